@@ -23,6 +23,15 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// IncludeEncryptedFilesPolicy includes the files encrypted with SOPS in
+	// the artifact.
+	IncludeEncryptedFilesPolicy = "Include"
+	// ExcludeEncryptedFilesPolicy excludes the files encrypted with SOPS
+	// from the artifact.
+	ExcludeEncryptedFilesPolicy = "Exclude"
+)
+
 // Artifact represents the output of a source synchronisation.
 type Artifact struct {
 	// Path is the relative file path of this artifact.
@@ -43,6 +52,21 @@ type Artifact struct {
 	// +optional
 	Checksum string `json:"checksum"`
 
+	// Encrypted is true if the artifact holds files encrypted with SOPS.
+	// +optional
+	Encrypted bool `json:"encrypted,omitempty"`
+
+	// SBOM is the HTTP address of the Software Bill of Materials of this
+	// artifact, describing its files and the Helm chart dependencies.
+	// +optional
+	SBOM string `json:"sbom,omitempty"`
+
+	// SkippedFiles holds the paths of the files skipped because they could
+	// not be read while archiving the artifact, e.g. because their path
+	// exceeds the limits of the file system.
+	// +optional
+	SkippedFiles []string `json:"skippedFiles,omitempty"`
+
 	// LastUpdateTime is the timestamp corresponding to the last update of this
 	// artifact.
 	// +required
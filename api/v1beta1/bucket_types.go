@@ -19,18 +19,30 @@ package v1beta1
 import (
 	"github.com/fluxcd/pkg/apis/meta"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
 	// BucketKind is the string representation of a Bucket.
 	BucketKind = "Bucket"
+
+	// AllowEmptyBucketPolicy produces an empty artifact when no object of
+	// the bucket is left to fetch by the ignore patterns.
+	AllowEmptyBucketPolicy = "Allow"
+	// FailEmptyBucketPolicy fails the reconciliation with the
+	// EmptyBucketReason when no object of the bucket is left to fetch by the
+	// ignore patterns.
+	FailEmptyBucketPolicy = "Fail"
 )
 
 // BucketSpec defines the desired state of an S3 compatible bucket
 type BucketSpec struct {
 	// The S3 compatible storage provider name, default ('generic').
-	// +kubebuilder:validation:Enum=generic;aws
+	// The 'swift' provider uses the OpenStack Swift API with Keystone v3
+	// authentication instead of S3. The 'r2' and 'b2' providers adapt the
+	// S3 client to Cloudflare R2 and Backblaze B2.
+	// +kubebuilder:validation:Enum=generic;aws;swift;r2;b2
 	// +kubebuilder:default:=generic
 	// +optional
 	Provider string `json:"provider,omitempty"`
@@ -39,7 +51,9 @@ type BucketSpec struct {
 	// +required
 	BucketName string `json:"bucketName"`
 
-	// The bucket endpoint address.
+	// The bucket endpoint address, in the '<host>[:<port>][/<path>]' format,
+	// without scheme.
+	// +kubebuilder:validation:Pattern=`^[^/]*[^/:]+(/.*)?$`
 	// +required
 	Endpoint string `json:"endpoint"`
 
@@ -51,6 +65,44 @@ type BucketSpec struct {
 	// +optional
 	Region string `json:"region,omitempty"`
 
+	// ForcePathStyle addresses the bucket with path-style requests
+	// ('https://<endpoint>/<bucket>/<key>') when true, and with
+	// virtual-host-style requests ('https://<bucket>.<endpoint>/<key>')
+	// when false. The style is detected from the endpoint when omitted.
+	// Ignored by the 'swift' provider.
+	// +optional
+	ForcePathStyle *bool `json:"forcePathStyle,omitempty"`
+
+	// EnableHTTP2 attempts to negotiate HTTP/2 with the TLS endpoint, instead
+	// of HTTP/1.1. Ignored by the 'swift' provider.
+	// +optional
+	EnableHTTP2 bool `json:"enableHTTP2,omitempty"`
+
+	// TransferAcceleration downloads the objects through the S3 Transfer
+	// Acceleration endpoint, which must be enabled on the bucket. Only
+	// effective on the Amazon S3 endpoints.
+	// +optional
+	TransferAcceleration bool `json:"transferAcceleration,omitempty"`
+
+	// RangedDownload downloads the objects larger than a part size with
+	// concurrent ranged GET requests. Ignored by the 'swift' provider.
+	// +optional
+	RangedDownload *BucketRangedDownload `json:"rangedDownload,omitempty"`
+
+	// Signing forces the requests to be signed with AWS Signature Version 4
+	// for the given region and service name, for the S3 compatible endpoints
+	// rejecting the ones detected by default. Ignored by the 'swift'
+	// provider.
+	// +optional
+	Signing *BucketSigning `json:"signing,omitempty"`
+
+	// Headers are extra HTTP headers sent with the requests to the endpoint,
+	// e.g. a User-Agent or a tracing header. They take precedence over the
+	// headers set with the --http-headers flag of the controller. The headers
+	// are not signed, so 'X-Amz-' headers are rejected by Amazon S3.
+	// +optional
+	Headers map[string]string `json:"headers,omitempty"`
+
 	// The name of the secret containing authentication credentials
 	// for the Bucket.
 	// +optional
@@ -65,20 +117,157 @@ type BucketSpec struct {
 	// +optional
 	Timeout *metav1.Duration `json:"timeout,omitempty"`
 
+	// Timeouts overrides the Timeout for the phases of the fetch, so that a
+	// slow download of large objects can be allowed more time than the
+	// listing of the bucket.
+	// +optional
+	Timeouts *BucketTimeouts `json:"timeouts,omitempty"`
+
 	// Ignore overrides the set of excluded patterns in the .sourceignore format
 	// (which is the same as .gitignore). If not provided, a default will be used,
 	// consult the documentation for your version to find out what those are.
 	// +optional
 	Ignore *string `json:"ignore,omitempty"`
 
+	// EncryptedFilesPolicy determines whether the files encrypted with SOPS
+	// are included in the artifact, 'Include' or 'Exclude', defaults to
+	// 'Include'. The Encrypted field of the artifact records whether it
+	// holds encrypted files.
+	// +kubebuilder:validation:Enum=Include;Exclude
+	// +optional
+	EncryptedFilesPolicy string `json:"encryptedFilesPolicy,omitempty"`
+
+	// IncludeMetadata records the content type, user metadata and last
+	// modified time of the objects in a .source-metadata.json file in the
+	// root of the artifact.
+	// +optional
+	IncludeMetadata bool `json:"includeMetadata,omitempty"`
+
+	// IncludeChecksums records the SHA-256 checksums of the files of the
+	// artifact in a SHA256SUMS file in its root, in the format of the
+	// sha256sum utility, for the consumers to verify the extracted files.
+	// +optional
+	IncludeChecksums bool `json:"includeChecksums,omitempty"`
+
+	// RequireObjectLock refuses to produce an artifact unless Object Lock is
+	// enabled on the bucket, as reported by the provider API. Not supported
+	// by the 'swift' provider.
+	// +optional
+	RequireObjectLock bool `json:"requireObjectLock,omitempty"`
+
+	// EmptyBucketPolicy determines whether a bucket with no object left to
+	// fetch by the ignore patterns results in an empty artifact, 'Allow', or
+	// fails the reconciliation, 'Fail'. Defaults to 'Allow'.
+	// +kubebuilder:validation:Enum=Allow;Fail
+	// +optional
+	EmptyBucketPolicy string `json:"emptyBucketPolicy,omitempty"`
+
+	// RevisionMode is how the revision of the artifact is computed, defaults
+	// to 'content'. The 'content' mode hashes the downloaded objects, while
+	// the 'listing' mode hashes the keys and ETags of the listed objects,
+	// which skips the download when the listing is unchanged.
+	// +kubebuilder:validation:Enum=content;listing
+	// +kubebuilder:default:=content
+	// +optional
+	RevisionMode string `json:"revisionMode,omitempty"`
+
+	// Publish pushes the artifacts to an OCI registry, for them to be
+	// distributed to other clusters by the registry replication.
+	// +optional
+	Publish *SourcePublish `json:"publish,omitempty"`
+
+	// Inline embeds the small artifacts in the Kubernetes API, for the
+	// consumers without network access to the artifact server.
+	// +optional
+	Inline *SourceInline `json:"inline,omitempty"`
+
+	// Window restricts the production of new artifacts to a recurring time
+	// window, the new revisions fetched outside of it being recorded as
+	// pending in the status until it opens.
+	// +optional
+	Window *SourceWindow `json:"window,omitempty"`
+
+	// DependsOn holds the sources the reconciliation of this source waits
+	// for, until they have a ready artifact at or above the given revisions.
+	// +optional
+	DependsOn []SourceDependency `json:"dependsOn,omitempty"`
+
+	// The maximum duration the artifact may go without an update, after which
+	// the ArtifactOutdated condition is set and a warning event is emitted,
+	// even if the reconciliations succeed. Disabled when not set.
+	// +optional
+	StaleAfter *metav1.Duration `json:"staleAfter,omitempty"`
+
 	// This flag tells the controller to suspend the reconciliation of this source.
 	// +optional
 	Suspend bool `json:"suspend,omitempty"`
+
+	// SuspendArtifact tells whether the artifact of the source is kept and
+	// served while the reconciliation is suspended, with 'Retain', or removed
+	// from the storage and the status, with 'Withdraw'. Defaults to 'Retain'.
+	// +kubebuilder:validation:Enum=Retain;Withdraw
+	// +optional
+	SuspendArtifact string `json:"suspendArtifact,omitempty"`
+}
+
+// BucketRangedDownload defines the ranged GET requests of the large objects.
+type BucketRangedDownload struct {
+	// PartSize is the size of the ranged GET requests, the objects larger
+	// than it are downloaded in parts. Defaults to 64Mi, can't be lower
+	// than 1Mi.
+	// +optional
+	PartSize *resource.Quantity `json:"partSize,omitempty"`
+
+	// Concurrency is the maximum number of concurrent ranged GET requests
+	// per object. Defaults to 4.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=32
+	// +optional
+	Concurrency int `json:"concurrency,omitempty"`
+}
+
+// BucketSigning defines the AWS Signature Version 4 signing of the requests.
+type BucketSigning struct {
+	// Region is the region the requests are signed for, which may be any
+	// string expected by the endpoint. Defaults to the region of the Bucket,
+	// or 'us-east-1' if not set.
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// Service is the service name the requests are signed for. Defaults to
+	// 's3'.
+	// +optional
+	Service string `json:"service,omitempty"`
+}
+
+// BucketTimeouts defines the timeouts of the phases of the fetch, which
+// default to the Timeout of the Bucket.
+type BucketTimeouts struct {
+	// Connect is the timeout for establishing a connection to the endpoint,
+	// including the TLS handshake.
+	// +optional
+	Connect *metav1.Duration `json:"connect,omitempty"`
+
+	// List is the timeout for checking the bucket and listing its objects.
+	// +optional
+	List *metav1.Duration `json:"list,omitempty"`
+
+	// Download is the timeout for downloading a single object.
+	// +optional
+	Download *metav1.Duration `json:"download,omitempty"`
 }
 
 const (
 	GenericBucketProvider string = "generic"
 	AmazonBucketProvider  string = "aws"
+	SwiftBucketProvider   string = "swift"
+	R2BucketProvider      string = "r2"
+	B2BucketProvider      string = "b2"
+)
+
+const (
+	ContentBucketRevisionMode string = "content"
+	ListingBucketRevisionMode string = "listing"
 )
 
 // BucketStatus defines the observed state of a bucket
@@ -92,6 +281,8 @@ type BucketStatus struct {
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 
 	// URL is the download link for the artifact output of the last Bucket sync.
+	// Deprecated: use the URL of the Artifact, the field is removed in
+	// v1beta2.
 	// +optional
 	URL string `json:"url,omitempty"`
 
@@ -99,6 +290,38 @@ type BucketStatus struct {
 	// +optional
 	Artifact *Artifact `json:"artifact,omitempty"`
 
+	// Preview is the result of the last dry-run reconciliation, set instead
+	// of the Artifact when the DryRunAnnotation is 'true'.
+	// +optional
+	Preview *SourcePreview `json:"preview,omitempty"`
+
+	// PublishedReference is the OCI reference, with digest, of the last
+	// artifact pushed to the Publish OCIRepository.
+	// +optional
+	PublishedReference string `json:"publishedReference,omitempty"`
+
+	// InlineArtifact is the last artifact embedded in the Kubernetes API
+	// according to the Inline spec.
+	// +optional
+	InlineArtifact *InlineArtifact `json:"inlineArtifact,omitempty"`
+
+	// PendingRevision is the revision fetched outside of the Window, for
+	// which no artifact is produced until the Window opens.
+	// +optional
+	PendingRevision string `json:"pendingRevision,omitempty"`
+
+	// LastFailure is the detail of the failure of the last reconciliation,
+	// removed once a reconciliation succeeds.
+	// +optional
+	LastFailure *SourceFailure `json:"lastFailure,omitempty"`
+
+	// NextReconcileAt is the time the next reconciliation is scheduled at,
+	// from the interval or the delay before the next attempt. Not set when
+	// the source is only reconciled on change or request, or when a failure
+	// is retried with an exponential backoff.
+	// +optional
+	NextReconcileAt *metav1.Time `json:"nextReconcileAt,omitempty"`
+
 	meta.ReconcileRequestStatus `json:",inline"`
 }
 
@@ -110,6 +333,19 @@ const (
 	// BucketOperationFailedReason represents the fact that the bucket listing or
 	// download operations failed.
 	BucketOperationFailedReason string = "BucketOperationFailed"
+
+	// ObjectLockNotEnabledReason represents the fact that Object Lock is
+	// required by the spec but not enabled on the bucket.
+	ObjectLockNotEnabledReason string = "ObjectLockNotEnabled"
+
+	// EmptyBucketReason represents the fact that no object of the bucket is
+	// left to fetch by the ignore patterns, while the EmptyBucketPolicy is
+	// FailEmptyBucketPolicy.
+	EmptyBucketReason string = "EmptyBucket"
+
+	// BucketSpecInvalidReason represents the fact that the spec of the Bucket
+	// combines its provider, endpoint and options in a way that can't succeed.
+	BucketSpecInvalidReason string = "BucketSpecInvalid"
 )
 
 // BucketProgressing resets the conditions of the Bucket to metav1.Condition of
@@ -119,7 +355,7 @@ func BucketProgressing(bucket Bucket) Bucket {
 	bucket.Status.ObservedGeneration = bucket.Generation
 	bucket.Status.URL = ""
 	bucket.Status.Conditions = []metav1.Condition{}
-	meta.SetResourceCondition(&bucket, meta.ReadyCondition, metav1.ConditionUnknown, meta.ProgressingReason, "reconciliation in progress")
+	SetReadyCondition(&bucket, metav1.ConditionUnknown, meta.ProgressingReason, "reconciliation in progress")
 	return bucket
 }
 
@@ -128,15 +364,50 @@ func BucketProgressing(bucket Bucket) Bucket {
 // the modified Bucket.
 func BucketReady(bucket Bucket, artifact Artifact, url, reason, message string) Bucket {
 	bucket.Status.Artifact = &artifact
+	bucket.Status.PendingRevision = ""
 	bucket.Status.URL = url
-	meta.SetResourceCondition(&bucket, meta.ReadyCondition, metav1.ConditionTrue, reason, message)
+	SetReadyCondition(&bucket, metav1.ConditionTrue, reason, message)
+	return bucket
+}
+
+// BucketPreviewed sets the given SourcePreview on the Bucket and sets the
+// meta.ReadyCondition to 'True', with the PreviewSucceededReason. It returns
+// the modified Bucket.
+func BucketPreviewed(bucket Bucket, preview SourcePreview) Bucket {
+	bucket.Status.Preview = &preview
+	SetReadyCondition(&bucket, metav1.ConditionTrue, PreviewSucceededReason, "Previewed revision: "+preview.Revision)
+	return bucket
+}
+
+// BucketPending sets the given revision as the PendingRevision of the Bucket
+// and sets the meta.ReadyCondition to 'True', with the WindowClosedReason and
+// the given message, the Artifact being kept. It returns the modified Bucket.
+func BucketPending(bucket Bucket, revision, message string) Bucket {
+	bucket.Status.PendingRevision = revision
+	SetReadyCondition(&bucket, metav1.ConditionTrue, WindowClosedReason, message)
 	return bucket
 }
 
 // BucketNotReady sets the meta.ReadyCondition on the Bucket to 'False', with
-// the given reason and message. It returns the modified Bucket.
+// the given reason and message, and unsets the time of the next
+// reconciliation. It returns the modified Bucket.
 func BucketNotReady(bucket Bucket, reason, message string) Bucket {
-	meta.SetResourceCondition(&bucket, meta.ReadyCondition, metav1.ConditionFalse, reason, message)
+	SetReadyCondition(&bucket, metav1.ConditionFalse, reason, message)
+	bucket.Status.NextReconcileAt = nil
+	return bucket
+}
+
+// BucketWithdrawn removes the artifacts from the status of the given
+// suspended Bucket and sets the meta.ReadyCondition to 'False', with the
+// ArtifactWithdrawnReason. It returns the modified Bucket.
+func BucketWithdrawn(bucket Bucket) Bucket {
+	bucket.Status.ObservedGeneration = bucket.Generation
+	bucket.Status.Artifact = nil
+	bucket.Status.InlineArtifact = nil
+	bucket.Status.PendingRevision = ""
+	bucket.Status.URL = ""
+	SetReadyCondition(&bucket, metav1.ConditionFalse, ArtifactWithdrawnReason, "artifact withdrawn while the reconciliation is suspended")
+	bucket.Status.NextReconcileAt = nil
 	return bucket
 }
 
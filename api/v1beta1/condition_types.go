@@ -16,8 +16,30 @@ limitations under the License.
 
 package v1beta1
 
+import (
+	"github.com/fluxcd/pkg/apis/meta"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
 const SourceFinalizer = "finalizers.fluxcd.io"
 
+const (
+	// ArtifactOutdatedCondition indicates the artifact of a source has not been
+	// updated within the duration set in the spec.
+	ArtifactOutdatedCondition string = "ArtifactOutdated"
+
+	// FetchFailedCondition indicates the last fetch of a source from its
+	// upstream failed, with a reason classifying the failure.
+	FetchFailedCondition string = "FetchFailed"
+
+	// RevisionOutdatedCondition indicates the revision fetched from the
+	// upstream of a source does not match the revision requested with the
+	// RequestedRevisionAnnotation, e.g. because it has not propagated to a
+	// mirror yet.
+	RevisionOutdatedCondition string = "RevisionOutdated"
+)
+
 const (
 	// URLInvalidReason represents the fact that a given source has an invalid URL.
 	URLInvalidReason string = "URLInvalid"
@@ -32,4 +54,90 @@ const (
 	// VerificationFailedReason represents the fact that the cryptographic
 	// provenance verification for the source failed.
 	VerificationFailedReason string = "VerificationFailed"
+
+	// ArtifactStaleReason represents the fact that the artifact of a source was
+	// last updated longer ago than allowed by the spec.
+	ArtifactStaleReason string = "ArtifactStale"
+
+	// PolicyViolationReason represents the fact that the endpoint of a source
+	// is not allowed by the endpoint policy of the controller.
+	PolicyViolationReason string = "PolicyViolation"
+
+	// AccessDeniedReason represents the fact that a source in another
+	// namespace is referenced while the cross-namespace references are not
+	// allowed by the controller.
+	AccessDeniedReason string = "AccessDenied"
+
+	// RevisionNotPropagatedReason represents the fact that the upstream of a
+	// source does not serve the revision requested with the
+	// RequestedRevisionAnnotation yet.
+	RevisionNotPropagatedReason string = "RevisionNotPropagated"
 )
+
+const (
+	// DNSResolutionFailedReason represents the fact that the host of the
+	// upstream of a source could not be resolved.
+	DNSResolutionFailedReason string = "DNSResolutionFailed"
+
+	// TLSHandshakeFailedReason represents the fact that the TLS connection to
+	// the upstream of a source could not be established.
+	TLSHandshakeFailedReason string = "TLSHandshakeFailed"
+
+	// UnauthorizedReason represents the fact that the upstream of a source
+	// rejected the credentials, with a 401 or 403 status code.
+	UnauthorizedReason string = "Unauthorized"
+
+	// NotFoundReason represents the fact that the upstream of a source does
+	// not exist, with a 404 status code.
+	NotFoundReason string = "NotFound"
+
+	// RateLimitedReason represents the fact that the upstream of a source
+	// throttled the requests, with a 429 status code.
+	RateLimitedReason string = "RateLimited"
+
+	// UpstreamUnavailableReason represents the fact that the upstream of a
+	// source failed to serve the requests, with a 5xx status code.
+	UpstreamUnavailableReason string = "UpstreamUnavailable"
+
+	// TimeoutReason represents the fact that the upstream of a source did not
+	// respond in time.
+	TimeoutReason string = "Timeout"
+)
+
+// stalledReasons are the reasons of the failures which are not recovered
+// from by retrying, the spec of the source having to change first.
+var stalledReasons = map[string]bool{
+	URLInvalidReason:        true,
+	PolicyViolationReason:   true,
+	AccessDeniedReason:      true,
+	BucketSpecInvalidReason: true,
+	WindowInvalidReason:     true,
+}
+
+// SetReadyCondition sets the meta.ReadyCondition on the given object with the
+// given status, reason and message, and summarizes it in the kstatus
+// compatible conditions:
+//
+//  - 'Unknown' sets meta.ReconcilingCondition to 'True', as the
+//    reconciliation is in progress.
+//  - 'False' sets meta.StalledCondition to 'True' if the failure is not
+//    recovered from without a change of the spec, e.g. with the
+//    URLInvalidReason, and meta.ReconcilingCondition to 'True' otherwise, as
+//    the reconciliation is retried.
+//  - 'True' removes both, as the source is up to date.
+func SetReadyCondition(obj meta.ObjectWithStatusConditions, status metav1.ConditionStatus, reason, message string) {
+	meta.SetResourceCondition(obj, meta.ReadyCondition, status, reason, message)
+
+	conditions := obj.GetStatusConditions()
+	switch {
+	case status == metav1.ConditionFalse && stalledReasons[reason]:
+		apimeta.RemoveStatusCondition(conditions, meta.ReconcilingCondition)
+		meta.SetResourceCondition(obj, meta.StalledCondition, metav1.ConditionTrue, reason, message)
+	case status == metav1.ConditionUnknown, status == metav1.ConditionFalse:
+		apimeta.RemoveStatusCondition(conditions, meta.StalledCondition)
+		meta.SetResourceCondition(obj, meta.ReconcilingCondition, metav1.ConditionTrue, reason, message)
+	default:
+		apimeta.RemoveStatusCondition(conditions, meta.ReconcilingCondition)
+		apimeta.RemoveStatusCondition(conditions, meta.StalledCondition)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetReadyCondition(t *testing.T) {
+	tests := []struct {
+		name            string
+		previous        []metav1.ConditionStatus
+		status          metav1.ConditionStatus
+		reason          string
+		wantReconciling bool
+		wantStalled     bool
+	}{
+		{
+			name:            "progressing",
+			status:          metav1.ConditionUnknown,
+			reason:          meta.ProgressingReason,
+			wantReconciling: true,
+		},
+		{
+			name:            "transient failure is retried",
+			status:          metav1.ConditionFalse,
+			reason:          GitOperationFailedReason,
+			wantReconciling: true,
+		},
+		{
+			name:            "authentication failure is retried",
+			status:          metav1.ConditionFalse,
+			reason:          AuthenticationFailedReason,
+			wantReconciling: true,
+		},
+		{
+			name:        "invalid URL stalls",
+			status:      metav1.ConditionFalse,
+			reason:      URLInvalidReason,
+			wantStalled: true,
+		},
+		{
+			name:        "policy violation stalls",
+			status:      metav1.ConditionFalse,
+			reason:      PolicyViolationReason,
+			wantStalled: true,
+		},
+		{
+			name:        "invalid bucket spec stalls",
+			status:      metav1.ConditionFalse,
+			reason:      BucketSpecInvalidReason,
+			wantStalled: true,
+		},
+		{
+			name:        "stalled after progressing",
+			previous:    []metav1.ConditionStatus{metav1.ConditionUnknown},
+			status:      metav1.ConditionFalse,
+			reason:      URLInvalidReason,
+			wantStalled: true,
+		},
+		{
+			name:     "ready after stalled",
+			previous: []metav1.ConditionStatus{metav1.ConditionFalse},
+			status:   metav1.ConditionTrue,
+			reason:   meta.ReconciliationSucceededReason,
+		},
+		{
+			name:            "retried after stalled",
+			previous:        []metav1.ConditionStatus{metav1.ConditionFalse},
+			status:          metav1.ConditionUnknown,
+			reason:          meta.ProgressingReason,
+			wantReconciling: true,
+		},
+		{
+			name:     "ready after retried",
+			previous: []metav1.ConditionStatus{metav1.ConditionUnknown, metav1.ConditionFalse},
+			status:   metav1.ConditionTrue,
+			reason:   meta.ReconciliationSucceededReason,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &GitRepository{}
+			for _, status := range tt.previous {
+				SetReadyCondition(obj, status, URLInvalidReason, "previous")
+			}
+			SetReadyCondition(obj, tt.status, tt.reason, "message")
+
+			if c := apimeta.FindStatusCondition(obj.Status.Conditions, meta.ReadyCondition); c == nil || c.Status != tt.status || c.Reason != tt.reason {
+				t.Errorf("Ready condition = %v, want %s with reason %s", c, tt.status, tt.reason)
+			}
+			if got := apimeta.IsStatusConditionTrue(obj.Status.Conditions, meta.ReconcilingCondition); got != tt.wantReconciling {
+				t.Errorf("Reconciling = %v, want %v", got, tt.wantReconciling)
+			}
+			if got := apimeta.IsStatusConditionTrue(obj.Status.Conditions, meta.StalledCondition); got != tt.wantStalled {
+				t.Errorf("Stalled = %v, want %v", got, tt.wantStalled)
+			}
+			if c := apimeta.FindStatusCondition(obj.Status.Conditions, meta.StalledCondition); c != nil && c.Reason != tt.reason {
+				t.Errorf("Stalled reason = %s, want %s", c.Reason, tt.reason)
+			}
+		})
+	}
+}
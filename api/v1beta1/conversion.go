@@ -0,0 +1,25 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+// Hub marks the GitRepository as the version the other GitRepository
+// versions are converted from and to, being the storage version.
+func (*GitRepository) Hub() {}
+
+// Hub marks the Bucket as the version the other Bucket versions are
+// converted from and to, being the storage version.
+func (*Bucket) Hub() {}
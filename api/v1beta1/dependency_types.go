@@ -0,0 +1,40 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+// SourceDependency is a source in the same namespace the reconciliation of a
+// source waits for, until it has a ready artifact at or above the given
+// revision.
+type SourceDependency struct {
+	// Kind of the source depended on.
+	// +kubebuilder:validation:Enum=GitRepository;HelmRepository;HelmChart;Bucket
+	// +required
+	Kind string `json:"kind"`
+
+	// Name of the source depended on.
+	// +required
+	Name string `json:"name"`
+
+	// Revision is the minimum revision of the artifact of the source depended
+	// on. The revisions are compared as semantic versions when both are, the
+	// Git revisions being compared by their branch or tag, e.g. 'v1.2.0' for
+	// 'v1.2.0/<commit>'. Otherwise, the revision must be the one of the
+	// artifact, or a prefix of its Git commit SHA. Any revision is accepted
+	// when not set.
+	// +optional
+	Revision string `json:"revision,omitempty"`
+}
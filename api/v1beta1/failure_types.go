@@ -0,0 +1,80 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ValidationFailurePhase is the phase of the failures caused by the spec
+	// of a source, e.g. an invalid URL or a policy violation.
+	ValidationFailurePhase string = "Validation"
+
+	// DependencyFailurePhase is the phase of the failures caused by the
+	// sources a source depends on not being ready.
+	DependencyFailurePhase string = "Dependency"
+
+	// AuthenticationFailurePhase is the phase of the failures to load the
+	// credentials of a source, or of their rejection by the upstream.
+	AuthenticationFailurePhase string = "Authentication"
+
+	// FetchFailurePhase is the phase of the failures to fetch the content of
+	// a source from its upstream.
+	FetchFailurePhase string = "Fetch"
+
+	// VerificationFailurePhase is the phase of the failures to verify the
+	// fetched content of a source, e.g. its signature or digest.
+	VerificationFailurePhase string = "Verification"
+
+	// BuildFailurePhase is the phase of the failures to build the artifact
+	// of a source from the fetched content, e.g. to package a Helm chart.
+	BuildFailurePhase string = "Build"
+
+	// StorageFailurePhase is the phase of the failures to write the artifact
+	// of a source to the storage.
+	StorageFailurePhase string = "Storage"
+)
+
+// SourceFailure is the machine-readable detail of the failure of the last
+// reconciliation of a source, in addition to the human-oriented message of
+// the Ready condition.
+type SourceFailure struct {
+	// Time is when the reconciliation failed.
+	// +required
+	Time metav1.Time `json:"time"`
+
+	// Phase is the phase of the reconciliation that failed.
+	// +kubebuilder:validation:Enum=Validation;Dependency;Authentication;Fetch;Verification;Build;Storage
+	// +required
+	Phase string `json:"phase"`
+
+	// Reason is the reason of the failure, classifying the fetch failures
+	// by their cause when known, e.g. 'RateLimited'.
+	// +required
+	Reason string `json:"reason"`
+
+	// StatusCode is the HTTP status code of the upstream response the
+	// failure was caused by, if any.
+	// +optional
+	StatusCode int `json:"statusCode,omitempty"`
+
+	// Retriable tells whether the reconciliation may succeed when retried
+	// without changes, as opposed to the failures requiring a change of the
+	// source, its credentials or its upstream.
+	Retriable bool `json:"retriable"`
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package v1beta1
 
 import (
+	"time"
+
 	"github.com/fluxcd/pkg/apis/meta"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -26,10 +28,38 @@ const (
 	// GitRepositoryKind is the string representation of a GitRepository.
 	GitRepositoryKind = "GitRepository"
 
+	// RequestedRevisionAnnotation is the annotation which, set alongside the
+	// meta.ReconcileRequestAnnotation, e.g. by a webhook receiver, holds the
+	// revision the reconciliation is requested for: a commit SHA, possibly
+	// abbreviated, or a '<branch>/<commit>' revision.
+	RequestedRevisionAnnotation = "reconcile.fluxcd.io/requestedRevision"
+
 	// GoGitImplementation represents the go-git Git implementation kind.
 	GoGitImplementation = "go-git"
 	// LibGit2Implementation represents the git2go Git implementation kind.
 	LibGit2Implementation = "libgit2"
+
+	// RepositorySemVerScope matches the SemVer expression against all the
+	// tags of the repository.
+	RepositorySemVerScope = "repository"
+	// BranchSemVerScope matches the SemVer expression against the tags
+	// reachable from the branch.
+	BranchSemVerScope = "branch"
+
+	// ProceedHistoryRewritePolicy accepts the revisions of rewritten branch
+	// histories without checking.
+	ProceedHistoryRewritePolicy = "Proceed"
+	// WarnHistoryRewritePolicy accepts the revisions of rewritten branch
+	// histories, and emits a warning event.
+	WarnHistoryRewritePolicy = "Warn"
+	// FailHistoryRewritePolicy refuses the revisions of rewritten branch
+	// histories, and keeps the current artifact.
+	FailHistoryRewritePolicy = "Fail"
+
+	// GitHubArchiveProvider fetches the archives from the GitHub REST API.
+	GitHubArchiveProvider = "github"
+	// GitLabArchiveProvider fetches the archives from the GitLab REST API.
+	GitLabArchiveProvider = "gitlab"
 )
 
 // GitRepositorySpec defines the desired state of a Git repository.
@@ -51,16 +81,64 @@ type GitRepositorySpec struct {
 	// +required
 	Interval metav1.Duration `json:"interval"`
 
+	// PushOnly disables the checks for repository updates at the Interval,
+	// the repository is then only reconciled on request, for example by a
+	// webhook receiver on push events, and at the FallbackInterval.
+	// +optional
+	PushOnly bool `json:"pushOnly,omitempty"`
+
+	// The interval at which to check for repository updates in PushOnly mode,
+	// as a fallback for missed push events. Disabled when not set.
+	// +optional
+	FallbackInterval *metav1.Duration `json:"fallbackInterval,omitempty"`
+
 	// The timeout for remote Git operations like cloning, defaults to 20s.
 	// +kubebuilder:default="20s"
 	// +optional
 	Timeout *metav1.Duration `json:"timeout,omitempty"`
 
+	// The SOCKS5 proxy to connect to the repository through, in the
+	// 'socks5://host:port' format. Only supported for SSH repositories.
+	// Overrides the proxy set with the --ssh-proxy flag of the controller.
+	// +kubebuilder:validation:Pattern="^socks5://"
+	// +optional
+	SSHProxy string `json:"sshProxy,omitempty"`
+
+	// Headers are extra HTTP headers sent with the requests to HTTP/S
+	// repositories, e.g. a User-Agent or a tracing header. They take
+	// precedence over the headers set with the --http-headers flag of the
+	// controller.
+	// +optional
+	Headers map[string]string `json:"headers,omitempty"`
+
 	// The Git reference to checkout and monitor for changes, defaults to
 	// master branch.
 	// +optional
 	Reference *GitRepositoryRef `json:"ref,omitempty"`
 
+	// HistoryRewritePolicy determines how to handle a rewrite of the branch
+	// history, e.g. by a force-push, detected when the revision of the
+	// current artifact is not reachable from the branch anymore.
+	// 'Proceed' accepts the new revision without checking, 'Warn' accepts it
+	// and emits a warning event, and 'Fail' refuses it and keeps the current
+	// artifact. Only applies to branch references, defaults to 'Proceed'.
+	// With 'Warn' and 'Fail', the full history of the branch is cloned.
+	// +kubebuilder:validation:Enum=Proceed;Warn;Fail
+	// +optional
+	HistoryRewritePolicy string `json:"historyRewritePolicy,omitempty"`
+
+	// IncludeMetadata records the commit SHA, author, committer, message,
+	// reference and signature status of the checked out commit in a
+	// .git-metadata.yaml file in the root of the artifact.
+	// +optional
+	IncludeMetadata bool `json:"includeMetadata,omitempty"`
+
+	// IncludeChecksums records the SHA-256 checksums of the files of the
+	// artifact in a SHA256SUMS file in its root, in the format of the
+	// sha256sum utility, for the consumers to verify the extracted files.
+	// +optional
+	IncludeChecksums bool `json:"includeChecksums,omitempty"`
+
 	// Verify OpenPGP signature for the Git commit HEAD points to.
 	// +optional
 	Verification *GitRepositoryVerification `json:"verify,omitempty"`
@@ -71,10 +149,31 @@ type GitRepositorySpec struct {
 	// +optional
 	Ignore *string `json:"ignore,omitempty"`
 
+	// EncryptedFilesPolicy determines whether the files encrypted with SOPS
+	// are included in the artifact, 'Include' or 'Exclude', defaults to
+	// 'Include'. The Encrypted field of the artifact records whether it
+	// holds encrypted files.
+	// +kubebuilder:validation:Enum=Include;Exclude
+	// +optional
+	EncryptedFilesPolicy string `json:"encryptedFilesPolicy,omitempty"`
+
+	// The maximum duration the artifact may go without an update, after which
+	// the ArtifactOutdated condition is set and a warning event is emitted,
+	// even if the reconciliations succeed. Disabled when not set.
+	// +optional
+	StaleAfter *metav1.Duration `json:"staleAfter,omitempty"`
+
 	// This flag tells the controller to suspend the reconciliation of this source.
 	// +optional
 	Suspend bool `json:"suspend,omitempty"`
 
+	// SuspendArtifact tells whether the artifact of the source is kept and
+	// served while the reconciliation is suspended, with 'Retain', or removed
+	// from the storage and the status, with 'Withdraw'. Defaults to 'Retain'.
+	// +kubebuilder:validation:Enum=Retain;Withdraw
+	// +optional
+	SuspendArtifact string `json:"suspendArtifact,omitempty"`
+
 	// Determines which git client library to use.
 	// Defaults to go-git, valid values are ('go-git', 'libgit2').
 	// +kubebuilder:validation:Enum=go-git;libgit2
@@ -88,6 +187,72 @@ type GitRepositorySpec struct {
 	// +optional
 	RecurseSubmodules bool `json:"recurseSubmodules,omitempty"`
 
+	// SubmoduleDepth is the maximum depth of the nested submodules initialized
+	// when RecurseSubmodules is enabled, the submodules of the repository being
+	// at depth 1. Defaults to 10.
+	// This option is available only when using the 'go-git' GitImplementation.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	SubmoduleDepth int `json:"submoduleDepth,omitempty"`
+
+	// SubmodulePaths is the allowlist of the paths of the submodules initialized
+	// when RecurseSubmodules is enabled, relative to the root of the repository.
+	// The submodules nested in the allowed ones, and the ones an allowed path is
+	// nested in, are initialized as well. Defaults to all the submodules.
+	// This option is available only when using the 'go-git' GitImplementation.
+	// +optional
+	SubmodulePaths []string `json:"submodulePaths,omitempty"`
+
+	// BundleURL is the HTTP/S URL of a Git bundle of the repository, e.g.
+	// hosted on a CDN, to bootstrap the clone from. The objects missing
+	// from the bundle are then fetched from the repository.
+	// This option is available only when using the 'go-git' GitImplementation,
+	// and not supported with SemVer references.
+	// +kubebuilder:validation:Pattern="^https?://"
+	// +optional
+	BundleURL string `json:"bundleURL,omitempty"`
+
+	// ArchiveProvider fetches the archive of the revision from the REST API
+	// of the given Git provider, instead of cloning the repository, which is
+	// faster for large repositories. The URL must be the HTTP/S URL of a
+	// repository of the provider, and the 'password' of the secretRef the
+	// API token. The verification, the history rewrite policies, the
+	// submodules, the bundle and the SemVer references are not supported.
+	// +kubebuilder:validation:Enum=github;gitlab
+	// +optional
+	ArchiveProvider string `json:"archiveProvider,omitempty"`
+
+	// PartialClone fetches the blobs of the files not ignored by the
+	// .sourceignore files and spec.ignore only, with the filters of the Git
+	// protocol v2, which is faster for repositories with large ignored files.
+	// This option is available only when using the 'go-git' GitImplementation,
+	// for the branch and tag references of HTTP/S repositories, the others
+	// and the repositories of servers not supporting the filters being
+	// cloned fully.
+	// +optional
+	PartialClone bool `json:"partialClone,omitempty"`
+
+	// Publish pushes the artifacts to an OCI registry, for them to be
+	// distributed to other clusters by the registry replication.
+	// +optional
+	Publish *SourcePublish `json:"publish,omitempty"`
+
+	// Inline embeds the small artifacts in the Kubernetes API, for the
+	// consumers without network access to the artifact server.
+	// +optional
+	Inline *SourceInline `json:"inline,omitempty"`
+
+	// Window restricts the production of new artifacts to a recurring time
+	// window, the new revisions fetched outside of it being recorded as
+	// pending in the status until it opens.
+	// +optional
+	Window *SourceWindow `json:"window,omitempty"`
+
+	// DependsOn holds the sources the reconciliation of this source waits
+	// for, until they have a ready artifact at or above the given revisions.
+	// +optional
+	DependsOn []SourceDependency `json:"dependsOn,omitempty"`
+
 	// Extra git repositories to map into the repository
 	Include []GitRepositoryInclude `json:"include,omitempty"`
 }
@@ -132,6 +297,13 @@ type GitRepositoryRef struct {
 	// +optional
 	SemVer string `json:"semver,omitempty"`
 
+	// The scope of the tags matched by SemVer, defaults to 'repository'.
+	// With 'branch', only the tags reachable from Branch are considered, so
+	// the tags of other branches do not supersede them.
+	// +kubebuilder:validation:Enum=repository;branch
+	// +optional
+	SemVerScope string `json:"semverScope,omitempty"`
+
 	// The Git commit SHA to checkout, if specified Tag filters will be ignored.
 	// +optional
 	Commit string `json:"commit,omitempty"`
@@ -145,6 +317,13 @@ type GitRepositoryVerification struct {
 
 	// The secret name containing the public keys of all trusted Git authors.
 	SecretRef meta.LocalObjectReference `json:"secretRef,omitempty"`
+
+	// SignersRef references a ConfigMap holding a signer policy in its
+	// 'signers' key, in the CODEOWNERS format mapping path patterns to the
+	// names of the keys of the secret allowed to sign the commits changing
+	// them. The last matching pattern of each changed path applies.
+	// +optional
+	SignersRef *meta.LocalObjectReference `json:"signersRef,omitempty"`
 }
 
 // GitRepositoryStatus defines the observed state of a Git repository.
@@ -159,6 +338,8 @@ type GitRepositoryStatus struct {
 
 	// URL is the download link for the artifact output of the last repository
 	// sync.
+	// Deprecated: use the URL of the Artifact, the field is removed in
+	// v1beta2.
 	// +optional
 	URL string `json:"url,omitempty"`
 
@@ -170,9 +351,78 @@ type GitRepositoryStatus struct {
 	// +optional
 	IncludedArtifacts []*Artifact `json:"includedArtifacts,omitempty"`
 
+	// Preview is the result of the last dry-run reconciliation, set instead
+	// of the Artifact when the DryRunAnnotation is 'true'.
+	// +optional
+	Preview *SourcePreview `json:"preview,omitempty"`
+
+	// RetryAfter is the delay before the next attempt requested by the
+	// upstream with a Retry-After header after the last fetch was rate
+	// limited, which replaces the interval until the next fetch succeeds.
+	// +optional
+	RetryAfter *metav1.Duration `json:"retryAfter,omitempty"`
+
+	// PublishedReference is the OCI reference, with digest, of the last
+	// artifact pushed to the Publish OCIRepository.
+	// +optional
+	PublishedReference string `json:"publishedReference,omitempty"`
+
+	// InlineArtifact is the last artifact embedded in the Kubernetes API
+	// according to the Inline spec.
+	// +optional
+	InlineArtifact *InlineArtifact `json:"inlineArtifact,omitempty"`
+
+	// PendingRevision is the revision fetched outside of the Window, for
+	// which no artifact is produced until the Window opens.
+	// +optional
+	PendingRevision string `json:"pendingRevision,omitempty"`
+
+	// Tag is the metadata of the tag the artifact was fetched from, set when
+	// the reference is a tag or a semver range.
+	// +optional
+	Tag *GitTag `json:"tag,omitempty"`
+
+	// LastFailure is the detail of the failure of the last reconciliation,
+	// removed once a reconciliation succeeds.
+	// +optional
+	LastFailure *SourceFailure `json:"lastFailure,omitempty"`
+
+	// NextReconcileAt is the time the next reconciliation is scheduled at,
+	// from the interval or the delay before the next attempt. Not set when
+	// the source is only reconciled on change or request, or when a failure
+	// is retried with an exponential backoff.
+	// +optional
+	NextReconcileAt *metav1.Time `json:"nextReconcileAt,omitempty"`
+
 	meta.ReconcileRequestStatus `json:",inline"`
 }
 
+// GitTag holds the metadata of a Git tag.
+type GitTag struct {
+	// Name is the name of the tag.
+	// +required
+	Name string `json:"name"`
+
+	// Annotated is true if the tag is an annotated tag object, false if it is
+	// a lightweight tag.
+	// +required
+	Annotated bool `json:"annotated"`
+
+	// Tagger is the tagger of an annotated tag, in the 'Name <email>' format.
+	// +optional
+	Tagger string `json:"tagger,omitempty"`
+
+	// TaggedAt is the time an annotated tag was created.
+	// +optional
+	TaggedAt *metav1.Time `json:"taggedAt,omitempty"`
+
+	// Signature is the status of the PGP signature of the tag, one of
+	// 'verified', 'unverified' or 'unsigned'. A signature is 'verified'
+	// against the keys of the verification secret, if any.
+	// +required
+	Signature string `json:"signature"`
+}
+
 const (
 	// GitOperationSucceedReason represents the fact that the git clone, pull
 	// and checkout operations succeeded.
@@ -181,6 +431,11 @@ const (
 	// GitOperationFailedReason represents the fact that the git clone, pull or
 	// checkout operations failed.
 	GitOperationFailedReason string = "GitOperationFailed"
+
+	// HistoryRewrittenReason represents the fact that the revision of the
+	// current artifact is not reachable from the branch anymore, and that the
+	// new revision was refused by the history rewrite policy.
+	HistoryRewrittenReason string = "HistoryRewritten"
 )
 
 // GitRepositoryProgressing resets the conditions of the GitRepository to
@@ -191,7 +446,7 @@ func GitRepositoryProgressing(repository GitRepository) GitRepository {
 	repository.Status.ObservedGeneration = repository.Generation
 	repository.Status.URL = ""
 	repository.Status.Conditions = []metav1.Condition{}
-	meta.SetResourceCondition(&repository, meta.ReadyCondition, metav1.ConditionUnknown, meta.ProgressingReason, "reconciliation in progress")
+	SetReadyCondition(&repository, metav1.ConditionUnknown, meta.ProgressingReason, "reconciliation in progress")
 	return repository
 }
 
@@ -200,17 +455,53 @@ func GitRepositoryProgressing(repository GitRepository) GitRepository {
 // returns the modified GitRepository.
 func GitRepositoryReady(repository GitRepository, artifact Artifact, includedArtifacts []*Artifact, url, reason, message string) GitRepository {
 	repository.Status.Artifact = &artifact
+	repository.Status.PendingRevision = ""
 	repository.Status.IncludedArtifacts = includedArtifacts
 	repository.Status.URL = url
-	meta.SetResourceCondition(&repository, meta.ReadyCondition, metav1.ConditionTrue, reason, message)
+	SetReadyCondition(&repository, metav1.ConditionTrue, reason, message)
+	return repository
+}
+
+// GitRepositoryPreviewed sets the given SourcePreview on the GitRepository and sets the
+// meta.ReadyCondition to 'True', with the PreviewSucceededReason. It returns
+// the modified GitRepository.
+func GitRepositoryPreviewed(repository GitRepository, preview SourcePreview) GitRepository {
+	repository.Status.Preview = &preview
+	SetReadyCondition(&repository, metav1.ConditionTrue, PreviewSucceededReason, "Previewed revision: "+preview.Revision)
+	return repository
+}
+
+// GitRepositoryPending sets the given revision as the PendingRevision of the
+// GitRepository and sets the meta.ReadyCondition to 'True', with the
+// WindowClosedReason and the given message, the Artifact being kept. It returns
+// the modified GitRepository.
+func GitRepositoryPending(repository GitRepository, revision, message string) GitRepository {
+	repository.Status.PendingRevision = revision
+	SetReadyCondition(&repository, metav1.ConditionTrue, WindowClosedReason, message)
 	return repository
 }
 
 // GitRepositoryNotReady sets the meta.ReadyCondition on the given GitRepository
-// to 'False', with the given reason and message. It returns the modified
-// GitRepository.
+// to 'False', with the given reason and message, and unsets the time of the
+// next reconciliation. It returns the modified GitRepository.
 func GitRepositoryNotReady(repository GitRepository, reason, message string) GitRepository {
-	meta.SetResourceCondition(&repository, meta.ReadyCondition, metav1.ConditionFalse, reason, message)
+	SetReadyCondition(&repository, metav1.ConditionFalse, reason, message)
+	repository.Status.NextReconcileAt = nil
+	return repository
+}
+
+// GitRepositoryWithdrawn removes the artifacts from the status of the given
+// suspended GitRepository and sets the meta.ReadyCondition to 'False', with the
+// ArtifactWithdrawnReason. It returns the modified GitRepository.
+func GitRepositoryWithdrawn(repository GitRepository) GitRepository {
+	repository.Status.ObservedGeneration = repository.Generation
+	repository.Status.Artifact = nil
+	repository.Status.IncludedArtifacts = nil
+	repository.Status.InlineArtifact = nil
+	repository.Status.PendingRevision = ""
+	repository.Status.URL = ""
+	SetReadyCondition(&repository, metav1.ConditionFalse, ArtifactWithdrawnReason, "artifact withdrawn while the reconciliation is suspended")
+	repository.Status.NextReconcileAt = nil
 	return repository
 }
 
@@ -241,6 +532,18 @@ func (in *GitRepository) GetInterval() metav1.Duration {
 	return in.Spec.Interval
 }
 
+// GetRequeueAfter returns the duration after which the repository is checked
+// for updates, which is zero if it is only reconciled on request.
+func (in *GitRepository) GetRequeueAfter() time.Duration {
+	if !in.Spec.PushOnly {
+		return in.Spec.Interval.Duration
+	}
+	if in.Spec.FallbackInterval != nil {
+		return in.Spec.FallbackInterval.Duration
+	}
+	return 0
+}
+
 // +genclient
 // +genclient:Namespaced
 // +kubebuilder:object:root=true
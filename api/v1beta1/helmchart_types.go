@@ -28,18 +28,32 @@ const HelmChartKind = "HelmChart"
 // HelmChartSpec defines the desired state of a Helm chart.
 type HelmChartSpec struct {
 	// The name or path the Helm chart is available at in the SourceRef.
+	// For GitRepository and Bucket sources, the path can be a glob pattern
+	// (e.g. 'charts/*') matching multiple charts, in which case every match
+	// is packaged and the artifact is a tarball holding all chart packages.
 	// +required
 	Chart string `json:"chart"`
 
 	// The chart version semver expression, ignored for charts from GitRepository
 	// and Bucket sources. Defaults to latest when omitted.
+	// The version may be pinned to the SHA-256 digest of the chart package,
+	// e.g. '1.2.3@sha256:<digest>', for a chart of the version whose package
+	// changed upstream to be refused.
 	// +kubebuilder:default:=*
 	// +optional
 	Version string `json:"version,omitempty"`
 
-	// The reference to the Source the chart is available at.
-	// +required
-	SourceRef LocalHelmChartSourceReference `json:"sourceRef"`
+	// The reference to the Source the chart is available at, required
+	// unless the ChartRef is set.
+	// +optional
+	SourceRef LocalHelmChartSourceReference `json:"sourceRef,omitempty"`
+
+	// ChartRef references a chart package by URL, e.g. a vendored chart on a
+	// static file server, bypassing the index of a HelmRepository. When set,
+	// the SourceRef and the Version are ignored, and the Chart must be the
+	// name of the chart in the package.
+	// +optional
+	ChartRef *HelmChartURLReference `json:"chartRef,omitempty"`
 
 	// The interval at which to check the Source for updates.
 	// +required
@@ -60,9 +74,73 @@ type HelmChartSpec struct {
 	// +deprecated
 	ValuesFile string `json:"valuesFile,omitempty"`
 
+	// PackageExclude holds patterns in the gitignore format, relative to the
+	// chart root, of the files left out of the chart package, e.g.
+	// 'charts/*/tests/' to drop the tests of the dependencies. Setting it
+	// causes the chart to be repackaged, the Chart.yaml and values.yaml files
+	// are always kept.
+	// +optional
+	PackageExclude []string `json:"packageExclude,omitempty"`
+
+	// FrozenDependencies requires the dependencies of the charts built from
+	// a GitRepository or a Bucket to be locked by a Chart.lock file in sync
+	// with the Chart.yaml, and built at their locked versions. The build
+	// fails if an update of the dependencies would change their versions.
+	// +optional
+	FrozenDependencies bool `json:"frozenDependencies,omitempty"`
+
+	// VersionTemplate sets the version and the appVersion of the charts
+	// built from a GitRepository from the Git metadata of its artifact, for
+	// every commit to produce a uniquely versioned chart. Ignored for the
+	// other sources.
+	// +optional
+	VersionTemplate *HelmChartVersionTemplate `json:"versionTemplate,omitempty"`
+
+	// HistoryLimit is the number of previous chart artifacts kept in storage
+	// and listed in the status History, so they stay downloadable after a
+	// newer version is packaged, e.g. for rollbacks. Disabled when 0.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=20
+	// +optional
+	HistoryLimit int `json:"historyLimit,omitempty"`
+
+	// Publish pushes the artifacts to an OCI registry, for them to be
+	// distributed to other clusters by the registry replication.
+	// +optional
+	Publish *SourcePublish `json:"publish,omitempty"`
+
+	// Inline embeds the small artifacts in the Kubernetes API, for the
+	// consumers without network access to the artifact server.
+	// +optional
+	Inline *SourceInline `json:"inline,omitempty"`
+
+	// Window restricts the production of new artifacts to a recurring time
+	// window, the new revisions fetched outside of it being recorded as
+	// pending in the status until it opens.
+	// +optional
+	Window *SourceWindow `json:"window,omitempty"`
+
+	// DependsOn holds the sources the reconciliation of this source waits
+	// for, until they have a ready artifact at or above the given revisions.
+	// +optional
+	DependsOn []SourceDependency `json:"dependsOn,omitempty"`
+
+	// The maximum duration the artifact may go without an update, after which
+	// the ArtifactOutdated condition is set and a warning event is emitted,
+	// even if the reconciliations succeed. Disabled when not set.
+	// +optional
+	StaleAfter *metav1.Duration `json:"staleAfter,omitempty"`
+
 	// This flag tells the controller to suspend the reconciliation of this source.
 	// +optional
 	Suspend bool `json:"suspend,omitempty"`
+
+	// SuspendArtifact tells whether the artifact of the source is kept and
+	// served while the reconciliation is suspended, with 'Retain', or removed
+	// from the storage and the status, with 'Withdraw'. Defaults to 'Retain'.
+	// +kubebuilder:validation:Enum=Retain;Withdraw
+	// +optional
+	SuspendArtifact string `json:"suspendArtifact,omitempty"`
 }
 
 // LocalHelmChartSourceReference contains enough information to let you locate
@@ -73,14 +151,58 @@ type LocalHelmChartSourceReference struct {
 	APIVersion string `json:"apiVersion,omitempty"`
 
 	// Kind of the referent, valid values are ('HelmRepository', 'GitRepository',
-	// 'Bucket').
+	// 'Bucket'). Required unless the ChartRef of the HelmChart is set.
 	// +kubebuilder:validation:Enum=HelmRepository;GitRepository;Bucket
-	// +required
-	Kind string `json:"kind"`
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// Name of the referent. Required unless the ChartRef of the HelmChart is
+	// set.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Namespace of the referent, defaults to the namespace of the HelmChart.
+	// The references to other namespaces are refused unless the controller
+	// runs with '--no-cross-namespace-refs=false'.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
 
-	// Name of the referent.
+// HelmChartURLReference references a chart package by URL.
+type HelmChartURLReference struct {
+	// The HTTP/S URL of the chart package.
+	// +kubebuilder:validation:Pattern="^https?://"
 	// +required
-	Name string `json:"name"`
+	URL string `json:"url"`
+
+	// The name of the secret containing the authentication credentials for
+	// the URL, in the same format as for the HelmRepository.
+	// +optional
+	SecretRef *meta.LocalObjectReference `json:"secretRef,omitempty"`
+
+	// The timeout of the download, defaults to 60s.
+	// +kubebuilder:default:="60s"
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// HelmChartVersionTemplate holds the Go templates of the version and the
+// appVersion of a chart built from a GitRepository. The templates are
+// executed with the '.Version' and '.AppVersion' of the Chart.yaml, the
+// '.Tag' or the '.Branch' the artifact was fetched from, and its '.Commit'
+// and '.ShortCommit', the first 7 characters of the commit hash.
+type HelmChartVersionTemplate struct {
+	// Version is the template of the version of the chart, e.g.
+	// '0.0.0-{{ .ShortCommit }}' or '{{ .Version }}+{{ .ShortCommit }}'.
+	// The result must be a semver version. The version of the Chart.yaml is
+	// kept when empty.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// AppVersion is the template of the appVersion of the chart, e.g.
+	// '{{ .Tag }}'. The appVersion of the Chart.yaml is kept when empty.
+	// +optional
+	AppVersion string `json:"appVersion,omitempty"`
 }
 
 // HelmChartStatus defines the observed state of the HelmChart.
@@ -101,9 +223,114 @@ type HelmChartStatus struct {
 	// +optional
 	Artifact *Artifact `json:"artifact,omitempty"`
 
+	// History holds the previous artifacts kept in storage when the
+	// HistoryLimit is set, sorted from the latest to the oldest one.
+	// +optional
+	History []Artifact `json:"history,omitempty"`
+
+	// Charts holds the status of every chart matched by the Chart glob
+	// pattern during the last reconciliation.
+	// +optional
+	Charts []HelmChartEntry `json:"charts,omitempty"`
+
+	// VersionResolution describes how the version of the chart was selected
+	// from the HelmRepository index, the last time a new version was packaged.
+	// +optional
+	VersionResolution *HelmChartVersionResolution `json:"versionResolution,omitempty"`
+
+	// ValuesChecksum is the checksum of the merged ValuesFiles the artifact
+	// was packaged with. The chart is not repackaged if neither the merged
+	// values nor the chart version changed.
+	// +optional
+	ValuesChecksum string `json:"valuesChecksum,omitempty"`
+
+	// BuildCacheKey is the checksum of the source revision, the generation
+	// and the ValuesChecksum the artifact was built from, for charts from a
+	// GitRepository or Bucket. The source is not unpacked again while the
+	// key is unchanged.
+	// +optional
+	BuildCacheKey string `json:"buildCacheKey,omitempty"`
+
+	// PublishedReference is the OCI reference, with digest, of the last
+	// artifact pushed to the Publish OCIRepository.
+	// +optional
+	PublishedReference string `json:"publishedReference,omitempty"`
+
+	// InlineArtifact is the last artifact embedded in the Kubernetes API
+	// according to the Inline spec.
+	// +optional
+	InlineArtifact *InlineArtifact `json:"inlineArtifact,omitempty"`
+
+	// PendingRevision is the revision fetched outside of the Window, for
+	// which no artifact is produced until the Window opens.
+	// +optional
+	PendingRevision string `json:"pendingRevision,omitempty"`
+
+	// LastFailure is the detail of the failure of the last reconciliation,
+	// removed once a reconciliation succeeds.
+	// +optional
+	LastFailure *SourceFailure `json:"lastFailure,omitempty"`
+
+	// NextReconcileAt is the time the next reconciliation is scheduled at,
+	// from the interval or the delay before the next attempt. Not set when
+	// the source is only reconciled on change or request, or when a failure
+	// is retried with an exponential backoff.
+	// +optional
+	NextReconcileAt *metav1.Time `json:"nextReconcileAt,omitempty"`
+
 	meta.ReconcileRequestStatus `json:",inline"`
 }
 
+// MaxVersionCandidates is the maximum number of candidate versions recorded
+// in a HelmChartVersionResolution.
+const MaxVersionCandidates = 10
+
+// HelmChartVersionResolution describes the selection of a chart version from
+// a HelmRepository index.
+type HelmChartVersionResolution struct {
+	// Version is the version or semver range the chart version was selected
+	// for, as set in the spec.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Selected is the chart version that was packaged.
+	// +required
+	Selected string `json:"selected"`
+
+	// Reason is the reason the version was selected, one of 'ExactVersion',
+	// 'SemVerConstraint' or 'LatestStable'.
+	// +required
+	Reason string `json:"reason"`
+
+	// Candidates holds the latest chart versions matching the Version, sorted
+	// from the latest to the oldest version.
+	// +optional
+	Candidates []string `json:"candidates,omitempty"`
+}
+
+// HelmChartEntry describes a chart matched by the glob pattern of a HelmChart.
+type HelmChartEntry struct {
+	// Path is the path of the chart relative to the root of the source.
+	// +required
+	Path string `json:"path"`
+
+	// Name of the chart, as declared in its metadata.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Version of the chart, as declared in its metadata.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Ready is true if the chart was packaged successfully.
+	// +required
+	Ready bool `json:"ready"`
+
+	// Message holds the reason the chart could not be packaged.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
 const (
 	// ChartPullFailedReason represents the fact that the pull of the Helm chart
 	// failed.
@@ -120,6 +347,10 @@ const (
 	// ChartPackageSucceededReason represents the fact that the package of the Helm
 	// chart succeeded.
 	ChartPackageSucceededReason string = "ChartPackageSucceeded"
+
+	// ChartDigestMismatchReason represents the fact that the digest of the
+	// Helm chart package does not match the digest pinned in the version.
+	ChartDigestMismatchReason string = "ChartDigestMismatch"
 )
 
 // HelmChartProgressing resets the conditions of the HelmChart to meta.Condition
@@ -128,8 +359,9 @@ const (
 func HelmChartProgressing(chart HelmChart) HelmChart {
 	chart.Status.ObservedGeneration = chart.Generation
 	chart.Status.URL = ""
+	chart.Status.Charts = nil
 	chart.Status.Conditions = []metav1.Condition{}
-	meta.SetResourceCondition(&chart, meta.ReadyCondition, metav1.ConditionUnknown, meta.ProgressingReason, "reconciliation in progress")
+	SetReadyCondition(&chart, metav1.ConditionUnknown, meta.ProgressingReason, "reconciliation in progress")
 	return chart
 }
 
@@ -138,16 +370,44 @@ func HelmChartProgressing(chart HelmChart) HelmChart {
 // the modified HelmChart.
 func HelmChartReady(chart HelmChart, artifact Artifact, url, reason, message string) HelmChart {
 	chart.Status.Artifact = &artifact
+	chart.Status.PendingRevision = ""
 	chart.Status.URL = url
-	meta.SetResourceCondition(&chart, meta.ReadyCondition, metav1.ConditionTrue, reason, message)
+	SetReadyCondition(&chart, metav1.ConditionTrue, reason, message)
+	return chart
+}
+
+// HelmChartPending sets the given revision as the PendingRevision of the
+// HelmChart and sets the meta.ReadyCondition to 'True', with the
+// WindowClosedReason and the given message, the Artifact being kept. It returns
+// the modified HelmChart.
+func HelmChartPending(chart HelmChart, revision, message string) HelmChart {
+	chart.Status.PendingRevision = revision
+	SetReadyCondition(&chart, metav1.ConditionTrue, WindowClosedReason, message)
 	return chart
 }
 
 // HelmChartNotReady sets the meta.ReadyCondition on the given HelmChart to
-// 'False', with the given reason and message. It returns the modified
-// HelmChart.
+// 'False', with the given reason and message, and unsets the time of the next
+// reconciliation. It returns the modified HelmChart.
 func HelmChartNotReady(chart HelmChart, reason, message string) HelmChart {
-	meta.SetResourceCondition(&chart, meta.ReadyCondition, metav1.ConditionFalse, reason, message)
+	SetReadyCondition(&chart, metav1.ConditionFalse, reason, message)
+	chart.Status.NextReconcileAt = nil
+	return chart
+}
+
+// HelmChartWithdrawn removes the artifacts from the status of the given
+// suspended HelmChart and sets the meta.ReadyCondition to 'False', with the
+// ArtifactWithdrawnReason. It returns the modified HelmChart.
+func HelmChartWithdrawn(chart HelmChart) HelmChart {
+	chart.Status.ObservedGeneration = chart.Generation
+	chart.Status.Artifact = nil
+	chart.Status.History = nil
+	chart.Status.InlineArtifact = nil
+	chart.Status.PendingRevision = ""
+	chart.Status.BuildCacheKey = ""
+	chart.Status.URL = ""
+	SetReadyCondition(&chart, metav1.ConditionFalse, ArtifactWithdrawnReason, "artifact withdrawn while the reconciliation is suspended")
+	chart.Status.NextReconcileAt = nil
 	return chart
 }
 
@@ -178,6 +438,15 @@ func (in *HelmChart) GetInterval() metav1.Duration {
 	return in.Spec.Interval
 }
 
+// GetSourceNamespace returns the namespace of the source of the HelmChart,
+// which defaults to the namespace of the HelmChart.
+func (in *HelmChart) GetSourceNamespace() string {
+	if in.Spec.SourceRef.Namespace != "" {
+		return in.Spec.SourceRef.Namespace
+	}
+	return in.Namespace
+}
+
 // GetValuesFiles returns a merged list of ValuesFiles.
 func (in *HelmChart) GetValuesFiles() []string {
 	valuesFiles := in.Spec.ValuesFiles
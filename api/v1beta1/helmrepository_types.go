@@ -54,6 +54,12 @@ type HelmRepositorySpec struct {
 	// +optional
 	PassCredentials bool `json:"passCredentials,omitempty"`
 
+	// Headers are extra HTTP headers sent with the requests to the
+	// repository, and to download its charts. They take precedence over the
+	// headers set with the --http-headers flag of the controller.
+	// +optional
+	Headers map[string]string `json:"headers,omitempty"`
+
 	// The interval at which to check the upstream for updates.
 	// +required
 	Interval metav1.Duration `json:"interval"`
@@ -63,9 +69,67 @@ type HelmRepositorySpec struct {
 	// +optional
 	Timeout *metav1.Duration `json:"timeout,omitempty"`
 
+	// Verify the integrity of the repository index before it is accepted.
+	// +optional
+	Verification *HelmRepositoryVerification `json:"verify,omitempty"`
+
+	// FilterIndex stores only the chart versions requested by the HelmCharts
+	// referencing the HelmRepository in the index of the artifact, to shrink
+	// the artifacts of large repositories. The charts only requested as the
+	// dependencies of other charts are filtered out.
+	// +optional
+	FilterIndex bool `json:"filterIndex,omitempty"`
+
+	// CacheCharts stores the chart packages downloaded for the HelmCharts
+	// referencing the HelmRepository on the storage volume, and reuses the
+	// cached packages on the next builds instead of downloading them again.
+	// The cached packages are served under the 'charts/' path of the
+	// artifact directory of the HelmRepository.
+	// +optional
+	CacheCharts bool `json:"cacheCharts,omitempty"`
+
+	// DependsOn holds the sources the reconciliation of this source waits
+	// for, until they have a ready artifact at or above the given revisions.
+	// +optional
+	DependsOn []SourceDependency `json:"dependsOn,omitempty"`
+
+	// The maximum duration the artifact may go without an update, after which
+	// the ArtifactOutdated condition is set and a warning event is emitted,
+	// even if the reconciliations succeed. Disabled when not set.
+	// +optional
+	StaleAfter *metav1.Duration `json:"staleAfter,omitempty"`
+
 	// This flag tells the controller to suspend the reconciliation of this source.
 	// +optional
 	Suspend bool `json:"suspend,omitempty"`
+
+	// SuspendArtifact tells whether the artifact of the source is kept and
+	// served while the reconciliation is suspended, with 'Retain', or removed
+	// from the storage and the status, with 'Withdraw'. Defaults to 'Retain'.
+	// +kubebuilder:validation:Enum=Retain;Withdraw
+	// +optional
+	SuspendArtifact string `json:"suspendArtifact,omitempty"`
+}
+
+const (
+	// PGPIndexVerificationProvider verifies the detached OpenPGP signature of
+	// the repository index, served on <url>/index.yaml.sig.
+	PGPIndexVerificationProvider string = "pgp"
+)
+
+// HelmRepositoryVerification defines the verification of the repository index.
+type HelmRepositoryVerification struct {
+	// Provider of the index verification, currently ('pgp'), which verifies
+	// the detached OpenPGP signature served on <url>/index.yaml.sig.
+	// +kubebuilder:validation:Enum=pgp
+	// +kubebuilder:default:=pgp
+	// +optional
+	Provider string `json:"provider,omitempty"`
+
+	// The secret name containing the armored public keys of all trusted
+	// signers of the repository index.
+	// +required
+	SecretRef meta.LocalObjectReference `json:"secretRef"`
 }
 
 // HelmRepositoryStatus defines the observed state of the HelmRepository.
@@ -86,6 +150,18 @@ type HelmRepositoryStatus struct {
 	// +optional
 	Artifact *Artifact `json:"artifact,omitempty"`
 
+	// LastFailure is the detail of the failure of the last reconciliation,
+	// removed once a reconciliation succeeds.
+	// +optional
+	LastFailure *SourceFailure `json:"lastFailure,omitempty"`
+
+	// NextReconcileAt is the time the next reconciliation is scheduled at,
+	// from the interval or the delay before the next attempt. Not set when
+	// the source is only reconciled on change or request, or when a failure
+	// is retried with an exponential backoff.
+	// +optional
+	NextReconcileAt *metav1.Time `json:"nextReconcileAt,omitempty"`
+
 	meta.ReconcileRequestStatus `json:",inline"`
 }
 
@@ -107,7 +183,7 @@ func HelmRepositoryProgressing(repository HelmRepository) HelmRepository {
 	repository.Status.ObservedGeneration = repository.Generation
 	repository.Status.URL = ""
 	repository.Status.Conditions = []metav1.Condition{}
-	meta.SetResourceCondition(&repository, meta.ReadyCondition, metav1.ConditionUnknown, meta.ProgressingReason, "reconciliation in progress")
+	SetReadyCondition(&repository, metav1.ConditionUnknown, meta.ProgressingReason, "reconciliation in progress")
 	return repository
 }
 
@@ -117,15 +193,28 @@ func HelmRepositoryProgressing(repository HelmRepository) HelmRepository {
 func HelmRepositoryReady(repository HelmRepository, artifact Artifact, url, reason, message string) HelmRepository {
 	repository.Status.Artifact = &artifact
 	repository.Status.URL = url
-	meta.SetResourceCondition(&repository, meta.ReadyCondition, metav1.ConditionTrue, reason, message)
+	SetReadyCondition(&repository, metav1.ConditionTrue, reason, message)
 	return repository
 }
 
 // HelmRepositoryNotReady sets the meta.ReadyCondition on the given
-// HelmRepository to 'False', with the given reason and message. It returns the
-// modified HelmRepository.
+// HelmRepository to 'False', with the given reason and message, and unsets the
+// time of the next reconciliation. It returns the modified HelmRepository.
 func HelmRepositoryNotReady(repository HelmRepository, reason, message string) HelmRepository {
-	meta.SetResourceCondition(&repository, meta.ReadyCondition, metav1.ConditionFalse, reason, message)
+	SetReadyCondition(&repository, metav1.ConditionFalse, reason, message)
+	repository.Status.NextReconcileAt = nil
+	return repository
+}
+
+// HelmRepositoryWithdrawn removes the artifacts from the status of the given
+// suspended HelmRepository and sets the meta.ReadyCondition to 'False', with the
+// ArtifactWithdrawnReason. It returns the modified HelmRepository.
+func HelmRepositoryWithdrawn(repository HelmRepository) HelmRepository {
+	repository.Status.ObservedGeneration = repository.Generation
+	repository.Status.Artifact = nil
+	repository.Status.URL = ""
+	SetReadyCondition(&repository, metav1.ConditionFalse, ArtifactWithdrawnReason, "artifact withdrawn while the reconciliation is suspended")
+	repository.Status.NextReconcileAt = nil
 	return repository
 }
 
@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"github.com/fluxcd/pkg/apis/meta"
+)
+
+const (
+	// InlineStatusMode embeds the artifacts in the status of the sources.
+	InlineStatusMode string = "Status"
+
+	// InlineConfigMapMode embeds the artifacts in ConfigMaps.
+	InlineConfigMapMode string = "ConfigMap"
+
+	// DefaultInlineMaxSize is the default size in bytes of the largest
+	// artifact embedded in the Kubernetes API.
+	DefaultInlineMaxSize int64 = 512 << 10
+
+	// InlineArtifactKey is the key of the artifact file in the binary data of
+	// the ConfigMaps the artifacts are embedded in.
+	InlineArtifactKey string = "artifact"
+)
+
+// SourceInline embeds the small artifacts of a source in the Kubernetes API,
+// for the consumers without network access to the artifact server.
+type SourceInline struct {
+	// Mode is where the artifacts are embedded, 'Status' for the status of
+	// the source, or 'ConfigMap' for a ConfigMap owned by the source in its
+	// namespace, defaults to 'Status'.
+	// +kubebuilder:validation:Enum=Status;ConfigMap
+	// +optional
+	Mode string `json:"mode,omitempty"`
+
+	// MaxSize is the size in bytes of the largest artifact embedded,
+	// defaults to 512KiB. The larger artifacts are only served by the
+	// artifact server.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=1048576
+	// +optional
+	MaxSize int64 `json:"maxSize,omitempty"`
+}
+
+// InlineArtifact is an artifact of a source embedded in the Kubernetes API.
+type InlineArtifact struct {
+	// Revision is the revision of the embedded artifact.
+	// +required
+	Revision string `json:"revision"`
+
+	// Checksum is the SHA1 checksum of the embedded artifact.
+	// +required
+	Checksum string `json:"checksum"`
+
+	// Content is the artifact file, e.g. a gzip compressed tarball, when
+	// embedded in the status.
+	// +optional
+	Content []byte `json:"content,omitempty"`
+
+	// ConfigMapRef is the ConfigMap holding the artifact file under the
+	// 'artifact' key of its binary data, when embedded in a ConfigMap.
+	// +optional
+	ConfigMapRef *meta.LocalObjectReference `json:"configMapRef,omitempty"`
+}
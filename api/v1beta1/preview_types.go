@@ -0,0 +1,112 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// DryRunAnnotation is the annotation which, when set to 'true' on a
+	// source, makes the controller fetch and preview the source without
+	// writing an artifact.
+	DryRunAnnotation string = "source.toolkit.fluxcd.io/dry-run"
+
+	// PreviewSucceededReason represents the fact that the dry-run
+	// reconciliation of a source succeeded.
+	PreviewSucceededReason string = "PreviewSucceeded"
+)
+
+// SourcePreview is the result of the dry-run reconciliation of a source.
+type SourcePreview struct {
+	// Revision is the revision the artifact would have.
+	// +required
+	Revision string `json:"revision"`
+
+	// Files is the number of files the artifact would hold.
+	// +required
+	Files int `json:"files"`
+
+	// Size is the total size in bytes of the files, before compression.
+	// +required
+	Size int64 `json:"size"`
+
+	// Entries summarizes the files per top-level entry of the artifact.
+	// +optional
+	Entries []SourcePreviewEntry `json:"entries,omitempty"`
+
+	// Issues lists the problems found, which do not fail the reconciliation
+	// but may cause an unexpected artifact content.
+	// +optional
+	Issues []string `json:"issues,omitempty"`
+
+	// Changes summarizes the objects the artifact would add, remove and
+	// modify relative to the current artifact. Set for the Buckets with an
+	// artifact only.
+	// +optional
+	Changes *SourcePreviewChanges `json:"changes,omitempty"`
+
+	// LastUpdateTime is the time of the preview.
+	// +required
+	LastUpdateTime metav1.Time `json:"lastUpdateTime"`
+}
+
+// SourcePreviewEntry summarizes the files of a top-level entry of a
+// SourcePreview.
+type SourcePreviewEntry struct {
+	// Path is the path of the top-level file or directory.
+	// +required
+	Path string `json:"path"`
+
+	// Files is the number of files in the entry.
+	// +required
+	Files int `json:"files"`
+
+	// Size is the total size in bytes of the files in the entry.
+	// +required
+	Size int64 `json:"size"`
+}
+
+// SourcePreviewChanges summarizes the objects changed between the current
+// artifact of a source and a SourcePreview.
+type SourcePreviewChanges struct {
+	// Revision is the revision of the current artifact.
+	// +required
+	Revision string `json:"revision"`
+
+	// Added is the number of objects which would be added.
+	// +required
+	Added int `json:"added"`
+
+	// Removed is the number of objects which would be removed.
+	// +required
+	Removed int `json:"removed"`
+
+	// Modified is the number of objects which would be modified.
+	// +required
+	Modified int `json:"modified"`
+
+	// Keys lists the keys of the changed objects, prefixed by '+' when
+	// added, '-' when removed and '~' when modified, up to 100 keys.
+	// +optional
+	Keys []string `json:"keys,omitempty"`
+}
+
+// InDryRun returns true if the DryRunAnnotation of the given object is 'true'.
+func InDryRun(obj metav1.Object) bool {
+	return obj.GetAnnotations()[DryRunAnnotation] == "true"
+}
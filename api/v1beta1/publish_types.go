@@ -0,0 +1,41 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"github.com/fluxcd/pkg/apis/meta"
+)
+
+// SourcePublish configures the push of the artifacts of a source to an OCI
+// registry, as OCI artifacts tagged with their revision.
+type SourcePublish struct {
+	// OCIRepository is the OCI repository the artifacts are pushed to, in the
+	// '<registry>/<name>' format, e.g. 'ghcr.io/org/podinfo'.
+	// +kubebuilder:validation:Pattern="^(oci://)?[^/]+/.+$"
+	// +required
+	OCIRepository string `json:"ociRepository"`
+
+	// SecretRef is the name of the secret holding the registry credentials,
+	// in the 'username' and 'password' fields, or in the '.dockerconfigjson'
+	// field of a 'kubernetes.io/dockerconfigjson' secret.
+	// +optional
+	SecretRef *meta.LocalObjectReference `json:"secretRef,omitempty"`
+
+	// Insecure connects to the registry over plain HTTP.
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+}
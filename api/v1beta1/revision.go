@@ -0,0 +1,147 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"strings"
+)
+
+// digestAlgorithms are the digest algorithms of the revisions, by the length
+// of their hex encoded digests.
+var digestAlgorithms = map[int]string{
+	40:  "sha1",
+	64:  "sha256",
+	96:  "sha384",
+	128: "sha512",
+}
+
+// Revision is an artifact revision parsed by ParseRevision, for the consumers
+// to compare the revisions regardless of their format.
+// +k8s:deepcopy-gen=false
+type Revision struct {
+	// Name is the named pointer of the revision, e.g. the branch or the tag
+	// of a Git commit, or the version of a chart. Empty for the revisions
+	// which are digests only, e.g. the checksums of the Bucket revisions.
+	Name string
+	// Algorithm is the algorithm of the Digest, e.g. 'sha1' or 'sha256'.
+	// Inferred from the length of the Digest for the revisions without one.
+	Algorithm string
+	// Digest is the lower case hex encoded digest of the revision, e.g. the
+	// SHA of a Git commit. Empty for the revisions without one, e.g. the
+	// versions of the charts.
+	Digest string
+}
+
+// ParseRevision parses the given artifact revision in any of the formats:
+//
+//  - '<name>/<digest>', e.g. 'main/363a6a8...' for a Git branch.
+//  - '<name>@<algorithm>:<digest>', e.g. 'main@sha1:363a6a8...'.
+//  - '<algorithm>:<digest>', e.g. 'sha256:3f2a5f4...'.
+//  - '<digest>', e.g. the checksum of a Bucket or HelmRepository revision.
+//  - '<name>', e.g. the version of a HelmChart revision.
+//
+// A digest without algorithm is only recognized if it is a full length hex
+// encoded SHA-1 or SHA-2 digest, the revision being a name otherwise.
+func ParseRevision(revision string) Revision {
+	if i := strings.LastIndex(revision, "@"); i >= 0 {
+		if alg, digest, ok := splitDigest(revision[i+1:]); ok {
+			return Revision{Name: revision[:i], Algorithm: alg, Digest: digest}
+		}
+	}
+	if alg, digest, ok := splitDigest(revision); ok {
+		return Revision{Algorithm: alg, Digest: digest}
+	}
+	name, digest := "", revision
+	if i := strings.LastIndex(revision, "/"); i >= 0 {
+		name, digest = revision[:i], revision[i+1:]
+	}
+	if alg, ok := digestAlgorithm(digest); ok {
+		return Revision{Name: name, Algorithm: alg, Digest: strings.ToLower(digest)}
+	}
+	return Revision{Name: revision}
+}
+
+// String returns the revision in the '<name>@<algorithm>:<digest>' format,
+// without the parts it does not have.
+func (r Revision) String() string {
+	s := r.Name
+	if r.Digest == "" {
+		return s
+	}
+	if s != "" {
+		s += "@"
+	}
+	if r.Algorithm != "" {
+		s += r.Algorithm + ":"
+	}
+	return s + r.Digest
+}
+
+// Equal returns true if the given revision is the same as this one: their
+// digests and algorithms are equal if they have one, and so are their names,
+// unless one of them is a digest only.
+func (r Revision) Equal(other Revision) bool {
+	if r.Digest == "" || other.Digest == "" {
+		return r.Digest == other.Digest && r.Name == other.Name
+	}
+	if !r.SameDigest(other) {
+		return false
+	}
+	return r.Name == "" || other.Name == "" || r.Name == other.Name
+}
+
+// SameDigest returns true if the given revision has the same digest as this
+// one, computed with the same algorithm, regardless of their names. Two
+// revisions without digest never have the same one.
+func (r Revision) SameDigest(other Revision) bool {
+	return r.Digest != "" && r.Digest == other.Digest && r.Algorithm == other.Algorithm
+}
+
+// RevisionsEqual returns true if the given revisions are the same, in any of
+// the formats parsed by ParseRevision. See Revision.Equal.
+func RevisionsEqual(a, b string) bool {
+	return a == b || ParseRevision(a).Equal(ParseRevision(b))
+}
+
+// splitDigest splits the given '<algorithm>:<digest>' string, and returns
+// false if it is not a hex encoded digest of a known algorithm.
+func splitDigest(s string) (string, string, bool) {
+	i := strings.Index(s, ":")
+	if i < 0 {
+		return "", "", false
+	}
+	alg, digest := strings.ToLower(s[:i]), strings.ToLower(s[i+1:])
+	if inferred, ok := digestAlgorithm(digest); !ok || inferred != alg {
+		return "", "", false
+	}
+	return alg, digest, true
+}
+
+// digestAlgorithm returns the algorithm of the given hex encoded digest,
+// inferred from its length, and false if it is not a digest.
+func digestAlgorithm(digest string) (string, bool) {
+	alg, ok := digestAlgorithms[len(digest)]
+	if !ok {
+		return "", false
+	}
+	for _, c := range digest {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return "", false
+		}
+	}
+	return alg, true
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"testing"
+)
+
+const (
+	sha1Digest   = "363a6a8fe6a7f13e05d34c163b0ef02a777da20a"
+	sha256Digest = "2e7d2c03a9507ae265ecf5b5356885a53393a2029d241394997265a1a25aefc6"
+)
+
+func TestParseRevision(t *testing.T) {
+	tests := []struct {
+		revision string
+		want     Revision
+	}{
+		{revision: "main/" + sha1Digest, want: Revision{Name: "main", Algorithm: "sha1", Digest: sha1Digest}},
+		{revision: "release/1.x/" + sha1Digest, want: Revision{Name: "release/1.x", Algorithm: "sha1", Digest: sha1Digest}},
+		{revision: "main@sha1:" + sha1Digest, want: Revision{Name: "main", Algorithm: "sha1", Digest: sha1Digest}},
+		{revision: "refs/heads/main@SHA1:" + sha1Digest, want: Revision{Name: "refs/heads/main", Algorithm: "sha1", Digest: sha1Digest}},
+		{revision: "sha256:" + sha256Digest, want: Revision{Algorithm: "sha256", Digest: sha256Digest}},
+		{revision: sha256Digest, want: Revision{Algorithm: "sha256", Digest: sha256Digest}},
+		{revision: "6.0.0", want: Revision{Name: "6.0.0"}},
+		{revision: "main/363a6a8", want: Revision{Name: "main/363a6a8"}},
+		{revision: "main@sha256:" + sha1Digest, want: Revision{Name: "main@sha256:" + sha1Digest}},
+		{revision: "", want: Revision{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.revision, func(t *testing.T) {
+			if got := ParseRevision(tt.revision); got != tt.want {
+				t.Errorf("ParseRevision() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevision_String(t *testing.T) {
+	for revision, want := range map[string]string{
+		"main/" + sha1Digest:      "main@sha1:" + sha1Digest,
+		sha256Digest:              "sha256:" + sha256Digest,
+		"6.0.0":                   "6.0.0",
+		"main@sha1:" + sha1Digest: "main@sha1:" + sha1Digest,
+	} {
+		if got := ParseRevision(revision).String(); got != want {
+			t.Errorf("String() = %s, want %s", got, want)
+		}
+	}
+}
+
+func TestRevisionsEqual(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "main/" + sha1Digest, b: "main@sha1:" + sha1Digest, want: true},
+		{a: "main/" + sha1Digest, b: "sha1:" + sha1Digest, want: true},
+		{a: sha1Digest, b: "main/" + sha1Digest, want: true},
+		{a: "main/" + sha1Digest, b: "main/" + sha1Digest[:39] + "b", want: false},
+		{a: "main/" + sha1Digest, b: "feature/" + sha1Digest, want: false},
+		{a: "6.0.0", b: "6.0.0", want: true},
+		{a: "6.0.0", b: "6.0.1", want: false},
+		{a: "6.0.0", b: sha1Digest, want: false},
+		{a: sha256Digest, b: "sha256:" + sha256Digest, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"="+tt.b, func(t *testing.T) {
+			if got := RevisionsEqual(tt.a, tt.b); got != tt.want {
+				t.Errorf("RevisionsEqual() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	a, b := ParseRevision("main/"+sha1Digest), ParseRevision("feature/"+sha1Digest)
+	if !a.SameDigest(b) {
+		t.Error("SameDigest() = false, want true")
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"github.com/fluxcd/pkg/apis/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// SourceSetKind is the string representation of a SourceSet.
+	SourceSetKind = "SourceSet"
+)
+
+// SourceSetSpec defines the group of sources aggregated by a SourceSet.
+type SourceSetSpec struct {
+	// Kinds restricts the aggregated sources to the given kinds, defaults to
+	// all the source kinds.
+	// +optional
+	Kinds []SourceSetKindName `json:"kinds,omitempty"`
+
+	// Selector selects the aggregated sources in the namespace of the
+	// SourceSet by their labels, defaults to all the sources.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// This flag tells the controller to suspend the aggregation of the sources.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// SourceSetKindName is the kind of a source aggregated by a SourceSet.
+// +kubebuilder:validation:Enum=GitRepository;HelmRepository;HelmChart;Bucket
+type SourceSetKindName string
+
+// SourceSetStatus defines the summary of the sources of a SourceSet.
+type SourceSetStatus struct {
+	// ObservedGeneration is the last observed generation.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions holds the conditions for the SourceSet.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Total is the number of sources in the set.
+	// +optional
+	Total int `json:"total"`
+
+	// Ready is the number of sources in the set which are ready.
+	// +optional
+	Ready int `json:"ready"`
+
+	// Failed is the number of sources in the set whose last reconciliation
+	// failed.
+	// +optional
+	Failed int `json:"failed"`
+
+	// Sources summarizes the status of the sources in the set, sorted by kind
+	// and name.
+	// +optional
+	Sources []SourceSummary `json:"sources,omitempty"`
+
+	meta.ReconcileRequestStatus `json:",inline"`
+}
+
+// SourceSummary summarizes the status of a source of a SourceSet.
+type SourceSummary struct {
+	// Kind is the kind of the source.
+	// +required
+	Kind string `json:"kind"`
+
+	// Name is the name of the source.
+	// +required
+	Name string `json:"name"`
+
+	// Ready is the status of the meta.ReadyCondition of the source, 'Unknown'
+	// when not set.
+	// +required
+	Ready metav1.ConditionStatus `json:"ready"`
+
+	// Reason is the reason of the meta.ReadyCondition of the source, when not
+	// 'True'.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is the message of the meta.ReadyCondition of the source, when not
+	// 'True'.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Revision is the revision of the latest artifact of the source.
+	// +optional
+	Revision string `json:"revision,omitempty"`
+
+	// LastUpdateTime is the time of the latest artifact of the source.
+	// +optional
+	LastUpdateTime *metav1.Time `json:"lastUpdateTime,omitempty"`
+}
+
+const (
+	// SourcesReadyReason represents the fact that all the sources of a
+	// SourceSet are ready.
+	SourcesReadyReason string = "SourcesReady"
+
+	// SourcesNotReadyReason represents the fact that some sources of a
+	// SourceSet are not ready.
+	SourcesNotReadyReason string = "SourcesNotReady"
+
+	// SelectorInvalidReason represents the fact that the selector of a
+	// SourceSet is invalid.
+	SelectorInvalidReason string = "SelectorInvalid"
+)
+
+// GetStatusConditions returns a pointer to the Status.Conditions slice
+func (in *SourceSet) GetStatusConditions() *[]metav1.Condition {
+	return &in.Status.Conditions
+}
+
+// +genclient
+// +genclient:Namespaced
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Total",type=integer,JSONPath=`.status.total`
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.ready`
+// +kubebuilder:printcolumn:name="Failed",type=integer,JSONPath=`.status.failed`
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].message",description=""
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description=""
+
+// SourceSet is the Schema for the sourcesets API
+type SourceSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SourceSetSpec   `json:"spec,omitempty"`
+	Status SourceSetStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SourceSetList contains a list of SourceSet
+type SourceSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SourceSet `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SourceSet{}, &SourceSetList{})
+}
@@ -0,0 +1,32 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+const (
+	// SuspendArtifactRetain keeps the artifact of a suspended source in the
+	// storage and the status, for the consumers to keep receiving it.
+	SuspendArtifactRetain string = "Retain"
+
+	// SuspendArtifactWithdraw removes the artifacts of a suspended source
+	// from the storage and the status, for the consumers to stop receiving
+	// them.
+	SuspendArtifactWithdraw string = "Withdraw"
+
+	// ArtifactWithdrawnReason represents the fact that the artifacts of a
+	// suspended source were withdrawn according to its SuspendArtifact.
+	ArtifactWithdrawnReason string = "ArtifactWithdrawn"
+)
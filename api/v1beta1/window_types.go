@@ -0,0 +1,61 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// WindowClosedReason represents the fact that a new revision of a source
+	// is pending until its window opens, the artifact of the previous
+	// revision being kept.
+	WindowClosedReason string = "WindowClosed"
+
+	// WindowInvalidReason represents the fact that the window of a source
+	// can't be evaluated, e.g. because of an unknown time zone.
+	WindowInvalidReason string = "WindowInvalid"
+)
+
+// SourceWindow is a recurring time window in which the new revisions of a
+// source are turned into artifacts. A new revision fetched outside of the
+// window is recorded as pending until the window opens.
+type SourceWindow struct {
+	// Start is the time of the day the window opens at, in the 'HH:MM'
+	// format.
+	// +kubebuilder:validation:Pattern="^([01][0-9]|2[0-3]):[0-5][0-9]$"
+	// +required
+	Start string `json:"start"`
+
+	// Duration is how long the window stays open.
+	// +required
+	Duration metav1.Duration `json:"duration"`
+
+	// Days are the days of the week the window opens on, e.g. ['Sat', 'Sun'],
+	// defaults to every day.
+	// +optional
+	Days []WindowDay `json:"days,omitempty"`
+
+	// TimeZone is the IANA time zone of the Start time, e.g. 'Europe/Berlin',
+	// defaults to 'UTC'.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// WindowDay is a day of the week of a SourceWindow.
+// +kubebuilder:validation:Enum=Mon;Tue;Wed;Thu;Fri;Sat;Sun
+type WindowDay string
@@ -29,6 +29,11 @@ import (
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Artifact) DeepCopyInto(out *Artifact) {
 	*out = *in
+	if in.SkippedFiles != nil {
+		in, out := &in.SkippedFiles, &out.SkippedFiles
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	in.LastUpdateTime.DeepCopyInto(&out.LastUpdateTime)
 }
 
@@ -101,9 +106,66 @@ func (in *BucketList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BucketRangedDownload) DeepCopyInto(out *BucketRangedDownload) {
+	*out = *in
+	if in.PartSize != nil {
+		in, out := &in.PartSize, &out.PartSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BucketRangedDownload.
+func (in *BucketRangedDownload) DeepCopy() *BucketRangedDownload {
+	if in == nil {
+		return nil
+	}
+	out := new(BucketRangedDownload)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BucketSigning) DeepCopyInto(out *BucketSigning) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BucketSigning.
+func (in *BucketSigning) DeepCopy() *BucketSigning {
+	if in == nil {
+		return nil
+	}
+	out := new(BucketSigning)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BucketSpec) DeepCopyInto(out *BucketSpec) {
 	*out = *in
+	if in.ForcePathStyle != nil {
+		in, out := &in.ForcePathStyle, &out.ForcePathStyle
+		*out = new(bool)
+		**out = **in
+	}
+	if in.RangedDownload != nil {
+		in, out := &in.RangedDownload, &out.RangedDownload
+		*out = new(BucketRangedDownload)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Signing != nil {
+		in, out := &in.Signing, &out.Signing
+		*out = new(BucketSigning)
+		**out = **in
+	}
+	if in.Headers != nil {
+		in, out := &in.Headers, &out.Headers
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.SecretRef != nil {
 		in, out := &in.SecretRef, &out.SecretRef
 		*out = new(meta.LocalObjectReference)
@@ -115,11 +177,41 @@ func (in *BucketSpec) DeepCopyInto(out *BucketSpec) {
 		*out = new(v1.Duration)
 		**out = **in
 	}
+	if in.Timeouts != nil {
+		in, out := &in.Timeouts, &out.Timeouts
+		*out = new(BucketTimeouts)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Ignore != nil {
 		in, out := &in.Ignore, &out.Ignore
 		*out = new(string)
 		**out = **in
 	}
+	if in.Publish != nil {
+		in, out := &in.Publish, &out.Publish
+		*out = new(SourcePublish)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Inline != nil {
+		in, out := &in.Inline, &out.Inline
+		*out = new(SourceInline)
+		**out = **in
+	}
+	if in.Window != nil {
+		in, out := &in.Window, &out.Window
+		*out = new(SourceWindow)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]SourceDependency, len(*in))
+		copy(*out, *in)
+	}
+	if in.StaleAfter != nil {
+		in, out := &in.StaleAfter, &out.StaleAfter
+		*out = new(v1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BucketSpec.
@@ -147,6 +239,25 @@ func (in *BucketStatus) DeepCopyInto(out *BucketStatus) {
 		*out = new(Artifact)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Preview != nil {
+		in, out := &in.Preview, &out.Preview
+		*out = new(SourcePreview)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.InlineArtifact != nil {
+		in, out := &in.InlineArtifact, &out.InlineArtifact
+		*out = new(InlineArtifact)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastFailure != nil {
+		in, out := &in.LastFailure, &out.LastFailure
+		*out = new(SourceFailure)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NextReconcileAt != nil {
+		in, out := &in.NextReconcileAt, &out.NextReconcileAt
+		*out = (*in).DeepCopy()
+	}
 	out.ReconcileRequestStatus = in.ReconcileRequestStatus
 }
 
@@ -160,6 +271,36 @@ func (in *BucketStatus) DeepCopy() *BucketStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BucketTimeouts) DeepCopyInto(out *BucketTimeouts) {
+	*out = *in
+	if in.Connect != nil {
+		in, out := &in.Connect, &out.Connect
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.List != nil {
+		in, out := &in.List, &out.List
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Download != nil {
+		in, out := &in.Download, &out.Download
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BucketTimeouts.
+func (in *BucketTimeouts) DeepCopy() *BucketTimeouts {
+	if in == nil {
+		return nil
+	}
+	out := new(BucketTimeouts)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GitRepository) DeepCopyInto(out *GitRepository) {
 	*out = *in
@@ -259,11 +400,23 @@ func (in *GitRepositorySpec) DeepCopyInto(out *GitRepositorySpec) {
 		**out = **in
 	}
 	out.Interval = in.Interval
+	if in.FallbackInterval != nil {
+		in, out := &in.FallbackInterval, &out.FallbackInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
 	if in.Timeout != nil {
 		in, out := &in.Timeout, &out.Timeout
 		*out = new(v1.Duration)
 		**out = **in
 	}
+	if in.Headers != nil {
+		in, out := &in.Headers, &out.Headers
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.Reference != nil {
 		in, out := &in.Reference, &out.Reference
 		*out = new(GitRepositoryRef)
@@ -272,13 +425,43 @@ func (in *GitRepositorySpec) DeepCopyInto(out *GitRepositorySpec) {
 	if in.Verification != nil {
 		in, out := &in.Verification, &out.Verification
 		*out = new(GitRepositoryVerification)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	if in.Ignore != nil {
 		in, out := &in.Ignore, &out.Ignore
 		*out = new(string)
 		**out = **in
 	}
+	if in.StaleAfter != nil {
+		in, out := &in.StaleAfter, &out.StaleAfter
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.SubmodulePaths != nil {
+		in, out := &in.SubmodulePaths, &out.SubmodulePaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Publish != nil {
+		in, out := &in.Publish, &out.Publish
+		*out = new(SourcePublish)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Inline != nil {
+		in, out := &in.Inline, &out.Inline
+		*out = new(SourceInline)
+		**out = **in
+	}
+	if in.Window != nil {
+		in, out := &in.Window, &out.Window
+		*out = new(SourceWindow)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]SourceDependency, len(*in))
+		copy(*out, *in)
+	}
 	if in.Include != nil {
 		in, out := &in.Include, &out.Include
 		*out = make([]GitRepositoryInclude, len(*in))
@@ -322,6 +505,35 @@ func (in *GitRepositoryStatus) DeepCopyInto(out *GitRepositoryStatus) {
 			}
 		}
 	}
+	if in.Preview != nil {
+		in, out := &in.Preview, &out.Preview
+		*out = new(SourcePreview)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RetryAfter != nil {
+		in, out := &in.RetryAfter, &out.RetryAfter
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.InlineArtifact != nil {
+		in, out := &in.InlineArtifact, &out.InlineArtifact
+		*out = new(InlineArtifact)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Tag != nil {
+		in, out := &in.Tag, &out.Tag
+		*out = new(GitTag)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastFailure != nil {
+		in, out := &in.LastFailure, &out.LastFailure
+		*out = new(SourceFailure)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NextReconcileAt != nil {
+		in, out := &in.NextReconcileAt, &out.NextReconcileAt
+		*out = (*in).DeepCopy()
+	}
 	out.ReconcileRequestStatus = in.ReconcileRequestStatus
 }
 
@@ -339,6 +551,11 @@ func (in *GitRepositoryStatus) DeepCopy() *GitRepositoryStatus {
 func (in *GitRepositoryVerification) DeepCopyInto(out *GitRepositoryVerification) {
 	*out = *in
 	out.SecretRef = in.SecretRef
+	if in.SignersRef != nil {
+		in, out := &in.SignersRef, &out.SignersRef
+		*out = new(meta.LocalObjectReference)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitRepositoryVerification.
@@ -351,6 +568,25 @@ func (in *GitRepositoryVerification) DeepCopy() *GitRepositoryVerification {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GitTag) DeepCopyInto(out *GitTag) {
+	*out = *in
+	if in.TaggedAt != nil {
+		in, out := &in.TaggedAt, &out.TaggedAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitTag.
+func (in *GitTag) DeepCopy() *GitTag {
+	if in == nil {
+		return nil
+	}
+	out := new(GitTag)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HelmChart) DeepCopyInto(out *HelmChart) {
 	*out = *in
@@ -378,6 +614,21 @@ func (in *HelmChart) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmChartEntry) DeepCopyInto(out *HelmChartEntry) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmChartEntry.
+func (in *HelmChartEntry) DeepCopy() *HelmChartEntry {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmChartEntry)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HelmChartList) DeepCopyInto(out *HelmChartList) {
 	*out = *in
@@ -414,12 +665,52 @@ func (in *HelmChartList) DeepCopyObject() runtime.Object {
 func (in *HelmChartSpec) DeepCopyInto(out *HelmChartSpec) {
 	*out = *in
 	out.SourceRef = in.SourceRef
+	if in.ChartRef != nil {
+		in, out := &in.ChartRef, &out.ChartRef
+		*out = new(HelmChartURLReference)
+		(*in).DeepCopyInto(*out)
+	}
 	out.Interval = in.Interval
 	if in.ValuesFiles != nil {
 		in, out := &in.ValuesFiles, &out.ValuesFiles
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.PackageExclude != nil {
+		in, out := &in.PackageExclude, &out.PackageExclude
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.VersionTemplate != nil {
+		in, out := &in.VersionTemplate, &out.VersionTemplate
+		*out = new(HelmChartVersionTemplate)
+		**out = **in
+	}
+	if in.Publish != nil {
+		in, out := &in.Publish, &out.Publish
+		*out = new(SourcePublish)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Inline != nil {
+		in, out := &in.Inline, &out.Inline
+		*out = new(SourceInline)
+		**out = **in
+	}
+	if in.Window != nil {
+		in, out := &in.Window, &out.Window
+		*out = new(SourceWindow)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]SourceDependency, len(*in))
+		copy(*out, *in)
+	}
+	if in.StaleAfter != nil {
+		in, out := &in.StaleAfter, &out.StaleAfter
+		*out = new(v1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmChartSpec.
@@ -447,6 +738,37 @@ func (in *HelmChartStatus) DeepCopyInto(out *HelmChartStatus) {
 		*out = new(Artifact)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]Artifact, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Charts != nil {
+		in, out := &in.Charts, &out.Charts
+		*out = make([]HelmChartEntry, len(*in))
+		copy(*out, *in)
+	}
+	if in.VersionResolution != nil {
+		in, out := &in.VersionResolution, &out.VersionResolution
+		*out = new(HelmChartVersionResolution)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.InlineArtifact != nil {
+		in, out := &in.InlineArtifact, &out.InlineArtifact
+		*out = new(InlineArtifact)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastFailure != nil {
+		in, out := &in.LastFailure, &out.LastFailure
+		*out = new(SourceFailure)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NextReconcileAt != nil {
+		in, out := &in.NextReconcileAt, &out.NextReconcileAt
+		*out = (*in).DeepCopy()
+	}
 	out.ReconcileRequestStatus = in.ReconcileRequestStatus
 }
 
@@ -460,6 +782,66 @@ func (in *HelmChartStatus) DeepCopy() *HelmChartStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmChartURLReference) DeepCopyInto(out *HelmChartURLReference) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(meta.LocalObjectReference)
+		**out = **in
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmChartURLReference.
+func (in *HelmChartURLReference) DeepCopy() *HelmChartURLReference {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmChartURLReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmChartVersionResolution) DeepCopyInto(out *HelmChartVersionResolution) {
+	*out = *in
+	if in.Candidates != nil {
+		in, out := &in.Candidates, &out.Candidates
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmChartVersionResolution.
+func (in *HelmChartVersionResolution) DeepCopy() *HelmChartVersionResolution {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmChartVersionResolution)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmChartVersionTemplate) DeepCopyInto(out *HelmChartVersionTemplate) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmChartVersionTemplate.
+func (in *HelmChartVersionTemplate) DeepCopy() *HelmChartVersionTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmChartVersionTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HelmRepository) DeepCopyInto(out *HelmRepository) {
 	*out = *in
@@ -527,12 +909,34 @@ func (in *HelmRepositorySpec) DeepCopyInto(out *HelmRepositorySpec) {
 		*out = new(meta.LocalObjectReference)
 		**out = **in
 	}
+	if in.Headers != nil {
+		in, out := &in.Headers, &out.Headers
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	out.Interval = in.Interval
 	if in.Timeout != nil {
 		in, out := &in.Timeout, &out.Timeout
 		*out = new(v1.Duration)
 		**out = **in
 	}
+	if in.Verification != nil {
+		in, out := &in.Verification, &out.Verification
+		*out = new(HelmRepositoryVerification)
+		**out = **in
+	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]SourceDependency, len(*in))
+		copy(*out, *in)
+	}
+	if in.StaleAfter != nil {
+		in, out := &in.StaleAfter, &out.StaleAfter
+		*out = new(v1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmRepositorySpec.
@@ -560,6 +964,15 @@ func (in *HelmRepositoryStatus) DeepCopyInto(out *HelmRepositoryStatus) {
 		*out = new(Artifact)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.LastFailure != nil {
+		in, out := &in.LastFailure, &out.LastFailure
+		*out = new(SourceFailure)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NextReconcileAt != nil {
+		in, out := &in.NextReconcileAt, &out.NextReconcileAt
+		*out = (*in).DeepCopy()
+	}
 	out.ReconcileRequestStatus = in.ReconcileRequestStatus
 }
 
@@ -573,6 +986,47 @@ func (in *HelmRepositoryStatus) DeepCopy() *HelmRepositoryStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmRepositoryVerification) DeepCopyInto(out *HelmRepositoryVerification) {
+	*out = *in
+	out.SecretRef = in.SecretRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmRepositoryVerification.
+func (in *HelmRepositoryVerification) DeepCopy() *HelmRepositoryVerification {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmRepositoryVerification)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InlineArtifact) DeepCopyInto(out *InlineArtifact) {
+	*out = *in
+	if in.Content != nil {
+		in, out := &in.Content, &out.Content
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	if in.ConfigMapRef != nil {
+		in, out := &in.ConfigMapRef, &out.ConfigMapRef
+		*out = new(meta.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InlineArtifact.
+func (in *InlineArtifact) DeepCopy() *InlineArtifact {
+	if in == nil {
+		return nil
+	}
+	out := new(InlineArtifact)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LocalHelmChartSourceReference) DeepCopyInto(out *LocalHelmChartSourceReference) {
 	*out = *in
@@ -587,3 +1041,289 @@ func (in *LocalHelmChartSourceReference) DeepCopy() *LocalHelmChartSourceReferen
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SourceDependency) DeepCopyInto(out *SourceDependency) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SourceDependency.
+func (in *SourceDependency) DeepCopy() *SourceDependency {
+	if in == nil {
+		return nil
+	}
+	out := new(SourceDependency)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SourceFailure) DeepCopyInto(out *SourceFailure) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SourceFailure.
+func (in *SourceFailure) DeepCopy() *SourceFailure {
+	if in == nil {
+		return nil
+	}
+	out := new(SourceFailure)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SourceInline) DeepCopyInto(out *SourceInline) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SourceInline.
+func (in *SourceInline) DeepCopy() *SourceInline {
+	if in == nil {
+		return nil
+	}
+	out := new(SourceInline)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SourcePreview) DeepCopyInto(out *SourcePreview) {
+	*out = *in
+	if in.Entries != nil {
+		in, out := &in.Entries, &out.Entries
+		*out = make([]SourcePreviewEntry, len(*in))
+		copy(*out, *in)
+	}
+	if in.Issues != nil {
+		in, out := &in.Issues, &out.Issues
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Changes != nil {
+		in, out := &in.Changes, &out.Changes
+		*out = new(SourcePreviewChanges)
+		(*in).DeepCopyInto(*out)
+	}
+	in.LastUpdateTime.DeepCopyInto(&out.LastUpdateTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SourcePreview.
+func (in *SourcePreview) DeepCopy() *SourcePreview {
+	if in == nil {
+		return nil
+	}
+	out := new(SourcePreview)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SourcePreviewChanges) DeepCopyInto(out *SourcePreviewChanges) {
+	*out = *in
+	if in.Keys != nil {
+		in, out := &in.Keys, &out.Keys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SourcePreviewChanges.
+func (in *SourcePreviewChanges) DeepCopy() *SourcePreviewChanges {
+	if in == nil {
+		return nil
+	}
+	out := new(SourcePreviewChanges)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SourcePreviewEntry) DeepCopyInto(out *SourcePreviewEntry) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SourcePreviewEntry.
+func (in *SourcePreviewEntry) DeepCopy() *SourcePreviewEntry {
+	if in == nil {
+		return nil
+	}
+	out := new(SourcePreviewEntry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SourcePublish) DeepCopyInto(out *SourcePublish) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(meta.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SourcePublish.
+func (in *SourcePublish) DeepCopy() *SourcePublish {
+	if in == nil {
+		return nil
+	}
+	out := new(SourcePublish)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SourceSet) DeepCopyInto(out *SourceSet) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SourceSet.
+func (in *SourceSet) DeepCopy() *SourceSet {
+	if in == nil {
+		return nil
+	}
+	out := new(SourceSet)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SourceSet) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SourceSetList) DeepCopyInto(out *SourceSetList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SourceSet, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SourceSetList.
+func (in *SourceSetList) DeepCopy() *SourceSetList {
+	if in == nil {
+		return nil
+	}
+	out := new(SourceSetList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SourceSetList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SourceSetSpec) DeepCopyInto(out *SourceSetSpec) {
+	*out = *in
+	if in.Kinds != nil {
+		in, out := &in.Kinds, &out.Kinds
+		*out = make([]SourceSetKindName, len(*in))
+		copy(*out, *in)
+	}
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SourceSetSpec.
+func (in *SourceSetSpec) DeepCopy() *SourceSetSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SourceSetSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SourceSetStatus) DeepCopyInto(out *SourceSetStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Sources != nil {
+		in, out := &in.Sources, &out.Sources
+		*out = make([]SourceSummary, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	out.ReconcileRequestStatus = in.ReconcileRequestStatus
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SourceSetStatus.
+func (in *SourceSetStatus) DeepCopy() *SourceSetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SourceSetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SourceSummary) DeepCopyInto(out *SourceSummary) {
+	*out = *in
+	if in.LastUpdateTime != nil {
+		in, out := &in.LastUpdateTime, &out.LastUpdateTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SourceSummary.
+func (in *SourceSummary) DeepCopy() *SourceSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(SourceSummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SourceWindow) DeepCopyInto(out *SourceWindow) {
+	*out = *in
+	out.Duration = in.Duration
+	if in.Days != nil {
+		in, out := &in.Days, &out.Days
+		*out = make([]WindowDay, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SourceWindow.
+func (in *SourceWindow) DeepCopy() *SourceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(SourceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	"github.com/fluxcd/pkg/apis/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+// BucketKind is the string representation of a Bucket.
+const BucketKind = "Bucket"
+
+// BucketSpec defines the desired state of an S3 compatible bucket, unchanged
+// from v1beta1.
+type BucketSpec v1beta1.BucketSpec
+
+// BucketStatus defines the observed state of a bucket. The deprecated URL of
+// v1beta1 is replaced by the URL of the Artifact.
+type BucketStatus struct {
+	// ObservedGeneration is the last observed generation.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions holds the conditions for the Bucket.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Artifact represents the output of the last successful Bucket sync.
+	// +optional
+	Artifact *v1beta1.Artifact `json:"artifact,omitempty"`
+
+	// Preview is the result of the last dry-run reconciliation, set instead
+	// of the Artifact when the DryRunAnnotation is 'true'.
+	// +optional
+	Preview *v1beta1.SourcePreview `json:"preview,omitempty"`
+
+	// PublishedReference is the OCI reference, with digest, of the last
+	// artifact pushed to the Publish OCIRepository.
+	// +optional
+	PublishedReference string `json:"publishedReference,omitempty"`
+
+	// InlineArtifact is the last artifact embedded in the Kubernetes API
+	// according to the Inline spec.
+	// +optional
+	InlineArtifact *v1beta1.InlineArtifact `json:"inlineArtifact,omitempty"`
+
+	// PendingRevision is the revision fetched outside of the Window, for
+	// which no artifact is produced until the Window opens.
+	// +optional
+	PendingRevision string `json:"pendingRevision,omitempty"`
+
+	// LastFailure is the detail of the failure of the last reconciliation,
+	// removed once a reconciliation succeeds.
+	// +optional
+	LastFailure *v1beta1.SourceFailure `json:"lastFailure,omitempty"`
+
+	// NextReconcileAt is the time the next reconciliation is scheduled at,
+	// from the interval or the delay before the next attempt. Not set when
+	// the source is only reconciled on change or request, or when a failure
+	// is retried with an exponential backoff.
+	// +optional
+	NextReconcileAt *metav1.Time `json:"nextReconcileAt,omitempty"`
+
+	meta.ReconcileRequestStatus `json:",inline"`
+}
+
+// GetArtifact returns the latest artifact from the source if present in the
+// status sub-resource.
+func (in *Bucket) GetArtifact() *v1beta1.Artifact {
+	return in.Status.Artifact
+}
+
+// GetStatusConditions returns a pointer to the Status.Conditions slice
+func (in *Bucket) GetStatusConditions() *[]metav1.Condition {
+	return &in.Status.Conditions
+}
+
+// GetInterval returns the interval at which the source is updated.
+func (in *Bucket) GetInterval() metav1.Duration {
+	return in.Spec.Interval
+}
+
+// +genclient
+// +genclient:Namespaced
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.spec.endpoint`
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description=""
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].message",description=""
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description=""
+
+// Bucket is the Schema for the buckets API
+type Bucket struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   BucketSpec   `json:"spec,omitempty"`
+	Status BucketStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// BucketList contains a list of Bucket
+type BucketList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Bucket `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Bucket{}, &BucketList{})
+}
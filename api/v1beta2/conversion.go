@@ -0,0 +1,181 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+// StatusURLAnnotation is the annotation holding the deprecated URL of the
+// status of a v1beta1 source converted to v1beta2, for it to be restored when
+// the source is converted back to v1beta1.
+const StatusURLAnnotation = "source.toolkit.fluxcd.io/v1beta1-status-url"
+
+// ConvertTo converts the GitRepository to the given v1beta1.GitRepository
+// hub, restoring the deprecated URL of the v1beta1 status from the
+// StatusURLAnnotation.
+func (in *GitRepository) ConvertTo(hub conversion.Hub) error {
+	dst, ok := hub.(*v1beta1.GitRepository)
+	if !ok {
+		return fmt.Errorf("unsupported conversion hub %T", hub)
+	}
+	var url string
+	dst.ObjectMeta, url = popStatusURL(in.ObjectMeta)
+	dst.Spec = v1beta1.GitRepositorySpec(in.Spec)
+	dst.Status = v1beta1.GitRepositoryStatus{
+		ObservedGeneration:     in.Status.ObservedGeneration,
+		Conditions:             in.Status.Conditions,
+		URL:                    url,
+		Artifact:               in.Status.Artifact,
+		IncludedArtifacts:      in.Status.IncludedArtifacts,
+		Preview:                in.Status.Preview,
+		RetryAfter:             in.Status.RetryAfter,
+		PublishedReference:     in.Status.PublishedReference,
+		InlineArtifact:         in.Status.InlineArtifact,
+		PendingRevision:        in.Status.PendingRevision,
+		Tag:                    in.Status.Tag,
+		LastFailure:            in.Status.LastFailure,
+		NextReconcileAt:        in.Status.NextReconcileAt,
+		ReconcileRequestStatus: in.Status.ReconcileRequestStatus,
+	}
+	return nil
+}
+
+// ConvertFrom converts the given v1beta1.GitRepository hub to the
+// GitRepository, keeping the deprecated URL of its status in the
+// StatusURLAnnotation.
+func (in *GitRepository) ConvertFrom(hub conversion.Hub) error {
+	src, ok := hub.(*v1beta1.GitRepository)
+	if !ok {
+		return fmt.Errorf("unsupported conversion hub %T", hub)
+	}
+	in.ObjectMeta = pushStatusURL(src.ObjectMeta, src.Status.URL)
+	in.Spec = GitRepositorySpec(src.Spec)
+	in.Status = GitRepositoryStatus{
+		ObservedGeneration:     src.Status.ObservedGeneration,
+		Conditions:             src.Status.Conditions,
+		Artifact:               src.Status.Artifact,
+		IncludedArtifacts:      src.Status.IncludedArtifacts,
+		Preview:                src.Status.Preview,
+		RetryAfter:             src.Status.RetryAfter,
+		PublishedReference:     src.Status.PublishedReference,
+		InlineArtifact:         src.Status.InlineArtifact,
+		PendingRevision:        src.Status.PendingRevision,
+		Tag:                    src.Status.Tag,
+		LastFailure:            src.Status.LastFailure,
+		NextReconcileAt:        src.Status.NextReconcileAt,
+		ReconcileRequestStatus: src.Status.ReconcileRequestStatus,
+	}
+	return nil
+}
+
+// ConvertTo converts the Bucket to the given v1beta1.Bucket hub, restoring
+// the deprecated URL of the v1beta1 status from the StatusURLAnnotation.
+func (in *Bucket) ConvertTo(hub conversion.Hub) error {
+	dst, ok := hub.(*v1beta1.Bucket)
+	if !ok {
+		return fmt.Errorf("unsupported conversion hub %T", hub)
+	}
+	var url string
+	dst.ObjectMeta, url = popStatusURL(in.ObjectMeta)
+	dst.Spec = v1beta1.BucketSpec(in.Spec)
+	dst.Status = v1beta1.BucketStatus{
+		ObservedGeneration:     in.Status.ObservedGeneration,
+		Conditions:             in.Status.Conditions,
+		URL:                    url,
+		Artifact:               in.Status.Artifact,
+		Preview:                in.Status.Preview,
+		PublishedReference:     in.Status.PublishedReference,
+		InlineArtifact:         in.Status.InlineArtifact,
+		PendingRevision:        in.Status.PendingRevision,
+		LastFailure:            in.Status.LastFailure,
+		NextReconcileAt:        in.Status.NextReconcileAt,
+		ReconcileRequestStatus: in.Status.ReconcileRequestStatus,
+	}
+	return nil
+}
+
+// ConvertFrom converts the given v1beta1.Bucket hub to the Bucket, keeping
+// the deprecated URL of its status in the StatusURLAnnotation.
+func (in *Bucket) ConvertFrom(hub conversion.Hub) error {
+	src, ok := hub.(*v1beta1.Bucket)
+	if !ok {
+		return fmt.Errorf("unsupported conversion hub %T", hub)
+	}
+	in.ObjectMeta = pushStatusURL(src.ObjectMeta, src.Status.URL)
+	in.Spec = BucketSpec(src.Spec)
+	in.Status = BucketStatus{
+		ObservedGeneration:     src.Status.ObservedGeneration,
+		Conditions:             src.Status.Conditions,
+		Artifact:               src.Status.Artifact,
+		Preview:                src.Status.Preview,
+		PublishedReference:     src.Status.PublishedReference,
+		InlineArtifact:         src.Status.InlineArtifact,
+		PendingRevision:        src.Status.PendingRevision,
+		LastFailure:            src.Status.LastFailure,
+		NextReconcileAt:        src.Status.NextReconcileAt,
+		ReconcileRequestStatus: src.Status.ReconcileRequestStatus,
+	}
+	return nil
+}
+
+// pushStatusURL returns a copy of the given object metadata of a v1beta1
+// source with the given URL of its status in the StatusURLAnnotation, or
+// without the annotation if the URL is empty.
+func pushStatusURL(meta metav1.ObjectMeta, url string) metav1.ObjectMeta {
+	meta.Annotations = copyAnnotations(meta.Annotations)
+	if url == "" {
+		delete(meta.Annotations, StatusURLAnnotation)
+	} else {
+		if meta.Annotations == nil {
+			meta.Annotations = make(map[string]string)
+		}
+		meta.Annotations[StatusURLAnnotation] = url
+	}
+	return meta
+}
+
+// popStatusURL returns a copy of the given object metadata of a v1beta2
+// source without the StatusURLAnnotation, and the URL it holds.
+func popStatusURL(meta metav1.ObjectMeta) (metav1.ObjectMeta, string) {
+	url, ok := meta.Annotations[StatusURLAnnotation]
+	if !ok {
+		return meta, ""
+	}
+	meta.Annotations = copyAnnotations(meta.Annotations)
+	delete(meta.Annotations, StatusURLAnnotation)
+	if len(meta.Annotations) == 0 {
+		meta.Annotations = nil
+	}
+	return meta, url
+}
+
+func copyAnnotations(annotations map[string]string) map[string]string {
+	if annotations == nil {
+		return nil
+	}
+	c := make(map[string]string, len(annotations))
+	for k, v := range annotations {
+		c[k] = v
+	}
+	return c
+}
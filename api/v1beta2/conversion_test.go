@@ -0,0 +1,126 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+func TestGitRepository_Conversion(t *testing.T) {
+	now := metav1.NewTime(time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC))
+	artifact := &v1beta1.Artifact{Path: "gitrepository/default/podinfo/363a6a8.tar.gz", URL: "http://source-controller/363a6a8.tar.gz", Revision: "main/363a6a8"}
+	hub := &v1beta1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "default", Generation: 2},
+		Spec: v1beta1.GitRepositorySpec{
+			URL:       "https://github.com/stefanprodan/podinfo",
+			Interval:  metav1.Duration{Duration: time.Minute},
+			Reference: &v1beta1.GitRepositoryRef{Branch: "main"},
+			Ignore:    func(s string) *string { return &s }("/*.md"),
+		},
+		Status: v1beta1.GitRepositoryStatus{
+			ObservedGeneration:     2,
+			Conditions:             []metav1.Condition{{Type: meta.ReadyCondition, Status: metav1.ConditionTrue, Reason: v1beta1.GitOperationSucceedReason}},
+			URL:                    "http://source-controller/latest.tar.gz",
+			Artifact:               artifact,
+			IncludedArtifacts:      []*v1beta1.Artifact{artifact},
+			Tag:                    &v1beta1.GitTag{Name: "v1.0.0"},
+			NextReconcileAt:        &now,
+			ReconcileRequestStatus: meta.ReconcileRequestStatus{LastHandledReconcileAt: "1"},
+		},
+	}
+
+	var spoke GitRepository
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatalf("ConvertFrom() error = %v", err)
+	}
+	if !reflect.DeepEqual(v1beta1.GitRepositorySpec(spoke.Spec), hub.Spec) {
+		t.Errorf("ConvertFrom() spec = %+v, want %+v", spoke.Spec, hub.Spec)
+	}
+	if spoke.GetArtifact() != artifact || spoke.Status.Tag.Name != "v1.0.0" {
+		t.Errorf("ConvertFrom() status = %+v", spoke.Status)
+	}
+	if got := spoke.GetAnnotations()[StatusURLAnnotation]; got != hub.Status.URL {
+		t.Errorf("ConvertFrom() %s annotation = %q, want %q", StatusURLAnnotation, got, hub.Status.URL)
+	}
+	if hub.Annotations != nil {
+		t.Errorf("ConvertFrom() modified the hub annotations: %v", hub.Annotations)
+	}
+
+	var got v1beta1.GitRepository
+	if err := spoke.ConvertTo(&got); err != nil {
+		t.Fatalf("ConvertTo() error = %v", err)
+	}
+	want := hub.DeepCopy()
+	if !reflect.DeepEqual(&got, want) {
+		t.Errorf("ConvertTo() = %+v, want %+v", got, want)
+	}
+
+	if err := spoke.ConvertTo(&v1beta1.Bucket{}); err == nil {
+		t.Error("ConvertTo() returned no error for a Bucket hub")
+	}
+}
+
+func TestBucket_Conversion(t *testing.T) {
+	hub := &v1beta1.Bucket{
+		ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "default"},
+		Spec: v1beta1.BucketSpec{
+			BucketName: "podinfo",
+			Endpoint:   "minio.minio.svc.cluster.local:9000",
+			Interval:   metav1.Duration{Duration: time.Minute},
+		},
+		Status: v1beta1.BucketStatus{
+			URL:             "http://source-controller/latest.tar.gz",
+			Artifact:        &v1beta1.Artifact{Revision: "1234"},
+			PendingRevision: "5678",
+		},
+	}
+
+	for _, annotations := range []map[string]string{nil, {"app": "podinfo"}} {
+		hub.Annotations = annotations
+		var spoke Bucket
+		if err := spoke.ConvertFrom(hub); err != nil {
+			t.Fatalf("ConvertFrom() error = %v", err)
+		}
+		var got v1beta1.Bucket
+		if err := spoke.ConvertTo(&got); err != nil {
+			t.Fatalf("ConvertTo() error = %v", err)
+		}
+		if !reflect.DeepEqual(&got, hub) {
+			t.Errorf("ConvertTo() = %+v, want %+v", got, hub)
+		}
+		if _, ok := spoke.GetAnnotations()[StatusURLAnnotation]; !ok {
+			t.Errorf("ConvertTo() removed the %s annotation of the spoke", StatusURLAnnotation)
+		}
+	}
+
+	// a URL left empty is not annotated
+	hub.Status.URL = ""
+	var spoke Bucket
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatalf("ConvertFrom() error = %v", err)
+	}
+	if _, ok := spoke.GetAnnotations()[StatusURLAnnotation]; ok {
+		t.Errorf("ConvertFrom() set the %s annotation for an empty URL", StatusURLAnnotation)
+	}
+}
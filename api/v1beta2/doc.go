@@ -0,0 +1,22 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1beta2 contains API Schema definitions for the source v1beta2 API
+// group. Its GitRepository and Bucket are converted from and to the v1beta1
+// ones, which are the storage versions, by the conversion webhook.
+// +kubebuilder:object:generate=true
+// +groupName=source.toolkit.fluxcd.io
+package v1beta2
@@ -0,0 +1,145 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	"github.com/fluxcd/pkg/apis/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+// GitRepositoryKind is the string representation of a GitRepository.
+const GitRepositoryKind = "GitRepository"
+
+// GitRepositorySpec defines the desired state of a Git repository, unchanged
+// from v1beta1.
+type GitRepositorySpec v1beta1.GitRepositorySpec
+
+// GitRepositoryStatus defines the observed state of a Git repository. The
+// deprecated URL of v1beta1 is replaced by the URL of the Artifact.
+type GitRepositoryStatus struct {
+	// ObservedGeneration is the last observed generation.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions holds the conditions for the GitRepository.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Artifact represents the output of the last successful repository sync.
+	// +optional
+	Artifact *v1beta1.Artifact `json:"artifact,omitempty"`
+
+	// IncludedArtifacts represents the included artifacts from the last successful repository sync.
+	// +optional
+	IncludedArtifacts []*v1beta1.Artifact `json:"includedArtifacts,omitempty"`
+
+	// Preview is the result of the last dry-run reconciliation, set instead
+	// of the Artifact when the DryRunAnnotation is 'true'.
+	// +optional
+	Preview *v1beta1.SourcePreview `json:"preview,omitempty"`
+
+	// RetryAfter is the delay before the next attempt requested by the
+	// upstream with a Retry-After header after the last fetch was rate
+	// limited, which replaces the interval until the next fetch succeeds.
+	// +optional
+	RetryAfter *metav1.Duration `json:"retryAfter,omitempty"`
+
+	// PublishedReference is the OCI reference, with digest, of the last
+	// artifact pushed to the Publish OCIRepository.
+	// +optional
+	PublishedReference string `json:"publishedReference,omitempty"`
+
+	// InlineArtifact is the last artifact embedded in the Kubernetes API
+	// according to the Inline spec.
+	// +optional
+	InlineArtifact *v1beta1.InlineArtifact `json:"inlineArtifact,omitempty"`
+
+	// PendingRevision is the revision fetched outside of the Window, for
+	// which no artifact is produced until the Window opens.
+	// +optional
+	PendingRevision string `json:"pendingRevision,omitempty"`
+
+	// Tag is the metadata of the tag the artifact was fetched from, set when
+	// the reference is a tag or a semver range.
+	// +optional
+	Tag *v1beta1.GitTag `json:"tag,omitempty"`
+
+	// LastFailure is the detail of the failure of the last reconciliation,
+	// removed once a reconciliation succeeds.
+	// +optional
+	LastFailure *v1beta1.SourceFailure `json:"lastFailure,omitempty"`
+
+	// NextReconcileAt is the time the next reconciliation is scheduled at,
+	// from the interval or the delay before the next attempt. Not set when
+	// the source is only reconciled on change or request, or when a failure
+	// is retried with an exponential backoff.
+	// +optional
+	NextReconcileAt *metav1.Time `json:"nextReconcileAt,omitempty"`
+
+	meta.ReconcileRequestStatus `json:",inline"`
+}
+
+// GetArtifact returns the latest artifact from the source if present in the
+// status sub-resource.
+func (in *GitRepository) GetArtifact() *v1beta1.Artifact {
+	return in.Status.Artifact
+}
+
+// GetStatusConditions returns a pointer to the Status.Conditions slice
+func (in *GitRepository) GetStatusConditions() *[]metav1.Condition {
+	return &in.Status.Conditions
+}
+
+// GetInterval returns the interval at which the source is updated.
+func (in *GitRepository) GetInterval() metav1.Duration {
+	return in.Spec.Interval
+}
+
+// +genclient
+// +genclient:Namespaced
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=gitrepo
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.spec.url`
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description=""
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].message",description=""
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description=""
+
+// GitRepository is the Schema for the gitrepositories API
+type GitRepository struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   GitRepositorySpec   `json:"spec,omitempty"`
+	Status GitRepositoryStatus `json:"status,omitempty"`
+}
+
+// GitRepositoryList contains a list of GitRepository
+// +kubebuilder:object:root=true
+type GitRepositoryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []GitRepository `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&GitRepository{}, &GitRepositoryList{})
+}
@@ -1,6 +1,18 @@
 package controllers
 
-import sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"github.com/fluxcd/source-controller/internal/index"
+	sourcemetrics "github.com/fluxcd/source-controller/internal/metrics"
+)
 
 // hasArtifactUpdated returns true if any of the revisions in the current artifacts
 // does not match any of the artifacts in the updated artifacts
@@ -21,3 +33,68 @@ OUTER:
 
 	return false
 }
+
+// indexArtifact records the given artifact as the latest artifact of the
+// source in the index. It is a no-op if the index or artifact is nil.
+func indexArtifact(idx *index.Index, storage *Storage, kind, namespace, name string, artifact *sourcev1.Artifact) {
+	if idx == nil || artifact == nil {
+		return
+	}
+	var size int64
+	if fi, err := os.Stat(storage.LocalPath(*artifact)); err == nil {
+		size = fi.Size()
+	}
+	idx.Set(index.Entry{
+		Kind:           kind,
+		Namespace:      namespace,
+		Name:           name,
+		Revision:       artifact.Revision,
+		URL:            artifact.URL,
+		Checksum:       artifact.Checksum,
+		Size:           size,
+		LastUpdateTime: artifact.LastUpdateTime,
+	})
+}
+
+// unindexArtifact removes the source from the index. It is a no-op if the
+// index is nil.
+func unindexArtifact(idx *index.Index, kind, namespace, name string) {
+	if idx == nil {
+		return
+	}
+	idx.Delete(kind, namespace, name)
+}
+
+// recordArtifactRevision records the revision of the given artifact of the
+// source in the metrics, counting a revision change if it differs from the
+// revision of the given previous artifact. It is a no-op if the artifact is
+// nil.
+func recordArtifactRevision(recorder *sourcemetrics.Recorder, kind, namespace, name string, previous, artifact *sourcev1.Artifact) {
+	if artifact == nil {
+		return
+	}
+	changed := previous == nil || previous.Revision != artifact.Revision
+	recorder.RecordArtifactRevision(kind, namespace, name, artifact.Revision, artifact.LastUpdateTime.Time, changed)
+}
+
+// setArtifactOutdated sets the sourcev1.ArtifactOutdatedCondition to 'True' on
+// the object if the artifact was last updated longer than staleAfter ago, and
+// removes the condition otherwise. It returns the condition message if the
+// object just became outdated, so the caller only emits a warning event once.
+func setArtifactOutdated(obj meta.ObjectWithStatusConditions, artifact *sourcev1.Artifact, staleAfter *metav1.Duration) string {
+	conditions := obj.GetStatusConditions()
+	if staleAfter == nil || staleAfter.Duration <= 0 || artifact == nil ||
+		time.Since(artifact.LastUpdateTime.Time) <= staleAfter.Duration {
+		apimeta.RemoveStatusCondition(conditions, sourcev1.ArtifactOutdatedCondition)
+		return ""
+	}
+
+	outdated := apimeta.IsStatusConditionTrue(*conditions, sourcev1.ArtifactOutdatedCondition)
+	msg := fmt.Sprintf("artifact for revision '%s' has not been updated since %s, exceeding the stale after duration of %s",
+		artifact.Revision, artifact.LastUpdateTime.UTC().Format(time.RFC3339), staleAfter.Duration.String())
+	meta.SetResourceCondition(obj, sourcev1.ArtifactOutdatedCondition, metav1.ConditionTrue, sourcev1.ArtifactStaleReason, msg)
+	if outdated {
+		return ""
+	}
+	return msg
+}
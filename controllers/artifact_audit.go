@@ -0,0 +1,118 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	sourcemetrics "github.com/fluxcd/source-controller/internal/metrics"
+)
+
+// AuditHandler returns a handler serving the requests with the given handler,
+// and auditing each of them with the client IP, the requested path, the
+// response status and the number of bytes served. The requests are logged
+// with the given logger if not nil, and the downloads of the artifacts of the
+// sources are counted by the given recorder if not nil.
+func AuditHandler(h http.Handler, log logr.Logger, recorder *sourcemetrics.Recorder) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		aw := &auditResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(aw, r)
+
+		failed := aw.status >= http.StatusBadRequest
+		kind, namespace, name := artifactSource(r.URL.Path)
+		if log != nil {
+			keysAndValues := []interface{}{
+				"clientIP", clientIP(r),
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", aw.status,
+				"bytes", aw.bytes,
+				"duration", time.Since(start).String(),
+				"userAgent", r.UserAgent(),
+			}
+			if kind != "" {
+				keysAndValues = append(keysAndValues, "kind", kind, "namespace", namespace, "name", name)
+			}
+			if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+				keysAndValues = append(keysAndValues, "forwardedFor", forwardedFor)
+			}
+			log.Info("artifact download", keysAndValues...)
+		}
+		// the requests for other paths are not counted, as their labels
+		// are not bounded
+		if kind != "" {
+			recorder.RecordDownload(kind, namespace, name, failed, aw.bytes)
+		}
+	})
+}
+
+// auditResponseWriter records the status and the number of bytes of the
+// response written with the wrapped http.ResponseWriter.
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// artifactSource returns the kind, namespace and name of the source of the
+// artifact at the given URL path, in the
+// '<source-kind>/<source-namespace>/<source-name>/<artifact-filename>' form,
+// or empty strings if the path is not the one of an artifact.
+func artifactSource(urlPath string) (kind, namespace, name string) {
+	parts := strings.Split(strings.TrimPrefix(path.Clean("/"+urlPath), "/"), "/")
+	if len(parts) != 4 {
+		return "", "", ""
+	}
+	for _, k := range sourceSetKinds {
+		if strings.ToLower(k) == parts[0] {
+			return k, parts[1], parts[2]
+		}
+	}
+	return "", "", ""
+}
+
+// clientIP returns the IP address of the client of the given request.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
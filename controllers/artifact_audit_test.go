@@ -0,0 +1,105 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestAuditHandler(t *testing.T) {
+	files := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/gitrepository/default/podinfo/1234.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("tarball"))
+	})
+	log := &auditLog{}
+	h := AuditHandler(files, log, nil)
+
+	for _, tt := range []struct {
+		path       string
+		wantStatus int
+		wantBytes  int64
+		wantKind   string
+	}{
+		{path: "/gitrepository/default/podinfo/1234.tar.gz", wantStatus: http.StatusOK, wantBytes: 7, wantKind: "GitRepository"},
+		{path: "/helmchart/default/podinfo/podinfo-1.0.0.tgz", wantStatus: http.StatusNotFound, wantBytes: 19, wantKind: "HelmChart"},
+		{path: "/favicon.ico", wantStatus: http.StatusNotFound, wantBytes: 19},
+	} {
+		log.entries = nil
+		req := httptest.NewRequest(http.MethodGet, tt.path+"?expires=1", nil)
+		req.RemoteAddr = "10.0.0.1:43210"
+		h.ServeHTTP(httptest.NewRecorder(), req)
+
+		if len(log.entries) != 1 {
+			t.Fatalf("%s: expected one audit log entry, got %d", tt.path, len(log.entries))
+		}
+		got := log.entries[0]
+		if got["clientIP"] != "10.0.0.1" || got["path"] != tt.path || got["status"] != tt.wantStatus || got["bytes"] != tt.wantBytes {
+			t.Errorf("%s: unexpected audit log entry %v", tt.path, got)
+		}
+		if kind, _ := got["kind"].(string); kind != tt.wantKind {
+			t.Errorf("%s: expected kind %q, got %q", tt.path, tt.wantKind, kind)
+		}
+	}
+}
+
+func Test_artifactSource(t *testing.T) {
+	tests := []struct {
+		path                              string
+		wantKind, wantNamespace, wantName string
+	}{
+		{path: "/bucket/flux-system/podinfo/1234.tar.gz", wantKind: "Bucket", wantNamespace: "flux-system", wantName: "podinfo"},
+		{path: "/helmrepository/default/stable/index-1234.yaml", wantKind: "HelmRepository", wantNamespace: "default", wantName: "stable"},
+		{path: "/gitrepository/default/podinfo/../../other/podinfo/1234.tar.gz", wantKind: "GitRepository", wantNamespace: "other", wantName: "podinfo"},
+		{path: "/gitrepository/default/podinfo"},
+		{path: "/unknown/default/podinfo/1234.tar.gz"},
+	}
+	for _, tt := range tests {
+		kind, namespace, name := artifactSource(tt.path)
+		if kind != tt.wantKind || namespace != tt.wantNamespace || name != tt.wantName {
+			t.Errorf("artifactSource(%q) = %q, %q, %q, want %q, %q, %q", tt.path, kind, namespace, name,
+				tt.wantKind, tt.wantNamespace, tt.wantName)
+		}
+	}
+}
+
+// auditLog is a logr.Logger recording the key and values of the Info
+// entries.
+type auditLog struct {
+	entries []map[string]interface{}
+}
+
+func (l *auditLog) Enabled() bool { return true }
+
+func (l *auditLog) Info(_ string, keysAndValues ...interface{}) {
+	entry := make(map[string]interface{})
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		entry[keysAndValues[i].(string)] = keysAndValues[i+1]
+	}
+	l.entries = append(l.entries, entry)
+}
+
+func (l *auditLog) Error(error, string, ...interface{})   {}
+func (l *auditLog) V(int) logr.Logger                     { return l }
+func (l *auditLog) WithValues(...interface{}) logr.Logger { return l }
+func (l *auditLog) WithName(string) logr.Logger           { return l }
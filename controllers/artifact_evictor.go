@@ -0,0 +1,210 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sourcemetrics "github.com/fluxcd/source-controller/internal/metrics"
+)
+
+// evictionMinAge is the minimum age of the artifact files considered for
+// eviction, as the recently written artifacts may not be recorded in the
+// status of their source yet.
+const evictionMinAge = 5 * time.Minute
+
+// ArtifactEvictor periodically enforces the maximum size of the storage, by
+// removing the least recently served artifacts when the files in storage
+// exceed it. The current artifacts of the sources are never evicted, only
+// the artifacts kept in history or left behind by the sources.
+type ArtifactEvictor struct {
+	client.Client
+	Storage            *Storage
+	OperationsRecorder *sourcemetrics.Recorder
+	Log                logr.Logger
+
+	// MaxSize is the maximum size in bytes of the files in storage.
+	MaxSize int64
+
+	// Interval is the interval at which the size of the storage is checked.
+	Interval time.Duration
+}
+
+// evictionCandidate is an artifact file which may be evicted.
+type evictionCandidate struct {
+	path       string
+	kind       string
+	size       int64
+	accessTime time.Time
+}
+
+// Start enforces the maximum size of the storage at every interval until the
+// context is done. It implements the manager.Runnable interface.
+func (e *ArtifactEvictor) Start(ctx context.Context) error {
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := e.evict(ctx); err != nil {
+				e.Log.Error(err, "unable to evict artifacts")
+			}
+		}
+	}
+}
+
+// NeedLeaderElection implements the manager.LeaderElectionRunnable interface,
+// as only the leader produces and removes the artifacts.
+func (e *ArtifactEvictor) NeedLeaderElection() bool {
+	return true
+}
+
+// evict removes the least recently served artifacts which are not the
+// current artifact of a source, until the size of the storage is below the
+// maximum size.
+func (e *ArtifactEvictor) evict(ctx context.Context) error {
+	retained, err := e.currentArtifacts(ctx)
+	if err != nil {
+		return err
+	}
+	used, candidates, err := e.scan(ctx, retained, time.Now().Add(-evictionMinAge))
+	if err != nil {
+		return err
+	}
+	if used <= e.MaxSize {
+		return nil
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].accessTime.Before(candidates[j].accessTime)
+	})
+	for _, c := range candidates {
+		if used <= e.MaxSize {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		freed := c.size
+		if n, err := linkCount(c.path); err == nil && n > 2 {
+			// the blob is still linked to by other artifacts
+			freed = 0
+		}
+		if err := e.Storage.removeFile(c.path); err != nil {
+			e.Log.Error(err, "unable to evict artifact", "path", c.path)
+			continue
+		}
+		used -= freed
+		e.OperationsRecorder.RecordEviction(c.kind, freed)
+		e.Log.Info(fmt.Sprintf("evicted artifact '%s'", c.path), "kind", c.kind, "size", c.size)
+	}
+	if used > e.MaxSize {
+		e.Log.Info(fmt.Sprintf("storage size %d exceeds the maximum size %d, with only current artifacts left to evict", used, e.MaxSize))
+	}
+	return nil
+}
+
+// currentArtifacts returns the local paths of the files of the current
+// artifacts of the sources of all kinds.
+func (e *ArtifactEvictor) currentArtifacts(ctx context.Context) (map[string]bool, error) {
+	retained := make(map[string]bool)
+	for _, kind := range sourceSetKinds {
+		list, items := newSourceList(kind)
+		if err := e.List(ctx, list); err != nil {
+			return nil, fmt.Errorf("unable to list %s sources: %w", kind, err)
+		}
+		for _, obj := range items() {
+			if artifact := obj.GetArtifact(); artifact != nil {
+				for _, p := range e.Storage.artifactFiles(*artifact) {
+					retained[p] = true
+				}
+			}
+		}
+	}
+	return retained, nil
+}
+
+// scan returns the size of the files in storage, and the artifact files that
+// are not retained and were last modified before the given time. The
+// deduplicated artifacts are accounted for by the size of their blob. The scan
+// stops once the given context is done.
+func (e *ArtifactEvictor) scan(ctx context.Context, retained map[string]bool, before time.Time) (int64, []evictionCandidate, error) {
+	var (
+		used       int64
+		candidates []evictionCandidate
+	)
+	blobsDir := filepath.Join(e.Storage.BasePath, BlobsDir)
+	err := filepath.Walk(e.Storage.BasePath, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if strings.HasPrefix(p, blobsDir+string(filepath.Separator)) {
+			used += info.Size()
+			return nil
+		}
+		if n, err := linkCount(p); err != nil || n < 2 {
+			used += info.Size()
+		}
+		if retained[p] || strings.HasSuffix(p, ".lock") || !info.ModTime().Before(before) {
+			return nil
+		}
+		candidates = append(candidates, evictionCandidate{
+			path:       p,
+			kind:       artifactKind(e.Storage.BasePath, p),
+			size:       info.Size(),
+			accessTime: accessTime(info),
+		})
+		return nil
+	})
+	return used, candidates, err
+}
+
+// artifactKind returns the kind of the source of the artifact at the given
+// path, from its directory in the storage.
+func artifactKind(basePath, p string) string {
+	rel, err := filepath.Rel(basePath, p)
+	if err != nil {
+		return ""
+	}
+	dir := strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+	for _, kind := range sourceSetKinds {
+		if strings.ToLower(kind) == dir {
+			return kind
+		}
+	}
+	return dir
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"github.com/fluxcd/source-controller/internal/sbom"
+)
+
+func TestArtifactEvictor_evict(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := sourcev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := createStoragePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanupStoragePath(dir))
+	storage, err := NewStorage(dir, "hostname", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// write writes an artifact of 100 bytes, last modified an hour ago and
+	// last served at the given time
+	write := func(kind, name, revision string, served time.Time) *sourcev1.Artifact {
+		t.Helper()
+		a := storage.NewArtifactFor(kind, &metav1.ObjectMeta{Name: name, Namespace: "default"}, revision, revision+".tgz")
+		if err := storage.MkdirAll(a); err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.AtomicWriteFile(&a, strings.NewReader(strings.Repeat(revision[:1], 100)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := time.Now().Add(-time.Hour)
+		if served.IsZero() {
+			served = modTime
+		}
+		if err := os.Chtimes(storage.LocalPath(a), served, modTime); err != nil {
+			t.Fatal(err)
+		}
+		return &a
+	}
+
+	now := time.Now()
+	chart := &sourcev1.HelmChart{ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "default"}}
+	chart.Status.Artifact = write(sourcev1.HelmChartKind, chart.Name, "3.0.0", time.Time{})
+	older := write(sourcev1.HelmChartKind, chart.Name, "1.0.0", now.Add(-30*time.Minute))
+	recent := write(sourcev1.HelmChartKind, chart.Name, "2.0.0", now.Add(-time.Minute))
+	orphan := write(sourcev1.GitRepositoryKind, "deleted", "abcdef", time.Time{})
+
+	// the SBOMs written alongside the current and an older artifact
+	sbomExt, err := sbom.Ext(sbom.SPDXFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentSBOM := storage.LocalPath(*chart.Status.Artifact) + sbomExt
+	olderSBOM := storage.LocalPath(*older) + sbomExt
+	for _, p := range []string{currentSBOM, olderSBOM} {
+		if err := os.WriteFile(p, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, now.Add(-time.Hour), now.Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// an artifact written since the listing of the sources
+	pending := storage.NewArtifactFor(sourcev1.HelmChartKind, &chart.ObjectMeta, "4.0.0", "4.0.0.tgz")
+	if err := storage.AtomicWriteFile(&pending, strings.NewReader(strings.Repeat("4", 100)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := &ArtifactEvictor{
+		Client:  fake.NewClientBuilder().WithScheme(scheme).WithObjects(chart).Build(),
+		Storage: storage,
+		Log:     logr.Discard(),
+		MaxSize: 302,
+	}
+
+	// nothing is evicted once the context is done
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	if err := e.evict(ctx); err == nil {
+		t.Error("evict() with a done context error = nil")
+	}
+	if !storage.ArtifactExist(*orphan) {
+		t.Errorf("artifact %s was evicted with a done context", orphan.Path)
+	}
+
+	if err := e.evict(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, a := range []*sourcev1.Artifact{orphan, older} {
+		if storage.ArtifactExist(*a) {
+			t.Errorf("artifact %s was not evicted", a.Path)
+		}
+	}
+	for _, a := range []*sourcev1.Artifact{chart.Status.Artifact, recent, &pending} {
+		if !storage.ArtifactExist(*a) {
+			t.Errorf("artifact %s was evicted", a.Path)
+		}
+	}
+
+	// the current artifacts are kept above the maximum size
+	e.MaxSize = 0
+	if err := e.evict(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if storage.ArtifactExist(*recent) {
+		t.Errorf("artifact %s was not evicted", recent.Path)
+	}
+	if !storage.ArtifactExist(*chart.Status.Artifact) {
+		t.Error("current artifact was evicted")
+	}
+	if _, err := os.Stat(currentSBOM); err != nil {
+		t.Errorf("SBOM of the current artifact was evicted: %v", err)
+	}
+	if _, err := os.Stat(olderSBOM); !os.IsNotExist(err) {
+		t.Error("SBOM of an older artifact was not evicted")
+	}
+}
+
+func Test_artifactKind(t *testing.T) {
+	for p, want := range map[string]string{
+		"/data/helmchart/default/podinfo/1.0.0.tgz": sourcev1.HelmChartKind,
+		"/data/gitrepository/default/podinfo/a.tar": sourcev1.GitRepositoryKind,
+		"/data/unknown/file":                        "unknown",
+	} {
+		if got := artifactKind("/data", p); got != want {
+			t.Errorf("artifactKind(%q) = %q, want %q", p, got, want)
+		}
+	}
+}
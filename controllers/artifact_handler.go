@@ -0,0 +1,206 @@
+/*
+Copyright 2020 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"compress/gzip"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+)
+
+const (
+	// ChecksumHeader is the response header of the artifact server holding
+	// the SHA1 checksum of the artifact, as in the v1beta1.Artifact.
+	ChecksumHeader = "X-Checksum"
+	// DigestHeader is the RFC 3230 response header of the artifact server
+	// holding the SHA-256 digest of the served bytes.
+	DigestHeader = "Digest"
+
+	// tarMediaType is the media type of the uncompressed tarballs, which the
+	// clients accept to receive the .tar.gz artifacts uncompressed.
+	tarMediaType = "application/x-tar"
+
+	// maxCachedDigests is the maximum number of files whose digests are
+	// cached by the artifact handler.
+	maxCachedDigests = 1024
+)
+
+// artifactHandler serves the artifact files with their checksum headers,
+// and negotiates the compression of the .tar.gz artifacts.
+type artifactHandler struct {
+	storage *Storage
+	files   http.Handler
+
+	mu      sync.Mutex
+	digests map[string]fileDigests
+}
+
+// fileDigests are the digests of a file, computed at its modification time
+// and size.
+type fileDigests struct {
+	modTime time.Time
+	size    int64
+	sha1    string
+	sha256  string
+}
+
+// ArtifactHandler returns a handler serving the files of the storage with
+// the given file server handler, adding the ChecksumHeader and DigestHeader
+// to the responses. The .tar.gz artifacts are served uncompressed to the
+// requests accepting the 'application/x-tar' media type, with the 'gzip'
+// content encoding if the request accepts it, or else decompressed on the
+// fly.
+func (s *Storage) ArtifactHandler(files http.Handler) http.Handler {
+	return &artifactHandler{
+		storage: s,
+		files:   files,
+		digests: make(map[string]fileDigests),
+	}
+}
+
+func (h *artifactHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	localPath, err := securejoin.SecureJoin(h.storage.BasePath, r.URL.Path)
+	if err != nil {
+		h.files.ServeHTTP(w, r)
+		return
+	}
+	fi, err := os.Stat(localPath)
+	if err != nil || !fi.Mode().IsRegular() {
+		h.files.ServeHTTP(w, r)
+		return
+	}
+	digests, err := h.fileDigests(localPath, fi)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), err.Error()),
+			http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(ChecksumHeader, digests.sha1)
+	// the access time of an artifact records when it was last served, for
+	// the ArtifactEvictor to evict the least recently served ones first,
+	// and fails on the storage mounted read-only
+	_ = os.Chtimes(localPath, time.Now(), fi.ModTime())
+
+	if !strings.HasSuffix(localPath, ".tar.gz") {
+		w.Header().Set(DigestHeader, "SHA-256="+digests.sha256)
+		h.files.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Add("Vary", "Accept, Accept-Encoding")
+	switch {
+	case !acceptsValue(r.Header.Get("Accept"), tarMediaType):
+		w.Header().Set(DigestHeader, "SHA-256="+digests.sha256)
+		h.files.ServeHTTP(w, r)
+	case acceptsValue(r.Header.Get("Accept-Encoding"), "gzip"):
+		// the file is served as is, as the gzip encoding of the tarball
+		w.Header().Set("Content-Type", tarMediaType)
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set(DigestHeader, "SHA-256="+digests.sha256)
+		h.files.ServeHTTP(w, r)
+	default:
+		serveDecompressed(w, r, localPath)
+	}
+}
+
+// fileDigests returns the digests of the file at the given path, computing
+// them if the file changed since they were cached.
+func (h *artifactHandler) fileDigests(localPath string, fi os.FileInfo) (fileDigests, error) {
+	h.mu.Lock()
+	d, ok := h.digests[localPath]
+	h.mu.Unlock()
+	if ok && d.modTime.Equal(fi.ModTime()) && d.size == fi.Size() {
+		return d, nil
+	}
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return fileDigests{}, err
+	}
+	defer f.Close()
+	sha1Hash, sha256Hash := sha1.New(), sha256.New()
+	if _, err := io.Copy(io.MultiWriter(sha1Hash, sha256Hash), f); err != nil {
+		return fileDigests{}, err
+	}
+	d = fileDigests{
+		modTime: fi.ModTime(),
+		size:    fi.Size(),
+		sha1:    fmt.Sprintf("%x", sha1Hash.Sum(nil)),
+		sha256:  base64.StdEncoding.EncodeToString(sha256Hash.Sum(nil)),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// the digests of the removed artifacts are dropped with the others
+	if len(h.digests) >= maxCachedDigests {
+		h.digests = make(map[string]fileDigests)
+	}
+	h.digests[localPath] = d
+	return d, nil
+}
+
+// serveDecompressed serves the tarball of the .tar.gz file at the given path
+// decompressed. The ranges are not supported, as the size of the tarball is
+// not known in advance.
+func serveDecompressed(w http.ResponseWriter, r *http.Request, localPath string) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusInternalServerError), err.Error()),
+			http.StatusInternalServerError)
+		return
+	}
+	defer gr.Close()
+
+	w.Header().Set("Content-Type", tarMediaType)
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		_, _ = io.Copy(w, gr)
+	}
+}
+
+// acceptsValue returns true if the given Accept or Accept-Encoding header
+// value lists the given value with a non-zero quality.
+func acceptsValue(header, value string) bool {
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(params[0]), value) {
+			continue
+		}
+		for _, p := range params[1:] {
+			if q := strings.TrimSpace(p); strings.HasPrefix(q, "q=") && strings.Trim(strings.TrimPrefix(q, "q="), "0.") == "" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
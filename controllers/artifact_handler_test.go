@@ -0,0 +1,179 @@
+/*
+Copyright 2020 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+func TestStorage_ArtifactHandler(t *testing.T) {
+	dir, err := createStoragePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanupStoragePath(dir))
+	s, err := NewStorage(dir, "hostname", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tarball bytes.Buffer
+	gw := gzip.NewWriter(&tarball)
+	if _, err := gw.Write([]byte("tarball")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	artifact := sourcev1.Artifact{Path: "gitrepository/default/podinfo/1234.tar.gz"}
+	if err := s.MkdirAll(artifact); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AtomicWriteFile(&artifact, bytes.NewReader(tarball.Bytes()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	index := sourcev1.Artifact{Path: "helmrepository/default/podinfo/index.yaml"}
+	if err := os.MkdirAll(filepath.Dir(s.LocalPath(index)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AtomicWriteFile(&index, strings.NewReader("apiVersion: v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	digest := func(b []byte) string {
+		sum := sha256.Sum256(b)
+		return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	tests := []struct {
+		name                string
+		path                string
+		accept              string
+		acceptEncoding      string
+		wantChecksum        string
+		wantDigest          string
+		wantContentType     string
+		wantContentEncoding string
+		wantBody            string
+	}{
+		{
+			name:         "tarball",
+			path:         artifact.Path,
+			wantChecksum: artifact.Checksum,
+			wantDigest:   digest(tarball.Bytes()),
+			wantBody:     tarball.String(),
+		},
+		{
+			name:                "tarball with gzip encoding",
+			path:                artifact.Path,
+			accept:              "application/x-tar, */*;q=0.1",
+			acceptEncoding:      "gzip",
+			wantChecksum:        artifact.Checksum,
+			wantDigest:          digest(tarball.Bytes()),
+			wantContentType:     tarMediaType,
+			wantContentEncoding: "gzip",
+			wantBody:            tarball.String(),
+		},
+		{
+			name:            "decompressed tarball",
+			path:            artifact.Path,
+			accept:          "application/x-tar",
+			acceptEncoding:  "gzip;q=0, identity",
+			wantChecksum:    artifact.Checksum,
+			wantContentType: tarMediaType,
+			wantBody:        "tarball",
+		},
+		{
+			name:         "other artifact",
+			path:         index.Path,
+			accept:       "application/x-tar",
+			wantChecksum: index.Checksum,
+			wantDigest:   digest([]byte("apiVersion: v1")),
+			wantBody:     "apiVersion: v1",
+		},
+		{
+			name: "directory",
+			path: "gitrepository/default/podinfo/",
+		},
+	}
+	h := s.ArtifactHandler(http.FileServer(http.Dir(dir)))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.path, nil)
+			req.Header.Set("Accept", tt.accept)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			if got := rec.Header().Get(ChecksumHeader); got != tt.wantChecksum {
+				t.Errorf("%s = %q, want %q", ChecksumHeader, got, tt.wantChecksum)
+			}
+			if got := rec.Header().Get(DigestHeader); got != tt.wantDigest {
+				t.Errorf("%s = %q, want %q", DigestHeader, got, tt.wantDigest)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != tt.wantContentEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.wantContentEncoding)
+			}
+			if got := rec.Header().Get("Content-Type"); tt.wantContentType != "" && got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+			if tt.wantBody == "" {
+				return
+			}
+			body, err := io.ReadAll(rec.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAcceptsValue(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{header: "gzip", want: true},
+		{header: "deflate, GZIP;q=0.5", want: true},
+		{header: "gzip;q=0", want: false},
+		{header: "gzip;q=0.000", want: false},
+		{header: "deflate", want: false},
+		{header: "", want: false},
+	}
+	for _, tt := range tests {
+		if got := acceptsValue(tt.header, "gzip"); got != tt.want {
+			t.Errorf("acceptsValue(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
@@ -2,6 +2,10 @@ package controllers
 
 import (
 	"testing"
+	"time"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
 )
@@ -108,3 +112,30 @@ func TestHasUpdated(t *testing.T) {
 		})
 	}
 }
+
+func TestSetArtifactOutdated(t *testing.T) {
+	staleAfter := &metav1.Duration{Duration: time.Hour}
+	fresh := &sourcev1.Artifact{Revision: "main/1234", LastUpdateTime: metav1.NewTime(time.Now().Add(-time.Minute))}
+	stale := &sourcev1.Artifact{Revision: "main/1234", LastUpdateTime: metav1.NewTime(time.Now().Add(-2 * time.Hour))}
+
+	var repository sourcev1.GitRepository
+	if msg := setArtifactOutdated(&repository, fresh, staleAfter); msg != "" {
+		t.Errorf("setArtifactOutdated() = %q for fresh artifact", msg)
+	}
+	if msg := setArtifactOutdated(&repository, stale, nil); msg != "" {
+		t.Errorf("setArtifactOutdated() = %q without stale after duration", msg)
+	}
+	if msg := setArtifactOutdated(&repository, stale, staleAfter); msg == "" {
+		t.Error("setArtifactOutdated() returned no message for stale artifact")
+	}
+	if !apimeta.IsStatusConditionTrue(repository.Status.Conditions, sourcev1.ArtifactOutdatedCondition) {
+		t.Error("setArtifactOutdated() did not set the condition")
+	}
+	if msg := setArtifactOutdated(&repository, stale, staleAfter); msg != "" {
+		t.Errorf("setArtifactOutdated() = %q for already outdated artifact", msg)
+	}
+	setArtifactOutdated(&repository, fresh, staleAfter)
+	if apimeta.FindStatusCondition(repository.Status.Conditions, sourcev1.ArtifactOutdatedCondition) != nil {
+		t.Error("setArtifactOutdated() did not remove the condition")
+	}
+}
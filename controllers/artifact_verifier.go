@@ -0,0 +1,155 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	kuberecorder "k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	"github.com/fluxcd/pkg/runtime/events"
+
+	sourcemetrics "github.com/fluxcd/source-controller/internal/metrics"
+)
+
+// ArtifactVerifier periodically verifies the integrity of the artifacts in
+// storage by re-hashing them and comparing them to the checksum recorded in
+// the status of their source. The corrupted artifacts are removed, and the
+// reconciliation of their source is requested for them to be produced again.
+type ArtifactVerifier struct {
+	client.Client
+	Storage            *Storage
+	EventRecorder      kuberecorder.EventRecorder
+	OperationsRecorder *sourcemetrics.Recorder
+	Log                logr.Logger
+
+	// Interval is the interval at which the artifacts are verified.
+	Interval time.Duration
+}
+
+// Start verifies the artifacts at every interval until the context is done.
+// It implements the manager.Runnable interface.
+func (v *ArtifactVerifier) Start(ctx context.Context) error {
+	ticker := time.NewTicker(v.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			v.verify(ctx)
+		}
+	}
+}
+
+// NeedLeaderElection implements the manager.LeaderElectionRunnable interface,
+// as only the leader produces the artifacts.
+func (v *ArtifactVerifier) NeedLeaderElection() bool {
+	return true
+}
+
+// verify verifies the artifacts of the sources of all kinds, until the given
+// context is done.
+func (v *ArtifactVerifier) verify(ctx context.Context) {
+	for _, kind := range sourceSetKinds {
+		if ctx.Err() != nil {
+			return
+		}
+		list, items := newSourceList(kind)
+		if err := v.List(ctx, list); err != nil {
+			v.Log.Error(err, "unable to list sources", "kind", kind)
+			continue
+		}
+		for _, obj := range items() {
+			if ctx.Err() != nil {
+				return
+			}
+			if obj.GetArtifact() == nil {
+				continue
+			}
+			corrupted, err := v.verifySource(ctx, kind, obj)
+			v.OperationsRecorder.RecordVerification(kind, corrupted, err)
+			if err != nil {
+				v.Log.Error(err, "unable to verify artifact", "kind", kind,
+					"namespace", obj.GetNamespace(), "name", obj.GetName())
+			}
+		}
+	}
+}
+
+// verifySource verifies the artifact of the given source of the given kind,
+// and returns true if it was found to be corrupted. A corrupted artifact is
+// removed, and the reconciliation of the source is requested.
+func (v *ArtifactVerifier) verifySource(ctx context.Context, kind string, obj summarizedSource) (bool, error) {
+	artifact := *obj.GetArtifact()
+	if !v.Storage.ArtifactExist(artifact) {
+		// a missing artifact is produced again on the next reconciliation
+		return false, nil
+	}
+
+	unlock, err := v.Storage.Lock(artifact)
+	if err != nil {
+		return false, fmt.Errorf("unable to acquire lock: %w", err)
+	}
+	defer unlock()
+
+	err = v.Storage.VerifyArtifact(artifact)
+	if err == nil || !errors.Is(err, ErrArtifactCorrupted) {
+		return false, err
+	}
+
+	// the artifact may have been replaced since the source was listed
+	if err := v.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	if current := obj.GetArtifact(); current == nil || current.Path != artifact.Path ||
+		current.Checksum != artifact.Checksum {
+		return false, nil
+	}
+
+	msg := fmt.Sprintf("Removing corrupted artifact '%s': %s", artifact.Path, err.Error())
+	v.Log.Info(msg, "kind", kind, "namespace", obj.GetNamespace(), "name", obj.GetName())
+	if v.EventRecorder != nil {
+		v.EventRecorder.Eventf(obj, "Warning", events.EventSeverityError, msg)
+	}
+	if err := v.Storage.RemoveCorrupted(artifact); err != nil {
+		return true, fmt.Errorf("unable to remove corrupted artifact: %w", err)
+	}
+	return true, v.requestReconciliation(ctx, obj)
+}
+
+// requestReconciliation sets the reconcile request annotation of the given
+// source, for its artifact to be reproduced.
+func (v *ArtifactVerifier) requestReconciliation(ctx context.Context, obj summarizedSource) error {
+	patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string, 1)
+	}
+	annotations[meta.ReconcileRequestAnnotation] = time.Now().Format(time.RFC3339Nano)
+	obj.SetAnnotations(annotations)
+	if err := v.Patch(ctx, obj, patch); err != nil {
+		return fmt.Errorf("unable to request reconciliation: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/fluxcd/pkg/apis/meta"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+func TestArtifactVerifier_verify(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := sourcev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := createStoragePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanupStoragePath(dir))
+	storage, err := NewStorage(dir, "hostname", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(kind, name string) *sourcev1.Artifact {
+		t.Helper()
+		a := storage.NewArtifactFor(kind, &metav1.ObjectMeta{Name: name, Namespace: "default"}, "1234", "1234.tar.gz")
+		if err := storage.MkdirAll(a); err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.AtomicWriteFile(&a, strings.NewReader(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return &a
+	}
+
+	healthy := &sourcev1.GitRepository{ObjectMeta: metav1.ObjectMeta{Name: "healthy", Namespace: "default"}}
+	healthy.Status.Artifact = write(sourcev1.GitRepositoryKind, healthy.Name)
+	corrupted := &sourcev1.Bucket{ObjectMeta: metav1.ObjectMeta{Name: "corrupted", Namespace: "default"}}
+	corrupted.Status.Artifact = write(sourcev1.BucketKind, corrupted.Name)
+	if err := os.WriteFile(storage.LocalPath(*corrupted.Status.Artifact), []byte("bit rot"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := &sourcev1.HelmRepository{ObjectMeta: metav1.ObjectMeta{Name: "missing", Namespace: "default"}}
+	missing.Status.Artifact = &sourcev1.Artifact{Path: path.Join("helmrepository", "default", "missing", "index.yaml")}
+	pending := &sourcev1.HelmChart{ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "default"}}
+
+	v := &ArtifactVerifier{
+		Client:  fake.NewClientBuilder().WithScheme(scheme).WithObjects(healthy, corrupted, missing, pending).Build(),
+		Storage: storage,
+		Log:     logr.Discard(),
+	}
+
+	// nothing is verified once the context is done
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	v.verify(ctx)
+	if !storage.ArtifactExist(*corrupted.Status.Artifact) {
+		t.Error("corrupted artifact was removed with a done context")
+	}
+
+	v.verify(context.TODO())
+
+	if !storage.ArtifactExist(*healthy.Status.Artifact) {
+		t.Error("healthy artifact was removed")
+	}
+	if storage.ArtifactExist(*corrupted.Status.Artifact) {
+		t.Error("corrupted artifact was not removed")
+	}
+
+	requested := func(obj client.Object) bool {
+		t.Helper()
+		if err := v.Get(context.TODO(), client.ObjectKeyFromObject(obj), obj); err != nil {
+			t.Fatal(err)
+		}
+		_, ok := obj.GetAnnotations()[meta.ReconcileRequestAnnotation]
+		return ok
+	}
+	if !requested(&sourcev1.Bucket{ObjectMeta: corrupted.ObjectMeta}) {
+		t.Error("reconciliation of the source of the corrupted artifact was not requested")
+	}
+	for _, obj := range []client.Object{
+		&sourcev1.GitRepository{ObjectMeta: healthy.ObjectMeta},
+		&sourcev1.HelmRepository{ObjectMeta: missing.ObjectMeta},
+		&sourcev1.HelmChart{ObjectMeta: pending.ObjectMeta},
+	} {
+		if requested(obj) {
+			t.Errorf("reconciliation of %s was requested", obj.GetName())
+		}
+	}
+}
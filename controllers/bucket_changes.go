@@ -0,0 +1,222 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	sourcebucket "github.com/fluxcd/source-controller/pkg/bucket"
+)
+
+// objectChanges holds the keys of the objects added, removed and modified
+// between two artifacts of a Bucket, sorted.
+type objectChanges struct {
+	added    []string
+	removed  []string
+	modified []string
+}
+
+// empty returns true if no object changed.
+func (c objectChanges) empty() bool {
+	return len(c.added)+len(c.removed)+len(c.modified) == 0
+}
+
+// message returns the summary of the changes between the given revisions,
+// listing at most maxKeys object keys.
+func (c objectChanges) message(from, to string, maxKeys int) string {
+	return c.summary(fmt.Sprintf("Objects changed from revision '%s' to '%s'", from, to), maxKeys)
+}
+
+// summary returns the given header followed by the number of changes and
+// at most maxKeys object keys.
+func (c objectChanges) summary(header string, maxKeys int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %d added, %d removed, %d modified", header, len(c.added), len(c.removed), len(c.modified))
+	keys := c.keys(maxKeys)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "\n%s", key)
+	}
+	if more := len(c.added) + len(c.removed) + len(c.modified) - len(keys); more > 0 {
+		fmt.Fprintf(&b, "\n(%d more)", more)
+	}
+	return b.String()
+}
+
+// keys returns at most max object keys, prefixed by '+' when added, '-'
+// when removed and '~' when modified.
+func (c objectChanges) keys(max int) []string {
+	var keys []string
+	for _, change := range []struct {
+		prefix string
+		keys   []string
+	}{{"+", c.added}, {"-", c.removed}, {"~", c.modified}} {
+		for _, key := range change.keys {
+			if len(keys) == max {
+				return keys
+			}
+			keys = append(keys, change.prefix+" "+key)
+		}
+	}
+	return keys
+}
+
+// preview returns the v1beta1.SourcePreviewChanges of the changes from the
+// artifact of the given revision.
+func (c objectChanges) preview(revision string) *sourcev1.SourcePreviewChanges {
+	return &sourcev1.SourcePreviewChanges{
+		Revision: revision,
+		Added:    len(c.added),
+		Removed:  len(c.removed),
+		Modified: len(c.modified),
+		Keys:     c.keys(maxPreviewChangedKeys),
+	}
+}
+
+// diffArtifacts returns the changes of the objects from the artifact archive
+// at the from path to the one at the to path, comparing the checksums of
+// their files. The metadata file is not an object and is skipped.
+func diffArtifacts(from, to string) (objectChanges, error) {
+	before, err := archiveChecksums(from)
+	if err != nil {
+		return objectChanges{}, err
+	}
+	after, err := archiveChecksums(to)
+	if err != nil {
+		return objectChanges{}, err
+	}
+	return diffChecksums(before, after), nil
+}
+
+// diffDir returns the changes of the objects from the artifact archive at
+// the given path to the files of the given directory which the given filter
+// does not exclude, the ones Storage.Archive would write in the next
+// artifact.
+func diffDir(from, dir string, filter ArchiveFileFilter) (objectChanges, error) {
+	before, err := archiveChecksums(from)
+	if err != nil {
+		return objectChanges{}, err
+	}
+	after, err := dirChecksums(dir, filter)
+	if err != nil {
+		return objectChanges{}, err
+	}
+	return diffChecksums(before, after), nil
+}
+
+// diffChecksums returns the changes from the given checksums to the given
+// other checksums, by file name.
+func diffChecksums(before, after map[string]string) objectChanges {
+	var changes objectChanges
+	for key, sum := range after {
+		previous, ok := before[key]
+		switch {
+		case !ok:
+			changes.added = append(changes.added, key)
+		case previous != sum:
+			changes.modified = append(changes.modified, key)
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			changes.removed = append(changes.removed, key)
+		}
+	}
+	sort.Strings(changes.added)
+	sort.Strings(changes.removed)
+	sort.Strings(changes.modified)
+	return changes
+}
+
+// archiveChecksums returns the SHA1 checksums of the regular files of the
+// tarball at the given path, by file name.
+func archiveChecksums(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read artifact '%s': %w", path, err)
+	}
+	defer gr.Close()
+
+	sums := make(map[string]string)
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return sums, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read artifact '%s': %w", path, err)
+		}
+		if header.Typeflag != tar.TypeReg || header.Name == sourcebucket.MetadataFile {
+			continue
+		}
+		h := sha1.New()
+		if _, err := io.Copy(h, tr); err != nil {
+			return nil, fmt.Errorf("unable to read artifact '%s': %w", path, err)
+		}
+		sums[header.Name] = fmt.Sprintf("%x", h.Sum(nil))
+	}
+}
+
+// dirChecksums returns the SHA1 checksums of the regular files of the given
+// directory which the given filter does not exclude, by slash separated path
+// relative to the directory, as Storage.Archive names them. The metadata
+// file is skipped.
+func dirChecksums(dir string, filter ArchiveFileFilter) (map[string]string, error) {
+	sums := make(map[string]string)
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() || (filter != nil && filter(p, fi)) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if name == sourcebucket.MetadataFile {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h := sha1.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		sums[name] = fmt.Sprintf("%x", h.Sum(nil))
+		return nil
+	})
+	return sums, err
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	sourcebucket "github.com/fluxcd/source-controller/pkg/bucket"
+)
+
+func writeTestArchive(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	if err := tw.WriteHeader(&tar.Header{Name: "deploy", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_diffArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	from, to := filepath.Join(dir, "from.tar.gz"), filepath.Join(dir, "to.tar.gz")
+	writeTestArchive(t, from, map[string]string{
+		"deploy/deployment.yaml":  "kind: Deployment",
+		"deploy/service.yaml":     "kind: Service",
+		"deploy/ingress.yaml":     "kind: Ingress",
+		sourcebucket.MetadataFile: "{}",
+	})
+	writeTestArchive(t, to, map[string]string{
+		"deploy/deployment.yaml":  "kind: Deployment\nspec: {}",
+		"deploy/service.yaml":     "kind: Service",
+		"deploy/configmap.yaml":   "kind: ConfigMap",
+		"deploy/secret.yaml":      "kind: Secret",
+		sourcebucket.MetadataFile: `{"objects": []}`,
+	})
+
+	changes, err := diffArtifacts(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := objectChanges{
+		added:    []string{"deploy/configmap.yaml", "deploy/secret.yaml"},
+		removed:  []string{"deploy/ingress.yaml"},
+		modified: []string{"deploy/deployment.yaml"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("diffArtifacts() = %+v, want %+v", changes, want)
+	}
+
+	if changes, err := diffArtifacts(to, to); err != nil || !changes.empty() {
+		t.Errorf("diffArtifacts() = %+v, %v for the same artifact", changes, err)
+	}
+	if _, err := diffArtifacts(filepath.Join(dir, "missing.tar.gz"), to); err == nil {
+		t.Error("diffArtifacts() returned no error for a missing artifact")
+	}
+}
+
+func Test_objectChanges_message(t *testing.T) {
+	changes := objectChanges{
+		added:    []string{"a.yaml", "b.yaml"},
+		removed:  []string{"c.yaml"},
+		modified: []string{"d.yaml"},
+	}
+
+	tests := []struct {
+		name    string
+		maxKeys int
+		want    string
+	}{
+		{
+			name:    "all keys",
+			maxKeys: 10,
+			want:    "Objects changed from revision 'abc' to 'def': 2 added, 1 removed, 1 modified\n+ a.yaml\n+ b.yaml\n- c.yaml\n~ d.yaml",
+		},
+		{
+			name:    "capped",
+			maxKeys: 3,
+			want:    "Objects changed from revision 'abc' to 'def': 2 added, 1 removed, 1 modified\n+ a.yaml\n+ b.yaml\n- c.yaml\n(1 more)",
+		},
+		{
+			name:    "no keys",
+			maxKeys: 0,
+			want:    "Objects changed from revision 'abc' to 'def': 2 added, 1 removed, 1 modified\n(4 more)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := changes.message("abc", "def", tt.maxKeys); got != tt.want {
+				t.Errorf("message() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_diffDir(t *testing.T) {
+	dir := t.TempDir()
+	from := filepath.Join(dir, "from.tar.gz")
+	writeTestArchive(t, from, map[string]string{
+		"deploy/deployment.yaml": "kind: Deployment",
+		"deploy/service.yaml":    "kind: Service",
+		"deploy/ingress.yaml":    "kind: Ingress",
+	})
+	fetched := filepath.Join(dir, "fetched")
+	for name, content := range map[string]string{
+		"deploy/deployment.yaml":  "kind: Deployment\nspec: {}",
+		"deploy/service.yaml":     "kind: Service",
+		"deploy/configmap.yaml":   "kind: ConfigMap",
+		"deploy/secret.enc.yaml":  "kind: Secret",
+		sourcebucket.MetadataFile: "{}",
+	} {
+		p := filepath.Join(fetched, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filter := func(p string, fi os.FileInfo) bool {
+		return filepath.Base(p) == "secret.enc.yaml"
+	}
+
+	changes, err := diffDir(from, fetched, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := objectChanges{
+		added:    []string{"deploy/configmap.yaml"},
+		removed:  []string{"deploy/ingress.yaml"},
+		modified: []string{"deploy/deployment.yaml"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("diffDir() = %+v, want %+v", changes, want)
+	}
+
+	preview := changes.preview("abc")
+	if preview.Revision != "abc" || preview.Added != 1 || preview.Removed != 1 || preview.Modified != 1 {
+		t.Errorf("preview() = %+v", preview)
+	}
+	wantKeys := []string{"+ deploy/configmap.yaml", "- deploy/ingress.yaml", "~ deploy/deployment.yaml"}
+	if !reflect.DeepEqual(preview.Keys, wantKeys) {
+		t.Errorf("preview() keys = %v, want %v", preview.Keys, wantKeys)
+	}
+}
@@ -19,16 +19,16 @@ package controllers
 import (
 	"context"
 	"crypto/sha1"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/go-logr/logr"
-	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
-	"github.com/minio/minio-go/v7/pkg/s3utils"
+	"golang.org/x/sync/errgroup"
 	corev1 "k8s.io/api/core/v1"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -48,7 +48,17 @@ import (
 	"github.com/fluxcd/pkg/runtime/predicates"
 
 	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
-	"github.com/fluxcd/source-controller/pkg/sourceignore"
+	"github.com/fluxcd/source-controller/internal/eventlimit"
+	"github.com/fluxcd/source-controller/internal/index"
+	sourcemetrics "github.com/fluxcd/source-controller/internal/metrics"
+	"github.com/fluxcd/source-controller/internal/policy"
+	"github.com/fluxcd/source-controller/internal/rewrite"
+	"github.com/fluxcd/source-controller/internal/tracing"
+	sourcebucket "github.com/fluxcd/source-controller/pkg/bucket"
+	"github.com/fluxcd/source-controller/pkg/bucket/minio"
+	"github.com/fluxcd/source-controller/pkg/bucket/swift"
+	"github.com/fluxcd/source-controller/pkg/retry"
+	"github.com/fluxcd/source-controller/pkg/throttle"
 )
 
 // +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=buckets,verbs=get;list;watch;create;update;patch;delete
@@ -59,15 +69,49 @@ import (
 // BucketReconciler reconciles a Bucket object
 type BucketReconciler struct {
 	client.Client
+	APIReader             client.Reader
+	requeueDependency     time.Duration
+	intervalJitter        int
+	checksumWorkers       int
 	Scheme                *runtime.Scheme
 	Storage               *Storage
 	EventRecorder         kuberecorder.EventRecorder
 	ExternalEventRecorder *events.Recorder
 	MetricsRecorder       *metrics.Recorder
+	OperationsRecorder    *sourcemetrics.Recorder
+	ArtifactIndex         *index.Index
+	EndpointPolicy        *policy.Policy
+	URLRewriter           *rewrite.Rewriter
+	EventLimiter          *eventlimit.Limiter
+
+	// HTTPHeaders are the headers sent with the requests to the bucket
+	// endpoints, unless overridden in the spec of the Buckets.
+	HTTPHeaders map[string]string
+	// ChangesMaxKeys is the maximum number of object keys listed in the
+	// events summarizing the objects changed between two artifacts.
+	ChangesMaxKeys int
+	// DownloadLimiter limits the bandwidth shared by the downloads of all
+	// the sources of the controller.
+	DownloadLimiter *throttle.Limiter
+	// SourceBandwidthLimit is the bandwidth in bytes per second of the
+	// downloads of each Bucket. Disabled when 0.
+	SourceBandwidthLimit int64
+	// DownloadRetry retries the object downloads which fail with a transient
+	// error. Disabled when nil.
+	DownloadRetry *retry.Policy
+
+	swiftClients clientCache
 }
 
 type BucketReconcilerOptions struct {
-	MaxConcurrentReconciles int
+	MaxConcurrentReconciles   int
+	DependencyRequeueInterval time.Duration
+	// IntervalJitterPercentage is the maximum percentage of the interval
+	// of a source its reconciliations are randomly advanced or delayed by.
+	IntervalJitterPercentage int
+	// ChecksumWorkers is the number of files hashed concurrently to compute
+	// the content revision of a Bucket.
+	ChecksumWorkers int
 }
 
 func (r *BucketReconciler) SetupWithManager(mgr ctrl.Manager) error {
@@ -75,6 +119,14 @@ func (r *BucketReconciler) SetupWithManager(mgr ctrl.Manager) error {
 }
 
 func (r *BucketReconciler) SetupWithManagerAndOptions(mgr ctrl.Manager, opts BucketReconcilerOptions) error {
+	if r.APIReader == nil {
+		r.APIReader = mgr.GetAPIReader()
+	}
+
+	r.requeueDependency = opts.DependencyRequeueInterval
+	r.intervalJitter = opts.IntervalJitterPercentage
+	r.checksumWorkers = opts.ChecksumWorkers
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&sourcev1.Bucket{}).
 		WithEventFilter(predicate.Or(predicate.GenerationChangedPredicate{}, predicates.ReconcileRequestedPredicate{})).
@@ -111,9 +163,41 @@ func (r *BucketReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	// Return early if the object is suspended.
 	if bucket.Spec.Suspend {
 		log.Info("Reconciliation is suspended for this object")
+		if bucket.Spec.SuspendArtifact == sourcev1.SuspendArtifactWithdraw {
+			return r.withdrawArtifact(ctx, req, bucket)
+		}
+		// sign the URLs of the kept artifact again before they expire
+		if requeueAfter := r.Storage.signedURLRequeueAfter(0); requeueAfter > 0 && bucket.GetArtifact() != nil {
+			if err := r.updateStatus(ctx, req, bucket.Status); err != nil {
+				log.Error(err, "unable to update status")
+				return ctrl.Result{Requeue: true}, err
+			}
+			return ctrl.Result{RequeueAfter: requeueAfter}, nil
+		}
 		return ctrl.Result{}, nil
 	}
 
+	// check dependencies
+	if len(bucket.Spec.DependsOn) > 0 {
+		if err := checkSourceDependencies(ctx, r, bucket.Namespace, bucket.Spec.DependsOn); err != nil {
+			bucket = sourcev1.BucketNotReady(bucket, meta.DependencyNotReadyReason, err.Error())
+			bucket.Status.LastFailure = sourceFailure(&bucket, err)
+			bucket.Status.NextReconcileAt = nextReconcileAt(r.requeueDependency)
+			if err := r.updateStatus(ctx, req, bucket.Status); err != nil {
+				log.Error(err, "unable to update status for dependency not ready")
+				return ctrl.Result{Requeue: true}, err
+			}
+			// we can't rely on exponential backoff because it will prolong the execution too much,
+			// instead we requeue on a fix interval.
+			msg := fmt.Sprintf("Dependencies do not meet ready condition, retrying in %s", r.requeueDependency.String())
+			log.Info(msg)
+			r.event(ctx, bucket, events.EventSeverityInfo, msg)
+			r.recordReadiness(ctx, bucket)
+			return ctrl.Result{RequeueAfter: r.requeueDependency}, nil
+		}
+		log.Info("All dependencies are ready, proceeding with reconciliation")
+	}
+
 	// record reconciliation duration
 	if r.MetricsRecorder != nil {
 		objRef, err := reference.GetReference(r.Scheme, &bucket)
@@ -146,7 +230,46 @@ func (r *BucketReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	}
 
 	// reconcile bucket by downloading its content
+	ctx, span := tracing.Start(ctx, "reconcile", tracing.ObjectAttributes(sourcev1.BucketKind, bucket.Namespace, bucket.Name)...)
 	reconciledBucket, reconcileErr := r.reconcile(ctx, *bucket.DeepCopy())
+	tracing.End(span, reconcileErr)
+	// record the failure of the reconciliation in a structured form
+	reconciledBucket.Status.LastFailure = sourceFailure(&reconciledBucket, reconcileErr)
+
+	// check if the artifact has been updated within the stale after duration
+	staleMsg := setArtifactOutdated(&reconciledBucket, reconciledBucket.GetArtifact(), reconciledBucket.Spec.StaleAfter)
+
+	// push the artifact to the OCI registry, failures do not affect the readiness
+	if reconcileErr == nil && !sourcev1.InDryRun(&reconciledBucket) {
+		ref, err := publishArtifact(ctx, r.Client, r.Storage, reconciledBucket.Namespace, reconciledBucket.Spec.Publish,
+			reconciledBucket.GetArtifact(), reconciledBucket.Status.PublishedReference)
+		if err != nil {
+			log.Error(err, "unable to publish artifact")
+			r.event(ctx, reconciledBucket, events.EventSeverityError, err.Error())
+		} else {
+			reconciledBucket.Status.PublishedReference = ref
+		}
+	}
+
+	// embed the small artifacts in the Kubernetes API, failures do not affect the readiness
+	if reconcileErr == nil && !sourcev1.InDryRun(&reconciledBucket) {
+		inlined, err := inlineArtifact(ctx, r.Client, r.Scheme, r.Storage, &reconciledBucket, reconciledBucket.Spec.Inline,
+			reconciledBucket.GetArtifact(), reconciledBucket.Status.InlineArtifact)
+		if err != nil {
+			log.Error(err, "unable to embed artifact")
+			r.event(ctx, reconciledBucket, events.EventSeverityError, err.Error())
+		} else {
+			reconciledBucket.Status.InlineArtifact = inlined
+		}
+	}
+
+	// record when the next reconciliation is scheduled, the failures being
+	// retried with an exponential backoff
+	var requeueAfter time.Duration
+	if reconcileErr == nil && !sourcev1.InDryRun(&reconciledBucket) {
+		requeueAfter = r.Storage.signedURLRequeueAfter(windowRequeueAfter(reconciledBucket.Spec.Window, reconciledBucket.Status.PendingRevision, jitterInterval(bucket.GetInterval().Duration, r.intervalJitter)))
+	}
+	reconciledBucket.Status.NextReconcileAt = nextReconcileAt(requeueAfter)
 
 	// update status with the reconciliation result
 	if err := r.updateStatus(ctx, req, reconciledBucket.Status); err != nil {
@@ -154,114 +277,160 @@ func (r *BucketReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		return ctrl.Result{Requeue: true}, err
 	}
 
+	// emit a warning event once the artifact is outdated
+	if staleMsg != "" {
+		r.event(ctx, reconciledBucket, events.EventSeverityError, staleMsg)
+	}
+
 	// if reconciliation failed, record the failure and requeue immediately
 	if reconcileErr != nil {
 		r.event(ctx, reconciledBucket, events.EventSeverityError, reconcileErr.Error())
 		r.recordReadiness(ctx, reconciledBucket)
+		// an invalid spec is not retried until it is updated, only requeued
+		// to sign the URLs of the kept artifact again
+		if c := apimeta.FindStatusCondition(reconciledBucket.Status.Conditions, meta.ReadyCondition); c != nil && c.Reason == sourcev1.BucketSpecInvalidReason {
+			return ctrl.Result{RequeueAfter: r.Storage.signedURLRequeueAfter(0)}, nil
+		}
 		return ctrl.Result{Requeue: true}, reconcileErr
 	}
 
+	// the preview is not updated until the next change or reconcile request
+	if sourcev1.InDryRun(&reconciledBucket) {
+		r.recordReadiness(ctx, reconciledBucket)
+		log.Info(fmt.Sprintf("Preview finished in %s, next run on change or reconcile request",
+			time.Now().Sub(start).String(),
+		))
+		return ctrl.Result{RequeueAfter: r.Storage.signedURLRequeueAfter(0)}, nil
+	}
+
 	// emit revision change event
 	if bucket.Status.Artifact == nil || reconciledBucket.Status.Artifact.Revision != bucket.Status.Artifact.Revision {
 		r.event(ctx, reconciledBucket, events.EventSeverityInfo, sourcev1.BucketReadyMessage(reconciledBucket))
 	}
+	if pending := reconciledBucket.Status.PendingRevision; pending != "" && pending != bucket.Status.PendingRevision {
+		r.event(ctx, reconciledBucket, events.EventSeverityInfo, sourcev1.BucketReadyMessage(reconciledBucket))
+	}
 	r.recordReadiness(ctx, reconciledBucket)
+	indexArtifact(r.ArtifactIndex, r.Storage, sourcev1.BucketKind, reconciledBucket.Namespace, reconciledBucket.Name, reconciledBucket.GetArtifact())
+	recordArtifactRevision(r.OperationsRecorder, sourcev1.BucketKind, reconciledBucket.Namespace, reconciledBucket.Name, bucket.GetArtifact(), reconciledBucket.GetArtifact())
 
 	log.Info(fmt.Sprintf("Reconciliation finished in %s, next run in %s",
 		time.Now().Sub(start).String(),
-		bucket.GetInterval().Duration.String(),
+		requeueAfter.String(),
 	))
 
-	return ctrl.Result{RequeueAfter: bucket.GetInterval().Duration}, nil
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
 }
 
 func (r *BucketReconciler) reconcile(ctx context.Context, bucket sourcev1.Bucket) (sourcev1.Bucket, error) {
-	s3Client, err := r.auth(ctx, bucket)
-	if err != nil {
-		err = fmt.Errorf("auth error: %w", err)
-		return sourcev1.BucketNotReady(bucket, sourcev1.AuthenticationFailedReason, err.Error()), err
+	if err := validateBucketSpec(bucket); err != nil {
+		return sourcev1.BucketNotReady(bucket, sourcev1.BucketSpecInvalidReason, err.Error()), err
+	}
+
+	// check the endpoint against the policy
+	if err := r.EndpointPolicy.Check(bucket.Namespace, bucket.Spec.Endpoint+"/"+bucket.Spec.BucketName); err != nil {
+		return sourcev1.BucketNotReady(bucket, sourcev1.PolicyViolationReason, err.Error()), err
 	}
 
-	// create tmp dir
-	tempDir, err := os.MkdirTemp("", bucket.Name)
+	// create or reuse the tmp dir of a previous, failed fetch
+	tempDir, stateFile, err := partialFetchDir(bucket)
 	if err != nil {
 		err = fmt.Errorf("tmp dir error: %w", err)
 		return sourcev1.BucketNotReady(bucket, sourcev1.StorageOperationFailedReason, err.Error()), err
 	}
-	defer os.RemoveAll(tempDir)
 
-	ctxTimeout, cancel := context.WithTimeout(ctx, bucket.Spec.Timeout.Duration)
-	defer cancel()
-
-	exists, err := s3Client.BucketExists(ctxTimeout, bucket.Spec.BucketName)
+	secret, err := r.getBucketSecret(ctx, bucket)
 	if err != nil {
-		return sourcev1.BucketNotReady(bucket, sourcev1.BucketOperationFailedReason, err.Error()), err
+		err = fmt.Errorf("auth error: %w", err)
+		return sourcev1.BucketNotReady(bucket, sourcev1.AuthenticationFailedReason, err.Error()), err
 	}
-	if !exists {
-		err = fmt.Errorf("bucket '%s' not found", bucket.Spec.BucketName)
-		return sourcev1.BucketNotReady(bucket, sourcev1.BucketOperationFailedReason, err.Error()), err
+	if err := validateBucketSecret(bucket, secret); err != nil {
+		err = fmt.Errorf("auth error: %w", err)
+		return sourcev1.BucketNotReady(bucket, sourcev1.AuthenticationFailedReason, err.Error()), err
 	}
 
-	// Look for file with ignore rules first
-	// NB: S3 has flat filepath keys making it impossible to look
-	// for files in "subdirectories" without building up a tree first.
-	path := filepath.Join(tempDir, sourceignore.IgnoreFile)
-	if err := s3Client.FGetObject(ctxTimeout, bucket.Spec.BucketName, sourceignore.IgnoreFile, path, minio.GetObjectOptions{}); err != nil {
-		if resp, ok := err.(minio.ErrorResponse); ok && resp.Code != "NoSuchKey" {
-			return sourcev1.BucketNotReady(bucket, sourcev1.BucketOperationFailedReason, err.Error()), err
+	// download bucket content, retrying once with fresh credentials if the
+	// secret has been rotated while fetching, only the objects missing from
+	// the state file being fetched then
+	// in the listing revision mode, the download is skipped if the revision
+	// computed from the listing is the one of the current artifact
+	var listingRevision string
+	var beforeDownload func(string) bool
+	if bucket.Spec.RevisionMode == sourcev1.ListingBucketRevisionMode {
+		beforeDownload = func(revision string) bool {
+			listingRevision = revision
+			return !listingRevisionUnchanged(bucket, revision)
 		}
 	}
-	ps, err := sourceignore.ReadIgnoreFile(path, nil)
+	sourceBucket, err := r.fetch(ctx, bucket, secret, tempDir, stateFile, beforeDownload)
 	if err != nil {
-		return sourcev1.BucketNotReady(bucket, sourcev1.BucketOperationFailedReason, err.Error()), err
-	}
-	// In-spec patterns take precedence
-	if bucket.Spec.Ignore != nil {
-		ps = append(ps, sourceignore.ReadPatterns(strings.NewReader(*bucket.Spec.Ignore), nil)...)
-	}
-	matcher := sourceignore.NewMatcher(ps)
-
-	// download bucket content
-	for object := range s3Client.ListObjects(ctxTimeout, bucket.Spec.BucketName, minio.ListObjectsOptions{
-		Recursive: true,
-		UseV1:     s3utils.IsGoogleEndpoint(*s3Client.EndpointURL()),
-	}) {
-		if object.Err != nil {
-			err = fmt.Errorf("listing objects from bucket '%s' failed: %w", bucket.Spec.BucketName, object.Err)
-			return sourcev1.BucketNotReady(bucket, sourcev1.BucketOperationFailedReason, err.Error()), err
+		rotated := rotatedSecret(ctx, r.APIReader, secret)
+		if rotated == nil {
+			return sourceBucket, err
 		}
-
-		if strings.HasSuffix(object.Key, "/") || object.Key == sourceignore.IgnoreFile {
-			continue
+		if sourceBucket, err = r.fetch(ctx, bucket, rotated, tempDir, stateFile, beforeDownload); err != nil {
+			return sourceBucket, err
 		}
+	}
+	setFetchFailed(&bucket, nil, "")
+	// the fetch is complete, the next one starts from scratch
+	defer removePartialFetchDir(bucket)
 
-		if matcher.Match(strings.Split(object.Key, "/"), false) {
-			continue
+	revision := listingRevision
+	if revision == "" {
+		if revision, err = r.checksum(tempDir); err != nil {
+			return sourcev1.BucketNotReady(bucket, sourcev1.StorageOperationFailedReason, err.Error()), err
 		}
+	}
 
-		localPath := filepath.Join(tempDir, object.Key)
-		err := s3Client.FGetObject(ctxTimeout, bucket.Spec.BucketName, object.Key, localPath, minio.GetObjectOptions{})
+	// preview the artifact instead of writing it in dry-run, with the
+	// objects changed since the current artifact
+	if sourcev1.InDryRun(&bucket) {
+		filter := EncryptedFileFilter(nil, bucket.Spec.EncryptedFilesPolicy, &sourcev1.Artifact{})
+		preview, err := r.Storage.previewDir(tempDir, filter, revision)
 		if err != nil {
-			err = fmt.Errorf("downloading object from bucket '%s' failed: %w", bucket.Spec.BucketName, err)
-			return sourcev1.BucketNotReady(bucket, sourcev1.BucketOperationFailedReason, err.Error()), err
+			err = fmt.Errorf("preview error: %w", err)
+			return sourcev1.BucketNotReady(bucket, sourcev1.StorageOperationFailedReason, err.Error()), err
+		}
+		if current := bucket.GetArtifact(); current != nil {
+			changes, err := diffDir(r.Storage.LocalPath(*current), tempDir, filter)
+			if err != nil {
+				logr.FromContext(ctx).Error(err, "unable to compare the objects with the current artifact")
+			} else {
+				preview.Changes = changes.preview(current.Revision)
+				r.event(ctx, bucket, events.EventSeverityInfo, changes.summary(
+					fmt.Sprintf("Objects would change from revision '%s' to '%s'", current.Revision, revision), r.ChangesMaxKeys))
+			}
 		}
+		return sourcev1.BucketPreviewed(bucket, preview), nil
 	}
 
-	revision, err := r.checksum(tempDir)
-	if err != nil {
-		return sourcev1.BucketNotReady(bucket, sourcev1.StorageOperationFailedReason, err.Error()), err
+	// the content is not downloaded when the listing revision reverts to the
+	// one of the current artifact while a newer revision is pending
+	if reverted, ok := revertPendingRevision(bucket, listingRevision); ok {
+		return reverted, nil
 	}
 
 	// return early on unchanged revision
 	artifact := r.Storage.NewArtifactFor(bucket.Kind, bucket.GetObjectMeta(), revision, fmt.Sprintf("%s.tar.gz", revision))
-	if apimeta.IsStatusConditionTrue(bucket.Status.Conditions, meta.ReadyCondition) && bucket.GetArtifact().HasRevision(artifact.Revision) {
+	if apimeta.IsStatusConditionTrue(bucket.Status.Conditions, meta.ReadyCondition) && bucket.GetArtifact().HasRevision(artifact.Revision) &&
+		bucket.Status.PendingRevision == "" {
 		if artifact.URL != bucket.GetArtifact().URL {
 			r.Storage.SetArtifactURL(bucket.GetArtifact())
-			bucket.Status.URL = r.Storage.SetHostname(bucket.Status.URL)
+			bucket.Status.URL = r.Storage.SetLinkURL(*bucket.GetArtifact(), bucket.Status.URL)
 		}
 		return bucket, nil
 	}
 
+	// hold the new revision back until the window opens
+	opensAt, err := holdRevision(bucket.Spec.Window, bucket.GetArtifact(), artifact.Revision)
+	if err != nil {
+		return sourcev1.BucketNotReady(bucket, sourcev1.WindowInvalidReason, err.Error()), err
+	}
+	if !opensAt.IsZero() {
+		return sourcev1.BucketPending(bucket, artifact.Revision, pendingMessage(artifact.Revision, opensAt)), nil
+	}
+
 	// create artifact dir
 	err = r.Storage.MkdirAll(artifact)
 	if err != nil {
@@ -278,23 +447,194 @@ func (r *BucketReconciler) reconcile(ctx context.Context, bucket sourcev1.Bucket
 	defer unlock()
 
 	// archive artifact and check integrity
-	if err := r.Storage.Archive(&artifact, tempDir, nil); err != nil {
+	_, span := tracing.Start(ctx, "archive")
+	filter := EncryptedFileFilter(nil, bucket.Spec.EncryptedFilesPolicy, &artifact)
+	if bucket.Spec.IncludeChecksums {
+		err = r.Storage.writeChecksumManifest(tempDir, filter)
+	}
+	if err == nil {
+		err = r.Storage.Archive(&artifact, tempDir, filter)
+	}
+	tracing.End(span, err)
+	if err != nil {
 		err = fmt.Errorf("storage archive error: %w", err)
 		return sourcev1.BucketNotReady(bucket, sourcev1.StorageOperationFailedReason, err.Error()), err
 	}
+	if err := r.Storage.WriteSBOM(&artifact); err != nil {
+		err = fmt.Errorf("storage SBOM error: %w", err)
+		return sourcev1.BucketNotReady(bucket, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
 
 	// update latest symlink
-	url, err := r.Storage.Symlink(artifact, "latest.tar.gz")
+	url, err := r.Storage.LatestSymlink(artifact)
 	if err != nil {
 		err = fmt.Errorf("storage symlink error: %w", err)
 		return sourcev1.BucketNotReady(bucket, sourcev1.StorageOperationFailedReason, err.Error()), err
 	}
 
+	// summarize the objects changed since the previous artifact
+	if previous := bucket.GetArtifact(); previous != nil {
+		changes, err := diffArtifacts(r.Storage.LocalPath(*previous), r.Storage.LocalPath(artifact))
+		if err != nil {
+			logr.FromContext(ctx).Error(err, "unable to compare the objects with the previous artifact")
+		} else if !changes.empty() {
+			r.OperationsRecorder.RecordObjectChanges(bucket.Namespace, bucket.Name,
+				len(changes.added), len(changes.removed), len(changes.modified))
+			r.event(ctx, bucket, events.EventSeverityInfo, changes.message(previous.Revision, artifact.Revision, r.ChangesMaxKeys))
+		}
+	}
+
 	message := fmt.Sprintf("Fetched revision: %s", artifact.Revision)
 	return sourcev1.BucketReady(bucket, artifact, url, sourcev1.BucketOperationSucceedReason, message), nil
 }
 
+// listingRevisionUnchanged returns true if the given listing revision of the
+// content of the Bucket is the one of its current artifact, in which case the
+// download of the content is skipped.
+func listingRevisionUnchanged(bucket sourcev1.Bucket, revision string) bool {
+	return revision != "" && !sourcev1.InDryRun(&bucket) &&
+		apimeta.IsStatusConditionTrue(bucket.Status.Conditions, meta.ReadyCondition) &&
+		bucket.GetArtifact().HasRevision(revision)
+}
+
+// revertPendingRevision returns the Bucket ready with its current artifact and
+// without pending revision, and true, if the given listing revision reverted
+// to the one of the current artifact while a newer revision was held back by
+// the window. Nothing is to be archived then, as the content is not
+// downloaded.
+func revertPendingRevision(bucket sourcev1.Bucket, listingRevision string) (sourcev1.Bucket, bool) {
+	if bucket.Status.PendingRevision == "" || !listingRevisionUnchanged(bucket, listingRevision) {
+		return bucket, false
+	}
+	message := fmt.Sprintf("Fetched revision: %s", listingRevision)
+	return sourcev1.BucketReady(bucket, *bucket.GetArtifact(), bucket.Status.URL, sourcev1.BucketOperationSucceedReason, message), true
+}
+
+// fetch downloads the bucket content into the given temporary directory using
+// the provider specific client, authenticated with the given secret. The
+// fetched objects are recorded in the given state file, so a failed fetch can
+// be resumed. The download is skipped if the given beforeDownload function,
+// if any, returns false for the listing revision.
+func (r *BucketReconciler) fetch(ctx context.Context, bucket sourcev1.Bucket, secret *corev1.Secret, tempDir, stateFile string,
+	beforeDownload func(string) bool) (sourcev1.Bucket, error) {
+	defer r.OperationsRecorder.RecordFetch(sourcev1.BucketKind)()
+
+	var bucketClient sourcebucket.Client
+	var err error
+	switch bucket.Spec.Provider {
+	case sourcev1.SwiftBucketProvider:
+		bucketClient, err = r.authSwift(ctx, bucket, secret)
+	default:
+		bucketClient, err = r.auth(bucket, secret)
+	}
+	if err != nil {
+		err = fmt.Errorf("auth error: %w", err)
+		return sourcev1.BucketNotReady(bucket, sourcev1.AuthenticationFailedReason, err.Error()), err
+	}
+
+	ctx = throttle.WithLimiters(ctx, r.DownloadLimiter, throttle.NewLimiter(r.SourceBandwidthLimit))
+	ctx = retry.WithPolicy(ctx, r.DownloadRetry)
+	timeouts := bucketTimeouts(bucket)
+	if bucket.Spec.RequireObjectLock {
+		listCtx, cancel := context.WithTimeout(ctx, timeouts.list)
+		defer cancel()
+		if err := sourcebucket.VerifyObjectLock(listCtx, bucketClient, bucket.Spec.BucketName); err != nil {
+			reason := sourcev1.BucketOperationFailedReason
+			if errors.Is(err, sourcebucket.ErrObjectLockNotEnabled) {
+				reason = sourcev1.ObjectLockNotEnabledReason
+			}
+			return sourcev1.BucketNotReady(bucket, reason, err.Error()), err
+		}
+	}
+
+	if err := sourcebucket.Fetch(ctx, bucketClient, bucket.Spec.BucketName, tempDir, sourcebucket.FetchOptions{
+		Ignore:          bucket.Spec.Ignore,
+		Metadata:        bucket.Spec.IncludeMetadata,
+		RequireObjects:  bucket.Spec.EmptyBucketPolicy == sourcev1.FailEmptyBucketPolicy,
+		StateFile:       stateFile,
+		ListTimeout:     timeouts.list,
+		DownloadTimeout: timeouts.download,
+		BeforeDownload:  beforeDownload,
+	}); err != nil {
+		// do not reuse the client after a failure, as the token may have
+		// been revoked
+		r.swiftClients.Delete(bucketClientKey(bucket))
+		readyReason := sourcev1.BucketOperationFailedReason
+		if errors.Is(err, sourcebucket.ErrEmptyBucket) {
+			readyReason = sourcev1.EmptyBucketReason
+		}
+		reason := setFetchFailed(&bucket, err, readyReason)
+		r.OperationsRecorder.RecordFetchFailure(sourcev1.BucketKind, reason)
+		return sourcev1.BucketNotReady(bucket, readyReason, err.Error()), err
+	}
+	return bucket, nil
+}
+
+// fetchTimeouts holds the timeouts of the phases of a bucket fetch.
+type fetchTimeouts struct {
+	connect  time.Duration
+	list     time.Duration
+	download time.Duration
+}
+
+// bucketTimeouts returns the fetch timeouts of the given bucket, which
+// default to spec.timeout when not set in spec.timeouts.
+func bucketTimeouts(bucket sourcev1.Bucket) fetchTimeouts {
+	timeout := bucket.Spec.Timeout.Duration
+	t := fetchTimeouts{connect: timeout, list: timeout, download: timeout}
+	if s := bucket.Spec.Timeouts; s != nil {
+		if s.Connect != nil {
+			t.connect = s.Connect.Duration
+		}
+		if s.List != nil {
+			t.list = s.List.Duration
+		}
+		if s.Download != nil {
+			t.download = s.Download.Duration
+		}
+	}
+	return t
+}
+
+// partialFetchRoot returns the tmp dir holding the partial fetches of the
+// given bucket.
+func partialFetchRoot(bucket sourcev1.Bucket) string {
+	return filepath.Join(os.TempDir(), "source-controller-buckets", bucket.Namespace, bucket.Name)
+}
+
+// partialFetchDir returns the tmp dir the content of the given bucket is
+// fetched into, and the state file recording the fetched objects. Both are
+// keyed by the bucket generation, and kept after a failed fetch so the next
+// attempt only downloads the missing objects. The leftovers of the fetches
+// of previous generations are removed.
+func partialFetchDir(bucket sourcev1.Bucket) (string, string, error) {
+	root := partialFetchRoot(bucket)
+	dir := filepath.Join(root, strconv.FormatInt(bucket.Generation, 10))
+	stateFile := dir + ".json"
+	if entries, err := os.ReadDir(root); err == nil {
+		for _, e := range entries {
+			if p := filepath.Join(root, e.Name()); p != dir && p != stateFile {
+				if err := os.RemoveAll(p); err != nil {
+					return "", "", err
+				}
+			}
+		}
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", err
+	}
+	return dir, stateFile, nil
+}
+
+// removePartialFetchDir removes the tmp dirs of the given bucket.
+func removePartialFetchDir(bucket sourcev1.Bucket) {
+	os.RemoveAll(partialFetchRoot(bucket))
+}
+
 func (r *BucketReconciler) reconcileDelete(ctx context.Context, bucket sourcev1.Bucket) (ctrl.Result, error) {
+	r.swiftClients.Delete(bucketClientKey(bucket))
+	removePartialFetchDir(bucket)
+
 	if err := r.gc(bucket); err != nil {
 		r.event(ctx, bucket, events.EventSeverityError,
 			fmt.Sprintf("garbage collection for deleted resource failed: %s", err.Error()))
@@ -304,6 +644,8 @@ func (r *BucketReconciler) reconcileDelete(ctx context.Context, bucket sourcev1.
 
 	// Record deleted status
 	r.recordReadiness(ctx, bucket)
+	unindexArtifact(r.ArtifactIndex, sourcev1.BucketKind, bucket.Namespace, bucket.Name)
+	r.OperationsRecorder.DeleteArtifactRevision(sourcev1.BucketKind, bucket.Namespace, bucket.Name)
 
 	// Remove our finalizer from the list and update it
 	controllerutil.RemoveFinalizer(&bucket, sourcev1.SourceFinalizer)
@@ -315,51 +657,102 @@ func (r *BucketReconciler) reconcileDelete(ctx context.Context, bucket sourcev1.
 	return ctrl.Result{}, nil
 }
 
-func (r *BucketReconciler) auth(ctx context.Context, bucket sourcev1.Bucket) (*minio.Client, error) {
-	opt := minio.Options{
-		Region: bucket.Spec.Region,
-		Secure: !bucket.Spec.Insecure,
+// getBucketSecret returns the Secret referenced by the Bucket, or nil if it
+// does not reference one.
+func (r *BucketReconciler) getBucketSecret(ctx context.Context, bucket sourcev1.Bucket) (*corev1.Secret, error) {
+	if bucket.Spec.SecretRef == nil {
+		return nil, nil
+	}
+	secretName := types.NamespacedName{
+		Namespace: bucket.GetNamespace(),
+		Name:      bucket.Spec.SecretRef.Name,
 	}
 
-	if bucket.Spec.SecretRef != nil {
-		secretName := types.NamespacedName{
-			Namespace: bucket.GetNamespace(),
-			Name:      bucket.Spec.SecretRef.Name,
-		}
-
-		var secret corev1.Secret
-		if err := r.Get(ctx, secretName, &secret); err != nil {
-			return nil, fmt.Errorf("credentials secret error: %w", err)
-		}
+	var secret corev1.Secret
+	if err := r.Get(ctx, secretName, &secret); err != nil {
+		return nil, fmt.Errorf("credentials secret error: %w", err)
+	}
+	return &secret, nil
+}
 
-		accesskey := ""
-		secretkey := ""
-		if k, ok := secret.Data["accesskey"]; ok {
-			accesskey = string(k)
+func (r *BucketReconciler) auth(bucket sourcev1.Bucket, secret *corev1.Secret) (*minio.Client, error) {
+	profile := bucketProfiles[bucket.Spec.Provider]
+	region := bucket.Spec.Region
+	if region == "" {
+		// the region of the profile is the one of the endpoint before rewriting
+		region = profile.Region(bucket.Spec.Endpoint)
+	}
+	opts := minio.Options{
+		Endpoint:             r.URLRewriter.Rewrite(bucket.Spec.Endpoint),
+		Region:               region,
+		Profile:              profile,
+		Insecure:             bucket.Spec.Insecure,
+		UseIAM:               bucket.Spec.Provider == sourcev1.AmazonBucketProvider,
+		ForcePathStyle:       bucket.Spec.ForcePathStyle,
+		HTTP2:                bucket.Spec.EnableHTTP2,
+		TransferAcceleration: bucket.Spec.TransferAcceleration,
+		Headers:              httpHeaders(r.HTTPHeaders, bucket.Spec.Headers),
+		ConnectTimeout:       bucketTimeouts(bucket).connect,
+	}
+	if rd := bucket.Spec.RangedDownload; rd != nil {
+		opts.PartSize = minio.DefaultPartSize
+		if rd.PartSize != nil {
+			opts.PartSize = rd.PartSize.Value()
 		}
-		if k, ok := secret.Data["secretkey"]; ok {
-			secretkey = string(k)
-		}
-		if accesskey == "" || secretkey == "" {
-			return nil, fmt.Errorf("invalid '%s' secret data: required fields 'accesskey' and 'secretkey'", secret.Name)
+		opts.PartConcurrency = rd.Concurrency
+	}
+	if signing := bucket.Spec.Signing; signing != nil {
+		opts.SigningRegion = signing.Region
+		opts.SigningService = signing.Service
+		if opts.SigningRegion == "" && opts.SigningService == "" {
+			opts.SigningService = minio.DefaultSigningService
 		}
-		opt.Creds = credentials.NewStaticV4(accesskey, secretkey, "")
-	} else if bucket.Spec.Provider == sourcev1.AmazonBucketProvider {
-		opt.Creds = credentials.NewIAM("")
 	}
+	return minio.NewClient(opts, secret)
+}
 
-	if opt.Creds == nil {
+// authSwift returns a Swift client authenticated against Keystone with the
+// credentials from the given Secret.
+// Clients are cached per Bucket, and are reused as long as neither the Bucket
+// spec nor the Secret has changed, to avoid a token exchange on every
+// reconciliation.
+func (r *BucketReconciler) authSwift(ctx context.Context, bucket sourcev1.Bucket, secret *corev1.Secret) (*swift.Client, error) {
+	if secret == nil {
 		return nil, fmt.Errorf("no bucket credentials found")
 	}
 
-	return minio.New(bucket.Spec.Endpoint, &opt)
+	key := bucketClientKey(bucket)
+	version := fmt.Sprintf("%d/%s", bucket.GetGeneration(), secret.GetResourceVersion())
+	if c, ok := r.swiftClients.Get(key, version); ok {
+		return c.(*swift.Client), nil
+	}
+
+	c, err := swift.NewClient(ctx, swift.Options{
+		Endpoint:       r.URLRewriter.Rewrite(bucket.Spec.Endpoint),
+		Region:         bucket.Spec.Region,
+		Insecure:       bucket.Spec.Insecure,
+		Timeout:        bucketTimeouts(bucket).download,
+		ConnectTimeout: bucketTimeouts(bucket).connect,
+		Headers:        httpHeaders(r.HTTPHeaders, bucket.Spec.Headers),
+	}, secret)
+	if err != nil {
+		return nil, err
+	}
+	r.swiftClients.Set(key, version, c)
+	return c, nil
+}
+
+// bucketClientKey returns the client cache key for the given Bucket.
+func bucketClientKey(bucket sourcev1.Bucket) string {
+	return types.NamespacedName{Namespace: bucket.GetNamespace(), Name: bucket.GetName()}.String()
 }
 
 // checksum calculates the SHA1 checksum of the given root directory.
 // It traverses the given root directory and calculates the checksum for any found file, and returns the SHA1 sum of the
-// list with relative file paths and their checksums.
+// list with relative file paths and their checksums. The files are hashed concurrently by up to checksumWorkers
+// goroutines, and listed in the order of the traversal, for the checksum not to depend on the number of workers.
 func (r *BucketReconciler) checksum(root string) (string, error) {
-	sum := sha1.New()
+	var relPaths []string
 	if err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -367,22 +760,85 @@ func (r *BucketReconciler) checksum(root string) (string, error) {
 		if !info.Mode().IsRegular() {
 			return nil
 		}
-		data, err := os.ReadFile(path)
-		if err != nil {
-			return err
-		}
 		relPath, err := filepath.Rel(root, path)
 		if err != nil {
 			return err
 		}
-		sum.Write([]byte(fmt.Sprintf("%x  %s\n", sha1.Sum(data), relPath)))
+		relPaths = append(relPaths, relPath)
 		return nil
 	}); err != nil {
 		return "", err
 	}
+
+	workers := r.checksumWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	sums := make([][sha1.Size]byte, len(relPaths))
+	g, ctx := errgroup.WithContext(context.Background())
+	sem := make(chan struct{}, workers)
+files:
+	for i := range relPaths {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break files
+		}
+		i := i
+		g.Go(func() error {
+			defer func() { <-sem }()
+			return fileSHA1(filepath.Join(root, relPaths[i]), &sums[i])
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return "", err
+	}
+
+	sum := sha1.New()
+	for i, relPath := range relPaths {
+		sum.Write([]byte(fmt.Sprintf("%x  %s\n", sums[i], relPath)))
+	}
 	return fmt.Sprintf("%x", sum.Sum(nil)), nil
 }
 
+// fileSHA1 writes the SHA1 checksum of the file at the given path to sum.
+func fileSHA1(path string, sum *[sha1.Size]byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	copy(sum[:], h.Sum(nil))
+	return nil
+}
+
+// withdrawArtifact removes the artifacts of the given suspended Bucket
+// from the storage and its status, for the consumers to stop receiving them.
+func (r *BucketReconciler) withdrawArtifact(ctx context.Context, req ctrl.Request, bucket sourcev1.Bucket) (ctrl.Result, error) {
+	if artifactWithdrawn(&bucket, bucket.Status.ObservedGeneration) {
+		return ctrl.Result{}, nil
+	}
+	if err := withdrawArtifacts(ctx, r.Client, r.Scheme, r.Storage, sourcev1.BucketKind, &bucket, bucket.Status.InlineArtifact); err != nil {
+		r.event(ctx, bucket, events.EventSeverityError, err.Error())
+		return ctrl.Result{Requeue: true}, err
+	}
+	unindexArtifact(r.ArtifactIndex, sourcev1.BucketKind, bucket.Namespace, bucket.Name)
+	r.OperationsRecorder.DeleteArtifactRevision(sourcev1.BucketKind, bucket.Namespace, bucket.Name)
+
+	bucket = sourcev1.BucketWithdrawn(bucket)
+	if err := r.updateStatus(ctx, req, bucket.Status); err != nil {
+		logr.FromContext(ctx).Error(err, "unable to update status")
+		return ctrl.Result{Requeue: true}, err
+	}
+	r.event(ctx, bucket, events.EventSeverityInfo, withdrawnMessage)
+	r.recordReadiness(ctx, bucket)
+	return ctrl.Result{}, nil
+}
+
 // resetStatus returns a modified v1beta1.Bucket and a boolean indicating
 // if the status field has been reset.
 func (r *BucketReconciler) resetStatus(bucket sourcev1.Bucket) (sourcev1.Bucket, bool) {
@@ -402,7 +858,10 @@ func (r *BucketReconciler) resetStatus(bucket sourcev1.Bucket) (sourcev1.Bucket,
 // It removes all but the current artifact except for when the
 // deletion timestamp is set, which will result in the removal of
 // all artifacts for the resource.
-func (r *BucketReconciler) gc(bucket sourcev1.Bucket) error {
+func (r *BucketReconciler) gc(bucket sourcev1.Bucket) (err error) {
+	defer func() {
+		r.OperationsRecorder.RecordGC(sourcev1.BucketKind, err)
+	}()
 	if !bucket.DeletionTimestamp.IsZero() {
 		return r.Storage.RemoveAll(r.Storage.NewArtifactFor(bucket.Kind, bucket.GetObjectMeta(), "", "*"))
 	}
@@ -414,6 +873,10 @@ func (r *BucketReconciler) gc(bucket sourcev1.Bucket) error {
 
 // event emits a Kubernetes event and forwards the event to notification controller if configured
 func (r *BucketReconciler) event(ctx context.Context, bucket sourcev1.Bucket, severity, msg string) {
+	if !r.EventLimiter.Allow(sourcev1.BucketKind+"/"+bucket.Namespace+"/"+bucket.Name, severity, msg) {
+		return
+	}
+
 	log := logr.FromContext(ctx)
 	if r.EventRecorder != nil {
 		r.EventRecorder.Eventf(&bucket, "Normal", severity, msg)
@@ -479,6 +942,7 @@ func (r *BucketReconciler) updateStatus(ctx context.Context, req ctrl.Request, n
 
 	patch := client.MergeFrom(bucket.DeepCopy())
 	bucket.Status = newStatus
+	bucket.Status.URL = r.Storage.resignURLs(bucket.Status.URL, bucket.Status.Artifact)
 
 	return r.Status().Patch(ctx, &bucket, patch)
 }
@@ -17,9 +17,24 @@ limitations under the License.
 package controllers
 
 import (
+	"context"
+	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
 )
 
 func TestBucketReconciler_checksum(t *testing.T) {
@@ -70,6 +85,174 @@ func TestBucketReconciler_checksum(t *testing.T) {
 	}
 }
 
+func TestBucketReconciler_checksum_workers(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 50; i++ {
+		mockFile(root, fmt.Sprintf("dir%d/file%d.txt", i%7, i), strings.Repeat("a", i))
+	}
+
+	want, err := (&BucketReconciler{}).checksum(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{2, 8, 100} {
+		got, err := (&BucketReconciler{checksumWorkers: workers}).checksum(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("checksum() with %d workers = %v, want %v", workers, got, want)
+		}
+	}
+
+	// root reads the files regardless of their mode
+	if os.Geteuid() != 0 {
+		if err := os.Chmod(filepath.Join(root, "dir0", "file0.txt"), 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := (&BucketReconciler{checksumWorkers: 4}).checksum(root); err == nil {
+			t.Error("checksum() of an unreadable file error = nil")
+		}
+	}
+}
+
+func Test_revertPendingRevision(t *testing.T) {
+	ready := sourcev1.BucketReady(sourcev1.Bucket{}, sourcev1.Artifact{Revision: "current"}, "http://example.com/current.tar.gz",
+		sourcev1.BucketOperationSucceedReason, "Fetched revision: current")
+	pending := sourcev1.BucketPending(ready, "newer", "window closed")
+
+	tests := []struct {
+		name            string
+		bucket          sourcev1.Bucket
+		listingRevision string
+		want            bool
+	}{
+		{name: "reverted while pending", bucket: pending, listingRevision: "current", want: true},
+		{name: "pending", bucket: pending, listingRevision: "newer"},
+		{name: "not pending", bucket: ready, listingRevision: "current"},
+		{name: "checksum revision mode", bucket: pending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := revertPendingRevision(tt.bucket, tt.listingRevision)
+			if ok != tt.want {
+				t.Fatalf("revertPendingRevision() = %v, want %v", ok, tt.want)
+			}
+			if !ok {
+				if got.Status.PendingRevision != tt.bucket.Status.PendingRevision {
+					t.Errorf("PendingRevision = %q, want %q", got.Status.PendingRevision, tt.bucket.Status.PendingRevision)
+				}
+				return
+			}
+			if got.Status.PendingRevision != "" {
+				t.Errorf("PendingRevision = %q, want empty", got.Status.PendingRevision)
+			}
+			if got.GetArtifact().Revision != "current" || got.Status.URL != ready.Status.URL {
+				t.Errorf("artifact = %+v, URL = %q, want the current ones", got.GetArtifact(), got.Status.URL)
+			}
+			if c := apimeta.FindStatusCondition(got.Status.Conditions, meta.ReadyCondition); c == nil ||
+				c.Reason != sourcev1.BucketOperationSucceedReason {
+				t.Errorf("Ready condition = %+v, want reason %s", c, sourcev1.BucketOperationSucceedReason)
+			}
+		})
+	}
+}
+
+func TestBucketReconciler_Reconcile_signedURLs(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := sourcev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := createStoragePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanupStoragePath(dir))
+	storage, err := NewStorage(dir, "hostname", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.SigningKey = []byte("key")
+	storage.SignedURLTTL = time.Hour
+
+	tests := []struct {
+		name      string
+		spec      sourcev1.BucketSpec
+		wantErr   bool
+		wantAfter time.Duration
+	}{
+		{
+			name:      "suspended",
+			spec:      sourcev1.BucketSpec{Suspend: true},
+			wantAfter: 30 * time.Minute,
+		},
+		{
+			name: "failing",
+			spec: sourcev1.BucketSpec{
+				BucketName: "podinfo",
+				Endpoint:   "127.0.0.1:1",
+				Insecure:   true,
+				Timeout:    &metav1.Duration{Duration: time.Second},
+				Interval:   metav1.Duration{Duration: 10 * time.Hour},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := &sourcev1.Bucket{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "podinfo-" + tt.name,
+					Namespace:  "default",
+					Finalizers: []string{sourcev1.SourceFinalizer},
+				},
+				Spec: tt.spec,
+			}
+			artifact := storage.NewArtifactFor(sourcev1.BucketKind, bucket, "revision", "revision.tar.gz")
+			if err := storage.MkdirAll(artifact); err != nil {
+				t.Fatal(err)
+			}
+			if err := storage.AtomicWriteFile(&artifact, strings.NewReader("content"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			// the URLs published before they expired
+			artifact.URL = "http://hostname/" + artifact.Path + "?expires=1&signature=00"
+			bucket.Status = sourcev1.BucketReady(*bucket, artifact, "http://hostname/bucket/default/"+bucket.Name+"/latest.tar.gz?expires=1&signature=00",
+				sourcev1.BucketOperationSucceedReason, "Fetched revision: revision").Status
+
+			r := &BucketReconciler{
+				Client:  fake.NewClientBuilder().WithScheme(scheme).WithObjects(bucket).Build(),
+				Storage: storage,
+			}
+			key := client.ObjectKeyFromObject(bucket)
+			result, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Reconcile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if result.RequeueAfter != tt.wantAfter {
+				t.Errorf("Reconcile() requeue after = %s, want %s", result.RequeueAfter, tt.wantAfter)
+			}
+
+			got := &sourcev1.Bucket{}
+			if err := r.Get(context.TODO(), key, got); err != nil {
+				t.Fatal(err)
+			}
+			if got.GetArtifact() == nil {
+				t.Fatal("artifact was removed from the status")
+			}
+			for _, s := range []string{got.GetArtifact().URL, got.Status.URL} {
+				u, err := url.Parse(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := storage.VerifyURL(u); err != nil {
+					t.Errorf("URL %s was not signed again: %v", s, err)
+				}
+			}
+		})
+	}
+}
+
 func mockFile(root, path, content string) error {
 	filePath := filepath.Join(root, path)
 	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"github.com/fluxcd/source-controller/pkg/bucket/minio"
+	"github.com/fluxcd/source-controller/pkg/bucket/swift"
+)
+
+// amazonS3Domains are the domains of the Amazon S3 endpoints.
+var amazonS3Domains = []string{"amazonaws.com", "amazonaws.com.cn"}
+
+// publicBucketDomains are the domains of the well-known public object
+// storages, which are never served over plain HTTP.
+var publicBucketDomains = append([]string{
+	"storage.googleapis.com",
+	"digitaloceanspaces.com",
+	"r2.cloudflarestorage.com",
+	"backblazeb2.com",
+	"wasabisys.com",
+}, amazonS3Domains...)
+
+// bucketProfiles are the minio.Profile of the S3 compatible providers.
+var bucketProfiles = map[string]minio.Profile{
+	sourcev1.R2BucketProvider: minio.R2Profile,
+	sourcev1.B2BucketProvider: minio.B2Profile,
+}
+
+// validateBucketSpec returns an error if the spec of the given Bucket combines
+// its provider, endpoint and options in a way that can't succeed.
+func validateBucketSpec(bucket sourcev1.Bucket) error {
+	host := endpointHost(bucket.Spec.Endpoint)
+	switch bucket.Spec.Provider {
+	case sourcev1.SwiftBucketProvider:
+		if hasDomain(host, publicBucketDomains...) {
+			return fmt.Errorf("invalid endpoint '%s': the '%s' provider requires a Keystone endpoint, not an S3 endpoint", bucket.Spec.Endpoint, sourcev1.SwiftBucketProvider)
+		}
+	case sourcev1.R2BucketProvider, sourcev1.B2BucketProvider:
+		profile := bucketProfiles[bucket.Spec.Provider]
+		if err := profile.ValidateEndpoint(bucket.Spec.Endpoint); err != nil {
+			return err
+		}
+		// B2 only accepts the requests signed for the region of the endpoint
+		region := profile.Region(bucket.Spec.Endpoint)
+		if profile == minio.B2Profile && bucket.Spec.Region != "" && bucket.Spec.Region != region {
+			return fmt.Errorf("invalid region '%s': the '%s' provider requires the region of the endpoint, '%s'", bucket.Spec.Region, bucket.Spec.Provider, region)
+		}
+	}
+	if bucket.Spec.Insecure && hasDomain(host, publicBucketDomains...) {
+		return fmt.Errorf("invalid endpoint '%s': insecure connections are not supported by the public object storages", bucket.Spec.Endpoint)
+	}
+	return nil
+}
+
+// bucketSpecWarnings returns the warnings about the spec of the given Bucket
+// which may not succeed, e.g. the 'aws' provider outside of Amazon S3, which
+// gets its credentials from IAM but is also used with S3 compatible storages.
+func bucketSpecWarnings(bucket sourcev1.Bucket) []string {
+	var warnings []string
+	if bucket.Spec.Provider == sourcev1.AmazonBucketProvider && !hasDomain(endpointHost(bucket.Spec.Endpoint), amazonS3Domains...) {
+		warnings = append(warnings, fmt.Sprintf("endpoint '%s' is not an Amazon S3 endpoint, the '%s' provider requires the IAM credentials to be accepted by it",
+			bucket.Spec.Endpoint, sourcev1.AmazonBucketProvider))
+	}
+	return warnings
+}
+
+// validateBucketSecret returns an error if the given Secret of the given
+// Bucket lacks the credential fields of its provider.
+func validateBucketSecret(bucket sourcev1.Bucket, secret *corev1.Secret) error {
+	if secret == nil {
+		if bucket.Spec.Provider == sourcev1.SwiftBucketProvider {
+			return fmt.Errorf("no bucket credentials found: the '%s' provider requires a secret", sourcev1.SwiftBucketProvider)
+		}
+		return nil
+	}
+	if bucket.Spec.Provider == sourcev1.SwiftBucketProvider {
+		return swift.ValidateSecret(secret.Data, secret.Name)
+	}
+	return minio.ValidateSecret(secret.Data, secret.Name)
+}
+
+// endpointHost returns the lower case host of the given bucket endpoint, in
+// the '<host>[:<port>][/<path>]' format.
+func endpointHost(endpoint string) string {
+	host := endpoint
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// hasDomain returns true if the given host is one of the given domains or a
+// subdomain of them.
+func hasDomain(host string, domains ...string) bool {
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
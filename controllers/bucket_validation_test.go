@@ -0,0 +1,112 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+func Test_validateBucketSpec(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		endpoint string
+		region   string
+		insecure bool
+		wantErr  bool
+	}{
+		{name: "generic", provider: sourcev1.GenericBucketProvider, endpoint: "minio.minio.svc.cluster.local:9000"},
+		{name: "generic insecure", provider: sourcev1.GenericBucketProvider, endpoint: "minio:9000", insecure: true},
+		{name: "generic on amazon", provider: sourcev1.GenericBucketProvider, endpoint: "s3.amazonaws.com"},
+		{name: "aws", provider: sourcev1.AmazonBucketProvider, endpoint: "s3.eu-west-1.amazonaws.com"},
+		{name: "aws china", provider: sourcev1.AmazonBucketProvider, endpoint: "s3.cn-north-1.amazonaws.com.cn"},
+		{name: "aws on minio", provider: sourcev1.AmazonBucketProvider, endpoint: "minio.minio.svc.cluster.local:9000"},
+		{name: "aws on ceph", provider: sourcev1.AmazonBucketProvider, endpoint: "rgw.ceph.example.com"},
+		{name: "swift", provider: sourcev1.SwiftBucketProvider, endpoint: "keystone.example.com:5000/v3"},
+		{name: "swift on amazon", provider: sourcev1.SwiftBucketProvider, endpoint: "s3.amazonaws.com", wantErr: true},
+		{name: "r2", provider: sourcev1.R2BucketProvider, endpoint: "0123456789abcdef.r2.cloudflarestorage.com"},
+		{name: "r2 on amazon", provider: sourcev1.R2BucketProvider, endpoint: "s3.amazonaws.com", wantErr: true},
+		{name: "b2", provider: sourcev1.B2BucketProvider, endpoint: "s3.us-west-004.backblazeb2.com", region: "us-west-004"},
+		{name: "b2 other region", provider: sourcev1.B2BucketProvider, endpoint: "s3.us-west-004.backblazeb2.com", region: "us-east-1", wantErr: true},
+		{name: "b2 on native api", provider: sourcev1.B2BucketProvider, endpoint: "api.backblazeb2.com", wantErr: true},
+		{name: "insecure r2", provider: sourcev1.R2BucketProvider, endpoint: "0123456789abcdef.r2.cloudflarestorage.com", insecure: true, wantErr: true},
+		{name: "insecure amazon", provider: sourcev1.AmazonBucketProvider, endpoint: "S3.amazonaws.com:80", insecure: true, wantErr: true},
+		{name: "insecure google", provider: sourcev1.GenericBucketProvider, endpoint: "storage.googleapis.com", insecure: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := sourcev1.Bucket{Spec: sourcev1.BucketSpec{Provider: tt.provider, Endpoint: tt.endpoint, Region: tt.region, Insecure: tt.insecure}}
+			if err := validateBucketSpec(bucket); (err != nil) != tt.wantErr {
+				t.Errorf("validateBucketSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_bucketSpecWarnings(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		endpoint string
+		want     int
+	}{
+		{name: "aws", provider: sourcev1.AmazonBucketProvider, endpoint: "s3.eu-west-1.amazonaws.com"},
+		{name: "aws china", provider: sourcev1.AmazonBucketProvider, endpoint: "s3.cn-north-1.amazonaws.com.cn"},
+		{name: "aws on minio", provider: sourcev1.AmazonBucketProvider, endpoint: "minio:9000", want: 1},
+		{name: "aws on lookalike", provider: sourcev1.AmazonBucketProvider, endpoint: "s3.amazonaws.com.example.com", want: 1},
+		{name: "generic on minio", provider: sourcev1.GenericBucketProvider, endpoint: "minio:9000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := sourcev1.Bucket{Spec: sourcev1.BucketSpec{Provider: tt.provider, Endpoint: tt.endpoint}}
+			if got := bucketSpecWarnings(bucket); len(got) != tt.want {
+				t.Errorf("bucketSpecWarnings() = %v, want %d warnings", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validateBucketSecret(t *testing.T) {
+	keys := &corev1.Secret{Data: map[string][]byte{"accesskey": []byte("a"), "secretkey": []byte("s")}}
+	password := &corev1.Secret{Data: map[string][]byte{"username": []byte("u"), "password": []byte("p")}}
+
+	tests := []struct {
+		name     string
+		provider string
+		secret   *corev1.Secret
+		wantErr  bool
+	}{
+		{name: "generic", provider: sourcev1.GenericBucketProvider, secret: keys},
+		{name: "generic without keys", provider: sourcev1.GenericBucketProvider, secret: password, wantErr: true},
+		{name: "aws without secret", provider: sourcev1.AmazonBucketProvider},
+		{name: "swift", provider: sourcev1.SwiftBucketProvider, secret: password},
+		{name: "swift with keys", provider: sourcev1.SwiftBucketProvider, secret: keys, wantErr: true},
+		{name: "swift without secret", provider: sourcev1.SwiftBucketProvider, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := sourcev1.Bucket{Spec: sourcev1.BucketSpec{Provider: tt.provider}}
+			if err := validateBucketSecret(bucket, tt.secret); (err != nil) != tt.wantErr {
+				t.Errorf("validateBucketSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+// chartCacheDir is the directory in the artifact directory of a
+// HelmRepository holding the chart packages cached for its HelmCharts.
+const chartCacheDir = "charts"
+
+// cachedChartArtifact returns the artifact of the cached package of the
+// chart version with the given name and version of the given HelmRepository.
+// The revision of the artifact is the digest of the chart version in the
+// index, if any.
+func cachedChartArtifact(storage *Storage, repository sourcev1.HelmRepository, name, version, digest string) sourcev1.Artifact {
+	fileName := path.Join(chartCacheDir, fmt.Sprintf("%s-%s.tgz", name, version))
+	return storage.NewArtifactFor(sourcev1.HelmRepositoryKind, repository.GetObjectMeta(), digest, fileName)
+}
+
+// cachedChart returns the local path of the cached package of the given
+// artifact, or an empty string if the package is not cached or does not
+// match the digest of the chart version.
+func cachedChart(storage *Storage, artifact sourcev1.Artifact) string {
+	if !storage.ArtifactExist(artifact) {
+		return ""
+	}
+	localPath := storage.LocalPath(artifact)
+	if artifact.Revision != "" {
+		if digest, err := fileDigest(localPath); err != nil || !strings.EqualFold(digest, artifact.Revision) {
+			return ""
+		}
+	}
+	return localPath
+}
+
+// cacheChart copies the chart package at the given path to the given
+// artifact of the chart cache of a HelmRepository.
+func cacheChart(storage *Storage, artifact sourcev1.Artifact, pkgPath string) error {
+	if err := storage.MkdirAll(artifact); err != nil {
+		return err
+	}
+	unlock, err := storage.Lock(artifact)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return storage.CopyFromPath(&artifact, pkgPath)
+}
+
+// cachedCharts returns the artifacts of the chart packages cached for the
+// given HelmRepository, which are kept by its garbage collection.
+func cachedCharts(storage *Storage, repository sourcev1.HelmRepository) []sourcev1.Artifact {
+	dir := filepath.Join(storage.BasePath, sourcev1.ArtifactDir(sourcev1.HelmRepositoryKind, repository.Namespace, repository.Name), chartCacheDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var artifacts []sourcev1.Artifact
+	for _, e := range entries {
+		if !e.Type().IsRegular() || filepath.Ext(e.Name()) != ".tgz" {
+			continue
+		}
+		artifacts = append(artifacts, storage.NewArtifactFor(sourcev1.HelmRepositoryKind, repository.GetObjectMeta(), "", path.Join(chartCacheDir, e.Name())))
+	}
+	return artifacts
+}
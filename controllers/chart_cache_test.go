@@ -0,0 +1,82 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+func TestChartCache(t *testing.T) {
+	storage, err := NewStorage(t.TempDir(), "hostname", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository := sourcev1.HelmRepository{
+		ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "default"},
+	}
+	pkgPath := filepath.Join(t.TempDir(), "podinfo-6.0.0.tgz")
+	if err := os.WriteFile(pkgPath, []byte("chart"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := fileDigest(pkgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	artifact := cachedChartArtifact(storage, repository, "podinfo", "6.0.0", digest)
+	if want := "helmrepository/default/podinfo/charts/podinfo-6.0.0.tgz"; artifact.Path != want {
+		t.Errorf("Path = %s, want %s", artifact.Path, want)
+	}
+	if got := cachedChart(storage, artifact); got != "" {
+		t.Errorf("cachedChart() = %s, want none before caching", got)
+	}
+
+	if err := cacheChart(storage, artifact, pkgPath); err != nil {
+		t.Fatal(err)
+	}
+	if got := cachedChart(storage, artifact); got != storage.LocalPath(artifact) {
+		t.Errorf("cachedChart() = %s, want %s", got, storage.LocalPath(artifact))
+	}
+	if got := cachedChart(storage, cachedChartArtifact(storage, repository, "podinfo", "6.0.0", "")); got == "" {
+		t.Error("cachedChart() = none, want the package without digest")
+	}
+	if got := cachedChart(storage, cachedChartArtifact(storage, repository, "podinfo", "6.0.0", "0123")); got != "" {
+		t.Errorf("cachedChart() = %s, want none for another digest", got)
+	}
+
+	current := storage.NewArtifactFor(sourcev1.HelmRepositoryKind, repository.GetObjectMeta(), "1", "index-1.yaml")
+	if err := os.WriteFile(storage.LocalPath(current), []byte("apiVersion: v1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	keep := cachedCharts(storage, repository)
+	if len(keep) != 1 || keep[0].Path != artifact.Path {
+		t.Fatalf("cachedCharts() = %v, want %s", keep, artifact.Path)
+	}
+	if err := storage.RemoveAllButCurrent(current, keep...); err != nil {
+		t.Fatal(err)
+	}
+	if !storage.ArtifactExist(artifact) {
+		t.Error("cached chart removed by garbage collection")
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ChecksumManifestFile is the name of the file in the root of the artifacts
+// holding the SHA-256 checksums of their files, if enabled in the spec.
+const ChecksumManifestFile = "SHA256SUMS"
+
+// writeChecksumManifest writes the SHA-256 checksums of the files of the
+// given directory archived by Archive with the given ArchiveFileFilter to the
+// ChecksumManifestFile in the directory, replacing any file of the source
+// with the same name. The manifest is in the format of the sha256sum utility,
+// one '<checksum>  <name>' line per file sorted by name, for the consumers to
+// verify the extracted files with 'sha256sum -c'.
+func (s *Storage) writeChecksumManifest(dir string, filter ArchiveFileFilter) error {
+	manifest := filepath.Join(dir, ChecksumManifestFile)
+	if err := os.RemoveAll(manifest); err != nil {
+		return err
+	}
+
+	var lines []string
+	if err := s.newArchiveWalker(filter, nil).Walk(dir, func(p, name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if p == dir || !s.SkipInvalidFiles {
+				return &ArchiveFileError{Path: name, Err: err}
+			}
+			return nil
+		}
+		if !fi.Mode().IsRegular() || (filter != nil && filter(p, fi)) {
+			return nil
+		}
+		sum, err := fileDigest(p)
+		if err != nil {
+			if s.SkipInvalidFiles {
+				return nil
+			}
+			return &ArchiveFileError{Path: name, Err: err}
+		}
+		lines = append(lines, fmt.Sprintf("%s  %s\n", sum, name))
+		return nil
+	}); err != nil {
+		return fmt.Errorf("checksum manifest error: %w", err)
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i][sha256.Size*2+2:] < lines[j][sha256.Size*2+2:]
+	})
+	return os.WriteFile(manifest, []byte(strings.Join(lines, "")), 0644)
+}
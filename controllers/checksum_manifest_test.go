@@ -0,0 +1,63 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStorage_writeChecksumManifest(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"b.yaml":             "b",
+		"a/c.yaml":           "c",
+		"ignored.txt":        "ignored",
+		ChecksumManifestFile: "stale",
+	} {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filter := func(p string, fi os.FileInfo) bool {
+		return strings.HasSuffix(p, ".txt")
+	}
+
+	s := &Storage{}
+	if err := s.writeChecksumManifest(dir, filter); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, ChecksumManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "2e7d2c03a9507ae265ecf5b5356885a53393a2029d241394997265a1a25aefc6  a/c.yaml\n" +
+		"3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d  b.yaml\n"
+	if string(got) != want {
+		t.Errorf("writeChecksumManifest() = %q, want %q", got, want)
+	}
+
+	if err := s.writeChecksumManifest(filepath.Join(dir, "missing"), nil); err == nil {
+		t.Error("writeChecksumManifest() of a missing directory error = nil")
+	}
+}
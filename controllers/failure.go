@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/fluxcd/pkg/apis/meta"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+// failureClass is the phase of the reconciliation a failure reason belongs
+// to, and whether the failures with the reason are retriable.
+type failureClass struct {
+	phase     string
+	retriable bool
+}
+
+// failureClasses maps the reasons of the Ready and FetchFailed conditions to
+// their failureClass. The fetch failures with other reasons are assumed to be
+// transient.
+var failureClasses = map[string]failureClass{
+	sourcev1.URLInvalidReason:        {sourcev1.ValidationFailurePhase, false},
+	sourcev1.PolicyViolationReason:   {sourcev1.ValidationFailurePhase, false},
+	sourcev1.AccessDeniedReason:      {sourcev1.ValidationFailurePhase, false},
+	sourcev1.BucketSpecInvalidReason: {sourcev1.ValidationFailurePhase, false},
+	sourcev1.WindowInvalidReason:     {sourcev1.ValidationFailurePhase, false},
+
+	meta.DependencyNotReadyReason: {sourcev1.DependencyFailurePhase, true},
+
+	sourcev1.AuthenticationFailedReason: {sourcev1.AuthenticationFailurePhase, false},
+	sourcev1.UnauthorizedReason:         {sourcev1.AuthenticationFailurePhase, false},
+
+	sourcev1.NotFoundReason:           {sourcev1.FetchFailurePhase, false},
+	sourcev1.TLSHandshakeFailedReason: {sourcev1.FetchFailurePhase, false},
+
+	sourcev1.VerificationFailedReason:   {sourcev1.VerificationFailurePhase, false},
+	sourcev1.ChartDigestMismatchReason:  {sourcev1.VerificationFailurePhase, false},
+	sourcev1.HistoryRewrittenReason:     {sourcev1.VerificationFailurePhase, false},
+	sourcev1.ObjectLockNotEnabledReason: {sourcev1.VerificationFailurePhase, false},
+
+	sourcev1.ChartPackageFailedReason: {sourcev1.BuildFailurePhase, false},
+
+	sourcev1.StorageOperationFailedReason: {sourcev1.StorageFailurePhase, true},
+}
+
+// sourceFailure returns the SourceFailure of the reconciliation of the given
+// object that failed with the given error, or nil if the error is nil. The
+// reason is the one of the FetchFailed condition for the fetch failures, as it
+// classifies them by their cause, and the one of the Ready condition
+// otherwise.
+func sourceFailure(obj meta.ObjectWithStatusConditions, err error) *sourcev1.SourceFailure {
+	if err == nil {
+		return nil
+	}
+	var reason string
+	if c := apimeta.FindStatusCondition(*obj.GetStatusConditions(), meta.ReadyCondition); c != nil && c.Status == metav1.ConditionFalse {
+		reason = c.Reason
+	}
+	class, ok := failureClasses[reason]
+	if !ok {
+		class = failureClass{sourcev1.FetchFailurePhase, true}
+		if c := apimeta.FindStatusCondition(*obj.GetStatusConditions(), sourcev1.FetchFailedCondition); c != nil && c.Status == metav1.ConditionTrue {
+			reason = c.Reason
+			if fetchClass, ok := failureClasses[reason]; ok {
+				class = fetchClass
+			}
+		}
+	}
+	return &sourcev1.SourceFailure{
+		Time:       metav1.Now(),
+		Phase:      class.phase,
+		Reason:     reason,
+		StatusCode: statusCode(err),
+		Retriable:  class.retriable,
+	}
+}
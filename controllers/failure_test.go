@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+func Test_sourceFailure(t *testing.T) {
+	tests := []struct {
+		name          string
+		fetchErr      error
+		reason        string
+		err           error
+		wantPhase     string
+		wantReason    string
+		wantCode      int
+		wantRetriable bool
+	}{
+		{
+			name:          "rate limited fetch",
+			fetchErr:      fmt.Errorf("failed to fetch https://charts.example.com/index.yaml : 429 Too Many Requests"),
+			reason:        sourcev1.GitOperationFailedReason,
+			wantPhase:     sourcev1.FetchFailurePhase,
+			wantReason:    sourcev1.RateLimitedReason,
+			wantCode:      429,
+			wantRetriable: true,
+		},
+		{
+			name:       "rejected credentials",
+			fetchErr:   fmt.Errorf("unable to clone: %w", transport.ErrAuthenticationRequired),
+			reason:     sourcev1.GitOperationFailedReason,
+			wantPhase:  sourcev1.AuthenticationFailurePhase,
+			wantReason: sourcev1.UnauthorizedReason,
+			wantCode:   401,
+		},
+		{
+			name:          "unclassified fetch",
+			fetchErr:      errors.New("unexpected EOF"),
+			reason:        sourcev1.GitOperationFailedReason,
+			wantPhase:     sourcev1.FetchFailurePhase,
+			wantReason:    sourcev1.GitOperationFailedReason,
+			wantRetriable: true,
+		},
+		{
+			name:       "verification",
+			err:        errors.New("signature verification failed"),
+			reason:     sourcev1.VerificationFailedReason,
+			wantPhase:  sourcev1.VerificationFailurePhase,
+			wantReason: sourcev1.VerificationFailedReason,
+		},
+		{
+			name:          "storage",
+			err:           errors.New("mkdir dir error"),
+			reason:        sourcev1.StorageOperationFailedReason,
+			wantPhase:     sourcev1.StorageFailurePhase,
+			wantReason:    sourcev1.StorageOperationFailedReason,
+			wantRetriable: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var repository sourcev1.GitRepository
+			err := tt.err
+			if tt.fetchErr != nil {
+				setFetchFailed(&repository, tt.fetchErr, tt.reason)
+				err = tt.fetchErr
+			}
+			repository = sourcev1.GitRepositoryNotReady(repository, tt.reason, err.Error())
+
+			got := sourceFailure(&repository, err)
+			if got == nil {
+				t.Fatal("expected a failure")
+			}
+			if got.Phase != tt.wantPhase || got.Reason != tt.wantReason || got.StatusCode != tt.wantCode || got.Retriable != tt.wantRetriable {
+				t.Errorf("sourceFailure() = %+v, want phase %q, reason %q, status code %d, retriable %v",
+					got, tt.wantPhase, tt.wantReason, tt.wantCode, tt.wantRetriable)
+			}
+			if got.Time.IsZero() {
+				t.Error("expected the time of the failure")
+			}
+		})
+	}
+
+	if got := sourceFailure(&sourcev1.GitRepository{}, nil); got != nil {
+		t.Errorf("sourceFailure() = %+v, want nil", got)
+	}
+}
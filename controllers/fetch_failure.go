@@ -0,0 +1,158 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/minio/minio-go/v7"
+	"github.com/ncw/swift"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	sourcebucket "github.com/fluxcd/source-controller/pkg/bucket"
+)
+
+// helmStatusPattern matches the status code in the errors of the Helm HTTP
+// getter, which only reports it in the message, e.g. 'failed to fetch
+// https://charts.example.com/index.yaml : 404 Not Found'.
+var helmStatusPattern = regexp.MustCompile(`^failed to fetch .* : (\d{3}) `)
+
+// setFetchFailed sets the sourcev1.FetchFailedCondition to 'True' on the
+// object if the given fetch error is not nil, and removes the condition
+// otherwise. The reason of the condition classifies the error, or is the
+// given default reason if the error is not classified. It returns the
+// reason of the condition.
+func setFetchFailed(obj meta.ObjectWithStatusConditions, err error, defaultReason string) string {
+	if err == nil {
+		apimeta.RemoveStatusCondition(obj.GetStatusConditions(), sourcev1.FetchFailedCondition)
+		return ""
+	}
+	reason := fetchFailureReason(err)
+	if reason == "" {
+		reason = defaultReason
+	}
+	meta.SetResourceCondition(obj, sourcev1.FetchFailedCondition, metav1.ConditionTrue, reason, err.Error())
+	return reason
+}
+
+// fetchFailureReason returns the reason classifying the given error of a
+// fetch from the upstream of a source, or an empty string if the error is
+// not classified.
+func fetchFailureReason(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return sourcev1.DNSResolutionFailedReason
+	}
+	if isTLSError(err) {
+		return sourcev1.TLSHandshakeFailedReason
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return sourcev1.TimeoutReason
+	}
+
+	switch code := statusCode(err); {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return sourcev1.UnauthorizedReason
+	case code == http.StatusNotFound:
+		return sourcev1.NotFoundReason
+	case code == http.StatusTooManyRequests:
+		return sourcev1.RateLimitedReason
+	case code >= http.StatusInternalServerError:
+		return sourcev1.UpstreamUnavailableReason
+	}
+	return ""
+}
+
+// retryAfter returns the duration the upstream asked to wait for before the
+// next fetch in the rate limited or unavailable response the given fetch
+// error was returned for, or nil if it did not ask for one.
+func retryAfter(err error) *metav1.Duration {
+	if code := statusCode(err); code != http.StatusTooManyRequests && code != http.StatusServiceUnavailable {
+		return nil
+	}
+	var retryErr interface{ RetryAfter() time.Duration }
+	if !errors.As(err, &retryErr) || retryErr.RetryAfter() <= 0 {
+		return nil
+	}
+	return &metav1.Duration{Duration: retryErr.RetryAfter()}
+}
+
+// isTLSError returns true if the given error is a failure to establish a TLS
+// connection, or to verify the certificate of the server.
+func isTLSError(err error) bool {
+	var (
+		recordErr    tls.RecordHeaderError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+	return errors.As(err, &recordErr) || errors.As(err, &authorityErr) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &invalidErr)
+}
+
+// statusCode returns the HTTP status code of the response the given error
+// was returned for by the Git, bucket or Helm clients, or 0 if unknown.
+func statusCode(err error) int {
+	switch {
+	case errors.Is(err, transport.ErrAuthenticationRequired):
+		return http.StatusUnauthorized
+	case errors.Is(err, transport.ErrAuthorizationFailed):
+		return http.StatusForbidden
+	case errors.Is(err, transport.ErrRepositoryNotFound), errors.Is(err, sourcebucket.ErrBucketNotFound):
+		return http.StatusNotFound
+	}
+
+	var unexpectedErr *plumbing.UnexpectedError
+	if errors.As(err, &unexpectedErr) {
+		// go-git does not unwrap the errors of unexpected status codes
+		return statusCode(unexpectedErr.Err)
+	}
+	var codeErr interface{ StatusCode() int }
+	if errors.As(err, &codeErr) {
+		return codeErr.StatusCode()
+	}
+	var minioErr minio.ErrorResponse
+	if errors.As(err, &minioErr) {
+		return minioErr.StatusCode
+	}
+	var swiftErr *swift.Error
+	if errors.As(err, &swiftErr) {
+		return swiftErr.StatusCode
+	}
+
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if m := helmStatusPattern.FindStringSubmatch(e.Error()); m != nil {
+			code, _ := strconv.Atoi(m[1])
+			return code
+		}
+	}
+	return 0
+}
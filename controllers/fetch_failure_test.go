@@ -0,0 +1,181 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/minio/minio-go/v7"
+	"github.com/ncw/swift"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	sourcebucket "github.com/fluxcd/source-controller/pkg/bucket"
+	"github.com/fluxcd/source-controller/pkg/git/archive"
+)
+
+func Test_fetchFailureReason(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/repo.git", nil)
+	urlErr := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://example.com", Err: err}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "DNS",
+			err:  urlErr(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "example.com"}}),
+			want: sourcev1.DNSResolutionFailedReason,
+		},
+		{
+			name: "TLS",
+			err:  urlErr(x509.UnknownAuthorityError{}),
+			want: sourcev1.TLSHandshakeFailedReason,
+		},
+		{
+			name: "timeout",
+			err:  fmt.Errorf("unable to clone: %w", context.DeadlineExceeded),
+			want: sourcev1.TimeoutReason,
+		},
+		{
+			name: "go-git authentication",
+			err:  fmt.Errorf("unable to clone: %w", transport.ErrAuthenticationRequired),
+			want: sourcev1.UnauthorizedReason,
+		},
+		{
+			name: "go-git not found",
+			err:  fmt.Errorf("unable to clone: %w", transport.ErrRepositoryNotFound),
+			want: sourcev1.NotFoundReason,
+		},
+		{
+			name: "go-git unexpected status",
+			err: fmt.Errorf("unable to clone: %w", plumbing.NewUnexpectedError(&githttp.Err{
+				Response: &http.Response{StatusCode: http.StatusBadGateway, Request: req},
+			})),
+			want: sourcev1.UpstreamUnavailableReason,
+		},
+		{
+			name: "minio",
+			err:  fmt.Errorf("listing objects failed: %w", minio.ErrorResponse{StatusCode: http.StatusTooManyRequests}),
+			want: sourcev1.RateLimitedReason,
+		},
+		{
+			name: "swift",
+			err:  fmt.Errorf("downloading object failed: %w", swift.Forbidden),
+			want: sourcev1.UnauthorizedReason,
+		},
+		{
+			name: "bucket not found",
+			err:  fmt.Errorf("bucket 'podinfo' %w", sourcebucket.ErrBucketNotFound),
+			want: sourcev1.NotFoundReason,
+		},
+		{
+			name: "helm",
+			err: fmt.Errorf("failed to download repository index: %w",
+				errors.New("failed to fetch https://example.com/index.yaml : 503 Service Unavailable")),
+			want: sourcev1.UpstreamUnavailableReason,
+		},
+		{
+			name: "unclassified",
+			err:  errors.New("invalid index"),
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fetchFailureReason(tt.err); got != tt.want {
+				t.Errorf("fetchFailureReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_setFetchFailed(t *testing.T) {
+	repository := sourcev1.GitRepository{}
+
+	if got := setFetchFailed(&repository, errors.New("invalid index"), sourcev1.GitOperationFailedReason); got != sourcev1.GitOperationFailedReason {
+		t.Errorf("setFetchFailed() = %q, want default reason", got)
+	}
+	if got := setFetchFailed(&repository, transport.ErrAuthorizationFailed, sourcev1.GitOperationFailedReason); got != sourcev1.UnauthorizedReason {
+		t.Errorf("setFetchFailed() = %q, want %q", got, sourcev1.UnauthorizedReason)
+	}
+	c := apimeta.FindStatusCondition(repository.Status.Conditions, sourcev1.FetchFailedCondition)
+	if c == nil || c.Reason != sourcev1.UnauthorizedReason {
+		t.Fatalf("setFetchFailed() did not set the condition, got %v", c)
+	}
+
+	setFetchFailed(&repository, nil, "")
+	if apimeta.FindStatusCondition(repository.Status.Conditions, sourcev1.FetchFailedCondition) != nil {
+		t.Error("setFetchFailed() did not remove the condition")
+	}
+}
+
+func Test_retryAfter(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want time.Duration
+	}{
+		{
+			name: "rate limited",
+			err:  fmt.Errorf("unable to clone: %w", &archive.StatusError{Code: http.StatusTooManyRequests, Delay: time.Minute}),
+			want: time.Minute,
+		},
+		{
+			name: "unavailable",
+			err:  &archive.StatusError{Code: http.StatusServiceUnavailable, Delay: 30 * time.Second},
+			want: 30 * time.Second,
+		},
+		{
+			name: "without delay",
+			err:  &archive.StatusError{Code: http.StatusTooManyRequests},
+		},
+		{
+			name: "not rate limited",
+			err:  &archive.StatusError{Code: http.StatusNotFound, Delay: time.Minute},
+		},
+		{
+			name: "without header",
+			err:  minio.ErrorResponse{StatusCode: http.StatusTooManyRequests},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := retryAfter(tt.err)
+			switch {
+			case tt.want == 0 && got != nil:
+				t.Errorf("retryAfter() = %s, want nil", got.Duration)
+			case tt.want != 0 && (got == nil || got.Duration != tt.want):
+				t.Errorf("retryAfter() = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
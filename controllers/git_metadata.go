@@ -0,0 +1,146 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"github.com/fluxcd/source-controller/pkg/git"
+)
+
+// GitMetadataFile is the name of the file in the root of the GitRepository
+// artifacts holding the metadata of the commit, if enabled in the spec.
+const GitMetadataFile = ".git-metadata.yaml"
+
+// The signature statuses of the commits in the GitMetadataFile, and of the
+// tags in the GitRepository status.
+const (
+	verifiedSignature   = "verified"
+	unverifiedSignature = "unverified"
+	unsignedSignature   = "unsigned"
+)
+
+// gitMetadata is the content of the GitMetadataFile.
+type gitMetadata struct {
+	Commit    string       `json:"commit"`
+	Revision  string       `json:"revision"`
+	Branch    string       `json:"branch,omitempty"`
+	Tag       string       `json:"tag,omitempty"`
+	Author    gitSignature `json:"author"`
+	Committer gitSignature `json:"committer"`
+	Message   string       `json:"message"`
+	Signature string       `json:"signature"`
+	Timestamp time.Time    `json:"timestamp"`
+}
+
+type gitSignature struct {
+	Name  string    `json:"name"`
+	Email string    `json:"email"`
+	When  time.Time `json:"when"`
+}
+
+// writeGitMetadata writes the metadata of the given commit checked out at the
+// given revision to the GitMetadataFile in the given directory, replacing
+// any file of the repository with the same name.
+func writeGitMetadata(dir string, repository sourcev1.GitRepository, commit git.Commit, revision string) error {
+	info := commit.Info()
+	metadata := gitMetadata{
+		Commit:    commit.Hash(),
+		Revision:  revision,
+		Author:    gitSignature(info.Author),
+		Committer: gitSignature(info.Committer),
+		Message:   info.Message,
+		Signature: unsignedSignature,
+		Timestamp: info.Committer.When,
+	}
+
+	// the revision is in the '<branch>/<commit>' or '<tag>/<commit>' format
+	if i := strings.LastIndex(revision, "/"); i > 0 {
+		if ref := repository.Spec.Reference; ref != nil && (ref.SemVer != "" || ref.Tag != "") {
+			metadata.Tag = revision[:i]
+		} else {
+			metadata.Branch = revision[:i]
+		}
+	}
+
+	switch {
+	case info.Signed && repository.Spec.Verification != nil:
+		// the commits which fail the verification are never archived
+		metadata.Signature = verifiedSignature
+	case info.Signed:
+		metadata.Signature = unverifiedSignature
+	}
+
+	b, err := yaml.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, GitMetadataFile), b, 0644); err != nil {
+		return fmt.Errorf("writing commit metadata failed: %w", err)
+	}
+	return nil
+}
+
+// gitTag returns the status of the tag the given commit was checked out from,
+// or nil if it was not checked out from a tag. The signature of an annotated
+// tag is verified against the keys of the verification secret of the given
+// repository, if any, without failing the reconciliation.
+func (r *GitRepositoryReconciler) gitTag(ctx context.Context, repository sourcev1.GitRepository, commit git.Commit) *sourcev1.GitTag {
+	tagged, ok := commit.(git.TaggedCommit)
+	if !ok {
+		return nil
+	}
+	info := tagged.Tag()
+	if info == nil {
+		return nil
+	}
+
+	tag := &sourcev1.GitTag{
+		Name:      info.Name,
+		Annotated: info.Annotated,
+		Signature: unsignedSignature,
+	}
+	if info.Annotated {
+		tag.Tagger = fmt.Sprintf("%s <%s>", info.Tagger.Name, info.Tagger.Email)
+		taggedAt := metav1.NewTime(info.Tagger.When)
+		tag.TaggedAt = &taggedAt
+	}
+	if !info.Signed {
+		return tag
+	}
+
+	tag.Signature = unverifiedSignature
+	if repository.Spec.Verification != nil {
+		var secret corev1.Secret
+		name := types.NamespacedName{Namespace: repository.Namespace, Name: repository.Spec.Verification.SecretRef.Name}
+		if err := r.Client.Get(ctx, name, &secret); err == nil && tagged.VerifyTag(secret) == nil {
+			tag.Signature = verifiedSignature
+		}
+	}
+	return tag
+}
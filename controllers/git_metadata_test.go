@@ -0,0 +1,126 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"github.com/fluxcd/source-controller/pkg/git"
+)
+
+type fakeCommit struct {
+	hash string
+	info git.CommitInfo
+}
+
+func (c *fakeCommit) Verify(corev1.Secret) error          { return nil }
+func (c *fakeCommit) Hash() string                        { return c.hash }
+func (c *fakeCommit) IsDescendantOf(string) (bool, error) { return true, nil }
+func (c *fakeCommit) Info() git.CommitInfo                { return c.info }
+
+func Test_writeGitMetadata(t *testing.T) {
+	when := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	commit := &fakeCommit{
+		hash: "1234abcd",
+		info: git.CommitInfo{
+			Author:    git.Signature{Name: "author", Email: "author@example.com", When: when.Add(-time.Hour)},
+			Committer: git.Signature{Name: "committer", Email: "committer@example.com", When: when},
+			Message:   "Release v1.0.0\n",
+			Signed:    true,
+		},
+	}
+
+	tests := []struct {
+		name       string
+		ref        *sourcev1.GitRepositoryRef
+		verify     bool
+		signed     bool
+		revision   string
+		wantBranch string
+		wantTag    string
+		wantSig    string
+	}{
+		{
+			name:       "branch",
+			revision:   "main/1234abcd",
+			wantBranch: "main",
+			wantSig:    unsignedSignature,
+		},
+		{
+			name:     "verified tag",
+			ref:      &sourcev1.GitRepositoryRef{Tag: "v1.0.0"},
+			verify:   true,
+			signed:   true,
+			revision: "v1.0.0/1234abcd",
+			wantTag:  "v1.0.0",
+			wantSig:  verifiedSignature,
+		},
+		{
+			name:     "unverified semver",
+			ref:      &sourcev1.GitRepositoryRef{SemVer: ">=1.0.0"},
+			signed:   true,
+			revision: "v1.0.0/1234abcd",
+			wantTag:  "v1.0.0",
+			wantSig:  unverifiedSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			repository := sourcev1.GitRepository{Spec: sourcev1.GitRepositorySpec{Reference: tt.ref}}
+			if tt.verify {
+				repository.Spec.Verification = &sourcev1.GitRepositoryVerification{Mode: "head"}
+			}
+			c := *commit
+			c.info.Signed = tt.signed
+
+			if err := writeGitMetadata(dir, repository, &c, tt.revision); err != nil {
+				t.Fatal(err)
+			}
+			b, err := os.ReadFile(filepath.Join(dir, GitMetadataFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got gitMetadata
+			if err := yaml.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Commit != "1234abcd" || got.Revision != tt.revision {
+				t.Errorf("commit = %q, revision = %q", got.Commit, got.Revision)
+			}
+			if got.Branch != tt.wantBranch || got.Tag != tt.wantTag {
+				t.Errorf("branch = %q, tag = %q, want %q, %q", got.Branch, got.Tag, tt.wantBranch, tt.wantTag)
+			}
+			if got.Signature != tt.wantSig {
+				t.Errorf("signature = %q, want %q", got.Signature, tt.wantSig)
+			}
+			if got.Author.Name != "author" || got.Committer.Email != "committer@example.com" || got.Message != "Release v1.0.0\n" {
+				t.Errorf("unexpected commit metadata %+v", got)
+			}
+			if !got.Timestamp.Equal(when) {
+				t.Errorf("timestamp = %s, want %s", got.Timestamp, when)
+			}
+		})
+	}
+}
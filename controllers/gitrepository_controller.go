@@ -18,6 +18,7 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -25,6 +26,7 @@ import (
 	"time"
 
 	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
@@ -46,30 +48,68 @@ import (
 	"github.com/fluxcd/pkg/runtime/predicates"
 
 	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"github.com/fluxcd/source-controller/internal/eventlimit"
+	"github.com/fluxcd/source-controller/internal/gitcache"
+	"github.com/fluxcd/source-controller/internal/githubapp"
+	"github.com/fluxcd/source-controller/internal/index"
+	sourcemetrics "github.com/fluxcd/source-controller/internal/metrics"
+	"github.com/fluxcd/source-controller/internal/policy"
+	"github.com/fluxcd/source-controller/internal/rewrite"
+	"github.com/fluxcd/source-controller/internal/tracing"
 	"github.com/fluxcd/source-controller/pkg/git"
 	"github.com/fluxcd/source-controller/pkg/git/strategy"
 	"github.com/fluxcd/source-controller/pkg/sourceignore"
+	"github.com/fluxcd/source-controller/pkg/throttle"
 )
 
 // +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=gitrepositories,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=gitrepositories/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=gitrepositories/finalizers,verbs=get;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 
 // GitRepositoryReconciler reconciles a GitRepository object
 type GitRepositoryReconciler struct {
 	client.Client
+	APIReader             client.Reader
 	requeueDependency     time.Duration
+	intervalJitter        int
 	Scheme                *runtime.Scheme
 	Storage               *Storage
 	EventRecorder         kuberecorder.EventRecorder
 	ExternalEventRecorder *events.Recorder
 	MetricsRecorder       *metrics.Recorder
+	OperationsRecorder    *sourcemetrics.Recorder
+	ArtifactIndex         *index.Index
+	EndpointPolicy        *policy.Policy
+	URLRewriter           *rewrite.Rewriter
+	EventLimiter          *eventlimit.Limiter
+	GitCache              *gitcache.Cache
+
+	// SSHProxy is the SOCKS5 proxy URL used for the SSH repositories without
+	// a proxy set in their spec.
+	SSHProxy string
+	// HTTPHeaders are the headers sent with the requests to HTTP/S
+	// repositories, unless overridden in their spec.
+	HTTPHeaders map[string]string
+	// DownloadLimiter limits the bandwidth shared by the downloads of all
+	// the sources of the controller.
+	DownloadLimiter *throttle.Limiter
+	// SourceBandwidthLimit is the bandwidth in bytes per second of the
+	// clones of each GitRepository. Disabled when 0.
+	SourceBandwidthLimit int64
+
+	// githubTokens mints the installation tokens of the GitHub Apps of the
+	// auth secrets.
+	githubTokens githubapp.TokenSource
 }
 
 type GitRepositoryReconcilerOptions struct {
 	MaxConcurrentReconciles   int
 	DependencyRequeueInterval time.Duration
+	// IntervalJitterPercentage is the maximum percentage of the interval
+	// of a source its reconciliations are randomly advanced or delayed by.
+	IntervalJitterPercentage int
 }
 
 func (r *GitRepositoryReconciler) SetupWithManager(mgr ctrl.Manager) error {
@@ -77,7 +117,12 @@ func (r *GitRepositoryReconciler) SetupWithManager(mgr ctrl.Manager) error {
 }
 
 func (r *GitRepositoryReconciler) SetupWithManagerAndOptions(mgr ctrl.Manager, opts GitRepositoryReconcilerOptions) error {
+	if r.APIReader == nil {
+		r.APIReader = mgr.GetAPIReader()
+	}
+
 	r.requeueDependency = opts.DependencyRequeueInterval
+	r.intervalJitter = opts.IntervalJitterPercentage
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&sourcev1.GitRepository{}, builder.WithPredicates(
@@ -116,13 +161,26 @@ func (r *GitRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	// Return early if the object is suspended.
 	if repository.Spec.Suspend {
 		log.Info("Reconciliation is suspended for this object")
+		if repository.Spec.SuspendArtifact == sourcev1.SuspendArtifactWithdraw {
+			return r.withdrawArtifact(ctx, req, repository)
+		}
+		// sign the URLs of the kept artifact again before they expire
+		if requeueAfter := r.Storage.signedURLRequeueAfter(0); requeueAfter > 0 && repository.GetArtifact() != nil {
+			if err := r.updateStatus(ctx, req, repository.Status); err != nil {
+				log.Error(err, "unable to update status")
+				return ctrl.Result{Requeue: true}, err
+			}
+			return ctrl.Result{RequeueAfter: requeueAfter}, nil
+		}
 		return ctrl.Result{}, nil
 	}
 
 	// check dependencies
-	if len(repository.Spec.Include) > 0 {
+	if len(repository.Spec.Include) > 0 || len(repository.Spec.DependsOn) > 0 {
 		if err := r.checkDependencies(repository); err != nil {
 			repository = sourcev1.GitRepositoryNotReady(repository, meta.DependencyNotReadyReason, err.Error())
+			repository.Status.LastFailure = sourceFailure(&repository, err)
+			repository.Status.NextReconcileAt = nextReconcileAt(r.requeueDependency)
 			if err := r.updateStatus(ctx, req, repository.Status); err != nil {
 				log.Error(err, "unable to update status for dependency not ready")
 				return ctrl.Result{Requeue: true}, err
@@ -160,7 +218,9 @@ func (r *GitRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	// record the value of the reconciliation request, if any
 	// TODO(hidde): would be better to defer this in combination with
 	//   always patching the status sub-resource after a reconciliation.
+	newRequest := false
 	if v, ok := meta.ReconcileAnnotationValue(repository.GetAnnotations()); ok {
+		newRequest = v != repository.Status.GetLastHandledReconcileRequest()
 		repository.Status.SetLastHandledReconcileRequest(v)
 	}
 
@@ -170,7 +230,59 @@ func (r *GitRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	}
 
 	// reconcile repository by pulling the latest Git commit
+	ctx, span := tracing.Start(ctx, "reconcile", tracing.ObjectAttributes(sourcev1.GitRepositoryKind, repository.Namespace, repository.Name)...)
 	reconciledRepository, reconcileErr := r.reconcile(ctx, *repository.DeepCopy())
+	tracing.End(span, reconcileErr)
+	// record the failure of the reconciliation in a structured form
+	reconciledRepository.Status.LastFailure = sourceFailure(&reconciledRepository, reconcileErr)
+
+	// check if the artifact has been updated within the stale after duration
+	staleMsg := setArtifactOutdated(&reconciledRepository, reconciledRepository.GetArtifact(), reconciledRepository.Spec.StaleAfter)
+
+	// check if the revision requested by a webhook has been fetched
+	var outdatedMsg string
+	if reconcileErr == nil && !sourcev1.InDryRun(&reconciledRepository) {
+		outdatedMsg = setRevisionOutdated(&reconciledRepository, revisionHint(&reconciledRepository), newRequest,
+			fetchedRevision(repository.GetArtifact(), repository.Status.PendingRevision),
+			fetchedRevision(reconciledRepository.GetArtifact(), reconciledRepository.Status.PendingRevision))
+	}
+
+	// push the artifact to the OCI registry, failures do not affect the readiness
+	if reconcileErr == nil && !sourcev1.InDryRun(&reconciledRepository) {
+		ref, err := publishArtifact(ctx, r.Client, r.Storage, reconciledRepository.Namespace, reconciledRepository.Spec.Publish,
+			reconciledRepository.GetArtifact(), reconciledRepository.Status.PublishedReference)
+		if err != nil {
+			log.Error(err, "unable to publish artifact")
+			r.event(ctx, reconciledRepository, events.EventSeverityError, err.Error())
+		} else {
+			reconciledRepository.Status.PublishedReference = ref
+		}
+	}
+
+	// embed the small artifacts in the Kubernetes API, failures do not affect the readiness
+	if reconcileErr == nil && !sourcev1.InDryRun(&reconciledRepository) {
+		inlined, err := inlineArtifact(ctx, r.Client, r.Scheme, r.Storage, &reconciledRepository, reconciledRepository.Spec.Inline,
+			reconciledRepository.GetArtifact(), reconciledRepository.Status.InlineArtifact)
+		if err != nil {
+			log.Error(err, "unable to embed artifact")
+			r.event(ctx, reconciledRepository, events.EventSeverityError, err.Error())
+		} else {
+			reconciledRepository.Status.InlineArtifact = inlined
+		}
+	}
+
+	// record when the next reconciliation is scheduled, the failures being
+	// retried with an exponential backoff unless rate limited
+	var requeueAfter time.Duration
+	switch {
+	case reconcileErr != nil:
+		if retryAfter := reconciledRepository.Status.RetryAfter; retryAfter != nil {
+			requeueAfter = retryAfter.Duration
+		}
+	case !sourcev1.InDryRun(&reconciledRepository):
+		requeueAfter = r.Storage.signedURLRequeueAfter(windowRequeueAfter(reconciledRepository.Spec.Window, reconciledRepository.Status.PendingRevision, jitterInterval(repository.GetRequeueAfter(), r.intervalJitter)))
+	}
+	reconciledRepository.Status.NextReconcileAt = nextReconcileAt(requeueAfter)
 
 	// update status with the reconciliation result
 	if err := r.updateStatus(ctx, req, reconciledRepository.Status); err != nil {
@@ -178,25 +290,138 @@ func (r *GitRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return ctrl.Result{Requeue: true}, err
 	}
 
+	// emit a warning event once the artifact is outdated
+	if staleMsg != "" {
+		r.event(ctx, reconciledRepository, events.EventSeverityError, staleMsg)
+	}
+
+	// emit a warning event once the requested revision is not fetched
+	if outdatedMsg != "" {
+		r.event(ctx, reconciledRepository, events.EventSeverityError, outdatedMsg)
+	}
+
 	// if reconciliation failed, record the failure and requeue immediately
 	if reconcileErr != nil {
 		r.event(ctx, reconciledRepository, events.EventSeverityError, reconcileErr.Error())
 		r.recordReadiness(ctx, reconciledRepository)
+		// wait for the delay requested by a rate limited upstream instead
+		// of the exponential backoff
+		if retryAfter := reconciledRepository.Status.RetryAfter; retryAfter != nil {
+			log.Error(reconcileErr, fmt.Sprintf("Fetch rate limited by upstream, next run in %s", retryAfter.Duration.String()))
+			return ctrl.Result{RequeueAfter: retryAfter.Duration}, nil
+		}
 		return ctrl.Result{Requeue: true}, reconcileErr
 	}
 
+	// the preview is not updated until the next change or reconcile request
+	if sourcev1.InDryRun(&reconciledRepository) {
+		r.recordReadiness(ctx, reconciledRepository)
+		log.Info(fmt.Sprintf("Preview finished in %s, next run on change or reconcile request",
+			time.Now().Sub(start).String(),
+		))
+		return ctrl.Result{RequeueAfter: r.Storage.signedURLRequeueAfter(0)}, nil
+	}
+
 	// emit revision change event
 	if repository.Status.Artifact == nil || reconciledRepository.Status.Artifact.Revision != repository.Status.Artifact.Revision {
 		r.event(ctx, reconciledRepository, events.EventSeverityInfo, sourcev1.GitRepositoryReadyMessage(reconciledRepository))
 	}
+	if pending := reconciledRepository.Status.PendingRevision; pending != "" && pending != repository.Status.PendingRevision {
+		r.event(ctx, reconciledRepository, events.EventSeverityInfo, sourcev1.GitRepositoryReadyMessage(reconciledRepository))
+	}
 	r.recordReadiness(ctx, reconciledRepository)
+	indexArtifact(r.ArtifactIndex, r.Storage, sourcev1.GitRepositoryKind, reconciledRepository.Namespace, reconciledRepository.Name, reconciledRepository.GetArtifact())
+	recordArtifactRevision(r.OperationsRecorder, sourcev1.GitRepositoryKind, reconciledRepository.Namespace, reconciledRepository.Name, repository.GetArtifact(), reconciledRepository.GetArtifact())
+
+	if requeueAfter == 0 {
+		log.Info(fmt.Sprintf("Reconciliation finished in %s, next run on reconcile request",
+			time.Now().Sub(start).String(),
+		))
+		return ctrl.Result{}, nil
+	}
 
 	log.Info(fmt.Sprintf("Reconciliation finished in %s, next run in %s",
 		time.Now().Sub(start).String(),
-		repository.GetInterval().Duration.String(),
+		requeueAfter.String(),
 	))
 
-	return ctrl.Result{RequeueAfter: repository.GetInterval().Duration}, nil
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// sshProxyFor returns the SOCKS5 proxy URL for the given repository, which is
+// the proxy set in the spec, or the SSHProxy of the reconciler for SSH
+// repositories.
+func (r *GitRepositoryReconciler) sshProxyFor(repository sourcev1.GitRepository) string {
+	if repository.Spec.SSHProxy != "" {
+		return repository.Spec.SSHProxy
+	}
+	if r.SSHProxy != "" && strings.HasPrefix(repository.Spec.URL, "ssh://") {
+		return r.SSHProxy
+	}
+	return ""
+}
+
+// historyRewritePolicy returns the history rewrite policy of the given
+// repository, which is always 'Proceed' for references other than branches.
+func historyRewritePolicy(repository sourcev1.GitRepository) string {
+	if ref := repository.Spec.Reference; ref != nil && (ref.SemVer != "" || ref.Tag != "" || ref.Commit != "") {
+		return sourcev1.ProceedHistoryRewritePolicy
+	}
+	if repository.Spec.HistoryRewritePolicy == "" {
+		return sourcev1.ProceedHistoryRewritePolicy
+	}
+	return repository.Spec.HistoryRewritePolicy
+}
+
+// gitIgnorePatterns returns the ignore patterns of the files of the given
+// repository checked out to the given directory, and their domain.
+func gitIgnorePatterns(repository sourcev1.GitRepository, dir string) ([]gitignore.Pattern, []string, error) {
+	domain := strings.Split(dir, string(filepath.Separator))
+	ps, err := sourceignore.LoadIgnorePatterns(dir, domain)
+	if err != nil {
+		return nil, nil, fmt.Errorf(".sourceignore error: %w", err)
+	}
+	if repository.Spec.Ignore != nil {
+		ps = append(ps, sourceignore.ReadPatterns(strings.NewReader(*repository.Spec.Ignore), domain)...)
+	}
+	return ps, domain, nil
+}
+
+// partialCloneOptions returns the options of the partial clone of the given
+// repository, leaving out the files ignored by its .sourceignore files and
+// spec.ignore, or nil if the partial clone is not enabled.
+func partialCloneOptions(repository sourcev1.GitRepository) *git.PartialCloneOptions {
+	if !repository.Spec.PartialClone {
+		return nil
+	}
+	return &git.PartialCloneOptions{
+		IgnoreFile: sourceignore.IgnoreFile,
+		Filter: func(dir string) (git.PathFilter, error) {
+			ps, domain, err := gitIgnorePatterns(repository, dir)
+			if err != nil {
+				return nil, err
+			}
+			filter := SourceIgnoreFilter(ps, domain)
+			return func(p string) bool {
+				return filter(filepath.Join(dir, filepath.FromSlash(p)), nil)
+			}, nil
+		},
+	}
+}
+
+// previousCommit returns the commit hash of the current artifact of the
+// given repository if it was checked out from the same branch as the given
+// revision, in the '<branch>/<commit>' format.
+func previousCommit(repository sourcev1.GitRepository, revision string) (string, bool) {
+	artifact := repository.GetArtifact()
+	if artifact == nil {
+		return "", false
+	}
+	i, j := strings.LastIndex(artifact.Revision, "/"), strings.LastIndex(revision, "/")
+	if i < 0 || j < 0 || artifact.Revision[:i] != revision[:j] {
+		return "", false
+	}
+	return artifact.Revision[i+1:], true
 }
 
 func (r *GitRepositoryReconciler) checkDependencies(repository sourcev1.GitRepository) error {
@@ -217,10 +442,34 @@ func (r *GitRepositoryReconciler) checkDependencies(repository sourcev1.GitRepos
 		}
 	}
 
-	return nil
+	return checkSourceDependencies(context.Background(), r, repository.Namespace, repository.Spec.DependsOn)
+}
+
+// authMethod returns the git.Auth of the given auth secret, exchanging the
+// credentials of a GitHub App for an installation token authenticating the
+// clone of the given URL.
+func (r *GitRepositoryReconciler) authMethod(ctx context.Context, authStrategy git.AuthSecretStrategy, secret corev1.Secret, repositoryURL string) (*git.Auth, error) {
+	secret, err := r.githubTokens.AuthSecret(ctx, secret, repositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	return authStrategy.Method(secret)
 }
 
 func (r *GitRepositoryReconciler) reconcile(ctx context.Context, repository sourcev1.GitRepository) (sourcev1.GitRepository, error) {
+	// check the endpoints against the policy
+	for _, endpoint := range []string{repository.Spec.URL, repository.Spec.BundleURL} {
+		if endpoint == "" {
+			continue
+		}
+		if err := r.EndpointPolicy.Check(repository.Namespace, endpoint); err != nil {
+			return sourcev1.GitRepositoryNotReady(repository, sourcev1.PolicyViolationReason, err.Error()), err
+		}
+	}
+
+	// clone from the mirror of the URL if rewritten, the spec is left as is
+	checkoutURL := r.URLRewriter.Rewrite(repository.Spec.URL)
+
 	// create tmp dir for the Git clone
 	tmpGit, err := os.MkdirTemp("", repository.Name)
 	if err != nil {
@@ -231,12 +480,15 @@ func (r *GitRepositoryReconciler) reconcile(ctx context.Context, repository sour
 
 	// determine auth method
 	auth := &git.Auth{}
+	var authStrategy git.AuthSecretStrategy
+	var authSecret *corev1.Secret
 	if repository.Spec.SecretRef != nil {
-		authStrategy, err := strategy.AuthSecretStrategyForURL(
-			repository.Spec.URL,
+		authStrategy, err = strategy.AuthSecretStrategyForURL(
+			checkoutURL,
 			git.CheckoutOptions{
 				GitImplementation: repository.Spec.GitImplementation,
 				RecurseSubmodules: repository.Spec.RecurseSubmodules,
+				ArchiveProvider:   repository.Spec.ArchiveProvider,
 			})
 		if err != nil {
 			return sourcev1.GitRepositoryNotReady(repository, sourcev1.AuthenticationFailedReason, err.Error()), err
@@ -254,11 +506,31 @@ func (r *GitRepositoryReconciler) reconcile(ctx context.Context, repository sour
 			return sourcev1.GitRepositoryNotReady(repository, sourcev1.AuthenticationFailedReason, err.Error()), err
 		}
 
-		auth, err = authStrategy.Method(secret)
+		auth, err = r.authMethod(ctx, authStrategy, secret, checkoutURL)
 		if err != nil {
 			err = fmt.Errorf("auth error: %w", err)
 			return sourcev1.GitRepositoryNotReady(repository, sourcev1.AuthenticationFailedReason, err.Error()), err
 		}
+		authSecret = &secret
+	}
+
+	// fetch into the cached repository of the source, which is locked until
+	// the commit objects are no longer used
+	var cacheDir string
+	if repository.Spec.GitImplementation == sourcev1.GoGitImplementation && !repository.Spec.RecurseSubmodules &&
+		repository.Spec.ArchiveProvider == "" {
+		var unlock func()
+		cacheDir, unlock, err = r.GitCache.Lock(repository.Namespace, repository.Name, repository.Spec.URL)
+		if err != nil {
+			err = fmt.Errorf("unable to lock Git cache: %w", err)
+			return sourcev1.GitRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
+		}
+		defer func() {
+			unlock()
+			if err := r.GitCache.Evict(); err != nil {
+				logr.FromContext(ctx).Error(err, "unable to evict Git cache")
+			}
+		}()
 	}
 
 	checkoutStrategy, err := strategy.CheckoutStrategyForRef(
@@ -266,19 +538,90 @@ func (r *GitRepositoryReconciler) reconcile(ctx context.Context, repository sour
 		git.CheckoutOptions{
 			GitImplementation: repository.Spec.GitImplementation,
 			RecurseSubmodules: repository.Spec.RecurseSubmodules,
+			SubmoduleDepth:    repository.Spec.SubmoduleDepth,
+			SubmodulePaths:    repository.Spec.SubmodulePaths,
+			CheckSubmoduleURL: func(u string) error { return r.EndpointPolicy.Check(repository.Namespace, u) },
+			Headers:           httpHeaders(r.HTTPHeaders, repository.Spec.Headers),
+			FullHistory:       historyRewritePolicy(repository) != sourcev1.ProceedHistoryRewritePolicy || hasSignerPolicy(repository),
+			BundleURL:         r.URLRewriter.Rewrite(repository.Spec.BundleURL),
+			CacheDir:          cacheDir,
+			ArchiveProvider:   repository.Spec.ArchiveProvider,
+			PartialClone:      partialCloneOptions(repository),
 		},
 	)
 	if err != nil {
 		return sourcev1.GitRepositoryNotReady(repository, sourcev1.GitOperationFailedReason, err.Error()), err
 	}
 
-	gitCtx, cancel := context.WithTimeout(ctx, repository.Spec.Timeout.Duration)
+	// forward the SSH connections through the SOCKS5 proxy if configured
+	var sshProxy *git.SSHProxy
+	if proxyURL := r.sshProxyFor(repository); proxyURL != "" {
+		sshProxy, err = git.NewSSHProxy(proxyURL, checkoutURL)
+		if err != nil {
+			err = fmt.Errorf("SSH proxy error: %w", err)
+			return sourcev1.GitRepositoryNotReady(repository, sourcev1.GitOperationFailedReason, err.Error()), err
+		}
+		defer sshProxy.Close()
+		checkoutURL = sshProxy.URL()
+		auth = sshProxy.Auth(auth)
+	}
+
+	// the errors are recorded on the reconcile span, the archive span being
+	// a sibling of this one
+	cloneCtx, span := tracing.Start(ctx, "clone")
+	defer span.End()
+
+	// the SSH clones and the libgit2 ones are not throttled
+	gitCtx := throttle.WithLimiters(cloneCtx, r.DownloadLimiter, throttle.NewLimiter(r.SourceBandwidthLimit))
+	gitCtx, cancel := context.WithTimeout(gitCtx, repository.Spec.Timeout.Duration)
 	defer cancel()
 
-	commit, revision, err := checkoutStrategy.Checkout(gitCtx, tmpGit, repository.Spec.URL, auth)
+	fetchDone := r.OperationsRecorder.RecordFetch(sourcev1.GitRepositoryKind)
+	defer fetchDone()
+	commit, revision, err := checkoutStrategy.Checkout(gitCtx, tmpGit, checkoutURL, auth)
+	if errors.Is(err, policy.ErrEndpointNotAllowed) {
+		// a submodule URL is not allowed
+		return sourcev1.GitRepositoryNotReady(repository, sourcev1.PolicyViolationReason, err.Error()), err
+	}
 	if err != nil {
-		return sourcev1.GitRepositoryNotReady(repository, sourcev1.GitOperationFailedReason, err.Error()), err
+		// retry immediately with fresh credentials if the auth secret
+		// has been rotated while cloning, the next attempt minting a new
+		// GitHub App installation token in case it was revoked
+		if authSecret != nil {
+			r.githubTokens.ForgetSecret(*authSecret)
+		}
+		rotated := rotatedSecret(ctx, r.APIReader, authSecret)
+		if rotated == nil {
+			reason := setFetchFailed(&repository, err, sourcev1.GitOperationFailedReason)
+			r.OperationsRecorder.RecordFetchFailure(sourcev1.GitRepositoryKind, reason)
+			repository.Status.RetryAfter = retryAfter(err)
+			return sourcev1.GitRepositoryNotReady(repository, sourcev1.GitOperationFailedReason, err.Error()), err
+		}
+		auth, err = r.authMethod(ctx, authStrategy, *rotated, checkoutURL)
+		if err != nil {
+			err = fmt.Errorf("auth error: %w", err)
+			return sourcev1.GitRepositoryNotReady(repository, sourcev1.AuthenticationFailedReason, err.Error()), err
+		}
+		if sshProxy != nil {
+			auth = sshProxy.Auth(auth)
+		}
+		if err := os.RemoveAll(tmpGit); err != nil {
+			err = fmt.Errorf("tmp dir error: %w", err)
+			return sourcev1.GitRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
+		}
+		commit, revision, err = checkoutStrategy.Checkout(gitCtx, tmpGit, checkoutURL, auth)
+		if err != nil {
+			reason := setFetchFailed(&repository, err, sourcev1.GitOperationFailedReason)
+			r.OperationsRecorder.RecordFetchFailure(sourcev1.GitRepositoryKind, reason)
+			repository.Status.RetryAfter = retryAfter(err)
+			return sourcev1.GitRepositoryNotReady(repository, sourcev1.GitOperationFailedReason, err.Error()), err
+		}
 	}
+	fetchDone()
+	setFetchFailed(&repository, nil, "")
+	repository.Status.RetryAfter = nil
+	span.SetAttributes(tracing.RevisionKey.String(revision))
+	span.End()
 
 	artifact := r.Storage.NewArtifactFor(repository.Kind, repository.GetObjectMeta(), revision, fmt.Sprintf("%s.tar.gz", commit.Hash()))
 
@@ -294,15 +637,35 @@ func (r *GitRepositoryReconciler) reconcile(ctx context.Context, repository sour
 		includedArtifacts = append(includedArtifacts, gr.GetArtifact())
 	}
 
+	repository.Status.Tag = r.gitTag(ctx, repository, commit)
+
 	// return early on unchanged revision and unchanged included repositories
-	if apimeta.IsStatusConditionTrue(repository.Status.Conditions, meta.ReadyCondition) && repository.GetArtifact().HasRevision(artifact.Revision) && !hasArtifactUpdated(repository.Status.IncludedArtifacts, includedArtifacts) {
+	if apimeta.IsStatusConditionTrue(repository.Status.Conditions, meta.ReadyCondition) && repository.GetArtifact().HasRevision(artifact.Revision) && repository.Status.PendingRevision == "" && !hasArtifactUpdated(repository.Status.IncludedArtifacts, includedArtifacts) {
 		if artifact.URL != repository.GetArtifact().URL {
 			r.Storage.SetArtifactURL(repository.GetArtifact())
-			repository.Status.URL = r.Storage.SetHostname(repository.Status.URL)
+			repository.Status.URL = r.Storage.SetLinkURL(*repository.GetArtifact(), repository.Status.URL)
 		}
 		return repository, nil
 	}
 
+	// detect a rewrite of the branch history since the current artifact
+	if policy := historyRewritePolicy(repository); policy != sourcev1.ProceedHistoryRewritePolicy {
+		if previous, ok := previousCommit(repository, artifact.Revision); ok {
+			descendant, err := commit.IsDescendantOf(previous)
+			if err != nil {
+				return sourcev1.GitRepositoryNotReady(repository, sourcev1.GitOperationFailedReason, err.Error()), err
+			}
+			if !descendant {
+				msg := fmt.Sprintf("history rewritten: revision '%s' is not reachable from '%s'", repository.GetArtifact().Revision, artifact.Revision)
+				if policy == sourcev1.FailHistoryRewritePolicy {
+					err := fmt.Errorf("%s, refused by the '%s' history rewrite policy", msg, policy)
+					return sourcev1.GitRepositoryNotReady(repository, sourcev1.HistoryRewrittenReason, err.Error()), err
+				}
+				r.event(ctx, repository, events.EventSeverityError, msg)
+			}
+		}
+	}
+
 	// verify PGP signature
 	if repository.Spec.Verification != nil {
 		publicKeySecret := types.NamespacedName{
@@ -319,13 +682,12 @@ func (r *GitRepositoryReconciler) reconcile(ctx context.Context, repository sour
 		if err != nil {
 			return sourcev1.GitRepositoryNotReady(repository, sourcev1.VerificationFailedReason, err.Error()), err
 		}
-	}
 
-	// create artifact dir
-	err = r.Storage.MkdirAll(artifact)
-	if err != nil {
-		err = fmt.Errorf("mkdir dir error: %w", err)
-		return sourcev1.GitRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
+		if repository.Spec.Verification.SignersRef != nil {
+			if err := r.verifySigners(ctx, repository, commit, secret, artifact.Revision); err != nil {
+				return sourcev1.GitRepositoryNotReady(repository, sourcev1.VerificationFailedReason, err.Error()), err
+			}
+		}
 	}
 
 	for i, incl := range repository.Spec.Include {
@@ -339,6 +701,45 @@ func (r *GitRepositoryReconciler) reconcile(ctx context.Context, repository sour
 		}
 	}
 
+	if repository.Spec.IncludeMetadata {
+		if err := writeGitMetadata(tmpGit, repository, commit, artifact.Revision); err != nil {
+			return sourcev1.GitRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
+		}
+	}
+
+	// load the ignore patterns
+	ps, ignoreDomain, err := gitIgnorePatterns(repository, tmpGit)
+	if err != nil {
+		return sourcev1.GitRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	// preview the artifact instead of writing it in dry-run
+	if sourcev1.InDryRun(&repository) {
+		filter := EncryptedFileFilter(SourceIgnoreFilter(ps, ignoreDomain), repository.Spec.EncryptedFilesPolicy, &artifact)
+		preview, err := r.Storage.previewDir(tmpGit, filter, artifact.Revision)
+		if err != nil {
+			err = fmt.Errorf("preview error: %w", err)
+			return sourcev1.GitRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
+		}
+		return sourcev1.GitRepositoryPreviewed(repository, preview), nil
+	}
+
+	// hold the new revision back until the window opens
+	opensAt, err := holdRevision(repository.Spec.Window, repository.GetArtifact(), artifact.Revision)
+	if err != nil {
+		return sourcev1.GitRepositoryNotReady(repository, sourcev1.WindowInvalidReason, err.Error()), err
+	}
+	if !opensAt.IsZero() {
+		return sourcev1.GitRepositoryPending(repository, artifact.Revision, pendingMessage(artifact.Revision, opensAt)), nil
+	}
+
+	// create artifact dir
+	err = r.Storage.MkdirAll(artifact)
+	if err != nil {
+		err = fmt.Errorf("mkdir dir error: %w", err)
+		return sourcev1.GitRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
 	// acquire lock
 	unlock, err := r.Storage.Lock(artifact)
 	if err != nil {
@@ -348,22 +749,26 @@ func (r *GitRepositoryReconciler) reconcile(ctx context.Context, repository sour
 	defer unlock()
 
 	// archive artifact and check integrity
-	ignoreDomain := strings.Split(tmpGit, string(filepath.Separator))
-	ps, err := sourceignore.LoadIgnorePatterns(tmpGit, ignoreDomain)
-	if err != nil {
-		err = fmt.Errorf(".sourceignore error: %w", err)
-		return sourcev1.GitRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
+	_, span = tracing.Start(ctx, "archive")
+	filter := EncryptedFileFilter(SourceIgnoreFilter(ps, ignoreDomain), repository.Spec.EncryptedFilesPolicy, &artifact)
+	if repository.Spec.IncludeChecksums {
+		err = r.Storage.writeChecksumManifest(tmpGit, filter)
 	}
-	if repository.Spec.Ignore != nil {
-		ps = append(ps, sourceignore.ReadPatterns(strings.NewReader(*repository.Spec.Ignore), ignoreDomain)...)
+	if err == nil {
+		err = r.Storage.Archive(&artifact, tmpGit, filter)
 	}
-	if err := r.Storage.Archive(&artifact, tmpGit, SourceIgnoreFilter(ps, ignoreDomain)); err != nil {
+	tracing.End(span, err)
+	if err != nil {
 		err = fmt.Errorf("storage archive error: %w", err)
 		return sourcev1.GitRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
 	}
+	if err := r.Storage.WriteSBOM(&artifact); err != nil {
+		err = fmt.Errorf("storage SBOM error: %w", err)
+		return sourcev1.GitRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
 
 	// update latest symlink
-	url, err := r.Storage.Symlink(artifact, "latest.tar.gz")
+	url, err := r.Storage.LatestSymlink(artifact)
 	if err != nil {
 		err = fmt.Errorf("storage symlink error: %w", err)
 		return sourcev1.GitRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
@@ -380,9 +785,16 @@ func (r *GitRepositoryReconciler) reconcileDelete(ctx context.Context, repositor
 		// Return the error so we retry the failed garbage collection
 		return ctrl.Result{}, err
 	}
+	if err := r.GitCache.Remove(repository.Namespace, repository.Name); err != nil {
+		r.event(ctx, repository, events.EventSeverityError,
+			fmt.Sprintf("Git cache removal for deleted resource failed: %s", err.Error()))
+		return ctrl.Result{}, err
+	}
 
 	// Record deleted status
 	r.recordReadiness(ctx, repository)
+	unindexArtifact(r.ArtifactIndex, sourcev1.GitRepositoryKind, repository.Namespace, repository.Name)
+	r.OperationsRecorder.DeleteArtifactRevision(sourcev1.GitRepositoryKind, repository.Namespace, repository.Name)
 
 	// Remove our finalizer from the list and update it
 	controllerutil.RemoveFinalizer(&repository, sourcev1.SourceFinalizer)
@@ -394,6 +806,29 @@ func (r *GitRepositoryReconciler) reconcileDelete(ctx context.Context, repositor
 	return ctrl.Result{}, nil
 }
 
+// withdrawArtifact removes the artifacts of the given suspended GitRepository
+// from the storage and its status, for the consumers to stop receiving them.
+func (r *GitRepositoryReconciler) withdrawArtifact(ctx context.Context, req ctrl.Request, repository sourcev1.GitRepository) (ctrl.Result, error) {
+	if artifactWithdrawn(&repository, repository.Status.ObservedGeneration) {
+		return ctrl.Result{}, nil
+	}
+	if err := withdrawArtifacts(ctx, r.Client, r.Scheme, r.Storage, sourcev1.GitRepositoryKind, &repository, repository.Status.InlineArtifact); err != nil {
+		r.event(ctx, repository, events.EventSeverityError, err.Error())
+		return ctrl.Result{Requeue: true}, err
+	}
+	unindexArtifact(r.ArtifactIndex, sourcev1.GitRepositoryKind, repository.Namespace, repository.Name)
+	r.OperationsRecorder.DeleteArtifactRevision(sourcev1.GitRepositoryKind, repository.Namespace, repository.Name)
+
+	repository = sourcev1.GitRepositoryWithdrawn(repository)
+	if err := r.updateStatus(ctx, req, repository.Status); err != nil {
+		logr.FromContext(ctx).Error(err, "unable to update status")
+		return ctrl.Result{Requeue: true}, err
+	}
+	r.event(ctx, repository, events.EventSeverityInfo, withdrawnMessage)
+	r.recordReadiness(ctx, repository)
+	return ctrl.Result{}, nil
+}
+
 // resetStatus returns a modified v1beta1.GitRepository and a boolean indicating
 // if the status field has been reset.
 func (r *GitRepositoryReconciler) resetStatus(repository sourcev1.GitRepository) (sourcev1.GitRepository, bool) {
@@ -413,7 +848,10 @@ func (r *GitRepositoryReconciler) resetStatus(repository sourcev1.GitRepository)
 // It removes all but the current artifact except for when the
 // deletion timestamp is set, which will result in the removal of
 // all artifacts for the resource.
-func (r *GitRepositoryReconciler) gc(repository sourcev1.GitRepository) error {
+func (r *GitRepositoryReconciler) gc(repository sourcev1.GitRepository) (err error) {
+	defer func() {
+		r.OperationsRecorder.RecordGC(sourcev1.GitRepositoryKind, err)
+	}()
 	if !repository.DeletionTimestamp.IsZero() {
 		return r.Storage.RemoveAll(r.Storage.NewArtifactFor(repository.Kind, repository.GetObjectMeta(), "", "*"))
 	}
@@ -425,6 +863,10 @@ func (r *GitRepositoryReconciler) gc(repository sourcev1.GitRepository) error {
 
 // event emits a Kubernetes event and forwards the event to notification controller if configured
 func (r *GitRepositoryReconciler) event(ctx context.Context, repository sourcev1.GitRepository, severity, msg string) {
+	if !r.EventLimiter.Allow(sourcev1.GitRepositoryKind+"/"+repository.Namespace+"/"+repository.Name, severity, msg) {
+		return
+	}
+
 	log := logr.FromContext(ctx)
 
 	if r.EventRecorder != nil {
@@ -491,6 +933,8 @@ func (r *GitRepositoryReconciler) updateStatus(ctx context.Context, req ctrl.Req
 
 	patch := client.MergeFrom(repository.DeepCopy())
 	repository.Status = newStatus
+	repository.Status.URL = r.Storage.resignURLs(repository.Status.URL,
+		append([]*sourcev1.Artifact{repository.Status.Artifact}, repository.Status.IncludedArtifacts...)...)
 
 	return r.Status().Patch(ctx, &repository, patch)
 }
@@ -45,6 +45,7 @@ import (
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 
@@ -288,6 +289,110 @@ var _ = Describe("GitRepositoryReconciler", func() {
 			}),
 		)
 
+		type requeueTestCase struct {
+			interval         time.Duration
+			pushOnly         bool
+			fallbackInterval *metav1.Duration
+
+			expectRequeueAfter time.Duration
+		}
+
+		DescribeTable("Git requeue interval tests", func(t requeueTestCase) {
+			err = gitServer.StartHTTP()
+			defer gitServer.StopHTTP()
+			Expect(err).NotTo(HaveOccurred())
+
+			u, err := url.Parse(gitServer.HTTPAddress())
+			Expect(err).NotTo(HaveOccurred())
+			u.Path = path.Join(u.Path, fmt.Sprintf("repository-%s.git", randStringRunes(5)))
+
+			fs := memfs.New()
+			gitrepo, err := git.Init(memory.NewStorage(), fs)
+			Expect(err).NotTo(HaveOccurred())
+
+			wt, err := gitrepo.Worktree()
+			Expect(err).NotTo(HaveOccurred())
+
+			ff, _ := fs.Create("fixture")
+			_ = ff.Close()
+			_, err = wt.Add(fs.Join("fixture"))
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = wt.Commit("Sample", &git.CommitOptions{Author: &object.Signature{
+				Name:  "John Doe",
+				Email: "john@example.com",
+				When:  time.Now(),
+			}})
+			Expect(err).NotTo(HaveOccurred())
+
+			remote, err := gitrepo.CreateRemote(&config.RemoteConfig{
+				Name: "origin",
+				URLs: []string{u.String()},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = remote.Push(&git.PushOptions{
+				RefSpecs: []config.RefSpec{"refs/heads/*:refs/heads/*"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			key := types.NamespacedName{
+				Name:      fmt.Sprintf("git-requeue-test-%s", randStringRunes(5)),
+				Namespace: namespace.Name,
+			}
+			created := &sourcev1.GitRepository{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      key.Name,
+					Namespace: key.Namespace,
+				},
+				Spec: sourcev1.GitRepositorySpec{
+					URL:              u.String(),
+					Interval:         metav1.Duration{Duration: t.interval},
+					PushOnly:         t.pushOnly,
+					FallbackInterval: t.fallbackInterval,
+					Reference:        &sourcev1.GitRepositoryRef{Branch: "master"},
+				},
+			}
+			Expect(created.GetRequeueAfter()).To(Equal(t.expectRequeueAfter))
+			Expect(k8sClient.Create(context.Background(), created)).Should(Succeed())
+			defer k8sClient.Delete(context.Background(), created)
+
+			got := &sourcev1.GitRepository{}
+			Eventually(func() bool {
+				_ = k8sClient.Get(context.Background(), key, got)
+				return apimeta.IsStatusConditionTrue(got.Status.Conditions, meta.ReadyCondition)
+			}, timeout, interval).Should(BeTrue())
+
+			// the next reconciliation is only scheduled if there is an
+			// interval to check the repository at
+			if t.expectRequeueAfter == 0 {
+				Expect(got.Status.NextReconcileAt).To(BeNil())
+				return
+			}
+			Expect(got.Status.NextReconcileAt).NotTo(BeNil())
+			Expect(got.Status.NextReconcileAt.Time).To(BeTemporally("~", time.Now().Add(t.expectRequeueAfter), t.expectRequeueAfter/2))
+		},
+			Entry("interval", requeueTestCase{
+				interval:           time.Hour,
+				expectRequeueAfter: time.Hour,
+			}),
+			Entry("push-only without fallback interval", requeueTestCase{
+				interval: time.Hour,
+				pushOnly: true,
+			}),
+			Entry("push-only with fallback interval", requeueTestCase{
+				interval:           time.Hour,
+				pushOnly:           true,
+				fallbackInterval:   &metav1.Duration{Duration: 2 * time.Hour},
+				expectRequeueAfter: 2 * time.Hour,
+			}),
+			Entry("fallback interval ignored without push-only", requeueTestCase{
+				interval:           time.Hour,
+				fallbackInterval:   &metav1.Duration{Duration: 2 * time.Hour},
+				expectRequeueAfter: time.Hour,
+			}),
+		)
+
 		DescribeTable("Git self signed cert tests", func(t refTestCase) {
 			err = gitServer.StartHTTPS(examplePublicKey, examplePrivateKey, exampleCA, "example.com")
 			defer gitServer.StopHTTP()
@@ -0,0 +1,59 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"net/http"
+
+	helmgetter "helm.sh/helm/v3/pkg/getter"
+
+	"github.com/fluxcd/source-controller/pkg/helm/getter"
+)
+
+// httpHeaders returns the given default headers of the reconciler, overridden
+// by the headers set in the spec of a source, or nil if there are none.
+func httpHeaders(defaults, headers map[string]string) http.Header {
+	if len(defaults) == 0 && len(headers) == 0 {
+		return nil
+	}
+	h := make(http.Header, len(defaults)+len(headers))
+	for k, v := range defaults {
+		h.Set(k, v)
+	}
+	for k, v := range headers {
+		h.Set(k, v)
+	}
+	return h
+}
+
+// helmGetters returns the given getter providers, the HTTP/S getters of which
+// send the given default headers of the reconciler, overridden by the headers
+// set in the spec of a HelmRepository.
+func helmGetters(providers helmgetter.Providers, defaults, headers map[string]string) helmgetter.Providers {
+	h := httpHeaders(defaults, headers)
+	if h == nil {
+		return providers
+	}
+	withHeaders := make(helmgetter.Providers, 0, len(providers))
+	for _, p := range providers {
+		withHeaders = append(withHeaders, helmgetter.Provider{
+			Schemes: p.Schemes,
+			New:     getter.WithHeaders(p.New, h),
+		})
+	}
+	return withHeaders
+}
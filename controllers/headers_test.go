@@ -0,0 +1,89 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	helmgetter "helm.sh/helm/v3/pkg/getter"
+
+	"github.com/fluxcd/source-controller/pkg/helm/getter"
+)
+
+func Test_httpHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults map[string]string
+		headers  map[string]string
+		want     http.Header
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:     "defaults",
+			defaults: map[string]string{"x-cluster": "prod-eu"},
+			want:     http.Header{"X-Cluster": []string{"prod-eu"}},
+		},
+		{
+			name:     "spec overrides defaults",
+			defaults: map[string]string{"User-Agent": "flux", "X-Cluster": "prod-eu"},
+			headers:  map[string]string{"user-agent": "flux/podinfo", "X-Trace-Id": "1234"},
+			want: http.Header{
+				"User-Agent": []string{"flux/podinfo"},
+				"X-Cluster":  []string{"prod-eu"},
+				"X-Trace-Id": []string{"1234"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := httpHeaders(tt.defaults, tt.headers); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("httpHeaders() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_helmGetters(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer server.Close()
+
+	providers := helmgetter.Providers{helmgetter.Provider{
+		Schemes: []string{"http", "https"},
+		New:     getter.NewHTTPGetter,
+	}}
+	g, err := helmGetters(providers, map[string]string{"X-Cluster": "prod-eu", "User-Agent": "flux"},
+		map[string]string{"X-Trace-Id": "1234"}).ByScheme("http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Get(server.URL); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{"X-Cluster": "prod-eu", "User-Agent": "flux", "X-Trace-Id": "1234"} {
+		if got.Get(k) != v {
+			t.Errorf("header %s = %q, want %q", k, got.Get(k), v)
+		}
+	}
+}
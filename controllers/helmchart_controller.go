@@ -17,7 +17,9 @@ limitations under the License.
 package controllers
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/url"
@@ -32,7 +34,8 @@ import (
 	helmchart "helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/chartutil"
-	"helm.sh/helm/v3/pkg/getter"
+	helmgetter "helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/repo"
 	corev1 "k8s.io/api/core/v1"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -59,7 +62,16 @@ import (
 	"github.com/fluxcd/pkg/untar"
 
 	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"github.com/fluxcd/source-controller/internal/eventlimit"
 	"github.com/fluxcd/source-controller/internal/helm"
+	"github.com/fluxcd/source-controller/internal/index"
+	sourcemetrics "github.com/fluxcd/source-controller/internal/metrics"
+	"github.com/fluxcd/source-controller/internal/policy"
+	"github.com/fluxcd/source-controller/internal/rewrite"
+	"github.com/fluxcd/source-controller/internal/spiffe"
+	"github.com/fluxcd/source-controller/internal/tracing"
+	"github.com/fluxcd/source-controller/pkg/helm/getter"
+	"github.com/fluxcd/source-controller/pkg/retry"
 )
 
 // +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=helmcharts,verbs=get;list;watch;create;update;patch;delete
@@ -67,15 +79,42 @@ import (
 // +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=helmcharts/finalizers,verbs=get;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
+// chartDigestSeparator separates the version of a HelmChart from the SHA-256
+// digest of the chart package it is pinned to.
+const chartDigestSeparator = "@sha256:"
+
 // HelmChartReconciler reconciles a HelmChart object
 type HelmChartReconciler struct {
 	client.Client
+	APIReader             client.Reader
+	requeueDependency     time.Duration
+	intervalJitter        int
 	Scheme                *runtime.Scheme
 	Storage               *Storage
-	Getters               getter.Providers
+	Getters               helmgetter.Providers
 	EventRecorder         kuberecorder.EventRecorder
 	ExternalEventRecorder *events.Recorder
 	MetricsRecorder       *metrics.Recorder
+	OperationsRecorder    *sourcemetrics.Recorder
+	ArtifactIndex         *index.Index
+	EndpointPolicy        *policy.Policy
+	URLRewriter           *rewrite.Rewriter
+	EventLimiter          *eventlimit.Limiter
+	ClientIdentity        *spiffe.X509SVIDSource
+
+	// HTTPHeaders are the headers sent with the requests to the Helm
+	// repositories, unless overridden in their spec.
+	HTTPHeaders map[string]string
+	// DownloadRetry retries the downloads of the charts which fail with a
+	// transient error. Disabled when nil.
+	DownloadRetry *retry.Policy
+	// IndexLimits bounds the size and the number of chart versions of the
+	// indexes of the Helm repositories.
+	IndexLimits helm.IndexLimits
+
+	// NoCrossNamespaceRefs refuses the references to the sources in other
+	// namespaces than the one of the HelmChart.
+	NoCrossNamespaceRefs bool
 }
 
 func (r *HelmChartReconciler) SetupWithManager(mgr ctrl.Manager) error {
@@ -83,6 +122,13 @@ func (r *HelmChartReconciler) SetupWithManager(mgr ctrl.Manager) error {
 }
 
 func (r *HelmChartReconciler) SetupWithManagerAndOptions(mgr ctrl.Manager, opts HelmChartReconcilerOptions) error {
+	if r.APIReader == nil {
+		r.APIReader = mgr.GetAPIReader()
+	}
+
+	r.requeueDependency = opts.DependencyRequeueInterval
+	r.intervalJitter = opts.IntervalJitterPercentage
+
 	if err := mgr.GetCache().IndexField(context.TODO(), &sourcev1.HelmRepository{}, sourcev1.HelmRepositoryURLIndexKey,
 		r.indexHelmRepositoryByURL); err != nil {
 		return fmt.Errorf("failed setting index fields: %w", err)
@@ -144,9 +190,41 @@ func (r *HelmChartReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	// Return early if the object is suspended.
 	if chart.Spec.Suspend {
 		log.Info("Reconciliation is suspended for this object")
+		if chart.Spec.SuspendArtifact == sourcev1.SuspendArtifactWithdraw {
+			return r.withdrawArtifact(ctx, req, chart)
+		}
+		// sign the URLs of the kept artifact again before they expire
+		if requeueAfter := r.Storage.signedURLRequeueAfter(0); requeueAfter > 0 && chart.GetArtifact() != nil {
+			if err := r.updateStatus(ctx, req, chart.Status); err != nil {
+				log.Error(err, "unable to update status")
+				return ctrl.Result{Requeue: true}, err
+			}
+			return ctrl.Result{RequeueAfter: requeueAfter}, nil
+		}
 		return ctrl.Result{}, nil
 	}
 
+	// check dependencies
+	if len(chart.Spec.DependsOn) > 0 {
+		if err := checkSourceDependencies(ctx, r, chart.Namespace, chart.Spec.DependsOn); err != nil {
+			chart = sourcev1.HelmChartNotReady(chart, meta.DependencyNotReadyReason, err.Error())
+			chart.Status.LastFailure = sourceFailure(&chart, err)
+			chart.Status.NextReconcileAt = nextReconcileAt(r.requeueDependency)
+			if err := r.updateStatus(ctx, req, chart.Status); err != nil {
+				log.Error(err, "unable to update status for dependency not ready")
+				return ctrl.Result{Requeue: true}, err
+			}
+			// we can't rely on exponential backoff because it will prolong the execution too much,
+			// instead we requeue on a fix interval.
+			msg := fmt.Sprintf("Dependencies do not meet ready condition, retrying in %s", r.requeueDependency.String())
+			log.Info(msg)
+			r.event(ctx, chart, events.EventSeverityInfo, msg)
+			r.recordReadiness(ctx, chart)
+			return ctrl.Result{RequeueAfter: r.requeueDependency}, nil
+		}
+		log.Info("All dependencies are ready, proceeding with reconciliation")
+	}
+
 	// Record reconciliation duration
 	if r.MetricsRecorder != nil {
 		objRef, err := reference.GetReference(r.Scheme, &chart)
@@ -179,32 +257,56 @@ func (r *HelmChartReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		log.Error(err, "unable to purge old artifacts")
 	}
 
-	// Retrieve the source
-	source, err := r.getSource(ctx, chart)
-	if err != nil {
-		chart = sourcev1.HelmChartNotReady(*chart.DeepCopy(), sourcev1.ChartPullFailedReason, err.Error())
-		if err := r.updateStatus(ctx, req, chart.Status); err != nil {
-			log.Error(err, "unable to update status")
+	// Retrieve the source, unless the chart is referenced by URL
+	var source sourcev1.Source
+	if chart.Spec.ChartRef == nil {
+		if r.NoCrossNamespaceRefs && chart.GetSourceNamespace() != chart.Namespace {
+			err := fmt.Errorf("cross-namespace reference to source %s '%s/%s' is not allowed",
+				chart.Spec.SourceRef.Kind, chart.GetSourceNamespace(), chart.Spec.SourceRef.Name)
+			chart = sourcev1.HelmChartNotReady(*chart.DeepCopy(), sourcev1.AccessDeniedReason, err.Error())
+			chart.Status.LastFailure = sourceFailure(&chart, err)
+			if err := r.updateStatus(ctx, req, chart.Status); err != nil {
+				log.Error(err, "unable to update status")
+				return ctrl.Result{Requeue: true}, err
+			}
+			r.event(ctx, chart, events.EventSeverityError, err.Error())
+			r.recordReadiness(ctx, chart)
+			// Do not requeue as there is no chance on recovery.
+			return ctrl.Result{Requeue: false}, nil
 		}
-		return ctrl.Result{Requeue: true}, err
-	}
 
-	// Assert source is ready
-	if source.GetArtifact() == nil {
-		err = fmt.Errorf("no artifact found for source `%s` kind '%s'",
-			chart.Spec.SourceRef.Name, chart.Spec.SourceRef.Kind)
-		chart = sourcev1.HelmChartNotReady(*chart.DeepCopy(), sourcev1.ChartPullFailedReason, err.Error())
-		if err := r.updateStatus(ctx, req, chart.Status); err != nil {
-			log.Error(err, "unable to update status")
+		var err error
+		source, err = r.getSource(ctx, chart)
+		if err != nil {
+			chart = sourcev1.HelmChartNotReady(*chart.DeepCopy(), sourcev1.ChartPullFailedReason, err.Error())
+			chart.Status.LastFailure = sourceFailure(&chart, err)
+			if err := r.updateStatus(ctx, req, chart.Status); err != nil {
+				log.Error(err, "unable to update status")
+			}
+			return ctrl.Result{Requeue: true}, err
+		}
+
+		// Assert source is ready
+		if source.GetArtifact() == nil {
+			err = fmt.Errorf("no artifact found for source `%s` kind '%s'",
+				chart.Spec.SourceRef.Name, chart.Spec.SourceRef.Kind)
+			chart = sourcev1.HelmChartNotReady(*chart.DeepCopy(), sourcev1.ChartPullFailedReason, err.Error())
+			chart.Status.LastFailure = sourceFailure(&chart, err)
+			if err := r.updateStatus(ctx, req, chart.Status); err != nil {
+				log.Error(err, "unable to update status")
+			}
+			r.recordReadiness(ctx, chart)
+			return ctrl.Result{Requeue: true}, err
 		}
-		r.recordReadiness(ctx, chart)
-		return ctrl.Result{Requeue: true}, err
 	}
 
 	// Perform the reconciliation for the chart source type
 	var reconciledChart sourcev1.HelmChart
 	var reconcileErr error
+	ctx, span := tracing.Start(ctx, "reconcile", tracing.ObjectAttributes(sourcev1.HelmChartKind, chart.Namespace, chart.Name)...)
 	switch typedSource := source.(type) {
+	case nil:
+		reconciledChart, reconcileErr = r.reconcileFromURL(ctx, *chart.DeepCopy(), changed)
 	case *sourcev1.HelmRepository:
 		// TODO: move this to a validation webhook once the discussion around
 		//  certificates has settled: https://github.com/fluxcd/image-reflector-controller/issues/69
@@ -218,17 +320,60 @@ func (r *HelmChartReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 			}
 			r.event(ctx, reconciledChart, events.EventSeverityError, err.Error())
 			r.recordReadiness(ctx, reconciledChart)
+			tracing.End(span, err)
 			// Do not requeue as there is no chance on recovery.
 			return ctrl.Result{Requeue: false}, nil
 		}
 		reconciledChart, reconcileErr = r.reconcileFromHelmRepository(ctx, *typedSource, *chart.DeepCopy(), changed)
 	case *sourcev1.GitRepository, *sourcev1.Bucket:
-		reconciledChart, reconcileErr = r.reconcileFromTarballArtifact(ctx, *typedSource.GetArtifact(),
-			*chart.DeepCopy(), changed)
+		reconciledChart, reconcileErr = r.reconcileFromTarballArtifact(ctx, typedSource, *chart.DeepCopy(), changed)
 	default:
 		err := fmt.Errorf("unable to reconcile unsupported source reference kind '%s'", chart.Spec.SourceRef.Kind)
+		tracing.End(span, err)
 		return ctrl.Result{Requeue: false}, err
 	}
+	tracing.End(span, reconcileErr)
+
+	// Record the failure of the reconciliation in a structured form
+	reconciledChart.Status.LastFailure = sourceFailure(&reconciledChart, reconcileErr)
+
+	// Keep the previous artifact in the history if it was replaced
+	r.updateHistory(chart.GetArtifact(), &reconciledChart)
+
+	// Check if the artifact has been updated within the stale after duration
+	staleMsg := setArtifactOutdated(&reconciledChart, reconciledChart.GetArtifact(), reconciledChart.Spec.StaleAfter)
+
+	// Push the artifact to the OCI registry, failures do not affect the readiness
+	if reconcileErr == nil {
+		ref, err := publishArtifact(ctx, r.Client, r.Storage, reconciledChart.Namespace, reconciledChart.Spec.Publish,
+			reconciledChart.GetArtifact(), reconciledChart.Status.PublishedReference)
+		if err != nil {
+			log.Error(err, "unable to publish artifact")
+			r.event(ctx, reconciledChart, events.EventSeverityError, err.Error())
+		} else {
+			reconciledChart.Status.PublishedReference = ref
+		}
+	}
+
+	// Embed the small artifacts in the Kubernetes API, failures do not affect the readiness
+	if reconcileErr == nil {
+		inlined, err := inlineArtifact(ctx, r.Client, r.Scheme, r.Storage, &reconciledChart, reconciledChart.Spec.Inline,
+			reconciledChart.GetArtifact(), reconciledChart.Status.InlineArtifact)
+		if err != nil {
+			log.Error(err, "unable to embed artifact")
+			r.event(ctx, reconciledChart, events.EventSeverityError, err.Error())
+		} else {
+			reconciledChart.Status.InlineArtifact = inlined
+		}
+	}
+
+	// Record when the next reconciliation is scheduled, the failures being
+	// retried with an exponential backoff
+	var requeueAfter time.Duration
+	if reconcileErr == nil {
+		requeueAfter = r.Storage.signedURLRequeueAfter(windowRequeueAfter(reconciledChart.Spec.Window, reconciledChart.Status.PendingRevision, jitterInterval(chart.GetInterval().Duration, r.intervalJitter)))
+	}
+	reconciledChart.Status.NextReconcileAt = nextReconcileAt(requeueAfter)
 
 	// Update status with the reconciliation result
 	if err := r.updateStatus(ctx, req, reconciledChart.Status); err != nil {
@@ -236,6 +381,11 @@ func (r *HelmChartReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{Requeue: true}, err
 	}
 
+	// Emit a warning event once the artifact is outdated
+	if staleMsg != "" {
+		r.event(ctx, reconciledChart, events.EventSeverityError, staleMsg)
+	}
+
 	// If reconciliation failed, record the failure and requeue immediately
 	if reconcileErr != nil {
 		r.event(ctx, reconciledChart, events.EventSeverityError, reconcileErr.Error())
@@ -247,24 +397,38 @@ func (r *HelmChartReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	if (chart.GetArtifact() == nil && reconciledChart.GetArtifact() != nil) ||
 		(chart.GetArtifact() != nil && reconciledChart.GetArtifact() != nil && reconciledChart.GetArtifact().Revision != chart.GetArtifact().Revision) {
 		r.event(ctx, reconciledChart, events.EventSeverityInfo, sourcev1.HelmChartReadyMessage(reconciledChart))
+		// audit the use of the sources of other namespaces
+		if source != nil && chart.GetSourceNamespace() != chart.Namespace {
+			r.event(ctx, reconciledChart, events.EventSeverityInfo, fmt.Sprintf("Revision %s produced from cross-namespace source %s '%s/%s'",
+				reconciledChart.GetArtifact().Revision, chart.Spec.SourceRef.Kind, chart.GetSourceNamespace(), chart.Spec.SourceRef.Name))
+		}
+	}
+	if pending := reconciledChart.Status.PendingRevision; pending != "" && pending != chart.Status.PendingRevision {
+		r.event(ctx, reconciledChart, events.EventSeverityInfo, sourcev1.HelmChartReadyMessage(reconciledChart))
 	}
 	r.recordReadiness(ctx, reconciledChart)
+	indexArtifact(r.ArtifactIndex, r.Storage, sourcev1.HelmChartKind, reconciledChart.Namespace, reconciledChart.Name, reconciledChart.GetArtifact())
+	recordArtifactRevision(r.OperationsRecorder, sourcev1.HelmChartKind, reconciledChart.Namespace, reconciledChart.Name, chart.GetArtifact(), reconciledChart.GetArtifact())
 
 	log.Info(fmt.Sprintf("Reconciliation finished in %s, next run in %s",
 		time.Now().Sub(start).String(),
-		chart.GetInterval().Duration.String(),
+		requeueAfter.String(),
 	))
-	return ctrl.Result{RequeueAfter: chart.GetInterval().Duration}, nil
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
 }
 
 type HelmChartReconcilerOptions struct {
-	MaxConcurrentReconciles int
+	MaxConcurrentReconciles   int
+	DependencyRequeueInterval time.Duration
+	// IntervalJitterPercentage is the maximum percentage of the interval
+	// of a source its reconciliations are randomly advanced or delayed by.
+	IntervalJitterPercentage int
 }
 
 func (r *HelmChartReconciler) getSource(ctx context.Context, chart sourcev1.HelmChart) (sourcev1.Source, error) {
 	var source sourcev1.Source
 	namespacedName := types.NamespacedName{
-		Namespace: chart.GetNamespace(),
+		Namespace: chart.GetSourceNamespace(),
 		Name:      chart.Spec.SourceRef.Name,
 	}
 	switch chart.Spec.SourceRef.Kind {
@@ -298,16 +462,21 @@ func (r *HelmChartReconciler) getSource(ctx context.Context, chart sourcev1.Helm
 
 func (r *HelmChartReconciler) reconcileFromHelmRepository(ctx context.Context,
 	repository sourcev1.HelmRepository, chart sourcev1.HelmChart, force bool) (sourcev1.HelmChart, error) {
-	// Configure ChartRepository getter options
-	clientOpts := []getter.Option{
-		getter.WithURL(repository.Spec.URL),
-		getter.WithTimeout(repository.Spec.Timeout.Duration),
-		getter.WithPassCredentialsAll(repository.Spec.PassCredentials),
-	}
-	if secret, err := r.getHelmRepositorySecret(ctx, &repository); err != nil {
+	// Configure ChartRepository getter options, downloading from the
+	// mirror of the URL if rewritten
+	repositoryURL := r.URLRewriter.Rewrite(repository.Spec.URL)
+	clientOpts := []helmgetter.Option{
+		helmgetter.WithURL(repositoryURL),
+		helmgetter.WithTimeout(repository.Spec.Timeout.Duration),
+		helmgetter.WithPassCredentialsAll(repository.Spec.PassCredentials),
+	}
+	secret, err := r.getHelmRepositorySecret(ctx, &repository)
+	if err != nil {
 		return sourcev1.HelmChartNotReady(chart, sourcev1.AuthenticationFailedReason, err.Error()), err
-	} else if secret != nil {
-		opts, cleanup, err := helm.ClientOptionsFromSecret(*secret)
+	}
+	clientOpts = append(clientOpts, clientIdentityOptions(r.ClientIdentity, secret)...)
+	if secret != nil {
+		opts, cleanup, err := getter.ClientOptionsFromSecret(*secret)
 		if err != nil {
 			err = fmt.Errorf("auth options error: %w", err)
 			return sourcev1.HelmChartNotReady(chart, sourcev1.AuthenticationFailedReason, err.Error()), err
@@ -317,7 +486,7 @@ func (r *HelmChartReconciler) reconcileFromHelmRepository(ctx context.Context,
 	}
 
 	// Initialize the chart repository and load the index file
-	chartRepo, err := helm.NewChartRepository(repository.Spec.URL, r.Getters, clientOpts)
+	chartRepo, err := helm.NewChartRepository(repositoryURL, helmGetters(r.Getters, r.HTTPHeaders, repository.Spec.Headers), clientOpts)
 	if err != nil {
 		switch err.(type) {
 		case *url.Error:
@@ -326,6 +495,10 @@ func (r *HelmChartReconciler) reconcileFromHelmRepository(ctx context.Context,
 			return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), err
 		}
 	}
+	chartRepo.RewriteURL = r.URLRewriter.Rewrite
+	chartRepo.CheckURL = func(u string) error { return r.EndpointPolicy.Check(chart.Namespace, u) }
+	chartRepo.Retry = r.DownloadRetry
+	chartRepo.IndexLimits = r.IndexLimits
 	indexFile, err := os.Open(r.Storage.LocalPath(*repository.GetArtifact()))
 	if err != nil {
 		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
@@ -339,22 +512,35 @@ func (r *HelmChartReconciler) reconcileFromHelmRepository(ctx context.Context,
 	}
 
 	// Lookup the chart version in the chart repository index
-	chartVer, err := chartRepo.Get(chart.Spec.Chart, chart.Spec.Version)
+	version, digest := splitChartDigest(chart.Spec.Version)
+	chartVer, resolution, err := chartRepo.Resolve(chart.Spec.Chart, version)
 	if err != nil {
 		return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), err
 	}
+	if err := verifyChartDigest(chartVer.Name, chartVer.Version, chartVer.Digest, digest); err != nil {
+		return sourcev1.HelmChartNotReady(chart, sourcev1.ChartDigestMismatchReason, err.Error()), err
+	}
 
 	// Return early if the revision is still the same as the current artifact
 	newArtifact := r.Storage.NewArtifactFor(chart.Kind, chart.GetObjectMeta(), chartVer.Version,
 		fmt.Sprintf("%s-%s.tgz", chartVer.Name, chartVer.Version))
-	if !force && repository.GetArtifact().HasRevision(newArtifact.Revision) {
+	if !force && repository.GetArtifact().HasRevision(newArtifact.Revision) && chart.Status.PendingRevision == "" {
 		if newArtifact.URL != chart.GetArtifact().URL {
 			r.Storage.SetArtifactURL(chart.GetArtifact())
-			chart.Status.URL = r.Storage.SetHostname(chart.Status.URL)
+			chart.Status.URL = r.Storage.SetLinkURL(*chart.GetArtifact(), chart.Status.URL)
 		}
 		return chart, nil
 	}
 
+	// Hold the new revision back until the window opens
+	opensAt, err := holdRevision(chart.Spec.Window, chart.GetArtifact(), newArtifact.Revision)
+	if err != nil {
+		return sourcev1.HelmChartNotReady(chart, sourcev1.WindowInvalidReason, err.Error()), err
+	}
+	if !opensAt.IsZero() {
+		return sourcev1.HelmChartPending(chart, newArtifact.Revision, pendingMessage(newArtifact.Revision, opensAt)), nil
+	}
+
 	// Ensure artifact directory exists
 	err = r.Storage.MkdirAll(newArtifact)
 	if err != nil {
@@ -370,33 +556,117 @@ func (r *HelmChartReconciler) reconcileFromHelmRepository(ctx context.Context,
 	}
 	defer unlock()
 
-	// Attempt to download the chart
+	// Build from the package cached for the HelmRepository, if any
+	var (
+		cache   *sourcev1.Artifact
+		pkgPath string
+	)
+	if repository.Spec.CacheCharts {
+		artifact := cachedChartArtifact(r.Storage, repository, chartVer.Name, chartVer.Version, chartVer.Digest)
+		cache = &artifact
+		pkgPath = cachedChart(r.Storage, artifact)
+	}
+	cached := pkgPath != ""
+	if !cached {
+		reconciledChart, tmpPath, err := r.downloadChart(ctx, chart, chartRepo, chartVer, secret)
+		if err != nil {
+			return reconciledChart, err
+		}
+		defer os.RemoveAll(tmpPath)
+		pkgPath = tmpPath
+	}
+
+	// the digest of the index may not be the one of the served package
+	if digest != "" {
+		downloaded, err := fileDigest(pkgPath)
+		if err != nil {
+			return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), err
+		}
+		if err := verifyChartDigest(chartVer.Name, chartVer.Version, downloaded, digest); err != nil {
+			return sourcev1.HelmChartNotReady(chart, sourcev1.ChartDigestMismatchReason, err.Error()), err
+		}
+	}
+
+	// the cache is a best effort, the chart is built regardless
+	if cache != nil && !cached {
+		if err := cacheChart(r.Storage, *cache, pkgPath); err != nil {
+			logr.FromContext(ctx).Error(err, "unable to cache chart package", "chart", chartVer.Name, "version", chartVer.Version)
+		}
+	}
+
+	reconciledChart, err := r.storeChartPackage(ctx, chart, newArtifact, pkgPath, chartVer.Name)
+	if err != nil {
+		return reconciledChart, err
+	}
+	reconciledChart.Status.VersionResolution = versionResolution(version, chartVer.Version, resolution)
+	return reconciledChart, nil
+}
+
+// downloadChart downloads the package of the given chart version from the
+// given chart repository to a temporary file, and returns its path. The
+// download is retried once with the rotated credentials if the given Secret
+// has been rotated.
+func (r *HelmChartReconciler) downloadChart(ctx context.Context, chart sourcev1.HelmChart, chartRepo *helm.ChartRepository,
+	chartVer *repo.ChartVersion, secret *corev1.Secret) (sourcev1.HelmChart, string, error) {
+	fetchDone := r.OperationsRecorder.RecordFetch(sourcev1.HelmChartKind)
+	defer fetchDone()
+	// the errors are recorded on the reconcile span
+	_, span := tracing.Start(ctx, "download")
+	defer span.End()
 	res, err := chartRepo.DownloadChart(chartVer)
+	if errors.Is(err, policy.ErrEndpointNotAllowed) {
+		return sourcev1.HelmChartNotReady(chart, sourcev1.PolicyViolationReason, err.Error()), "", err
+	}
 	if err != nil {
-		return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), err
+		// Retry immediately with fresh credentials if the auth secret
+		// has been rotated while downloading the chart
+		rotated := rotatedSecret(ctx, r.APIReader, secret)
+		if rotated == nil {
+			return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), "", err
+		}
+		opts, cleanup, err := getter.ClientOptionsFromSecret(*rotated)
+		if err != nil {
+			err = fmt.Errorf("auth options error: %w", err)
+			return sourcev1.HelmChartNotReady(chart, sourcev1.AuthenticationFailedReason, err.Error()), "", err
+		}
+		defer cleanup()
+		// Options are applied in order, the rotated credentials take
+		// precedence over the ones read before
+		chartRepo.Options = append(chartRepo.Options, opts...)
+		if res, err = chartRepo.DownloadChart(chartVer); err != nil {
+			return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), "", err
+		}
 	}
+	fetchDone()
+	span.End()
 	tmpFile, err := os.CreateTemp("", fmt.Sprintf("%s-%s-", chart.Namespace, chart.Name))
 	if err != nil {
-		return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), err
+		return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), "", err
 	}
-	defer os.RemoveAll(tmpFile.Name())
 	if _, err = io.Copy(tmpFile, res); err != nil {
 		tmpFile.Close()
-		return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), err
+		os.Remove(tmpFile.Name())
+		return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), "", err
 	}
 	tmpFile.Close()
+	return chart, tmpFile.Name(), nil
+}
 
+// storeChartPackage writes the chart package at the given path to storage as
+// the given artifact, once repackaged with the default values overwritten by
+// the values files and without the excluded files of the v1beta1.HelmChart,
+// if any. The values files are paths in the chart package.
+func (r *HelmChartReconciler) storeChartPackage(ctx context.Context, chart sourcev1.HelmChart,
+	newArtifact sourcev1.Artifact, pkgPath, chartName string) (sourcev1.HelmChart, error) {
 	// Check if we need to repackage the chart with the declared defaults files.
 	var (
-		pkgPath      = tmpFile.Name()
-		readyReason  = sourcev1.ChartPullSucceededReason
-		readyMessage = fmt.Sprintf("Fetched revision: %s", newArtifact.Revision)
+		readyReason    = sourcev1.ChartPullSucceededReason
+		readyMessage   = fmt.Sprintf("Fetched revision: %s", newArtifact.Revision)
+		valuesChecksum string
 	)
 
 	switch {
-	case len(chart.GetValuesFiles()) > 0:
-		valuesMap := make(map[string]interface{})
-
+	case len(chart.GetValuesFiles()) > 0 || len(chart.Spec.PackageExclude) > 0:
 		// Load the chart
 		helmChart, err := loader.LoadFile(pkgPath)
 		if err != nil {
@@ -404,45 +674,56 @@ func (r *HelmChartReconciler) reconcileFromHelmRepository(ctx context.Context,
 			return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
 		}
 
-		for _, v := range chart.GetValuesFiles() {
-			if v == "values.yaml" {
-				valuesMap = transform.MergeMaps(valuesMap, helmChart.Values)
-				continue
-			}
+		changed := false
+		if len(chart.GetValuesFiles()) > 0 {
+			valuesMap := make(map[string]interface{})
+			for _, v := range chart.GetValuesFiles() {
+				if v == "values.yaml" {
+					valuesMap = transform.MergeMaps(valuesMap, helmChart.Values)
+					continue
+				}
 
-			var valuesData []byte
-			cfn := filepath.Clean(v)
-			for _, f := range helmChart.Files {
-				if f.Name == cfn {
-					valuesData = f.Data
-					break
+				var valuesData []byte
+				cfn := filepath.Clean(v)
+				for _, f := range helmChart.Files {
+					if f.Name == cfn {
+						valuesData = f.Data
+						break
+					}
 				}
-			}
-			if valuesData == nil {
-				err = fmt.Errorf("invalid values file path: %s", v)
-				return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+				if valuesData == nil {
+					err = fmt.Errorf("invalid values file path: %s", v)
+					return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+				}
+
+				yamlMap := make(map[string]interface{})
+				err = yaml.Unmarshal(valuesData, &yamlMap)
+				if err != nil {
+					err = fmt.Errorf("unmarshaling values from %s failed: %w", v, err)
+					return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+				}
+
+				valuesMap = transform.MergeMaps(valuesMap, yamlMap)
 			}
 
-			yamlMap := make(map[string]interface{})
-			err = yaml.Unmarshal(valuesData, &yamlMap)
+			yamlBytes, err := yaml.Marshal(valuesMap)
 			if err != nil {
-				err = fmt.Errorf("unmarshaling values from %s failed: %w", v, err)
-				return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+				err = fmt.Errorf("marshaling values failed: %w", err)
+				return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPackageFailedReason, err.Error()), err
 			}
+			valuesChecksum = r.valuesChecksum(yamlBytes)
 
-			valuesMap = transform.MergeMaps(valuesMap, yamlMap)
+			// Overwrite values file
+			if changed, err = helm.OverwriteChartDefaultValues(helmChart, yamlBytes); err != nil {
+				return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPackageFailedReason, err.Error()), err
+			}
 		}
 
-		yamlBytes, err := yaml.Marshal(valuesMap)
-		if err != nil {
-			err = fmt.Errorf("marshaling values failed: %w", err)
-			return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPackageFailedReason, err.Error()), err
+		// Drop the excluded files
+		if helm.ExcludeChartFiles(helmChart, chart.Spec.PackageExclude) {
+			changed = true
 		}
-
-		// Overwrite values file
-		if changed, err := helm.OverwriteChartDefaultValues(helmChart, yamlBytes); err != nil {
-			return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPackageFailedReason, err.Error()), err
-		} else if !changed {
+		if !changed {
 			break
 		}
 
@@ -472,23 +753,201 @@ func (r *HelmChartReconciler) reconcileFromHelmRepository(ctx context.Context,
 	}
 
 	// Write artifact to storage
-	if err := r.Storage.CopyFromPath(&newArtifact, pkgPath); err != nil {
+	_, span := tracing.Start(ctx, "store")
+	err := r.Storage.CopyFromPath(&newArtifact, pkgPath)
+	tracing.End(span, err)
+	if err != nil {
 		err = fmt.Errorf("unable to write chart file: %w", err)
 		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
 	}
+	if err := r.Storage.WriteSBOM(&newArtifact); err != nil {
+		err = fmt.Errorf("storage SBOM error: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
 
-	// Update symlink
-	chartUrl, err := r.Storage.Symlink(newArtifact, fmt.Sprintf("%s-latest.tgz", chartVer.Name))
+	// Update the symlinks of the chart and of the latest artifact
+	chartUrl, err := r.Storage.Symlink(newArtifact, fmt.Sprintf("%s-latest.tgz", chartName))
 	if err != nil {
 		err = fmt.Errorf("storage error: %w", err)
 		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
 	}
+	if _, err := r.Storage.LatestSymlink(newArtifact); err != nil {
+		err = fmt.Errorf("storage error: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
 
+	chart.Status.ValuesChecksum = valuesChecksum
 	return sourcev1.HelmChartReady(chart, newArtifact, chartUrl, readyReason, readyMessage), nil
 }
 
+// reconcileFromURL downloads the chart package from the URL of the ChartRef
+// of the v1beta1.HelmChart, and writes it to storage if its version is not
+// the revision of the current artifact.
+func (r *HelmChartReconciler) reconcileFromURL(ctx context.Context,
+	chart sourcev1.HelmChart, force bool) (sourcev1.HelmChart, error) {
+	ref := chart.Spec.ChartRef
+	if err := r.EndpointPolicy.Check(chart.Namespace, ref.URL); err != nil {
+		return sourcev1.HelmChartNotReady(chart, sourcev1.PolicyViolationReason, err.Error()), err
+	}
+	// download from the mirror of the URL if rewritten
+	chartURL := r.URLRewriter.Rewrite(ref.URL)
+	u, err := url.Parse(chartURL)
+	if err != nil {
+		err = fmt.Errorf("invalid chart URL '%s': %w", chartURL, err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.URLInvalidReason, err.Error()), err
+	}
+	chartGetter, err := helmGetters(r.Getters, r.HTTPHeaders, nil).ByScheme(u.Scheme)
+	if err != nil {
+		return sourcev1.HelmChartNotReady(chart, sourcev1.URLInvalidReason, err.Error()), err
+	}
+
+	// Configure the getter options
+	clientOpts := []helmgetter.Option{helmgetter.WithURL(chartURL)}
+	if ref.Timeout != nil {
+		clientOpts = append(clientOpts, helmgetter.WithTimeout(ref.Timeout.Duration))
+	}
+	secret, err := r.getChartRefSecret(ctx, chart)
+	if err != nil {
+		return sourcev1.HelmChartNotReady(chart, sourcev1.AuthenticationFailedReason, err.Error()), err
+	}
+	clientOpts = append(clientOpts, clientIdentityOptions(r.ClientIdentity, secret)...)
+	if secret != nil {
+		opts, cleanup, err := getter.ClientOptionsFromSecret(*secret)
+		if err != nil {
+			err = fmt.Errorf("auth options error: %w", err)
+			return sourcev1.HelmChartNotReady(chart, sourcev1.AuthenticationFailedReason, err.Error()), err
+		}
+		defer cleanup()
+		clientOpts = append(clientOpts, opts...)
+	}
+
+	// Attempt to download the chart
+	fetchDone := r.OperationsRecorder.RecordFetch(sourcev1.HelmChartKind)
+	defer fetchDone()
+	_, span := tracing.Start(ctx, "download")
+	var res *bytes.Buffer
+	err = r.DownloadRetry.Do(ctx, func() error {
+		res, err = chartGetter.Get(chartURL, clientOpts...)
+		return err
+	})
+	fetchDone()
+	tracing.End(span, err)
+	if err != nil {
+		err = fmt.Errorf("chart download error: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), err
+	}
+	tmpFile, err := os.CreateTemp("", fmt.Sprintf("%s-%s-", chart.Namespace, chart.Name))
+	if err != nil {
+		return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), err
+	}
+	defer os.RemoveAll(tmpFile.Name())
+	if _, err = io.Copy(tmpFile, res); err != nil {
+		tmpFile.Close()
+		return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), err
+	}
+	tmpFile.Close()
+
+	// Load the chart metadata, and assert it is the declared chart
+	helmChart, err := loader.LoadFile(tmpFile.Name())
+	if err != nil {
+		err = fmt.Errorf("load chart error: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), err
+	}
+	if helmChart.Metadata.Name != chart.Spec.Chart {
+		err = fmt.Errorf("chart name mismatch: expected '%s', got '%s'", chart.Spec.Chart, helmChart.Metadata.Name)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), err
+	}
+
+	// Return early if the revision is still the same as the current artifact
+	newArtifact := r.Storage.NewArtifactFor(chart.Kind, chart.GetObjectMeta(), helmChart.Metadata.Version,
+		fmt.Sprintf("%s-%s.tgz", helmChart.Metadata.Name, helmChart.Metadata.Version))
+	if !force && apimeta.IsStatusConditionTrue(chart.Status.Conditions, meta.ReadyCondition) &&
+		chart.GetArtifact().HasRevision(newArtifact.Revision) && chart.Status.PendingRevision == "" {
+		if newArtifact.URL != chart.GetArtifact().URL {
+			r.Storage.SetArtifactURL(chart.GetArtifact())
+			chart.Status.URL = r.Storage.SetLinkURL(*chart.GetArtifact(), chart.Status.URL)
+		}
+		return chart, nil
+	}
+
+	// Hold the new revision back until the window opens
+	opensAt, err := holdRevision(chart.Spec.Window, chart.GetArtifact(), newArtifact.Revision)
+	if err != nil {
+		return sourcev1.HelmChartNotReady(chart, sourcev1.WindowInvalidReason, err.Error()), err
+	}
+	if !opensAt.IsZero() {
+		return sourcev1.HelmChartPending(chart, newArtifact.Revision, pendingMessage(newArtifact.Revision, opensAt)), nil
+	}
+
+	// Ensure artifact directory exists
+	err = r.Storage.MkdirAll(newArtifact)
+	if err != nil {
+		err = fmt.Errorf("unable to create chart directory: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	// Acquire a lock for the artifact
+	unlock, err := r.Storage.Lock(newArtifact)
+	if err != nil {
+		err = fmt.Errorf("unable to acquire lock: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	defer unlock()
+
+	reconciledChart, err := r.storeChartPackage(ctx, chart, newArtifact, tmpFile.Name(), helmChart.Metadata.Name)
+	if err != nil {
+		return reconciledChart, err
+	}
+	reconciledChart.Status.VersionResolution = nil
+	return reconciledChart, nil
+}
+
+// reconcileFromTarballArtifact builds the chart from the artifact of the given
+// GitRepository or Bucket, unless the build cache key of the
+// v1beta1.HelmChart shows it was already built from the same source revision
+// and values.
 func (r *HelmChartReconciler) reconcileFromTarballArtifact(ctx context.Context,
-	artifact sourcev1.Artifact, chart sourcev1.HelmChart, force bool) (sourcev1.HelmChart, error) {
+	source sourcev1.Source, chart sourcev1.HelmChart, force bool) (sourcev1.HelmChart, error) {
+	artifact := *source.GetArtifact()
+	// Return early without unpacking the source if the key is still the same
+	// as the one of the current artifact
+	if !force && apimeta.IsStatusConditionTrue(chart.Status.Conditions, meta.ReadyCondition) &&
+		chart.GetArtifact() != nil && r.Storage.ArtifactExist(*chart.GetArtifact()) &&
+		chart.Status.BuildCacheKey == r.buildCacheKey(chart, artifact) && chart.Status.PendingRevision == "" {
+		r.OperationsRecorder.RecordChartBuildCache(true)
+		current := *chart.GetArtifact()
+		r.Storage.SetArtifactURL(&current)
+		if current.URL != chart.GetArtifact().URL {
+			r.Storage.SetArtifactURL(chart.GetArtifact())
+			chart.Status.URL = r.Storage.SetLinkURL(*chart.GetArtifact(), chart.Status.URL)
+		}
+		return chart, nil
+	}
+	r.OperationsRecorder.RecordChartBuildCache(false)
+
+	reconciledChart, err := r.buildFromTarballArtifact(ctx, source, chart, force)
+	if err != nil {
+		return reconciledChart, err
+	}
+	// the key is only the one of the current artifact if the build was not
+	// held back by the window
+	if reconciledChart.Status.PendingRevision == "" {
+		reconciledChart.Status.BuildCacheKey = r.buildCacheKey(reconciledChart, artifact)
+	}
+	return reconciledChart, nil
+}
+
+// buildCacheKey returns the checksum of the revision of the given source
+// artifact, the generation of the v1beta1.HelmChart and the checksum of the
+// merged values its artifact was packaged with.
+func (r *HelmChartReconciler) buildCacheKey(chart sourcev1.HelmChart, artifact sourcev1.Artifact) string {
+	key := fmt.Sprintf("%s\n%d\n%s\n", artifact.Revision, chart.GetGeneration(), chart.Status.ValuesChecksum)
+	return r.Storage.Checksum(strings.NewReader(key))
+}
+
+func (r *HelmChartReconciler) buildFromTarballArtifact(ctx context.Context,
+	source sourcev1.Source, chart sourcev1.HelmChart, force bool) (sourcev1.HelmChart, error) {
+	artifact := *source.GetArtifact()
 	// Create temporary working directory
 	tmpDir, err := os.MkdirTemp("", fmt.Sprintf("%s-%s-", chart.Namespace, chart.Name))
 	if err != nil {
@@ -510,6 +969,11 @@ func (r *HelmChartReconciler) reconcileFromTarballArtifact(ctx context.Context,
 	}
 	f.Close()
 
+	// Package all the charts matching the pattern into a single artifact
+	if isChartPattern(chart.Spec.Chart) {
+		return r.reconcileChartsFromDir(ctx, source, tmpDir, chart, force)
+	}
+
 	// Load the chart
 	chartPath, err := securejoin.SecureJoin(tmpDir, chart.Spec.Chart)
 	if err != nil {
@@ -525,65 +989,367 @@ func (r *HelmChartReconciler) reconcileFromTarballArtifact(ctx context.Context,
 		err = fmt.Errorf("load chart error: %w", err)
 		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
 	}
+	isVersionTemplated, err := templateChartVersion(chart, source, helmChart)
+	if err != nil {
+		return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPackageFailedReason, err.Error()), err
+	}
+
+	values, reason, err := mergeValuesFiles(chart, tmpDir)
+	if err != nil {
+		return sourcev1.HelmChartNotReady(chart, reason, err.Error()), err
+	}
+	valuesChecksum := r.valuesChecksum(values)
 
-	// Return early if the revision is still the same as the current chart artifact
+	// Return early if the revision and the merged values are still the same
+	// as the ones of the current chart artifact
 	newArtifact := r.Storage.NewArtifactFor(chart.Kind, chart.ObjectMeta.GetObjectMeta(), helmChart.Metadata.Version,
 		fmt.Sprintf("%s-%s.tgz", helmChart.Metadata.Name, helmChart.Metadata.Version))
-	if !force && apimeta.IsStatusConditionTrue(chart.Status.Conditions, meta.ReadyCondition) && chart.GetArtifact().HasRevision(newArtifact.Revision) {
+	if !force && apimeta.IsStatusConditionTrue(chart.Status.Conditions, meta.ReadyCondition) &&
+		chart.GetArtifact().HasRevision(newArtifact.Revision) && chart.Status.ValuesChecksum == valuesChecksum &&
+		chart.Status.PendingRevision == "" {
 		if newArtifact.URL != artifact.URL {
 			r.Storage.SetArtifactURL(chart.GetArtifact())
-			chart.Status.URL = r.Storage.SetHostname(chart.Status.URL)
+			chart.Status.URL = r.Storage.SetLinkURL(*chart.GetArtifact(), chart.Status.URL)
 		}
 		return chart, nil
 	}
 
+	// Hold the new revision back until the window opens
+	opensAt, err := holdRevision(chart.Spec.Window, chart.GetArtifact(), newArtifact.Revision)
+	if err != nil {
+		return sourcev1.HelmChartNotReady(chart, sourcev1.WindowInvalidReason, err.Error()), err
+	}
+	if !opensAt.IsZero() {
+		return sourcev1.HelmChartPending(chart, newArtifact.Revision, pendingMessage(newArtifact.Revision, opensAt)), nil
+	}
+
 	// Either (re)package the chart with the declared default values file,
 	// or write the chart directly to storage.
-	pkgPath := chartPath
-	isValuesFileOverriden := false
-	if len(chart.GetValuesFiles()) > 0 {
-		valuesMap := make(map[string]interface{})
-		for _, v := range chart.GetValuesFiles() {
-			srcPath, err := securejoin.SecureJoin(tmpDir, v)
-			if err != nil {
-				return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
-			}
-			if f, err := os.Stat(srcPath); os.IsNotExist(err) || !f.Mode().IsRegular() {
-				err = fmt.Errorf("invalid values file path: %s", v)
-				return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
-			}
+	pkgPath, reason, err := r.packageChart(ctx, chart, tmpDir, chart.Spec.Chart, helmChart, chartFileInfo.IsDir(), isVersionTemplated, tmpDir, values)
+	if err != nil {
+		return sourcev1.HelmChartNotReady(chart, reason, err.Error()), err
+	}
 
-			valuesData, err := os.ReadFile(srcPath)
-			if err != nil {
-				err = fmt.Errorf("failed to read from values file '%s': %w", v, err)
-				return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	// Ensure artifact directory exists
+	err = r.Storage.MkdirAll(newArtifact)
+	if err != nil {
+		err = fmt.Errorf("unable to create artifact directory: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	// Acquire a lock for the artifact
+	unlock, err := r.Storage.Lock(newArtifact)
+	if err != nil {
+		err = fmt.Errorf("unable to acquire lock: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	defer unlock()
+
+	// Copy the packaged chart to the artifact path
+	_, span := tracing.Start(ctx, "store")
+	err = r.Storage.CopyFromPath(&newArtifact, pkgPath)
+	tracing.End(span, err)
+	if err != nil {
+		err = fmt.Errorf("failed to write chart package to storage: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	if err := r.Storage.WriteSBOM(&newArtifact); err != nil {
+		err = fmt.Errorf("storage SBOM error: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	// Update the symlinks of the chart and of the latest artifact
+	cUrl, err := r.Storage.Symlink(newArtifact, fmt.Sprintf("%s-latest.tgz", helmChart.Metadata.Name))
+	if err != nil {
+		err = fmt.Errorf("storage error: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	if _, err := r.Storage.LatestSymlink(newArtifact); err != nil {
+		err = fmt.Errorf("storage error: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	message := fmt.Sprintf("Fetched and packaged revision: %s", newArtifact.Revision)
+	chart.Status.VersionResolution = nil
+	chart.Status.ValuesChecksum = valuesChecksum
+	return sourcev1.HelmChartReady(chart, newArtifact, cUrl, sourcev1.ChartPackageSucceededReason, message), nil
+}
+
+// reconcileChartsFromDir packages all the charts in the given working dir,
+// holding the artifact of the given source, matching the glob pattern of the
+// v1beta1.HelmChart, and archives the packages into a single artifact. The
+// status of every matched chart is recorded in the status of the
+// v1beta1.HelmChart.
+func (r *HelmChartReconciler) reconcileChartsFromDir(ctx context.Context,
+	source sourcev1.Source, workDir string, chart sourcev1.HelmChart, force bool) (sourcev1.HelmChart, error) {
+	matches, err := filepath.Glob(filepath.Join(workDir, chart.Spec.Chart))
+	if err != nil {
+		err = fmt.Errorf("invalid chart pattern '%s': %w", chart.Spec.Chart, err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), err
+	}
+
+	// Load the charts, skipping any matches which are not a chart
+	type loadedChart struct {
+		entry     *sourcev1.HelmChartEntry
+		helmChart *helmchart.Chart
+		isDir     bool
+		templated bool
+	}
+	var entries []sourcev1.HelmChartEntry
+	var loaded []loadedChart
+	var failed int
+	for _, match := range matches {
+		rel, err := filepath.Rel(workDir, match)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		fi, err := os.Stat(match)
+		if err != nil {
+			continue
+		}
+		if fi.IsDir() {
+			if _, err := os.Stat(filepath.Join(match, chartutil.ChartfileName)); err != nil {
+				continue
 			}
+		} else if filepath.Ext(match) != ".tgz" {
+			continue
+		}
 
-			yamlMap := make(map[string]interface{})
-			err = yaml.Unmarshal(valuesData, &yamlMap)
+		entry := sourcev1.HelmChartEntry{Path: filepath.ToSlash(rel)}
+		helmChart, err := loader.Load(match)
+		templated := false
+		if err == nil {
+			templated, err = templateChartVersion(chart, source, helmChart)
 			if err != nil {
-				err = fmt.Errorf("unmarshaling values from %s failed: %w", v, err)
-				return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+				helmChart = nil
+				entry.Message = err.Error()
+				failed++
 			}
+		} else {
+			entry.Message = fmt.Sprintf("load chart error: %s", err.Error())
+			failed++
+		}
+		if helmChart != nil {
+			entry.Name = helmChart.Metadata.Name
+			entry.Version = helmChart.Metadata.Version
+		}
+		entries = append(entries, entry)
+		loaded = append(loaded, loadedChart{helmChart: helmChart, isDir: fi.IsDir(), templated: templated})
+	}
+	for i := range loaded {
+		loaded[i].entry = &entries[i]
+	}
+	if len(entries) == 0 {
+		err = fmt.Errorf("no charts found matching pattern '%s'", chart.Spec.Chart)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), err
+	}
+
+	// The revision of the artifact is the checksum of the paths and versions
+	// of all charts
+	var revision strings.Builder
+	for _, e := range entries {
+		revision.WriteString(fmt.Sprintf("%s %s %s\n", e.Path, e.Name, e.Version))
+	}
+	rev := r.Storage.Checksum(strings.NewReader(revision.String()))
+	newArtifact := r.Storage.NewArtifactFor(chart.Kind, chart.ObjectMeta.GetObjectMeta(), rev,
+		fmt.Sprintf("charts-%s.tar.gz", rev))
 
-			valuesMap = transform.MergeMaps(valuesMap, yamlMap)
+	values, reason, err := mergeValuesFiles(chart, workDir)
+	if err != nil {
+		return sourcev1.HelmChartNotReady(chart, reason, err.Error()), err
+	}
+	valuesChecksum := r.valuesChecksum(values)
+
+	// Return early if the revision and the merged values are still the same
+	// as the ones of the current artifact
+	if failed == 0 && !force && apimeta.IsStatusConditionTrue(chart.Status.Conditions, meta.ReadyCondition) &&
+		chart.GetArtifact().HasRevision(newArtifact.Revision) && chart.Status.ValuesChecksum == valuesChecksum &&
+		chart.Status.PendingRevision == "" {
+		if newArtifact.URL != chart.GetArtifact().URL {
+			r.Storage.SetArtifactURL(chart.GetArtifact())
+			chart.Status.URL = r.Storage.SetLinkURL(*chart.GetArtifact(), chart.Status.URL)
 		}
+		return chart, nil
+	}
+
+	// Hold the new revision back until the window opens
+	opensAt, err := holdRevision(chart.Spec.Window, chart.GetArtifact(), newArtifact.Revision)
+	if err != nil {
+		return sourcev1.HelmChartNotReady(chart, sourcev1.WindowInvalidReason, err.Error()), err
+	}
+	if !opensAt.IsZero() {
+		return sourcev1.HelmChartPending(chart, newArtifact.Revision, pendingMessage(newArtifact.Revision, opensAt)), nil
+	}
 
-		yamlBytes, err := yaml.Marshal(valuesMap)
+	// Package every chart into a dedicated directory
+	pkgDir, err := os.MkdirTemp("", fmt.Sprintf("%s-%s-packages-", chart.Namespace, chart.Name))
+	if err != nil {
+		err = fmt.Errorf("tmp dir error: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	defer os.RemoveAll(pkgDir)
+
+	packages := make(map[string]string)
+	for _, l := range loaded {
+		if l.helmChart == nil {
+			continue
+		}
+		pkgName := fmt.Sprintf("%s-%s.tgz", l.entry.Name, l.entry.Version)
+		if path, ok := packages[pkgName]; ok {
+			l.entry.Message = fmt.Sprintf("chart package %s conflicts with chart at %s", pkgName, path)
+			failed++
+			continue
+		}
+		packages[pkgName] = l.entry.Path
+
+		pkgPath, _, err := r.packageChart(ctx, chart, workDir, l.entry.Path, l.helmChart, l.isDir, l.templated, pkgDir, values)
+		if err == nil && filepath.Dir(pkgPath) != pkgDir {
+			err = copyFile(pkgPath, filepath.Join(pkgDir, pkgName))
+		}
 		if err != nil {
-			err = fmt.Errorf("marshaling values failed: %w", err)
-			return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPackageFailedReason, err.Error()), err
+			l.entry.Message = err.Error()
+			failed++
+			continue
 		}
+		l.entry.Ready = true
+	}
+	chart.Status.Charts = entries
+	if failed > 0 {
+		err = fmt.Errorf("failed to package %d of %d charts matching pattern '%s'", failed, len(entries), chart.Spec.Chart)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPackageFailedReason, err.Error()), err
+	}
 
-		isValuesFileOverriden, err = helm.OverwriteChartDefaultValues(helmChart, yamlBytes)
+	// Ensure artifact directory exists
+	err = r.Storage.MkdirAll(newArtifact)
+	if err != nil {
+		err = fmt.Errorf("unable to create artifact directory: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	// Acquire a lock for the artifact
+	unlock, err := r.Storage.Lock(newArtifact)
+	if err != nil {
+		err = fmt.Errorf("unable to acquire lock: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	defer unlock()
+
+	// Archive the chart packages
+	_, span := tracing.Start(ctx, "archive")
+	err = r.Storage.Archive(&newArtifact, pkgDir, nil)
+	tracing.End(span, err)
+	if err != nil {
+		err = fmt.Errorf("storage archive error: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	if err := r.Storage.WriteSBOM(&newArtifact); err != nil {
+		err = fmt.Errorf("storage SBOM error: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	// Update the symlinks of the chart and of the latest artifact
+	cUrl, err := r.Storage.Symlink(newArtifact, "charts-latest.tar.gz")
+	if err != nil {
+		err = fmt.Errorf("storage error: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	if _, err := r.Storage.LatestSymlink(newArtifact); err != nil {
+		err = fmt.Errorf("storage error: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	message := fmt.Sprintf("Fetched and packaged %d charts, revision: %s", len(entries), newArtifact.Revision)
+	chart.Status.VersionResolution = nil
+	chart.Status.ValuesChecksum = valuesChecksum
+	return sourcev1.HelmChartReady(chart, newArtifact, cUrl, sourcev1.ChartPackageSucceededReason, message), nil
+}
+
+// mergeValuesFiles merges the values files of the v1beta1.HelmChart relative
+// to the working dir, in the order they are declared. It returns nil if the
+// v1beta1.HelmChart has no values files. On failure, it returns the reason to
+// set on the Ready condition.
+func mergeValuesFiles(chart sourcev1.HelmChart, workDir string) ([]byte, string, error) {
+	if len(chart.GetValuesFiles()) == 0 {
+		return nil, "", nil
+	}
+	valuesMap := make(map[string]interface{})
+	for _, v := range chart.GetValuesFiles() {
+		srcPath, err := securejoin.SecureJoin(workDir, v)
 		if err != nil {
-			return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPackageFailedReason, err.Error()), err
+			return nil, sourcev1.StorageOperationFailedReason, err
+		}
+		if f, err := os.Stat(srcPath); os.IsNotExist(err) || !f.Mode().IsRegular() {
+			err = fmt.Errorf("invalid values file path: %s", v)
+			return nil, sourcev1.StorageOperationFailedReason, err
+		}
+
+		valuesData, err := os.ReadFile(srcPath)
+		if err != nil {
+			err = fmt.Errorf("failed to read from values file '%s': %w", v, err)
+			return nil, sourcev1.StorageOperationFailedReason, err
+		}
+
+		yamlMap := make(map[string]interface{})
+		err = yaml.Unmarshal(valuesData, &yamlMap)
+		if err != nil {
+			err = fmt.Errorf("unmarshaling values from %s failed: %w", v, err)
+			return nil, sourcev1.StorageOperationFailedReason, err
+		}
+
+		valuesMap = transform.MergeMaps(valuesMap, yamlMap)
+	}
+
+	yamlBytes, err := yaml.Marshal(valuesMap)
+	if err != nil {
+		err = fmt.Errorf("marshaling values failed: %w", err)
+		return nil, sourcev1.ChartPackageFailedReason, err
+	}
+	return yamlBytes, "", nil
+}
+
+// valuesChecksum returns the checksum of the given merged values, or an empty
+// string if there are none.
+func (r *HelmChartReconciler) valuesChecksum(values []byte) string {
+	if values == nil {
+		return ""
+	}
+	return r.Storage.Checksum(bytes.NewReader(values))
+}
+
+// packageChart packages the given chart loaded from the chart path relative to
+// the working dir into the output dir, with the given merged values and the
+// chart dependencies. It returns the path of the package, which is the chart
+// path itself if the chart is already packaged and does not need to be
+// modified, i.e. if its values and files are unchanged and its version was
+// not templated. On failure, it returns the reason to set on the Ready
+// condition.
+func (r *HelmChartReconciler) packageChart(ctx context.Context, chart sourcev1.HelmChart,
+	workDir, chartPath string, helmChart *helmchart.Chart, isDir, isVersionTemplated bool, outDir string, values []byte) (string, string, error) {
+	pkgPath, err := securejoin.SecureJoin(workDir, chartPath)
+	if err != nil {
+		return "", sourcev1.StorageOperationFailedReason, err
+	}
+	isValuesFileOverriden := false
+	if values != nil {
+		isValuesFileOverriden, err = helm.OverwriteChartDefaultValues(helmChart, values)
+		if err != nil {
+			return "", sourcev1.ChartPackageFailedReason, err
 		}
 	}
+	// The dependencies of a chart directory are filtered once built
+	isFilesExcluded := false
+	if !isDir {
+		isFilesExcluded = helm.ExcludeChartFiles(helmChart, chart.Spec.PackageExclude)
+	}
 
-	isDir := chartFileInfo.IsDir()
 	switch {
 	case isDir:
+		if chart.Spec.FrozenDependencies {
+			if err := helm.VerifyChartLock(helmChart); err != nil {
+				return "", sourcev1.ChartPackageFailedReason, err
+			}
+		}
+
 		// Determine chart dependencies
 		deps := helmChart.Dependencies()
 		reqs := helmChart.Metadata.Dependencies
@@ -614,9 +1380,15 @@ func (r *HelmChartReconciler) reconcileFromTarballArtifact(ctx context.Context,
 				continue
 			}
 
-			// Discover existing HelmRepository by URL
+			// Discover existing HelmRepository by name or URL, falling back
+			// to an anonymous repository for the URLs without one
 			repository, err := r.resolveDependencyRepository(ctx, dep, chart.Namespace)
+			anonymous := false
 			if err != nil {
+				if _, ok := helm.RepositoryAlias(dep.Repository); ok {
+					return "", sourcev1.ChartPullFailedReason, err
+				}
+				anonymous = true
 				repository = &sourcev1.HelmRepository{
 					Spec: sourcev1.HelmRepositorySpec{
 						URL:     dep.Repository,
@@ -625,51 +1397,68 @@ func (r *HelmChartReconciler) reconcileFromTarballArtifact(ctx context.Context,
 				}
 			}
 
-			// Configure ChartRepository getter options
-			clientOpts := []getter.Option{
-				getter.WithURL(repository.Spec.URL),
-				getter.WithTimeout(repository.Spec.Timeout.Duration),
-				getter.WithPassCredentialsAll(repository.Spec.PassCredentials),
+			if err := r.EndpointPolicy.Check(chart.Namespace, repository.Spec.URL); err != nil {
+				return "", sourcev1.PolicyViolationReason, err
 			}
-			if secret, err := r.getHelmRepositorySecret(ctx, repository); err != nil {
-				return sourcev1.HelmChartNotReady(chart, sourcev1.AuthenticationFailedReason, err.Error()), err
-			} else if secret != nil {
-				opts, cleanup, err := helm.ClientOptionsFromSecret(*secret)
+
+			// Configure ChartRepository getter options, downloading
+			// from the mirror of the URL if rewritten
+			repositoryURL := r.URLRewriter.Rewrite(repository.Spec.URL)
+			clientOpts := []helmgetter.Option{
+				helmgetter.WithURL(repositoryURL),
+				helmgetter.WithTimeout(repository.Spec.Timeout.Duration),
+				helmgetter.WithPassCredentialsAll(repository.Spec.PassCredentials),
+			}
+			secret, err := r.getHelmRepositorySecret(ctx, repository)
+			if err != nil {
+				return "", sourcev1.AuthenticationFailedReason, err
+			}
+			clientOpts = append(clientOpts, clientIdentityOptions(r.ClientIdentity, secret)...)
+			if secret != nil {
+				opts, cleanup, err := getter.ClientOptionsFromSecret(*secret)
 				if err != nil {
 					err = fmt.Errorf("auth options error: %w", err)
-					return sourcev1.HelmChartNotReady(chart, sourcev1.AuthenticationFailedReason, err.Error()), err
+					return "", sourcev1.AuthenticationFailedReason, err
 				}
 				defer cleanup()
 				clientOpts = append(clientOpts, opts...)
 			}
 
 			// Initialize the chart repository and load the index file
-			chartRepo, err := helm.NewChartRepository(repository.Spec.URL, r.Getters, clientOpts)
+			chartRepo, err := helm.NewChartRepository(repositoryURL, helmGetters(r.Getters, r.HTTPHeaders, repository.Spec.Headers), clientOpts)
 			if err != nil {
 				switch err.(type) {
 				case *url.Error:
-					return sourcev1.HelmChartNotReady(chart, sourcev1.URLInvalidReason, err.Error()), err
+					return "", sourcev1.URLInvalidReason, err
 				default:
-					return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), err
+					return "", sourcev1.ChartPullFailedReason, err
 				}
 			}
+			chartRepo.RewriteURL = r.URLRewriter.Rewrite
+			chartRepo.CheckURL = func(u string) error { return r.EndpointPolicy.Check(chart.Namespace, u) }
+			chartRepo.Retry = r.DownloadRetry
+			chartRepo.IndexLimits = r.IndexLimits
 			if repository.Status.Artifact != nil {
 				indexFile, err := os.Open(r.Storage.LocalPath(*repository.GetArtifact()))
 				if err != nil {
-					return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+					return "", sourcev1.StorageOperationFailedReason, err
 				}
 				b, err := io.ReadAll(indexFile)
 				if err != nil {
-					return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), err
+					return "", sourcev1.ChartPullFailedReason, err
 				}
 				if err = chartRepo.LoadIndex(b); err != nil {
-					return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), err
+					return "", sourcev1.ChartPullFailedReason, err
 				}
 			} else {
 				// Download index
 				err = chartRepo.DownloadIndex()
 				if err != nil {
-					return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), err
+					if anonymous {
+						err = fmt.Errorf("no HelmRepository with URL '%s' found in namespace '%s' to authenticate with: %w",
+							dep.Repository, chart.Namespace, err)
+					}
+					return "", sourcev1.ChartPullFailedReason, err
 				}
 			}
 
@@ -682,56 +1471,30 @@ func (r *HelmChartReconciler) reconcileFromTarballArtifact(ctx context.Context,
 		// Construct dependencies for chart if any
 		if len(dwr) > 0 {
 			dm := &helm.DependencyManager{
-				WorkingDir:   tmpDir,
-				ChartPath:    chart.Spec.Chart,
+				WorkingDir:   workDir,
+				ChartPath:    chartPath,
 				Chart:        helmChart,
 				Dependencies: dwr,
 			}
 			err = dm.Build(ctx)
+			if errors.Is(err, policy.ErrEndpointNotAllowed) {
+				return "", sourcev1.PolicyViolationReason, err
+			}
 			if err != nil {
-				return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+				return "", sourcev1.StorageOperationFailedReason, err
 			}
 		}
+		helm.ExcludeChartFiles(helmChart, chart.Spec.PackageExclude)
 
 		fallthrough
-	case isValuesFileOverriden:
-		pkgPath, err = chartutil.Save(helmChart, tmpDir)
+	case isValuesFileOverriden, isFilesExcluded, isVersionTemplated:
+		pkgPath, err = chartutil.Save(helmChart, outDir)
 		if err != nil {
 			err = fmt.Errorf("chart package error: %w", err)
-			return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPackageFailedReason, err.Error()), err
+			return "", sourcev1.ChartPackageFailedReason, err
 		}
 	}
-
-	// Ensure artifact directory exists
-	err = r.Storage.MkdirAll(newArtifact)
-	if err != nil {
-		err = fmt.Errorf("unable to create artifact directory: %w", err)
-		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
-	}
-
-	// Acquire a lock for the artifact
-	unlock, err := r.Storage.Lock(newArtifact)
-	if err != nil {
-		err = fmt.Errorf("unable to acquire lock: %w", err)
-		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
-	}
-	defer unlock()
-
-	// Copy the packaged chart to the artifact path
-	if err := r.Storage.CopyFromPath(&newArtifact, pkgPath); err != nil {
-		err = fmt.Errorf("failed to write chart package to storage: %w", err)
-		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
-	}
-
-	// Update symlink
-	cUrl, err := r.Storage.Symlink(newArtifact, fmt.Sprintf("%s-latest.tgz", helmChart.Metadata.Name))
-	if err != nil {
-		err = fmt.Errorf("storage error: %w", err)
-		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
-	}
-
-	message := fmt.Sprintf("Fetched and packaged revision: %s", newArtifact.Revision)
-	return sourcev1.HelmChartReady(chart, newArtifact, cUrl, sourcev1.ChartPackageSucceededReason, message), nil
+	return pkgPath, "", nil
 }
 
 func (r *HelmChartReconciler) reconcileDelete(ctx context.Context, chart sourcev1.HelmChart) (ctrl.Result, error) {
@@ -745,6 +1508,8 @@ func (r *HelmChartReconciler) reconcileDelete(ctx context.Context, chart sourcev
 
 	// Record deleted status
 	r.recordReadiness(ctx, chart)
+	unindexArtifact(r.ArtifactIndex, sourcev1.HelmChartKind, chart.Namespace, chart.Name)
+	r.OperationsRecorder.DeleteArtifactRevision(sourcev1.HelmChartKind, chart.Namespace, chart.Name)
 
 	// Remove our finalizer from the list and update it
 	controllerutil.RemoveFinalizer(&chart, sourcev1.SourceFinalizer)
@@ -756,6 +1521,29 @@ func (r *HelmChartReconciler) reconcileDelete(ctx context.Context, chart sourcev
 	return ctrl.Result{}, nil
 }
 
+// withdrawArtifact removes the artifacts of the given suspended HelmChart
+// from the storage and its status, for the consumers to stop receiving them.
+func (r *HelmChartReconciler) withdrawArtifact(ctx context.Context, req ctrl.Request, chart sourcev1.HelmChart) (ctrl.Result, error) {
+	if artifactWithdrawn(&chart, chart.Status.ObservedGeneration) {
+		return ctrl.Result{}, nil
+	}
+	if err := withdrawArtifacts(ctx, r.Client, r.Scheme, r.Storage, sourcev1.HelmChartKind, &chart, chart.Status.InlineArtifact); err != nil {
+		r.event(ctx, chart, events.EventSeverityError, err.Error())
+		return ctrl.Result{Requeue: true}, err
+	}
+	unindexArtifact(r.ArtifactIndex, sourcev1.HelmChartKind, chart.Namespace, chart.Name)
+	r.OperationsRecorder.DeleteArtifactRevision(sourcev1.HelmChartKind, chart.Namespace, chart.Name)
+
+	chart = sourcev1.HelmChartWithdrawn(chart)
+	if err := r.updateStatus(ctx, req, chart.Status); err != nil {
+		logr.FromContext(ctx).Error(err, "unable to update status")
+		return ctrl.Result{Requeue: true}, err
+	}
+	r.event(ctx, chart, events.EventSeverityInfo, withdrawnMessage)
+	r.recordReadiness(ctx, chart)
+	return ctrl.Result{}, nil
+}
+
 // resetStatus returns a modified v1beta1.HelmChart and a boolean indicating
 // if the status field has been reset.
 func (r *HelmChartReconciler) resetStatus(chart sourcev1.HelmChart) (sourcev1.HelmChart, bool) {
@@ -776,19 +1564,58 @@ func (r *HelmChartReconciler) resetStatus(chart sourcev1.HelmChart) (sourcev1.He
 // It removes all but the current artifact except for when the
 // deletion timestamp is set, which will result in the removal of
 // all artifacts for the resource.
-func (r *HelmChartReconciler) gc(chart sourcev1.HelmChart) error {
+func (r *HelmChartReconciler) gc(chart sourcev1.HelmChart) (err error) {
+	defer func() {
+		r.OperationsRecorder.RecordGC(sourcev1.HelmChartKind, err)
+	}()
 	if !chart.DeletionTimestamp.IsZero() {
 		return r.Storage.RemoveAll(r.Storage.NewArtifactFor(chart.Kind, chart.GetObjectMeta(), "", "*"))
 	}
 	if chart.GetArtifact() != nil {
-		return r.Storage.RemoveAllButCurrent(*chart.GetArtifact())
+		return r.Storage.RemoveAllButCurrent(*chart.GetArtifact(), chart.Status.History...)
 	}
 	return nil
 }
 
+// updateHistory adds the given previous artifact of the HelmChart to the
+// front of its history when it was replaced by a new one, and keeps the
+// HistoryLimit latest entries that still exist in storage. The history is
+// cleared when the HistoryLimit is not set.
+func (r *HelmChartReconciler) updateHistory(previous *sourcev1.Artifact, chart *sourcev1.HelmChart) {
+	if chart.Spec.HistoryLimit <= 0 || chart.GetArtifact() == nil {
+		chart.Status.History = nil
+		return
+	}
+
+	var candidates []sourcev1.Artifact
+	if previous != nil {
+		candidates = append(candidates, *previous)
+	}
+	candidates = append(candidates, chart.Status.History...)
+
+	seen := map[string]bool{chart.GetArtifact().Path: true}
+	var history []sourcev1.Artifact
+	for _, artifact := range candidates {
+		if len(history) == chart.Spec.HistoryLimit {
+			break
+		}
+		if seen[artifact.Path] || !r.Storage.ArtifactExist(artifact) {
+			continue
+		}
+		seen[artifact.Path] = true
+		r.Storage.SetArtifactURL(&artifact)
+		history = append(history, artifact)
+	}
+	chart.Status.History = history
+}
+
 // event emits a Kubernetes event and forwards the event to notification
 // controller if configured.
 func (r *HelmChartReconciler) event(ctx context.Context, chart sourcev1.HelmChart, severity, msg string) {
+	if !r.EventLimiter.Allow(sourcev1.HelmChartKind+"/"+chart.Namespace+"/"+chart.Name, severity, msg) {
+		return
+	}
+
 	log := logr.FromContext(ctx)
 	if r.EventRecorder != nil {
 		r.EventRecorder.Eventf(&chart, "Normal", severity, msg)
@@ -835,6 +1662,7 @@ func (r *HelmChartReconciler) updateStatus(ctx context.Context, req ctrl.Request
 
 	patch := client.MergeFrom(chart.DeepCopy())
 	chart.Status = newStatus
+	chart.Status.URL = r.Storage.resignURLs(chart.Status.URL, chart.Status.Artifact)
 
 	return r.Status().Patch(ctx, &chart, patch)
 }
@@ -856,10 +1684,22 @@ func (r *HelmChartReconciler) indexHelmChartBySource(o client.Object) []string {
 	if !ok {
 		panic(fmt.Sprintf("Expected a HelmChart, got %T", o))
 	}
-	return []string{fmt.Sprintf("%s/%s", hc.Spec.SourceRef.Kind, hc.Spec.SourceRef.Name)}
+	return []string{fmt.Sprintf("%s/%s/%s", hc.Spec.SourceRef.Kind, hc.GetSourceNamespace(), hc.Spec.SourceRef.Name)}
 }
 
+// resolveDependencyRepository returns the HelmRepository in the given
+// namespace the repository of the given dependency refers to, by name for the
+// '@name' and 'alias:name' references, or else by URL.
 func (r *HelmChartReconciler) resolveDependencyRepository(ctx context.Context, dep *helmchart.Dependency, namespace string) (*sourcev1.HelmRepository, error) {
+	if name, ok := helm.RepositoryAlias(dep.Repository); ok {
+		var repository sourcev1.HelmRepository
+		err := r.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &repository)
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve HelmRepository '%s' of dependency '%s': %w", name, dep.Name, err)
+		}
+		return &repository, nil
+	}
+
 	u := helm.NormalizeChartRepositoryURL(dep.Repository)
 	if u == "" {
 		return nil, fmt.Errorf("invalid repository URL")
@@ -900,6 +1740,23 @@ func (r *HelmChartReconciler) getHelmRepositorySecret(ctx context.Context, repos
 	return nil, nil
 }
 
+// getChartRefSecret returns the Secret referenced by the ChartRef of the
+// v1beta1.HelmChart, or nil if it does not reference one.
+func (r *HelmChartReconciler) getChartRefSecret(ctx context.Context, chart sourcev1.HelmChart) (*corev1.Secret, error) {
+	if chart.Spec.ChartRef.SecretRef == nil {
+		return nil, nil
+	}
+	name := types.NamespacedName{
+		Namespace: chart.GetNamespace(),
+		Name:      chart.Spec.ChartRef.SecretRef.Name,
+	}
+	var secret corev1.Secret
+	if err := r.Client.Get(ctx, name, &secret); err != nil {
+		return nil, fmt.Errorf("auth secret error: %w", err)
+	}
+	return &secret, nil
+}
+
 func (r *HelmChartReconciler) requestsForHelmRepositoryChange(o client.Object) []reconcile.Request {
 	repo, ok := o.(*sourcev1.HelmRepository)
 	if !ok {
@@ -913,7 +1770,7 @@ func (r *HelmChartReconciler) requestsForHelmRepositoryChange(o client.Object) [
 	ctx := context.Background()
 	var list sourcev1.HelmChartList
 	if err := r.List(ctx, &list, client.MatchingFields{
-		sourcev1.SourceIndexKey: fmt.Sprintf("%s/%s", sourcev1.HelmRepositoryKind, repo.Name),
+		sourcev1.SourceIndexKey: fmt.Sprintf("%s/%s/%s", sourcev1.HelmRepositoryKind, repo.Namespace, repo.Name),
 	}); err != nil {
 		return nil
 	}
@@ -942,7 +1799,7 @@ func (r *HelmChartReconciler) requestsForGitRepositoryChange(o client.Object) []
 
 	var list sourcev1.HelmChartList
 	if err := r.List(context.TODO(), &list, client.MatchingFields{
-		sourcev1.SourceIndexKey: fmt.Sprintf("%s/%s", sourcev1.GitRepositoryKind, repo.Name),
+		sourcev1.SourceIndexKey: fmt.Sprintf("%s/%s/%s", sourcev1.GitRepositoryKind, repo.Namespace, repo.Name),
 	}); err != nil {
 		return nil
 	}
@@ -971,7 +1828,7 @@ func (r *HelmChartReconciler) requestsForBucketChange(o client.Object) []reconci
 
 	var list sourcev1.HelmChartList
 	if err := r.List(context.TODO(), &list, client.MatchingFields{
-		sourcev1.SourceIndexKey: fmt.Sprintf("%s/%s", sourcev1.BucketKind, bucket.Name),
+		sourcev1.SourceIndexKey: fmt.Sprintf("%s/%s/%s", sourcev1.BucketKind, bucket.Namespace, bucket.Name),
 	}); err != nil {
 		return nil
 	}
@@ -987,6 +1844,71 @@ func (r *HelmChartReconciler) requestsForBucketChange(o client.Object) []reconci
 	return reqs
 }
 
+// versionResolution returns the v1beta1.HelmChartVersionResolution for the
+// given selected chart version, recording at most
+// v1beta1.MaxVersionCandidates candidates.
+func versionResolution(version, selected string, resolution *helm.VersionResolution) *sourcev1.HelmChartVersionResolution {
+	if resolution == nil {
+		return nil
+	}
+	res := &sourcev1.HelmChartVersionResolution{
+		Version:  version,
+		Selected: selected,
+		Reason:   resolution.Reason,
+	}
+	for i, cv := range resolution.Candidates {
+		if i == sourcev1.MaxVersionCandidates {
+			break
+		}
+		res.Candidates = append(res.Candidates, cv.Version)
+	}
+	return res
+}
+
+// splitChartDigest returns the version of the given HelmChart version and
+// the hex encoded SHA-256 digest it is pinned to, or an empty digest if it is
+// not pinned.
+func splitChartDigest(version string) (string, string) {
+	i := strings.LastIndex(version, chartDigestSeparator)
+	if i < 0 {
+		return version, ""
+	}
+	return version[:i], strings.ToLower(version[i+len(chartDigestSeparator):])
+}
+
+// verifyChartDigest returns an error if the given digest of the given chart
+// version is set and does not match the pinned digest.
+func verifyChartDigest(name, version, digest, pinned string) error {
+	if pinned == "" || digest == "" || strings.EqualFold(digest, pinned) {
+		return nil
+	}
+	return fmt.Errorf("chart '%s' version '%s' has digest 'sha256:%s', but is pinned to 'sha256:%s'",
+		name, version, strings.ToLower(digest), pinned)
+}
+
+// isChartPattern returns true if the given chart path is a glob pattern.
+func isChartPattern(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// copyFile copies the regular file at src to dst.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
 // validHelmChartName returns an error if the given string is not a
 // valid Helm chart name; a valid name must be lower case letters
 // and numbers, words may be separated with dashes (-).
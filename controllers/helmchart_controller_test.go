@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path"
@@ -41,10 +42,13 @@ import (
 	helmchart "helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/getter"
 	corev1 "k8s.io/api/core/v1"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/yaml"
 
 	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
@@ -404,6 +408,26 @@ var _ = Describe("HelmChartReconciler", func() {
 			}, timeout, interval).Should(BeTrue())
 			Expect(chart.GetArtifact()).NotTo(BeNil())
 			Expect(chart.Status.Artifact.Revision).Should(Equal("0.1.1"))
+
+			By("Refusing a chart with another digest than the pinned one")
+			chart.Spec.Version = "0.1.0@sha256:" + strings.Repeat("0", 64)
+			Expect(k8sClient.Update(context.Background(), chart)).Should(Succeed())
+			Eventually(func() bool {
+				_ = k8sClient.Get(context.Background(), key, chart)
+				return apimeta.IsStatusConditionPresentAndEqual(chart.Status.Conditions, meta.ReadyCondition, metav1.ConditionFalse) &&
+					apimeta.FindStatusCondition(chart.Status.Conditions, meta.ReadyCondition).Reason == sourcev1.ChartDigestMismatchReason
+			}, timeout, interval).Should(BeTrue())
+			Expect(chart.Status.Artifact.Revision).Should(Equal("0.1.1"))
+
+			By("Accepting a chart with the pinned digest")
+			digest, err := fileDigest(path.Join(helmServer.Root(), "helmchart-0.1.0.tgz"))
+			Expect(err).NotTo(HaveOccurred())
+			chart.Spec.Version = "0.1.0@sha256:" + digest
+			Expect(k8sClient.Update(context.Background(), chart)).Should(Succeed())
+			Eventually(func() string {
+				_ = k8sClient.Get(context.Background(), key, chart)
+				return chart.Status.Artifact.Revision
+			}, timeout, interval).Should(Equal("0.1.0"))
 		})
 
 		It("Authenticates when credentials are provided", func() {
@@ -949,6 +973,122 @@ var _ = Describe("HelmChartReconciler", func() {
 					storage.ArtifactExist(*got.Status.Artifact)
 			}, timeout, interval).Should(BeTrue())
 		})
+		It("Creates a combined artifact for charts matching a pattern", func() {
+			fs := memfs.New()
+			gitrepo, err := git.Init(memory.NewStorage(), fs)
+			Expect(err).NotTo(HaveOccurred())
+
+			wt, err := gitrepo.Worktree()
+			Expect(err).NotTo(HaveOccurred())
+
+			u, err := url.Parse(gitServer.HTTPAddress())
+			Expect(err).NotTo(HaveOccurred())
+			u.Path = path.Join(u.Path, fmt.Sprintf("repository-%s.git", randStringRunes(5)))
+
+			_, err = gitrepo.CreateRemote(&config.RemoteConfig{
+				Name: "origin",
+				URLs: []string{u.String()},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			chartDir := "testdata/charts"
+			Expect(filepath.Walk(chartDir, func(p string, fi os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+
+				switch {
+				case fi.Mode().IsDir():
+					return fs.MkdirAll(p, os.ModeDir)
+				case !fi.Mode().IsRegular(), filepath.Ext(p) == ".tgz":
+					// Skip the packaged chart, as it conflicts with
+					// the chart directory it was packaged from
+					return nil
+				}
+
+				b, err := os.ReadFile(p)
+				if err != nil {
+					return err
+				}
+
+				ff, err := fs.Create(p)
+				if err != nil {
+					return err
+				}
+				if _, err := ff.Write(b); err != nil {
+					return err
+				}
+				_ = ff.Close()
+				_, err = wt.Add(p)
+
+				return err
+			})).To(Succeed())
+
+			_, err = wt.Commit("Helm charts", &git.CommitOptions{Author: &object.Signature{
+				Name:  "John Doe",
+				Email: "john@example.com",
+				When:  time.Now(),
+			}})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = gitrepo.Push(&git.PushOptions{})
+			Expect(err).NotTo(HaveOccurred())
+
+			repositoryKey := types.NamespacedName{
+				Name:      fmt.Sprintf("git-repository-sample-%s", randStringRunes(5)),
+				Namespace: namespace.Name,
+			}
+			repository := &sourcev1.GitRepository{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      repositoryKey.Name,
+					Namespace: repositoryKey.Namespace,
+				},
+				Spec: sourcev1.GitRepositorySpec{
+					URL:      u.String(),
+					Interval: metav1.Duration{Duration: indexInterval},
+				},
+			}
+			Expect(k8sClient.Create(context.Background(), repository)).Should(Succeed())
+			defer k8sClient.Delete(context.Background(), repository)
+
+			key := types.NamespacedName{
+				Name:      "helmchart-sample-" + randStringRunes(5),
+				Namespace: namespace.Name,
+			}
+			chart := &sourcev1.HelmChart{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      key.Name,
+					Namespace: key.Namespace,
+				},
+				Spec: sourcev1.HelmChartSpec{
+					Chart:   "testdata/charts/*",
+					Version: "*",
+					SourceRef: sourcev1.LocalHelmChartSourceReference{
+						Kind: sourcev1.GitRepositoryKind,
+						Name: repositoryKey.Name,
+					},
+					Interval: metav1.Duration{Duration: pullInterval},
+				},
+			}
+			Expect(k8sClient.Create(context.Background(), chart)).Should(Succeed())
+			defer k8sClient.Delete(context.Background(), chart)
+
+			By("Expecting artifact")
+			got := &sourcev1.HelmChart{}
+			Eventually(func() bool {
+				_ = k8sClient.Get(context.Background(), key, got)
+				return got.Status.Artifact != nil &&
+					storage.ArtifactExist(*got.Status.Artifact)
+			}, timeout, interval).Should(BeTrue())
+
+			By("Expecting a status entry for every chart")
+			Expect(got.Status.Charts).To(HaveLen(2))
+			for i, name := range []string{"helmchart", "helmchartwithdeps"} {
+				Expect(got.Status.Charts[i].Path).To(Equal(path.Join(chartDir, name)))
+				Expect(got.Status.Charts[i].Name).To(Equal(name))
+				Expect(got.Status.Charts[i].Ready).To(BeTrue())
+			}
+		})
 	})
 
 	Context("HelmChart from GitRepository with HelmRepository dependency", func() {
@@ -1334,3 +1474,340 @@ func Test_validHelmChartName(t *testing.T) {
 		})
 	}
 }
+
+func Test_mergeValuesFiles(t *testing.T) {
+	workDir, err := os.MkdirTemp("", "values-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workDir)
+	files := map[string]string{
+		"values.yaml":      "replicas: 1\nimage: podinfo\n",
+		"values-prod.yaml": "replicas: 3\n",
+		"invalid.yaml":     "replicas: [",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(workDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		valuesFiles []string
+		want        string
+		wantReason  string
+	}{
+		{
+			name: "no values files",
+		},
+		{
+			name:        "merged in order",
+			valuesFiles: []string{"values.yaml", "values-prod.yaml"},
+			want:        "image: podinfo\nreplicas: 3\n",
+		},
+		{
+			name:        "missing file",
+			valuesFiles: []string{"missing.yaml"},
+			wantReason:  sourcev1.StorageOperationFailedReason,
+		},
+		{
+			name:        "invalid file",
+			valuesFiles: []string{"invalid.yaml"},
+			wantReason:  sourcev1.StorageOperationFailedReason,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chart := sourcev1.HelmChart{Spec: sourcev1.HelmChartSpec{ValuesFiles: tt.valuesFiles}}
+			got, reason, err := mergeValuesFiles(chart, workDir)
+			if tt.wantReason != "" {
+				if err == nil || reason != tt.wantReason {
+					t.Fatalf("mergeValuesFiles() reason = %q, error = %v, want %q", reason, err, tt.wantReason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mergeValuesFiles() error = %v", err)
+			}
+			if tt.want == "" && got != nil {
+				t.Errorf("mergeValuesFiles() = %q, want nil", string(got))
+			}
+			if tt.want != "" && string(got) != tt.want {
+				t.Errorf("mergeValuesFiles() = %q, want %q", string(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestHelmChartReconciler_updateHistory(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := NewStorage(dir, "hostname", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifacts := map[string]sourcev1.Artifact{}
+	for _, v := range []string{"1.0.0", "1.1.0", "1.2.0", "1.3.0"} {
+		artifact := sourcev1.Artifact{
+			Path:     path.Join("helmchart", "default", "podinfo", "podinfo-"+v+".tgz"),
+			Revision: v,
+		}
+		if v != "1.0.0" {
+			if err := storage.MkdirAll(artifact); err != nil {
+				t.Fatal(err)
+			}
+			if err := storage.AtomicWriteFile(&artifact, strings.NewReader(v), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		artifacts[v] = artifact
+	}
+	r := &HelmChartReconciler{Storage: storage}
+
+	revisions := func(history []sourcev1.Artifact) []string {
+		var revs []string
+		for _, a := range history {
+			revs = append(revs, a.Revision)
+		}
+		return revs
+	}
+	tests := []struct {
+		name     string
+		limit    int
+		previous string
+		current  string
+		history  []string
+		want     []string
+	}{
+		{
+			name:     "disabled",
+			previous: "1.2.0",
+			current:  "1.3.0",
+			history:  []string{"1.1.0"},
+		},
+		{
+			name:     "new artifact",
+			limit:    2,
+			previous: "1.2.0",
+			current:  "1.3.0",
+			history:  []string{"1.1.0"},
+			want:     []string{"1.2.0", "1.1.0"},
+		},
+		{
+			name:     "unchanged artifact",
+			limit:    2,
+			previous: "1.3.0",
+			current:  "1.3.0",
+			history:  []string{"1.2.0", "1.1.0"},
+			want:     []string{"1.2.0", "1.1.0"},
+		},
+		{
+			name:     "truncated to limit",
+			limit:    1,
+			previous: "1.2.0",
+			current:  "1.3.0",
+			history:  []string{"1.1.0"},
+			want:     []string{"1.2.0"},
+		},
+		{
+			name:     "missing from storage",
+			limit:    3,
+			previous: "1.2.0",
+			current:  "1.3.0",
+			history:  []string{"1.1.0", "1.0.0"},
+			want:     []string{"1.2.0", "1.1.0"},
+		},
+		{
+			name:     "rollback to a previous version",
+			limit:    3,
+			previous: "1.3.0",
+			current:  "1.2.0",
+			history:  []string{"1.2.0", "1.1.0"},
+			want:     []string{"1.3.0", "1.1.0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := artifacts[tt.current]
+			chart := sourcev1.HelmChart{Spec: sourcev1.HelmChartSpec{HistoryLimit: tt.limit}}
+			chart.Status.Artifact = &current
+			for _, v := range tt.history {
+				chart.Status.History = append(chart.Status.History, artifacts[v])
+			}
+			previous := artifacts[tt.previous]
+			r.updateHistory(&previous, &chart)
+
+			got := revisions(chart.Status.History)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("updateHistory() = %v, want %v", got, tt.want)
+			}
+			for _, a := range chart.Status.History {
+				if a.URL == "" {
+					t.Errorf("updateHistory() artifact %s has no URL", a.Revision)
+				}
+			}
+		})
+	}
+}
+
+func TestHelmChartReconciler_reconcileFromURL(t *testing.T) {
+	pkg, err := os.ReadFile("testdata/charts/helmchart-0.1.0.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != "user" || p != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write(pkg)
+	}))
+	defer server.Close()
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "auth", Namespace: "default"},
+		Data:       map[string][]byte{"username": []byte("user"), "password": []byte("pass")},
+	}
+	storage, err := NewStorage(t.TempDir(), "hostname", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &HelmChartReconciler{
+		Client:  fake.NewClientBuilder().WithScheme(scheme).WithObjects(secret).Build(),
+		Storage: storage,
+		Getters: getter.Providers{getter.Provider{
+			Schemes: []string{"http", "https"},
+			New:     getter.NewHTTPGetter,
+		}},
+	}
+
+	tests := []struct {
+		name       string
+		chart      string
+		secretRef  *meta.LocalObjectReference
+		wantReason string
+	}{
+		{
+			name:       "authenticated",
+			chart:      "helmchart",
+			secretRef:  &meta.LocalObjectReference{Name: "auth"},
+			wantReason: sourcev1.ChartPullSucceededReason,
+		},
+		{
+			name:       "unauthenticated",
+			chart:      "helmchart",
+			wantReason: sourcev1.ChartPullFailedReason,
+		},
+		{
+			name:       "other chart",
+			chart:      "podinfo",
+			secretRef:  &meta.LocalObjectReference{Name: "auth"},
+			wantReason: sourcev1.ChartPullFailedReason,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chart := sourcev1.HelmChart{
+				TypeMeta:   metav1.TypeMeta{Kind: sourcev1.HelmChartKind},
+				ObjectMeta: metav1.ObjectMeta{Name: "vendored", Namespace: "default"},
+				Spec: sourcev1.HelmChartSpec{
+					Chart: tt.chart,
+					ChartRef: &sourcev1.HelmChartURLReference{
+						URL:       server.URL + "/helmchart-0.1.0.tgz",
+						SecretRef: tt.secretRef,
+					},
+				},
+			}
+			got, err := r.reconcileFromURL(context.TODO(), chart, false)
+			if (err != nil) != (tt.wantReason != sourcev1.ChartPullSucceededReason) {
+				t.Fatalf("reconcileFromURL() error = %v", err)
+			}
+			c := apimeta.FindStatusCondition(got.Status.Conditions, meta.ReadyCondition)
+			if c == nil || c.Reason != tt.wantReason {
+				t.Fatalf("reconcileFromURL() ready condition = %v, want reason %s", c, tt.wantReason)
+			}
+			if err != nil {
+				return
+			}
+			if got.GetArtifact().Revision != "0.1.0" || !storage.ArtifactExist(*got.GetArtifact()) {
+				t.Errorf("reconcileFromURL() artifact = %v, want stored revision 0.1.0", got.GetArtifact())
+			}
+		})
+	}
+}
+
+func Test_splitChartDigest(t *testing.T) {
+	tests := []struct {
+		version     string
+		wantVersion string
+		wantDigest  string
+	}{
+		{version: "1.2.3", wantVersion: "1.2.3"},
+		{version: ">=1.0.0 <2.0.0", wantVersion: ">=1.0.0 <2.0.0"},
+		{version: "1.2.3@sha256:ABCDEF", wantVersion: "1.2.3", wantDigest: "abcdef"},
+		{version: "@sha256:abcdef", wantVersion: "", wantDigest: "abcdef"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			version, digest := splitChartDigest(tt.version)
+			if version != tt.wantVersion || digest != tt.wantDigest {
+				t.Errorf("splitChartDigest() = %q, %q, want %q, %q", version, digest, tt.wantVersion, tt.wantDigest)
+			}
+		})
+	}
+}
+
+func Test_verifyChartDigest(t *testing.T) {
+	if err := verifyChartDigest("podinfo", "1.2.3", "ABCDEF", "abcdef"); err != nil {
+		t.Errorf("verifyChartDigest() error = %v", err)
+	}
+	if err := verifyChartDigest("podinfo", "1.2.3", "", "abcdef"); err != nil {
+		t.Errorf("verifyChartDigest() error = %v for a chart without digest", err)
+	}
+	if err := verifyChartDigest("podinfo", "1.2.3", "abcdef", ""); err != nil {
+		t.Errorf("verifyChartDigest() error = %v for an unpinned chart", err)
+	}
+	err := verifyChartDigest("podinfo", "1.2.3", "123456", "abcdef")
+	if want := "chart 'podinfo' version '1.2.3' has digest 'sha256:123456', but is pinned to 'sha256:abcdef'"; err == nil || err.Error() != want {
+		t.Errorf("verifyChartDigest() error = %v, want %s", err, want)
+	}
+}
+
+func TestHelmChartReconciler_indexHelmChartBySource(t *testing.T) {
+	tests := []struct {
+		name      string
+		sourceRef sourcev1.LocalHelmChartSourceReference
+		want      string
+	}{
+		{
+			name:      "same namespace",
+			sourceRef: sourcev1.LocalHelmChartSourceReference{Kind: sourcev1.HelmRepositoryKind, Name: "stable"},
+			want:      "HelmRepository/apps/stable",
+		},
+		{
+			name: "cross-namespace",
+			sourceRef: sourcev1.LocalHelmChartSourceReference{
+				Kind:      sourcev1.GitRepositoryKind,
+				Name:      "charts",
+				Namespace: "flux-system",
+			},
+			want: "GitRepository/flux-system/charts",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chart := &sourcev1.HelmChart{
+				ObjectMeta: metav1.ObjectMeta{Name: "chart", Namespace: "apps"},
+				Spec:       sourcev1.HelmChartSpec{SourceRef: tt.sourceRef},
+			}
+			got := (&HelmChartReconciler{}).indexHelmChartBySource(chart)
+			if len(got) != 1 || got[0] != tt.want {
+				t.Errorf("indexHelmChartBySource() = %v, want [%s]", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/semver/v3"
+	helmchart "helm.sh/helm/v3/pkg/chart"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+// shortCommitLength is the length of the ShortCommit of the chartVersionData.
+const shortCommitLength = 7
+
+// chartVersionData is the data the templates of the
+// v1beta1.HelmChartVersionTemplate are executed with.
+type chartVersionData struct {
+	Version     string
+	AppVersion  string
+	Tag         string
+	Branch      string
+	Commit      string
+	ShortCommit string
+}
+
+// gitChartVersionData returns the chartVersionData of a chart with the given
+// metadata built from the artifact of the given GitRepository, whose revision
+// is in the '<branch>/<commit>' or '<tag>/<commit>' format.
+func gitChartVersionData(repository sourcev1.GitRepository, metadata *helmchart.Metadata) chartVersionData {
+	data := chartVersionData{Version: metadata.Version, AppVersion: metadata.AppVersion}
+	revision := repository.GetArtifact().Revision
+	data.Commit = revision
+	if i := strings.LastIndex(revision, "/"); i >= 0 {
+		data.Commit = revision[i+1:]
+		if ref := repository.Spec.Reference; ref != nil && (ref.SemVer != "" || ref.Tag != "") {
+			data.Tag = revision[:i]
+		} else {
+			data.Branch = revision[:i]
+		}
+	}
+	data.ShortCommit = data.Commit
+	if len(data.ShortCommit) > shortCommitLength {
+		data.ShortCommit = data.ShortCommit[:shortCommitLength]
+	}
+	return data
+}
+
+// templateChartVersion sets the version and the appVersion of the given chart
+// loaded from the artifact of the given source, according to the
+// VersionTemplate of the v1beta1.HelmChart. The chart is left unchanged
+// unless the source is a GitRepository. It returns true if the metadata of
+// the chart changed, for it to be packaged again.
+func templateChartVersion(chart sourcev1.HelmChart, source sourcev1.Source, helmChart *helmchart.Chart) (bool, error) {
+	repository, ok := source.(*sourcev1.GitRepository)
+	tmpl := chart.Spec.VersionTemplate
+	if !ok || tmpl == nil || repository.GetArtifact() == nil || helmChart.Metadata == nil {
+		return false, nil
+	}
+	data := gitChartVersionData(*repository, helmChart.Metadata)
+
+	version, err := executeVersionTemplate("version", tmpl.Version, data)
+	if err != nil {
+		return false, err
+	}
+	if version != "" {
+		if _, err := semver.NewVersion(version); err != nil {
+			return false, fmt.Errorf("invalid chart version '%s' from template: %w", version, err)
+		}
+	}
+	appVersion, err := executeVersionTemplate("appVersion", tmpl.AppVersion, data)
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	if version != "" && version != helmChart.Metadata.Version {
+		helmChart.Metadata.Version = version
+		changed = true
+	}
+	if appVersion != "" && appVersion != helmChart.Metadata.AppVersion {
+		helmChart.Metadata.AppVersion = appVersion
+		changed = true
+	}
+	return changed, nil
+}
+
+// executeVersionTemplate executes the given template with the given data. It
+// returns an empty string if the template is empty.
+func executeVersionTemplate(name, text string, data chartVersionData) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("%s template error: %w", name, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
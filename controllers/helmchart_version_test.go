@@ -0,0 +1,127 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	helmchart "helm.sh/helm/v3/pkg/chart"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+func Test_templateChartVersion(t *testing.T) {
+	const commit = "8f3a1b2c4d5e6f708192a3b4c5d6e7f809102132"
+
+	tests := []struct {
+		name           string
+		source         sourcev1.Source
+		template       *sourcev1.HelmChartVersionTemplate
+		wantChanged    bool
+		wantVersion    string
+		wantAppVersion string
+		wantErr        bool
+	}{
+		{
+			name:        "short commit",
+			source:      gitSource(nil, "main/"+commit),
+			template:    &sourcev1.HelmChartVersionTemplate{Version: "0.0.0-{{ .ShortCommit }}"},
+			wantChanged: true, wantVersion: "0.0.0-8f3a1b2", wantAppVersion: "1.0.0",
+		},
+		{
+			name:   "tag",
+			source: gitSource(&sourcev1.GitRepositoryRef{SemVer: "1.x"}, "v1.2.0/"+commit),
+			template: &sourcev1.HelmChartVersionTemplate{
+				Version:    "{{ .Version }}+{{ .Commit }}",
+				AppVersion: "{{ .Tag }}",
+			},
+			wantChanged: true, wantVersion: "0.1.0+" + commit, wantAppVersion: "v1.2.0",
+		},
+		{
+			name:        "branch",
+			source:      gitSource(nil, "release/1.x/"+commit),
+			template:    &sourcev1.HelmChartVersionTemplate{AppVersion: "{{ .Branch }}-{{ .AppVersion }}"},
+			wantChanged: true, wantVersion: "0.1.0", wantAppVersion: "release/1.x-1.0.0",
+		},
+		{
+			name:        "unchanged",
+			source:      gitSource(nil, "main/"+commit),
+			template:    &sourcev1.HelmChartVersionTemplate{Version: "{{ .Version }}"},
+			wantVersion: "0.1.0", wantAppVersion: "1.0.0",
+		},
+		{
+			name:        "no template",
+			source:      gitSource(nil, "main/"+commit),
+			wantVersion: "0.1.0", wantAppVersion: "1.0.0",
+		},
+		{
+			name: "bucket",
+			source: &sourcev1.Bucket{Status: sourcev1.BucketStatus{
+				Artifact: &sourcev1.Artifact{Revision: commit},
+			}},
+			template:    &sourcev1.HelmChartVersionTemplate{Version: "0.0.0-{{ .ShortCommit }}"},
+			wantVersion: "0.1.0", wantAppVersion: "1.0.0",
+		},
+		{
+			name:     "invalid version",
+			source:   gitSource(nil, "main/"+commit),
+			template: &sourcev1.HelmChartVersionTemplate{Version: "{{ .Branch }}"},
+			wantErr:  true,
+		},
+		{
+			name:     "unknown field",
+			source:   gitSource(nil, "main/"+commit),
+			template: &sourcev1.HelmChartVersionTemplate{Version: "0.0.0-{{ .SHA }}"},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid template",
+			source:   gitSource(nil, "main/"+commit),
+			template: &sourcev1.HelmChartVersionTemplate{AppVersion: "{{ .Tag"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chart := sourcev1.HelmChart{Spec: sourcev1.HelmChartSpec{VersionTemplate: tt.template}}
+			helmChart := &helmchart.Chart{Metadata: &helmchart.Metadata{Name: "podinfo", Version: "0.1.0", AppVersion: "1.0.0"}}
+			changed, err := templateChartVersion(chart, tt.source, helmChart)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("templateChartVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("templateChartVersion() = %v, want %v", changed, tt.wantChanged)
+			}
+			if got := helmChart.Metadata.Version; got != tt.wantVersion {
+				t.Errorf("Version = %q, want %q", got, tt.wantVersion)
+			}
+			if got := helmChart.Metadata.AppVersion; got != tt.wantAppVersion {
+				t.Errorf("AppVersion = %q, want %q", got, tt.wantAppVersion)
+			}
+		})
+	}
+}
+
+func gitSource(ref *sourcev1.GitRepositoryRef, revision string) *sourcev1.GitRepository {
+	return &sourcev1.GitRepository{
+		Spec:   sourcev1.GitRepositorySpec{Reference: ref},
+		Status: sourcev1.GitRepositoryStatus{Artifact: &sourcev1.Artifact{Revision: revision}},
+	}
+}
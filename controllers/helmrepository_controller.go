@@ -19,12 +19,13 @@ package controllers
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
 	"time"
 
 	"github.com/go-logr/logr"
-	"helm.sh/helm/v3/pkg/getter"
+	helmgetter "helm.sh/helm/v3/pkg/getter"
 	corev1 "k8s.io/api/core/v1"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -36,7 +37,10 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 	"sigs.k8s.io/yaml"
 
 	"github.com/fluxcd/pkg/apis/meta"
@@ -45,7 +49,16 @@ import (
 	"github.com/fluxcd/pkg/runtime/predicates"
 
 	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"github.com/fluxcd/source-controller/internal/eventlimit"
 	"github.com/fluxcd/source-controller/internal/helm"
+	"github.com/fluxcd/source-controller/internal/index"
+	sourcemetrics "github.com/fluxcd/source-controller/internal/metrics"
+	"github.com/fluxcd/source-controller/internal/policy"
+	"github.com/fluxcd/source-controller/internal/rewrite"
+	"github.com/fluxcd/source-controller/internal/spiffe"
+	"github.com/fluxcd/source-controller/internal/tracing"
+	"github.com/fluxcd/source-controller/pkg/helm/getter"
+	"github.com/fluxcd/source-controller/pkg/retry"
 )
 
 // +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=helmrepositories,verbs=get;list;watch;create;update;patch;delete
@@ -56,16 +69,39 @@ import (
 // HelmRepositoryReconciler reconciles a HelmRepository object
 type HelmRepositoryReconciler struct {
 	client.Client
+	APIReader             client.Reader
+	requeueDependency     time.Duration
+	intervalJitter        int
 	Scheme                *runtime.Scheme
 	Storage               *Storage
-	Getters               getter.Providers
+	Getters               helmgetter.Providers
 	EventRecorder         kuberecorder.EventRecorder
 	ExternalEventRecorder *events.Recorder
 	MetricsRecorder       *metrics.Recorder
+	OperationsRecorder    *sourcemetrics.Recorder
+	ArtifactIndex         *index.Index
+	EndpointPolicy        *policy.Policy
+	URLRewriter           *rewrite.Rewriter
+	EventLimiter          *eventlimit.Limiter
+	ClientIdentity        *spiffe.X509SVIDSource
+
+	// HTTPHeaders are the headers sent with the requests to the Helm
+	// repositories, unless overridden in their spec.
+	HTTPHeaders map[string]string
+	// DownloadRetry retries the downloads of the indexes which fail with a
+	// transient error. Disabled when nil.
+	DownloadRetry *retry.Policy
+	// IndexLimits bounds the size and the number of chart versions of the
+	// indexes of the Helm repositories.
+	IndexLimits helm.IndexLimits
 }
 
 type HelmRepositoryReconcilerOptions struct {
-	MaxConcurrentReconciles int
+	MaxConcurrentReconciles   int
+	DependencyRequeueInterval time.Duration
+	// IntervalJitterPercentage is the maximum percentage of the interval
+	// of a source its reconciliations are randomly advanced or delayed by.
+	IntervalJitterPercentage int
 }
 
 func (r *HelmRepositoryReconciler) SetupWithManager(mgr ctrl.Manager) error {
@@ -73,8 +109,19 @@ func (r *HelmRepositoryReconciler) SetupWithManager(mgr ctrl.Manager) error {
 }
 
 func (r *HelmRepositoryReconciler) SetupWithManagerAndOptions(mgr ctrl.Manager, opts HelmRepositoryReconcilerOptions) error {
+	if r.APIReader == nil {
+		r.APIReader = mgr.GetAPIReader()
+	}
+
+	r.requeueDependency = opts.DependencyRequeueInterval
+	r.intervalJitter = opts.IntervalJitterPercentage
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&sourcev1.HelmRepository{}).
+		Watches(
+			&source.Kind{Type: &sourcev1.HelmChart{}},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForHelmChartChange),
+		).
 		WithEventFilter(predicate.Or(predicate.GenerationChangedPredicate{}, predicates.ReconcileRequestedPredicate{})).
 		WithOptions(controller.Options{MaxConcurrentReconciles: opts.MaxConcurrentReconciles}).
 		Complete(r)
@@ -106,9 +153,41 @@ func (r *HelmRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	// Return early if the object is suspended.
 	if repository.Spec.Suspend {
 		log.Info("Reconciliation is suspended for this object")
+		if repository.Spec.SuspendArtifact == sourcev1.SuspendArtifactWithdraw {
+			return r.withdrawArtifact(ctx, req, repository)
+		}
+		// sign the URLs of the kept artifact again before they expire
+		if requeueAfter := r.Storage.signedURLRequeueAfter(0); requeueAfter > 0 && repository.GetArtifact() != nil {
+			if err := r.updateStatus(ctx, req, repository.Status); err != nil {
+				log.Error(err, "unable to update status")
+				return ctrl.Result{Requeue: true}, err
+			}
+			return ctrl.Result{RequeueAfter: requeueAfter}, nil
+		}
 		return ctrl.Result{}, nil
 	}
 
+	// check dependencies
+	if len(repository.Spec.DependsOn) > 0 {
+		if err := checkSourceDependencies(ctx, r, repository.Namespace, repository.Spec.DependsOn); err != nil {
+			repository = sourcev1.HelmRepositoryNotReady(repository, meta.DependencyNotReadyReason, err.Error())
+			repository.Status.LastFailure = sourceFailure(&repository, err)
+			repository.Status.NextReconcileAt = nextReconcileAt(r.requeueDependency)
+			if err := r.updateStatus(ctx, req, repository.Status); err != nil {
+				log.Error(err, "unable to update status for dependency not ready")
+				return ctrl.Result{Requeue: true}, err
+			}
+			// we can't rely on exponential backoff because it will prolong the execution too much,
+			// instead we requeue on a fix interval.
+			msg := fmt.Sprintf("Dependencies do not meet ready condition, retrying in %s", r.requeueDependency.String())
+			log.Info(msg)
+			r.event(ctx, repository, events.EventSeverityInfo, msg)
+			r.recordReadiness(ctx, repository)
+			return ctrl.Result{RequeueAfter: r.requeueDependency}, nil
+		}
+		log.Info("All dependencies are ready, proceeding with reconciliation")
+	}
+
 	// record reconciliation duration
 	if r.MetricsRecorder != nil {
 		objRef, err := reference.GetReference(r.Scheme, &repository)
@@ -141,7 +220,22 @@ func (r *HelmRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	}
 
 	// reconcile repository by downloading the index.yaml file
+	ctx, span := tracing.Start(ctx, "reconcile", tracing.ObjectAttributes(sourcev1.HelmRepositoryKind, repository.Namespace, repository.Name)...)
 	reconciledRepository, reconcileErr := r.reconcile(ctx, *repository.DeepCopy())
+	tracing.End(span, reconcileErr)
+	// record the failure of the reconciliation in a structured form
+	reconciledRepository.Status.LastFailure = sourceFailure(&reconciledRepository, reconcileErr)
+
+	// check if the artifact has been updated within the stale after duration
+	staleMsg := setArtifactOutdated(&reconciledRepository, reconciledRepository.GetArtifact(), reconciledRepository.Spec.StaleAfter)
+
+	// record when the next reconciliation is scheduled, the failures being
+	// retried with an exponential backoff
+	var requeueAfter time.Duration
+	if reconcileErr == nil {
+		requeueAfter = r.Storage.signedURLRequeueAfter(jitterInterval(repository.GetInterval().Duration, r.intervalJitter))
+	}
+	reconciledRepository.Status.NextReconcileAt = nextReconcileAt(requeueAfter)
 
 	// update status with the reconciliation result
 	if err := r.updateStatus(ctx, req, reconciledRepository.Status); err != nil {
@@ -149,6 +243,11 @@ func (r *HelmRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		return ctrl.Result{Requeue: true}, err
 	}
 
+	// emit a warning event once the artifact is outdated
+	if staleMsg != "" {
+		r.event(ctx, reconciledRepository, events.EventSeverityError, staleMsg)
+	}
+
 	// if reconciliation failed, record the failure and requeue immediately
 	if reconcileErr != nil {
 		r.event(ctx, reconciledRepository, events.EventSeverityError, reconcileErr.Error())
@@ -161,21 +260,24 @@ func (r *HelmRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		r.event(ctx, reconciledRepository, events.EventSeverityInfo, sourcev1.HelmRepositoryReadyMessage(reconciledRepository))
 	}
 	r.recordReadiness(ctx, reconciledRepository)
+	indexArtifact(r.ArtifactIndex, r.Storage, sourcev1.HelmRepositoryKind, reconciledRepository.Namespace, reconciledRepository.Name, reconciledRepository.GetArtifact())
+	recordArtifactRevision(r.OperationsRecorder, sourcev1.HelmRepositoryKind, reconciledRepository.Namespace, reconciledRepository.Name, repository.GetArtifact(), reconciledRepository.GetArtifact())
 
 	log.Info(fmt.Sprintf("Reconciliation finished in %s, next run in %s",
 		time.Now().Sub(start).String(),
-		repository.GetInterval().Duration.String(),
+		requeueAfter.String(),
 	))
 
-	return ctrl.Result{RequeueAfter: repository.GetInterval().Duration}, nil
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
 }
 
 func (r *HelmRepositoryReconciler) reconcile(ctx context.Context, repository sourcev1.HelmRepository) (sourcev1.HelmRepository, error) {
-	clientOpts := []getter.Option{
-		getter.WithURL(repository.Spec.URL),
-		getter.WithTimeout(repository.Spec.Timeout.Duration),
-		getter.WithPassCredentialsAll(repository.Spec.PassCredentials),
+	// check the endpoint against the policy
+	if err := r.EndpointPolicy.Check(repository.Namespace, repository.Spec.URL); err != nil {
+		return sourcev1.HelmRepositoryNotReady(repository, sourcev1.PolicyViolationReason, err.Error()), err
 	}
+
+	var authSecret *corev1.Secret
 	if repository.Spec.SecretRef != nil {
 		name := types.NamespacedName{
 			Namespace: repository.GetNamespace(),
@@ -188,31 +290,43 @@ func (r *HelmRepositoryReconciler) reconcile(ctx context.Context, repository sou
 			err = fmt.Errorf("auth secret error: %w", err)
 			return sourcev1.HelmRepositoryNotReady(repository, sourcev1.AuthenticationFailedReason, err.Error()), err
 		}
+		authSecret = &secret
+	}
 
-		opts, cleanup, err := helm.ClientOptionsFromSecret(secret)
+	var verifier helm.IndexVerifier
+	if repository.Spec.Verification != nil {
+		v, err := r.indexVerifier(ctx, repository)
 		if err != nil {
-			err = fmt.Errorf("auth options error: %w", err)
-			return sourcev1.HelmRepositoryNotReady(repository, sourcev1.AuthenticationFailedReason, err.Error()), err
+			return sourcev1.HelmRepositoryNotReady(repository, sourcev1.VerificationFailedReason, err.Error()), err
 		}
-		defer cleanup()
-		clientOpts = append(clientOpts, opts...)
+		verifier = v
 	}
 
-	chartRepo, err := helm.NewChartRepository(repository.Spec.URL, r.Getters, clientOpts)
+	chartRepo, failedRepository, err := r.downloadIndex(ctx, repository, authSecret, verifier)
 	if err != nil {
-		switch err.(type) {
-		case *url.Error:
-			return sourcev1.HelmRepositoryNotReady(repository, sourcev1.URLInvalidReason, err.Error()), err
-		default:
-			return sourcev1.HelmRepositoryNotReady(repository, sourcev1.IndexationFailedReason, err.Error()), err
+		// retry immediately with fresh credentials if the auth secret
+		// has been rotated while downloading the index
+		rotated := rotatedSecret(ctx, r.APIReader, authSecret)
+		if rotated == nil {
+			return failedRepository, err
+		}
+		if chartRepo, failedRepository, err = r.downloadIndex(ctx, repository, rotated, verifier); err != nil {
+			return failedRepository, err
 		}
 	}
-	if err := chartRepo.DownloadIndex(); err != nil {
-		err = fmt.Errorf("failed to download repository index: %w", err)
-		return sourcev1.HelmRepositoryNotReady(repository, sourcev1.IndexationFailedReason, err.Error()), err
+	setFetchFailed(&repository, nil, "")
+
+	index := chartRepo.Index
+	if repository.Spec.FilterIndex {
+		charts, err := r.requestedCharts(ctx, repository)
+		if err != nil {
+			err = fmt.Errorf("unable to list the HelmCharts of the repository: %w", err)
+			return sourcev1.HelmRepositoryNotReady(repository, sourcev1.IndexationFailedReason, err.Error()), err
+		}
+		index = helm.FilterIndex(index, charts)
 	}
 
-	indexBytes, err := yaml.Marshal(&chartRepo.Index)
+	indexBytes, err := yaml.Marshal(index)
 	if err != nil {
 		return sourcev1.HelmRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
 	}
@@ -225,7 +339,7 @@ func (r *HelmRepositoryReconciler) reconcile(ctx context.Context, repository sou
 	if apimeta.IsStatusConditionTrue(repository.Status.Conditions, meta.ReadyCondition) && repository.GetArtifact().HasRevision(artifact.Revision) {
 		if artifact.URL != repository.GetArtifact().URL {
 			r.Storage.SetArtifactURL(repository.GetArtifact())
-			repository.Status.URL = r.Storage.SetHostname(repository.Status.URL)
+			repository.Status.URL = r.Storage.SetLinkURL(*repository.GetArtifact(), repository.Status.URL)
 		}
 		return repository, nil
 	}
@@ -246,7 +360,10 @@ func (r *HelmRepositoryReconciler) reconcile(ctx context.Context, repository sou
 	defer unlock()
 
 	// save artifact to storage
-	if err := r.Storage.AtomicWriteFile(&artifact, bytes.NewReader(indexBytes), 0644); err != nil {
+	_, span := tracing.Start(ctx, "store")
+	err = r.Storage.AtomicWriteFile(&artifact, bytes.NewReader(indexBytes), 0644)
+	tracing.End(span, err)
+	if err != nil {
 		err = fmt.Errorf("unable to write repository index file: %w", err)
 		return sourcev1.HelmRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
 	}
@@ -262,6 +379,119 @@ func (r *HelmRepositoryReconciler) reconcile(ctx context.Context, repository sou
 	return sourcev1.HelmRepositoryReady(repository, artifact, indexURL, sourcev1.IndexationSucceededReason, message), nil
 }
 
+// indexVerifier returns the helm.IndexVerifier for the verification of the
+// given v1beta1.HelmRepository, trusting the public keys of its Secret.
+func (r *HelmRepositoryReconciler) indexVerifier(ctx context.Context, repository sourcev1.HelmRepository) (helm.IndexVerifier, error) {
+	name := types.NamespacedName{
+		Namespace: repository.GetNamespace(),
+		Name:      repository.Spec.Verification.SecretRef.Name,
+	}
+	var secret corev1.Secret
+	if err := r.Client.Get(ctx, name, &secret); err != nil {
+		return nil, fmt.Errorf("PGP public keys secret error: %w", err)
+	}
+
+	var keyRings [][]byte
+	for _, b := range secret.Data {
+		keyRings = append(keyRings, b)
+	}
+	verifier, err := helm.NewSignatureVerifier(keyRings...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid '%s' secret data: %w", secret.Name, err)
+	}
+	return verifier, nil
+}
+
+// downloadIndex downloads the index of the given v1beta1.HelmRepository,
+// authenticating with the given secret and verifying the index with the given
+// verifier if not nil. On failure, it returns the v1beta1.HelmRepository
+// marked as not ready.
+func (r *HelmRepositoryReconciler) downloadIndex(ctx context.Context, repository sourcev1.HelmRepository, secret *corev1.Secret, verifier helm.IndexVerifier) (*helm.ChartRepository, sourcev1.HelmRepository, error) {
+	// download from the mirror of the URL if rewritten
+	repositoryURL := r.URLRewriter.Rewrite(repository.Spec.URL)
+	clientOpts := []helmgetter.Option{
+		helmgetter.WithURL(repositoryURL),
+		helmgetter.WithTimeout(repository.Spec.Timeout.Duration),
+		helmgetter.WithPassCredentialsAll(repository.Spec.PassCredentials),
+	}
+	clientOpts = append(clientOpts, clientIdentityOptions(r.ClientIdentity, secret)...)
+	if secret != nil {
+		opts, cleanup, err := getter.ClientOptionsFromSecret(*secret)
+		if err != nil {
+			err = fmt.Errorf("auth options error: %w", err)
+			return nil, sourcev1.HelmRepositoryNotReady(repository, sourcev1.AuthenticationFailedReason, err.Error()), err
+		}
+		defer cleanup()
+		clientOpts = append(clientOpts, opts...)
+	}
+
+	chartRepo, err := helm.NewChartRepository(repositoryURL, helmGetters(r.Getters, r.HTTPHeaders, repository.Spec.Headers), clientOpts)
+	if err != nil {
+		switch err.(type) {
+		case *url.Error:
+			return nil, sourcev1.HelmRepositoryNotReady(repository, sourcev1.URLInvalidReason, err.Error()), err
+		default:
+			return nil, sourcev1.HelmRepositoryNotReady(repository, sourcev1.IndexationFailedReason, err.Error()), err
+		}
+	}
+	chartRepo.Verifier = verifier
+	chartRepo.Retry = r.DownloadRetry
+	chartRepo.IndexLimits = r.IndexLimits
+	fetchDone := r.OperationsRecorder.RecordFetch(sourcev1.HelmRepositoryKind)
+	_, span := tracing.Start(ctx, "download")
+	err = chartRepo.DownloadIndex()
+	tracing.End(span, err)
+	fetchDone()
+	if err != nil {
+		if errors.Is(err, helm.ErrIndexVerification) {
+			return nil, sourcev1.HelmRepositoryNotReady(repository, sourcev1.VerificationFailedReason, err.Error()), err
+		}
+		err = fmt.Errorf("failed to download repository index: %w", err)
+		reason := setFetchFailed(&repository, err, sourcev1.IndexationFailedReason)
+		r.OperationsRecorder.RecordFetchFailure(sourcev1.HelmRepositoryKind, reason)
+		return nil, sourcev1.HelmRepositoryNotReady(repository, sourcev1.IndexationFailedReason, err.Error()), err
+	}
+	return chartRepo, repository, nil
+}
+
+// requestedCharts returns the charts requested by the HelmCharts referencing
+// the given v1beta1.HelmRepository, a map of chart names to versions.
+func (r *HelmRepositoryReconciler) requestedCharts(ctx context.Context, repository sourcev1.HelmRepository) (map[string][]string, error) {
+	// the charts of other namespaces may reference the repository
+	var list sourcev1.HelmChartList
+	if err := r.List(ctx, &list); err != nil {
+		return nil, err
+	}
+	charts := make(map[string][]string)
+	for _, chart := range list.Items {
+		if chart.Spec.SourceRef.Kind == sourcev1.HelmRepositoryKind && chart.Spec.SourceRef.Name == repository.GetName() &&
+			chart.GetSourceNamespace() == repository.GetNamespace() {
+			version, _ := splitChartDigest(chart.Spec.Version)
+			charts[chart.Spec.Chart] = append(charts[chart.Spec.Chart], version)
+		}
+	}
+	return charts, nil
+}
+
+// requestsForHelmChartChange returns a request for the HelmRepository the
+// given HelmChart refers to, if it filters its index by the requested charts.
+func (r *HelmRepositoryReconciler) requestsForHelmChartChange(o client.Object) []reconcile.Request {
+	chart, ok := o.(*sourcev1.HelmChart)
+	if !ok {
+		panic(fmt.Sprintf("Expected a HelmChart, got %T", o))
+	}
+	if chart.Spec.SourceRef.Kind != sourcev1.HelmRepositoryKind {
+		return nil
+	}
+
+	name := types.NamespacedName{Namespace: chart.GetSourceNamespace(), Name: chart.Spec.SourceRef.Name}
+	var repository sourcev1.HelmRepository
+	if err := r.Get(context.Background(), name, &repository); err != nil || !repository.Spec.FilterIndex {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: name}}
+}
+
 func (r *HelmRepositoryReconciler) reconcileDelete(ctx context.Context, repository sourcev1.HelmRepository) (ctrl.Result, error) {
 	// Our finalizer is still present, so lets handle garbage collection
 	if err := r.gc(repository); err != nil {
@@ -273,6 +503,8 @@ func (r *HelmRepositoryReconciler) reconcileDelete(ctx context.Context, reposito
 
 	// Record deleted status
 	r.recordReadiness(ctx, repository)
+	unindexArtifact(r.ArtifactIndex, sourcev1.HelmRepositoryKind, repository.Namespace, repository.Name)
+	r.OperationsRecorder.DeleteArtifactRevision(sourcev1.HelmRepositoryKind, repository.Namespace, repository.Name)
 
 	// Remove our finalizer from the list and update it
 	controllerutil.RemoveFinalizer(&repository, sourcev1.SourceFinalizer)
@@ -284,6 +516,29 @@ func (r *HelmRepositoryReconciler) reconcileDelete(ctx context.Context, reposito
 	return ctrl.Result{}, nil
 }
 
+// withdrawArtifact removes the artifacts of the given suspended HelmRepository
+// from the storage and its status, for the consumers to stop receiving them.
+func (r *HelmRepositoryReconciler) withdrawArtifact(ctx context.Context, req ctrl.Request, repository sourcev1.HelmRepository) (ctrl.Result, error) {
+	if artifactWithdrawn(&repository, repository.Status.ObservedGeneration) {
+		return ctrl.Result{}, nil
+	}
+	if err := withdrawArtifacts(ctx, r.Client, r.Scheme, r.Storage, sourcev1.HelmRepositoryKind, &repository, nil); err != nil {
+		r.event(ctx, repository, events.EventSeverityError, err.Error())
+		return ctrl.Result{Requeue: true}, err
+	}
+	unindexArtifact(r.ArtifactIndex, sourcev1.HelmRepositoryKind, repository.Namespace, repository.Name)
+	r.OperationsRecorder.DeleteArtifactRevision(sourcev1.HelmRepositoryKind, repository.Namespace, repository.Name)
+
+	repository = sourcev1.HelmRepositoryWithdrawn(repository)
+	if err := r.updateStatus(ctx, req, repository.Status); err != nil {
+		logr.FromContext(ctx).Error(err, "unable to update status")
+		return ctrl.Result{Requeue: true}, err
+	}
+	r.event(ctx, repository, events.EventSeverityInfo, withdrawnMessage)
+	r.recordReadiness(ctx, repository)
+	return ctrl.Result{}, nil
+}
+
 // resetStatus returns a modified v1beta1.HelmRepository and a boolean indicating
 // if the status field has been reset.
 func (r *HelmRepositoryReconciler) resetStatus(repository sourcev1.HelmRepository) (sourcev1.HelmRepository, bool) {
@@ -303,18 +558,29 @@ func (r *HelmRepositoryReconciler) resetStatus(repository sourcev1.HelmRepositor
 // It removes all but the current artifact except for when the
 // deletion timestamp is set, which will result in the removal of
 // all artifacts for the resource.
-func (r *HelmRepositoryReconciler) gc(repository sourcev1.HelmRepository) error {
+func (r *HelmRepositoryReconciler) gc(repository sourcev1.HelmRepository) (err error) {
+	defer func() {
+		r.OperationsRecorder.RecordGC(sourcev1.HelmRepositoryKind, err)
+	}()
 	if !repository.DeletionTimestamp.IsZero() {
 		return r.Storage.RemoveAll(r.Storage.NewArtifactFor(repository.Kind, repository.GetObjectMeta(), "", "*"))
 	}
 	if repository.GetArtifact() != nil {
-		return r.Storage.RemoveAllButCurrent(*repository.GetArtifact())
+		var keep []sourcev1.Artifact
+		if repository.Spec.CacheCharts {
+			keep = cachedCharts(r.Storage, repository)
+		}
+		return r.Storage.RemoveAllButCurrent(*repository.GetArtifact(), keep...)
 	}
 	return nil
 }
 
 // event emits a Kubernetes event and forwards the event to notification controller if configured
 func (r *HelmRepositoryReconciler) event(ctx context.Context, repository sourcev1.HelmRepository, severity, msg string) {
+	if !r.EventLimiter.Allow(sourcev1.HelmRepositoryKind+"/"+repository.Namespace+"/"+repository.Name, severity, msg) {
+		return
+	}
+
 	log := logr.FromContext(ctx)
 	if r.EventRecorder != nil {
 		r.EventRecorder.Eventf(&repository, "Normal", severity, msg)
@@ -361,6 +627,7 @@ func (r *HelmRepositoryReconciler) updateStatus(ctx context.Context, req ctrl.Re
 
 	patch := client.MergeFrom(repository.DeepCopy())
 	repository.Status = newStatus
+	repository.Status.URL = r.Storage.resignURLs(repository.Status.URL, repository.Status.Artifact)
 
 	return r.Status().Patch(ctx, &repository, patch)
 }
@@ -383,3 +650,15 @@ func (r *HelmRepositoryReconciler) recordSuspension(ctx context.Context, hr sour
 		r.MetricsRecorder.RecordSuspend(*objRef, hr.Spec.Suspend)
 	}
 }
+
+// clientIdentityOptions returns the getter options presenting the given
+// client identity, if not nil, to a chart repository with the given Secret.
+func clientIdentityOptions(identity *spiffe.X509SVIDSource, secret *corev1.Secret) []helmgetter.Option {
+	if identity == nil {
+		return nil
+	}
+	if opt := getter.ClientIdentityOption(identity.CertFile(), identity.KeyFile(), secret); opt != nil {
+		return []helmgetter.Option{opt}
+	}
+	return nil
+}
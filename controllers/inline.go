@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+// inlineArtifact embeds the given artifact of the given source in the
+// Kubernetes API according to the given v1beta1.SourceInline, and returns its
+// v1beta1.InlineArtifact. It returns nil if the inlining is disabled or the
+// artifact is larger than the maximum size. The embedding is skipped if the
+// given previous v1beta1.InlineArtifact is already the one of the artifact,
+// and the ConfigMap of the previous one is deleted once it is no longer used.
+func inlineArtifact(ctx context.Context, c client.Client, scheme *runtime.Scheme, storage *Storage, obj client.Object,
+	inline *sourcev1.SourceInline, artifact *sourcev1.Artifact, previous *sourcev1.InlineArtifact) (*sourcev1.InlineArtifact, error) {
+	var inlined *sourcev1.InlineArtifact
+	if inline != nil && artifact != nil {
+		mode := inline.Mode
+		if mode == "" {
+			mode = sourcev1.InlineStatusMode
+		}
+		if previous != nil && previous.Revision == artifact.Revision && previous.Checksum == artifact.Checksum &&
+			(previous.ConfigMapRef != nil) == (mode == sourcev1.InlineConfigMapMode) {
+			return previous, nil
+		}
+		maxSize := inline.MaxSize
+		if maxSize <= 0 {
+			maxSize = sourcev1.DefaultInlineMaxSize
+		}
+
+		localPath := storage.LocalPath(*artifact)
+		fi, err := os.Stat(localPath)
+		if err != nil {
+			return nil, err
+		}
+		if fi.Size() <= maxSize {
+			data, err := os.ReadFile(localPath)
+			if err != nil {
+				return nil, err
+			}
+			inlined = &sourcev1.InlineArtifact{Revision: artifact.Revision, Checksum: artifact.Checksum}
+			switch mode {
+			case sourcev1.InlineConfigMapMode:
+				name, err := inlineConfigMapName(obj, scheme)
+				if err != nil {
+					return nil, err
+				}
+				configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: obj.GetNamespace(), Name: name}}
+				if _, err := controllerutil.CreateOrUpdate(ctx, c, configMap, func() error {
+					configMap.BinaryData = map[string][]byte{sourcev1.InlineArtifactKey: data}
+					return controllerutil.SetControllerReference(obj, configMap, scheme)
+				}); err != nil {
+					return nil, fmt.Errorf("unable to write inline artifact ConfigMap '%s': %w", name, err)
+				}
+				inlined.ConfigMapRef = &meta.LocalObjectReference{Name: name}
+			default:
+				inlined.Content = data
+			}
+		}
+	}
+
+	if previous != nil && previous.ConfigMapRef != nil && (inlined == nil || inlined.ConfigMapRef == nil) {
+		configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: obj.GetNamespace(), Name: previous.ConfigMapRef.Name}}
+		if err := c.Delete(ctx, configMap); err != nil && !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("unable to delete inline artifact ConfigMap '%s': %w", configMap.Name, err)
+		}
+	}
+	return inlined, nil
+}
+
+// inlineConfigMapName returns the name of the ConfigMap the artifacts of the
+// given source are embedded in, '<name>-<kind>-artifact'.
+func inlineConfigMapName(obj client.Object, scheme *runtime.Scheme) (string, error) {
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%s-artifact", obj.GetName(), strings.ToLower(gvk.Kind)), nil
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+func Test_inlineArtifact(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := sourcev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	storage, err := NewStorage(t.TempDir(), "hostname", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repository := &sourcev1.GitRepository{ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "default", UID: "uid"}}
+	artifact := storage.NewArtifactFor(sourcev1.GitRepositoryKind, repository, "main/363a6a8", "363a6a8.tar.gz")
+	content := []byte("tarball")
+	if err := storage.MkdirAll(artifact); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(storage.LocalPath(artifact), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	artifact.Checksum = "1234"
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(repository).Build()
+	ctx := context.TODO()
+
+	got, err := inlineArtifact(ctx, c, scheme, storage, repository, nil, &artifact, nil)
+	if err != nil || got != nil {
+		t.Errorf("inlineArtifact() = %v, %v, want nil when disabled", got, err)
+	}
+
+	got, err = inlineArtifact(ctx, c, scheme, storage, repository, &sourcev1.SourceInline{}, &artifact, nil)
+	if err != nil {
+		t.Fatalf("inlineArtifact() error = %v", err)
+	}
+	if got == nil || !bytes.Equal(got.Content, content) || got.Revision != artifact.Revision || got.ConfigMapRef != nil {
+		t.Errorf("inlineArtifact() = %+v, want the content embedded in the status", got)
+	}
+
+	got, err = inlineArtifact(ctx, c, scheme, storage, repository, &sourcev1.SourceInline{MaxSize: 4}, &artifact, nil)
+	if err != nil || got != nil {
+		t.Errorf("inlineArtifact() = %v, %v, want nil for an artifact above the maximum size", got, err)
+	}
+
+	inline := &sourcev1.SourceInline{Mode: sourcev1.InlineConfigMapMode}
+	previous, err := inlineArtifact(ctx, c, scheme, storage, repository, inline, &artifact, nil)
+	if err != nil {
+		t.Fatalf("inlineArtifact() error = %v", err)
+	}
+	if previous == nil || previous.ConfigMapRef == nil || previous.Content != nil {
+		t.Fatalf("inlineArtifact() = %+v, want a ConfigMap reference", previous)
+	}
+	name := types.NamespacedName{Namespace: "default", Name: previous.ConfigMapRef.Name}
+	if name.Name != "podinfo-gitrepository-artifact" {
+		t.Errorf("ConfigMap name = %s, want podinfo-gitrepository-artifact", name.Name)
+	}
+	var configMap corev1.ConfigMap
+	if err := c.Get(ctx, name, &configMap); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(configMap.BinaryData[sourcev1.InlineArtifactKey], content) {
+		t.Errorf("ConfigMap data = %q, want %q", configMap.BinaryData[sourcev1.InlineArtifactKey], content)
+	}
+	if len(configMap.OwnerReferences) != 1 || configMap.OwnerReferences[0].Name != "podinfo" {
+		t.Errorf("ConfigMap owner references = %v, want the GitRepository", configMap.OwnerReferences)
+	}
+
+	got, err = inlineArtifact(ctx, c, scheme, storage, repository, nil, &artifact, previous)
+	if err != nil || got != nil {
+		t.Errorf("inlineArtifact() = %v, %v, want nil when disabled", got, err)
+	}
+	if err := c.Get(ctx, name, &configMap); !apierrors.IsNotFound(err) {
+		t.Errorf("ConfigMap not deleted once disabled: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+// defaultPackTimeout is the default timeout of the sources, as defaulted by
+// the API server.
+const defaultPackTimeout = 20 * time.Second
+
+// Pack fetches the content of the given GitRepository or Bucket and archives
+// it in the given Storage, the way its reconciliation does, and returns the
+// resulting artifact. The status of the source is ignored, and the defaults
+// of its spec are applied as the API server does. The Secrets the source
+// refers to are read with the given client.
+func Pack(ctx context.Context, c client.Client, scheme *runtime.Scheme, storage *Storage, obj client.Object) (*sourcev1.Artifact, error) {
+	if logr.FromContext(ctx) == nil {
+		ctx = logr.NewContext(ctx, logr.Discard())
+	}
+	var artifact *sourcev1.Artifact
+	switch o := obj.(type) {
+	case *sourcev1.GitRepository:
+		repository := *o.DeepCopy()
+		repository.Status = sourcev1.GitRepositoryStatus{}
+		if len(repository.Spec.Include) > 0 {
+			return nil, fmt.Errorf("unable to pack GitRepository '%s': the included repositories are not supported", repository.Name)
+		}
+		if repository.Spec.Timeout == nil {
+			repository.Spec.Timeout = &metav1.Duration{Duration: defaultPackTimeout}
+		}
+		if repository.Spec.GitImplementation == "" {
+			repository.Spec.GitImplementation = sourcev1.GoGitImplementation
+		}
+		r := &GitRepositoryReconciler{Client: c, Scheme: scheme, Storage: storage}
+		packed, err := r.reconcile(ctx, repository)
+		if err != nil {
+			return nil, err
+		}
+		artifact = packed.GetArtifact()
+	case *sourcev1.Bucket:
+		bucket := *o.DeepCopy()
+		bucket.Status = sourcev1.BucketStatus{}
+		if bucket.Spec.Timeout == nil {
+			bucket.Spec.Timeout = &metav1.Duration{Duration: defaultPackTimeout}
+		}
+		r := &BucketReconciler{Client: c, Scheme: scheme, Storage: storage}
+		packed, err := r.reconcile(ctx, bucket)
+		if err != nil {
+			return nil, err
+		}
+		artifact = packed.GetArtifact()
+	default:
+		return nil, fmt.Errorf("unable to pack %T: only the GitRepository and Bucket sources are supported", obj)
+	}
+	if artifact == nil {
+		return nil, fmt.Errorf("unable to pack %s '%s': no artifact produced", obj.GetObjectKind().GroupVersionKind().Kind, obj.GetName())
+	}
+	return artifact, nil
+}
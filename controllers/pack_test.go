@@ -0,0 +1,131 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+func TestPack(t *testing.T) {
+	objects := map[string]string{
+		".sourceignore": "*.md\n",
+		"deploy.yaml":   "kind: Deployment",
+		"README.md":     "# podinfo",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("list-type") == "2" {
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<ListBucketResult><Name>podinfo</Name><IsTruncated>false</IsTruncated>`)
+			for key := range objects {
+				fmt.Fprintf(w, `<Contents><Key>%s</Key><ETag>&#34;%s&#34;</ETag></Contents>`, key, key)
+			}
+			fmt.Fprint(w, `</ListBucketResult>`)
+			return
+		}
+		content, ok := objects[strings.TrimPrefix(r.URL.Path, "/podinfo/")]
+		if !ok {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("ETag", `"`+content+`"`)
+		w.Header().Set("Last-Modified", time.Unix(0, 0).UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+		fmt.Fprint(w, content)
+	}))
+	defer server.Close()
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := sourcev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "default"},
+		Data:       map[string][]byte{"accesskey": []byte("access"), "secretkey": []byte("secret")},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(secret).Build()
+	storage, err := NewStorage(t.TempDir(), "hostname", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := &sourcev1.Bucket{
+		TypeMeta:   metav1.TypeMeta{Kind: sourcev1.BucketKind},
+		ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "default", UID: "uid"},
+		Spec: sourcev1.BucketSpec{
+			BucketName: "podinfo",
+			Endpoint:   strings.TrimPrefix(server.URL, "http://"),
+			Region:     "us-east-1",
+			Insecure:   true,
+			SecretRef:  &meta.LocalObjectReference{Name: "credentials"},
+		},
+	}
+	artifact, err := Pack(context.TODO(), c, scheme, storage, bucket)
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	toPath := filepath.Join(t.TempDir(), "podinfo")
+	if err := storage.CopyToPath(artifact, "", toPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(toPath, "deploy.yaml")); err != nil {
+		t.Errorf("deploy.yaml not archived: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(toPath, "README.md")); !os.IsNotExist(err) {
+		t.Errorf("README.md archived despite the .sourceignore file: %v", err)
+	}
+	if bucket.Status.Artifact != nil {
+		t.Error("Pack() updated the status of the source")
+	}
+
+	again, err := Pack(context.TODO(), c, scheme, storage, bucket)
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	if again.Revision != artifact.Revision || again.Checksum != artifact.Checksum {
+		t.Errorf("Pack() = %s/%s, want the same revision and checksum %s/%s", again.Revision, again.Checksum, artifact.Revision, artifact.Checksum)
+	}
+
+	if _, err := Pack(context.TODO(), c, scheme, storage, &sourcev1.HelmRepository{}); err == nil {
+		t.Error("Pack() error = nil, want an error for a HelmRepository")
+	}
+	repository := &sourcev1.GitRepository{Spec: sourcev1.GitRepositorySpec{
+		Include: []sourcev1.GitRepositoryInclude{{GitRepositoryRef: meta.LocalObjectReference{Name: "podinfo"}}},
+	}}
+	if _, err := Pack(context.TODO(), c, scheme, storage, repository); err == nil {
+		t.Error("Pack() error = nil, want an error for a GitRepository with includes")
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+const (
+	// maxPreviewEntries is the maximum number of entries listed in a
+	// v1beta1.SourcePreview.
+	maxPreviewEntries = 50
+	// maxPreviewIssues is the maximum number of issues listed in a
+	// v1beta1.SourcePreview.
+	maxPreviewIssues = 20
+	// maxPreviewChangedKeys is the maximum number of object keys listed in
+	// the changes of a v1beta1.SourcePreview.
+	maxPreviewChangedKeys = 100
+)
+
+// previewDir returns the v1beta1.SourcePreview of the artifact with the given
+// revision that Storage.Archive would produce for the given directory and
+// ArchiveFileFilter.
+func (s *Storage) previewDir(dir string, filter ArchiveFileFilter, revision string) (sourcev1.SourcePreview, error) {
+	preview := sourcev1.SourcePreview{
+		Revision:       revision,
+		LastUpdateTime: metav1.Now(),
+	}
+	entries := make(map[string]*sourcev1.SourcePreviewEntry)
+	var issues []string
+	w := s.newArchiveWalker(filter, func(_, reason string) {
+		issues = append(issues, reason)
+	})
+	w.dryRun = true
+	if err := w.Walk(dir, func(p, rel string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// Storage.Archive skips anything that is not a file
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		if filter != nil && filter(p, fi) {
+			return nil
+		}
+
+		name := rel
+		if i := strings.Index(rel, "/"); i >= 0 {
+			name = rel[:i+1]
+		}
+		e, ok := entries[name]
+		if !ok {
+			e = &sourcev1.SourcePreviewEntry{Path: name}
+			entries[name] = e
+		}
+		e.Files++
+		e.Size += fi.Size()
+		preview.Files++
+		preview.Size += fi.Size()
+		return nil
+	}); err != nil {
+		return preview, err
+	}
+
+	for _, e := range entries {
+		preview.Entries = append(preview.Entries, *e)
+	}
+	sort.Slice(preview.Entries, func(i, j int) bool {
+		return preview.Entries[i].Path < preview.Entries[j].Path
+	})
+	if n := len(preview.Entries); n > maxPreviewEntries {
+		preview.Entries = preview.Entries[:maxPreviewEntries]
+		issues = append(issues, fmt.Sprintf("%d more top-level entries are not listed", n-maxPreviewEntries))
+	}
+
+	if preview.Files == 0 {
+		issues = append([]string{"the artifact would hold no files"}, issues...)
+	}
+	if n := len(issues); n > maxPreviewIssues {
+		issues = append(issues[:maxPreviewIssues-1], fmt.Sprintf("%d more issues are not listed", n-maxPreviewIssues+1))
+	}
+	preview.Issues = issues
+	return preview, nil
+}
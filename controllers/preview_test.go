@@ -0,0 +1,87 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"github.com/fluxcd/source-controller/pkg/sourceignore"
+)
+
+func Test_previewDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"README.md":              "readme",
+		"deploy/app.yaml":        "kind: Deployment",
+		"deploy/base/svc.yaml":   "kind: Service",
+		"docs/index.md":          "index",
+		".git/config":            "[core]",
+		"deploy/secret.enc.yaml": "encrypted",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("README.md", filepath.Join(dir, "link.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	domain := strings.Split(dir, string(filepath.Separator))
+	ps := sourceignore.ReadPatterns(strings.NewReader("/docs/\n*.enc.yaml"), domain)
+	preview, err := (&Storage{}).previewDir(dir, SourceIgnoreFilter(ps, domain), "main/1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if preview.Revision != "main/1234" {
+		t.Errorf("Revision = %q, want %q", preview.Revision, "main/1234")
+	}
+	if preview.Files != 3 || preview.Size != int64(len("readme")+len("kind: Deployment")+len("kind: Service")) {
+		t.Errorf("Files = %d, Size = %d", preview.Files, preview.Size)
+	}
+	wantEntries := []sourcev1.SourcePreviewEntry{
+		{Path: "README.md", Files: 1, Size: 6},
+		{Path: "deploy/", Files: 2, Size: int64(len("kind: Deployment") + len("kind: Service"))},
+	}
+	if !reflect.DeepEqual(preview.Entries, wantEntries) {
+		t.Errorf("Entries = %v, want %v", preview.Entries, wantEntries)
+	}
+	wantIssues := []string{"symlink 'link.md' is not included in the artifact"}
+	if !reflect.DeepEqual(preview.Issues, wantIssues) {
+		t.Errorf("Issues = %v, want %v", preview.Issues, wantIssues)
+	}
+}
+
+func Test_previewDir_Empty(t *testing.T) {
+	preview, err := (&Storage{}).previewDir(t.TempDir(), nil, "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Files != 0 || len(preview.Issues) != 1 || preview.Issues[0] != "the artifact would hold no files" {
+		t.Errorf("preview = %+v", preview)
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"github.com/fluxcd/source-controller/internal/oci"
+)
+
+// publishArtifact pushes the given artifact to the OCI repository of the given
+// v1beta1.SourcePublish, tagged with the artifact revision, and returns the
+// '<repository>:<tag>@<digest>' reference of the pushed artifact. The push is
+// skipped if the given published reference is already the one of the
+// artifact revision. It returns an empty reference if the publishing is
+// disabled.
+func publishArtifact(ctx context.Context, c client.Client, storage *Storage, namespace string,
+	publish *sourcev1.SourcePublish, artifact *sourcev1.Artifact, published string) (string, error) {
+	if publish == nil || artifact == nil {
+		return "", nil
+	}
+
+	repository := strings.TrimPrefix(publish.OCIRepository, "oci://")
+	tag := oci.Tag(artifact.Revision)
+	if strings.HasPrefix(published, repository+":"+tag+"@") {
+		return published, nil
+	}
+
+	registry := &oci.Client{Insecure: publish.Insecure}
+	if publish.SecretRef != nil {
+		var secret corev1.Secret
+		name := types.NamespacedName{Namespace: namespace, Name: publish.SecretRef.Name}
+		if err := c.Get(ctx, name, &secret); err != nil {
+			return "", fmt.Errorf("unable to get publish secret '%s': %w", name.String(), err)
+		}
+		username, password, err := registryCredentials(secret, repository)
+		if err != nil {
+			return "", fmt.Errorf("invalid publish secret '%s': %w", name.String(), err)
+		}
+		registry.Username, registry.Password = username, password
+	}
+
+	annotations := map[string]string{
+		"org.opencontainers.image.revision": artifact.Revision,
+		"org.opencontainers.image.created":  artifact.LastUpdateTime.UTC().Format(time.RFC3339),
+	}
+	digest, err := registry.Push(ctx, repository, tag, storage.LocalPath(*artifact), annotations)
+	if err != nil {
+		return "", fmt.Errorf("failed to publish artifact to '%s:%s': %w", repository, tag, err)
+	}
+	return fmt.Sprintf("%s:%s@%s", repository, tag, digest), nil
+}
+
+// registryCredentials returns the credentials of the registry of the given
+// repository held by the given Secret, either in its 'username' and
+// 'password' fields, or in the auths of its '.dockerconfigjson' field.
+func registryCredentials(secret corev1.Secret, repository string) (string, string, error) {
+	if data, ok := secret.Data[corev1.DockerConfigJsonKey]; ok {
+		var config struct {
+			Auths map[string]struct {
+				Username string `json:"username"`
+				Password string `json:"password"`
+				Auth     string `json:"auth"`
+			} `json:"auths"`
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return "", "", fmt.Errorf("invalid '%s': %w", corev1.DockerConfigJsonKey, err)
+		}
+		host := strings.SplitN(repository, "/", 2)[0]
+		hosts := []string{host, "https://" + host}
+		if host == "docker.io" {
+			hosts = append(hosts, "index.docker.io", "https://index.docker.io/v1/")
+		}
+		for _, h := range hosts {
+			auth, ok := config.Auths[h]
+			if !ok {
+				continue
+			}
+			if auth.Auth == "" {
+				return auth.Username, auth.Password, nil
+			}
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return "", "", fmt.Errorf("invalid auth of '%s': %w", h, err)
+			}
+			parts := strings.SplitN(string(decoded), ":", 2)
+			if len(parts) != 2 {
+				return "", "", fmt.Errorf("invalid auth of '%s': missing password", h)
+			}
+			return parts[0], parts[1], nil
+		}
+		return "", "", fmt.Errorf("no auth for '%s' in '%s'", host, corev1.DockerConfigJsonKey)
+	}
+
+	username, password := string(secret.Data["username"]), string(secret.Data["password"])
+	if username == "" || password == "" {
+		return "", "", fmt.Errorf("'username' and 'password' fields are required")
+	}
+	return username, password, nil
+}
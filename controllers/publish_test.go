@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+func Test_registryCredentials(t *testing.T) {
+	auth := base64.StdEncoding.EncodeToString([]byte("flux:t0ken"))
+	tests := []struct {
+		name         string
+		data         map[string]string
+		repository   string
+		wantUsername string
+		wantPassword string
+		wantErr      bool
+	}{
+		{
+			name:         "username and password",
+			data:         map[string]string{"username": "flux", "password": "secret"},
+			repository:   "ghcr.io/org/podinfo",
+			wantUsername: "flux",
+			wantPassword: "secret",
+		},
+		{
+			name:       "missing password",
+			data:       map[string]string{"username": "flux"},
+			repository: "ghcr.io/org/podinfo",
+			wantErr:    true,
+		},
+		{
+			name:         "docker config auth",
+			data:         map[string]string{corev1.DockerConfigJsonKey: `{"auths":{"ghcr.io":{"auth":"` + auth + `"}}}`},
+			repository:   "ghcr.io/org/podinfo",
+			wantUsername: "flux",
+			wantPassword: "t0ken",
+		},
+		{
+			name:         "docker config username and password",
+			data:         map[string]string{corev1.DockerConfigJsonKey: `{"auths":{"https://index.docker.io/v1/":{"username":"flux","password":"secret"}}}`},
+			repository:   "docker.io/org/podinfo",
+			wantUsername: "flux",
+			wantPassword: "secret",
+		},
+		{
+			name:       "docker config of another registry",
+			data:       map[string]string{corev1.DockerConfigJsonKey: `{"auths":{"quay.io":{"auth":"` + auth + `"}}}`},
+			repository: "ghcr.io/org/podinfo",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := corev1.Secret{Data: map[string][]byte{}}
+			for k, v := range tt.data {
+				secret.Data[k] = []byte(v)
+			}
+			username, password, err := registryCredentials(secret, tt.repository)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("registryCredentials() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if username != tt.wantUsername || password != tt.wantPassword {
+				t.Errorf("registryCredentials() = %s, %s, want %s, %s", username, password, tt.wantUsername, tt.wantPassword)
+			}
+		})
+	}
+}
+
+func Test_publishArtifact(t *testing.T) {
+	artifact := &sourcev1.Artifact{Revision: "main/6b7aab8"}
+	publish := &sourcev1.SourcePublish{OCIRepository: "oci://ghcr.io/org/podinfo"}
+
+	got, err := publishArtifact(context.TODO(), nil, nil, "default", nil, artifact, "ghcr.io/org/podinfo:main-1a2b3c4@sha256:00")
+	if err != nil || got != "" {
+		t.Errorf("publishArtifact() = %q, %v, want an empty reference when disabled", got, err)
+	}
+
+	published := "ghcr.io/org/podinfo:main-6b7aab8@sha256:00"
+	got, err = publishArtifact(context.TODO(), nil, nil, "default", publish, artifact, published)
+	if err != nil || got != published {
+		t.Errorf("publishArtifact() = %q, %v, want the reference of the published revision", got, err)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+// minRevisionHintLength is the minimum length of the abbreviated commit SHAs
+// matched by a revision hint.
+const minRevisionHintLength = 7
+
+// revisionHint returns the revision requested with the
+// sourcev1.RequestedRevisionAnnotation of the given object, if any.
+func revisionHint(obj metav1.Object) string {
+	return strings.TrimSpace(obj.GetAnnotations()[sourcev1.RequestedRevisionAnnotation])
+}
+
+// matchesRevisionHint returns true if the given '<branch>/<commit>' or
+// '<tag>/<commit>' revision is the one of the given hint, which is either a
+// revision or a commit SHA, possibly abbreviated.
+func matchesRevisionHint(revision, hint string) bool {
+	if revision == "" || hint == "" {
+		return false
+	}
+	if revision == hint {
+		return true
+	}
+	commit := revision[strings.LastIndex(revision, "/")+1:]
+	hint = strings.ToLower(hint[strings.LastIndex(hint, "/")+1:])
+	return len(hint) >= minRevisionHintLength && strings.HasPrefix(strings.ToLower(commit), hint)
+}
+
+// setRevisionOutdated sets the sourcev1.RevisionOutdatedCondition to 'True'
+// on the object if the given fetched revision does not match the given hint
+// of a new reconciliation request, and removes the condition once the hinted
+// revision, or a revision other than the given previous one, is fetched. The
+// condition is also removed by a new request without a hint. It returns the
+// condition message if it was just set, so the caller only emits a warning
+// event once per request.
+func setRevisionOutdated(obj meta.ObjectWithStatusConditions, hint string, newRequest bool, previous, revision string) string {
+	conditions := obj.GetStatusConditions()
+	if !newRequest {
+		if apimeta.IsStatusConditionTrue(*conditions, sourcev1.RevisionOutdatedCondition) &&
+			(hint == "" || revision != previous || matchesRevisionHint(revision, hint)) {
+			apimeta.RemoveStatusCondition(conditions, sourcev1.RevisionOutdatedCondition)
+		}
+		return ""
+	}
+	if hint == "" || matchesRevisionHint(revision, hint) {
+		apimeta.RemoveStatusCondition(conditions, sourcev1.RevisionOutdatedCondition)
+		return ""
+	}
+
+	msg := fmt.Sprintf("requested revision '%s' not found upstream, fetched revision '%s'", hint, revision)
+	meta.SetResourceCondition(obj, sourcev1.RevisionOutdatedCondition, metav1.ConditionTrue, sourcev1.RevisionNotPropagatedReason, msg)
+	return msg
+}
+
+// fetchedRevision returns the revision last fetched from the upstream of a
+// source, the given pending revision held back by a maintenance window or the
+// revision of the given artifact.
+func fetchedRevision(artifact *sourcev1.Artifact, pendingRevision string) string {
+	if pendingRevision != "" {
+		return pendingRevision
+	}
+	if artifact == nil {
+		return ""
+	}
+	return artifact.Revision
+}
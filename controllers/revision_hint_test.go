@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+func Test_matchesRevisionHint(t *testing.T) {
+	const revision = "main/363a6a8fe6a7f13e05d34c163b0ef02a777da20a"
+
+	tests := []struct {
+		hint string
+		want bool
+	}{
+		{hint: revision, want: true},
+		{hint: "363a6a8fe6a7f13e05d34c163b0ef02a777da20a", want: true},
+		{hint: "363A6A8", want: true},
+		{hint: "main/363a6a8", want: true},
+		{hint: "363a6a", want: false},
+		{hint: "0c9b8a7f6e5d4c3b2a1f0e9d8c7b6a5f4e3d2c1b", want: false},
+		{hint: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hint, func(t *testing.T) {
+			if got := matchesRevisionHint(revision, tt.hint); got != tt.want {
+				t.Errorf("matchesRevisionHint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_setRevisionOutdated(t *testing.T) {
+	const (
+		oldRevision = "main/0c9b8a7f6e5d4c3b2a1f0e9d8c7b6a5f4e3d2c1b"
+		newRevision = "main/363a6a8fe6a7f13e05d34c163b0ef02a777da20a"
+	)
+
+	tests := []struct {
+		name         string
+		outdated     bool
+		hint         string
+		newRequest   bool
+		previous     string
+		revision     string
+		wantMsg      bool
+		wantOutdated bool
+	}{
+		{name: "fetched", hint: "363a6a8", newRequest: true, previous: oldRevision, revision: newRevision},
+		{name: "not fetched", hint: "363a6a8", newRequest: true, previous: oldRevision, revision: oldRevision, wantMsg: true, wantOutdated: true},
+		{name: "no hint", outdated: true, newRequest: true, previous: oldRevision, revision: oldRevision},
+		{name: "still not fetched", outdated: true, hint: "363a6a8", previous: oldRevision, revision: oldRevision, wantOutdated: true},
+		{name: "fetched later", outdated: true, hint: "363a6a8", previous: oldRevision, revision: newRevision},
+		{name: "newer fetched later", outdated: true, hint: "363a6a8", previous: oldRevision, revision: "main/8f3a1b2"},
+		{name: "interval", hint: "363a6a8", previous: oldRevision, revision: "main/8f3a1b2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &sourcev1.GitRepository{}
+			if tt.outdated {
+				meta.SetResourceCondition(obj, sourcev1.RevisionOutdatedCondition, metav1.ConditionTrue, sourcev1.RevisionNotPropagatedReason, "")
+			}
+			msg := setRevisionOutdated(obj, tt.hint, tt.newRequest, tt.previous, tt.revision)
+			if (msg != "") != tt.wantMsg {
+				t.Errorf("setRevisionOutdated() = %q, want message %v", msg, tt.wantMsg)
+			}
+			if got := apimeta.IsStatusConditionTrue(obj.Status.Conditions, sourcev1.RevisionOutdatedCondition); got != tt.wantOutdated {
+				t.Errorf("RevisionOutdated = %v, want %v", got, tt.wantOutdated)
+			}
+		})
+	}
+}
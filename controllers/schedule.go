@@ -0,0 +1,61 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"math/rand"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// nextReconcileAt returns the time of the next reconciliation of a source
+// requeued after the given duration, or nil if it is not requeued after a
+// fixed duration.
+func nextReconcileAt(requeueAfter time.Duration) *metav1.Time {
+	if requeueAfter <= 0 {
+		return nil
+	}
+	// the status times are serialized with a second precision
+	t := metav1.NewTime(time.Now().Add(requeueAfter).Truncate(time.Second))
+	return &t
+}
+
+// MaxIntervalJitterPercentage is the maximum percentage of the interval of a
+// source its reconciliations are randomly advanced or delayed by, for a
+// jittered interval to never fall below half of the interval.
+const MaxIntervalJitterPercentage = 50
+
+// jitterInterval returns the given interval advanced or delayed by a random
+// duration of up to the given percentage of it, for the reconciliations of
+// the sources created at the same time, e.g. from a template, to spread over
+// time instead of recurring in the same second. The interval is returned as
+// is if the percentage is not positive, and the percentage is capped at
+// MaxIntervalJitterPercentage.
+func jitterInterval(interval time.Duration, percentage int) time.Duration {
+	if interval <= 0 || percentage <= 0 {
+		return interval
+	}
+	if percentage > MaxIntervalJitterPercentage {
+		percentage = MaxIntervalJitterPercentage
+	}
+	max := int64(interval) * int64(percentage) / 100
+	if max <= 0 {
+		return interval
+	}
+	return interval + time.Duration(rand.Int63n(2*max+1)-max)
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_nextReconcileAt(t *testing.T) {
+	if got := nextReconcileAt(0); got != nil {
+		t.Errorf("nextReconcileAt(0) = %v, want nil", got)
+	}
+
+	before := time.Now().Truncate(time.Second)
+	got := nextReconcileAt(10 * time.Minute)
+	if got == nil {
+		t.Fatal("nextReconcileAt() = nil, want a time")
+	}
+	if d := got.Sub(before); d < 10*time.Minute || d > 10*time.Minute+time.Second {
+		t.Errorf("nextReconcileAt() = %s, want 10m after %s", got, before)
+	}
+}
+
+func Test_jitterInterval(t *testing.T) {
+	for _, tt := range []struct {
+		interval   time.Duration
+		percentage int
+	}{
+		{interval: 0, percentage: 10},
+		{interval: 10 * time.Minute, percentage: 0},
+		{interval: time.Nanosecond, percentage: 10},
+	} {
+		if got := jitterInterval(tt.interval, tt.percentage); got != tt.interval {
+			t.Errorf("jitterInterval(%s, %d) = %s, want %s", tt.interval, tt.percentage, got, tt.interval)
+		}
+	}
+
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		got := jitterInterval(10*time.Minute, 10)
+		if got < 9*time.Minute || got > 11*time.Minute {
+			t.Fatalf("jitterInterval(10m, 10) = %s, want within 9m and 11m", got)
+		}
+		seen[got] = true
+	}
+	if len(seen) < 2 {
+		t.Error("jitterInterval(10m, 10) returned the same interval every time")
+	}
+
+	// the percentage is capped for the interval not to drop to zero
+	for i := 0; i < 100; i++ {
+		got := jitterInterval(10*time.Minute, 100)
+		if got < 5*time.Minute || got > 15*time.Minute {
+			t.Fatalf("jitterInterval(10m, 100) = %s, want within 5m and 15m", got)
+		}
+	}
+}
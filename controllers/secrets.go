@@ -0,0 +1,95 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// rotatedSecret reads the given Secret from the API server, bypassing the
+// cache, and returns it if its resourceVersion differs from the one of the
+// given Secret. This allows a fetch that failed with credentials which were
+// rotated mid-reconcile to be retried immediately with the fresh ones,
+// instead of waiting for the cache to catch up and the next interval.
+// It returns nil if the Secret has not changed or can not be read.
+func rotatedSecret(ctx context.Context, reader client.Reader, secret *corev1.Secret) *corev1.Secret {
+	if reader == nil || secret == nil {
+		return nil
+	}
+	var latest corev1.Secret
+	if err := reader.Get(ctx, types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}, &latest); err != nil {
+		return nil
+	}
+	if latest.ResourceVersion == secret.ResourceVersion {
+		return nil
+	}
+	return &latest
+}
+
+// cachedClient is a client created from the credentials of a Secret.
+type cachedClient struct {
+	version string
+	client  interface{}
+}
+
+// clientCache holds clients which are expensive to create, like the ones that
+// perform a token exchange on creation. The clients are keyed on the object
+// they were created for, and are only valid for the version they were created
+// with. The version is composed by the caller, and must at least contain the
+// resourceVersion of the Secret the credentials were read from.
+type clientCache struct {
+	mu      sync.Mutex
+	clients map[string]cachedClient
+}
+
+// Get returns the client cached for the given key if it was created with the
+// given version. A client created with a different version is evicted.
+func (c *clientCache) Get(key, version string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.clients[key]
+	if !ok {
+		return nil, false
+	}
+	if cached.version != version {
+		delete(c.clients, key)
+		return nil, false
+	}
+	return cached.client, true
+}
+
+// Set caches the client for the given key and version.
+func (c *clientCache) Set(key, version string, client interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.clients == nil {
+		c.clients = make(map[string]cachedClient)
+	}
+	c.clients[key] = cachedClient{version: version, client: client}
+}
+
+// Delete evicts the client cached for the given key.
+func (c *clientCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.clients, key)
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_rotatedSecret(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "auth", Namespace: "default"},
+		Data:       map[string][]byte{"password": []byte("old")},
+	}
+	reader := fake.NewClientBuilder().WithObjects(secret.DeepCopy()).Build()
+
+	var current corev1.Secret
+	if err := reader.Get(context.TODO(), client.ObjectKeyFromObject(secret), &current); err != nil {
+		t.Fatal(err)
+	}
+	if got := rotatedSecret(context.TODO(), reader, &current); got != nil {
+		t.Errorf("rotatedSecret() = %v, want nil for unchanged secret", got)
+	}
+
+	rotated := current.DeepCopy()
+	rotated.Data["password"] = []byte("new")
+	if err := reader.Update(context.TODO(), rotated); err != nil {
+		t.Fatal(err)
+	}
+	got := rotatedSecret(context.TODO(), reader, &current)
+	if got == nil {
+		t.Fatal("rotatedSecret() = nil, want rotated secret")
+	}
+	if string(got.Data["password"]) != "new" {
+		t.Errorf("rotatedSecret() password = %q, want %q", got.Data["password"], "new")
+	}
+
+	if got := rotatedSecret(context.TODO(), reader, nil); got != nil {
+		t.Errorf("rotatedSecret() = %v, want nil for nil secret", got)
+	}
+	missing := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "missing", Namespace: "default"}}
+	if got := rotatedSecret(context.TODO(), reader, missing); got != nil {
+		t.Errorf("rotatedSecret() = %v, want nil for missing secret", got)
+	}
+}
+
+func Test_clientCache(t *testing.T) {
+	var c clientCache
+
+	if _, ok := c.Get("default/bucket", "1"); ok {
+		t.Fatal("Get() on empty cache returned a client")
+	}
+
+	c.Set("default/bucket", "1", "client")
+	if got, ok := c.Get("default/bucket", "1"); !ok || got != "client" {
+		t.Errorf("Get() = %v, %v, want cached client", got, ok)
+	}
+
+	if _, ok := c.Get("default/bucket", "2"); ok {
+		t.Error("Get() with new version returned the stale client")
+	}
+	if _, ok := c.Get("default/bucket", "1"); ok {
+		t.Error("Get() returned a client evicted for a version mismatch")
+	}
+
+	c.Set("default/bucket", "2", "client")
+	c.Delete("default/bucket")
+	if _, ok := c.Get("default/bucket", "2"); ok {
+		t.Error("Get() returned a deleted client")
+	}
+}
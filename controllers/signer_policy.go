@@ -0,0 +1,143 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"github.com/fluxcd/source-controller/pkg/git"
+)
+
+// signerPolicyKey is the key of the signer policy in the data of the
+// ConfigMap referenced by the verification of a GitRepository.
+const signerPolicyKey = "signers"
+
+// signerRule allows the keys with the given names to sign the changes of the
+// paths matching its pattern.
+type signerRule struct {
+	pattern gitignore.Pattern
+	keys    []string
+}
+
+// hasSignerPolicy returns true if the changes of the given repository are
+// verified against a signer policy.
+func hasSignerPolicy(repository sourcev1.GitRepository) bool {
+	return repository.Spec.Verification != nil && repository.Spec.Verification.SignersRef != nil
+}
+
+// parseSignerPolicy parses the given signer policy in the CODEOWNERS format,
+// each line holding a path pattern in the .gitignore format followed by the
+// names of the keys allowed to sign the changes of the matching paths. A
+// pattern without keys leaves the matching paths unrestricted. The empty lines
+// and the ones starting with '#' are ignored.
+func parseSignerPolicy(policy string) ([]signerRule, error) {
+	var rules []signerRule
+	for i, line := range strings.Split(policy, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if strings.HasPrefix(fields[0], "!") {
+			return nil, fmt.Errorf("line %d: negated pattern '%s' not supported", i+1, fields[0])
+		}
+		rules = append(rules, signerRule{
+			pattern: gitignore.ParsePattern(fields[0], nil),
+			keys:    fields[1:],
+		})
+	}
+	return rules, nil
+}
+
+// unauthorizedPaths returns the given paths the last matching rule of which
+// allows none of the given signers. The paths matching no rule are
+// unrestricted.
+func unauthorizedPaths(rules []signerRule, paths, signers []string) []string {
+	var unauthorized []string
+	for _, p := range paths {
+		var rule *signerRule
+		for i := len(rules) - 1; i >= 0; i-- {
+			if rules[i].pattern.Match(strings.Split(p, "/"), false) == gitignore.Exclude {
+				rule = &rules[i]
+				break
+			}
+		}
+		if rule == nil || len(rule.keys) == 0 || containsAny(rule.keys, signers) {
+			continue
+		}
+		unauthorized = append(unauthorized, p)
+	}
+	return unauthorized
+}
+
+func containsAny(keys, signers []string) bool {
+	for _, k := range keys {
+		for _, s := range signers {
+			if k == s {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifySigners returns an error if the given commit changes paths, since the
+// commit of the current artifact or its parent, that none of the keys of the
+// given secret its signature is verified by are allowed to sign by the signer
+// policy of the given repository.
+func (r *GitRepositoryReconciler) verifySigners(ctx context.Context, repository sourcev1.GitRepository,
+	commit git.Commit, secret corev1.Secret, revision string) error {
+	changes, ok := commit.(git.ChangeCommit)
+	if !ok {
+		return fmt.Errorf("signer policy not supported by the checkout of '%s'", repository.Spec.URL)
+	}
+
+	policyName := types.NamespacedName{
+		Namespace: repository.Namespace,
+		Name:      repository.Spec.Verification.SignersRef.Name,
+	}
+	var configMap corev1.ConfigMap
+	if err := r.Client.Get(ctx, policyName, &configMap); err != nil {
+		return fmt.Errorf("signer policy ConfigMap error: %w", err)
+	}
+	policy, ok := configMap.Data[signerPolicyKey]
+	if !ok {
+		return fmt.Errorf("signer policy ConfigMap '%s' has no '%s' key", policyName, signerPolicyKey)
+	}
+	rules, err := parseSignerPolicy(policy)
+	if err != nil {
+		return fmt.Errorf("signer policy '%s' error: %w", policyName, err)
+	}
+
+	since, _ := previousCommit(repository, revision)
+	paths, err := changes.ChangedFiles(since)
+	if err != nil {
+		return err
+	}
+	signers := changes.Signers(secret)
+	if unauthorized := unauthorizedPaths(rules, paths, signers); len(unauthorized) > 0 {
+		return fmt.Errorf("commit '%s' signed by [%s] changes paths not allowed by the signer policy: %s",
+			commit.Hash(), strings.Join(signers, ", "), strings.Join(unauthorized, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_unauthorizedPaths(t *testing.T) {
+	rules, err := parseSignerPolicy(`
+# default signers
+*               release-team.asc
+
+/charts/        chart-owners.asc release-team.asc
+docs/
+/deploy/prod/** prod-owners.asc
+`)
+	if err != nil {
+		t.Fatalf("parseSignerPolicy() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		paths   []string
+		signers []string
+		want    []string
+	}{
+		{
+			name:    "default signer",
+			paths:   []string{"README.md", "charts/app/Chart.yaml"},
+			signers: []string{"release-team.asc"},
+		},
+		{
+			name:    "path owner",
+			paths:   []string{"charts/app/Chart.yaml", "charts/app/values.yaml"},
+			signers: []string{"chart-owners.asc"},
+		},
+		{
+			name:    "last matching pattern",
+			paths:   []string{"deploy/prod/app.yaml", "deploy/staging/app.yaml"},
+			signers: []string{"release-team.asc"},
+			want:    []string{"deploy/prod/app.yaml"},
+		},
+		{
+			name:    "unrestricted paths",
+			paths:   []string{"docs/index.md"},
+			signers: nil,
+		},
+		{
+			name:    "other signer",
+			paths:   []string{"README.md", "docs/index.md", "charts/app/Chart.yaml"},
+			signers: []string{"prod-owners.asc"},
+			want:    []string{"README.md", "charts/app/Chart.yaml"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unauthorizedPaths(rules, tt.paths, tt.signers); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unauthorizedPaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseSignerPolicy(t *testing.T) {
+	if _, err := parseSignerPolicy("!charts/ owner.asc"); err == nil {
+		t.Error("expected an error for a negated pattern")
+	}
+	rules, err := parseSignerPolicy("\n# comment\n*.yaml a.asc b.asc\n")
+	if err != nil {
+		t.Fatalf("parseSignerPolicy() error = %v", err)
+	}
+	if len(rules) != 1 || !reflect.DeepEqual(rules[0].keys, []string{"a.asc", "b.asc"}) {
+		t.Errorf("parseSignerPolicy() = %+v, want one rule with the keys [a.asc b.asc]", rules)
+	}
+}
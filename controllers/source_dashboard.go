@@ -0,0 +1,239 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/fluxcd/pkg/apis/meta"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+// SourceDashboard serves a read-only summary of the sources of all kinds
+// and namespaces, as an HTML page or as JSON, for the clusters without a
+// monitoring stack.
+type SourceDashboard struct {
+	client.Client
+	Log logr.Logger
+
+	// Addr is the address the dashboard binds to.
+	Addr string
+}
+
+// DashboardEntry is the summary of a source served by the SourceDashboard.
+type DashboardEntry struct {
+	sourcev1.SourceSummary `json:",inline"`
+
+	// Namespace is the namespace of the source.
+	Namespace string `json:"namespace"`
+
+	// Suspended is true if the reconciliation of the source is suspended.
+	Suspended bool `json:"suspended,omitempty"`
+
+	// NextReconcileAt is the estimated time of the next scheduled
+	// reconciliation of the source, not set if it is suspended or only
+	// reconciled on request.
+	NextReconcileAt *metav1.Time `json:"nextReconcileAt,omitempty"`
+}
+
+// DashboardList is the JSON response of the SourceDashboard.
+type DashboardList struct {
+	Sources []DashboardEntry `json:"sources"`
+}
+
+// Start serves the dashboard until the context is done. It implements the
+// manager.Runnable interface.
+func (d *SourceDashboard) Start(ctx context.Context) error {
+	server := &http.Server{Addr: d.Addr, Handler: d}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			d.Log.Error(err, "unable to shut down dashboard")
+		}
+	}()
+	d.Log.Info("starting source dashboard", "addr", d.Addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// NeedLeaderElection implements the manager.LeaderElectionRunnable interface,
+// as every replica can read the sources.
+func (d *SourceDashboard) NeedLeaderElection() bool {
+	return false
+}
+
+// ServeHTTP serves the summary of the sources as JSON if requested with the
+// 'format=json' query parameter or an 'application/json' Accept header, and
+// as an HTML page otherwise. The sources can be filtered with the 'kind' and
+// 'namespace' query parameters.
+func (d *SourceDashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, err := d.list(r.Context(), r.URL.Query().Get("kind"), r.URL.Query().Get("namespace"), time.Now())
+	if err != nil {
+		d.Log.Error(err, "unable to list sources for the dashboard")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(list); err != nil {
+			d.Log.Error(err, "failed to write dashboard response")
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, list); err != nil {
+		d.Log.Error(err, "failed to write dashboard response")
+	}
+}
+
+// list returns the summary of the sources of the given kind in the given
+// namespace, of all kinds and namespaces if empty, sorted by kind, namespace
+// and name.
+func (d *SourceDashboard) list(ctx context.Context, kind, namespace string, now time.Time) (DashboardList, error) {
+	list := DashboardList{Sources: []DashboardEntry{}}
+	for _, k := range sourceSetKinds {
+		if kind != "" && !strings.EqualFold(k, kind) {
+			continue
+		}
+		sources, items := newSourceList(k)
+		if err := d.List(ctx, sources, client.InNamespace(namespace)); err != nil {
+			return list, err
+		}
+		for _, obj := range items() {
+			list.Sources = append(list.Sources, dashboardEntry(k, obj, now))
+		}
+	}
+	sort.SliceStable(list.Sources, func(i, j int) bool {
+		a, b := list.Sources[i], list.Sources[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return list, nil
+}
+
+// dashboardEntry returns the DashboardEntry of the given source of the given
+// kind. The next reconciliation is estimated from the latest of the last
+// transition of its readiness and the time of its artifact, as the sources
+// are reconciled at every interval after their previous reconciliation.
+func dashboardEntry(kind string, obj summarizedSource, now time.Time) DashboardEntry {
+	entry := DashboardEntry{
+		SourceSummary: summarizeSource(kind, obj),
+		Namespace:     obj.GetNamespace(),
+	}
+
+	var interval time.Duration
+	switch o := obj.(type) {
+	case *sourcev1.GitRepository:
+		entry.Suspended = o.Spec.Suspend
+		interval = o.GetRequeueAfter()
+	case *sourcev1.HelmRepository:
+		entry.Suspended = o.Spec.Suspend
+		interval = o.GetInterval().Duration
+	case *sourcev1.HelmChart:
+		entry.Suspended = o.Spec.Suspend
+		interval = o.GetInterval().Duration
+	case *sourcev1.Bucket:
+		entry.Suspended = o.Spec.Suspend
+		interval = o.GetInterval().Duration
+	}
+	if entry.Suspended || interval <= 0 {
+		return entry
+	}
+
+	var last time.Time
+	if c := apimeta.FindStatusCondition(*obj.GetStatusConditions(), meta.ReadyCondition); c != nil {
+		last = c.LastTransitionTime.Time
+	}
+	if entry.LastUpdateTime != nil && entry.LastUpdateTime.After(last) {
+		last = entry.LastUpdateTime.Time
+	}
+	if last.IsZero() {
+		return entry
+	}
+	next := last.Add(interval)
+	if next.Before(now) {
+		next = next.Add(now.Sub(next).Truncate(interval) + interval)
+	}
+	nextReconcileAt := metav1.NewTime(next)
+	entry.NextReconcileAt = &nextReconcileAt
+	return entry
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="30">
+<title>Sources</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.4em; text-align: left; vertical-align: top; }
+.True { color: #2e7d32; }
+.False { color: #c62828; }
+.Unknown { color: #757575; }
+</style>
+</head>
+<body>
+<h1>Sources</h1>
+<table>
+<tr><th>Kind</th><th>Namespace</th><th>Name</th><th>Ready</th><th>Revision</th><th>Last update</th><th>Next reconcile</th><th>Message</th></tr>
+{{- range .Sources }}
+<tr>
+<td>{{ .Kind }}</td>
+<td>{{ .Namespace }}</td>
+<td>{{ .Name }}</td>
+<td class="{{ .Ready }}">{{ .Ready }}{{ if .Suspended }} (suspended){{ end }}</td>
+<td>{{ .Revision }}</td>
+<td>{{ with .LastUpdateTime }}{{ .UTC.Format "2006-01-02 15:04:05Z" }}{{ end }}</td>
+<td>{{ with .NextReconcileAt }}{{ .UTC.Format "2006-01-02 15:04:05Z" }}{{ end }}</td>
+<td>{{ .Reason }}{{ if .Message }}: {{ .Message }}{{ end }}</td>
+</tr>
+{{- end }}
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,128 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/fluxcd/pkg/apis/meta"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+func TestSourceDashboard_ServeHTTP(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := sourcev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	ready := &sourcev1.GitRepository{ObjectMeta: metav1.ObjectMeta{Name: "ready", Namespace: "apps"}}
+	ready.Spec.Interval = metav1.Duration{Duration: time.Minute}
+	ready.Status.Artifact = &sourcev1.Artifact{Revision: "main/1234", LastUpdateTime: metav1.Now()}
+	ready.Status.Conditions = []metav1.Condition{{Type: meta.ReadyCondition, Status: metav1.ConditionTrue, Reason: "Succeeded"}}
+	failing := &sourcev1.Bucket{ObjectMeta: metav1.ObjectMeta{Name: "failing", Namespace: "infra"}}
+	failing.Spec.Interval = metav1.Duration{Duration: time.Minute}
+	failing.Status.Conditions = []metav1.Condition{{Type: meta.ReadyCondition, Status: metav1.ConditionFalse,
+		Reason: "BucketOperationFailed", Message: "<access denied>", LastTransitionTime: metav1.Now()}}
+	suspended := &sourcev1.HelmRepository{ObjectMeta: metav1.ObjectMeta{Name: "suspended", Namespace: "apps"}}
+	suspended.Spec.Interval = metav1.Duration{Duration: time.Minute}
+	suspended.Spec.Suspend = true
+
+	d := &SourceDashboard{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(ready, failing, suspended).Build(),
+		Log:    logr.Discard(),
+	}
+
+	t.Run("json", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		d.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?format=json", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		var list DashboardList
+		if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+			t.Fatal(err)
+		}
+		if len(list.Sources) != 3 {
+			t.Fatalf("got %d sources, want 3: %+v", len(list.Sources), list.Sources)
+		}
+		// sorted by kind, namespace and name
+		failed, git, helm := list.Sources[0], list.Sources[1], list.Sources[2]
+		if failed.Name != "failing" || failed.Ready != metav1.ConditionFalse || failed.Message != "<access denied>" {
+			t.Errorf("unexpected failing entry: %+v", failed)
+		}
+		if failed.NextReconcileAt == nil {
+			t.Error("expected the next reconciliation of the failing source")
+		}
+		if git.Name != "ready" || git.Ready != metav1.ConditionTrue || git.Revision != "main/1234" || git.Message != "" {
+			t.Errorf("unexpected ready entry: %+v", git)
+		}
+		if git.NextReconcileAt == nil || git.NextReconcileAt.Before(&metav1.Time{Time: time.Now()}) {
+			t.Errorf("expected the next reconciliation in the future, got %v", git.NextReconcileAt)
+		}
+		if helm.Name != "suspended" || !helm.Suspended || helm.NextReconcileAt != nil {
+			t.Errorf("unexpected suspended entry: %+v", helm)
+		}
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/?namespace=apps&kind=gitrepository", nil)
+		req.Header.Set("Accept", "application/json")
+		d.ServeHTTP(rec, req)
+		var list DashboardList
+		if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+			t.Fatal(err)
+		}
+		if len(list.Sources) != 1 || list.Sources[0].Name != "ready" {
+			t.Errorf("unexpected sources: %+v", list.Sources)
+		}
+	})
+
+	t.Run("html", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		d.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Errorf("Content-Type = %s, want text/html", ct)
+		}
+		body := rec.Body.String()
+		if !strings.Contains(body, "main/1234") || !strings.Contains(body, "(suspended)") {
+			t.Errorf("missing sources in the page:\n%s", body)
+		}
+		if strings.Contains(body, "<access denied>") {
+			t.Error("the messages of the sources are not escaped")
+		}
+	})
+
+	t.Run("method", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		d.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+		}
+	})
+}
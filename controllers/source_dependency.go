@@ -0,0 +1,114 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/fluxcd/pkg/apis/meta"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+// checkSourceDependencies returns an error if any of the given dependencies
+// of a source in the given namespace has no ready artifact at or above its
+// revision.
+func checkSourceDependencies(ctx context.Context, c client.Reader, namespace string, deps []sourcev1.SourceDependency) error {
+	for _, d := range deps {
+		obj, err := newSourceObject(d.Kind)
+		if err != nil {
+			return err
+		}
+		dName := types.NamespacedName{Namespace: namespace, Name: d.Name}
+		if err := c.Get(ctx, dName, obj); err != nil {
+			return fmt.Errorf("unable to get %s '%s' dependency: %w", d.Kind, dName, err)
+		}
+		if obj.GetGeneration() != observedGeneration(obj) ||
+			!apimeta.IsStatusConditionTrue(*obj.GetStatusConditions(), meta.ReadyCondition) || obj.GetArtifact() == nil {
+			return fmt.Errorf("dependency %s '%s' is not ready", d.Kind, dName)
+		}
+		if revision := obj.GetArtifact().Revision; !revisionAtLeast(revision, d.Revision) {
+			return fmt.Errorf("dependency %s '%s' revision '%s' is not at or above '%s'", d.Kind, dName, revision, d.Revision)
+		}
+	}
+	return nil
+}
+
+// newSourceObject returns an empty source of the given kind.
+func newSourceObject(kind string) (summarizedSource, error) {
+	switch kind {
+	case sourcev1.GitRepositoryKind:
+		return &sourcev1.GitRepository{}, nil
+	case sourcev1.HelmRepositoryKind:
+		return &sourcev1.HelmRepository{}, nil
+	case sourcev1.HelmChartKind:
+		return &sourcev1.HelmChart{}, nil
+	case sourcev1.BucketKind:
+		return &sourcev1.Bucket{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported dependency kind '%s'", kind)
+	}
+}
+
+// observedGeneration returns the generation last observed by the
+// reconciliation of the given source.
+func observedGeneration(obj summarizedSource) int64 {
+	switch o := obj.(type) {
+	case *sourcev1.GitRepository:
+		return o.Status.ObservedGeneration
+	case *sourcev1.HelmRepository:
+		return o.Status.ObservedGeneration
+	case *sourcev1.HelmChart:
+		return o.Status.ObservedGeneration
+	case *sourcev1.Bucket:
+		return o.Status.ObservedGeneration
+	default:
+		return 0
+	}
+}
+
+// revisionAtLeast returns true if the given revision of an artifact is at or
+// above the given minimum revision, as documented by
+// sourcev1.SourceDependency. Any revision is at or above an empty one.
+func revisionAtLeast(revision, min string) bool {
+	if min == "" || revision == min {
+		return true
+	}
+	// the Git revisions are '<branch or tag>/<commit>'
+	name, commit := revision, ""
+	if i := strings.LastIndex(revision, "/"); i >= 0 {
+		name, commit = revision[:i], revision[i+1:]
+	}
+	if len(min) >= 7 && strings.HasPrefix(commit, min) {
+		return true
+	}
+	v, err := semver.NewVersion(name)
+	if err != nil {
+		return false
+	}
+	minVersion, err := semver.NewVersion(min)
+	if err != nil {
+		return false
+	}
+	return !v.LessThan(minVersion)
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/fluxcd/pkg/apis/meta"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+func Test_revisionAtLeast(t *testing.T) {
+	tests := []struct {
+		revision string
+		min      string
+		want     bool
+	}{
+		{revision: "main/363a6a8fe6a7f13e05d34c163b0ef02a777da20a", min: "", want: true},
+		{revision: "main/363a6a8fe6a7f13e05d34c163b0ef02a777da20a", min: "main/363a6a8fe6a7f13e05d34c163b0ef02a777da20a", want: true},
+		{revision: "main/363a6a8fe6a7f13e05d34c163b0ef02a777da20a", min: "363a6a8", want: true},
+		{revision: "main/363a6a8fe6a7f13e05d34c163b0ef02a777da20a", min: "363", want: false},
+		{revision: "main/363a6a8fe6a7f13e05d34c163b0ef02a777da20a", min: "1.0.0", want: false},
+		{revision: "v1.2.0/363a6a8fe6a7f13e05d34c163b0ef02a777da20a", min: "v1.1.0", want: true},
+		{revision: "v1.2.0/363a6a8fe6a7f13e05d34c163b0ef02a777da20a", min: "1.2.0", want: true},
+		{revision: "v1.2.0/363a6a8fe6a7f13e05d34c163b0ef02a777da20a", min: "v1.3.0", want: false},
+		{revision: "6.0.1", min: "6.0.0", want: true},
+		{revision: "6.0.0-rc.1", min: "6.0.0", want: false},
+		{revision: "c3ab8ff13720e8ad9047dd39466b3c8974e592c2df383d0a7f7a5e2a1fd6a4b7", min: "6.0.0", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.revision+">="+tt.min, func(t *testing.T) {
+			if got := revisionAtLeast(tt.revision, tt.min); got != tt.want {
+				t.Errorf("revisionAtLeast() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_checkSourceDependencies(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := sourcev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	ready := []metav1.Condition{{Type: meta.ReadyCondition, Status: metav1.ConditionTrue, Reason: "Succeeded"}}
+
+	podinfo := &sourcev1.GitRepository{ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "default", Generation: 2}}
+	podinfo.Status.ObservedGeneration = 2
+	podinfo.Status.Conditions = ready
+	podinfo.Status.Artifact = &sourcev1.Artifact{Revision: "v1.2.0/363a6a8fe6a7f13e05d34c163b0ef02a777da20a"}
+	pending := &sourcev1.GitRepository{ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "default", Generation: 2}}
+	pending.Status.ObservedGeneration = 1
+	pending.Status.Conditions = ready
+	pending.Status.Artifact = podinfo.Status.Artifact
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(podinfo, pending).Build()
+
+	tests := []struct {
+		name    string
+		deps    []sourcev1.SourceDependency
+		wantErr bool
+	}{
+		{
+			name: "ready",
+			deps: []sourcev1.SourceDependency{{Kind: sourcev1.GitRepositoryKind, Name: "podinfo", Revision: "v1.0.0"}},
+		},
+		{
+			name:    "revision below",
+			deps:    []sourcev1.SourceDependency{{Kind: sourcev1.GitRepositoryKind, Name: "podinfo", Revision: "v2.0.0"}},
+			wantErr: true,
+		},
+		{
+			name:    "generation not observed",
+			deps:    []sourcev1.SourceDependency{{Kind: sourcev1.GitRepositoryKind, Name: "pending"}},
+			wantErr: true,
+		},
+		{
+			name:    "not found",
+			deps:    []sourcev1.SourceDependency{{Kind: sourcev1.BucketKind, Name: "podinfo"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSourceDependencies(context.TODO(), c, "default", tt.deps)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkSourceDependencies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"github.com/fluxcd/source-controller/internal/policy"
+)
+
+// SourceValidatorPath is the path the SourceValidator is served on by the
+// webhook server of the manager.
+const SourceValidatorPath = "/validate-source-toolkit-fluxcd-io-v1beta1"
+
+// SourceValidator is an admission webhook rejecting the v1beta1 sources
+// referencing an endpoint the EndpointPolicy does not allow, and the Buckets
+// with a spec that can't succeed, so that they are denied before being
+// reconciled. Both are still enforced by the reconcilers, for the clusters
+// without the webhook, and as the policy applies to the endpoints found while
+// fetching, e.g. the URLs of the Git submodules and of the chart dependencies.
+type SourceValidator struct {
+	EndpointPolicy *policy.Policy
+
+	decoder *admission.Decoder
+}
+
+// InjectDecoder implements admission.DecoderInjector.
+func (v *SourceValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle implements admission.Handler.
+func (v *SourceValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	var obj runtime.Object
+	switch req.Kind.Kind {
+	case sourcev1.GitRepositoryKind:
+		obj = &sourcev1.GitRepository{}
+	case sourcev1.BucketKind:
+		obj = &sourcev1.Bucket{}
+	case sourcev1.HelmRepositoryKind:
+		obj = &sourcev1.HelmRepository{}
+	case sourcev1.HelmChartKind:
+		obj = &sourcev1.HelmChart{}
+	default:
+		return admission.Allowed("")
+	}
+	if err := v.decoder.Decode(req, obj); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	var warnings []string
+	if bucket, ok := obj.(*sourcev1.Bucket); ok {
+		if err := validateBucketSpec(*bucket); err != nil {
+			return admission.Denied(fmt.Sprintf("%s: %s", sourcev1.BucketSpecInvalidReason, err))
+		}
+		warnings = bucketSpecWarnings(*bucket)
+	}
+	for _, endpoint := range sourceEndpoints(obj) {
+		if err := v.EndpointPolicy.Check(req.Namespace, endpoint); err != nil {
+			return admission.Denied(fmt.Sprintf("%s: %s", sourcev1.PolicyViolationReason, err))
+		}
+	}
+	return admission.Allowed("").WithWarnings(warnings...)
+}
+
+// sourceEndpoints returns the endpoints of the spec of the given source
+// checked against the EndpointPolicy.
+func sourceEndpoints(obj runtime.Object) []string {
+	switch o := obj.(type) {
+	case *sourcev1.GitRepository:
+		if o.Spec.BundleURL != "" {
+			return []string{o.Spec.URL, o.Spec.BundleURL}
+		}
+		return []string{o.Spec.URL}
+	case *sourcev1.Bucket:
+		return []string{o.Spec.Endpoint + "/" + o.Spec.BucketName}
+	case *sourcev1.HelmRepository:
+		return []string{o.Spec.URL}
+	case *sourcev1.HelmChart:
+		if o.Spec.ChartRef != nil {
+			return []string{o.Spec.ChartRef.URL}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"github.com/fluxcd/source-controller/internal/policy"
+)
+
+func TestSourceValidator_Handle(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := sourcev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &SourceValidator{
+		EndpointPolicy: &policy.Policy{Rules: []policy.Rule{
+			{Namespaces: []string{"team-*"}, Allow: []string{"github.com/ourorg/*", "charts.ourorg.com/*"}},
+			{Deny: []string{"*.amazonaws.com/*"}},
+		}},
+	}
+	if err := v.InjectDecoder(decoder); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		kind      string
+		obj       runtime.Object
+		allowed   bool
+		warnings  int
+	}{
+		{
+			name:      "allowed Git URL",
+			namespace: "team-a",
+			kind:      sourcev1.GitRepositoryKind,
+			obj: &sourcev1.GitRepository{
+				Spec: sourcev1.GitRepositorySpec{URL: "https://github.com/ourorg/podinfo"},
+			},
+			allowed: true,
+		},
+		{
+			name:      "Git URL not allowed",
+			namespace: "team-a",
+			kind:      sourcev1.GitRepositoryKind,
+			obj: &sourcev1.GitRepository{
+				Spec: sourcev1.GitRepositorySpec{URL: "https://github.com/otherorg/podinfo"},
+			},
+		},
+		{
+			name:      "Git bundle URL not allowed",
+			namespace: "team-a",
+			kind:      sourcev1.GitRepositoryKind,
+			obj: &sourcev1.GitRepository{
+				Spec: sourcev1.GitRepositorySpec{
+					URL:       "https://github.com/ourorg/podinfo",
+					BundleURL: "https://cdn.example.com/podinfo.bundle",
+				},
+			},
+		},
+		{
+			name:      "denied bucket",
+			namespace: "default",
+			kind:      sourcev1.BucketKind,
+			obj: &sourcev1.Bucket{
+				Spec: sourcev1.BucketSpec{Endpoint: "s3.amazonaws.com", BucketName: "podinfo"},
+			},
+		},
+		{
+			name:      "allowed bucket",
+			namespace: "default",
+			kind:      sourcev1.BucketKind,
+			obj: &sourcev1.Bucket{
+				Spec: sourcev1.BucketSpec{Endpoint: "minio.internal:9000", BucketName: "podinfo"},
+			},
+			allowed: true,
+		},
+		{
+			name:      "invalid bucket spec",
+			namespace: "default",
+			kind:      sourcev1.BucketKind,
+			obj: &sourcev1.Bucket{
+				Spec: sourcev1.BucketSpec{Provider: sourcev1.GenericBucketProvider, Endpoint: "storage.googleapis.com", BucketName: "podinfo", Insecure: true},
+			},
+		},
+		{
+			name:      "aws bucket on minio",
+			namespace: "default",
+			kind:      sourcev1.BucketKind,
+			obj: &sourcev1.Bucket{
+				Spec: sourcev1.BucketSpec{Provider: sourcev1.AmazonBucketProvider, Endpoint: "minio.internal:9000", BucketName: "podinfo"},
+			},
+			allowed:  true,
+			warnings: 1,
+		},
+		{
+			name:      "Helm repository URL not allowed",
+			namespace: "team-a",
+			kind:      sourcev1.HelmRepositoryKind,
+			obj: &sourcev1.HelmRepository{
+				Spec: sourcev1.HelmRepositorySpec{URL: "https://charts.bitnami.com/bitnami"},
+			},
+		},
+		{
+			name:      "Helm chart URL not allowed",
+			namespace: "team-a",
+			kind:      sourcev1.HelmChartKind,
+			obj: &sourcev1.HelmChart{
+				Spec: sourcev1.HelmChartSpec{
+					ChartRef: &sourcev1.HelmChartURLReference{URL: "https://example.com/podinfo-6.0.0.tgz"},
+				},
+			},
+		},
+		{
+			name:      "Helm chart from a repository",
+			namespace: "team-a",
+			kind:      sourcev1.HelmChartKind,
+			obj: &sourcev1.HelmChart{
+				Spec: sourcev1.HelmChartSpec{Chart: "podinfo"},
+			},
+			allowed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := json.Marshal(tt.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp := v.Handle(context.TODO(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Group: sourcev1.GroupVersion.Group, Version: sourcev1.GroupVersion.Version, Kind: tt.kind},
+				Namespace: tt.namespace,
+				Operation: admissionv1.Create,
+				Object:    runtime.RawExtension{Raw: raw},
+			}})
+			if resp.Allowed != tt.allowed {
+				t.Errorf("Handle() allowed = %v, want %v: %v", resp.Allowed, tt.allowed, resp.Result)
+			}
+			if len(resp.Warnings) != tt.warnings {
+				t.Errorf("Handle() warnings = %v, want %d", resp.Warnings, tt.warnings)
+			}
+		})
+	}
+}
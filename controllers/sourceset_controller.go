@@ -0,0 +1,296 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	"github.com/fluxcd/pkg/runtime/predicates"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+// +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=sourcesets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=sourcesets/status,verbs=get;update;patch
+
+// sourceSetKinds are the kinds of the sources aggregated by the SourceSets.
+var sourceSetKinds = []string{
+	sourcev1.GitRepositoryKind,
+	sourcev1.HelmRepositoryKind,
+	sourcev1.HelmChartKind,
+	sourcev1.BucketKind,
+}
+
+// SourceSetReconciler reconciles a SourceSet object by summarizing the
+// status of its sources.
+type SourceSetReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+type SourceSetReconcilerOptions struct {
+	MaxConcurrentReconciles int
+}
+
+func (r *SourceSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return r.SetupWithManagerAndOptions(mgr, SourceSetReconcilerOptions{})
+}
+
+func (r *SourceSetReconciler) SetupWithManagerAndOptions(mgr ctrl.Manager, opts SourceSetReconcilerOptions) error {
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&sourcev1.SourceSet{}, builder.WithPredicates(
+			predicate.Or(predicate.GenerationChangedPredicate{}, predicates.ReconcileRequestedPredicate{}),
+		))
+	// the status updates of the sources are not filtered out, as they change
+	// the summary
+	for _, obj := range []client.Object{
+		&sourcev1.GitRepository{},
+		&sourcev1.HelmRepository{},
+		&sourcev1.HelmChart{},
+		&sourcev1.Bucket{},
+	} {
+		b = b.Watches(
+			&source.Kind{Type: obj},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForSourceChange),
+		)
+	}
+	return b.WithOptions(controller.Options{MaxConcurrentReconciles: opts.MaxConcurrentReconciles}).
+		Complete(r)
+}
+
+func (r *SourceSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	var set sourcev1.SourceSet
+	if err := r.Get(ctx, req.NamespacedName, &set); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// Return early if the object is suspended.
+	if set.Spec.Suspend {
+		log.Info("Reconciliation is suspended for this object")
+		return ctrl.Result{}, nil
+	}
+
+	status, err := r.summarize(ctx, set)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if v, ok := meta.ReconcileAnnotationValue(set.GetAnnotations()); ok {
+		status.SetLastHandledReconcileRequest(v)
+	}
+
+	patch := client.MergeFrom(set.DeepCopy())
+	set.Status = status
+	if err := r.Status().Patch(ctx, &set, patch); err != nil {
+		log.Error(err, "unable to update status")
+		return ctrl.Result{Requeue: true}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// summarize returns the status of the given SourceSet summarizing its
+// sources.
+func (r *SourceSetReconciler) summarize(ctx context.Context, set sourcev1.SourceSet) (sourcev1.SourceSetStatus, error) {
+	status := sourcev1.SourceSetStatus{
+		ObservedGeneration:     set.Generation,
+		Conditions:             set.Status.Conditions,
+		ReconcileRequestStatus: set.Status.ReconcileRequestStatus,
+	}
+
+	selector := labels.Everything()
+	if set.Spec.Selector != nil {
+		var err error
+		if selector, err = metav1.LabelSelectorAsSelector(set.Spec.Selector); err != nil {
+			meta.SetResourceCondition(&set, meta.ReadyCondition, metav1.ConditionFalse, sourcev1.SelectorInvalidReason, err.Error())
+			status.Conditions = set.Status.Conditions
+			return status, nil
+		}
+	}
+
+	for _, kind := range sourceSetKinds {
+		if !sourceSetHasKind(set, kind) {
+			continue
+		}
+		list, items := newSourceList(kind)
+		if err := r.List(ctx, list, client.InNamespace(set.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			return status, fmt.Errorf("unable to list %s sources: %w", kind, err)
+		}
+		for _, obj := range items() {
+			summary := summarizeSource(kind, obj)
+			switch summary.Ready {
+			case metav1.ConditionTrue:
+				status.Ready++
+			case metav1.ConditionFalse:
+				status.Failed++
+			}
+			status.Sources = append(status.Sources, summary)
+		}
+	}
+	status.Total = len(status.Sources)
+	sort.SliceStable(status.Sources, func(i, j int) bool {
+		if status.Sources[i].Kind != status.Sources[j].Kind {
+			return status.Sources[i].Kind < status.Sources[j].Kind
+		}
+		return status.Sources[i].Name < status.Sources[j].Name
+	})
+
+	set.Status.Conditions = status.Conditions
+	if status.Ready == status.Total {
+		meta.SetResourceCondition(&set, meta.ReadyCondition, metav1.ConditionTrue, sourcev1.SourcesReadyReason,
+			fmt.Sprintf("%d sources ready", status.Total))
+	} else {
+		meta.SetResourceCondition(&set, meta.ReadyCondition, metav1.ConditionFalse, sourcev1.SourcesNotReadyReason,
+			fmt.Sprintf("%d of %d sources not ready, %d failed", status.Total-status.Ready, status.Total, status.Failed))
+	}
+	status.Conditions = set.Status.Conditions
+	return status, nil
+}
+
+// requestsForSourceChange returns a request for every SourceSet in the
+// namespace of the given source which selects it.
+func (r *SourceSetReconciler) requestsForSourceChange(o client.Object) []reconcile.Request {
+	gvk, err := apiutil.GVKForObject(o, r.Scheme)
+	if err != nil {
+		return nil
+	}
+	kind := gvk.Kind
+
+	var sets sourcev1.SourceSetList
+	if err := r.List(context.Background(), &sets, client.InNamespace(o.GetNamespace())); err != nil {
+		return nil
+	}
+	var reqs []reconcile.Request
+	for _, set := range sets.Items {
+		if set.Spec.Suspend || !sourceSetHasKind(set, kind) {
+			continue
+		}
+		if set.Spec.Selector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(set.Spec.Selector)
+			if err != nil || !selector.Matches(labels.Set(o.GetLabels())) {
+				continue
+			}
+		}
+		reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: set.Namespace, Name: set.Name}})
+	}
+	return reqs
+}
+
+// sourceSetHasKind returns true if the given SourceSet aggregates the sources
+// of the given kind.
+func sourceSetHasKind(set sourcev1.SourceSet, kind string) bool {
+	if len(set.Spec.Kinds) == 0 {
+		return true
+	}
+	for _, k := range set.Spec.Kinds {
+		if string(k) == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// summarizedSource is a source whose status can be summarized.
+type summarizedSource interface {
+	client.Object
+	sourcev1.Source
+	GetStatusConditions() *[]metav1.Condition
+}
+
+// newSourceList returns an empty list of the sources of the given kind, and
+// a function returning its items once filled.
+func newSourceList(kind string) (client.ObjectList, func() []summarizedSource) {
+	switch kind {
+	case sourcev1.GitRepositoryKind:
+		list := &sourcev1.GitRepositoryList{}
+		return list, func() []summarizedSource {
+			items := make([]summarizedSource, len(list.Items))
+			for i := range list.Items {
+				items[i] = &list.Items[i]
+			}
+			return items
+		}
+	case sourcev1.HelmRepositoryKind:
+		list := &sourcev1.HelmRepositoryList{}
+		return list, func() []summarizedSource {
+			items := make([]summarizedSource, len(list.Items))
+			for i := range list.Items {
+				items[i] = &list.Items[i]
+			}
+			return items
+		}
+	case sourcev1.HelmChartKind:
+		list := &sourcev1.HelmChartList{}
+		return list, func() []summarizedSource {
+			items := make([]summarizedSource, len(list.Items))
+			for i := range list.Items {
+				items[i] = &list.Items[i]
+			}
+			return items
+		}
+	default:
+		list := &sourcev1.BucketList{}
+		return list, func() []summarizedSource {
+			items := make([]summarizedSource, len(list.Items))
+			for i := range list.Items {
+				items[i] = &list.Items[i]
+			}
+			return items
+		}
+	}
+}
+
+// summarizeSource returns the sourcev1.SourceSummary of the given source of
+// the given kind.
+func summarizeSource(kind string, obj summarizedSource) sourcev1.SourceSummary {
+	summary := sourcev1.SourceSummary{
+		Kind:  kind,
+		Name:  obj.GetName(),
+		Ready: metav1.ConditionUnknown,
+	}
+	if c := apimeta.FindStatusCondition(*obj.GetStatusConditions(), meta.ReadyCondition); c != nil {
+		summary.Ready = c.Status
+		if c.Status != metav1.ConditionTrue {
+			summary.Reason = c.Reason
+			summary.Message = c.Message
+		}
+	}
+	if artifact := obj.GetArtifact(); artifact != nil {
+		summary.Revision = artifact.Revision
+		lastUpdateTime := artifact.LastUpdateTime
+		summary.LastUpdateTime = &lastUpdateTime
+	}
+	return summary
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/fluxcd/pkg/apis/meta"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+func TestSourceSetReconciler_summarize(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := sourcev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	objectMeta := func(name string, labels map[string]string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels}
+	}
+	ready := []metav1.Condition{{Type: meta.ReadyCondition, Status: metav1.ConditionTrue, Reason: "Succeeded"}}
+	failed := []metav1.Condition{{Type: meta.ReadyCondition, Status: metav1.ConditionFalse, Reason: "Failed", Message: "boom"}}
+	team := map[string]string{"team": "a"}
+
+	podinfo := &sourcev1.GitRepository{ObjectMeta: objectMeta("podinfo", team)}
+	podinfo.Status.Conditions = ready
+	podinfo.Status.Artifact = &sourcev1.Artifact{Revision: "main/1234"}
+	broken := &sourcev1.GitRepository{ObjectMeta: objectMeta("broken", team)}
+	broken.Status.Conditions = failed
+	charts := &sourcev1.HelmRepository{ObjectMeta: objectMeta("charts", team)}
+	other := &sourcev1.Bucket{ObjectMeta: objectMeta("other", map[string]string{"team": "b"})}
+	other.Status.Conditions = ready
+
+	r := &SourceSetReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(podinfo, broken, charts, other).Build(),
+		Scheme: scheme,
+	}
+
+	tests := []struct {
+		name       string
+		spec       sourcev1.SourceSetSpec
+		wantNames  []string
+		wantReady  int
+		wantFailed int
+		wantReason string
+	}{
+		{
+			name:       "all sources",
+			wantNames:  []string{"Bucket/other", "GitRepository/broken", "GitRepository/podinfo", "HelmRepository/charts"},
+			wantReady:  2,
+			wantFailed: 1,
+			wantReason: sourcev1.SourcesNotReadyReason,
+		},
+		{
+			name:       "selector",
+			spec:       sourcev1.SourceSetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "b"}}},
+			wantNames:  []string{"Bucket/other"},
+			wantReady:  1,
+			wantReason: sourcev1.SourcesReadyReason,
+		},
+		{
+			name:       "kinds",
+			spec:       sourcev1.SourceSetSpec{Kinds: []sourcev1.SourceSetKindName{sourcev1.GitRepositoryKind}},
+			wantNames:  []string{"GitRepository/broken", "GitRepository/podinfo"},
+			wantReady:  1,
+			wantFailed: 1,
+			wantReason: sourcev1.SourcesNotReadyReason,
+		},
+		{
+			name: "invalid selector",
+			spec: sourcev1.SourceSetSpec{Selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "team", Operator: "Invalid"},
+			}}},
+			wantReason: sourcev1.SelectorInvalidReason,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := sourcev1.SourceSet{ObjectMeta: objectMeta("set", nil), Spec: tt.spec}
+			status, err := r.summarize(context.TODO(), set)
+			if err != nil {
+				t.Fatalf("summarize() error = %v", err)
+			}
+
+			var names []string
+			for _, s := range status.Sources {
+				names = append(names, s.Kind+"/"+s.Name)
+			}
+			if len(names) != len(tt.wantNames) {
+				t.Fatalf("summarize() sources = %v, want %v", names, tt.wantNames)
+			}
+			for i := range names {
+				if names[i] != tt.wantNames[i] {
+					t.Errorf("summarize() sources = %v, want %v", names, tt.wantNames)
+					break
+				}
+			}
+			if status.Total != len(tt.wantNames) || status.Ready != tt.wantReady || status.Failed != tt.wantFailed {
+				t.Errorf("summarize() total, ready, failed = %d, %d, %d, want %d, %d, %d",
+					status.Total, status.Ready, status.Failed, len(tt.wantNames), tt.wantReady, tt.wantFailed)
+			}
+			c := apimeta.FindStatusCondition(status.Conditions, meta.ReadyCondition)
+			if c == nil || c.Reason != tt.wantReason {
+				t.Errorf("summarize() ready condition = %v, want reason %s", c, tt.wantReason)
+			}
+		})
+	}
+
+	set, err := r.summarize(context.TODO(), sourcev1.SourceSet{ObjectMeta: objectMeta("set", nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range set.Sources {
+		switch s.Name {
+		case "podinfo":
+			if s.Revision != "main/1234" || s.Reason != "" {
+				t.Errorf("summarize() podinfo = %+v, want revision and no reason", s)
+			}
+		case "broken":
+			if s.Ready != metav1.ConditionFalse || s.Reason != "Failed" || s.Message != "boom" {
+				t.Errorf("summarize() broken = %+v, want failure reason and message", s)
+			}
+		case "charts":
+			if s.Ready != metav1.ConditionUnknown {
+				t.Errorf("summarize() charts ready = %s, want Unknown", s.Ready)
+			}
+		}
+	}
+}
+
+func TestSourceSetReconciler_requestsForSourceChange(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := sourcev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	sets := []*sourcev1.SourceSet{
+		{ObjectMeta: metav1.ObjectMeta{Name: "all", Namespace: "default"}},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "team-a", Namespace: "default"},
+			Spec:       sourcev1.SourceSetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "buckets", Namespace: "default"},
+			Spec:       sourcev1.SourceSetSpec{Kinds: []sourcev1.SourceSetKindName{sourcev1.BucketKind}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "suspended", Namespace: "default"},
+			Spec:       sourcev1.SourceSetSpec{Suspend: true},
+		},
+		{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "other"}},
+	}
+	builder := fake.NewClientBuilder().WithScheme(scheme)
+	for _, set := range sets {
+		builder = builder.WithObjects(set)
+	}
+	r := &SourceSetReconciler{Client: builder.Build(), Scheme: scheme}
+
+	repository := &sourcev1.GitRepository{ObjectMeta: metav1.ObjectMeta{
+		Name: "podinfo", Namespace: "default", Labels: map[string]string{"team": "a"},
+	}}
+	reqs := r.requestsForSourceChange(repository)
+	got := map[string]bool{}
+	for _, req := range reqs {
+		got[req.Namespace+"/"+req.Name] = true
+	}
+	if len(got) != 2 || !got["default/all"] || !got["default/team-a"] {
+		t.Errorf("requestsForSourceChange() = %v, want default/all and default/team-a", reqs)
+	}
+}
@@ -18,14 +18,20 @@ package controllers
 
 import (
 	"archive/tar"
-	"compress/gzip"
+	"crypto/hmac"
 	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"hash"
 	"io"
+	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -34,14 +40,17 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/fluxcd/pkg/lockedfile"
-
-	"github.com/fluxcd/pkg/untar"
 	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
 	"github.com/fluxcd/source-controller/internal/fs"
+	"github.com/fluxcd/source-controller/internal/sbom"
+	"github.com/fluxcd/source-controller/internal/sops"
 	"github.com/fluxcd/source-controller/pkg/sourceignore"
 )
 
-// Storage manages artifacts
+// Storage manages artifacts: it archives the directories in the ArchiveFormat
+// registered for the extension of the artifact paths, copies the files to the
+// artifacts, and serves them. The other controllers reuse it with NewStorage,
+// as do the tests with a temporary base path.
 type Storage struct {
 	// BasePath is the local directory path where the source artifacts are stored.
 	BasePath string `json:"basePath"`
@@ -49,10 +58,86 @@ type Storage struct {
 	// Hostname is the file server host name used to compose the artifacts URIs.
 	Hostname string `json:"hostname"`
 
+	// BaseURL is the advertised base URL of the file server used to compose the
+	// artifacts URIs, including the scheme and an optional path prefix. It takes
+	// precedence over the Hostname when set.
+	BaseURL string `json:"baseURL,omitempty"`
+
 	// Timeout for artifacts operations
 	Timeout time.Duration `json:"timeout"`
+
+	// SigningKey is the HMAC key the artifacts URIs are signed with, so they
+	// expire after the SignedURLTTL. The URIs are not signed when empty.
+	SigningKey []byte `json:"-"`
+
+	// SignedURLTTL is the duration the signed artifacts URIs are valid for.
+	SignedURLTTL time.Duration `json:"signedURLTTL,omitempty"`
+
+	// Dedup stores the artifacts content-addressed in the BlobsDir, each
+	// artifact file being a hard link to the blob of its content, so the
+	// identical artifacts of different sources consume space only once.
+	Dedup bool `json:"dedup,omitempty"`
+
+	// SBOMFormat is the format of the Software Bill of Materials written
+	// alongside the artifacts by WriteSBOM, no SBOM being written when empty.
+	SBOMFormat string `json:"sbomFormat,omitempty"`
+
+	// FileMode is how the modes of the files archived by Archive are
+	// written, one of ArchiveFileModePreserve, ArchiveFileModeStrip or
+	// ArchiveFileModeNormalize. The modes are preserved when empty.
+	FileMode string `json:"fileMode,omitempty"`
+
+	// FileUmask holds the permission bits cleared from the modes of the
+	// files archived by Archive.
+	FileUmask os.FileMode `json:"fileUmask,omitempty"`
+
+	// SkipInvalidFiles skips the files which cannot be read by Archive, e.g.
+	// because their path exceeds the limits of the file system, recording
+	// them in the SkippedFiles of the artifact instead of failing.
+	SkipInvalidFiles bool `json:"skipInvalidFiles,omitempty"`
+
+	// SymlinkPolicy is how the symbolic links are archived by Archive, one of
+	// LinkPolicyFollow, LinkPolicySkip or LinkPolicyFail. They are skipped
+	// when empty.
+	SymlinkPolicy string `json:"symlinkPolicy,omitempty"`
+
+	// HardlinkPolicy is how the files with more than one hard link are
+	// archived by Archive, one of LinkPolicyFollow, LinkPolicySkip or
+	// LinkPolicyFail. They are followed when empty.
+	HardlinkPolicy string `json:"hardlinkPolicy,omitempty"`
 }
 
+const (
+	// ExpiresQueryParam is the query parameter of a signed artifact URI
+	// holding its expiry time as a Unix timestamp.
+	ExpiresQueryParam = "expires"
+	// SignatureQueryParam is the query parameter of a signed artifact URI
+	// holding its signature.
+	SignatureQueryParam = "signature"
+
+	// BlobsDir is the directory of the Storage.BasePath holding the
+	// artifact blobs, named after their SHA-256 digest, when Dedup is
+	// enabled.
+	BlobsDir = ".blobs"
+
+	// ArchiveFileModePreserve preserves the modes of the archived files.
+	ArchiveFileModePreserve = "preserve"
+	// ArchiveFileModeStrip preserves the permission bits of the archived
+	// files, and strips their setuid, setgid and sticky bits.
+	ArchiveFileModeStrip = "strip"
+	// ArchiveFileModeNormalize writes the archived files with the 0755 mode
+	// if they are executable by their owner, and 0644 otherwise.
+	ArchiveFileModeNormalize = "normalize"
+
+	// latestLinkPrefix is the prefix of the symbolic link to the latest
+	// artifact of a source.
+	latestLinkPrefix = "latest"
+)
+
+// ErrArtifactCorrupted is the error returned by Storage.VerifyArtifact when
+// the checksum of an artifact file does not match the recorded checksum.
+var ErrArtifactCorrupted = errors.New("artifact is corrupted")
+
 // NewStorage creates the storage helper for a given path and hostname
 func NewStorage(basePath string, hostname string, timeout time.Duration) (*Storage, error) {
 	if f, err := os.Stat(basePath); os.IsNotExist(err) || !f.IsDir() {
@@ -65,6 +150,74 @@ func NewStorage(basePath string, hostname string, timeout time.Duration) (*Stora
 	}, nil
 }
 
+// SetBaseURL validates and sets the Storage.BaseURL. The URL must have a
+// http or https scheme and a host, and may have a path prefix.
+func (s *Storage) SetBaseURL(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("invalid base URL '%s': %w", baseURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid base URL '%s': scheme must be http or https", baseURL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid base URL '%s': host is required", baseURL)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("invalid base URL '%s': query and fragment are not supported", baseURL)
+	}
+	s.BaseURL = strings.TrimSuffix(u.String(), "/")
+	return nil
+}
+
+// SetFileMode validates and sets the Storage.FileMode and the
+// Storage.FileUmask, given as an octal number, e.g. '022'. The umask is not
+// changed when empty.
+func (s *Storage) SetFileMode(mode, umask string) error {
+	switch mode {
+	case "", ArchiveFileModePreserve, ArchiveFileModeStrip, ArchiveFileModeNormalize:
+	default:
+		return fmt.Errorf("invalid file mode '%s': must be one of '%s', '%s' or '%s'",
+			mode, ArchiveFileModePreserve, ArchiveFileModeStrip, ArchiveFileModeNormalize)
+	}
+	if umask != "" {
+		m, err := strconv.ParseUint(umask, 8, 32)
+		if err != nil || m > 0777 {
+			return fmt.Errorf("invalid file umask '%s': must be an octal number of permission bits", umask)
+		}
+		s.FileUmask = os.FileMode(m)
+	}
+	s.FileMode = mode
+	return nil
+}
+
+// skipInvalidFile returns the ArchiveFileError of the file with the given
+// name which could not be read, or records it in the SkippedFiles of the given
+// artifact and returns nil if the Storage skips the invalid files.
+func (s *Storage) skipInvalidFile(artifact *sourcev1.Artifact, name string, err error) error {
+	if !s.SkipInvalidFiles {
+		return &ArchiveFileError{Path: name, Err: err}
+	}
+	artifact.SkippedFiles = append(artifact.SkippedFiles, name)
+	return nil
+}
+
+// archiveFileMode returns the mode of the header of an archived file with the
+// given mode, according to the Storage.FileMode and Storage.FileUmask.
+func (s *Storage) archiveFileMode(mode int64) int64 {
+	switch s.FileMode {
+	case ArchiveFileModeStrip:
+		mode &^= 07000
+	case ArchiveFileModeNormalize:
+		if mode&0100 != 0 {
+			mode = 0755
+		} else {
+			mode = 0644
+		}
+	}
+	return mode &^ int64(s.FileUmask.Perm())
+}
+
 // NewArtifactFor returns a new v1beta1.Artifact.
 func (s *Storage) NewArtifactFor(kind string, metadata metav1.Object, revision, fileName string) sourcev1.Artifact {
 	path := sourcev1.ArtifactPath(kind, metadata.GetNamespace(), metadata.GetName(), fileName)
@@ -81,17 +234,123 @@ func (s Storage) SetArtifactURL(artifact *sourcev1.Artifact) {
 	if artifact.Path == "" {
 		return
 	}
-	artifact.URL = fmt.Sprintf("http://%s/%s", s.Hostname, artifact.Path)
+	artifact.URL = s.artifactURL(artifact.Path)
+	if artifact.SBOM != "" {
+		if ext, err := sbom.Ext(s.SBOMFormat); err == nil {
+			artifact.SBOM = s.artifactURL(artifact.Path + ext)
+		}
+	}
 }
 
-// SetHostname sets the hostname of the given URL string to the current Storage.Hostname and returns the result.
-func (s Storage) SetHostname(URL string) string {
+// SetLinkURL returns the URL of the symlink with the base name of the given URL
+// in the directory of the given v1beta1.Artifact, composed with the current
+// advertised address of the Storage.
+func (s Storage) SetLinkURL(artifact sourcev1.Artifact, URL string) string {
 	u, err := url.Parse(URL)
 	if err != nil {
 		return ""
 	}
-	u.Host = s.Hostname
-	return u.String()
+	return s.artifactURL(path.Join(path.Dir(artifact.Path), path.Base(u.Path)))
+}
+
+// artifactURL returns the URL of the given path relative to the
+// Storage.BasePath, using the Storage.BaseURL if set and the Storage.Hostname
+// otherwise. The URL is signed if the Storage.SigningKey is set.
+func (s Storage) artifactURL(p string) string {
+	var u string
+	if s.BaseURL != "" {
+		u = strings.TrimSuffix(s.BaseURL, "/") + "/" + p
+	} else {
+		u = fmt.Sprintf("http://%s/%s", s.Hostname, p)
+	}
+	if len(s.SigningKey) == 0 {
+		return u
+	}
+	expires := time.Now().Add(s.SignedURLTTL).Unix()
+	q := url.Values{}
+	q.Set(ExpiresQueryParam, strconv.FormatInt(expires, 10))
+	q.Set(SignatureQueryParam, s.signature(p, expires))
+	return u + "?" + q.Encode()
+}
+
+// resignURLs signs again the URLs of the given v1beta1.Artifacts and the
+// given link URL of the first one, as published in the status of a source,
+// for them to be valid for another SignedURLTTL. It returns the link URL, and
+// is a no-op if the URLs are not signed.
+func (s Storage) resignURLs(linkURL string, artifacts ...*sourcev1.Artifact) string {
+	if len(s.SigningKey) == 0 || len(artifacts) == 0 {
+		return linkURL
+	}
+	for _, artifact := range artifacts {
+		if artifact != nil {
+			s.SetArtifactURL(artifact)
+		}
+	}
+	if linkURL != "" && artifacts[0] != nil {
+		linkURL = s.SetLinkURL(*artifacts[0], linkURL)
+	}
+	return linkURL
+}
+
+// signedURLRequeueAfter returns the given delay before the next
+// reconciliation of a source, capped at half the SignedURLTTL for the URLs
+// published in its status to be signed again before they expire. A zero
+// delay, for a source not requeued, is capped as well.
+func (s Storage) signedURLRequeueAfter(requeueAfter time.Duration) time.Duration {
+	if len(s.SigningKey) == 0 || s.SignedURLTTL <= 0 {
+		return requeueAfter
+	}
+	if max := s.SignedURLTTL / 2; requeueAfter <= 0 || requeueAfter > max {
+		return max
+	}
+	return requeueAfter
+}
+
+// signature returns the HMAC-SHA256 signature of the given path relative to
+// the Storage.BasePath and expiry time.
+func (s Storage) signature(p string, expires int64) string {
+	mac := hmac.New(sha256.New, s.SigningKey)
+	mac.Write([]byte(fmt.Sprintf("%s\n%d", strings.TrimPrefix(p, "/"), expires)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyURL verifies the signature and the expiry time of the given artifact
+// URL, as served by the file server at the Storage.BasePath. Any URL is valid
+// if the Storage.SigningKey is not set.
+func (s Storage) VerifyURL(u *url.URL) error {
+	if len(s.SigningKey) == 0 {
+		return nil
+	}
+	q := u.Query()
+	expires, err := strconv.ParseInt(q.Get(ExpiresQueryParam), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid or missing '%s' query parameter", ExpiresQueryParam)
+	}
+	signature, err := hex.DecodeString(q.Get(SignatureQueryParam))
+	if err != nil || len(signature) == 0 {
+		return fmt.Errorf("invalid or missing '%s' query parameter", SignatureQueryParam)
+	}
+	want, _ := hex.DecodeString(s.signature(u.Path, expires))
+	if !hmac.Equal(signature, want) {
+		return fmt.Errorf("invalid signature")
+	}
+	if time.Now().Unix() > expires {
+		return fmt.Errorf("URL expired at %s", time.Unix(expires, 0).UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// SignedURLHandler returns a handler serving the requests for the signed
+// artifact URLs with the given handler, and rejecting the others with a 403
+// Forbidden.
+func (s Storage) SignedURLHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := s.VerifyURL(r.URL); err != nil {
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusForbidden), err.Error()), http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
 }
 
 // MkdirAll calls os.MkdirAll for the given v1beta1.Artifact base dir.
@@ -100,16 +359,32 @@ func (s *Storage) MkdirAll(artifact sourcev1.Artifact) error {
 	return os.MkdirAll(dir, 0777)
 }
 
-// RemoveAll calls os.RemoveAll for the given v1beta1.Artifact base dir.
+// RemoveAll calls os.RemoveAll for the given v1beta1.Artifact base dir,
+// removing the blobs no other artifact links to.
 func (s *Storage) RemoveAll(artifact sourcev1.Artifact) error {
 	dir := filepath.Dir(s.LocalPath(artifact))
+	if err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		return s.removeFile(p)
+	}); err != nil {
+		return err
+	}
 	return os.RemoveAll(dir)
 }
 
-// RemoveAllButCurrent removes all files for the given v1beta1.Artifact base dir, excluding the current one.
-func (s *Storage) RemoveAllButCurrent(artifact sourcev1.Artifact) error {
+// RemoveAllButCurrent removes all files for the given v1beta1.Artifact base dir, excluding the current one and
+// the given artifacts to keep.
+func (s *Storage) RemoveAllButCurrent(artifact sourcev1.Artifact, keep ...sourcev1.Artifact) error {
 	localPath := s.LocalPath(artifact)
 	dir := filepath.Dir(localPath)
+	kept := map[string]bool{}
+	for _, a := range append(keep, artifact) {
+		for _, p := range s.artifactFiles(a) {
+			kept[p] = true
+		}
+	}
 	var errors []string
 	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -117,8 +392,8 @@ func (s *Storage) RemoveAllButCurrent(artifact sourcev1.Artifact) error {
 			return nil
 		}
 
-		if path != localPath && !info.IsDir() && info.Mode()&os.ModeSymlink != os.ModeSymlink {
-			if err := os.Remove(path); err != nil {
+		if !kept[path] && !info.IsDir() && info.Mode()&os.ModeSymlink != os.ModeSymlink {
+			if err := s.removeFile(path); err != nil {
 				errors = append(errors, info.Name())
 			}
 		}
@@ -131,6 +406,18 @@ func (s *Storage) RemoveAllButCurrent(artifact sourcev1.Artifact) error {
 	return nil
 }
 
+// artifactFiles returns the local paths of the files belonging to the given
+// v1beta1.Artifact: its file and the SBOMs written alongside it in any format.
+func (s *Storage) artifactFiles(artifact sourcev1.Artifact) []string {
+	p := s.LocalPath(artifact)
+	files := []string{p}
+	for _, format := range []string{sbom.SPDXFormat, sbom.CycloneDXFormat} {
+		ext, _ := sbom.Ext(format)
+		files = append(files, p+ext)
+	}
+	return files
+}
+
 // ArtifactExist returns a boolean indicating whether the v1beta1.Artifact exists in storage and is a regular file.
 func (s *Storage) ArtifactExist(artifact sourcev1.Artifact) bool {
 	fi, err := os.Lstat(s.LocalPath(artifact))
@@ -140,6 +427,41 @@ func (s *Storage) ArtifactExist(artifact sourcev1.Artifact) bool {
 	return fi.Mode().IsRegular()
 }
 
+// VerifyArtifact re-hashes the file of the given v1beta1.Artifact and compares
+// it to the recorded checksum, returning an ErrArtifactCorrupted error on a
+// mismatch.
+func (s *Storage) VerifyArtifact(artifact sourcev1.Artifact) error {
+	f, err := os.Open(s.LocalPath(artifact))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := newHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if checksum := fmt.Sprintf("%x", h.Sum(nil)); checksum != artifact.Checksum {
+		return fmt.Errorf("%w: expected checksum '%s', got '%s'", ErrArtifactCorrupted, artifact.Checksum, checksum)
+	}
+	return nil
+}
+
+// RemoveCorrupted removes the file of the given corrupted v1beta1.Artifact.
+// When the file is linked to a blob, the blob is removed as well, as its
+// content no longer matches its digest and must not be linked to again.
+func (s *Storage) RemoveCorrupted(artifact sourcev1.Artifact) error {
+	localPath := s.LocalPath(artifact)
+	if n, err := linkCount(localPath); err == nil && n > 1 {
+		if err := s.removeLinkedBlob(localPath); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 // ArchiveFileFilter must return true if a file should not be included in the archive after inspecting the given path
 // and/or os.FileInfo.
 type ArchiveFileFilter func(p string, fi os.FileInfo) bool
@@ -160,9 +482,41 @@ func SourceIgnoreFilter(ps []gitignore.Pattern, domain []string) ArchiveFileFilt
 	}
 }
 
-// Archive atomically archives the given directory as a tarball to the given v1beta1.Artifact path, excluding
+// maxEncryptedFileSize is the size above which the files are not inspected by
+// the EncryptedFileFilter.
+const maxEncryptedFileSize = 10 << 20
+
+// EncryptedFileFilter returns an ArchiveFileFilter that filters out the files matching the given ArchiveFileFilter,
+// if not nil, and the files encrypted with SOPS if the policy is sourcev1.ExcludeEncryptedFilesPolicy. It sets the
+// Encrypted field of the given v1beta1.Artifact to true once an encrypted file is not filtered out.
+func EncryptedFileFilter(filter ArchiveFileFilter, policy string, artifact *sourcev1.Artifact) ArchiveFileFilter {
+	artifact.Encrypted = false
+	return func(p string, fi os.FileInfo) bool {
+		if filter != nil && filter(p, fi) {
+			return true
+		}
+		if fi.Size() > maxEncryptedFileSize {
+			return false
+		}
+		data, err := os.ReadFile(p)
+		if err != nil || !sops.IsEncrypted(p, data) {
+			return false
+		}
+		if policy == sourcev1.ExcludeEncryptedFilesPolicy {
+			return true
+		}
+		artifact.Encrypted = true
+		return false
+	}
+}
+
+// Archive atomically archives the given directory to the given v1beta1.Artifact path, excluding
 // directories and any ArchiveFileFilter matches. While archiving, any environment specific data (for example,
 // the user and group name) is stripped from file headers.
+// The ArchiveFormat is the one registered for the extension of the artifact path, the artifacts with other
+// extensions being archived as gzip compressed tarballs.
+// The errors of the files are returned as ArchiveFileError, the files which cannot be read being skipped instead if
+// the Storage.SkipInvalidFiles is set.
 // If successful, it sets the checksum and last update time on the artifact.
 func (s *Storage) Archive(artifact *sourcev1.Artifact, dir string, filter ArchiveFileFilter) (err error) {
 	if f, err := os.Stat(dir); os.IsNotExist(err) || !f.IsDir() {
@@ -184,14 +538,25 @@ func (s *Storage) Archive(artifact *sourcev1.Artifact, dir string, filter Archiv
 	h := newHash()
 	mw := io.MultiWriter(h, tf)
 
-	gw := gzip.NewWriter(mw)
-	tw := tar.NewWriter(gw)
-	if err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+	format, ok := archiveFormatFor(artifact.Path)
+	if !ok {
+		format = tarGzipFormat{}
+	}
+	aw, err := format.NewWriter(mw)
+	if err != nil {
+		tf.Close()
+		return err
+	}
+	artifact.SkippedFiles = nil
+	if err := s.newArchiveWalker(filter, nil).Walk(dir, func(p, name string, fi os.FileInfo, err error) error {
 		if err != nil {
-			return err
+			if p == dir {
+				return err
+			}
+			return s.skipInvalidFile(artifact, name, err)
 		}
 
-		// Ignore anything that is not a file (directories, symlinks)
+		// Ignore anything that is not a file (directories, skipped links)
 		if !fi.Mode().IsRegular() {
 			return nil
 		}
@@ -201,59 +566,29 @@ func (s *Storage) Archive(artifact *sourcev1.Artifact, dir string, filter Archiv
 			return nil
 		}
 
+		// The mode is the one of the tar header of the file, including
+		// its setuid, setgid and sticky bits.
 		header, err := tar.FileInfoHeader(fi, p)
 		if err != nil {
-			return err
-		}
-		// The name needs to be modified to maintain directory structure
-		// as tar.FileInfoHeader only has access to the base name of the file.
-		// Ref: https://golang.org/src/archive/tar/common.go?#L626
-		relFilePath := p
-		if filepath.IsAbs(dir) {
-			relFilePath, err = filepath.Rel(dir, p)
-			if err != nil {
-				return err
-			}
-		}
-		header.Name = relFilePath
-
-		// We want to remove any environment specific data as well, this
-		// ensures the checksum is purely content based.
-		header.Gid = 0
-		header.Uid = 0
-		header.Uname = ""
-		header.Gname = ""
-		header.ModTime = time.Time{}
-		header.AccessTime = time.Time{}
-		header.ChangeTime = time.Time{}
-
-		if err := tw.WriteHeader(header); err != nil {
-			return err
+			return &ArchiveFileError{Path: name, Err: err}
 		}
 
 		f, err := os.Open(p)
 		if err != nil {
-			f.Close()
-			return err
+			return s.skipInvalidFile(artifact, name, err)
 		}
-		if _, err := io.Copy(tw, f); err != nil {
+		if err := aw.WriteFile(name, s.archiveFileMode(header.Mode), fi.Size(), f); err != nil {
 			f.Close()
-			return err
+			return &ArchiveFileError{Path: name, Err: err}
 		}
 		return f.Close()
 	}); err != nil {
-		tw.Close()
-		gw.Close()
+		aw.Close()
 		tf.Close()
 		return err
 	}
 
-	if err := tw.Close(); err != nil {
-		gw.Close()
-		tf.Close()
-		return err
-	}
-	if err := gw.Close(); err != nil {
+	if err := aw.Close(); err != nil {
 		tf.Close()
 		return err
 	}
@@ -265,7 +600,7 @@ func (s *Storage) Archive(artifact *sourcev1.Artifact, dir string, filter Archiv
 		return err
 	}
 
-	if err := fs.RenameWithFallback(tmpName, localPath); err != nil {
+	if err := s.rename(tmpName, localPath); err != nil {
 		return err
 	}
 
@@ -274,6 +609,67 @@ func (s *Storage) Archive(artifact *sourcev1.Artifact, dir string, filter Archiv
 	return nil
 }
 
+// WriteSBOM writes the Software Bill of Materials of the files of the given
+// v1beta1.Artifact tarball in the SBOMFormat alongside it, and sets its URL
+// on the artifact. It is a no-op if the SBOMFormat is empty.
+func (s *Storage) WriteSBOM(artifact *sourcev1.Artifact) error {
+	if s.SBOMFormat == "" {
+		return nil
+	}
+	ext, err := sbom.Ext(s.SBOMFormat)
+	if err != nil {
+		return err
+	}
+
+	localPath := s.LocalPath(*artifact)
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	doc := sbom.Document{
+		Name:             artifact.Path,
+		Version:          artifact.Revision,
+		DownloadLocation: strings.SplitN(artifact.URL, "?", 2)[0],
+		Checksum:         artifact.Checksum,
+		Created:          artifact.LastUpdateTime.Time,
+	}
+	if err := doc.ReadTarball(f); err != nil {
+		return fmt.Errorf("failed to read artifact: %w", err)
+	}
+	data, err := sbom.Marshal(s.SBOMFormat, doc)
+	if err != nil {
+		return err
+	}
+
+	tf, err := os.CreateTemp(filepath.Split(localPath + ext))
+	if err != nil {
+		return err
+	}
+	tfName := tf.Name()
+	if _, err := tf.Write(data); err != nil {
+		tf.Close()
+		os.Remove(tfName)
+		return err
+	}
+	if err := tf.Close(); err != nil {
+		os.Remove(tfName)
+		return err
+	}
+	if err := os.Chmod(tfName, 0644); err != nil {
+		os.Remove(tfName)
+		return err
+	}
+	if err := fs.RenameWithFallback(tfName, localPath+ext); err != nil {
+		os.Remove(tfName)
+		return err
+	}
+
+	artifact.SBOM = s.artifactURL(artifact.Path + ext)
+	return nil
+}
+
 // AtomicWriteFile atomically writes the io.Reader contents to the v1beta1.Artifact path.
 // If successful, it sets the checksum and last update time on the artifact.
 func (s *Storage) AtomicWriteFile(artifact *sourcev1.Artifact, reader io.Reader, mode os.FileMode) (err error) {
@@ -304,7 +700,7 @@ func (s *Storage) AtomicWriteFile(artifact *sourcev1.Artifact, reader io.Reader,
 		return err
 	}
 
-	if err := fs.RenameWithFallback(tfName, localPath); err != nil {
+	if err := s.rename(tfName, localPath); err != nil {
 		return err
 	}
 
@@ -339,7 +735,7 @@ func (s *Storage) Copy(artifact *sourcev1.Artifact, reader io.Reader) (err error
 		return err
 	}
 
-	if err := fs.RenameWithFallback(tfName, localPath); err != nil {
+	if err := s.rename(tfName, localPath); err != nil {
 		return err
 	}
 
@@ -376,9 +772,13 @@ func (s *Storage) CopyToPath(artifact *sourcev1.Artifact, subPath, toPath string
 	}
 	defer f.Close()
 
-	// untar the artifact
+	// extract the artifact
 	untarPath := filepath.Join(tmp, "unpack")
-	if _, err = untar.Untar(f, untarPath); err != nil {
+	format, ok := archiveFormatFor(artifact.Path)
+	if !ok {
+		format = tarGzipFormat{}
+	}
+	if err = format.Extract(f, untarPath); err != nil {
 		return err
 	}
 
@@ -409,7 +809,9 @@ func (s *Storage) Symlink(artifact sourcev1.Artifact, linkName string) (string,
 		return "", err
 	}
 
-	if err := os.Symlink(localPath, tmpLink); err != nil {
+	// the target is relative, for the link to resolve wherever the storage
+	// is mounted, e.g. in the artifact server replicas
+	if err := os.Symlink(filepath.Base(localPath), tmpLink); err != nil {
 		return "", err
 	}
 
@@ -417,8 +819,36 @@ func (s *Storage) Symlink(artifact sourcev1.Artifact, linkName string) (string,
 		return "", err
 	}
 
-	url := fmt.Sprintf("http://%s/%s", s.Hostname, filepath.Join(filepath.Dir(artifact.Path), linkName))
-	return url, nil
+	return s.artifactURL(path.Join(path.Dir(artifact.Path), linkName)), nil
+}
+
+// LatestSymlink creates or updates the 'latest' symbolic link of the source
+// of the given v1beta1.Artifact, named after the extension of the artifact,
+// e.g. 'latest.tar.gz', and returns its URL. The 'latest' links with other
+// extensions are removed, so that a source has a single one.
+func (s *Storage) LatestSymlink(artifact sourcev1.Artifact) (string, error) {
+	linkName := latestLinkPrefix + artifactExt(artifact.Path)
+	links, err := filepath.Glob(filepath.Join(filepath.Dir(s.LocalPath(artifact)), latestLinkPrefix+"*"))
+	if err != nil {
+		return "", err
+	}
+	for _, l := range links {
+		if fi, err := os.Lstat(l); err == nil && fi.Mode()&os.ModeSymlink != 0 && filepath.Base(l) != linkName {
+			if err := os.Remove(l); err != nil && !os.IsNotExist(err) {
+				return "", err
+			}
+		}
+	}
+	return s.Symlink(artifact, linkName)
+}
+
+// artifactExt returns the extension of the given artifact path, which is the
+// one of its ArchiveFormat if registered, e.g. '.tar.gz'.
+func artifactExt(p string) string {
+	if format, ok := archiveFormatFor(p); ok {
+		return format.Extension()
+	}
+	return path.Ext(p)
 }
 
 // Checksum returns the SHA1 checksum for the data of the given io.Reader as a string.
@@ -447,6 +877,134 @@ func (s *Storage) LocalPath(artifact sourcev1.Artifact) string {
 	return path
 }
 
+// blobPath returns the local path of the blob with the given SHA-256 digest.
+func (s *Storage) blobPath(digest string) string {
+	return filepath.Join(s.BasePath, BlobsDir, "sha256", digest[:2], digest)
+}
+
+// rename moves the artifact file written to the given temporary path to the
+// given local path, and deduplicates it. The blob of the replaced file is
+// removed if no other artifact links to it.
+func (s *Storage) rename(tmpName, localPath string) error {
+	replaced := linkedDigest(localPath)
+	if err := fs.RenameWithFallback(tmpName, localPath); err != nil {
+		return err
+	}
+	if err := s.dedup(localPath); err != nil {
+		return err
+	}
+	return s.collectBlob(replaced)
+}
+
+// dedup replaces the artifact file at the given local path with a hard link
+// to the blob of its content if Dedup is enabled. When there is no such blob
+// yet, the file is linked as the blob.
+func (s *Storage) dedup(localPath string) error {
+	if !s.Dedup {
+		return nil
+	}
+	digest, err := fileDigest(localPath)
+	if err != nil {
+		return err
+	}
+	blob := s.blobPath(digest)
+	if err := os.MkdirAll(filepath.Dir(blob), 0777); err != nil {
+		return err
+	}
+	tmpName := localPath + ".link"
+	for {
+		err := os.Link(localPath, blob)
+		if err == nil || !os.IsExist(err) {
+			return err
+		}
+		if err := os.Remove(tmpName); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Link(blob, tmpName); err != nil {
+			// the blob was garbage collected in the meantime
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		return os.Rename(tmpName, localPath)
+	}
+}
+
+// removeFile removes the artifact file at the given path, and the blob it is
+// linked to if no other artifact links to it anymore.
+func (s *Storage) removeFile(p string) error {
+	digest := linkedDigest(p)
+	if err := os.Remove(p); err != nil {
+		return err
+	}
+	return s.collectBlob(digest)
+}
+
+// collectBlob removes the blob with the given digest, if any, when no
+// artifact links to it anymore. The link count of a blob is its reference
+// count.
+func (s *Storage) collectBlob(digest string) error {
+	if digest == "" {
+		return nil
+	}
+	blob := s.blobPath(digest)
+	if n, err := linkCount(blob); err != nil || n > 1 {
+		return nil
+	}
+	if err := os.Remove(blob); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// removeLinkedBlob removes the blob the file at the given path is linked
+// to. The blob is looked up by file identity, since the digest of a corrupted
+// file is not the one of its blob.
+func (s *Storage) removeLinkedBlob(p string) error {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(filepath.Join(s.BasePath, BlobsDir), func(blob string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() || !os.SameFile(fi, info) {
+			return nil
+		}
+		if err := os.Remove(blob); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return filepath.SkipDir
+	})
+}
+
+// linkedDigest returns the digest of the file at the given path if it is
+// linked to a blob, or else an empty string.
+func linkedDigest(p string) string {
+	if n, err := linkCount(p); err != nil || n < 2 {
+		return ""
+	}
+	digest, err := fileDigest(p)
+	if err != nil {
+		return ""
+	}
+	return digest
+}
+
+// fileDigest returns the hex encoded SHA-256 digest of the file at the given
+// path.
+func fileDigest(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 // newHash returns a new SHA1 hash.
 func newHash() hash.Hash {
 	return sha1.New()
@@ -0,0 +1,322 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// TarGzipExt is the extension of the gzip compressed tarballs, the
+	// default archive format of the artifacts.
+	TarGzipExt = ".tar.gz"
+	// TarZstdExt is the extension of the Zstandard compressed tarballs.
+	TarZstdExt = ".tar.zst"
+	// ZipExt is the extension of the zip archives.
+	ZipExt = ".zip"
+)
+
+// ArchiveFormat is a format the directories are archived in by
+// Storage.Archive, and the archives extracted from by Storage.CopyToPath. The
+// format of an artifact is selected by the extension of its path.
+type ArchiveFormat interface {
+	// Extension returns the extension of the archive files, e.g. '.tar.gz'.
+	Extension() string
+	// NewWriter returns an ArchiveWriter writing an archive to the given
+	// io.Writer.
+	NewWriter(w io.Writer) (ArchiveWriter, error)
+	// Extract extracts the archive read from the given io.Reader to the
+	// given directory.
+	Extract(r io.Reader, dir string) error
+}
+
+// ArchiveWriter writes the files of an archive.
+type ArchiveWriter interface {
+	// WriteFile writes the regular file with the given slash-separated name,
+	// mode and size, with the content read from the given io.Reader. The mode
+	// holds the permission bits and the setuid, setgid and sticky bits in the
+	// format of the tar headers.
+	WriteFile(name string, mode, size int64, r io.Reader) error
+	// Close writes the end of the archive, without closing the underlying
+	// io.Writer.
+	Close() error
+}
+
+// ArchiveFileError is the error of a file which could not be archived or
+// extracted, e.g. because its path exceeds the limits of the file system.
+type ArchiveFileError struct {
+	// Path is the slash-separated path of the file, relative to the archived
+	// directory or the root of the archive.
+	Path string
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *ArchiveFileError) Error() string {
+	return fmt.Sprintf("file '%s': %v", e.Path, e.Err)
+}
+
+func (e *ArchiveFileError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	archiveFormatsMu sync.RWMutex
+	archiveFormats   = map[string]ArchiveFormat{}
+)
+
+func init() {
+	RegisterArchiveFormat(tarGzipFormat{})
+	RegisterArchiveFormat(tarZstdFormat{})
+	RegisterArchiveFormat(zipFormat{})
+}
+
+// RegisterArchiveFormat registers the given ArchiveFormat for the artifacts
+// with its extension, replacing the format registered for it, if any.
+func RegisterArchiveFormat(format ArchiveFormat) {
+	archiveFormatsMu.Lock()
+	defer archiveFormatsMu.Unlock()
+	archiveFormats[format.Extension()] = format
+}
+
+// archiveFormatFor returns the ArchiveFormat registered with the longest
+// extension the given path ends with, and false if there is none.
+func archiveFormatFor(p string) (ArchiveFormat, bool) {
+	archiveFormatsMu.RLock()
+	defer archiveFormatsMu.RUnlock()
+	var format ArchiveFormat
+	for ext, f := range archiveFormats {
+		if strings.HasSuffix(p, ext) && (format == nil || len(ext) > len(format.Extension())) {
+			format = f
+		}
+	}
+	return format, format != nil
+}
+
+// tarWriter writes a tarball, compressed by its io.WriteCloser.
+type tarWriter struct {
+	tw *tar.Writer
+	cw io.WriteCloser
+}
+
+func (w *tarWriter) WriteFile(name string, mode, size int64, r io.Reader) error {
+	// the headers hold no environment specific data, for the checksum of
+	// the tarball to be purely content based, and the format is selected
+	// by the writer, the names longer than the 100 bytes of the USTAR
+	// headers being written in PAX extended headers
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     mode,
+		Size:     size,
+	}
+	if err := w.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.Copy(w.tw, r)
+	return err
+}
+
+func (w *tarWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		w.cw.Close()
+		return err
+	}
+	return w.cw.Close()
+}
+
+// extractTar extracts the regular files and directories of the tarball read
+// from the given tar.Reader to the given directory. The errors of the files
+// are returned as ArchiveFileError.
+func extractTar(tr *tar.Reader, dir string) error {
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("tar error: %w", err)
+		}
+		target, err := securejoin.SecureJoin(dir, header.Name)
+		if err != nil {
+			return &ArchiveFileError{Path: header.Name, Err: err}
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg:
+			err = extractFile(target, os.FileMode(header.Mode).Perm(), tr)
+		}
+		if err != nil {
+			return &ArchiveFileError{Path: header.Name, Err: err}
+		}
+	}
+}
+
+// extractFile writes the content read from the given io.Reader to the file
+// at the given path with the given mode, creating its parent directories.
+func extractFile(target string, mode os.FileMode, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// tarGzipFormat is the ArchiveFormat of the gzip compressed tarballs.
+type tarGzipFormat struct{}
+
+func (tarGzipFormat) Extension() string {
+	return TarGzipExt
+}
+
+func (tarGzipFormat) NewWriter(w io.Writer) (ArchiveWriter, error) {
+	gw := gzip.NewWriter(w)
+	return &tarWriter{tw: tar.NewWriter(gw), cw: gw}, nil
+}
+
+func (tarGzipFormat) Extract(r io.Reader, dir string) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("requires gzip-compressed body: %w", err)
+	}
+	defer gr.Close()
+	return extractTar(tar.NewReader(gr), dir)
+}
+
+// tarZstdFormat is the ArchiveFormat of the Zstandard compressed tarballs.
+type tarZstdFormat struct{}
+
+func (tarZstdFormat) Extension() string {
+	return TarZstdExt
+}
+
+func (tarZstdFormat) NewWriter(w io.Writer) (ArchiveWriter, error) {
+	// a single goroutine encodes the tarball, for its checksum to be stable
+	zw, err := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &tarWriter{tw: tar.NewWriter(zw), cw: zw}, nil
+}
+
+func (tarZstdFormat) Extract(r io.Reader, dir string) error {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	return extractTar(tar.NewReader(zr), dir)
+}
+
+// zipFormat is the ArchiveFormat of the zip archives.
+type zipFormat struct{}
+
+func (zipFormat) Extension() string {
+	return ZipExt
+}
+
+func (zipFormat) NewWriter(w io.Writer) (ArchiveWriter, error) {
+	return &zipWriter{zw: zip.NewWriter(w)}, nil
+}
+
+// Extract extracts the zip archive read from the given io.Reader, which is
+// buffered in a temporary file as the directory of a zip archive is at its
+// end.
+func (zipFormat) Extract(r io.Reader, dir string) error {
+	tf, err := os.CreateTemp("", "flux-zip-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tf.Name())
+	defer tf.Close()
+	size, err := io.Copy(tf, r)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(tf, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if err := extractZipFile(f, dir); err != nil {
+			return &ArchiveFileError{Path: f.Name, Err: err}
+		}
+	}
+	return nil
+}
+
+// extractZipFile extracts the given zip.File to the given directory if it is
+// a regular file or a directory.
+func extractZipFile(f *zip.File, dir string) error {
+	target, err := securejoin.SecureJoin(dir, f.Name)
+	if err != nil {
+		return err
+	}
+	if f.FileInfo().IsDir() {
+		return os.MkdirAll(target, 0755)
+	}
+	if !f.Mode().IsRegular() {
+		return nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return extractFile(target, f.Mode().Perm(), rc)
+}
+
+// zipWriter writes a zip archive.
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func (w *zipWriter) WriteFile(name string, mode, _ int64, r io.Reader) error {
+	// the modification times are not set, for the checksum of the archive
+	// to be purely content based
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate}
+	header.SetMode(os.FileMode(mode).Perm())
+	fw, err := w.zw.CreateHeader(header)
+	if err != nil {
+		return fmt.Errorf("zip header of '%s' error: %w", name, err)
+	}
+	_, err = io.Copy(fw, r)
+	return err
+}
+
+func (w *zipWriter) Close() error {
+	return w.zw.Close()
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+func TestStorage_Archive_Formats(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"manifest.yaml":         "kind: ConfigMap",
+		"charts/app/Chart.yaml": "name: app",
+		// longer than the 100 bytes of the USTAR names
+		strings.Repeat("deep/", 30) + strings.Repeat("long", 40) + ".yaml": "kind: Secret",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := NewStorage(t.TempDir(), "hostname", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fileName := range []string{"1.tar.gz", "1.tar.zst", "1.zip", "1.tgz"} {
+		t.Run(fileName, func(t *testing.T) {
+			artifact := sourcev1.Artifact{Path: path.Join("gitrepository", "default", "podinfo", fileName)}
+			if err := s.MkdirAll(artifact); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Archive(&artifact, dir, nil); err != nil {
+				t.Fatalf("Archive() error = %v", err)
+			}
+			checksum := artifact.Checksum
+			if err := s.Archive(&artifact, dir, nil); err != nil {
+				t.Fatalf("Archive() error = %v", err)
+			}
+			if artifact.Checksum != checksum {
+				t.Errorf("Archive() checksum = %s, want the stable checksum %s", artifact.Checksum, checksum)
+			}
+
+			toPath := filepath.Join(t.TempDir(), "include")
+			if err := s.CopyToPath(&artifact, "", toPath); err != nil {
+				t.Fatalf("CopyToPath() error = %v", err)
+			}
+			for name, content := range files {
+				b, err := os.ReadFile(filepath.Join(toPath, name))
+				if err != nil {
+					t.Fatalf("file %s not extracted: %v", name, err)
+				}
+				if string(b) != content {
+					t.Errorf("file %s content = %q, want %q", name, b, content)
+				}
+			}
+		})
+	}
+}
+
+// namesFormat is an ArchiveFormat writing the names of the archived files.
+type namesFormat struct{}
+
+func (namesFormat) Extension() string { return ".names" }
+
+func (namesFormat) NewWriter(w io.Writer) (ArchiveWriter, error) { return &namesWriter{w: w}, nil }
+
+func (namesFormat) Extract(io.Reader, string) error { return nil }
+
+type namesWriter struct{ w io.Writer }
+
+func (w *namesWriter) WriteFile(name string, _, _ int64, _ io.Reader) error {
+	_, err := io.WriteString(w.w, name+"\n")
+	return err
+}
+
+func (w *namesWriter) Close() error { return nil }
+
+func TestRegisterArchiveFormat(t *testing.T) {
+	RegisterArchiveFormat(namesFormat{})
+	defer func() {
+		archiveFormatsMu.Lock()
+		delete(archiveFormats, namesFormat{}.Extension())
+		archiveFormatsMu.Unlock()
+	}()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "manifest.yaml"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewStorage(t.TempDir(), "hostname", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifact := sourcev1.Artifact{Path: path.Join("gitrepository", "default", "podinfo", "1.names")}
+	if err := s.MkdirAll(artifact); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Archive(&artifact, dir, nil); err != nil {
+		t.Fatalf("Archive() error = %v", err)
+	}
+	b, err := os.ReadFile(s.LocalPath(artifact))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "manifest.yaml\n" {
+		t.Errorf("archive = %q, want the names of the files", b)
+	}
+	if ext := artifactExt(artifact.Path); ext != ".names" {
+		t.Errorf("artifactExt() = %q, want %q", ext, ".names")
+	}
+}
+
+func TestStorage_Archive_SkipInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "manifest.yaml"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the deep directories are made relative to their parent, their path
+	// exceeding the PATH_MAX of the file system
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	component := strings.Repeat("d", 250)
+	var deep []string
+	for i := 0; i < 20; i++ {
+		if err := os.Mkdir(component, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chdir(component); err != nil {
+			t.Fatal(err)
+		}
+		deep = append(deep, component)
+	}
+	if err := os.WriteFile("file.yaml", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(wd); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		// os.RemoveAll handles the paths exceeding PATH_MAX
+		os.RemoveAll(filepath.Join(dir, component))
+	}()
+
+	s, err := NewStorage(t.TempDir(), "hostname", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifact := sourcev1.Artifact{Path: path.Join("gitrepository", "default", "podinfo", "1.tar.gz")}
+	if err := s.MkdirAll(artifact); err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Archive(&artifact, dir, nil)
+	var fileErr *ArchiveFileError
+	if !errors.As(err, &fileErr) {
+		t.Fatalf("Archive() error = %v, want an ArchiveFileError", err)
+	}
+	if !strings.HasPrefix(strings.Join(deep, "/"), fileErr.Path) {
+		t.Errorf("ArchiveFileError.Path = %s, want a parent of the deep file", fileErr.Path)
+	}
+
+	s.SkipInvalidFiles = true
+	if err := s.Archive(&artifact, dir, nil); err != nil {
+		t.Fatalf("Archive() error = %v", err)
+	}
+	if !reflect.DeepEqual(artifact.SkippedFiles, []string{fileErr.Path}) {
+		t.Errorf("SkippedFiles = %v, want [%s]", artifact.SkippedFiles, fileErr.Path)
+	}
+	toPath := filepath.Join(t.TempDir(), "include")
+	if err := s.CopyToPath(&artifact, "", toPath); err != nil {
+		t.Fatalf("CopyToPath() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(toPath, "manifest.yaml")); err != nil {
+		t.Errorf("manifest.yaml not extracted: %v", err)
+	}
+}
@@ -0,0 +1,285 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// LinkPolicyFollow archives the content of the targets of the links,
+	// under the name of the links, if the targets are within the archived
+	// directory. The links escaping it are skipped.
+	LinkPolicyFollow = "follow"
+	// LinkPolicySkip does not archive the links.
+	LinkPolicySkip = "skip"
+	// LinkPolicyFail fails the archiving of a directory holding a link.
+	LinkPolicyFail = "fail"
+
+	// maxFollowedSymlinks is the maximum number of symbolic links followed
+	// while archiving a directory, for the links to the same directories not
+	// to multiply the size of the artifact.
+	maxFollowedSymlinks = 1000
+)
+
+var (
+	// errSymlink is the error of the symbolic links archived with the
+	// LinkPolicyFail.
+	errSymlink = errors.New("symbolic links are not allowed")
+	// errHardlink is the error of the hard links archived with the
+	// LinkPolicyFail.
+	errHardlink = errors.New("hard links are not allowed")
+)
+
+// SetLinkPolicies validates and sets the Storage.SymlinkPolicy and the
+// Storage.HardlinkPolicy, each one of LinkPolicyFollow, LinkPolicySkip or
+// LinkPolicyFail. A policy is not changed when empty.
+func (s *Storage) SetLinkPolicies(symlink, hardlink string) error {
+	for _, p := range []struct{ kind, policy string }{{"symlink", symlink}, {"hardlink", hardlink}} {
+		switch p.policy {
+		case "", LinkPolicyFollow, LinkPolicySkip, LinkPolicyFail:
+		default:
+			return fmt.Errorf("invalid %s policy '%s': must be one of '%s', '%s' or '%s'",
+				p.kind, p.policy, LinkPolicyFollow, LinkPolicySkip, LinkPolicyFail)
+		}
+	}
+	if symlink != "" {
+		s.SymlinkPolicy = symlink
+	}
+	if hardlink != "" {
+		s.HardlinkPolicy = hardlink
+	}
+	return nil
+}
+
+// archiveWalkFunc is called by the archiveWalker for each file or directory
+// to archive, with its path and its slash-separated name in the archive. The
+// path of the content of a followed symbolic link is the path through the
+// link, and its os.FileInfo the one of the target.
+type archiveWalkFunc func(p, name string, fi os.FileInfo, err error) error
+
+// archiveWalker walks the directories archived by Storage.Archive, applying
+// the link policies of the Storage.
+type archiveWalker struct {
+	symlinkPolicy  string
+	hardlinkPolicy string
+	// filter excludes the links before the policies are applied, if not
+	// nil, for the excluded links not to fail the archiving.
+	filter ArchiveFileFilter
+	// skipped is called with the name of the links which are not archived,
+	// and the reason why, if not nil.
+	skipped func(name, reason string)
+	// dryRun reports the links failing the archiving to skipped instead of
+	// returning an error, for the preview to list them all.
+	dryRun bool
+
+	// root is the real path of the walked directory, the targets of the
+	// followed links must be within.
+	root string
+	// links are the numbers of hard links within the root of the files
+	// having more than one, counted on the first one found.
+	links map[fileID]uint64
+	// followed is the number of symbolic links followed.
+	followed int
+}
+
+// newArchiveWalker returns an archiveWalker with the link policies of the
+// Storage and the given ArchiveFileFilter. The symbolic links are skipped and
+// the hard links followed by default.
+func (s *Storage) newArchiveWalker(filter ArchiveFileFilter, skipped func(name, reason string)) *archiveWalker {
+	w := &archiveWalker{
+		symlinkPolicy:  s.SymlinkPolicy,
+		hardlinkPolicy: s.HardlinkPolicy,
+		filter:         filter,
+		skipped:        skipped,
+	}
+	if w.symlinkPolicy == "" {
+		w.symlinkPolicy = LinkPolicySkip
+	}
+	if w.hardlinkPolicy == "" {
+		w.hardlinkPolicy = LinkPolicyFollow
+	}
+	return w
+}
+
+// Walk walks the given directory, calling fn for each file or directory to
+// archive.
+func (w *archiveWalker) Walk(dir string, fn archiveWalkFunc) error {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return fn(dir, filepath.ToSlash(dir), nil, err)
+	}
+	if w.root, err = filepath.Abs(root); err != nil {
+		return err
+	}
+	w.links, w.followed = nil, 0
+	return w.walk(dir, dir, "", []string{w.root}, fn)
+}
+
+// walk walks the given directory, whose content is named after the given
+// prefix in the archive and found at the given path through the followed
+// links. The stack holds the real paths of the directories being walked, to
+// detect the cycles of links.
+func (w *archiveWalker) walk(dir, linkPath, prefix string, stack []string, fn archiveWalkFunc) error {
+	return filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		// The name needs to be relative to maintain the directory structure.
+		rel := p
+		if filepath.IsAbs(dir) {
+			r, relErr := filepath.Rel(dir, p)
+			if relErr != nil {
+				return relErr
+			}
+			rel = r
+		}
+		name := filepath.ToSlash(rel)
+		if prefix != "" {
+			name = path.Join(prefix, name)
+		}
+		if linkPath != dir {
+			p = filepath.Join(linkPath, strings.TrimPrefix(p, dir))
+		}
+		if err != nil {
+			return fn(p, name, fi, err)
+		}
+
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			if w.filter != nil && w.filter(p, fi) {
+				return nil
+			}
+			return w.symlink(p, name, stack, fn)
+		case fi.Mode().IsRegular():
+			if ok, err := w.hardlink(p, name, fi); !ok {
+				return err
+			}
+		}
+		return fn(p, name, fi, nil)
+	})
+}
+
+// symlink applies the symlink policy to the symbolic link at the given path.
+func (w *archiveWalker) symlink(p, name string, stack []string, fn archiveWalkFunc) error {
+	switch w.symlinkPolicy {
+	case LinkPolicyFail:
+		return w.fail(name, errSymlink)
+	case LinkPolicyFollow:
+	default:
+		w.skip(name, "symlink '%s' is not included in the artifact")
+		return nil
+	}
+
+	target, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		w.skip(name, "symlink '%s' is broken and not included in the artifact")
+		return nil
+	}
+	if target, err = filepath.Abs(target); err != nil || !w.within(target) {
+		w.skip(name, "symlink '%s' points outside of the source and is not included in the artifact")
+		return nil
+	}
+	if w.followed++; w.followed > maxFollowedSymlinks {
+		return &ArchiveFileError{Path: name, Err: fmt.Errorf("more than %d symbolic links followed", maxFollowedSymlinks)}
+	}
+	fi, err := os.Stat(target)
+	if err != nil {
+		return fn(p, name, nil, err)
+	}
+	if !fi.IsDir() {
+		if fi.Mode().IsRegular() {
+			if ok, err := w.hardlink(p, name, fi); !ok {
+				return err
+			}
+		}
+		return fn(p, name, fi, nil)
+	}
+	for _, dir := range stack {
+		if dir == target {
+			w.skip(name, "symlink '%s' is a cycle and not included in the artifact")
+			return nil
+		}
+	}
+	return w.walk(target, p, name, append(stack[:len(stack):len(stack)], target), fn)
+}
+
+// hardlink applies the hardlink policy to the regular file at the given
+// path, and returns false if it is not to be archived.
+func (w *archiveWalker) hardlink(p, name string, fi os.FileInfo) (bool, error) {
+	id, nlink, ok := fileLinks(fi)
+	if !ok || nlink <= 1 || (w.filter != nil && w.filter(p, fi)) {
+		return true, nil
+	}
+	switch w.hardlinkPolicy {
+	case LinkPolicyFail:
+		return false, w.fail(name, errHardlink)
+	case LinkPolicyFollow:
+	default:
+		w.skip(name, "hard link '%s' is not included in the artifact")
+		return false, nil
+	}
+
+	if w.links == nil {
+		if err := w.countLinks(); err != nil {
+			return false, err
+		}
+	}
+	if w.links[id] < nlink {
+		w.skip(name, "hard link '%s' has links outside of the source and is not included in the artifact")
+		return false, nil
+	}
+	return true, nil
+}
+
+// countLinks counts the hard links within the root of the files having more
+// than one.
+func (w *archiveWalker) countLinks() error {
+	w.links = make(map[fileID]uint64)
+	return filepath.Walk(w.root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.Mode().IsRegular() {
+			return nil
+		}
+		if id, nlink, ok := fileLinks(fi); ok && nlink > 1 {
+			w.links[id]++
+		}
+		return nil
+	})
+}
+
+// within returns true if the given real path is the root or within it.
+func (w *archiveWalker) within(p string) bool {
+	return p == w.root || strings.HasPrefix(p, w.root+string(filepath.Separator))
+}
+
+// fail returns the ArchiveFileError of the link with the given name, or
+// reports it to skipped in a dry run.
+func (w *archiveWalker) fail(name string, err error) error {
+	if w.dryRun {
+		w.skip(name, "link '%s' would fail the artifact: "+err.Error())
+		return nil
+	}
+	return &ArchiveFileError{Path: name, Err: err}
+}
+
+func (w *archiveWalker) skip(name, reason string) {
+	if w.skipped != nil {
+		w.skipped(name, fmt.Sprintf(reason, name))
+	}
+}
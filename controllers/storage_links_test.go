@@ -0,0 +1,190 @@
+// +build !windows
+
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+// linksDir returns a directory holding symbolic and hard links, within and
+// outside of it.
+func linksDir(t *testing.T) string {
+	t.Helper()
+	outside, dir := t.TempDir(), t.TempDir()
+	for _, f := range []struct{ dir, name, content string }{
+		{outside, "secret.txt", "secret"},
+		{outside, "shadow.txt", "shadow"},
+		{dir, "README.md", "readme"},
+		{dir, "sub/a.md", "a"},
+		{dir, "pair1.txt", "pair"},
+	} {
+		p := filepath.Join(f.dir, f.name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(f.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, l := range []struct{ target, name string }{
+		{"README.md", "link.md"},
+		{"sub", "docs"},
+		{"..", "sub/loop"},
+		{filepath.Join(outside, "secret.txt"), "escape.txt"},
+		{"../" + filepath.Base(outside), "outside"},
+		{"missing.md", "broken.md"},
+	} {
+		if err := os.Symlink(l.target, filepath.Join(dir, l.name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Link(filepath.Join(dir, "pair1.txt"), filepath.Join(dir, "pair2.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(outside, "shadow.txt"), filepath.Join(dir, "hard.txt")); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// tarFiles returns the content of the files of the given tarball by name.
+func tarFiles(t *testing.T, tarball string) map[string]string {
+	t.Helper()
+	f, err := os.Open(tarball)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	tr := tar.NewReader(gzr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[header.Name] = string(b)
+	}
+}
+
+func TestStorage_Archive_LinkPolicies(t *testing.T) {
+	dir := linksDir(t)
+
+	tests := []struct {
+		symlink  string
+		hardlink string
+		want     map[string]string
+		wantErr  error
+	}{
+		{
+			want: map[string]string{"README.md": "readme", "sub/a.md": "a", "pair1.txt": "pair", "pair2.txt": "pair"},
+		},
+		{
+			symlink: LinkPolicyFollow,
+			want: map[string]string{
+				"README.md": "readme", "sub/a.md": "a", "pair1.txt": "pair", "pair2.txt": "pair",
+				"link.md": "readme", "docs/a.md": "a",
+			},
+		},
+		{
+			hardlink: LinkPolicySkip,
+			want:     map[string]string{"README.md": "readme", "sub/a.md": "a"},
+		},
+		{symlink: LinkPolicyFail, wantErr: errSymlink},
+		{hardlink: LinkPolicyFail, wantErr: errHardlink},
+	}
+	for _, tt := range tests {
+		t.Run(tt.symlink+"/"+tt.hardlink, func(t *testing.T) {
+			s, err := NewStorage(t.TempDir(), "hostname", time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SetLinkPolicies(tt.symlink, tt.hardlink); err != nil {
+				t.Fatal(err)
+			}
+			artifact := sourcev1.Artifact{Path: path.Join("gitrepository", "default", "podinfo", "1.tar.gz")}
+			if err := s.MkdirAll(artifact); err != nil {
+				t.Fatal(err)
+			}
+			err = s.Archive(&artifact, dir, nil)
+			if tt.wantErr != nil {
+				var fileErr *ArchiveFileError
+				if !errors.As(err, &fileErr) || !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Archive() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tarFiles(t, s.LocalPath(artifact)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Archive() files = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if err := (&Storage{}).SetLinkPolicies("copy", ""); err == nil {
+		t.Error("SetLinkPolicies() with an invalid policy error = nil")
+	}
+}
+
+func TestStorage_previewDir_LinkPolicies(t *testing.T) {
+	dir := linksDir(t)
+	s := &Storage{SymlinkPolicy: LinkPolicyFollow, HardlinkPolicy: LinkPolicyFail}
+	preview, err := s.previewDir(dir, nil, "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(preview.Issues)
+	want := []string{
+		"link 'hard.txt' would fail the artifact: hard links are not allowed",
+		"link 'pair1.txt' would fail the artifact: hard links are not allowed",
+		"link 'pair2.txt' would fail the artifact: hard links are not allowed",
+		"symlink 'broken.md' is broken and not included in the artifact",
+		"symlink 'docs/loop' is a cycle and not included in the artifact",
+		"symlink 'escape.txt' points outside of the source and is not included in the artifact",
+		"symlink 'outside' points outside of the source and is not included in the artifact",
+		"symlink 'sub/loop' is a cycle and not included in the artifact",
+	}
+	if !reflect.DeepEqual(preview.Issues, want) {
+		t.Errorf("Issues = %v, want %v", preview.Issues, want)
+	}
+}
@@ -19,17 +19,23 @@ package controllers
 import (
 	"archive/tar"
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
 
 	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"github.com/fluxcd/source-controller/internal/sbom"
 )
 
 func createStoragePath() (string, error) {
@@ -241,6 +247,164 @@ func TestStorage_Archive(t *testing.T) {
 	}
 }
 
+func TestStorage_Archive_FileMode(t *testing.T) {
+	dir := t.TempDir()
+	for name, mode := range map[string]os.FileMode{"run.sh": 0775 | os.ModeSetuid, "values.yaml": 0664} {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(p, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		mode  string
+		umask string
+		want  map[string]int64
+	}{
+		{mode: ArchiveFileModePreserve, want: map[string]int64{"run.sh": 04775, "values.yaml": 0664}},
+		{mode: ArchiveFileModeStrip, want: map[string]int64{"run.sh": 0775, "values.yaml": 0664}},
+		{mode: ArchiveFileModeNormalize, want: map[string]int64{"run.sh": 0755, "values.yaml": 0644}},
+		{mode: ArchiveFileModeStrip, umask: "027", want: map[string]int64{"run.sh": 0750, "values.yaml": 0640}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+tt.umask, func(t *testing.T) {
+			s, err := NewStorage(t.TempDir(), "hostname", time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SetFileMode(tt.mode, tt.umask); err != nil {
+				t.Fatal(err)
+			}
+			artifact := sourcev1.Artifact{Path: path.Join("gitrepository", "default", "podinfo", "1.tar.gz")}
+			if err := s.MkdirAll(artifact); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Archive(&artifact, dir, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := os.Open(s.LocalPath(artifact))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			gzr, err := gzip.NewReader(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr := tar.NewReader(gzr)
+			for {
+				header, err := tr.Next()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				if want := tt.want[header.Name]; header.Mode != want {
+					t.Errorf("mode of %s = %o, want %o", header.Name, header.Mode, want)
+				}
+			}
+		})
+	}
+
+	s := &Storage{}
+	if err := s.SetFileMode("keep", ""); err == nil {
+		t.Error("SetFileMode() with an invalid mode error = nil")
+	}
+	if err := s.SetFileMode(ArchiveFileModeStrip, "999"); err == nil {
+		t.Error("SetFileMode() with an invalid umask error = nil")
+	}
+}
+
+func TestEncryptedFileFilter(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"secret.yaml":    "data:\n  token: ENC[AES256_GCM,data:Tr7o=]\nsops:\n  mac: ENC[AES256_GCM,data:oYyi]\n",
+		"configmap.yaml": "data:\n  token: plain\n",
+		".git/config":    "[core]\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	domain := strings.Split(dir, string(filepath.Separator))
+
+	tests := []struct {
+		policy        string
+		wantFiltered  []string
+		wantEncrypted bool
+	}{
+		{policy: "", wantFiltered: []string{".git/config"}, wantEncrypted: true},
+		{policy: sourcev1.IncludeEncryptedFilesPolicy, wantFiltered: []string{".git/config"}, wantEncrypted: true},
+		{policy: sourcev1.ExcludeEncryptedFilesPolicy, wantFiltered: []string{".git/config", "secret.yaml"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			artifact := sourcev1.Artifact{Encrypted: true}
+			filter := EncryptedFileFilter(SourceIgnoreFilter(nil, domain), tt.policy, &artifact)
+			var filtered []string
+			for _, name := range []string{".git/config", "configmap.yaml", "secret.yaml"} {
+				p := filepath.Join(dir, name)
+				fi, err := os.Stat(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if filter(p, fi) {
+					filtered = append(filtered, name)
+				}
+			}
+			if strings.Join(filtered, ",") != strings.Join(tt.wantFiltered, ",") {
+				t.Errorf("filtered = %v, want %v", filtered, tt.wantFiltered)
+			}
+			if artifact.Encrypted != tt.wantEncrypted {
+				t.Errorf("Encrypted = %v, want %v", artifact.Encrypted, tt.wantEncrypted)
+			}
+		})
+	}
+}
+
+// BenchmarkStorage_Archive archives a source of 100 files of 64KiB with the
+// given parallelism, e.g. 'go test -bench Archive -cpu 1,2,4,8', to compare
+// the throughput of concurrent reconciles on the storage volume.
+func BenchmarkStorage_Archive(b *testing.B) {
+	storage, err := NewStorage(b.TempDir(), "hostname", time.Minute)
+	if err != nil {
+		b.Fatal(err)
+	}
+	dir := b.TempDir()
+	data := []byte(strings.Repeat("0123456789abcdef", 4<<10))
+	for i := 0; i < 100; i++ {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file-%d.yaml", i)), data, 0o644); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.SetBytes(int64(100 * len(data)))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		artifact := sourcev1.Artifact{
+			Path: filepath.Join("gitrepository", "default", randStringRunes(10), "artifact.tar.gz"),
+		}
+		if err := storage.MkdirAll(artifact); err != nil {
+			b.Error(err)
+			return
+		}
+		for pb.Next() {
+			if err := storage.Archive(&artifact, dir, nil); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
 func TestStorageRemoveAllButCurrent(t *testing.T) {
 	t.Run("bad directory in archive", func(t *testing.T) {
 		dir, err := os.MkdirTemp("", "")
@@ -258,4 +422,442 @@ func TestStorageRemoveAllButCurrent(t *testing.T) {
 			t.Fatal("Did not error while pruning non-existent path")
 		}
 	})
+
+	t.Run("keeps the given artifacts", func(t *testing.T) {
+		dir, err := os.MkdirTemp("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.RemoveAll(dir) })
+
+		s, err := NewStorage(dir, "hostname", time.Minute)
+		if err != nil {
+			t.Fatalf("Valid path did not successfully return: %v", err)
+		}
+
+		artifacts := map[string]sourcev1.Artifact{}
+		for _, v := range []string{"1.0.0", "1.1.0", "1.2.0"} {
+			artifact := sourcev1.Artifact{Path: path.Join("helmchart", "default", "podinfo", "podinfo-"+v+".tgz")}
+			if err := s.MkdirAll(artifact); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.AtomicWriteFile(&artifact, strings.NewReader(v), 0644); err != nil {
+				t.Fatal(err)
+			}
+			artifacts[v] = artifact
+		}
+
+		if err := s.RemoveAllButCurrent(artifacts["1.2.0"], artifacts["1.1.0"]); err != nil {
+			t.Fatal(err)
+		}
+		for v, want := range map[string]bool{"1.0.0": false, "1.1.0": true, "1.2.0": true} {
+			if got := s.ArtifactExist(artifacts[v]); got != want {
+				t.Errorf("ArtifactExist(%s) = %v, want %v", v, got, want)
+			}
+		}
+	})
+}
+
+func TestStorage_WriteSBOM(t *testing.T) {
+	s, err := NewStorage(t.TempDir(), "hostname", time.Minute)
+	if err != nil {
+		t.Fatalf("Valid path did not successfully return: %v", err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("test"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	artifact := sourcev1.Artifact{Path: path.Join("gitrepository", "default", "podinfo", "1.tar.gz"), Revision: "1"}
+	if err := s.MkdirAll(artifact); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Archive(&artifact, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.WriteSBOM(&artifact); err != nil || artifact.SBOM != "" {
+		t.Fatalf("WriteSBOM() = %v, SBOM = %s, want no SBOM when disabled", err, artifact.SBOM)
+	}
+
+	s.SBOMFormat = sbom.SPDXFormat
+	if err := s.WriteSBOM(&artifact); err != nil {
+		t.Fatal(err)
+	}
+	if want := "http://hostname/gitrepository/default/podinfo/1.tar.gz.spdx.json"; artifact.SBOM != want {
+		t.Errorf("SBOM = %s, want %s", artifact.SBOM, want)
+	}
+	data, err := os.ReadFile(s.LocalPath(artifact) + ".spdx.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"fileName": "./README.md"`) {
+		t.Errorf("SBOM does not describe README.md:\n%s", data)
+	}
+
+	if err := s.RemoveAllButCurrent(artifact); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.LocalPath(artifact) + ".spdx.json"); err != nil {
+		t.Errorf("SBOM of the current artifact removed: %v", err)
+	}
+}
+
+func TestStorage_ArtifactURLs(t *testing.T) {
+	artifact := sourcev1.Artifact{Path: "gitrepository/default/podinfo/1234.tar.gz"}
+	tests := []struct {
+		name     string
+		baseURL  string
+		wantErr  bool
+		wantURL  string
+		wantLink string
+	}{
+		{
+			name:     "hostname",
+			wantURL:  "http://hostname/gitrepository/default/podinfo/1234.tar.gz",
+			wantLink: "http://hostname/gitrepository/default/podinfo/latest.tar.gz",
+		},
+		{
+			name:     "base URL with path prefix",
+			baseURL:  "https://flux.example.com/artifacts/",
+			wantURL:  "https://flux.example.com/artifacts/gitrepository/default/podinfo/1234.tar.gz",
+			wantLink: "https://flux.example.com/artifacts/gitrepository/default/podinfo/latest.tar.gz",
+		},
+		{
+			name:    "base URL without scheme",
+			baseURL: "flux.example.com/artifacts",
+			wantErr: true,
+		},
+		{
+			name:    "base URL with query",
+			baseURL: "https://flux.example.com/?token=foo",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Storage{Hostname: "hostname"}
+			if tt.baseURL != "" {
+				err := s.SetBaseURL(tt.baseURL)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("SetBaseURL() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if tt.wantErr {
+					return
+				}
+			}
+
+			a := artifact
+			s.SetArtifactURL(&a)
+			if a.URL != tt.wantURL {
+				t.Errorf("SetArtifactURL() = %q, want %q", a.URL, tt.wantURL)
+			}
+			if got := s.SetLinkURL(a, "http://old-hostname/gitrepository/default/podinfo/latest.tar.gz"); got != tt.wantLink {
+				t.Errorf("SetLinkURL() = %q, want %q", got, tt.wantLink)
+			}
+		})
+	}
+}
+
+func TestStorage_signedURLRequeueAfter(t *testing.T) {
+	signed := Storage{SigningKey: []byte("secret"), SignedURLTTL: time.Hour}
+	tests := []struct {
+		name         string
+		storage      Storage
+		requeueAfter time.Duration
+		want         time.Duration
+	}{
+		{name: "unsigned", requeueAfter: 2 * time.Hour, want: 2 * time.Hour},
+		{name: "unsigned not requeued", want: 0},
+		{name: "shorter interval", storage: signed, requeueAfter: 10 * time.Minute, want: 10 * time.Minute},
+		{name: "longer interval", storage: signed, requeueAfter: 2 * time.Hour, want: 30 * time.Minute},
+		{name: "not requeued", storage: signed, want: 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.storage.signedURLRequeueAfter(tt.requeueAfter); got != tt.want {
+				t.Errorf("signedURLRequeueAfter() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStorage_SignedURLHandler(t *testing.T) {
+	s := Storage{Hostname: "hostname", SigningKey: []byte("secret"), SignedURLTTL: time.Hour}
+	artifact := sourcev1.Artifact{Path: "gitrepository/default/podinfo/1234.tar.gz"}
+	s.SetArtifactURL(&artifact)
+
+	expired := s
+	expired.SignedURLTTL = -time.Minute
+	expiredArtifact := artifact
+	expired.SetArtifactURL(&expiredArtifact)
+
+	otherKey := s
+	otherKey.SigningKey = []byte("other")
+	otherKeyArtifact := artifact
+	otherKey.SetArtifactURL(&otherKeyArtifact)
+
+	u, err := url.Parse(artifact.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := *u
+	tampered.Path = "/gitrepository/default/podinfo/5678.tar.gz"
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+	}{
+		{
+			name:       "signed URL",
+			target:     artifact.URL,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "unsigned URL",
+			target:     "http://hostname/gitrepository/default/podinfo/1234.tar.gz",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "expired URL",
+			target:     expiredArtifact.URL,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "URL signed with other key",
+			target:     otherKeyArtifact.URL,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "signature of other path",
+			target:     tampered.String(),
+			wantStatus: http.StatusForbidden,
+		},
+	}
+	h := s.SignedURLHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	// any URL is served without a signing key
+	s.SigningKey = nil
+	if err := s.VerifyURL(&tampered); err != nil {
+		t.Errorf("VerifyURL() without signing key error = %v", err)
+	}
+}
+
+func TestStorage_Dedup(t *testing.T) {
+	dir, err := createStoragePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanupStoragePath(dir))
+
+	s, err := NewStorage(dir, "hostname", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Dedup = true
+
+	write := func(name, content string) sourcev1.Artifact {
+		t.Helper()
+		a := sourcev1.Artifact{Path: path.Join("gitrepository", "default", name, "1234.tar.gz")}
+		if err := s.MkdirAll(a); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AtomicWriteFile(&a, strings.NewReader(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	sameFile := func(a, b string) bool {
+		t.Helper()
+		fa, err := os.Stat(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fb, err := os.Stat(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return os.SameFile(fa, fb)
+	}
+
+	tenant1 := write("tenant1", "podinfo")
+	tenant2 := write("tenant2", "podinfo")
+	other := write("other", "other")
+
+	digest, err := fileDigest(s.LocalPath(tenant1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := s.blobPath(digest)
+	if !sameFile(s.LocalPath(tenant1), blob) || !sameFile(s.LocalPath(tenant2), blob) {
+		t.Fatal("identical artifacts are not linked to the same blob")
+	}
+	if sameFile(s.LocalPath(other), blob) {
+		t.Fatal("different artifacts are linked to the same blob")
+	}
+	if !s.ArtifactExist(tenant1) {
+		t.Fatal("deduplicated artifact does not exist")
+	}
+
+	// the blob is kept as long as an artifact links to it
+	if err := s.RemoveAll(tenant1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(blob); err != nil {
+		t.Fatalf("blob referenced by an artifact was removed: %v", err)
+	}
+
+	// replacing the last artifact linking to the blob removes it
+	write("tenant2", "podinfo v2")
+	if _, err := os.Stat(blob); !os.IsNotExist(err) {
+		t.Fatalf("unreferenced blob was not removed: %v", err)
+	}
+
+	if err := s.RemoveAll(tenant2); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveAll(other); err != nil {
+		t.Fatal(err)
+	}
+	blobs, err := filepath.Glob(filepath.Join(dir, BlobsDir, "sha256", "*", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs) != 0 {
+		t.Errorf("unreferenced blobs were not removed: %v", blobs)
+	}
+}
+
+func TestStorage_VerifyArtifact(t *testing.T) {
+	dir, err := createStoragePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanupStoragePath(dir))
+
+	s, err := NewStorage(dir, "hostname", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Dedup = true
+
+	write := func(name, content string) sourcev1.Artifact {
+		t.Helper()
+		a := sourcev1.Artifact{Path: path.Join("helmchart", "default", name, "podinfo-1.0.0.tgz")}
+		if err := s.MkdirAll(a); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AtomicWriteFile(&a, strings.NewReader(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+
+	tenant1 := write("tenant1", "podinfo")
+	tenant2 := write("tenant2", "podinfo")
+	if err := s.VerifyArtifact(tenant1); err != nil {
+		t.Fatalf("VerifyArtifact() error = %v", err)
+	}
+
+	// corrupting the blob corrupts all the artifacts linked to it
+	if err := os.WriteFile(s.LocalPath(tenant1), []byte("podinf0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range []sourcev1.Artifact{tenant1, tenant2} {
+		if err := s.VerifyArtifact(a); !errors.Is(err, ErrArtifactCorrupted) {
+			t.Errorf("VerifyArtifact() error = %v, want %v", err, ErrArtifactCorrupted)
+		}
+	}
+
+	if err := s.RemoveCorrupted(tenant1); err != nil {
+		t.Fatal(err)
+	}
+	if s.ArtifactExist(tenant1) {
+		t.Error("corrupted artifact was not removed")
+	}
+	blobs, err := filepath.Glob(filepath.Join(dir, BlobsDir, "sha256", "*", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs) != 0 {
+		t.Errorf("corrupted blobs were not removed: %v", blobs)
+	}
+
+	// the artifacts written again are not linked to the corrupted content
+	if err := s.RemoveCorrupted(tenant2); err != nil {
+		t.Fatal(err)
+	}
+	tenant1 = write("tenant1", "podinfo")
+	if err := s.VerifyArtifact(tenant1); err != nil {
+		t.Errorf("VerifyArtifact() error = %v", err)
+	}
+
+	if err := s.VerifyArtifact(sourcev1.Artifact{Path: "helmchart/default/missing/podinfo-1.0.0.tgz"}); !os.IsNotExist(err) {
+		t.Errorf("VerifyArtifact() error = %v, want not exist", err)
+	}
+}
+
+func TestStorage_LatestSymlink(t *testing.T) {
+	dir, err := createStoragePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanupStoragePath(dir))
+
+	s, err := NewStorage(dir, "hostname", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name, content string) sourcev1.Artifact {
+		t.Helper()
+		a := sourcev1.Artifact{Path: path.Join("helmchart", "default", "podinfo", name)}
+		if err := s.MkdirAll(a); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AtomicWriteFile(&a, strings.NewReader(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+
+	charts := write("charts.tar.gz", "charts")
+	u, err := s.LatestSymlink(charts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "http://hostname/helmchart/default/podinfo/latest.tar.gz"; u != want {
+		t.Errorf("LatestSymlink() = %s, want %s", u, want)
+	}
+
+	chart := write("podinfo-1.0.0.tgz", "podinfo")
+	if _, err := s.LatestSymlink(chart); err != nil {
+		t.Fatal(err)
+	}
+	linkDir := filepath.Join(dir, "helmchart", "default", "podinfo")
+	target, err := os.Readlink(filepath.Join(linkDir, "latest.tgz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "podinfo-1.0.0.tgz" {
+		t.Errorf("latest.tgz links to %s, want a relative link to podinfo-1.0.0.tgz", target)
+	}
+	if _, err := os.Lstat(filepath.Join(linkDir, "latest.tar.gz")); !os.IsNotExist(err) {
+		t.Errorf("latest.tar.gz was not removed: %v", err)
+	}
+	if b, err := os.ReadFile(filepath.Join(linkDir, "latest.tgz")); err != nil || string(b) != "podinfo" {
+		t.Errorf("latest.tgz content = %q, %v", b, err)
+	}
 }
@@ -0,0 +1,53 @@
+// +build !windows
+
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"os"
+	"syscall"
+)
+
+// linkCount returns the number of hard links to the file at the given path.
+func linkCount(path string) (uint64, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return 0, err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, &os.PathError{Op: "lstat", Path: path, Err: syscall.ENOTSUP}
+	}
+	return uint64(st.Nlink), nil
+}
+
+// fileID identifies a file across its hard links.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// fileLinks returns the fileID and the number of hard links of the file with
+// the given os.FileInfo, and false if they are unknown.
+func fileLinks(fi os.FileInfo) (fileID, uint64, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, 0, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, uint64(st.Nlink), true
+}
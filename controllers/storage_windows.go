@@ -0,0 +1,38 @@
+// +build windows
+
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"os"
+)
+
+// linkCount is not supported on Windows.
+func linkCount(path string) (uint64, error) {
+	return 0, errors.New("link count is not supported on windows")
+}
+
+// fileID identifies a file across its hard links.
+type fileID struct{}
+
+// fileLinks is not supported on Windows, the hard links being archived as
+// regular files.
+func fileLinks(fi os.FileInfo) (fileID, uint64, bool) {
+	return fileID{}, 0, false
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+// withdrawnMessage is the message of the events of the withdrawn artifacts.
+const withdrawnMessage = "Artifact withdrawn while the reconciliation is suspended"
+
+// withdrawnSource is a source whose artifacts can be withdrawn.
+type withdrawnSource interface {
+	client.Object
+	meta.ObjectWithStatusConditions
+	sourcev1.Source
+}
+
+// artifactWithdrawn returns true if the artifacts of the given suspended
+// source were already withdrawn at its observed generation.
+func artifactWithdrawn(obj withdrawnSource, observedGeneration int64) bool {
+	if obj.GetArtifact() != nil || obj.GetGeneration() != observedGeneration {
+		return false
+	}
+	c := apimeta.FindStatusCondition(*obj.GetStatusConditions(), meta.ReadyCondition)
+	return c != nil && c.Reason == sourcev1.ArtifactWithdrawnReason
+}
+
+// withdrawArtifacts deletes the ConfigMap of the given v1beta1.InlineArtifact
+// of the given source of the given kind, if any, and removes its artifacts
+// from the storage.
+func withdrawArtifacts(ctx context.Context, c client.Client, scheme *runtime.Scheme, storage *Storage,
+	kind string, obj withdrawnSource, inlined *sourcev1.InlineArtifact) error {
+	if _, err := inlineArtifact(ctx, c, scheme, storage, obj, nil, nil, inlined); err != nil {
+		return err
+	}
+	if err := storage.RemoveAll(storage.NewArtifactFor(kind, obj, "", "*")); err != nil {
+		return fmt.Errorf("unable to withdraw artifacts: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+func Test_withdrawArtifacts(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := sourcev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	storage, err := NewStorage(t.TempDir(), "hostname", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repository := &sourcev1.GitRepository{ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "default", UID: "uid"}}
+	artifact := storage.NewArtifactFor(sourcev1.GitRepositoryKind, repository, "main/363a6a8", "363a6a8.tar.gz")
+	if err := storage.MkdirAll(artifact); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(storage.LocalPath(artifact), []byte("tarball"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.LatestSymlink(artifact); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(repository).Build()
+	ctx := context.TODO()
+	inlined, err := inlineArtifact(ctx, c, scheme, storage, repository,
+		&sourcev1.SourceInline{Mode: sourcev1.InlineConfigMapMode}, &artifact, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository.Status.Artifact = &artifact
+	repository.Status.InlineArtifact = inlined
+
+	if err := withdrawArtifacts(ctx, c, scheme, storage, sourcev1.GitRepositoryKind, repository, inlined); err != nil {
+		t.Fatalf("withdrawArtifacts() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(storage.LocalPath(artifact))); !os.IsNotExist(err) {
+		t.Errorf("artifact dir not removed: %v", err)
+	}
+	var configMap corev1.ConfigMap
+	name := types.NamespacedName{Namespace: "default", Name: inlined.ConfigMapRef.Name}
+	if err := c.Get(ctx, name, &configMap); !apierrors.IsNotFound(err) {
+		t.Errorf("inline artifact ConfigMap not deleted: %v", err)
+	}
+
+	if artifactWithdrawn(repository, repository.Status.ObservedGeneration) {
+		t.Error("artifactWithdrawn() = true before the status is updated")
+	}
+	withdrawn := sourcev1.GitRepositoryWithdrawn(*repository)
+	if withdrawn.GetArtifact() != nil || withdrawn.Status.InlineArtifact != nil || withdrawn.Status.URL != "" {
+		t.Errorf("GitRepositoryWithdrawn() status = %+v, want no artifact", withdrawn.Status)
+	}
+	if !artifactWithdrawn(&withdrawn, withdrawn.Status.ObservedGeneration) {
+		t.Error("artifactWithdrawn() = false after the status is updated")
+	}
+	withdrawn.Generation++
+	if artifactWithdrawn(&withdrawn, withdrawn.Status.ObservedGeneration) {
+		t.Error("artifactWithdrawn() = true for a new generation")
+	}
+}
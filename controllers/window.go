@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+// maxWindowDays is the number of days before and after a given time searched
+// for the opening of a window.
+const maxWindowDays = 7
+
+// windowOpensAt returns the zero time if the given window is open at the
+// given time, or the time the window opens next otherwise. A nil window is
+// always open.
+func windowOpensAt(window *sourcev1.SourceWindow, now time.Time) (time.Time, error) {
+	if window == nil {
+		return time.Time{}, nil
+	}
+	if window.Duration.Duration <= 0 {
+		return time.Time{}, fmt.Errorf("invalid window duration '%s'", window.Duration.Duration)
+	}
+	start, err := time.Parse("15:04", window.Start)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid window start '%s': %w", window.Start, err)
+	}
+	loc := time.UTC
+	if window.TimeZone != "" {
+		if loc, err = time.LoadLocation(window.TimeZone); err != nil {
+			return time.Time{}, fmt.Errorf("invalid window time zone '%s': %w", window.TimeZone, err)
+		}
+	}
+
+	days := make(map[time.Weekday]bool, len(window.Days))
+	for _, d := range window.Days {
+		wd, ok := windowDays[d]
+		if !ok {
+			return time.Time{}, fmt.Errorf("invalid window day '%s'", d)
+		}
+		days[wd] = true
+	}
+
+	// the windows opened on the previous days may still be open
+	local := now.In(loc)
+	for d := -maxWindowDays; d <= maxWindowDays; d++ {
+		opens := time.Date(local.Year(), local.Month(), local.Day()+d, start.Hour(), start.Minute(), 0, 0, loc)
+		if len(days) > 0 && !days[opens.Weekday()] {
+			continue
+		}
+		if opens.After(now) {
+			return opens, nil
+		}
+		if now.Before(opens.Add(window.Duration.Duration)) {
+			return time.Time{}, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("window does not open within %d days", maxWindowDays)
+}
+
+// windowDays maps the days of a window to their time.Weekday.
+var windowDays = map[sourcev1.WindowDay]time.Weekday{
+	"Sun": time.Sunday,
+	"Mon": time.Monday,
+	"Tue": time.Tuesday,
+	"Wed": time.Wednesday,
+	"Thu": time.Thursday,
+	"Fri": time.Friday,
+	"Sat": time.Saturday,
+}
+
+// pendingMessage returns the message of the Ready condition of a source with
+// the given pending revision.
+func pendingMessage(revision string, opensAt time.Time) string {
+	return fmt.Sprintf("Revision '%s' pending until the window opens at %s", revision, opensAt.UTC().Format(time.RFC3339))
+}
+
+// windowRequeueAfter returns the given requeue duration of a source with the
+// given window, shortened to the time until the window opens when a revision
+// is pending, so the revision is not held back longer than needed.
+func windowRequeueAfter(window *sourcev1.SourceWindow, pendingRevision string, requeueAfter time.Duration) time.Duration {
+	if pendingRevision == "" {
+		return requeueAfter
+	}
+	opensAt, err := windowOpensAt(window, time.Now())
+	if err != nil || opensAt.IsZero() {
+		return requeueAfter
+	}
+	if d := time.Until(opensAt); requeueAfter == 0 || d < requeueAfter {
+		return d
+	}
+	return requeueAfter
+}
+
+// holdRevision returns the time the given window opens next if the given
+// revision, which differs from the one of the given current artifact, is to
+// be held back until then, or the zero time. The first artifact of a source is
+// never held back.
+func holdRevision(window *sourcev1.SourceWindow, current *sourcev1.Artifact, revision string) (time.Time, error) {
+	if current == nil || current.HasRevision(revision) {
+		return time.Time{}, nil
+	}
+	return windowOpensAt(window, time.Now())
+}
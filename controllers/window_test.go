@@ -0,0 +1,107 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+func Test_windowOpensAt(t *testing.T) {
+	// a Wednesday
+	now := time.Date(2021, 6, 16, 12, 0, 0, 0, time.UTC)
+	nightly := &sourcev1.SourceWindow{Start: "22:00", Duration: metav1.Duration{Duration: 4 * time.Hour}}
+
+	tests := []struct {
+		name    string
+		window  *sourcev1.SourceWindow
+		now     time.Time
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "no window", now: now},
+		{name: "before", window: nightly, now: now, want: time.Date(2021, 6, 16, 22, 0, 0, 0, time.UTC)},
+		{name: "open", window: nightly, now: now.Add(11 * time.Hour)},
+		{name: "open since the previous day", window: nightly, now: now.Add(13 * time.Hour)},
+		{name: "closed at the end", window: nightly, now: now.Add(14 * time.Hour), want: time.Date(2021, 6, 17, 22, 0, 0, 0, time.UTC)},
+		{
+			name:   "days",
+			window: &sourcev1.SourceWindow{Start: "01:00", Duration: metav1.Duration{Duration: time.Hour}, Days: []sourcev1.WindowDay{"Sat", "Sun"}},
+			now:    now,
+			want:   time.Date(2021, 6, 19, 1, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "time zone",
+			window: &sourcev1.SourceWindow{Start: "13:00", Duration: metav1.Duration{Duration: time.Hour}, TimeZone: "Europe/Berlin"},
+			now:    now,
+			want:   time.Date(2021, 6, 17, 11, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "unknown time zone",
+			window:  &sourcev1.SourceWindow{Start: "13:00", Duration: metav1.Duration{Duration: time.Hour}, TimeZone: "Mars/Olympus"},
+			now:     now,
+			wantErr: true,
+		},
+		{
+			name:    "no duration",
+			window:  &sourcev1.SourceWindow{Start: "13:00"},
+			now:     now,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := windowOpensAt(tt.window, tt.now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("windowOpensAt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("windowOpensAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_holdRevision(t *testing.T) {
+	now := time.Now().UTC()
+	closed := &sourcev1.SourceWindow{
+		Start:    now.Add(2 * time.Hour).Format("15:04"),
+		Duration: metav1.Duration{Duration: time.Hour},
+	}
+	current := &sourcev1.Artifact{Revision: "main/1"}
+
+	if opensAt, err := holdRevision(closed, current, "main/2"); err != nil || opensAt.IsZero() {
+		t.Errorf("expected the new revision to be held back, got %v, %v", opensAt, err)
+	}
+	if opensAt, _ := holdRevision(closed, current, "main/1"); !opensAt.IsZero() {
+		t.Error("the current revision is held back")
+	}
+	if opensAt, _ := holdRevision(closed, nil, "main/2"); !opensAt.IsZero() {
+		t.Error("the first revision is held back")
+	}
+
+	if got := windowRequeueAfter(closed, "main/2", 10*time.Hour); got > 2*time.Hour {
+		t.Errorf("windowRequeueAfter() = %v, want the time until the window opens", got)
+	}
+	if got := windowRequeueAfter(closed, "", 10*time.Hour); got != 10*time.Hour {
+		t.Errorf("windowRequeueAfter() = %v, want the interval", got)
+	}
+}
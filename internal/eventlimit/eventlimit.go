@@ -0,0 +1,145 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package eventlimit limits the events emitted for the sources, for the
+// flapping sources not to flood the events API and the notification-controller.
+package eventlimit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fluxcd/pkg/runtime/events"
+)
+
+// Options configures a Limiter.
+type Options struct {
+	// DedupWindow is the duration during which an event identical to the
+	// last one emitted for an object is suppressed. Disabled when zero.
+	DedupWindow time.Duration
+	// MaxEvents is the maximum number of events emitted for an object per
+	// Interval. Disabled when zero.
+	MaxEvents int
+	// Interval is the interval of MaxEvents.
+	Interval time.Duration
+	// MinSeverity is the lowest severity of the emitted events, either
+	// events.EventSeverityInfo or events.EventSeverityError. All the events
+	// are emitted when empty.
+	MinSeverity string
+}
+
+// object holds the events emitted for an object.
+type object struct {
+	lastSeverity string
+	lastMessage  string
+	lastTime     time.Time
+
+	windowStart time.Time
+	count       int
+}
+
+// Limiter decides which events are emitted for the objects. A nil Limiter
+// allows all the events. It is safe for concurrent use.
+type Limiter struct {
+	opts Options
+	now  func() time.Time
+
+	mu        sync.Mutex
+	objects   map[string]*object
+	lastPrune time.Time
+}
+
+// New returns a Limiter with the given options.
+func New(opts Options) (*Limiter, error) {
+	switch opts.MinSeverity {
+	case "", events.EventSeverityInfo, events.EventSeverityError:
+	default:
+		return nil, fmt.Errorf("invalid minimum event severity '%s', must be '%s' or '%s'",
+			opts.MinSeverity, events.EventSeverityInfo, events.EventSeverityError)
+	}
+	if opts.MaxEvents < 0 || opts.DedupWindow < 0 {
+		return nil, fmt.Errorf("the event limits must not be negative")
+	}
+	if opts.MaxEvents > 0 && opts.Interval <= 0 {
+		return nil, fmt.Errorf("the event rate limit interval must be positive")
+	}
+	return &Limiter{
+		opts:    opts,
+		now:     time.Now,
+		objects: make(map[string]*object),
+	}, nil
+}
+
+// Allow returns true if the event of the given severity and message is
+// emitted for the object with the given key, and records it if so.
+func (l *Limiter) Allow(key, severity, msg string) bool {
+	if l == nil {
+		return true
+	}
+	if l.opts.MinSeverity == events.EventSeverityError && severity != events.EventSeverityError {
+		return false
+	}
+	if l.opts.DedupWindow == 0 && l.opts.MaxEvents == 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	o, ok := l.objects[key]
+	if !ok {
+		o = &object{}
+		l.objects[key] = o
+	}
+	if l.opts.DedupWindow > 0 && o.lastMessage == msg && o.lastSeverity == severity &&
+		now.Sub(o.lastTime) < l.opts.DedupWindow {
+		return false
+	}
+	if l.opts.MaxEvents > 0 {
+		if now.Sub(o.windowStart) >= l.opts.Interval {
+			o.windowStart, o.count = now, 0
+		}
+		if o.count >= l.opts.MaxEvents {
+			return false
+		}
+		o.count++
+	}
+	o.lastSeverity, o.lastMessage, o.lastTime = severity, msg, now
+	return true
+}
+
+// prune forgets the objects which emitted no event within the longest of
+// the dedup window and the rate limit interval, at most once per that
+// duration.
+func (l *Limiter) prune(now time.Time) {
+	ttl := l.opts.DedupWindow
+	if l.opts.MaxEvents > 0 && l.opts.Interval > ttl {
+		ttl = l.opts.Interval
+	}
+	if now.Sub(l.lastPrune) < ttl {
+		return
+	}
+	l.lastPrune = now
+	for key, o := range l.objects {
+		if now.Sub(o.lastTime) >= ttl && now.Sub(o.windowStart) >= ttl {
+			delete(l.objects, key)
+		}
+	}
+}
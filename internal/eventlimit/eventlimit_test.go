@@ -0,0 +1,121 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eventlimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fluxcd/pkg/runtime/events"
+)
+
+// clock is a settable time source.
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func newLimiter(t *testing.T, opts Options) (*Limiter, *clock) {
+	t.Helper()
+	l, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &clock{t: time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)}
+	l.now = c.now
+	return l, c
+}
+
+func TestLimiter_Dedup(t *testing.T) {
+	l, c := newLimiter(t, Options{DedupWindow: 10 * time.Minute})
+	const key = "GitRepository/default/podinfo"
+
+	if !l.Allow(key, events.EventSeverityError, "auth failed") {
+		t.Fatal("first event suppressed")
+	}
+	c.t = c.t.Add(time.Minute)
+	if l.Allow(key, events.EventSeverityError, "auth failed") {
+		t.Error("identical event not suppressed within the window")
+	}
+	if !l.Allow("GitRepository/default/other", events.EventSeverityError, "auth failed") {
+		t.Error("event of another object suppressed")
+	}
+	if !l.Allow(key, events.EventSeverityError, "timeout") {
+		t.Error("different event suppressed")
+	}
+	if !l.Allow(key, events.EventSeverityError, "auth failed") {
+		t.Error("event suppressed after a different one")
+	}
+	c.t = c.t.Add(10 * time.Minute)
+	if !l.Allow(key, events.EventSeverityError, "auth failed") {
+		t.Error("identical event suppressed after the window")
+	}
+}
+
+func TestLimiter_RateLimit(t *testing.T) {
+	l, c := newLimiter(t, Options{MaxEvents: 2, Interval: time.Minute})
+	const key = "Bucket/default/podinfo"
+
+	for i, want := range []bool{true, true, false} {
+		if got := l.Allow(key, events.EventSeverityInfo, "event"); got != want {
+			t.Errorf("Allow() #%d = %v, want %v", i, got, want)
+		}
+	}
+	c.t = c.t.Add(time.Minute)
+	if !l.Allow(key, events.EventSeverityInfo, "event") {
+		t.Error("event suppressed in the next interval")
+	}
+}
+
+func TestLimiter_MinSeverity(t *testing.T) {
+	l, _ := newLimiter(t, Options{MinSeverity: events.EventSeverityError})
+	if l.Allow("HelmChart/default/podinfo", events.EventSeverityInfo, "packaged") {
+		t.Error("info event not suppressed")
+	}
+	if !l.Allow("HelmChart/default/podinfo", events.EventSeverityError, "failed") {
+		t.Error("error event suppressed")
+	}
+}
+
+func TestLimiter_Prune(t *testing.T) {
+	l, c := newLimiter(t, Options{DedupWindow: time.Minute})
+	l.Allow("GitRepository/default/podinfo", events.EventSeverityInfo, "event")
+	c.t = c.t.Add(2 * time.Minute)
+	l.Allow("GitRepository/default/other", events.EventSeverityInfo, "event")
+	if _, ok := l.objects["GitRepository/default/podinfo"]; ok || len(l.objects) != 1 {
+		t.Errorf("objects = %v, want the stale object pruned", l.objects)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, opts := range []Options{
+		{MinSeverity: "warning"},
+		{MaxEvents: 1},
+		{DedupWindow: -time.Second},
+	} {
+		if _, err := New(opts); err == nil {
+			t.Errorf("New(%+v) error = nil, want error", opts)
+		}
+	}
+	var l *Limiter
+	if !l.Allow("GitRepository/default/podinfo", events.EventSeverityInfo, "event") {
+		t.Error("nil Limiter suppressed an event")
+	}
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gitcache keeps a persistent bare repository per GitRepository on
+// disk, so the Git objects are fetched incrementally across reconciles
+// instead of cloning the repository every time.
+package gitcache
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fluxcd/pkg/lockedfile"
+)
+
+// Cache holds the repositories of the sources in a directory, evicting the
+// least recently used ones when their total size exceeds a quota. A nil
+// Cache caches nothing. It is safe for concurrent use.
+type Cache struct {
+	path    string
+	maxSize int64
+
+	mu    sync.Mutex
+	inUse map[string]bool
+}
+
+// New returns a Cache holding the repositories in the directory at the given
+// path, which is created if it does not exist. The least recently used
+// repositories are evicted when their total size exceeds maxSize bytes,
+// disabled when 0.
+func New(path string, maxSize int64) (*Cache, error) {
+	if err := os.MkdirAll(path, 0o700); err != nil {
+		return nil, fmt.Errorf("unable to create Git cache directory '%s': %w", path, err)
+	}
+	return &Cache{
+		path:    path,
+		maxSize: maxSize,
+		inUse:   make(map[string]bool),
+	}, nil
+}
+
+// Lock locks the repository of the source with the given namespace and name
+// fetched from the given URL, and returns its directory and the function to
+// call to unlock it. The repositories of the source fetched from other URLs
+// are removed, so that their objects never end up in a checkout. For a nil
+// Cache, it returns an empty directory path.
+func (c *Cache) Lock(namespace, name, url string) (dir string, unlock func(), err error) {
+	if c == nil {
+		return "", func() {}, nil
+	}
+
+	sourceDir := c.sourceDir(namespace, name)
+	if err := os.MkdirAll(filepath.Dir(sourceDir), 0o700); err != nil {
+		return "", nil, err
+	}
+	unlockFile, err := lockedfile.MutexAt(sourceDir + ".lock").Lock()
+	if err != nil {
+		return "", nil, err
+	}
+	c.setInUse(sourceDir, true)
+	unlock = func() {
+		c.setInUse(sourceDir, false)
+		unlockFile()
+	}
+	if err := os.MkdirAll(sourceDir, 0o700); err != nil {
+		unlock()
+		return "", nil, err
+	}
+
+	dirName := fmt.Sprintf("%x", sha256.Sum256([]byte(url)))[:16]
+	entries, err := os.ReadDir(sourceDir)
+	if err != nil {
+		unlock()
+		return "", nil, err
+	}
+	for _, entry := range entries {
+		if entry.Name() == dirName {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(sourceDir, entry.Name())); err != nil {
+			unlock()
+			return "", nil, err
+		}
+	}
+
+	// the modification time of the source directory orders the eviction
+	now := time.Now()
+	if err := os.Chtimes(sourceDir, now, now); err != nil {
+		unlock()
+		return "", nil, err
+	}
+	return filepath.Join(sourceDir, dirName), unlock, nil
+}
+
+// Remove removes the repositories of the source with the given namespace
+// and name. It is a no-op for a nil Cache.
+func (c *Cache) Remove(namespace, name string) error {
+	if c == nil {
+		return nil
+	}
+
+	sourceDir := c.sourceDir(namespace, name)
+	if _, err := os.Stat(sourceDir + ".lock"); os.IsNotExist(err) {
+		// the source has never been cached
+		return nil
+	}
+	if err := removeLocked(sourceDir); err != nil {
+		return err
+	}
+	return os.Remove(sourceDir + ".lock")
+}
+
+// Evict removes the least recently used repositories which are not locked,
+// until the total size of the repositories is at most the maximum size of
+// the Cache. It is a no-op for a nil Cache, or if the maximum size is 0.
+func (c *Cache) Evict() error {
+	if c == nil || c.maxSize <= 0 {
+		return nil
+	}
+
+	type source struct {
+		dir     string
+		size    int64
+		modTime time.Time
+	}
+	var sources []source
+	var total int64
+	namespaces, err := os.ReadDir(c.path)
+	if err != nil {
+		return err
+	}
+	for _, ns := range namespaces {
+		if !ns.IsDir() {
+			continue
+		}
+		names, err := os.ReadDir(filepath.Join(c.path, ns.Name()))
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if !name.IsDir() {
+				continue
+			}
+			info, err := name.Info()
+			if err != nil {
+				return err
+			}
+			dir := filepath.Join(c.path, ns.Name(), name.Name())
+			size, err := dirSize(dir)
+			if err != nil {
+				return err
+			}
+			sources = append(sources, source{dir: dir, size: size, modTime: info.ModTime()})
+			total += size
+		}
+	}
+
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].modTime.Before(sources[j].modTime)
+	})
+	for _, s := range sources {
+		if total <= c.maxSize {
+			break
+		}
+		if c.isInUse(s.dir) {
+			continue
+		}
+		if err := removeLocked(s.dir); err != nil {
+			return err
+		}
+		total -= s.size
+	}
+	return nil
+}
+
+func (c *Cache) sourceDir(namespace, name string) string {
+	return filepath.Join(c.path, namespace, name)
+}
+
+func (c *Cache) setInUse(dir string, inUse bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if inUse {
+		c.inUse[dir] = true
+	} else {
+		delete(c.inUse, dir)
+	}
+}
+
+func (c *Cache) isInUse(dir string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.inUse[dir]
+}
+
+// removeLocked removes the directory of a source while holding its lock.
+func removeLocked(sourceDir string) error {
+	unlock, err := lockedfile.MutexAt(sourceDir + ".lock").Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return os.RemoveAll(sourceDir)
+}
+
+// dirSize returns the total size of the regular files in the directory at
+// the given path.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCache_Lock(t *testing.T) {
+	c, err := New(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, unlock, err := c.Lock("default", "podinfo", "https://github.com/stefanprodan/podinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+
+	same, unlock, err := c.Lock("default", "podinfo", "https://github.com/stefanprodan/podinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	if same != dir {
+		t.Errorf("Lock() = %q for the same URL, want %q", same, dir)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("repository removed for the same URL: %v", err)
+	}
+
+	other, unlock, err := c.Lock("default", "podinfo", "ssh://git@github.com/stefanprodan/podinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	if other == dir {
+		t.Errorf("Lock() = %q for another URL", other)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("repository of the previous URL not removed, err = %v", err)
+	}
+
+	if err := c.Remove("default", "podinfo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Dir(other)); !os.IsNotExist(err) {
+		t.Errorf("source directory not removed, err = %v", err)
+	}
+	if err := c.Remove("default", "never-cached"); err != nil {
+		t.Errorf("Remove() error = %v for a source never cached", err)
+	}
+}
+
+func TestCache_Evict(t *testing.T) {
+	c, err := New(t.TempDir(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fill := func(name string, size int, age time.Duration) string {
+		t.Helper()
+		dir, unlock, err := c.Lock("default", name, "https://example.com/"+name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer unlock()
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "pack"), make([]byte, size), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		modTime := time.Now().Add(-age)
+		if err := os.Chtimes(filepath.Dir(dir), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	oldest := fill("oldest", 40, 3*time.Hour)
+	old := fill("old", 40, 2*time.Hour)
+	recent := fill("recent", 40, time.Hour)
+
+	// the oldest repository is in use, the next one is evicted instead
+	_, unlock, err := c.Lock("default", "oldest", "https://example.com/oldest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(-3 * time.Hour)
+	if err := os.Chtimes(filepath.Dir(oldest), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Evict(); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	for dir, want := range map[string]bool{oldest: true, old: false, recent: true} {
+		if _, err := os.Stat(dir); (err == nil) != want {
+			t.Errorf("%s exists = %v, want %v", filepath.Base(filepath.Dir(dir)), err == nil, want)
+		}
+	}
+}
+
+func TestCache_Nil(t *testing.T) {
+	var c *Cache
+	dir, unlock, err := c.Lock("default", "podinfo", "https://example.com")
+	if err != nil || dir != "" {
+		t.Errorf("Lock() = %q, %v, want no directory", dir, err)
+	}
+	unlock()
+	if err := c.Remove("default", "podinfo"); err != nil {
+		t.Error(err)
+	}
+	if err := c.Evict(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,320 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package githubapp exchanges the credentials of a GitHub App for the
+// short-lived tokens of its installations, to authenticate the Git
+// operations as the App instead of with personal access tokens.
+package githubapp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/fluxcd/source-controller/pkg/trust"
+)
+
+const (
+	// AppIDKey is the key of the ID of the GitHub App in a Secret.
+	AppIDKey = "githubAppID"
+	// InstallationIDKey is the key of the ID of the installation of the
+	// GitHub App in a Secret.
+	InstallationIDKey = "githubAppInstallationID"
+	// PrivateKeyKey is the key of the PEM encoded private key of the GitHub
+	// App in a Secret.
+	PrivateKeyKey = "githubAppPrivateKey"
+	// BaseURLKey is the key of the optional URL of the GitHub REST API in a
+	// Secret, for GitHub Enterprise Server, e.g.
+	// 'https://github.example.com/api/v3'.
+	BaseURLKey = "githubAppBaseURL"
+	// CAFileKey is the key of the optional CA bundle of the GitHub REST API
+	// in a Secret, shared with the Git HTTPS auth.
+	CAFileKey = "caFile"
+
+	// DefaultBaseURL is the URL of the GitHub REST API.
+	DefaultBaseURL = "https://api.github.com"
+	// TokenUsername is the username of the basic auth with an installation
+	// token.
+	TokenUsername = "x-access-token"
+
+	// jwtLifetime is the lifetime of the JWTs authenticating the App, below
+	// the maximum of 10 minutes allowed by GitHub.
+	jwtLifetime = 9 * time.Minute
+	// clockSkew is the allowance for the clock drift between the controller
+	// and GitHub.
+	clockSkew = time.Minute
+	// refreshBefore is the remaining lifetime below which a cached
+	// installation token is replaced, tokens being valid for an hour.
+	refreshBefore = 5 * time.Minute
+)
+
+// Credentials are the credentials of a GitHub App installation.
+type Credentials struct {
+	AppID          int64
+	InstallationID int64
+	PrivateKey     *rsa.PrivateKey
+	BaseURL        string
+	CABundle       []byte
+}
+
+// CredentialsFromSecret returns the Credentials of the given Secret, or nil
+// if it holds no AppIDKey. It returns an error if the credentials are
+// incomplete or invalid.
+func CredentialsFromSecret(secret corev1.Secret) (*Credentials, error) {
+	appID, ok := secret.Data[AppIDKey]
+	if !ok {
+		return nil, nil
+	}
+	c := &Credentials{BaseURL: DefaultBaseURL, CABundle: secret.Data[CAFileKey]}
+	var err error
+	if c.AppID, err = strconv.ParseInt(strings.TrimSpace(string(appID)), 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid '%s' secret data: '%s' must be an integer", secret.Name, AppIDKey)
+	}
+	installationID, ok := secret.Data[InstallationIDKey]
+	if !ok {
+		return nil, fmt.Errorf("invalid '%s' secret data: required field '%s'", secret.Name, InstallationIDKey)
+	}
+	if c.InstallationID, err = strconv.ParseInt(strings.TrimSpace(string(installationID)), 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid '%s' secret data: '%s' must be an integer", secret.Name, InstallationIDKey)
+	}
+	privateKey, ok := secret.Data[PrivateKeyKey]
+	if !ok {
+		return nil, fmt.Errorf("invalid '%s' secret data: required field '%s'", secret.Name, PrivateKeyKey)
+	}
+	if c.PrivateKey, err = parsePrivateKey(privateKey); err != nil {
+		return nil, fmt.Errorf("invalid '%s' secret data: '%s': %w", secret.Name, PrivateKeyKey, err)
+	}
+	if baseURL, ok := secret.Data[BaseURLKey]; ok {
+		u, err := url.Parse(strings.TrimSpace(string(baseURL)))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid '%s' secret data: '%s' must be an HTTP/S URL", secret.Name, BaseURLKey)
+		}
+		c.BaseURL = strings.TrimSuffix(u.String(), "/")
+	}
+	return c, nil
+}
+
+// parsePrivateKey parses the given PEM encoded PKCS #1 or PKCS #8 RSA
+// private key.
+func parsePrivateKey(b []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded key found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("the private key must be an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// tokenKey identifies the installation token of Credentials.
+type tokenKey struct {
+	baseURL        string
+	appID          int64
+	installationID int64
+	// keyID is the checksum of the public key, for the rotation of the
+	// private key to invalidate the token.
+	keyID string
+}
+
+func (c *Credentials) key() tokenKey {
+	der, _ := x509.MarshalPKIXPublicKey(&c.PrivateKey.PublicKey)
+	return tokenKey{
+		baseURL:        c.BaseURL,
+		appID:          c.AppID,
+		installationID: c.InstallationID,
+		keyID:          fmt.Sprintf("%x", sha256.Sum256(der)),
+	}
+}
+
+// token is an installation token.
+type token struct {
+	value     string
+	expiresAt time.Time
+}
+
+// TokenSource mints the installation tokens of GitHub Apps, and caches them
+// until they are about to expire. The zero value is ready to use.
+type TokenSource struct {
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+
+	mu     sync.Mutex
+	tokens map[tokenKey]token
+}
+
+func (s *TokenSource) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// Token returns an installation token of the given Credentials, minting a
+// new one if none is cached or the cached one is about to expire.
+func (s *TokenSource) Token(ctx context.Context, c *Credentials) (string, error) {
+	key := c.key()
+	s.mu.Lock()
+	t, ok := s.tokens[key]
+	s.mu.Unlock()
+	if ok && s.now().Add(refreshBefore).Before(t.expiresAt) {
+		return t.value, nil
+	}
+
+	t, err := s.mint(ctx, c)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tokens == nil {
+		s.tokens = make(map[tokenKey]token)
+	}
+	s.tokens[key] = t
+	return t.value, nil
+}
+
+// Forget removes the cached installation token of the given Credentials, for
+// the next Token call to mint a new one, e.g. after the token was revoked.
+func (s *TokenSource) Forget(c *Credentials) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, c.key())
+}
+
+// AuthSecret returns a copy of the given Secret with the TokenUsername and
+// an installation token as the 'username' and 'password' of the basic auth,
+// if the Secret holds the Credentials of a GitHub App, or the Secret itself
+// otherwise. The installation tokens authenticate the HTTP/S operations only,
+// and an error is returned for the other schemes of the given repository URL.
+func (s *TokenSource) AuthSecret(ctx context.Context, secret corev1.Secret, repositoryURL string) (corev1.Secret, error) {
+	c, err := CredentialsFromSecret(secret)
+	if err != nil || c == nil {
+		return secret, err
+	}
+	if u, err := url.Parse(repositoryURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return secret, fmt.Errorf("the GitHub App credentials of the '%s' secret require an HTTP/S repository URL", secret.Name)
+	}
+	value, err := s.Token(ctx, c)
+	if err != nil {
+		return secret, err
+	}
+	secret = *secret.DeepCopy()
+	secret.Data["username"] = []byte(TokenUsername)
+	secret.Data["password"] = []byte(value)
+	return secret, nil
+}
+
+// ForgetSecret removes the cached installation token of the Credentials of
+// the given Secret, if any.
+func (s *TokenSource) ForgetSecret(secret corev1.Secret) {
+	if c, err := CredentialsFromSecret(secret); err == nil && c != nil {
+		s.Forget(c)
+	}
+}
+
+// mint requests a new installation token from the GitHub REST API.
+func (s *TokenSource) mint(ctx context.Context, c *Credentials) (token, error) {
+	jwt, err := c.jwt(s.now())
+	if err != nil {
+		return token{}, err
+	}
+	u := fmt.Sprintf("%s/app/installations/%d/access_tokens", c.BaseURL, c.InstallationID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, nil)
+	if err != nil {
+		return token{}, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	client := &http.Client{Transport: trust.DefaultTransport}
+	if len(c.CABundle) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(c.CABundle) {
+			return token{}, fmt.Errorf("invalid CA bundle")
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+		client = &http.Client{Transport: transport}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return token{}, fmt.Errorf("unable to mint GitHub App installation token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return token{}, fmt.Errorf("unable to mint GitHub App installation token: unexpected status code %d from '%s'", resp.StatusCode, u)
+	}
+	var body struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return token{}, fmt.Errorf("unable to decode GitHub App installation token: %w", err)
+	}
+	if body.Token == "" {
+		return token{}, fmt.Errorf("unable to mint GitHub App installation token: empty token from '%s'", u)
+	}
+	return token{value: body.Token, expiresAt: body.ExpiresAt}, nil
+}
+
+// jwt returns the RS256 JSON Web Token authenticating the App at the given
+// time.
+func (c *Credentials) jwt(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-clockSkew).Unix(),
+		"exp": now.Add(jwtLifetime).Unix(),
+		"iss": strconv.FormatInt(c.AppID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, c.PrivateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("unable to sign GitHub App JWT: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
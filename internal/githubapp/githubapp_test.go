@@ -0,0 +1,207 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package githubapp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testSecret(t *testing.T, key *rsa.PrivateKey, baseURL string) corev1.Secret {
+	t.Helper()
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "github-app"},
+		Data: map[string][]byte{
+			AppIDKey:          []byte("1234"),
+			InstallationIDKey: []byte("5678"),
+			PrivateKeyKey:     keyPEM,
+			BaseURLKey:        []byte(baseURL),
+		},
+	}
+}
+
+// verifyJWT returns an error if the given JWT is not signed with the given
+// key for the App 1234.
+func verifyJWT(jwt string, key *rsa.PublicKey) error {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed JWT")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return err
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+	var claims struct {
+		Iss string `json:"iss"`
+		Iat int64  `json:"iat"`
+		Exp int64  `json:"exp"`
+	}
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return err
+	}
+	if claims.Iss != "1234" || claims.Exp-claims.Iat > int64((10 * time.Minute).Seconds()) {
+		return fmt.Errorf("unexpected claims %+v", claims)
+	}
+	return nil
+}
+
+func TestTokenSource_AuthSecret(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var minted int32
+	now := time.Date(2021, 10, 14, 10, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/app/installations/5678/access_tokens" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := verifyJWT(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), &key.PublicKey); err != nil {
+			t.Errorf("invalid JWT: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n := atomic.AddInt32(&minted, 1)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": "ghs_%d", "expires_at": "%s"}`, n, now.Add(time.Hour).Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	clock := now
+	s := &TokenSource{Now: func() time.Time { return clock }}
+	secret := testSecret(t, key, server.URL)
+	ctx := context.TODO()
+
+	got, err := s.AuthSecret(ctx, secret, "https://github.com/org/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Data["username"]) != TokenUsername || string(got.Data["password"]) != "ghs_1" {
+		t.Errorf("AuthSecret() username, password = %q, %q", got.Data["username"], got.Data["password"])
+	}
+	if _, ok := secret.Data["password"]; ok {
+		t.Error("AuthSecret() modified the given Secret")
+	}
+
+	// cached until about to expire
+	clock = now.Add(50 * time.Minute)
+	if got, _ := s.AuthSecret(ctx, secret, "https://github.com/org/repo"); string(got.Data["password"]) != "ghs_1" {
+		t.Errorf("AuthSecret() password = %q, want the cached token", got.Data["password"])
+	}
+	clock = now.Add(56 * time.Minute)
+	if got, _ := s.AuthSecret(ctx, secret, "https://github.com/org/repo"); string(got.Data["password"]) != "ghs_2" {
+		t.Errorf("AuthSecret() password = %q, want a refreshed token", got.Data["password"])
+	}
+	s.ForgetSecret(secret)
+	if got, _ := s.AuthSecret(ctx, secret, "https://github.com/org/repo"); string(got.Data["password"]) != "ghs_3" {
+		t.Errorf("AuthSecret() password = %q, want a new token once forgotten", got.Data["password"])
+	}
+
+	if _, err := s.AuthSecret(ctx, secret, "ssh://git@github.com/org/repo"); err == nil {
+		t.Error("AuthSecret() returned no error for an SSH URL")
+	}
+
+	other := corev1.Secret{Data: map[string][]byte{"username": []byte("git"), "password": []byte("pat")}}
+	if got, err := s.AuthSecret(ctx, other, "https://github.com/org/repo"); err != nil || string(got.Data["password"]) != "pat" {
+		t.Errorf("AuthSecret() = %v, %v, want the Secret without GitHub App credentials unchanged", got.Data, err)
+	}
+
+	secret.Data[InstallationIDKey] = []byte("9")
+	if _, err := s.AuthSecret(ctx, secret, "https://github.com/org/repo"); err == nil {
+		t.Error("AuthSecret() returned no error for an unknown installation")
+	}
+}
+
+func TestCredentialsFromSecret(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(data map[string][]byte)
+		wantURL string
+		wantErr bool
+	}{
+		{name: "PKCS #1 key", modify: func(map[string][]byte) {}, wantURL: "https://github.example.com/api/v3"},
+		{
+			name: "PKCS #8 key, default URL",
+			modify: func(data map[string][]byte) {
+				data[PrivateKeyKey] = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})
+				delete(data, BaseURLKey)
+			},
+			wantURL: DefaultBaseURL,
+		},
+		{name: "invalid app ID", modify: func(data map[string][]byte) { data[AppIDKey] = []byte("app") }, wantErr: true},
+		{name: "no installation ID", modify: func(data map[string][]byte) { delete(data, InstallationIDKey) }, wantErr: true},
+		{name: "no private key", modify: func(data map[string][]byte) { delete(data, PrivateKeyKey) }, wantErr: true},
+		{name: "invalid private key", modify: func(data map[string][]byte) { data[PrivateKeyKey] = []byte("key") }, wantErr: true},
+		{name: "invalid base URL", modify: func(data map[string][]byte) { data[BaseURLKey] = []byte("github.example.com") }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := testSecret(t, key, "https://github.example.com/api/v3/")
+			tt.modify(secret.Data)
+			got, err := CredentialsFromSecret(secret)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CredentialsFromSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.AppID != 1234 || got.InstallationID != 5678 || got.BaseURL != tt.wantURL || !got.PrivateKey.Equal(key) {
+				t.Errorf("CredentialsFromSecret() = %+v", got)
+			}
+		})
+	}
+
+	if got, err := CredentialsFromSecret(corev1.Secret{}); got != nil || err != nil {
+		t.Errorf("CredentialsFromSecret() = %v, %v, want nil without GitHub App credentials", got, err)
+	}
+}
@@ -17,11 +17,19 @@ limitations under the License.
 package helm
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"path"
 	"reflect"
+	"strings"
 
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
 	helmchart "helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/provenance"
+
+	"github.com/fluxcd/source-controller/pkg/sourceignore"
 )
 
 // OverwriteChartDefaultValues overwrites the chart default values file with the
@@ -57,3 +65,121 @@ func OverwriteChartDefaultValues(chart *helmchart.Chart, data []byte) (bool, err
 	// This should never happen, helm charts must have a values.yaml file to be valid
 	return false, fmt.Errorf("failed to locate values file: %s", chartutil.ValuesfileName)
 }
+
+// ExcludeChartFiles removes the templates and files of the chart and its
+// dependencies matching the given patterns in the gitignore format, which
+// are relative to the chart root, e.g. 'charts/*/tests/'. The chart metadata
+// and default values files are always kept. It returns true if any file was
+// removed.
+func ExcludeChartFiles(chart *helmchart.Chart, patterns []string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+	ps := sourceignore.ReadPatterns(strings.NewReader(strings.Join(patterns, "\n")), nil)
+	return excludeChartFiles(chart, sourceignore.NewMatcher(ps), nil)
+}
+
+func excludeChartFiles(chart *helmchart.Chart, matcher gitignore.Matcher, domain []string) bool {
+	excluded := false
+	keep := func(files []*helmchart.File) []*helmchart.File {
+		var kept []*helmchart.File
+		for _, f := range files {
+			if f.Name != chartutil.ValuesfileName && matchFile(matcher, domain, f.Name) {
+				excluded = true
+				continue
+			}
+			kept = append(kept, f)
+		}
+		return kept
+	}
+	chart.Templates = keep(chart.Templates)
+	chart.Files = keep(chart.Files)
+	for _, dep := range chart.Dependencies() {
+		depDomain := append(append([]string{}, domain...), "charts", dep.Name())
+		if excludeChartFiles(dep, matcher, depDomain) {
+			excluded = true
+		}
+	}
+	return excluded
+}
+
+// matchFile returns true if the file with the given name relative to the
+// given domain, or any of its parent directories, matches.
+func matchFile(matcher gitignore.Matcher, domain []string, name string) bool {
+	parts := append(append([]string{}, domain...), strings.Split(path.Clean(name), "/")...)
+	for i := 1; i <= len(parts); i++ {
+		if matcher.Match(parts[:i], i < len(parts)) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyChartLock returns an error if the given chart declares dependencies
+// without a lock file, if its lock file is out of sync with them, i.e. if an
+// update of the dependencies could change their locked versions, or if the
+// dependencies vendored in its charts directory are not the locked versions.
+func VerifyChartLock(chart *helmchart.Chart) error {
+	reqs := chart.Metadata.Dependencies
+	if len(reqs) == 0 {
+		return nil
+	}
+	lockFile := "Chart.lock"
+	if chart.Metadata.APIVersion == helmchart.APIVersionV1 {
+		lockFile = "requirements.lock"
+	}
+	if chart.Lock == nil {
+		return fmt.Errorf("no %s found for the dependencies of chart '%s'", lockFile, chart.Name())
+	}
+
+	// the aliases of the repositories are resolved to the URLs recorded in
+	// the lock file, as Helm resolves them before hashing the dependencies
+	resolved := make([]*helmchart.Dependency, len(reqs))
+	for i, req := range reqs {
+		dep := *req
+		if _, ok := RepositoryAlias(dep.Repository); ok {
+			for _, locked := range chart.Lock.Dependencies {
+				if locked.Name == dep.Name {
+					dep.Repository = locked.Repository
+				}
+			}
+		}
+		resolved[i] = &dep
+	}
+	sum, err := hashDependencies([2][]*helmchart.Dependency{resolved, chart.Lock.Dependencies})
+	if err != nil {
+		return err
+	}
+	if sum != chart.Lock.Digest {
+		// the lock files of the v1 charts may have been written by Helm 2,
+		// which hashes the dependencies only
+		v2Sum, err := hashDependencies(map[string][]*helmchart.Dependency{"dependencies": reqs})
+		if err != nil {
+			return err
+		}
+		if chart.Metadata.APIVersion != helmchart.APIVersionV1 || v2Sum != chart.Lock.Digest {
+			return fmt.Errorf("the lock file (%s) of chart '%s' is out of sync with its dependencies", lockFile, chart.Name())
+		}
+	}
+
+	for _, vendored := range chart.Dependencies() {
+		for _, locked := range chart.Lock.Dependencies {
+			if locked.Name == vendored.Name() && locked.Version != vendored.Metadata.Version {
+				return fmt.Errorf("dependency '%s' version '%s' in the charts directory of chart '%s' does not match the locked version '%s'",
+					vendored.Name(), vendored.Metadata.Version, chart.Name(), locked.Version)
+			}
+		}
+	}
+	return nil
+}
+
+// hashDependencies returns the digest of the given dependencies, in the
+// format of the digest of the Helm lock files.
+func hashDependencies(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	s, err := provenance.Digest(bytes.NewBuffer(data))
+	return "sha256:" + s, err
+}
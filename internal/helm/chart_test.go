@@ -18,6 +18,7 @@ package helm
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 
 	helmchart "helm.sh/helm/v3/pkg/chart"
@@ -111,3 +112,174 @@ func TestOverwriteChartDefaultValues(t *testing.T) {
 		})
 	}
 }
+
+func TestExcludeChartFiles(t *testing.T) {
+	newChart := func() *helmchart.Chart {
+		dep := &helmchart.Chart{
+			Metadata:  &helmchart.Metadata{Name: "dep", Version: "0.1.0"},
+			Templates: []*helmchart.File{{Name: "templates/deployment.yaml"}, {Name: "templates/tests/test.yaml"}},
+			Files:     []*helmchart.File{{Name: "values.yaml"}, {Name: "README.md"}},
+		}
+		c := &helmchart.Chart{
+			Metadata:  &helmchart.Metadata{Name: "test", Version: "0.1.0"},
+			Templates: []*helmchart.File{{Name: "templates/deployment.yaml"}, {Name: "templates/tests/test.yaml"}},
+			Files:     []*helmchart.File{{Name: "values.yaml"}, {Name: "README.md"}, {Name: "crds/crd.yaml"}, {Name: "docs/index.md"}},
+		}
+		c.AddDependency(dep)
+		return c
+	}
+	var names func(c *helmchart.Chart) []string
+	names = func(c *helmchart.Chart) []string {
+		var n []string
+		for _, f := range append(append([]*helmchart.File{}, c.Templates...), c.Files...) {
+			n = append(n, f.Name)
+		}
+		for _, d := range c.Dependencies() {
+			for _, name := range names(d) {
+				n = append(n, "charts/"+d.Name()+"/"+name)
+			}
+		}
+		return n
+	}
+
+	tests := []struct {
+		name         string
+		patterns     []string
+		wantExcluded bool
+		wantFiles    []string
+	}{
+		{
+			name: "no patterns",
+			wantFiles: []string{
+				"templates/deployment.yaml", "templates/tests/test.yaml", "values.yaml", "README.md", "crds/crd.yaml", "docs/index.md",
+				"charts/dep/templates/deployment.yaml", "charts/dep/templates/tests/test.yaml", "charts/dep/values.yaml", "charts/dep/README.md",
+			},
+		},
+		{
+			name:         "dependency tests and docs",
+			patterns:     []string{"charts/*/templates/tests/", "docs/", "*.md"},
+			wantExcluded: true,
+			wantFiles: []string{
+				"templates/deployment.yaml", "templates/tests/test.yaml", "values.yaml", "crds/crd.yaml",
+				"charts/dep/templates/deployment.yaml", "charts/dep/values.yaml",
+			},
+		},
+		{
+			name:         "values files are kept",
+			patterns:     []string{"/crds/", "values.yaml", "/charts/"},
+			wantExcluded: true,
+			wantFiles: []string{
+				"templates/deployment.yaml", "templates/tests/test.yaml", "values.yaml", "README.md", "docs/index.md",
+				"charts/dep/values.yaml",
+			},
+		},
+		{
+			name:      "no match",
+			patterns:  []string{"*.tgz"},
+			wantFiles: names(newChart()),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newChart()
+			if got := ExcludeChartFiles(c, tt.patterns); got != tt.wantExcluded {
+				t.Errorf("ExcludeChartFiles() = %v, want %v", got, tt.wantExcluded)
+			}
+			if got := names(c); !reflect.DeepEqual(got, tt.wantFiles) {
+				t.Errorf("files = %v, want %v", got, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestVerifyChartLock(t *testing.T) {
+	newChart := func(reqs []*helmchart.Dependency, locked []*helmchart.Dependency, vendored ...*helmchart.Chart) *helmchart.Chart {
+		t.Helper()
+		c := &helmchart.Chart{
+			Metadata: &helmchart.Metadata{Name: "test", Version: "0.1.0", APIVersion: helmchart.APIVersionV2, Dependencies: reqs},
+		}
+		if locked != nil {
+			// the digest is the one of the dependencies resolved by Helm
+			resolved := make([]*helmchart.Dependency, len(reqs))
+			for i, req := range reqs {
+				dep := *req
+				if dep.Repository == "@bitnami" {
+					dep.Repository = "https://charts.bitnami.com/bitnami"
+				}
+				resolved[i] = &dep
+			}
+			digest, err := hashDependencies([2][]*helmchart.Dependency{resolved, locked})
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Lock = &helmchart.Lock{Digest: digest, Dependencies: locked}
+		}
+		for _, v := range vendored {
+			c.AddDependency(v)
+		}
+		return c
+	}
+	reqs := []*helmchart.Dependency{
+		{Name: "redis", Version: "~14.0.0", Repository: "@bitnami"},
+		{Name: "common", Version: "1.x", Repository: "file://../common"},
+	}
+	locked := []*helmchart.Dependency{
+		{Name: "redis", Version: "14.0.2", Repository: "https://charts.bitnami.com/bitnami"},
+		{Name: "common", Version: "1.2.0", Repository: "file://../common"},
+	}
+
+	tests := []struct {
+		name    string
+		chart   *helmchart.Chart
+		wantErr string
+	}{
+		{
+			name:  "no dependencies",
+			chart: newChart(nil, nil),
+		},
+		{
+			name:  "locked dependencies",
+			chart: newChart(reqs, locked),
+		},
+		{
+			name:    "no lock file",
+			chart:   newChart(reqs, nil),
+			wantErr: "no Chart.lock found",
+		},
+		{
+			name: "out of sync lock file",
+			chart: func() *helmchart.Chart {
+				c := newChart(reqs, locked)
+				c.Metadata.Dependencies = []*helmchart.Dependency{
+					{Name: "redis", Version: "~15.0.0", Repository: "@bitnami"},
+					reqs[1],
+				}
+				return c
+			}(),
+			wantErr: "out of sync",
+		},
+		{
+			name:  "vendored locked version",
+			chart: newChart(reqs, locked, &helmchart.Chart{Metadata: &helmchart.Metadata{Name: "redis", Version: "14.0.2"}}),
+		},
+		{
+			name:    "vendored other version",
+			chart:   newChart(reqs, locked, &helmchart.Chart{Metadata: &helmchart.Metadata{Name: "redis", Version: "14.0.4"}}),
+			wantErr: "does not match the locked version '14.0.2'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyChartLock(tt.chart)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("VerifyChartLock() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("VerifyChartLock() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,456 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	yamlv3 "gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// DefaultIndexMaxSize is the default maximum size of a chart repository
+	// index, in bytes.
+	DefaultIndexMaxSize int64 = 50 << 20
+	// DefaultIndexMaxEntries is the default maximum number of chart versions
+	// of a chart repository index.
+	DefaultIndexMaxEntries = 100000
+)
+
+var (
+	// ErrIndexTooLarge is returned when a chart repository index is larger
+	// than the maximum size of the IndexLimits.
+	ErrIndexTooLarge = errors.New("index exceeds the maximum size")
+	// ErrIndexTooManyEntries is returned when a chart repository index holds
+	// more chart versions than the maximum of the IndexLimits.
+	ErrIndexTooManyEntries = errors.New("index exceeds the maximum number of chart versions")
+	// ErrIndexMalformed is returned when a chart repository index is not a
+	// valid index document.
+	ErrIndexMalformed = errors.New("malformed index")
+)
+
+// IndexLimits bounds the resources used to load a chart repository index.
+// The zero values are replaced by the defaults.
+type IndexLimits struct {
+	// MaxSize is the maximum size of the index, in bytes.
+	MaxSize int64
+	// MaxEntries is the maximum number of chart versions of the index, all
+	// charts combined.
+	MaxEntries int
+}
+
+// withDefaults returns the IndexLimits with the defaults for the zero values.
+func (l IndexLimits) withDefaults() IndexLimits {
+	if l.MaxSize <= 0 {
+		l.MaxSize = DefaultIndexMaxSize
+	}
+	if l.MaxEntries <= 0 {
+		l.MaxEntries = DefaultIndexMaxEntries
+	}
+	return l
+}
+
+// checkSize returns an error wrapping ErrIndexTooLarge if the given size is
+// above the maximum size.
+func (l IndexLimits) checkSize(size int64) error {
+	if max := l.withDefaults().MaxSize; size > max {
+		return fmt.Errorf("%w: %d bytes, the limit is %d bytes", ErrIndexTooLarge, size, max)
+	}
+	return nil
+}
+
+// errNotBlockStyle is returned by parseIndexLines for the indexes with
+// another layout than the block style one of the indexes generated by Helm.
+var errNotBlockStyle = errors.New("index not in block style")
+
+// parseIndex parses the given index within the given IndexLimits. The indexes
+// in the block style of the ones generated by Helm are read line by line with
+// parseIndexLines, the other ones being parsed as a YAML node tree with
+// parseIndexTree. The anchors and aliases, which the indexes generated by
+// Helm never use, are refused to prevent their exponential expansion.
+func parseIndex(b []byte, limits IndexLimits) (*repo.IndexFile, error) {
+	limits = limits.withDefaults()
+	if err := limits.checkSize(int64(len(b))); err != nil {
+		return nil, err
+	}
+	i, err := parseIndexLines(b, limits)
+	if errors.Is(err, errNotBlockStyle) {
+		return parseIndexTree(b, limits)
+	}
+	return i, err
+}
+
+// parseIndexLines parses the given block style index line by line. Each
+// chart version is counted when its first line is read, and the versions of
+// each chart are decoded once their last line is read, so that the index is
+// never held as a whole in a YAML node tree nor in JSON. It returns
+// errNotBlockStyle as soon as a line does not have the expected layout.
+func parseIndexLines(b []byte, limits IndexLimits) (*repo.IndexFile, error) {
+	s := &indexScanner{b: b}
+	var header []byte
+	var entries map[string]repo.ChartVersions
+	var count int
+	for s.scan() {
+		line := s.text()
+		if s.indent != 0 || line[0] == '-' || line[0] == '%' || line[0] == '.' || line[0] == '"' || line[0] == '\'' {
+			// indented document, sequence, directive, document marker or
+			// quoted key
+			return nil, errNotBlockStyle
+		}
+		if bytes.HasPrefix(line, []byte("entries:")) {
+			if entries != nil {
+				return nil, fmt.Errorf("%w: duplicate entries", ErrIndexMalformed)
+			}
+			if len(line) != len("entries:") {
+				return nil, errNotBlockStyle
+			}
+			entries = make(map[string]repo.ChartVersions)
+			if err := parseEntries(s, entries, &count, limits); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		start := s.start
+		for s.scan() {
+			if s.indent == 0 {
+				s.unscan()
+				break
+			}
+		}
+		header = append(header, b[start:s.offset()]...)
+		header = append(header, '\n')
+	}
+
+	i := &repo.IndexFile{}
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(header, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrIndexMalformed, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, repo.ErrNoAPIVersion
+	}
+	root := doc.Content[0]
+	if root.Kind != yamlv3.MappingNode {
+		return nil, errNotBlockStyle
+	}
+	for j := 0; j < len(root.Content); j += 2 {
+		if root.Content[j].Value == "entries" {
+			return nil, errNotBlockStyle
+		}
+	}
+	if err := refuseAliases(root); err != nil {
+		return nil, err
+	}
+	if err := decodeNode(root, i); err != nil {
+		return nil, err
+	}
+	if i.APIVersion == "" {
+		return nil, repo.ErrNoAPIVersion
+	}
+	i.Entries = entries
+	if i.Entries == nil {
+		i.Entries = make(map[string]repo.ChartVersions)
+	}
+	return i, nil
+}
+
+// parseEntries parses the charts of the entries of a block style index into
+// the given map, adding the number of chart versions to the given count.
+func parseEntries(s *indexScanner, entries map[string]repo.ChartVersions, count *int, limits IndexLimits) error {
+	indent := -1
+	for s.scan() {
+		if s.indent == 0 {
+			s.unscan()
+			return nil
+		}
+		if indent < 0 {
+			indent = s.indent
+		}
+		if s.indent != indent {
+			return errNotBlockStyle
+		}
+		name, ok := chartKey(s.text())
+		if !ok {
+			return errNotBlockStyle
+		}
+		if _, ok := entries[name]; ok {
+			return fmt.Errorf("%w: duplicate chart '%s'", ErrIndexMalformed, name)
+		}
+		versions, err := parseVersions(s, indent, count, limits)
+		if err != nil {
+			return fmt.Errorf("chart '%s': %w", name, err)
+		}
+		entries[name] = versions
+	}
+	return nil
+}
+
+// parseVersions parses the sequence of chart versions of the chart with the
+// key at the given indentation, adding their number to the given count
+// before they are decoded.
+func parseVersions(s *indexScanner, keyIndent int, count *int, limits IndexLimits) (repo.ChartVersions, error) {
+	start, indent := -1, -1
+	for s.scan() {
+		if s.indent < keyIndent || (s.indent == keyIndent && !isSequenceItem(s.text())) {
+			s.unscan()
+			break
+		}
+		if indent < 0 {
+			start, indent = s.start, s.indent
+		}
+		if s.indent != indent || !isSequenceItem(s.text()) {
+			return nil, errNotBlockStyle
+		}
+		if *count++; *count > limits.MaxEntries {
+			return nil, fmt.Errorf("%w: more than %d chart versions", ErrIndexTooManyEntries, limits.MaxEntries)
+		}
+		for s.scan() {
+			if s.indent <= indent {
+				s.unscan()
+				break
+			}
+		}
+	}
+	if start < 0 {
+		return nil, nil
+	}
+	return decodeChartVersions(s.b[start:s.offset()])
+}
+
+// decodeChartVersions decodes the given lines of a sequence of chart
+// versions, with the strict semantics of yaml.UnmarshalStrict.
+func decodeChartVersions(versions []byte) (repo.ChartVersions, error) {
+	// the anchors and aliases start with '&' and '*', which are only looked
+	// for in a YAML node tree when found in the lines
+	if bytes.ContainsAny(versions, "&*") {
+		var doc yamlv3.Node
+		if err := yamlv3.Unmarshal(versions, &doc); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrIndexMalformed, err)
+		}
+		if err := refuseAliases(&doc); err != nil {
+			return nil, err
+		}
+	}
+	var cvs repo.ChartVersions
+	if err := yaml.UnmarshalStrict(versions, &cvs); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrIndexMalformed, err)
+	}
+	for k, cv := range cvs {
+		if cv == nil {
+			cvs[k] = &repo.ChartVersion{}
+		}
+	}
+	return cvs, nil
+}
+
+// chartKey returns the name of the chart of the given line of the entries,
+// and false if the line is not a key without an inline value.
+func chartKey(line []byte) (string, bool) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(line, &doc); err != nil || len(doc.Content) != 1 {
+		return "", false
+	}
+	m := doc.Content[0]
+	if m.Kind != yamlv3.MappingNode || len(m.Content) != 2 || m.Content[0].Kind != yamlv3.ScalarNode {
+		return "", false
+	}
+	if v := m.Content[1]; v.Kind != yamlv3.ScalarNode || v.Tag != "!!null" || v.Value != "" {
+		return "", false
+	}
+	return m.Content[0].Value, true
+}
+
+// isSequenceItem returns true if the given line starts a block sequence item.
+func isSequenceItem(line []byte) bool {
+	return line[0] == '-' && (len(line) == 1 || line[1] == ' ')
+}
+
+// indexScanner reads the lines of an index which are neither blank nor a
+// comment, one at a time.
+type indexScanner struct {
+	b []byte
+	// next is the offset of the line after the current one.
+	next int
+	// start, end and indent are the offsets of the start and of the end of
+	// the current line, and its indentation.
+	start, end, indent int
+	unscanned          bool
+}
+
+// scan advances to the next line which is neither blank nor a comment, or
+// to the current line again after unscan. It returns false at the end of the
+// index.
+func (s *indexScanner) scan() bool {
+	if s.unscanned {
+		s.unscanned = false
+		return true
+	}
+	for s.next < len(s.b) {
+		start := s.next
+		end := bytes.IndexByte(s.b[start:], '\n')
+		if end < 0 {
+			end = len(s.b)
+		} else {
+			end += start
+		}
+		s.next = end + 1
+		line := bytes.TrimRight(s.b[start:end], " \r")
+		content := bytes.TrimLeft(line, " ")
+		if len(content) == 0 || content[0] == '#' {
+			continue
+		}
+		s.start, s.end, s.indent = start, start+len(line), len(line)-len(content)
+		return true
+	}
+	s.start = len(s.b)
+	return false
+}
+
+// unscan makes the next call to scan return the current line again.
+func (s *indexScanner) unscan() {
+	s.unscanned = true
+}
+
+// text returns the current line, without its indentation.
+func (s *indexScanner) text() []byte {
+	return s.b[s.start+s.indent : s.end]
+}
+
+// offset returns the offset of the line returned by the next call to scan,
+// or the length of the index at its end.
+func (s *indexScanner) offset() int {
+	if s.unscanned {
+		return s.start
+	}
+	return len(s.b)
+}
+
+// parseIndexTree parses the given index within the given IndexLimits from its
+// YAML node tree. Instead of converting the whole document to JSON at once,
+// the chart versions are decoded one at a time from the tree, and released
+// once decoded. The number of chart versions is checked before they are
+// decoded.
+func parseIndexTree(b []byte, limits IndexLimits) (*repo.IndexFile, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.NewDecoder(bytes.NewReader(b)).Decode(&doc); err != nil {
+		if err == io.EOF {
+			return nil, repo.ErrNoAPIVersion
+		}
+		return nil, fmt.Errorf("%w: %s", ErrIndexMalformed, err)
+	}
+	if len(doc.Content) != 1 || doc.Content[0].Kind != yamlv3.MappingNode {
+		return nil, fmt.Errorf("%w: the document is not a mapping", ErrIndexMalformed)
+	}
+	root := doc.Content[0]
+	if err := refuseAliases(root); err != nil {
+		return nil, err
+	}
+
+	// Detach the entries from the document, which is decoded without them
+	var entries *yamlv3.Node
+	fields := make([]*yamlv3.Node, 0, len(root.Content))
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "entries" {
+			fields = append(fields, root.Content[i], root.Content[i+1])
+			continue
+		}
+		if entries != nil {
+			return nil, fmt.Errorf("%w: duplicate entries", ErrIndexMalformed)
+		}
+		entries = root.Content[i+1]
+	}
+	root.Content = fields
+	i := &repo.IndexFile{}
+	if err := decodeNode(root, i); err != nil {
+		return nil, err
+	}
+	if i.APIVersion == "" {
+		return nil, repo.ErrNoAPIVersion
+	}
+	i.Entries = make(map[string]repo.ChartVersions)
+	if entries == nil || entries.Tag == "!!null" {
+		return i, nil
+	}
+	if entries.Kind != yamlv3.MappingNode {
+		return nil, fmt.Errorf("%w: the entries are not a mapping", ErrIndexMalformed)
+	}
+
+	var count int
+	for j := 0; j < len(entries.Content); j += 2 {
+		name, versions := entries.Content[j].Value, entries.Content[j+1]
+		if _, ok := i.Entries[name]; ok {
+			return nil, fmt.Errorf("%w: duplicate chart '%s'", ErrIndexMalformed, name)
+		}
+		if versions.Tag == "!!null" {
+			i.Entries[name] = nil
+			continue
+		}
+		if versions.Kind != yamlv3.SequenceNode {
+			return nil, fmt.Errorf("%w: the versions of chart '%s' are not a sequence", ErrIndexMalformed, name)
+		}
+		count += len(versions.Content)
+		if count > limits.MaxEntries {
+			return nil, fmt.Errorf("%w: more than %d chart versions", ErrIndexTooManyEntries, limits.MaxEntries)
+		}
+		cvs := make(repo.ChartVersions, 0, len(versions.Content))
+		for k, version := range versions.Content {
+			cv := &repo.ChartVersion{}
+			if err := decodeNode(version, cv); err != nil {
+				return nil, fmt.Errorf("chart '%s': %w", name, err)
+			}
+			cvs = append(cvs, cv)
+			versions.Content[k] = nil
+		}
+		i.Entries[name] = cvs
+		entries.Content[j+1] = nil
+	}
+	return i, nil
+}
+
+// decodeNode decodes the given YAML node into the given object, with the
+// strict semantics of yaml.UnmarshalStrict.
+func decodeNode(node *yamlv3.Node, obj interface{}) error {
+	b, err := yamlv3.Marshal(node)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrIndexMalformed, err)
+	}
+	if err := yaml.UnmarshalStrict(b, obj); err != nil {
+		return fmt.Errorf("%w: %s", ErrIndexMalformed, err)
+	}
+	return nil
+}
+
+// refuseAliases returns an error wrapping ErrIndexMalformed if the given
+// node tree has an anchor or an alias. The tree is walked iteratively, as its
+// depth is controlled by the index.
+func refuseAliases(root *yamlv3.Node) error {
+	stack := []*yamlv3.Node{root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n.Kind == yamlv3.AliasNode || n.Anchor != "" {
+			return fmt.Errorf("%w: anchors and aliases are not supported (line %d)", ErrIndexMalformed, n.Line)
+		}
+		stack = append(stack, n.Content...)
+	}
+	return nil
+}
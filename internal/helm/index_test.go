@@ -0,0 +1,244 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+)
+
+func Test_parseIndex_parity(t *testing.T) {
+	for _, filename := range []string{testfile, chartmuseumtestfile, unorderedtestfile} {
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := &repo.IndexFile{}
+		if err := yaml.UnmarshalStrict(b, want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := parseIndex(b, IndexLimits{})
+		if err != nil {
+			t.Fatalf("parseIndex(%s) error = %v", filename, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("parseIndex(%s) = %+v, want %+v", filename, got, want)
+		}
+		if _, err := parseIndexLines(b, IndexLimits{}.withDefaults()); err != nil {
+			t.Errorf("parseIndexLines(%s) error = %v", filename, err)
+		}
+	}
+}
+
+func Test_parseIndex(t *testing.T) {
+	index := `
+apiVersion: v1
+entries:
+  alpine:
+    - name: alpine
+      version: 1.0.0
+      appVersion: "1.0"
+    - name: alpine
+      version: 0.9.0
+  nginx:
+    - name: nginx
+      version: 0.2.0
+`
+	tests := []struct {
+		name    string
+		index   string
+		limits  IndexLimits
+		wantErr error
+	}{
+		{name: "within limits", index: index, limits: IndexLimits{MaxSize: int64(len(index)), MaxEntries: 3}},
+		{name: "too large", index: index, limits: IndexLimits{MaxSize: int64(len(index)) - 1}, wantErr: ErrIndexTooLarge},
+		{name: "too many entries", index: index, limits: IndexLimits{MaxEntries: 2}, wantErr: ErrIndexTooManyEntries},
+		{name: "empty", index: "", wantErr: repo.ErrNoAPIVersion},
+		{name: "no API version", index: "entries: {}\n", wantErr: repo.ErrNoAPIVersion},
+		{name: "invalid YAML", index: "apiVersion: v1\nentries: [\n", wantErr: ErrIndexMalformed},
+		{name: "not a mapping", index: "- apiVersion: v1\n", wantErr: ErrIndexMalformed},
+		{name: "unknown field", index: "apiVersion: v1\nunknown: true\n", wantErr: ErrIndexMalformed},
+		{name: "unknown chart field", index: "apiVersion: v1\nentries:\n  nginx:\n    - unknown: true\n", wantErr: ErrIndexMalformed},
+		{name: "entries not a mapping", index: "apiVersion: v1\nentries: []\n", wantErr: ErrIndexMalformed},
+		{name: "versions not a sequence", index: "apiVersion: v1\nentries:\n  nginx: {}\n", wantErr: ErrIndexMalformed},
+		{name: "duplicate entries", index: "apiVersion: v1\nentries: {}\nentries: {}\n", wantErr: ErrIndexMalformed},
+		{name: "duplicate charts", index: indexWithDuplicates, wantErr: ErrIndexMalformed},
+		{
+			name:    "aliases",
+			index:   "apiVersion: v1\nentries:\n  nginx:\n    - &v\n      name: nginx\n      version: 0.2.0\n    - *v\n",
+			wantErr: ErrIndexMalformed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseIndex([]byte(tt.index), tt.limits)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("parseIndex() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseIndex() error = %v", err)
+			}
+			if len(got.Entries["alpine"]) != 2 || len(got.Entries["nginx"]) != 1 {
+				t.Errorf("parseIndex() entries = %v", got.Entries)
+			}
+			if got.Entries["alpine"][0].AppVersion != "1.0" {
+				t.Errorf("parseIndex() appVersion = %q, want 1.0", got.Entries["alpine"][0].AppVersion)
+			}
+		})
+	}
+}
+
+func Test_parseIndex_layouts(t *testing.T) {
+	tests := []struct {
+		name      string
+		index     string
+		wantLines bool
+	}{
+		{
+			name:      "sequences at the indentation of the keys",
+			index:     "apiVersion: v1\nentries:\n  nginx:\n  - name: nginx\n    version: 0.2.0\n  - name: nginx\n    version: 0.1.0\n  alpine:\n  - name: alpine\n    version: 1.0.0\ngenerated: \"2021-01-01T00:00:00Z\"\n",
+			wantLines: true,
+		},
+		{
+			name:      "comments, blank lines and CRLF",
+			index:     "# index\r\napiVersion: v1\r\n\r\nentries:\r\n  # charts\r\n  nginx:\r\n\r\n    - name: nginx # latest\r\n      version: 0.2.0\r\n",
+			wantLines: true,
+		},
+		{
+			name:      "block scalar",
+			index:     "apiVersion: v1\nentries:\n  nginx:\n    - name: nginx\n      description: |\n        # nginx\n\n        - web server\n      version: 0.2.0\n",
+			wantLines: true,
+		},
+		{
+			name:      "null chart",
+			index:     "apiVersion: v1\nentries:\n  nginx:\n  alpine:\n    - name: alpine\n      version: 1.0.0\n",
+			wantLines: true,
+		},
+		{
+			name:  "flow entries",
+			index: "apiVersion: v1\nentries: {nginx: [{name: nginx, version: 0.2.0}]}\n",
+		},
+		{
+			name:  "flow versions",
+			index: "apiVersion: v1\nentries:\n  nginx: [{name: nginx, version: 0.2.0}]\n",
+		},
+		{
+			name:  "document marker",
+			index: "---\napiVersion: v1\nentries:\n  nginx:\n    - name: nginx\n      version: 0.2.0\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := &repo.IndexFile{}
+			if err := yaml.UnmarshalStrict([]byte(tt.index), want); err != nil {
+				t.Fatal(err)
+			}
+			if want.Entries == nil {
+				want.Entries = map[string]repo.ChartVersions{}
+			}
+			got, err := parseIndex([]byte(tt.index), IndexLimits{})
+			if err != nil {
+				t.Fatalf("parseIndex() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("parseIndex() = %+v, want %+v", got, want)
+			}
+			_, err = parseIndexLines([]byte(tt.index), IndexLimits{}.withDefaults())
+			if gotLines := !errors.Is(err, errNotBlockStyle); gotLines != tt.wantLines {
+				t.Errorf("parseIndexLines() error = %v, want parsed line by line %v", err, tt.wantLines)
+			}
+		})
+	}
+}
+
+// largeIndex returns a block style index of the given number of charts,
+// with the given number of versions each.
+func largeIndex(charts, versions int) []byte {
+	var b strings.Builder
+	b.WriteString("apiVersion: v1\nentries:\n")
+	for c := 0; c < charts; c++ {
+		fmt.Fprintf(&b, "  chart-%d:\n", c)
+		for v := 0; v < versions; v++ {
+			fmt.Fprintf(&b, "  - name: chart-%d\n    version: 1.0.%d\n    digest: %064d\n    urls:\n    - https://charts.example.com/chart-%d-1.0.%d.tgz\n",
+				c, v, v, c, v)
+		}
+	}
+	return []byte(b.String())
+}
+
+func Test_parseIndex_allocations(t *testing.T) {
+	b := largeIndex(100, 200)
+	allocated := func(f func()) uint64 {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		f()
+		runtime.ReadMemStats(&after)
+		return after.TotalAlloc - before.TotalAlloc
+	}
+
+	// the number of chart versions is enforced as the index is read
+	limits := IndexLimits{MaxEntries: 100}
+	if got := allocated(func() {
+		if _, err := parseIndex(b, limits); !errors.Is(err, ErrIndexTooManyEntries) {
+			t.Errorf("parseIndex() error = %v, want %v", err, ErrIndexTooManyEntries)
+		}
+	}); got > uint64(len(b)) {
+		t.Errorf("parseIndex() allocated %d bytes before exceeding the limit of %d chart versions, the index is %d bytes",
+			got, limits.MaxEntries, len(b))
+	}
+}
+
+func BenchmarkParseIndex(b *testing.B) {
+	index := largeIndex(100, 200)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(index)))
+	for n := 0; n < b.N; n++ {
+		if _, err := parseIndex(index, IndexLimits{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestChartRepository_DownloadIndex_TooLarge(t *testing.T) {
+	mg := mockGetter{response: []byte("apiVersion: v1\n" + strings.Repeat("#", 64))}
+	r := &ChartRepository{
+		URL:         "https://example.com",
+		Client:      &mg,
+		Verifier:    verifierFunc(func([]byte) error { t.Error("index verified"); return nil }),
+		IndexLimits: IndexLimits{MaxSize: 64},
+	}
+	if err := r.DownloadIndex(); !errors.Is(err, ErrIndexTooLarge) {
+		t.Errorf("DownloadIndex() error = %v, want %v", err, ErrIndexTooLarge)
+	}
+}
+
+type verifierFunc func([]byte) error
+
+func (f verifierFunc) Verify(index []byte, _ func(string) ([]byte, error)) error {
+	return f(index)
+}
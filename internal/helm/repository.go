@@ -18,6 +18,7 @@ package helm
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/url"
@@ -28,9 +29,10 @@ import (
 	"github.com/Masterminds/semver/v3"
 	"helm.sh/helm/v3/pkg/getter"
 	"helm.sh/helm/v3/pkg/repo"
-	"sigs.k8s.io/yaml"
 
 	"github.com/fluxcd/pkg/version"
+
+	"github.com/fluxcd/source-controller/pkg/retry"
 )
 
 // ChartRepository represents a Helm chart repository, and the configuration
@@ -40,6 +42,20 @@ type ChartRepository struct {
 	Index   *repo.IndexFile
 	Client  getter.Getter
 	Options []getter.Option
+	// Verifier verifies the index on download if set.
+	Verifier IndexVerifier
+	// RewriteURL rewrites the absolute URLs of the charts before they are
+	// downloaded if set.
+	RewriteURL func(string) string
+	// CheckURL returns an error if the chart with the given absolute URL
+	// must not be downloaded if set. It is called before RewriteURL.
+	CheckURL func(string) error
+	// Retry retries the downloads of the index and of the charts which fail
+	// with a transient error if set.
+	Retry *retry.Policy
+	// IndexLimits bounds the size and the number of chart versions of the
+	// index.
+	IndexLimits IndexLimits
 }
 
 // NewChartRepository constructs and returns a new ChartRepository with
@@ -62,23 +78,56 @@ func NewChartRepository(repositoryURL string, providers getter.Providers, opts [
 	}, nil
 }
 
+// Version resolution reasons of a VersionResolution.
+const (
+	// ExactVersionResolution is the reason for a version equal to the
+	// requested version.
+	ExactVersionResolution = "ExactVersion"
+	// SemVerConstraintResolution is the reason for the latest version
+	// matching the requested semver.Constraints.
+	SemVerConstraintResolution = "SemVerConstraint"
+	// LatestStableResolution is the reason for the latest stable version,
+	// when no version is requested.
+	LatestStableResolution = "LatestStable"
+)
+
+// VersionResolution describes how ChartRepository.Resolve selected a chart
+// version.
+type VersionResolution struct {
+	// Reason is the reason the version was selected.
+	Reason string
+	// Candidates holds the versions matching the request, sorted from the
+	// latest to the oldest version.
+	Candidates []*repo.ChartVersion
+}
+
 // Get returns the repo.ChartVersion for the given name, the version is expected
 // to be a semver.Constraints compatible string. If version is empty, the latest
 // stable version will be returned and prerelease versions will be ignored.
 func (r *ChartRepository) Get(name, ver string) (*repo.ChartVersion, error) {
+	cv, _, err := r.Resolve(name, ver)
+	return cv, err
+}
+
+// Resolve returns the repo.ChartVersion for the given name and version like
+// Get, together with the VersionResolution describing the selection.
+func (r *ChartRepository) Resolve(name, ver string) (*repo.ChartVersion, *VersionResolution, error) {
 	cvs, ok := r.Index.Entries[name]
 	if !ok {
-		return nil, repo.ErrNoChartName
+		return nil, nil, repo.ErrNoChartName
 	}
 	if len(cvs) == 0 {
-		return nil, repo.ErrNoChartVersion
+		return nil, nil, repo.ErrNoChartVersion
 	}
 
 	// Check for exact matches first
 	if len(ver) != 0 {
 		for _, cv := range cvs {
 			if ver == cv.Version {
-				return cv, nil
+				return cv, &VersionResolution{
+					Reason:     ExactVersionResolution,
+					Candidates: []*repo.ChartVersion{cv},
+				}, nil
 			}
 		}
 	}
@@ -86,14 +135,16 @@ func (r *ChartRepository) Get(name, ver string) (*repo.ChartVersion, error) {
 	// Continue to look for a (semantic) version match
 	verConstraint, err := semver.NewConstraint("*")
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	latestStable := len(ver) == 0 || ver == "*"
+	reason := LatestStableResolution
 	if !latestStable {
 		verConstraint, err = semver.NewConstraint(ver)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
+		reason = SemVerConstraintResolution
 	}
 
 	// Filter out chart versions that doesn't satisfy constraints if any,
@@ -114,7 +165,7 @@ func (r *ChartRepository) Get(name, ver string) (*repo.ChartVersion, error) {
 		lookup[v] = cv
 	}
 	if len(matchedVersions) == 0 {
-		return nil, fmt.Errorf("no chart version found for %s-%s", name, ver)
+		return nil, nil, fmt.Errorf("no chart version found for %s-%s", name, ver)
 	}
 
 	// Sort versions
@@ -136,8 +187,57 @@ func (r *ChartRepository) Get(name, ver string) (*repo.ChartVersion, error) {
 		})()
 	})
 
+	resolution := &VersionResolution{Reason: reason}
+	for _, v := range matchedVersions {
+		resolution.Candidates = append(resolution.Candidates, lookup[v])
+	}
 	latest := matchedVersions[0]
-	return lookup[latest], nil
+	return lookup[latest], resolution, nil
+}
+
+// FilterIndex returns a copy of the given index holding only the chart
+// versions Resolve may select for the given charts, a map of chart names to
+// the versions requested by their consumers.
+func FilterIndex(index *repo.IndexFile, charts map[string][]string) *repo.IndexFile {
+	filtered := &repo.IndexFile{
+		APIVersion:  index.APIVersion,
+		Generated:   index.Generated,
+		Entries:     make(map[string]repo.ChartVersions),
+		PublicKeys:  index.PublicKeys,
+		Annotations: index.Annotations,
+	}
+	for name, versions := range charts {
+		for _, cv := range index.Entries[name] {
+			for _, ver := range versions {
+				if matchesVersion(cv, ver) {
+					filtered.Entries[name] = append(filtered.Entries[name], cv)
+					break
+				}
+			}
+		}
+	}
+	return filtered
+}
+
+// matchesVersion returns true if the given chart version is equal to, or
+// satisfies the semver.Constraints of the given version. An empty version
+// matches the stable versions, like '*'.
+func matchesVersion(cv *repo.ChartVersion, ver string) bool {
+	if ver != "" && ver == cv.Version {
+		return true
+	}
+	if ver == "" {
+		ver = "*"
+	}
+	constraint, err := semver.NewConstraint(ver)
+	if err != nil {
+		return false
+	}
+	v, err := version.ParseVersion(cv.Version)
+	if err != nil {
+		return false
+	}
+	return constraint.Check(v)
 }
 
 // DownloadChart confirms the given repo.ChartVersion has a downloadable URL,
@@ -170,25 +270,43 @@ func (r *ChartRepository) DownloadChart(chart *repo.ChartVersion) (*bytes.Buffer
 		repoURL.Path = strings.TrimSuffix(repoURL.Path, "/") + "/"
 		u = repoURL.ResolveReference(u)
 		u.RawQuery = q.Encode()
+	} else {
+		if r.CheckURL != nil {
+			if err := r.CheckURL(u.String()); err != nil {
+				return nil, err
+			}
+		}
+		if r.RewriteURL != nil {
+			return r.get(r.RewriteURL(u.String()))
+		}
 	}
 
-	return r.Client.Get(u.String(), r.Options...)
+	return r.get(u.String())
+}
+
+// get downloads the given URL using the Client and set Options, retrying the
+// transient failures with the Retry policy.
+func (r *ChartRepository) get(u string) (b *bytes.Buffer, err error) {
+	err = r.Retry.Do(context.Background(), func() error {
+		b, err = r.Client.Get(u, r.Options...)
+		return err
+	})
+	return b, err
 }
 
 // LoadIndex loads the given bytes into the Index while performing
 // minimal validity checks. It fails if the API version is not set
-// (repo.ErrNoAPIVersion), or if the unmarshal fails.
+// (repo.ErrNoAPIVersion), or with an error wrapping ErrIndexTooLarge,
+// ErrIndexTooManyEntries or ErrIndexMalformed if the index exceeds the
+// IndexLimits or cannot be decoded.
 //
 // The logic is derived from and on par with:
 // https://github.com/helm/helm/blob/v3.3.4/pkg/repo/index.go#L301
 func (r *ChartRepository) LoadIndex(b []byte) error {
-	i := &repo.IndexFile{}
-	if err := yaml.UnmarshalStrict(b, i); err != nil {
+	i, err := parseIndex(b, r.IndexLimits)
+	if err != nil {
 		return err
 	}
-	if i.APIVersion == "" {
-		return repo.ErrNoAPIVersion
-	}
 	i.SortEntries()
 	r.Index = i
 	return nil
@@ -196,23 +314,42 @@ func (r *ChartRepository) LoadIndex(b []byte) error {
 
 // DownloadIndex attempts to download the chart repository index using
 // the Client and set Options, and loads the index file into the Index.
-// It returns an error on URL parsing and Client failures.
+// If a Verifier is set, the index is verified before it is loaded, and an
+// error wrapping ErrIndexVerification is returned if the verification fails.
+// It returns an error on URL parsing and Client failures, and an error
+// wrapping ErrIndexTooLarge before the verification if the index exceeds the
+// maximum size of the IndexLimits.
 func (r *ChartRepository) DownloadIndex() error {
-	u, err := url.Parse(r.URL)
+	b, err := r.download("index.yaml")
 	if err != nil {
 		return err
 	}
-	u.RawPath = path.Join(u.RawPath, "index.yaml")
-	u.Path = path.Join(u.Path, "index.yaml")
-
-	res, err := r.Client.Get(u.String(), r.Options...)
-	if err != nil {
+	if err := r.IndexLimits.checkSize(int64(len(b))); err != nil {
 		return err
 	}
-	b, err := io.ReadAll(res)
-	if err != nil {
-		return err
+
+	if r.Verifier != nil {
+		if err := r.Verifier.Verify(b, r.download); err != nil {
+			return fmt.Errorf("%w: %s", ErrIndexVerification, err)
+		}
 	}
 
 	return r.LoadIndex(b)
 }
+
+// download downloads the file with the given name relative to the chart
+// repository URL using the Client and set Options.
+func (r *ChartRepository) download(name string) ([]byte, error) {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return nil, err
+	}
+	u.RawPath = path.Join(u.RawPath, name)
+	u.Path = path.Join(u.Path, name)
+
+	res, err := r.get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(res)
+}
@@ -18,6 +18,8 @@ package helm
 
 import (
 	"bytes"
+	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"reflect"
@@ -28,6 +30,8 @@ import (
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/getter"
 	"helm.sh/helm/v3/pkg/repo"
+
+	"github.com/fluxcd/source-controller/pkg/retry"
 )
 
 const (
@@ -180,10 +184,118 @@ func TestChartRepository_Get(t *testing.T) {
 	}
 }
 
+func TestChartRepository_Resolve(t *testing.T) {
+	i := repo.NewIndexFile()
+	for _, v := range []string{"0.1.0", "0.2.0", "1.0.0", "1.1.0-rc.1", "invalid"} {
+		i.Add(&chart.Metadata{Name: "chart", Version: v}, "chart-"+v+".tgz", "http://example.com/charts", "sha256:1234567890")
+	}
+	i.SortEntries()
+	r := &ChartRepository{Index: i}
+
+	tests := []struct {
+		name           string
+		chartVersion   string
+		wantReason     string
+		wantCandidates []string
+	}{
+		{
+			name:           "exact match",
+			chartVersion:   "0.2.0",
+			wantReason:     ExactVersionResolution,
+			wantCandidates: []string{"0.2.0"},
+		},
+		{
+			name:           "semver range",
+			chartVersion:   "<1.0.0",
+			wantReason:     SemVerConstraintResolution,
+			wantCandidates: []string{"0.2.0", "0.1.0"},
+		},
+		{
+			name:           "stable version",
+			wantReason:     LatestStableResolution,
+			wantCandidates: []string{"1.0.0", "0.2.0", "0.1.0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cv, resolution, err := r.Resolve("chart", tt.chartVersion)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if resolution.Reason != tt.wantReason {
+				t.Errorf("Resolve() reason = %s, want %s", resolution.Reason, tt.wantReason)
+			}
+			var got []string
+			for _, c := range resolution.Candidates {
+				got = append(got, c.Version)
+			}
+			if !reflect.DeepEqual(got, tt.wantCandidates) {
+				t.Errorf("Resolve() candidates = %v, want %v", got, tt.wantCandidates)
+			}
+			if cv != resolution.Candidates[0] {
+				t.Errorf("Resolve() = %s, want first candidate %s", cv.Version, resolution.Candidates[0].Version)
+			}
+		})
+	}
+}
+
+func TestFilterIndex(t *testing.T) {
+	i := repo.NewIndexFile()
+	for _, v := range []string{"0.1.0", "0.2.0", "1.0.0", "1.1.0-rc.1", "invalid"} {
+		i.Add(&chart.Metadata{Name: "chart", Version: v}, "chart-"+v+".tgz", "http://example.com/charts", "sha256:1234567890")
+		i.Add(&chart.Metadata{Name: "other", Version: v}, "other-"+v+".tgz", "http://example.com/charts", "sha256:1234567890")
+	}
+	i.SortEntries()
+
+	tests := []struct {
+		name   string
+		charts map[string][]string
+		want   map[string][]string
+	}{
+		{
+			name:   "semver range and exact version",
+			charts: map[string][]string{"chart": {"<0.2.0", "1.1.0-rc.1"}},
+			want:   map[string][]string{"chart": {"1.1.0-rc.1", "0.1.0"}},
+		},
+		{
+			name:   "stable versions",
+			charts: map[string][]string{"chart": {""}, "other": {"*"}},
+			want: map[string][]string{
+				"chart": {"1.0.0", "0.2.0", "0.1.0"},
+				"other": {"1.0.0", "0.2.0", "0.1.0"},
+			},
+		},
+		{
+			name:   "unknown chart",
+			charts: map[string][]string{"unknown": {"*"}},
+			want:   map[string][]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filtered := FilterIndex(i, tt.charts)
+			if filtered.APIVersion != i.APIVersion || filtered.Generated != i.Generated {
+				t.Errorf("FilterIndex() did not keep the index metadata")
+			}
+			got := make(map[string][]string)
+			for name, cvs := range filtered.Entries {
+				for _, cv := range cvs {
+					got[name] = append(got[name], cv.Version)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FilterIndex() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestChartRepository_DownloadChart(t *testing.T) {
 	tests := []struct {
 		name         string
 		url          string
+		rewriteURL   func(string) string
+		checkURL     func(string) error
 		chartVersion *repo.ChartVersion
 		wantURL      string
 		wantErr      bool
@@ -197,6 +309,33 @@ func TestChartRepository_DownloadChart(t *testing.T) {
 			},
 			wantURL: "https://example.com/charts/foo-1.0.0.tgz",
 		},
+		{
+			name: "rewritten absolute URL",
+			url:  "https://example.com",
+			rewriteURL: func(u string) string {
+				return strings.Replace(u, "github.com", "github-mirror.internal", 1)
+			},
+			chartVersion: &repo.ChartVersion{
+				Metadata: &chart.Metadata{Name: "chart"},
+				URLs:     []string{"https://github.com/releases/foo-1.0.0.tgz"},
+			},
+			wantURL: "https://github-mirror.internal/releases/foo-1.0.0.tgz",
+		},
+		{
+			name: "denied absolute URL",
+			url:  "https://example.com",
+			checkURL: func(u string) error {
+				if strings.HasPrefix(u, "https://github.com/") {
+					return fmt.Errorf("endpoint '%s' denied", u)
+				}
+				return nil
+			},
+			chartVersion: &repo.ChartVersion{
+				Metadata: &chart.Metadata{Name: "chart"},
+				URLs:     []string{"https://github.com/releases/foo-1.0.0.tgz"},
+			},
+			wantErr: true,
+		},
 		{
 			name:         "no chart URL",
 			chartVersion: &repo.ChartVersion{Metadata: &chart.Metadata{Name: "chart"}},
@@ -215,8 +354,10 @@ func TestChartRepository_DownloadChart(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			mg := mockGetter{}
 			r := &ChartRepository{
-				URL:    tt.url,
-				Client: &mg,
+				URL:        tt.url,
+				Client:     &mg,
+				RewriteURL: tt.rewriteURL,
+				CheckURL:   tt.checkURL,
 			}
 			_, err := r.DownloadChart(tt.chartVersion)
 			if (err != nil) != tt.wantErr {
@@ -249,6 +390,26 @@ func TestChartRepository_DownloadIndex(t *testing.T) {
 	verifyLocalIndex(t, r.Index)
 }
 
+func TestChartRepository_DownloadIndex_Retry(t *testing.T) {
+	b, err := os.ReadFile(chartmuseumtestfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mg := mockGetter{response: b, errs: []error{io.ErrUnexpectedEOF}}
+	r := &ChartRepository{
+		URL:    "https://example.com",
+		Client: &mg,
+		Retry:  retry.NewPolicy(2, time.Millisecond),
+	}
+	if err := r.DownloadIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if mg.calls != 2 {
+		t.Errorf("DownloadIndex() requested the index %d times, want 2", mg.calls)
+	}
+	verifyLocalIndex(t, r.Index)
+}
+
 // Index load tests are derived from https://github.com/helm/helm/blob/v3.3.4/pkg/repo/index_test.go#L108
 // to ensure parity with Helm behaviour.
 func TestChartRepository_LoadIndex(t *testing.T) {
@@ -402,9 +563,16 @@ func verifyLocalIndex(t *testing.T, i *repo.IndexFile) {
 type mockGetter struct {
 	requestedURL string
 	response     []byte
+	// errs are returned by the first calls, in order.
+	errs  []error
+	calls int
 }
 
 func (g *mockGetter) Get(url string, options ...getter.Option) (*bytes.Buffer, error) {
 	g.requestedURL = url
+	g.calls++
+	if g.calls <= len(g.errs) {
+		return nil, g.errs[g.calls-1]
+	}
 	return bytes.NewBuffer(g.response), nil
 }
@@ -25,3 +25,15 @@ func NormalizeChartRepositoryURL(url string) string {
 	}
 	return url
 }
+
+// RepositoryAlias returns the name of the repository the given dependency
+// repository refers to, if it is in the '@name' or 'alias:name' format of
+// Helm.
+func RepositoryAlias(repository string) (string, bool) {
+	for _, prefix := range []string{"@", "alias:"} {
+		if strings.HasPrefix(repository, prefix) {
+			return strings.TrimPrefix(repository, prefix), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import "testing"
+
+func TestRepositoryAlias(t *testing.T) {
+	tests := []struct {
+		repository string
+		wantName   string
+		wantOK     bool
+	}{
+		{repository: "@bitnami", wantName: "bitnami", wantOK: true},
+		{repository: "alias:bitnami", wantName: "bitnami", wantOK: true},
+		{repository: "https://charts.bitnami.com/bitnami"},
+		{repository: "file://../common"},
+		{repository: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.repository, func(t *testing.T) {
+			name, ok := RepositoryAlias(tt.repository)
+			if name != tt.wantName || ok != tt.wantOK {
+				t.Errorf("RepositoryAlias() = (%q, %v), want (%q, %v)", name, ok, tt.wantName, tt.wantOK)
+			}
+		})
+	}
+}
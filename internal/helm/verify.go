@@ -0,0 +1,82 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// IndexSignatureFile is the name of the file holding the detached OpenPGP
+// signature of the chart repository index.
+const IndexSignatureFile = "index.yaml.sig"
+
+// ErrIndexVerification is returned by ChartRepository.DownloadIndex when the
+// downloaded index fails the verification of the IndexVerifier.
+var ErrIndexVerification = errors.New("index verification failed")
+
+// IndexVerifier verifies the integrity of a chart repository index.
+type IndexVerifier interface {
+	// Verify returns an error if the given index data fails validation. The
+	// get function downloads the file with the given name from the chart
+	// repository, for verifiers relying on additional metadata.
+	Verify(index []byte, get func(name string) ([]byte, error)) error
+}
+
+// SignatureVerifier is an IndexVerifier checking the detached OpenPGP
+// signature of the index, served as IndexSignatureFile next to the index.
+type SignatureVerifier struct {
+	KeyRing openpgp.EntityList
+}
+
+// NewSignatureVerifier returns a SignatureVerifier trusting the keys of the
+// given armored key rings.
+func NewSignatureVerifier(keyRings ...[]byte) (*SignatureVerifier, error) {
+	var keyRing openpgp.EntityList
+	for _, b := range keyRings {
+		entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PGP key ring: %w", err)
+		}
+		keyRing = append(keyRing, entities...)
+	}
+	if len(keyRing) == 0 {
+		return nil, fmt.Errorf("no PGP public keys found")
+	}
+	return &SignatureVerifier{KeyRing: keyRing}, nil
+}
+
+// Verify downloads the IndexSignatureFile, and checks if it is a valid
+// armored or binary signature of the index by one of the keys of the KeyRing.
+func (v *SignatureVerifier) Verify(index []byte, get func(name string) ([]byte, error)) error {
+	sig, err := get(IndexSignatureFile)
+	if err != nil {
+		return fmt.Errorf("failed to download index signature: %w", err)
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(sig), []byte("-----BEGIN")) {
+		_, err = openpgp.CheckArmoredDetachedSignature(v.KeyRing, bytes.NewReader(index), bytes.NewReader(sig))
+	} else {
+		_, err = openpgp.CheckDetachedSignature(v.KeyRing, bytes.NewReader(index), bytes.NewReader(sig))
+	}
+	if err != nil {
+		return fmt.Errorf("PGP signature of index can't be verified: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"helm.sh/helm/v3/pkg/getter"
+)
+
+// filesGetter serves the files mapped to the suffix of the requested URL.
+type filesGetter map[string][]byte
+
+func (g filesGetter) Get(url string, _ ...getter.Option) (*bytes.Buffer, error) {
+	for name, b := range g {
+		if strings.HasSuffix(url, "/"+name) {
+			return bytes.NewBuffer(b), nil
+		}
+	}
+	return nil, fmt.Errorf("%s not found", url)
+}
+
+func newTestEntity(t *testing.T) (*openpgp.Entity, []byte) {
+	t.Helper()
+	entity, err := openpgp.NewEntity("flux", "", "flux@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return entity, buf.Bytes()
+}
+
+func TestChartRepository_DownloadIndex_Verify(t *testing.T) {
+	index, err := os.ReadFile(chartmuseumtestfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, publicKey := newTestEntity(t)
+	_, otherKey := newTestEntity(t)
+
+	var armored, binary bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&armored, signer, bytes.NewReader(index), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := openpgp.DetachSign(&binary, signer, bytes.NewReader(index), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		files   filesGetter
+		keyRing []byte
+		wantErr bool
+	}{
+		{
+			name:    "armored signature",
+			files:   filesGetter{"index.yaml": index, IndexSignatureFile: armored.Bytes()},
+			keyRing: publicKey,
+		},
+		{
+			name:    "binary signature",
+			files:   filesGetter{"index.yaml": index, IndexSignatureFile: binary.Bytes()},
+			keyRing: publicKey,
+		},
+		{
+			name:    "untrusted key",
+			files:   filesGetter{"index.yaml": index, IndexSignatureFile: armored.Bytes()},
+			keyRing: otherKey,
+			wantErr: true,
+		},
+		{
+			name:    "tampered index",
+			files:   filesGetter{"index.yaml": append(index, []byte("\n# tampered")...), IndexSignatureFile: armored.Bytes()},
+			keyRing: publicKey,
+			wantErr: true,
+		},
+		{
+			name:    "missing signature",
+			files:   filesGetter{"index.yaml": index},
+			keyRing: publicKey,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := NewSignatureVerifier(tt.keyRing)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := &ChartRepository{
+				URL:      "https://example.com",
+				Client:   tt.files,
+				Verifier: verifier,
+			}
+			err = r.DownloadIndex()
+			if tt.wantErr {
+				if !errors.Is(err, ErrIndexVerification) {
+					t.Fatalf("DownloadIndex() error = %v, want %v", err, ErrIndexVerification)
+				}
+				if r.Index != nil {
+					t.Error("DownloadIndex() loaded an unverified index")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DownloadIndex() error = %v", err)
+			}
+			verifyLocalIndex(t, r.Index)
+		})
+	}
+}
+
+func TestNewSignatureVerifier(t *testing.T) {
+	if _, err := NewSignatureVerifier(); err == nil {
+		t.Error("NewSignatureVerifier() did not return an error without keys")
+	}
+	if _, err := NewSignatureVerifier([]byte("invalid")); err == nil {
+		t.Error("NewSignatureVerifier() did not return an error for invalid key ring")
+	}
+}
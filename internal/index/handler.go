@@ -0,0 +1,181 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+// Path is the HTTP path the index is served on.
+const Path = "/api/v1/artifacts"
+
+// resources maps the source kinds to their API resource names.
+var resources = map[string]string{
+	sourcev1.BucketKind:         "buckets",
+	sourcev1.GitRepositoryKind:  "gitrepositories",
+	sourcev1.HelmChartKind:      "helmcharts",
+	sourcev1.HelmRepositoryKind: "helmrepositories",
+}
+
+// Authorizer authenticates the bearer token of a request, and authorizes the
+// user it belongs to to read the sources of a kind in a namespace.
+type Authorizer interface {
+	// Authenticate returns the user the token belongs to, or an error if
+	// the token is not valid.
+	Authenticate(ctx context.Context, token string) (*authenticationv1.UserInfo, error)
+	// Authorize returns true if the user is allowed to get the sources of the
+	// given kind in the given namespace.
+	Authorize(ctx context.Context, user *authenticationv1.UserInfo, kind, namespace string) (bool, error)
+}
+
+// +kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// ReviewAuthorizer is an Authorizer that delegates to the Kubernetes API
+// server using TokenReviews and SubjectAccessReviews, so the index honours
+// the namespace-level RBAC of the sources.
+type ReviewAuthorizer struct {
+	Client client.Client
+}
+
+// Authenticate creates a TokenReview for the given token.
+func (a *ReviewAuthorizer) Authenticate(ctx context.Context, token string) (*authenticationv1.UserInfo, error) {
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}
+	if err := a.Client.Create(ctx, review); err != nil {
+		return nil, fmt.Errorf("token review failed: %w", err)
+	}
+	if !review.Status.Authenticated {
+		if review.Status.Error != "" {
+			return nil, fmt.Errorf("token is not authenticated: %s", review.Status.Error)
+		}
+		return nil, fmt.Errorf("token is not authenticated")
+	}
+	return &review.Status.User, nil
+}
+
+// Authorize creates a SubjectAccessReview for getting the sources of the given
+// kind in the given namespace.
+func (a *ReviewAuthorizer) Authorize(ctx context.Context, user *authenticationv1.UserInfo, kind, namespace string) (bool, error) {
+	resource, ok := resources[kind]
+	if !ok {
+		return false, nil
+	}
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      "get",
+				Group:     sourcev1.GroupVersion.Group,
+				Resource:  resource,
+			},
+			User:   user.Username,
+			Groups: user.Groups,
+			UID:    user.UID,
+			Extra:  extra,
+		},
+	}
+	if err := a.Client.Create(ctx, review); err != nil {
+		return false, fmt.Errorf("subject access review failed: %w", err)
+	}
+	return review.Status.Allowed, nil
+}
+
+// List is the response body of the index API.
+type List struct {
+	Artifacts []Entry `json:"artifacts"`
+}
+
+type handler struct {
+	index      *Index
+	authorizer Authorizer
+	log        logr.Logger
+}
+
+// NewHandler returns a read-only HTTP handler serving the entries of the
+// given Index as JSON. Requests must carry a bearer token, and only the
+// entries of the sources the token owner is allowed to get are listed.
+// The results can be filtered with the 'kind' and 'namespace' query
+// parameters.
+func NewHandler(index *Index, authorizer Authorizer, log logr.Logger) http.Handler {
+	return &handler{index: index, authorizer: authorizer, log: log}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || token == r.Header.Get("Authorization") {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	user, err := h.authorizer.Authenticate(r.Context(), token)
+	if err != nil {
+		h.log.Error(err, "artifact index authentication failed")
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	kind := r.URL.Query().Get("kind")
+	namespace := r.URL.Query().Get("namespace")
+
+	list := List{Artifacts: []Entry{}}
+	allowed := make(map[string]bool)
+	for _, e := range h.index.List() {
+		if (kind != "" && !strings.EqualFold(e.Kind, kind)) || (namespace != "" && e.Namespace != namespace) {
+			continue
+		}
+		key := e.Kind + "/" + e.Namespace
+		ok, seen := allowed[key]
+		if !seen {
+			if ok, err = h.authorizer.Authorize(r.Context(), user, e.Kind, e.Namespace); err != nil {
+				h.log.Error(err, "artifact index authorization failed")
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			allowed[key] = ok
+		}
+		if ok {
+			list.Artifacts = append(list.Artifacts, e)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		h.log.Error(err, "failed to write artifact index response")
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+// fakeAuthorizer allows the user of the 'valid' token to get the sources in
+// the 'default' namespace.
+type fakeAuthorizer struct{}
+
+func (fakeAuthorizer) Authenticate(_ context.Context, token string) (*authenticationv1.UserInfo, error) {
+	if token != "valid" {
+		return nil, fmt.Errorf("token is not authenticated")
+	}
+	return &authenticationv1.UserInfo{Username: "dashboard"}, nil
+}
+
+func (fakeAuthorizer) Authorize(_ context.Context, user *authenticationv1.UserInfo, _, namespace string) (bool, error) {
+	return user.Username == "dashboard" && namespace == "default", nil
+}
+
+func TestHandler(t *testing.T) {
+	idx := New(0)
+	idx.Set(entry("GitRepository", "default", "podinfo", 0))
+	idx.Set(entry("HelmChart", "default", "podinfo", 0))
+	idx.Set(entry("GitRepository", "private", "secret", 0))
+	h := NewHandler(idx, fakeAuthorizer{}, logr.Discard())
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		token      string
+		wantStatus int
+		wantNames  []string
+	}{
+		{
+			name:       "no token",
+			target:     Path,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "invalid token",
+			target:     Path,
+			token:      "invalid",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "method not allowed",
+			method:     http.MethodPost,
+			target:     Path,
+			token:      "valid",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "lists authorized namespaces",
+			target:     Path,
+			token:      "valid",
+			wantStatus: http.StatusOK,
+			wantNames:  []string{"GitRepository/default/podinfo", "HelmChart/default/podinfo"},
+		},
+		{
+			name:       "filters on kind",
+			target:     Path + "?kind=helmchart",
+			token:      "valid",
+			wantStatus: http.StatusOK,
+			wantNames:  []string{"HelmChart/default/podinfo"},
+		},
+		{
+			name:       "filters on unauthorized namespace",
+			target:     Path + "?namespace=private",
+			token:      "valid",
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tt.target, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var list List
+			if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range list.Artifacts {
+				got = append(got, e.key())
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.wantNames) {
+				t.Errorf("artifacts = %v, want %v", got, tt.wantNames)
+			}
+		})
+	}
+}
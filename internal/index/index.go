@@ -0,0 +1,129 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package index
+
+import (
+	"sort"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultMaxEntries is the default maximum number of entries in an Index.
+const DefaultMaxEntries = 10000
+
+// Entry describes the latest artifact of a source.
+type Entry struct {
+	// Kind is the kind of the source.
+	Kind string `json:"kind"`
+	// Namespace is the namespace of the source.
+	Namespace string `json:"namespace"`
+	// Name is the name of the source.
+	Name string `json:"name"`
+	// Revision is the revision of the artifact.
+	Revision string `json:"revision"`
+	// URL is the HTTP address of the artifact.
+	URL string `json:"url"`
+	// Checksum is the SHA1 checksum of the artifact.
+	Checksum string `json:"checksum"`
+	// Size is the size of the artifact in bytes.
+	Size int64 `json:"size"`
+	// LastUpdateTime is the timestamp of the last update of the artifact.
+	LastUpdateTime metav1.Time `json:"lastUpdateTime"`
+}
+
+func (e Entry) key() string {
+	return e.Kind + "/" + e.Namespace + "/" + e.Name
+}
+
+// Index is a bounded in-memory index of the latest artifact of every source
+// reconciled by the controller. It is safe for concurrent use.
+type Index struct {
+	maxEntries int
+
+	mu      sync.RWMutex
+	entries map[string]Entry
+}
+
+// New returns a new Index holding at most maxEntries entries. When the Index
+// is full, the entry with the oldest artifact is evicted to make room for a
+// new one. If maxEntries is lower than one, DefaultMaxEntries is used.
+func New(maxEntries int) *Index {
+	if maxEntries < 1 {
+		maxEntries = DefaultMaxEntries
+	}
+	return &Index{
+		maxEntries: maxEntries,
+		entries:    make(map[string]Entry),
+	}
+}
+
+// Set adds or replaces the entry for the source of the given Entry.
+func (i *Index) Set(e Entry) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	key := e.key()
+	if _, ok := i.entries[key]; !ok && len(i.entries) >= i.maxEntries {
+		i.evictOldest()
+	}
+	i.entries[key] = e
+}
+
+// Delete removes the entry for the given source, if any.
+func (i *Index) Delete(kind, namespace, name string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	delete(i.entries, Entry{Kind: kind, Namespace: namespace, Name: name}.key())
+}
+
+// List returns all entries sorted by kind, namespace and name.
+func (i *Index) List() []Entry {
+	i.mu.RLock()
+	entries := make([]Entry, 0, len(i.entries))
+	for _, e := range i.entries {
+		entries = append(entries, e)
+	}
+	i.mu.RUnlock()
+
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].key() < entries[b].key()
+	})
+	return entries
+}
+
+// Len returns the number of entries in the Index.
+func (i *Index) Len() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return len(i.entries)
+}
+
+// evictOldest removes the entry with the oldest LastUpdateTime.
+// It must be called with the lock held.
+func (i *Index) evictOldest() {
+	var oldest string
+	var oldestTime metav1.Time
+	for key, e := range i.entries {
+		if oldest == "" || e.LastUpdateTime.Before(&oldestTime) {
+			oldest = key
+			oldestTime = e.LastUpdateTime
+		}
+	}
+	delete(i.entries, oldest)
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package index
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func entry(kind, namespace, name string, age time.Duration) Entry {
+	return Entry{
+		Kind:           kind,
+		Namespace:      namespace,
+		Name:           name,
+		LastUpdateTime: metav1.NewTime(time.Now().Add(-age)),
+	}
+}
+
+func TestIndex_Set(t *testing.T) {
+	idx := New(2)
+	idx.Set(entry("GitRepository", "default", "old", time.Hour))
+	idx.Set(entry("GitRepository", "default", "new", time.Minute))
+
+	// replacing an existing entry does not evict
+	replaced := entry("GitRepository", "default", "old", time.Hour)
+	replaced.Revision = "main/1234"
+	idx.Set(replaced)
+	if got := idx.Len(); got != 2 {
+		t.Fatalf("Len() = %d, want 2", got)
+	}
+	if got := idx.List()[1].Revision; got != "main/1234" {
+		t.Errorf("Set() did not replace entry, revision = %q", got)
+	}
+
+	// adding to a full index evicts the oldest entry
+	idx.Set(entry("Bucket", "default", "newest", 0))
+	if got := idx.Len(); got != 2 {
+		t.Fatalf("Len() = %d, want 2", got)
+	}
+	for _, e := range idx.List() {
+		if e.Name == "old" {
+			t.Errorf("Set() did not evict the oldest entry")
+		}
+	}
+}
+
+func TestIndex_Delete(t *testing.T) {
+	idx := New(0)
+	idx.Set(entry("HelmChart", "default", "podinfo", 0))
+	idx.Set(entry("HelmRepository", "default", "podinfo", 0))
+
+	idx.Delete("HelmChart", "default", "podinfo")
+	entries := idx.List()
+	if len(entries) != 1 || entries[0].Kind != "HelmRepository" {
+		t.Errorf("Delete() left entries %v", entries)
+	}
+}
+
+func TestIndex_List(t *testing.T) {
+	idx := New(0)
+	idx.Set(entry("HelmChart", "flux-system", "b", 0))
+	idx.Set(entry("Bucket", "default", "a", 0))
+	idx.Set(entry("HelmChart", "default", "c", 0))
+
+	var got []string
+	for _, e := range idx.List() {
+		got = append(got, e.key())
+	}
+	want := []string{"Bucket/default/a", "HelmChart/default/c", "HelmChart/flux-system/b"}
+	for i := range want {
+		if i >= len(got) || got[i] != want[i] {
+			t.Fatalf("List() = %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Package metrics provides the Prometheus metrics of the source-controller
+// operations, complementing the reconciliation metrics of the GitOps Toolkit
+// runtime and the workqueue metrics of controller-runtime.
+package metrics
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// SuccessStatus is the status label value of a successful operation.
+	SuccessStatus = "success"
+	// FailureStatus is the status label value of a failed operation.
+	FailureStatus = "failure"
+	// CorruptedStatus is the status label value of an artifact verification
+	// which found the artifact to be corrupted.
+	CorruptedStatus = "corrupted"
+
+	// AddedChange is the change label value of the added objects.
+	AddedChange = "added"
+	// RemovedChange is the change label value of the removed objects.
+	RemovedChange = "removed"
+	// ModifiedChange is the change label value of the modified objects.
+	ModifiedChange = "modified"
+
+	// HitResult is the result label value of a cache hit.
+	HitResult = "hit"
+	// MissResult is the result label value of a cache miss.
+	MissResult = "miss"
+)
+
+// Recorder records the metrics of the source-controller operations. A nil
+// Recorder records nothing.
+type Recorder struct {
+	fetchGauge           *prometheus.GaugeVec
+	fetchFailureCounter  *prometheus.CounterVec
+	objectChangesCounter *prometheus.CounterVec
+	gcCounter            *prometheus.CounterVec
+	verifyCounter        *prometheus.CounterVec
+	evictionCounter      *prometheus.CounterVec
+	evictedBytesCounter  *prometheus.CounterVec
+	chartBuildCounter    *prometheus.CounterVec
+	downloadCounter      *prometheus.CounterVec
+	downloadBytesCounter *prometheus.CounterVec
+	revisionCounter      *prometheus.CounterVec
+	revisionGauge        *prometheus.GaugeVec
+	storage              *storageCollector
+
+	// revisions holds the revision hash label value of the revisionGauge
+	// series of each source, by kind, namespace and name.
+	revisions   map[[3]string]string
+	revisionsMu sync.Mutex
+}
+
+// NewRecorder returns a Recorder reporting the usage of the filesystem at the
+// given storage path.
+func NewRecorder(storagePath string) *Recorder {
+	return &Recorder{
+		fetchGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gotk_source_fetch_in_flight",
+				Help: "The number of source fetch operations in progress.",
+			},
+			[]string{"kind"},
+		),
+		fetchFailureCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gotk_source_fetch_failures_total",
+				Help: "The total number of failed source fetch operations, by failure reason.",
+			},
+			[]string{"kind", "reason"},
+		),
+		objectChangesCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gotk_bucket_object_changes_total",
+				Help: "The total number of objects added, removed or modified between the artifacts of a Bucket.",
+			},
+			[]string{"namespace", "name", "change"},
+		),
+		gcCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gotk_artifact_gc_total",
+				Help: "The total number of artifact garbage collections.",
+			},
+			[]string{"kind", "status"},
+		),
+		verifyCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gotk_artifact_verification_total",
+				Help: "The total number of artifact integrity verifications.",
+			},
+			[]string{"kind", "status"},
+		),
+		evictionCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gotk_artifact_evictions_total",
+				Help: "The total number of artifacts evicted to keep the storage under its maximum size.",
+			},
+			[]string{"kind"},
+		),
+		evictedBytesCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gotk_artifact_evicted_bytes_total",
+				Help: "The total number of bytes freed by the eviction of artifacts.",
+			},
+			[]string{"kind"},
+		),
+		chartBuildCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gotk_helmchart_build_cache_total",
+				Help: "The total number of HelmChart builds from a GitRepository or Bucket, by build cache result.",
+			},
+			[]string{"result"},
+		),
+		downloadCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gotk_artifact_downloads_total",
+				Help: "The total number of artifact downloads from the file server, by source and result.",
+			},
+			[]string{"kind", "namespace", "name", "status"},
+		),
+		downloadBytesCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gotk_artifact_download_bytes_total",
+				Help: "The total number of bytes of the artifacts served by the file server, by source.",
+			},
+			[]string{"kind", "namespace", "name"},
+		),
+		revisionCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gotk_artifact_revision_changes_total",
+				Help: "The total number of new artifact revisions, by source.",
+			},
+			[]string{"kind", "namespace", "name"},
+		),
+		revisionGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gotk_artifact_revision_timestamp_seconds",
+				Help: "The time of the last update of the artifact of a source, with the hash of its revision.",
+			},
+			[]string{"kind", "namespace", "name", "revision_hash"},
+		),
+		storage:   newStorageCollector(storagePath),
+		revisions: make(map[[3]string]string),
+	}
+}
+
+// Collectors returns the collectors to register.
+func (r *Recorder) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{r.fetchGauge, r.fetchFailureCounter, r.objectChangesCounter, r.gcCounter, r.verifyCounter,
+		r.evictionCounter, r.evictedBytesCounter, r.chartBuildCounter, r.downloadCounter, r.downloadBytesCounter,
+		r.revisionCounter, r.revisionGauge, r.storage}
+}
+
+// RecordFetch records the start of a fetch operation for a source of the
+// given kind, and returns the function to call once it is done. The returned
+// function may be called more than once, so it can both be deferred and
+// called as soon as the fetch completes.
+func (r *Recorder) RecordFetch(kind string) func() {
+	if r == nil {
+		return func() {}
+	}
+	g := r.fetchGauge.WithLabelValues(kind)
+	g.Inc()
+	var once sync.Once
+	return func() {
+		once.Do(g.Dec)
+	}
+}
+
+// RecordFetchFailure records a failed fetch operation for a source of the
+// given kind, with the given reason classifying the failure.
+func (r *Recorder) RecordFetchFailure(kind, reason string) {
+	if r == nil {
+		return
+	}
+	r.fetchFailureCounter.WithLabelValues(kind, reason).Inc()
+}
+
+// RecordObjectChanges records the number of objects added, removed and
+// modified between two artifacts of the Bucket with the given namespace and
+// name.
+func (r *Recorder) RecordObjectChanges(namespace, name string, added, removed, modified int) {
+	if r == nil {
+		return
+	}
+	r.objectChangesCounter.WithLabelValues(namespace, name, AddedChange).Add(float64(added))
+	r.objectChangesCounter.WithLabelValues(namespace, name, RemovedChange).Add(float64(removed))
+	r.objectChangesCounter.WithLabelValues(namespace, name, ModifiedChange).Add(float64(modified))
+}
+
+// RecordGC records a garbage collection of the artifacts of a source of the
+// given kind, which failed if the given error is not nil.
+func (r *Recorder) RecordGC(kind string, err error) {
+	if r == nil {
+		return
+	}
+	status := SuccessStatus
+	if err != nil {
+		status = FailureStatus
+	}
+	r.gcCounter.WithLabelValues(kind, status).Inc()
+}
+
+// RecordVerification records an integrity verification of the artifact of a
+// source of the given kind, which found the artifact to be corrupted, or
+// failed if the given error is not nil.
+func (r *Recorder) RecordVerification(kind string, corrupted bool, err error) {
+	if r == nil {
+		return
+	}
+	status := SuccessStatus
+	switch {
+	case err != nil:
+		status = FailureStatus
+	case corrupted:
+		status = CorruptedStatus
+	}
+	r.verifyCounter.WithLabelValues(kind, status).Inc()
+}
+
+// RecordEviction records the eviction of an artifact of a source of the given
+// kind, which freed the given number of bytes.
+func (r *Recorder) RecordEviction(kind string, freed int64) {
+	if r == nil {
+		return
+	}
+	r.evictionCounter.WithLabelValues(kind).Inc()
+	r.evictedBytesCounter.WithLabelValues(kind).Add(float64(freed))
+}
+
+// RecordChartBuildCache records a build of a HelmChart from a GitRepository
+// or Bucket, which was skipped if the given hit is true.
+func (r *Recorder) RecordChartBuildCache(hit bool) {
+	if r == nil {
+		return
+	}
+	result := MissResult
+	if hit {
+		result = HitResult
+	}
+	r.chartBuildCounter.WithLabelValues(result).Inc()
+}
+
+// RecordDownload records a download of an artifact of the source with the
+// given kind, namespace and name from the file server, which failed if the
+// given failed is true, and the given number of bytes served.
+func (r *Recorder) RecordDownload(kind, namespace, name string, failed bool, bytes int64) {
+	if r == nil {
+		return
+	}
+	status := SuccessStatus
+	if failed {
+		status = FailureStatus
+	}
+	r.downloadCounter.WithLabelValues(kind, namespace, name, status).Inc()
+	r.downloadBytesCounter.WithLabelValues(kind, namespace, name).Add(float64(bytes))
+}
+
+// RecordArtifactRevision records the given revision of the artifact of the
+// source with the given kind, namespace and name, last updated at the given
+// time, and counts a revision change if the given changed is true. The
+// revision is recorded as its RevisionHash, the series of the previous
+// revision of the source being removed.
+func (r *Recorder) RecordArtifactRevision(kind, namespace, name, revision string, updated time.Time, changed bool) {
+	if r == nil {
+		return
+	}
+	if changed {
+		r.revisionCounter.WithLabelValues(kind, namespace, name).Inc()
+	}
+	hash := RevisionHash(revision)
+	key := [3]string{kind, namespace, name}
+	r.revisionsMu.Lock()
+	defer r.revisionsMu.Unlock()
+	if previous, ok := r.revisions[key]; ok && previous != hash {
+		r.revisionGauge.DeleteLabelValues(kind, namespace, name, previous)
+	}
+	r.revisions[key] = hash
+	r.revisionGauge.WithLabelValues(kind, namespace, name, hash).Set(float64(updated.Unix()))
+}
+
+// DeleteArtifactRevision removes the revision metrics of the deleted source
+// with the given kind, namespace and name.
+func (r *Recorder) DeleteArtifactRevision(kind, namespace, name string) {
+	if r == nil {
+		return
+	}
+	r.revisionCounter.DeleteLabelValues(kind, namespace, name)
+	key := [3]string{kind, namespace, name}
+	r.revisionsMu.Lock()
+	defer r.revisionsMu.Unlock()
+	if previous, ok := r.revisions[key]; ok {
+		r.revisionGauge.DeleteLabelValues(kind, namespace, name, previous)
+		delete(r.revisions, key)
+	}
+}
+
+// RevisionHash returns the revision_hash label value of the given revision,
+// the first 16 hexadecimal characters of its SHA-256 checksum, which bounds
+// the length of the label whatever the revision format.
+func RevisionHash(revision string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(revision)))[:16]
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package metrics
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecorder_RecordFetch(t *testing.T) {
+	r := NewRecorder(os.TempDir())
+
+	done := r.RecordFetch("GitRepository")
+	r.RecordFetch("Bucket")
+	if got := testutil.ToFloat64(r.fetchGauge.WithLabelValues("GitRepository")); got != 1 {
+		t.Errorf("in flight fetches = %v, want 1", got)
+	}
+	done()
+	done()
+	if got := testutil.ToFloat64(r.fetchGauge.WithLabelValues("GitRepository")); got != 0 {
+		t.Errorf("in flight fetches after done = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(r.fetchGauge.WithLabelValues("Bucket")); got != 1 {
+		t.Errorf("in flight fetches of other kind = %v, want 1", got)
+	}
+}
+
+func TestRecorder_RecordFetchFailure(t *testing.T) {
+	r := NewRecorder(os.TempDir())
+
+	r.RecordFetchFailure("Bucket", "Unauthorized")
+	r.RecordFetchFailure("Bucket", "Unauthorized")
+	r.RecordFetchFailure("Bucket", "Timeout")
+	for reason, want := range map[string]float64{"Unauthorized": 2, "Timeout": 1} {
+		if got := testutil.ToFloat64(r.fetchFailureCounter.WithLabelValues("Bucket", reason)); got != want {
+			t.Errorf("%s fetch failures = %v, want %v", reason, got, want)
+		}
+	}
+}
+
+func TestRecorder_RecordObjectChanges(t *testing.T) {
+	r := NewRecorder(os.TempDir())
+
+	r.RecordObjectChanges("default", "podinfo", 2, 0, 1)
+	r.RecordObjectChanges("default", "podinfo", 1, 1, 0)
+	for change, want := range map[string]float64{AddedChange: 3, RemovedChange: 1, ModifiedChange: 1} {
+		if got := testutil.ToFloat64(r.objectChangesCounter.WithLabelValues("default", "podinfo", change)); got != want {
+			t.Errorf("%s objects = %v, want %v", change, got, want)
+		}
+	}
+}
+
+func TestRecorder_RecordGC(t *testing.T) {
+	r := NewRecorder(os.TempDir())
+
+	r.RecordGC("HelmChart", nil)
+	r.RecordGC("HelmChart", nil)
+	r.RecordGC("HelmChart", errors.New("permission denied"))
+	if got := testutil.ToFloat64(r.gcCounter.WithLabelValues("HelmChart", SuccessStatus)); got != 2 {
+		t.Errorf("successful gc = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(r.gcCounter.WithLabelValues("HelmChart", FailureStatus)); got != 1 {
+		t.Errorf("failed gc = %v, want 1", got)
+	}
+}
+
+func TestRecorder_RecordVerification(t *testing.T) {
+	r := NewRecorder(os.TempDir())
+
+	r.RecordVerification("GitRepository", false, nil)
+	r.RecordVerification("GitRepository", true, nil)
+	r.RecordVerification("GitRepository", true, errors.New("permission denied"))
+	for status, want := range map[string]float64{SuccessStatus: 1, CorruptedStatus: 1, FailureStatus: 1} {
+		if got := testutil.ToFloat64(r.verifyCounter.WithLabelValues("GitRepository", status)); got != want {
+			t.Errorf("%s verifications = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestRecorder_RecordEviction(t *testing.T) {
+	r := NewRecorder(os.TempDir())
+
+	r.RecordEviction("HelmChart", 1024)
+	r.RecordEviction("HelmChart", 512)
+	if got := testutil.ToFloat64(r.evictionCounter.WithLabelValues("HelmChart")); got != 2 {
+		t.Errorf("evictions = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(r.evictedBytesCounter.WithLabelValues("HelmChart")); got != 1536 {
+		t.Errorf("evicted bytes = %v, want 1536", got)
+	}
+}
+
+func TestRecorder_RecordChartBuildCache(t *testing.T) {
+	r := NewRecorder(os.TempDir())
+
+	r.RecordChartBuildCache(true)
+	r.RecordChartBuildCache(true)
+	r.RecordChartBuildCache(false)
+	for result, want := range map[string]float64{HitResult: 2, MissResult: 1} {
+		if got := testutil.ToFloat64(r.chartBuildCounter.WithLabelValues(result)); got != want {
+			t.Errorf("%s chart builds = %v, want %v", result, got, want)
+		}
+	}
+}
+
+func TestRecorder_RecordDownload(t *testing.T) {
+	r := NewRecorder(os.TempDir())
+
+	r.RecordDownload("GitRepository", "default", "podinfo", false, 100)
+	r.RecordDownload("GitRepository", "default", "podinfo", false, 50)
+	r.RecordDownload("GitRepository", "default", "podinfo", true, 0)
+	for status, want := range map[string]float64{SuccessStatus: 2, FailureStatus: 1} {
+		if got := testutil.ToFloat64(r.downloadCounter.WithLabelValues("GitRepository", "default", "podinfo", status)); got != want {
+			t.Errorf("%s downloads = %v, want %v", status, got, want)
+		}
+	}
+	if got := testutil.ToFloat64(r.downloadBytesCounter.WithLabelValues("GitRepository", "default", "podinfo")); got != 150 {
+		t.Errorf("downloaded bytes = %v, want 150", got)
+	}
+}
+
+func TestRecorder_Nil(t *testing.T) {
+	var r *Recorder
+	r.RecordFetch("GitRepository")()
+	r.RecordFetchFailure("GitRepository", "Timeout")
+	r.RecordObjectChanges("default", "podinfo", 1, 0, 0)
+	r.RecordGC("GitRepository", nil)
+	r.RecordVerification("GitRepository", true, nil)
+	r.RecordEviction("GitRepository", 1024)
+	r.RecordChartBuildCache(true)
+	r.RecordDownload("GitRepository", "default", "podinfo", false, 1024)
+}
+
+func TestStorageCollector(t *testing.T) {
+	dir, err := os.MkdirTemp("", "storage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "gitrepository"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, size := range map[string]int{"a.tar.gz": 10, "gitrepository/b.tar.gz": 32} {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := newStorageCollector(dir)
+	if got := testutil.CollectAndCount(c, "gotk_storage_used_bytes"); got != 1 {
+		t.Fatalf("used bytes metrics = %d, want 1", got)
+	}
+	used, err := dirSize(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used != 42 {
+		t.Errorf("dirSize() = %d, want 42", used)
+	}
+	if got := testutil.CollectAndCount(c, "gotk_storage_free_bytes", "gotk_storage_size_bytes"); got != 2 {
+		t.Errorf("filesystem metrics = %d, want 2", got)
+	}
+}
+
+func TestRecorder_RecordArtifactRevision(t *testing.T) {
+	r := NewRecorder(os.TempDir())
+	first, second := time.Unix(1634206314, 0), time.Unix(1634209914, 0)
+
+	r.RecordArtifactRevision("GitRepository", "default", "podinfo", "main/363a6a8", first, true)
+	r.RecordArtifactRevision("GitRepository", "default", "podinfo", "main/363a6a8", first, false)
+	r.RecordArtifactRevision("GitRepository", "default", "podinfo", "main/6f5b3d2", second, true)
+	if got := testutil.ToFloat64(r.revisionCounter.WithLabelValues("GitRepository", "default", "podinfo")); got != 2 {
+		t.Errorf("revision changes = %v, want 2", got)
+	}
+	if got := testutil.CollectAndCount(r.revisionGauge); got != 1 {
+		t.Errorf("revision series = %v, want 1", got)
+	}
+	hash := RevisionHash("main/6f5b3d2")
+	if got := testutil.ToFloat64(r.revisionGauge.WithLabelValues("GitRepository", "default", "podinfo", hash)); got != float64(second.Unix()) {
+		t.Errorf("revision timestamp = %v, want %v", got, second.Unix())
+	}
+
+	r.DeleteArtifactRevision("GitRepository", "default", "podinfo")
+	if got := testutil.CollectAndCount(r.revisionGauge) + testutil.CollectAndCount(r.revisionCounter); got != 0 {
+		t.Errorf("series after deletion = %v, want 0", got)
+	}
+}
+
+func TestRevisionHash(t *testing.T) {
+	if got := RevisionHash("main/363a6a8"); len(got) != 16 || got == RevisionHash("main/6f5b3d2") {
+		t.Errorf("RevisionHash() = %q", got)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// storageCollector reports the bytes used by the artifacts in the storage
+// path, and the bytes left on the filesystem holding it, at scrape time.
+type storageCollector struct {
+	path      string
+	usedDesc  *prometheus.Desc
+	freeDesc  *prometheus.Desc
+	totalDesc *prometheus.Desc
+}
+
+func newStorageCollector(path string) *storageCollector {
+	return &storageCollector{
+		path: path,
+		usedDesc: prometheus.NewDesc("gotk_storage_used_bytes",
+			"The number of bytes used by the files in the artifact storage.", nil, nil),
+		freeDesc: prometheus.NewDesc("gotk_storage_free_bytes",
+			"The number of bytes available on the filesystem of the artifact storage.", nil, nil),
+		totalDesc: prometheus.NewDesc("gotk_storage_size_bytes",
+			"The size in bytes of the filesystem of the artifact storage.", nil, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *storageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.usedDesc
+	ch <- c.freeDesc
+	ch <- c.totalDesc
+}
+
+// Collect implements prometheus.Collector. The metrics of the failed
+// measurements are omitted.
+func (c *storageCollector) Collect(ch chan<- prometheus.Metric) {
+	if used, err := dirSize(c.path); err == nil {
+		ch <- prometheus.MustNewConstMetric(c.usedDesc, prometheus.GaugeValue, float64(used))
+	}
+	if free, total, err := diskUsage(c.path); err == nil {
+		ch <- prometheus.MustNewConstMetric(c.freeDesc, prometheus.GaugeValue, float64(free))
+		ch <- prometheus.MustNewConstMetric(c.totalDesc, prometheus.GaugeValue, float64(total))
+	}
+}
+
+// dirSize returns the total size of the regular files in the given
+// directory.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			// files may be garbage collected while walking
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,383 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package oci pushes the artifacts to OCI registries as OCI artifacts, with
+// the OCI distribution API.
+package oci
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/fluxcd/source-controller/pkg/trust"
+)
+
+const (
+	// ManifestMediaType is the media type of the manifests of the pushed
+	// artifacts.
+	ManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	// ConfigMediaType is the media type of the empty config of the pushed
+	// artifacts.
+	ConfigMediaType = "application/vnd.cncf.flux.config.v1+json"
+	// ContentMediaType is the media type of the single layer of the pushed
+	// artifacts, the gzip compressed tarball of the artifact.
+	ContentMediaType = "application/vnd.cncf.flux.content.v1.tar+gzip"
+
+	// maxTagLength is the maximum length of a tag.
+	maxTagLength = 128
+)
+
+var (
+	// invalidTagChars matches the characters not allowed in a tag.
+	invalidTagChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+	// challengeParam matches a parameter of a WWW-Authenticate challenge.
+	challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+)
+
+// Descriptor describes a blob of a manifest.
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Manifest is an OCI image manifest.
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// Client pushes artifacts to an OCI registry.
+type Client struct {
+	// HTTPClient is the client the requests are sent with, defaults to a
+	// client with the trust.DefaultTransport.
+	HTTPClient *http.Client
+	// Insecure connects to the registry over plain HTTP.
+	Insecure bool
+	// Username and Password authenticate to the registry, or to its token
+	// service, anonymously when empty.
+	Username string
+	Password string
+
+	mu    sync.Mutex
+	token string
+}
+
+// Tag returns the given revision as a valid tag, the invalid characters
+// being replaced with dashes, e.g. 'main-6b7aab8' for 'main/6b7aab8'.
+func Tag(revision string) string {
+	tag := invalidTagChars.ReplaceAllString(revision, "-")
+	tag = strings.TrimLeft(tag, ".-")
+	if len(tag) > maxTagLength {
+		tag = tag[:maxTagLength]
+	}
+	if tag == "" {
+		return "latest"
+	}
+	return tag
+}
+
+// Push pushes the file at the given path as the single layer of an OCI
+// artifact with the given annotations, tagged with the given tag in the
+// given repository in the '<registry>/<name>' format. It returns the digest
+// of the pushed manifest.
+func (c *Client) Push(ctx context.Context, repository, tag, path string, annotations map[string]string) (string, error) {
+	host, name, err := splitRepository(repository)
+	if err != nil {
+		return "", err
+	}
+	base := &url.URL{Scheme: "https", Host: host}
+	if c.Insecure {
+		base.Scheme = "http"
+	}
+	scope := fmt.Sprintf("repository:%s:pull,push", name)
+
+	config := []byte("{}")
+	configDesc := Descriptor{MediaType: ConfigMediaType, Digest: digest(config), Size: int64(len(config))}
+	if err := c.pushBlob(ctx, base, name, scope, configDesc, func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(config)), nil
+	}); err != nil {
+		return "", fmt.Errorf("failed to push config: %w", err)
+	}
+
+	layerDesc, err := fileDescriptor(path)
+	if err != nil {
+		return "", err
+	}
+	if err := c.pushBlob(ctx, base, name, scope, layerDesc, func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}); err != nil {
+		return "", fmt.Errorf("failed to push layer: %w", err)
+	}
+
+	manifest, err := json.Marshal(Manifest{
+		SchemaVersion: 2,
+		MediaType:     ManifestMediaType,
+		Config:        configDesc,
+		Layers:        []Descriptor{layerDesc},
+		Annotations:   annotations,
+	})
+	if err != nil {
+		return "", err
+	}
+	u := base.ResolveReference(&url.URL{Path: fmt.Sprintf("/v2/%s/manifests/%s", name, tag)})
+	resp, err := c.do(ctx, scope, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(manifest))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", ManifestMediaType)
+		return req, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to push manifest: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("failed to push manifest: %w", responseError(resp))
+	}
+	return digest(manifest), nil
+}
+
+// pushBlob uploads the blob with the given descriptor and content to the
+// repository with the given name, unless it already exists.
+func (c *Client) pushBlob(ctx context.Context, base *url.URL, name, scope string, desc Descriptor, open func() (io.ReadCloser, error)) error {
+	blobURL := base.ResolveReference(&url.URL{Path: fmt.Sprintf("/v2/%s/blobs/%s", name, desc.Digest)})
+	resp, err := c.do(ctx, scope, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodHead, blobURL.String(), nil)
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	uploadsURL := base.ResolveReference(&url.URL{Path: fmt.Sprintf("/v2/%s/blobs/uploads/", name)})
+	resp, err = c.do(ctx, scope, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodPost, uploadsURL.String(), nil)
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return responseError(resp)
+	}
+	location, err := resp.Location()
+	if err != nil {
+		return fmt.Errorf("invalid upload location: %w", err)
+	}
+	q := location.Query()
+	q.Set("digest", desc.Digest)
+	location.RawQuery = q.Encode()
+
+	resp, err = c.do(ctx, scope, func() (*http.Request, error) {
+		body, err := open()
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, location.String(), body)
+		if err != nil {
+			body.Close()
+			return nil, err
+		}
+		req.ContentLength = desc.Size
+		req.Header.Set("Content-Type", "application/octet-stream")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return responseError(resp)
+	}
+	return nil
+}
+
+// do sends the request returned by the given function, authenticating it
+// with the cached token, and sends it again once authenticated if the
+// registry challenges it.
+func (c *Client) do(ctx context.Context, scope string, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+	c.authorize(req, c.cachedToken())
+	resp, err := c.httpClient().Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	token, err := c.authenticate(ctx, challenge, scope)
+	if err != nil {
+		return nil, err
+	}
+	if req, err = newRequest(); err != nil {
+		return nil, err
+	}
+	c.authorize(req, token)
+	return c.httpClient().Do(req)
+}
+
+// authenticate returns the bearer token issued by the token service of the
+// given challenge for the given scope, or an empty token for the basic
+// authentication challenges.
+func (c *Client) authenticate(ctx context.Context, challenge, scope string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		if c.Username == "" {
+			return "", fmt.Errorf("registry requires authentication")
+		}
+		return "", nil
+	}
+	params := map[string]string{}
+	for _, m := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(m[1])] = m[2]
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid authentication challenge '%s'", challenge)
+	}
+	q := realm.Query()
+	if service := params["service"]; service != "" {
+		q.Set("service", service)
+	}
+	q.Set("scope", scope)
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request failed: %w", responseError(resp))
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid token response: %w", err)
+	}
+	token := body.Token
+	if token == "" {
+		token = body.AccessToken
+	}
+	c.mu.Lock()
+	c.token = token
+	c.mu.Unlock()
+	return token, nil
+}
+
+// authorize sets the bearer token on the given request if not empty, and
+// the basic authentication credentials otherwise.
+func (c *Client) authorize(req *http.Request, token string) {
+	switch {
+	case token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	case c.Username != "":
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+}
+
+func (c *Client) cachedToken() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return defaultHTTPClient
+}
+
+// defaultHTTPClient is the client of the Clients without HTTPClient.
+var defaultHTTPClient = &http.Client{Transport: trust.DefaultTransport}
+
+// splitRepository returns the registry host and the repository name of the
+// given repository in the '<registry>/<name>' format.
+func splitRepository(repository string) (string, string, error) {
+	repository = strings.TrimPrefix(strings.TrimPrefix(repository, "oci://"), "https://")
+	i := strings.Index(repository, "/")
+	if i <= 0 || i == len(repository)-1 {
+		return "", "", fmt.Errorf("invalid OCI repository '%s': must be in the '<registry>/<name>' format", repository)
+	}
+	host, name := repository[:i], repository[i+1:]
+	if host == "docker.io" {
+		host = "registry-1.docker.io"
+	}
+	return host, name, nil
+}
+
+// fileDescriptor returns the layer descriptor of the file at the given path.
+func fileDescriptor(path string) (Descriptor, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	return Descriptor{
+		MediaType:   ContentMediaType,
+		Digest:      fmt.Sprintf("sha256:%x", h.Sum(nil)),
+		Size:        n,
+		Annotations: map[string]string{"org.opencontainers.image.title": filepath.Base(path)},
+	}, nil
+}
+
+func digest(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+// responseError returns an error with the status and the body of the given
+// response.
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// registry is an in-memory registry issuing bearer tokens.
+type registry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	// scopes holds the scopes of the issued tokens.
+	scopes []string
+}
+
+func (r *registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if req.URL.Path == "/token" {
+		if user, pass, ok := req.BasicAuth(); !ok || user != "flux" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		r.scopes = append(r.scopes, req.URL.Query().Get("scope"))
+		json.NewEncoder(w).Encode(map[string]string{"token": "t0ken"})
+		return
+	}
+	if req.Header.Get("Authorization") != "Bearer t0ken" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token",service="registry"`, req.Host))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	const prefix = "/v2/org/podinfo/"
+	p := strings.TrimPrefix(req.URL.Path, prefix)
+	switch {
+	case req.Method == http.MethodHead && strings.HasPrefix(p, "blobs/"):
+		if _, ok := r.blobs[strings.TrimPrefix(p, "blobs/")]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case req.Method == http.MethodPost && p == "blobs/uploads/":
+		w.Header().Set("Location", prefix+"blobs/uploads/1?state=abc")
+		w.WriteHeader(http.StatusAccepted)
+	case req.Method == http.MethodPut && p == "blobs/uploads/1":
+		if req.URL.Query().Get("state") != "abc" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(req.Body)
+		r.blobs[req.URL.Query().Get("digest")] = data
+		w.WriteHeader(http.StatusCreated)
+	case req.Method == http.MethodPut && strings.HasPrefix(p, "manifests/"):
+		data, _ := io.ReadAll(req.Body)
+		r.manifests[strings.TrimPrefix(p, "manifests/")] = data
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestClient_Push(t *testing.T) {
+	reg := &registry{blobs: map[string][]byte{}, manifests: map[string][]byte{}}
+	server := httptest.NewServer(reg)
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "6b7aab8.tar.gz")
+	if err := os.WriteFile(path, []byte("artifact"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Client{Insecure: true, Username: "flux", Password: "secret"}
+	repository := strings.TrimPrefix(server.URL, "http://") + "/org/podinfo"
+	got, err := c.Push(context.TODO(), repository, "main-6b7aab8", path, map[string]string{
+		"org.opencontainers.image.revision": "main/6b7aab8",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, ok := reg.manifests["main-6b7aab8"]
+	if !ok {
+		t.Fatalf("manifest not pushed: %v", reg.manifests)
+	}
+	if want := digest(data); got != want {
+		t.Errorf("Push() = %s, want %s", got, want)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Layers) != 1 || string(reg.blobs[manifest.Layers[0].Digest]) != "artifact" {
+		t.Errorf("layer of manifest %s not pushed", data)
+	}
+	if _, ok := reg.blobs[manifest.Config.Digest]; !ok {
+		t.Errorf("config of manifest %s not pushed", data)
+	}
+	if manifest.Annotations["org.opencontainers.image.revision"] != "main/6b7aab8" {
+		t.Errorf("annotations = %v, want the revision", manifest.Annotations)
+	}
+	if len(reg.scopes) != 1 || reg.scopes[0] != "repository:org/podinfo:pull,push" {
+		t.Errorf("token scopes = %v, want a single push token", reg.scopes)
+	}
+
+	// the blobs are not uploaded again
+	blobs := len(reg.blobs)
+	if _, err := c.Push(context.TODO(), repository, "main-6b7aab8", path, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(reg.blobs) != blobs {
+		t.Errorf("blobs = %d, want %d", len(reg.blobs), blobs)
+	}
+
+	c = &Client{Insecure: true, Username: "flux", Password: "wrong"}
+	if _, err := c.Push(context.TODO(), repository, "main-6b7aab8", path, nil); err == nil {
+		t.Error("Push() error = nil, want an authentication error")
+	}
+}
+
+func TestTag(t *testing.T) {
+	tests := []struct {
+		revision string
+		want     string
+	}{
+		{revision: "main/6b7aab8a10d6ee8b895b0a5048f4ab0966ed29ff", want: "main-6b7aab8a10d6ee8b895b0a5048f4ab0966ed29ff"},
+		{revision: "6.0.0+build.1", want: "6.0.0-build.1"},
+		{revision: "v1.2.3", want: "v1.2.3"},
+		{revision: ".hidden", want: "hidden"},
+		{revision: strings.Repeat("a", 200), want: strings.Repeat("a", 128)},
+		{revision: "", want: "latest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.revision, func(t *testing.T) {
+			if got := Tag(tt.revision); got != tt.want {
+				t.Errorf("Tag() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_splitRepository(t *testing.T) {
+	tests := []struct {
+		repository string
+		wantHost   string
+		wantName   string
+		wantErr    bool
+	}{
+		{repository: "ghcr.io/org/podinfo", wantHost: "ghcr.io", wantName: "org/podinfo"},
+		{repository: "oci://localhost:5000/podinfo", wantHost: "localhost:5000", wantName: "podinfo"},
+		{repository: "docker.io/org/podinfo", wantHost: "registry-1.docker.io", wantName: "org/podinfo"},
+		{repository: "podinfo", wantErr: true},
+		{repository: "ghcr.io/", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.repository, func(t *testing.T) {
+			host, name, err := splitRepository(tt.repository)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitRepository() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if host != tt.wantHost || name != tt.wantName {
+				t.Errorf("splitRepository() = %s, %s, want %s, %s", host, name, tt.wantHost, tt.wantName)
+			}
+		})
+	}
+}
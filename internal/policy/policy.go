@@ -0,0 +1,151 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package policy restricts the endpoints the sources in a namespace may
+// reference, e.g. to keep the tenants of a cluster to the repositories of
+// their organization.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// ErrEndpointNotAllowed is the error returned by Policy.Check for the
+// endpoints the policy does not allow.
+var ErrEndpointNotAllowed = errors.New("endpoint not allowed by policy")
+
+// Policy holds the rules restricting the endpoints of the sources.
+type Policy struct {
+	// Rules are the rules of the policy. An endpoint is allowed if it does
+	// not match any deny pattern of the rules of the namespace and, if they
+	// have allow patterns, it matches at least one of them.
+	Rules []Rule `json:"rules"`
+}
+
+// Rule restricts the endpoints of the sources in the matching namespaces.
+type Rule struct {
+	// Namespaces are the glob patterns of the namespaces the rule applies
+	// to, e.g. 'team-*'. The rule applies to all namespaces when empty.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Allow are the glob patterns of the allowed endpoints, in the
+	// '<host>/<path>' format, e.g. 'github.com/ourorg/*'.
+	// +optional
+	Allow []string `json:"allow,omitempty"`
+
+	// Deny are the glob patterns of the denied endpoints, in the
+	// '<host>/<path>' format, e.g. '*.s3.amazonaws.com/*'.
+	// +optional
+	Deny []string `json:"deny,omitempty"`
+}
+
+// Load reads the YAML policy from the file at the given path, and validates
+// its patterns.
+func Load(p string) (*Policy, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var policy Policy
+	if err := yaml.UnmarshalStrict(b, &policy); err != nil {
+		return nil, fmt.Errorf("invalid policy '%s': %w", p, err)
+	}
+	for _, rule := range policy.Rules {
+		for _, patterns := range [][]string{rule.Namespaces, rule.Allow, rule.Deny} {
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return nil, fmt.Errorf("invalid policy pattern '%s': %w", pattern, err)
+				}
+			}
+		}
+	}
+	return &policy, nil
+}
+
+// Check returns an ErrEndpointNotAllowed error if the policy does not allow
+// the sources in the given namespace to reference the given endpoint URL. A
+// nil Policy allows any endpoint.
+func (p *Policy) Check(namespace, endpoint string) error {
+	if p == nil {
+		return nil
+	}
+	normalized, err := Normalize(endpoint)
+	if err != nil {
+		return err
+	}
+	var allow []string
+	for _, rule := range p.Rules {
+		if len(rule.Namespaces) > 0 && !matchAny(rule.Namespaces, namespace) {
+			continue
+		}
+		if matchAny(rule.Deny, normalized) {
+			return fmt.Errorf("%w: '%s' is denied in namespace '%s'", ErrEndpointNotAllowed, normalized, namespace)
+		}
+		allow = append(allow, rule.Allow...)
+	}
+	if len(allow) > 0 && !matchAny(allow, normalized) {
+		return fmt.Errorf("%w: '%s' is not allowed in namespace '%s'", ErrEndpointNotAllowed, normalized, namespace)
+	}
+	return nil
+}
+
+// scpURL matches the scp-like URLs of the Git repositories, e.g.
+// 'git@github.com:ourorg/podinfo.git', capturing their host and path.
+var scpURL = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.*)$`)
+
+// portPrefix matches the path of an scp-like URL which is the port and path
+// of an endpoint without a scheme, e.g. the one of a bucket.
+var portPrefix = regexp.MustCompile(`^[0-9]+(/|$)`)
+
+// Normalize returns the given endpoint URL in the '<host>/<path>' format
+// matched by the patterns, without the scheme, the user info, the port,
+// the query and the '.git' suffix. An endpoint without a scheme, e.g. the
+// one of a bucket, is parsed as a host and path, unless it is an scp-like
+// Git URL, e.g. the one of a submodule.
+func Normalize(endpoint string) (string, error) {
+	if !strings.Contains(endpoint, "://") {
+		if m := scpURL.FindStringSubmatch(endpoint); m != nil && !portPrefix.MatchString(m[2]) {
+			endpoint = m[1] + "/" + strings.TrimPrefix(m[2], "/")
+		}
+		endpoint = "//" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid endpoint '%s': %w", endpoint, err)
+	}
+	p := strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), ".git")
+	return strings.ToLower(u.Hostname()) + p, nil
+}
+
+// matchAny returns true if the given name matches any of the given glob
+// patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
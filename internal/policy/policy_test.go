@@ -0,0 +1,115 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{endpoint: "https://github.com/ourorg/podinfo", want: "github.com/ourorg/podinfo"},
+		{endpoint: "ssh://git@GitHub.com:22/ourorg/podinfo.git", want: "github.com/ourorg/podinfo"},
+		{endpoint: "https://charts.example.com/stable/?token=x", want: "charts.example.com/stable"},
+		{endpoint: "minio.example.com:9000/podinfo", want: "minio.example.com/podinfo"},
+		{endpoint: "git@github.com:ourorg/podinfo.git", want: "github.com/ourorg/podinfo"},
+		{endpoint: "github.com:/ourorg/podinfo", want: "github.com/ourorg/podinfo"},
+		{endpoint: "minio.example.com:9000", want: "minio.example.com"},
+	}
+	for _, tt := range tests {
+		got, err := Normalize(tt.endpoint)
+		if err != nil {
+			t.Errorf("Normalize(%q) error = %v", tt.endpoint, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.endpoint, got, tt.want)
+		}
+	}
+}
+
+func TestPolicy_Check(t *testing.T) {
+	p := &Policy{Rules: []Rule{
+		{Deny: []string{"*.s3.amazonaws.com/*"}},
+		{Namespaces: []string{"team-*"}, Allow: []string{"github.com/ourorg/*", "charts.example.com/*"}},
+		{Namespaces: []string{"team-b"}, Deny: []string{"github.com/ourorg/secrets"}},
+	}}
+	tests := []struct {
+		namespace string
+		endpoint  string
+		allowed   bool
+	}{
+		{namespace: "team-a", endpoint: "https://github.com/ourorg/podinfo", allowed: true},
+		{namespace: "team-a", endpoint: "ssh://git@github.com/ourorg/podinfo.git", allowed: true},
+		{namespace: "team-a", endpoint: "https://github.com/otherorg/podinfo", allowed: false},
+		{namespace: "team-a", endpoint: "https://github.com/ourorg/secrets", allowed: true},
+		{namespace: "team-b", endpoint: "https://github.com/ourorg/secrets", allowed: false},
+		{namespace: "flux-system", endpoint: "https://github.com/otherorg/podinfo", allowed: true},
+		{namespace: "flux-system", endpoint: "public.s3.amazonaws.com/podinfo", allowed: false},
+	}
+	for _, tt := range tests {
+		err := p.Check(tt.namespace, tt.endpoint)
+		if tt.allowed && err != nil {
+			t.Errorf("Check(%q, %q) error = %v", tt.namespace, tt.endpoint, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrEndpointNotAllowed) {
+			t.Errorf("Check(%q, %q) error = %v, want %v", tt.namespace, tt.endpoint, err, ErrEndpointNotAllowed)
+		}
+	}
+
+	var nilPolicy *Policy
+	if err := nilPolicy.Check("default", "https://example.com"); err != nil {
+		t.Errorf("nil Policy Check() error = %v", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.yaml")
+	if err := os.WriteFile(valid, []byte(`rules:
+- namespaces: ["team-*"]
+  allow: ["github.com/ourorg/*"]
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Load(valid)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(p.Rules) != 1 || p.Rules[0].Allow[0] != "github.com/ourorg/*" {
+		t.Errorf("Load() = %+v", p)
+	}
+
+	for name, content := range map[string]string{
+		"unknown.yaml": "rules:\n- allowed: [\"github.com/*\"]\n",
+		"pattern.yaml": "rules:\n- allow: [\"github.com/[\"]\n",
+	} {
+		f := filepath.Join(dir, name)
+		if err := os.WriteFile(f, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(f); err == nil {
+			t.Errorf("Load(%s) error = nil", name)
+		}
+	}
+}
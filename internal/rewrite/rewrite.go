@@ -0,0 +1,116 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rewrite rewrites the URLs of the sources before they are fetched,
+// e.g. to fetch from the mirrors of an air-gapped cluster without editing the
+// spec of the sources.
+package rewrite
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Rewriter holds the rules rewriting the URLs of the sources.
+type Rewriter struct {
+	// Rules are the rules of the rewriter. A URL is rewritten by the rule
+	// with the longest matching From prefix.
+	Rules []Rule `json:"rules"`
+}
+
+// Rule replaces a prefix of the URLs.
+type Rule struct {
+	// From is the prefix of the URLs rewritten by the rule, in the
+	// '<host>[:<port>][/<path>]' format, e.g. 'github.com/ourorg'. It
+	// matches the URLs of any scheme and user info, up to a path segment.
+	From string `json:"from"`
+
+	// To is the replacement of the From prefix, in the same format, e.g.
+	// 'github-mirror.internal/ourorg'.
+	To string `json:"to"`
+}
+
+// Load reads the YAML rules from the file at the given path, and validates
+// their prefixes.
+func Load(p string) (*Rewriter, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var rewriter Rewriter
+	if err := yaml.UnmarshalStrict(b, &rewriter); err != nil {
+		return nil, fmt.Errorf("invalid rewrite rules '%s': %w", p, err)
+	}
+	for _, rule := range rewriter.Rules {
+		for _, prefix := range []string{rule.From, rule.To} {
+			if prefix == "" || strings.Contains(prefix, "://") || strings.Contains(prefix, "@") {
+				return nil, fmt.Errorf("invalid rewrite prefix '%s': must be in the '<host>[:<port>][/<path>]' format", prefix)
+			}
+		}
+	}
+	return &rewriter, nil
+}
+
+// Rewrite returns the given URL with the prefix of the matching rule
+// replaced, keeping its scheme and user info, or the URL as is if no rule
+// matches. A URL without a scheme, e.g. the endpoint of a bucket, is
+// matched as a host and path. A nil Rewriter returns the URL as is.
+func (r *Rewriter) Rewrite(u string) string {
+	if r == nil || u == "" {
+		return u
+	}
+
+	var prefix, rest string
+	if i := strings.Index(u, "://"); i >= 0 {
+		prefix, rest = u[:i+3], u[i+3:]
+	} else {
+		rest = u
+	}
+	authority := rest
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		authority = rest[:i]
+	}
+	if i := strings.LastIndex(authority, "@"); i >= 0 {
+		prefix, rest = prefix+rest[:i+1], rest[i+1:]
+	}
+
+	var match *Rule
+	for i, rule := range r.Rules {
+		if !hasPrefix(rest, strings.TrimSuffix(rule.From, "/")) {
+			continue
+		}
+		if match == nil || len(rule.From) > len(match.From) {
+			match = &r.Rules[i]
+		}
+	}
+	if match == nil {
+		return u
+	}
+	from, to := strings.TrimSuffix(match.From, "/"), strings.TrimSuffix(match.To, "/")
+	return prefix + to + rest[len(from):]
+}
+
+// hasPrefix returns true if the given host and path starts with the given
+// prefix, ending at a path segment.
+func hasPrefix(s, prefix string) bool {
+	if !strings.HasPrefix(s, prefix) {
+		return false
+	}
+	return len(s) == len(prefix) || strings.ContainsRune("/?#", rune(s[len(prefix)]))
+}
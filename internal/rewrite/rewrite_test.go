@@ -0,0 +1,86 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rewrite
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRewriter_Rewrite(t *testing.T) {
+	r := &Rewriter{Rules: []Rule{
+		{From: "github.com", To: "github-mirror.internal"},
+		{From: "github.com/ourorg/", To: "git.internal:8443/mirrors/ourorg"},
+		{From: "s3.amazonaws.com", To: "minio.internal:9000"},
+	}}
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "https://github.com/otherorg/podinfo", want: "https://github-mirror.internal/otherorg/podinfo"},
+		{url: "ssh://git@github.com/otherorg/podinfo.git", want: "ssh://git@github-mirror.internal/otherorg/podinfo.git"},
+		{url: "https://github.com/ourorg/podinfo", want: "https://git.internal:8443/mirrors/ourorg/podinfo"},
+		{url: "https://github.com?ref=main", want: "https://github-mirror.internal?ref=main"},
+		{url: "https://github.company.com/ourorg/podinfo", want: "https://github.company.com/ourorg/podinfo"},
+		{url: "https://github.com/ourorganization/podinfo", want: "https://github-mirror.internal/ourorganization/podinfo"},
+		{url: "s3.amazonaws.com", want: "minio.internal:9000"},
+		{url: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := r.Rewrite(tt.url); got != tt.want {
+			t.Errorf("Rewrite(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+
+	var nilRewriter *Rewriter
+	if got := nilRewriter.Rewrite("https://github.com"); got != "https://github.com" {
+		t.Errorf("nil Rewriter Rewrite() = %q", got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.yaml")
+	if err := os.WriteFile(valid, []byte(`rules:
+- from: github.com
+  to: github-mirror.internal
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Load(valid)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(r.Rules) != 1 || r.Rules[0].To != "github-mirror.internal" {
+		t.Errorf("Load() = %+v", r)
+	}
+
+	for name, content := range map[string]string{
+		"unknown.yaml": "rules:\n- source: github.com\n  to: github-mirror.internal\n",
+		"scheme.yaml":  "rules:\n- from: https://github.com\n  to: github-mirror.internal\n",
+		"empty.yaml":   "rules:\n- from: github.com\n",
+	} {
+		f := filepath.Join(dir, name)
+		if err := os.WriteFile(f, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(f); err == nil {
+			t.Errorf("Load(%s) error = nil", name)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+type cdxDocument struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components,omitempty"`
+	Dependencies []cdxDependency `json:"dependencies,omitempty"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     []cdxTool    `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTool struct {
+	Vendor string `json:"vendor"`
+	Name   string `json:"name"`
+}
+
+type cdxComponent struct {
+	BOMRef             string         `json:"bom-ref"`
+	Type               string         `json:"type"`
+	Name               string         `json:"name"`
+	Version            string         `json:"version,omitempty"`
+	Hashes             []cdxHash      `json:"hashes,omitempty"`
+	ExternalReferences []cdxReference `json:"externalReferences,omitempty"`
+	Properties         []cdxProperty  `json:"properties,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxReference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// marshalCycloneDX returns the given document in the CycloneDX 1.3 JSON
+// format. The artifact is the component described by the metadata, the
+// files and the dependencies of the charts being its components.
+func marshalCycloneDX(doc Document) ([]byte, error) {
+	const artifactRef = "artifact"
+	artifact := cdxComponent{
+		BOMRef:  artifactRef,
+		Type:    "application",
+		Name:    doc.Name,
+		Version: doc.Version,
+	}
+	if doc.Checksum != "" {
+		artifact.Hashes = []cdxHash{{Alg: "SHA-1", Content: doc.Checksum}}
+	}
+	if doc.DownloadLocation != "" {
+		artifact.ExternalReferences = []cdxReference{{Type: "distribution", URL: doc.DownloadLocation}}
+	}
+
+	out := cdxDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.3",
+		SerialNumber: "urn:uuid:" + serialNumber(doc),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: doc.Created.UTC().Format(time.RFC3339),
+			Tools:     []cdxTool{{Vendor: "Flux", Name: "source-controller"}},
+			Component: artifact,
+		},
+	}
+	for _, f := range doc.Files {
+		out.Components = append(out.Components, cdxComponent{
+			BOMRef: "file:" + f.Name,
+			Type:   "file",
+			Name:   f.Name,
+			Hashes: []cdxHash{
+				{Alg: "SHA-1", Content: f.SHA1},
+				{Alg: "SHA-256", Content: f.SHA256},
+			},
+			Properties: []cdxProperty{{Name: "size", Value: strconv.FormatInt(f.Size, 10)}},
+		})
+	}
+	if len(doc.Dependencies) > 0 {
+		dependencies := cdxDependency{Ref: artifactRef}
+		for i, dep := range doc.Dependencies {
+			ref := fmt.Sprintf("dependency:%d", i)
+			component := cdxComponent{
+				BOMRef:     ref,
+				Type:       "library",
+				Name:       dep.Name,
+				Version:    dep.Version,
+				Properties: []cdxProperty{{Name: "chart", Value: dep.Chart}},
+			}
+			if dep.Repository != "" {
+				component.ExternalReferences = []cdxReference{{Type: "distribution", URL: dep.Repository}}
+			}
+			out.Components = append(out.Components, component)
+			dependencies.DependsOn = append(dependencies.DependsOn, ref)
+		}
+		out.Dependencies = []cdxDependency{dependencies}
+	}
+	return json.MarshalIndent(out, "", "  ")
+}
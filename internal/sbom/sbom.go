@@ -0,0 +1,197 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sbom describes the contents of the artifacts in Software Bill of
+// Materials documents, in the SPDX and CycloneDX JSON formats.
+package sbom
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// SPDXFormat is the SPDX 2.2 JSON format.
+	SPDXFormat = "spdx"
+	// CycloneDXFormat is the CycloneDX 1.3 JSON format.
+	CycloneDXFormat = "cyclonedx"
+
+	// maxChartFileSize is the maximum size of the Chart.yaml files whose
+	// dependencies are recorded.
+	maxChartFileSize = 1 << 20
+)
+
+// File is a file of an artifact.
+type File struct {
+	// Name is the path of the file in the artifact.
+	Name string
+	// Size is the size of the file in bytes.
+	Size int64
+	// SHA1 is the hex encoded SHA-1 digest of the file.
+	SHA1 string
+	// SHA256 is the hex encoded SHA-256 digest of the file.
+	SHA256 string
+}
+
+// Dependency is a dependency declared in the Chart.yaml of a Helm chart of
+// an artifact.
+type Dependency struct {
+	// Chart is the name of the chart declaring the dependency.
+	Chart string
+	// Name is the name of the chart depended on.
+	Name string
+	// Version is the version constraint of the chart depended on.
+	Version string
+	// Repository is the URL of the repository of the chart depended on.
+	Repository string
+}
+
+// Document is the Software Bill of Materials of an artifact.
+type Document struct {
+	// Name is the name of the artifact, e.g. its path in the storage.
+	Name string
+	// Version is the revision of the artifact.
+	Version string
+	// DownloadLocation is the URL of the artifact.
+	DownloadLocation string
+	// Checksum is the hex encoded SHA-1 digest of the artifact.
+	Checksum string
+	// Created is the time the artifact was created.
+	Created time.Time
+	// Files are the files of the artifact, sorted by name.
+	Files []File
+	// Dependencies are the dependencies of the Helm charts of the artifact.
+	Dependencies []Dependency
+}
+
+// Ext returns the file extension of the documents of the given format, or
+// an error if the format is not supported.
+func Ext(format string) (string, error) {
+	switch format {
+	case SPDXFormat:
+		return ".spdx.json", nil
+	case CycloneDXFormat:
+		return ".cdx.json", nil
+	default:
+		return "", fmt.Errorf("unsupported SBOM format '%s'", format)
+	}
+}
+
+// Marshal returns the given document encoded in the given format.
+func Marshal(format string, doc Document) ([]byte, error) {
+	switch format {
+	case SPDXFormat:
+		return marshalSPDX(doc)
+	case CycloneDXFormat:
+		return marshalCycloneDX(doc)
+	default:
+		return nil, fmt.Errorf("unsupported SBOM format '%s'", format)
+	}
+}
+
+// ReadTarball records in the given document the regular files of the given
+// gzip compressed tarball, and the dependencies declared in its Chart.yaml
+// files.
+func (d *Document) ReadTarball(r io.Reader) error {
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gzr.Close()
+
+	tr := tar.NewReader(gzr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		sha1Hash, sha256Hash := sha1.New(), sha256.New()
+		w := io.MultiWriter(sha1Hash, sha256Hash)
+		var metadata bytes.Buffer
+		isChart := path.Base(hdr.Name) == "Chart.yaml" && hdr.Size <= maxChartFileSize
+		if isChart {
+			w = io.MultiWriter(w, &metadata)
+		}
+		if _, err := io.Copy(w, tr); err != nil {
+			return err
+		}
+		d.Files = append(d.Files, File{
+			Name:   hdr.Name,
+			Size:   hdr.Size,
+			SHA1:   hex.EncodeToString(sha1Hash.Sum(nil)),
+			SHA256: hex.EncodeToString(sha256Hash.Sum(nil)),
+		})
+		if isChart {
+			d.Dependencies = append(d.Dependencies, chartDependencies(metadata.Bytes())...)
+		}
+	}
+
+	sort.Slice(d.Files, func(i, j int) bool {
+		return d.Files[i].Name < d.Files[j].Name
+	})
+	return nil
+}
+
+// chartDependencies returns the dependencies declared in the given
+// Chart.yaml, or none if it can not be decoded.
+func chartDependencies(data []byte) []Dependency {
+	var metadata chart.Metadata
+	if err := yaml.Unmarshal(data, &metadata); err != nil {
+		return nil
+	}
+	var deps []Dependency
+	for _, dep := range metadata.Dependencies {
+		if dep == nil {
+			continue
+		}
+		deps = append(deps, Dependency{
+			Chart:      metadata.Name,
+			Name:       dep.Name,
+			Version:    dep.Version,
+			Repository: dep.Repository,
+		})
+	}
+	return deps
+}
+
+// serialNumber returns an UUID derived from the name, version and checksum
+// of the given document, so the same artifact is always described by the
+// same document.
+func serialNumber(doc Document) string {
+	sum := sha1.Sum([]byte(doc.Name + "\n" + doc.Version + "\n" + doc.Checksum))
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
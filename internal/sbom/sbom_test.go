@@ -0,0 +1,151 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sbom
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func tarball(t *testing.T, files map[string]string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	if err := tw.WriteHeader(&tar.Header{Name: "podinfo/", Typeflag: tar.TypeDir, Mode: 0o755}); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestDocument_ReadTarball(t *testing.T) {
+	r := tarball(t, map[string]string{
+		"podinfo/values.yaml": "replicaCount: 1\n",
+		"podinfo/Chart.yaml": `apiVersion: v2
+name: podinfo
+version: 6.0.0
+dependencies:
+  - name: redis
+    version: 15.x
+    repository: https://charts.bitnami.com/bitnami
+`,
+	})
+
+	var doc Document
+	if err := doc.ReadTarball(r); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Files) != 2 {
+		t.Fatalf("Files = %v, want 2 regular files", doc.Files)
+	}
+	values := doc.Files[1]
+	if values.Name != "podinfo/values.yaml" || values.Size != 16 {
+		t.Errorf("Files[1] = %s of %d bytes, want podinfo/values.yaml of 16 bytes", values.Name, values.Size)
+	}
+	if len(values.SHA1) != 40 || len(values.SHA256) != 64 {
+		t.Errorf("SHA1 = %s, SHA256 = %s, want hex encoded digests", values.SHA1, values.SHA256)
+	}
+	want := Dependency{Chart: "podinfo", Name: "redis", Version: "15.x", Repository: "https://charts.bitnami.com/bitnami"}
+	if len(doc.Dependencies) != 1 || doc.Dependencies[0] != want {
+		t.Errorf("Dependencies = %v, want %v", doc.Dependencies, want)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	doc := Document{
+		Name:             "gitrepository/default/podinfo/6b7aab8a10d6ee8b895b0a5048f4ab0966ed29ff.tar.gz",
+		Version:          "main/6b7aab8a10d6ee8b895b0a5048f4ab0966ed29ff",
+		DownloadLocation: "http://source-controller./gitrepository/default/podinfo/6b7aab8a10d6ee8b895b0a5048f4ab0966ed29ff.tar.gz",
+		Checksum:         "b9d1e1b6cb0b6d7d1ae7a9b6a1ea0e1f1c0fb3f7",
+		Created:          time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC),
+		Files:            []File{{Name: "README.md", Size: 5, SHA1: "sha1", SHA256: "sha256"}},
+		Dependencies:     []Dependency{{Chart: "podinfo", Name: "redis", Version: "15.x"}},
+	}
+
+	tests := []struct {
+		format string
+		check  func(t *testing.T, out map[string]interface{})
+	}{
+		{
+			format: SPDXFormat,
+			check: func(t *testing.T, out map[string]interface{}) {
+				if out["spdxVersion"] != "SPDX-2.2" {
+					t.Errorf("spdxVersion = %v, want SPDX-2.2", out["spdxVersion"])
+				}
+				if files := out["files"].([]interface{}); len(files) != 1 {
+					t.Errorf("files = %v, want 1", files)
+				}
+				if packages := out["packages"].([]interface{}); len(packages) != 2 {
+					t.Errorf("packages = %v, want the artifact and its dependency", packages)
+				}
+			},
+		},
+		{
+			format: CycloneDXFormat,
+			check: func(t *testing.T, out map[string]interface{}) {
+				if out["bomFormat"] != "CycloneDX" {
+					t.Errorf("bomFormat = %v, want CycloneDX", out["bomFormat"])
+				}
+				if components := out["components"].([]interface{}); len(components) != 2 {
+					t.Errorf("components = %v, want the file and the dependency", components)
+				}
+				if dependencies := out["dependencies"].([]interface{}); len(dependencies) != 1 {
+					t.Errorf("dependencies = %v, want 1", dependencies)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			data, err := Marshal(tt.format, doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			again, _ := Marshal(tt.format, doc)
+			if !bytes.Equal(data, again) {
+				t.Error("Marshal() is not deterministic")
+			}
+			var out map[string]interface{}
+			if err := json.Unmarshal(data, &out); err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, out)
+		})
+	}
+
+	if _, err := Marshal("syft", doc); err == nil {
+		t.Error("Marshal() error = nil, want unsupported format")
+	}
+}
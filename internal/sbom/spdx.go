@@ -0,0 +1,153 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// noAssertion is the SPDX value of the fields whose value is not known.
+const noAssertion = "NOASSERTION"
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Files             []spdxFile         `json:"files,omitempty"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string         `json:"SPDXID"`
+	Name             string         `json:"name"`
+	VersionInfo      string         `json:"versionInfo,omitempty"`
+	DownloadLocation string         `json:"downloadLocation"`
+	FilesAnalyzed    bool           `json:"filesAnalyzed"`
+	Checksums        []spdxChecksum `json:"checksums,omitempty"`
+	LicenseConcluded string         `json:"licenseConcluded"`
+	LicenseDeclared  string         `json:"licenseDeclared"`
+	CopyrightText    string         `json:"copyrightText"`
+	HasFiles         []string       `json:"hasFiles,omitempty"`
+}
+
+type spdxFile struct {
+	SPDXID           string         `json:"SPDXID"`
+	FileName         string         `json:"fileName"`
+	Checksums        []spdxChecksum `json:"checksums"`
+	LicenseConcluded string         `json:"licenseConcluded"`
+	CopyrightText    string         `json:"copyrightText"`
+	Comment          string         `json:"comment"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// marshalSPDX returns the given document in the SPDX 2.2 JSON format. The
+// artifact is the described package holding the files, which SPDX has no
+// size field for, so it is recorded in their comment. The dependencies of
+// the charts are packages the artifact depends on.
+func marshalSPDX(doc Document) ([]byte, error) {
+	const artifactID = "SPDXRef-Artifact"
+	artifact := spdxPackage{
+		SPDXID:           artifactID,
+		Name:             doc.Name,
+		VersionInfo:      doc.Version,
+		DownloadLocation: orNoAssertion(doc.DownloadLocation),
+		FilesAnalyzed:    true,
+		LicenseConcluded: noAssertion,
+		LicenseDeclared:  noAssertion,
+		CopyrightText:    noAssertion,
+	}
+	if doc.Checksum != "" {
+		artifact.Checksums = []spdxChecksum{{Algorithm: "SHA1", ChecksumValue: doc.Checksum}}
+	}
+
+	out := spdxDocument{
+		SPDXVersion:       "SPDX-2.2",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              doc.Name,
+		DocumentNamespace: "urn:uuid:" + serialNumber(doc),
+		CreationInfo: spdxCreationInfo{
+			Created:  doc.Created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: source-controller"},
+		},
+		Relationships: []spdxRelationship{
+			{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: artifactID},
+		},
+	}
+	for i, f := range doc.Files {
+		id := fmt.Sprintf("SPDXRef-File-%d", i)
+		artifact.HasFiles = append(artifact.HasFiles, id)
+		out.Files = append(out.Files, spdxFile{
+			SPDXID:   id,
+			FileName: "./" + f.Name,
+			Checksums: []spdxChecksum{
+				{Algorithm: "SHA1", ChecksumValue: f.SHA1},
+				{Algorithm: "SHA256", ChecksumValue: f.SHA256},
+			},
+			LicenseConcluded: noAssertion,
+			CopyrightText:    noAssertion,
+			Comment:          fmt.Sprintf("Size: %d bytes", f.Size),
+		})
+	}
+	out.Packages = append(out.Packages, artifact)
+	for i, dep := range doc.Dependencies {
+		id := fmt.Sprintf("SPDXRef-Dependency-%d", i)
+		out.Packages = append(out.Packages, spdxPackage{
+			SPDXID:           id,
+			Name:             dep.Name,
+			VersionInfo:      dep.Version,
+			DownloadLocation: orNoAssertion(dep.Repository),
+			LicenseConcluded: noAssertion,
+			LicenseDeclared:  noAssertion,
+			CopyrightText:    noAssertion,
+		})
+		out.Relationships = append(out.Relationships, spdxRelationship{
+			SPDXElementID:      artifactID,
+			RelationshipType:   "DEPENDS_ON",
+			RelatedSPDXElement: id,
+		})
+	}
+	return json.MarshalIndent(out, "", "  ")
+}
+
+func orNoAssertion(s string) string {
+	if s == "" {
+		return noAssertion
+	}
+	return s
+}
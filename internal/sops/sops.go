@@ -0,0 +1,89 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sops detects the files encrypted with SOPS, to keep their
+// ciphertext out of the artifacts of the tenants lacking the decryption keys.
+package sops
+
+import (
+	"bufio"
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	// documentSeparator matches the separators of the documents of a YAML
+	// stream.
+	documentSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+	// iniMACKey matches the MAC key of the 'sops' section of an INI file.
+	iniMACKey = regexp.MustCompile(`^mac\s*=`)
+)
+
+// IsEncrypted returns true if the given content of the file with the given
+// name has been encrypted with SOPS, which records its metadata in the file
+// in a format depending on the extension: in a 'sops_mac' variable for
+// dotenv files, in a 'sops' section for INI files, and in a 'sops' key of
+// the documents for YAML, JSON and binary files.
+func IsEncrypted(name string, data []byte) bool {
+	if !bytes.Contains(data, []byte("sops")) {
+		return false
+	}
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".env":
+		return hasLine(data, func(line string) bool {
+			return strings.HasPrefix(line, "sops_mac=")
+		})
+	case ".ini":
+		inSection := false
+		return hasLine(data, func(line string) bool {
+			if strings.HasPrefix(line, "[") {
+				inSection = line == "[sops]"
+				return false
+			}
+			return inSection && iniMACKey.MatchString(line)
+		})
+	}
+
+	for _, doc := range documentSeparator.Split(string(data), -1) {
+		var metadata struct {
+			SOPS map[string]interface{} `json:"sops"`
+		}
+		if err := yaml.Unmarshal([]byte(doc), &metadata); err != nil {
+			continue
+		}
+		if _, ok := metadata.SOPS["mac"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasLine returns true if the given function returns true for any of the
+// trimmed lines of the given data.
+func hasLine(data []byte, f func(line string) bool) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if f(strings.TrimSpace(scanner.Text())) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sops
+
+import "testing"
+
+func TestIsEncrypted(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data string
+		want bool
+	}{
+		{
+			name: "encrypted YAML",
+			file: "secret.yaml",
+			data: `apiVersion: v1
+kind: Secret
+data:
+    token: ENC[AES256_GCM,data:Tr7o=,iv:1=,tag:k=,type:str]
+sops:
+    mac: ENC[AES256_GCM,data:oYyi,iv:M=,tag:D=,type:str]
+    version: 3.7.1
+`,
+			want: true,
+		},
+		{
+			name: "encrypted document of a YAML stream",
+			file: "secrets.yml",
+			data: `apiVersion: v1
+kind: ConfigMap
+---
+apiVersion: v1
+kind: Secret
+sops:
+    mac: ENC[AES256_GCM,data:oYyi,iv:M=,tag:D=,type:str]
+`,
+			want: true,
+		},
+		{
+			name: "encrypted JSON",
+			file: "secret.json",
+			data: `{"token": "ENC[AES256_GCM,data:Tr7o=]", "sops": {"mac": "ENC[AES256_GCM,data:oYyi]", "version": "3.7.1"}}`,
+			want: true,
+		},
+		{
+			name: "encrypted binary",
+			file: "id_rsa",
+			data: `{"data": "ENC[AES256_GCM,data:Tr7o=]", "sops": {"mac": "ENC[AES256_GCM,data:oYyi]"}}`,
+			want: true,
+		},
+		{
+			name: "encrypted dotenv",
+			file: "app.env",
+			data: "TOKEN=ENC[AES256_GCM,data:Tr7o=]\nsops_version=3.7.1\nsops_mac=ENC[AES256_GCM,data:oYyi]\n",
+			want: true,
+		},
+		{
+			name: "encrypted INI",
+			file: "app.ini",
+			data: "[app]\ntoken = ENC[AES256_GCM,data:Tr7o=]\n\n[sops]\nversion = 3.7.1\nmac = ENC[AES256_GCM,data:oYyi]\n",
+			want: true,
+		},
+		{
+			name: "configuration of SOPS",
+			file: ".sops.yaml",
+			data: "creation_rules:\n  - path_regex: .*.yaml\n    encrypted_regex: ^(data|stringData)$\n",
+		},
+		{
+			name: "YAML without MAC",
+			file: "values.yaml",
+			data: "sops:\n  enabled: true\n",
+		},
+		{
+			name: "INI with MAC outside the sops section",
+			file: "app.ini",
+			data: "[sops]\nversion = 3.7.1\n\n[app]\nmac = 00:11:22:33:44:55\n",
+		},
+		{
+			name: "plain text",
+			file: "README.md",
+			data: "Decrypt with `sops -d secret.yaml`.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsEncrypted(tt.file, []byte(tt.data)); got != tt.want {
+				t.Errorf("IsEncrypted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
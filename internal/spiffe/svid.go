@@ -0,0 +1,122 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package spiffe loads the SPIFFE X.509 SVID of the controller from the
+// files written to a mounted volume, e.g. by the SPIFFE Helper or the
+// SPIFFE CSI driver, to present it as the TLS client certificate.
+package spiffe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// SVIDFile is the name of the PEM file holding the X.509 SVID certificate
+	// chain, leaf first.
+	SVIDFile = "svid.pem"
+	// SVIDKeyFile is the name of the PEM file holding the private key of the
+	// X.509 SVID.
+	SVIDKeyFile = "svid_key.pem"
+)
+
+// X509SVIDSource provides the X.509 SVID from the SVIDFile and SVIDKeyFile in
+// a directory. The files are loaded again when they change, as the SVIDs are
+// short-lived and rotated by the workload identity provider.
+type X509SVIDSource struct {
+	dir string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewX509SVIDSource returns a X509SVIDSource for the given directory, failing
+// if it does not hold a valid X.509 SVID.
+func NewX509SVIDSource(dir string) (*X509SVIDSource, error) {
+	s := &X509SVIDSource{dir: dir}
+	if _, err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// CertFile returns the path of the SVIDFile.
+func (s *X509SVIDSource) CertFile() string {
+	return filepath.Join(s.dir, SVIDFile)
+}
+
+// KeyFile returns the path of the SVIDKeyFile.
+func (s *X509SVIDSource) KeyFile() string {
+	return filepath.Join(s.dir, SVIDKeyFile)
+}
+
+// ID returns the SPIFFE ID of the current X.509 SVID.
+func (s *X509SVIDSource) ID() (string, error) {
+	cert, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	return spiffeID(cert.Leaf)
+}
+
+// GetClientCertificate returns the current X.509 SVID, to be used as the
+// tls.Config GetClientCertificate callback.
+func (s *X509SVIDSource) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return s.load()
+}
+
+// load returns the cached X.509 SVID, loading the files again if the
+// certificate file has been modified since.
+func (s *X509SVIDSource) load() (*tls.Certificate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.CertFile())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read X.509 SVID: %w", err)
+	}
+	if s.cert != nil && info.ModTime().Equal(s.modTime) {
+		return s.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(s.CertFile(), s.KeyFile())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load X.509 SVID: %w", err)
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return nil, fmt.Errorf("failed to parse X.509 SVID: %w", err)
+	}
+	if _, err := spiffeID(cert.Leaf); err != nil {
+		return nil, err
+	}
+	s.cert = &cert
+	s.modTime = info.ModTime()
+	return s.cert, nil
+}
+
+// spiffeID returns the SPIFFE ID from the URI SAN of the given certificate.
+func spiffeID(cert *x509.Certificate) (string, error) {
+	if len(cert.URIs) != 1 || cert.URIs[0].Scheme != "spiffe" {
+		return "", fmt.Errorf("invalid X.509 SVID: certificate must have exactly one 'spiffe' URI SAN")
+	}
+	return cert.URIs[0].String(), nil
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spiffe
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSVID writes a self-signed X.509 SVID with the given URI SANs to the
+// given directory.
+func writeSVID(t *testing.T, dir string, modTime time.Time, uris ...string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"flux"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	for _, u := range uris {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.URIs = append(tmpl.URIs, parsed)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, SVIDFile), filepath.Join(dir, SVIDKeyFile)
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(certFile, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestX509SVIDSource(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeSVID(t, dir, now, "spiffe://example.org/ns/flux-system/sa/source-controller")
+
+	s, err := NewX509SVIDSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := s.ID(); err != nil || id != "spiffe://example.org/ns/flux-system/sa/source-controller" {
+		t.Errorf("ID() = %q, %v", id, err)
+	}
+
+	// the rotated SVID is loaded again
+	writeSVID(t, dir, now.Add(time.Minute), "spiffe://example.org/rotated")
+	cert, err := s.GetClientCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cert.Leaf.URIs[0].String(); got != "spiffe://example.org/rotated" {
+		t.Errorf("GetClientCertificate() returned SVID of %q, want rotated SVID", got)
+	}
+}
+
+func TestNewX509SVIDSource_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		uris []string
+	}{
+		{name: "no URI SAN"},
+		{name: "not a SPIFFE ID", uris: []string{"https://example.org"}},
+		{name: "multiple SPIFFE IDs", uris: []string{"spiffe://example.org/a", "spiffe://example.org/b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeSVID(t, dir, time.Now(), tt.uris...)
+			if _, err := NewX509SVIDSource(dir); err == nil {
+				t.Error("NewX509SVIDSource() did not return error")
+			}
+		})
+	}
+
+	if _, err := NewX509SVIDSource(t.TempDir()); err == nil {
+		t.Error("NewX509SVIDSource() did not return error for missing files")
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing records the OpenTelemetry spans of the source-controller
+// operations, and exports them to an OTLP collector.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the tracer of the spans.
+const instrumentationName = "github.com/fluxcd/source-controller"
+
+// The attribute keys of the spans.
+const (
+	// KindKey is the kind of the reconciled object.
+	KindKey = attribute.Key("source.kind")
+	// NamespaceKey is the namespace of the reconciled object.
+	NamespaceKey = attribute.Key("source.namespace")
+	// NameKey is the name of the reconciled object.
+	NameKey = attribute.Key("source.name")
+	// RevisionKey is the revision of the fetched source.
+	RevisionKey = attribute.Key("source.revision")
+	// ObjectsKey is the number of the downloaded objects.
+	ObjectsKey = attribute.Key("source.objects")
+)
+
+// Options contains the settings of the span export.
+type Options struct {
+	// ServiceName is the name of the service reported with the spans.
+	ServiceName string
+	// Endpoint is the 'host:port' address of the OTLP gRPC collector. The
+	// spans are not exported when empty.
+	Endpoint string
+	// Insecure connects to the collector without TLS.
+	Insecure bool
+	// SampleRatio is the ratio of the traces exported, from 0 to 1. The
+	// traces started by a sampled parent are always exported.
+	SampleRatio float64
+}
+
+// Setup registers a global TracerProvider exporting the spans as configured
+// in the given options, and returns the function flushing the pending spans
+// and stopping the export. It does nothing if the endpoint is not set.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	if opts.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	if opts.SampleRatio < 0 || opts.SampleRatio > 1 {
+		return nil, fmt.Errorf("invalid sample ratio %v: must be between 0 and 1", opts.SampleRatio)
+	}
+
+	clientOpts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(opts.Endpoint)}
+	if opts.Insecure {
+		clientOpts = append(clientOpts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create OTLP exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNameKey.String(opts.ServiceName),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// Start starts a span with the given name and attributes, as a child of the
+// span of the given context if any. The returned span must be ended, with End
+// to record the outcome of the operation.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records the given error on the span if not nil, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// ObjectAttributes returns the attributes of the object with the given kind,
+// namespace and name.
+func ObjectAttributes(kind, namespace, name string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		KindKey.String(kind),
+		NamespaceKey.String(namespace),
+		NameKey.String(name),
+	}
+}
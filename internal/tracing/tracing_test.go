@@ -0,0 +1,73 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup(context.TODO(), Options{})
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	if err := shutdown(context.TODO()); err != nil {
+		t.Errorf("shutdown() error = %v", err)
+	}
+
+	if _, err := Setup(context.TODO(), Options{Endpoint: "localhost:4317", SampleRatio: 2}); err == nil {
+		t.Error("Setup() error = nil, want invalid sample ratio error")
+	}
+}
+
+func TestStart(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	global := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(global)
+
+	ctx, parent := Start(context.TODO(), "reconcile", ObjectAttributes("GitRepository", "default", "podinfo")...)
+	_, child := Start(ctx, "clone")
+	End(child, errors.New("authentication required"))
+	End(parent, nil)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("ended spans = %d, want 2", len(spans))
+	}
+	clone, reconcile := spans[0], spans[1]
+	if clone.Parent().SpanID() != reconcile.SpanContext().SpanID() {
+		t.Errorf("clone span is not a child of the reconcile span")
+	}
+	if clone.Status().Code != codes.Error || clone.Status().Description != "authentication required" {
+		t.Errorf("clone span status = %v, want error", clone.Status())
+	}
+	if reconcile.Status().Code != codes.Unset {
+		t.Errorf("reconcile span status = %v, want unset", reconcile.Status())
+	}
+	if got := len(reconcile.Attributes()); got != 3 {
+		t.Errorf("reconcile span attributes = %d, want 3", got)
+	}
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package main
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"net"
 	"net/http"
@@ -27,13 +29,14 @@ import (
 
 	"github.com/go-logr/logr"
 	flag "github.com/spf13/pflag"
-	"helm.sh/helm/v3/pkg/getter"
+	helmgetter "helm.sh/helm/v3/pkg/getter"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
 	crtlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	"github.com/fluxcd/pkg/runtime/client"
 	"github.com/fluxcd/pkg/runtime/events"
@@ -44,7 +47,23 @@ import (
 	"github.com/fluxcd/pkg/runtime/probes"
 
 	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	sourcev1beta2 "github.com/fluxcd/source-controller/api/v1beta2"
 	"github.com/fluxcd/source-controller/controllers"
+	"github.com/fluxcd/source-controller/internal/eventlimit"
+	"github.com/fluxcd/source-controller/internal/gitcache"
+	"github.com/fluxcd/source-controller/internal/helm"
+	"github.com/fluxcd/source-controller/internal/index"
+	sourcemetrics "github.com/fluxcd/source-controller/internal/metrics"
+	"github.com/fluxcd/source-controller/internal/policy"
+	"github.com/fluxcd/source-controller/internal/rewrite"
+	"github.com/fluxcd/source-controller/internal/sbom"
+	"github.com/fluxcd/source-controller/internal/spiffe"
+	"github.com/fluxcd/source-controller/internal/tracing"
+	"github.com/fluxcd/source-controller/pkg/git/gogit"
+	"github.com/fluxcd/source-controller/pkg/helm/getter"
+	"github.com/fluxcd/source-controller/pkg/retry"
+	"github.com/fluxcd/source-controller/pkg/throttle"
+	"github.com/fluxcd/source-controller/pkg/trust"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -53,8 +72,8 @@ const controllerName = "source-controller"
 var (
 	scheme   = runtime.NewScheme()
 	setupLog = ctrl.Log.WithName("setup")
-	getters  = getter.Providers{
-		getter.Provider{
+	getters  = helmgetter.Providers{
+		helmgetter.Provider{
 			Schemes: []string{"http", "https"},
 			New:     getter.NewHTTPGetter,
 		},
@@ -65,20 +84,79 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(sourcev1.AddToScheme(scheme))
+	utilruntime.Must(sourcev1beta2.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "pack" {
+		if err := runPack(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "pack: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var (
 		metricsAddr           string
 		eventsAddr            string
+		eventsDedupWindow     time.Duration
+		eventsRateLimit       int
+		eventsRateInterval    time.Duration
+		eventsMinSeverity     string
 		healthAddr            string
+		dashboardAddr         string
 		storagePath           string
 		storageAddr           string
 		storageAdvAddr        string
+		storageAdvURL         string
+		storageSigningKeyFile string
+		storageSignedURLTTL   time.Duration
+		storageDedup          bool
+		storageSBOMFormat     string
+		storageFileMode       string
+		storageFileUmask      string
+		storageSkipInvalid    bool
+		storageSymlinkPolicy  string
+		storageHardlinkPolicy string
+		storageVerifyInterval time.Duration
+		storageMaxSize        int64
+		storageAuditLog       bool
+		storageAuditMetrics   bool
+		sshProxy              string
+		spiffeSVIDDir         string
+		caBundleFiles         []string
+		endpointPolicyFile    string
+		urlRewriteFile        string
+		gitCachePath          string
+		gitCacheMaxSize       int64
+		bucketChangesMaxKeys  int
+		bucketChecksumWorkers int
+		downloadBandwidth     int64
+		sourceBandwidth       int64
+		downloadRetries       int
+		downloadRetryBackoff  time.Duration
+		httpHeaders           map[string]string
+		helmIndexMaxSize      int64
+		helmIndexMaxEntries   int
+		artifactServerOnly    bool
+		enableSourceSets      bool
+		conversionWebhook     bool
+		validatingWebhook     bool
+		webhookCertDir        string
 		concurrent            int
+		concurrentGit         int
+		concurrentBucket      int
+		concurrentHelmRepo    int
+		concurrentHelmChart   int
 		requeueDependency     time.Duration
+		intervalJitter        int
 		watchAllNamespaces    bool
+		noCrossNamespaceRefs  bool
+		artifactIndexSize     int
+		otlpEndpoint          string
+		otlpInsecure          bool
+		traceSampleRatio      float64
 		clientOptions         client.Options
 		logOptions            logger.Options
 		leaderElectionOptions leaderelection.Options
@@ -88,17 +166,120 @@ func main() {
 		"The address the metric endpoint binds to.")
 	flag.StringVar(&eventsAddr, "events-addr", envOrDefault("EVENTS_ADDR", ""),
 		"The address of the events receiver.")
+	flag.DurationVar(&eventsDedupWindow, "events-dedup-window", 0,
+		"The duration during which an event identical to the last one emitted for a source, e.g. a repeated fetch failure, is suppressed. Disabled when zero.")
+	flag.IntVar(&eventsRateLimit, "events-rate-limit", 0,
+		"The maximum number of events emitted for a source per --events-rate-limit-interval. Disabled when zero.")
+	flag.DurationVar(&eventsRateInterval, "events-rate-limit-interval", time.Minute,
+		"The interval of the --events-rate-limit.")
+	flag.StringVar(&eventsMinSeverity, "events-min-severity", events.EventSeverityInfo,
+		fmt.Sprintf("The lowest severity of the events emitted for the sources, '%s' or '%s'.", events.EventSeverityInfo, events.EventSeverityError))
 	flag.StringVar(&healthAddr, "health-addr", ":9440", "The address the health endpoint binds to.")
+	flag.StringVar(&dashboardAddr, "dashboard-addr", envOrDefault("DASHBOARD_ADDR", ""),
+		"The address the read-only dashboard of the sources binds to, if set. The dashboard is not authenticated.")
 	flag.StringVar(&storagePath, "storage-path", envOrDefault("STORAGE_PATH", ""),
 		"The local storage path.")
 	flag.StringVar(&storageAddr, "storage-addr", envOrDefault("STORAGE_ADDR", ":9090"),
 		"The address the static file server binds to.")
 	flag.StringVar(&storageAdvAddr, "storage-adv-addr", envOrDefault("STORAGE_ADV_ADDR", ""),
 		"The advertised address of the static file server.")
+	flag.StringVar(&storageAdvURL, "storage-adv-url", envOrDefault("STORAGE_ADV_URL", ""),
+		"The advertised base URL of the static file server, including the scheme and an optional path prefix, e.g. 'https://flux.example.com/artifacts'. Takes precedence over --storage-adv-addr.")
+	flag.StringVar(&storageSigningKeyFile, "storage-signing-key-file", envOrDefault("STORAGE_SIGNING_KEY_FILE", ""),
+		"The path of the file holding the HMAC key the artifact URLs are signed with. When set, the static file server only serves the signed URLs until they expire.")
+	flag.DurationVar(&storageSignedURLTTL, "storage-signed-url-ttl", time.Hour,
+		"The duration the signed artifact URLs are valid for, the sources being reconciled at least every half of it to sign their URLs again.")
+	flag.BoolVar(&storageDedup, "storage-dedup", false,
+		"Store the artifacts content-addressed, as hard links to blobs named after their digest, so the identical artifacts of different sources consume space only once.")
+	flag.StringVar(&storageSBOMFormat, "storage-sbom-format", envOrDefault("STORAGE_SBOM_FORMAT", ""),
+		"The format of the Software Bill of Materials written alongside the artifacts, 'spdx' or 'cyclonedx'. Disabled when empty.")
+	flag.StringVar(&storageFileMode, "storage-file-mode", controllers.ArchiveFileModePreserve,
+		fmt.Sprintf("How the modes of the files in the artifacts are written: '%s' as in the source, '%s' without the setuid, setgid and sticky bits, or '%s' to 0755 for the executables and 0644 otherwise.",
+			controllers.ArchiveFileModePreserve, controllers.ArchiveFileModeStrip, controllers.ArchiveFileModeNormalize))
+	flag.StringVar(&storageFileUmask, "storage-file-umask", "",
+		"The octal permission bits cleared from the modes of the files in the artifacts, e.g. '022'.")
+	flag.BoolVar(&storageSkipInvalid, "storage-skip-invalid-files", false,
+		"Skip the files which cannot be read while archiving the artifacts, e.g. because their path exceeds the limits of the file system, listing them in the skippedFiles of the artifacts instead of failing.")
+	flag.StringVar(&storageSymlinkPolicy, "storage-symlink-policy", controllers.LinkPolicySkip,
+		fmt.Sprintf("How the symbolic links of the sources are archived: '%s' to archive the content of their targets within the source, '%s' to leave them out, or '%s' to fail the artifact.",
+			controllers.LinkPolicyFollow, controllers.LinkPolicySkip, controllers.LinkPolicyFail))
+	flag.StringVar(&storageHardlinkPolicy, "storage-hardlink-policy", controllers.LinkPolicyFollow,
+		fmt.Sprintf("How the files of the sources with more than one hard link are archived: '%s' to archive them if all their links are within the source, '%s' to leave them out, or '%s' to fail the artifact.",
+			controllers.LinkPolicyFollow, controllers.LinkPolicySkip, controllers.LinkPolicyFail))
+	flag.DurationVar(&storageVerifyInterval, "storage-verify-interval", 0,
+		"The interval at which the stored artifacts are re-hashed and compared to their recorded checksum, the corrupted artifacts being removed and their source reconciled again. Disabled when zero.")
+	flag.Int64Var(&storageMaxSize, "storage-max-size", 0,
+		"The size in bytes of the files in storage above which the least recently served artifacts are evicted, except the current artifact of each source. Disabled when zero.")
+	flag.BoolVar(&storageAuditLog, "storage-audit-log", false,
+		"Log each request to the static file server with the client IP, the requested path, the response status and the number of bytes served.")
+	flag.BoolVar(&storageAuditMetrics, "storage-audit-metrics", false,
+		"Count the artifact downloads from the static file server and the bytes served in the gotk_artifact_downloads_total and gotk_artifact_download_bytes_total metrics, labeled with the source.")
+	flag.StringVar(&sshProxy, "ssh-proxy", envOrDefault("SSH_PROXY", ""),
+		"The SOCKS5 proxy URL used for the SSH Git repositories, in the 'socks5://host:port' format.")
+	flag.StringVar(&spiffeSVIDDir, "spiffe-svid-dir", envOrDefault("SPIFFE_SVID_DIR", ""),
+		fmt.Sprintf("The directory of the '%s' and '%s' files of the SPIFFE X.509 SVID presented as the TLS client certificate to the HTTPS Git and Helm repositories.", spiffe.SVIDFile, spiffe.SVIDKeyFile))
+	flag.StringSliceVar(&caBundleFiles, "ca-bundle-file", nil,
+		"The PEM files, e.g. mounted from a ConfigMap, of the CA certificates trusted in addition to the system ones to verify the HTTPS Git repositories, Buckets, Helm repositories and registries. The files are loaded again when they change, which is checked at most every 10 seconds.")
+	flag.StringVar(&endpointPolicyFile, "endpoint-policy-file", envOrDefault("ENDPOINT_POLICY_FILE", ""),
+		"The path of the YAML file, e.g. mounted from a ConfigMap, holding the policy restricting the endpoints the sources in each namespace may reference.")
+	flag.StringVar(&urlRewriteFile, "url-rewrite-file", envOrDefault("URL_REWRITE_FILE", ""),
+		"The path of the YAML file, e.g. mounted from a ConfigMap, holding the rules rewriting the URLs of the sources before they are fetched, e.g. to the mirrors of an air-gapped cluster.")
+	flag.StringVar(&gitCachePath, "git-cache-path", envOrDefault("GIT_CACHE_PATH", ""),
+		"The directory of the persistent bare repositories the GitRepositories are fetched into incrementally across reconciles, instead of cloned every time. Disabled when empty.")
+	flag.Int64Var(&gitCacheMaxSize, "git-cache-max-size", 0,
+		"The size in bytes of the Git cache above which the least recently used repositories are evicted. Disabled when zero.")
+	flag.IntVar(&bucketChangesMaxKeys, "bucket-changes-max-keys", 10,
+		"The maximum number of object keys listed in the events summarizing the objects added, removed and modified between two artifacts of a Bucket.")
+	flag.IntVar(&bucketChecksumWorkers, "bucket-checksum-workers", 1,
+		"The number of files hashed concurrently to compute the revision of a Bucket from its content, e.g. the number of CPUs of the controller.")
+	flag.Int64Var(&downloadBandwidth, "download-bandwidth-limit", 0,
+		"The bandwidth in bytes per second shared by the downloads of all the Buckets and the HTTP/S clones of all the GitRepositories. Disabled when zero.")
+	flag.Int64Var(&sourceBandwidth, "source-download-bandwidth-limit", 0,
+		"The bandwidth in bytes per second of the downloads of each Bucket and the HTTP/S clones of each GitRepository. Disabled when zero.")
+	flag.IntVar(&downloadRetries, "download-retries", 2,
+		"The number of retries of the object downloads of the Buckets and of the index and chart downloads of the Helm repositories failing with a transient network error. Disabled when zero.")
+	flag.DurationVar(&downloadRetryBackoff, "download-retry-backoff", time.Second,
+		"The delay before the first retry of a download, doubled before every next retry.")
+	flag.Int64Var(&helmIndexMaxSize, "helm-index-max-size", helm.DefaultIndexMaxSize,
+		"The maximum size in bytes of the indexes of the Helm repositories.")
+	flag.IntVar(&helmIndexMaxEntries, "helm-index-max-entries", helm.DefaultIndexMaxEntries,
+		"The maximum number of chart versions of the indexes of the Helm repositories.")
+	flag.StringToStringVar(&httpHeaders, "http-headers", nil,
+		"The extra headers sent with the HTTP requests to the Git and Helm repositories and the buckets, unless overridden in the spec of the sources, e.g. 'User-Agent=flux/prod-eu,X-Cluster=prod-eu'.")
 	flag.IntVar(&concurrent, "concurrent", 2, "The number of concurrent reconciles per controller.")
+	flag.IntVar(&concurrentGit, "concurrent-git", 0,
+		"The number of concurrent GitRepository reconciles, if set to 0 the --concurrent value is used.")
+	flag.IntVar(&concurrentBucket, "concurrent-bucket", 0,
+		"The number of concurrent Bucket reconciles, if set to 0 the --concurrent value is used.")
+	flag.IntVar(&concurrentHelmRepo, "concurrent-helmrepository", 0,
+		"The number of concurrent HelmRepository reconciles, if set to 0 the --concurrent value is used.")
+	flag.IntVar(&concurrentHelmChart, "concurrent-helmchart", 0,
+		"The number of concurrent HelmChart reconciles, if set to 0 the --concurrent value is used.")
 	flag.BoolVar(&watchAllNamespaces, "watch-all-namespaces", true,
 		"Watch for custom resources in all namespaces, if set to false it will only watch the runtime namespace.")
+	flag.BoolVar(&noCrossNamespaceRefs, "no-cross-namespace-refs", true,
+		"Refuse the references of the HelmCharts to the sources in other namespaces, if set to false they are allowed and audited with events.")
 	flag.DurationVar(&requeueDependency, "requeue-dependency", 30*time.Second, "The interval at which failing dependencies are reevaluated.")
+	flag.IntVar(&intervalJitter, "interval-jitter-percentage", 0,
+		fmt.Sprintf("The maximum percentage of the interval of a source its reconciliations are randomly advanced or delayed by, from 0 to %d, for the sources created at the same time not to be reconciled in the same second. Disabled when zero.", controllers.MaxIntervalJitterPercentage))
+	flag.IntVar(&artifactIndexSize, "artifact-index-size", 0,
+		fmt.Sprintf("The maximum number of sources listed by the artifact index served on %s, if set to 0 the index is disabled.", index.Path))
+	flag.BoolVar(&artifactServerOnly, "artifact-server-only", false,
+		"Only serve the artifacts of the storage path, without leader election and reconciliation. The storage must be shared with the replica running the reconcilers.")
+	flag.BoolVar(&enableSourceSets, "enable-source-sets", false,
+		"Enable the SourceSet controller, which summarizes the status of label-selected groups of sources.")
+	flag.BoolVar(&conversionWebhook, "enable-conversion-webhook", false,
+		"Serve the webhook converting the GitRepositories and Buckets between the v1beta1 and v1beta2 API versions on port 9443.")
+	flag.BoolVar(&validatingWebhook, "enable-validating-webhook", false,
+		"Serve the webhook rejecting the sources referencing an endpoint not allowed by the endpoint policy, and the Buckets with an invalid spec, on port 9443.")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "",
+		"The directory holding the 'tls.crt' and 'tls.key' files of the serving certificate of the webhooks, defaults to the controller-runtime one.")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", envOrDefault("OTLP_ENDPOINT", ""),
+		"The 'host:port' address of the OTLP gRPC collector the traces of the reconciliations are exported to, if set.")
+	flag.BoolVar(&otlpInsecure, "otlp-insecure", false,
+		"Connect to the OTLP collector without TLS.")
+	flag.Float64Var(&traceSampleRatio, "trace-sample-ratio", 1,
+		"The ratio of the reconciliation traces exported to the OTLP collector, from 0 to 1.")
 	clientOptions.BindFlags(flag.CommandLine)
 	logOptions.BindFlags(flag.CommandLine)
 	leaderElectionOptions.BindFlags(flag.CommandLine)
@@ -106,6 +287,15 @@ func main() {
 
 	ctrl.SetLogger(logger.NewLogger(logOptions))
 
+	if intervalJitter < 0 || intervalJitter > controllers.MaxIntervalJitterPercentage {
+		setupLog.Error(fmt.Errorf("must be between 0 and %d, got %d", controllers.MaxIntervalJitterPercentage, intervalJitter), "invalid interval jitter percentage")
+		os.Exit(1)
+	}
+	if bucketChecksumWorkers < 1 {
+		setupLog.Error(fmt.Errorf("must be at least 1, got %d", bucketChecksumWorkers), "invalid bucket checksum workers")
+		os.Exit(1)
+	}
+
 	var eventRecorder *events.Recorder
 	if eventsAddr != "" {
 		if er, err := events.NewRecorder(eventsAddr, controllerName); err != nil {
@@ -116,6 +306,8 @@ func main() {
 		}
 	}
 
+	shutdownTracing := mustInitTracing(otlpEndpoint, otlpInsecure, traceSampleRatio, setupLog)
+
 	metricsRecorder := metrics.NewRecorder()
 	crtlmetrics.Registry.MustRegister(metricsRecorder.Collectors()...)
 
@@ -130,7 +322,8 @@ func main() {
 		MetricsBindAddress:            metricsAddr,
 		HealthProbeBindAddress:        healthAddr,
 		Port:                          9443,
-		LeaderElection:                leaderElectionOptions.Enable,
+		CertDir:                       webhookCertDir,
+		LeaderElection:                leaderElectionOptions.Enable && !artifactServerOnly,
 		LeaderElectionReleaseOnCancel: leaderElectionOptions.ReleaseOnCancel,
 		LeaseDuration:                 &leaderElectionOptions.LeaseDuration,
 		RenewDeadline:                 &leaderElectionOptions.RenewDeadline,
@@ -150,72 +343,225 @@ func main() {
 	if storageAdvAddr == "" {
 		storageAdvAddr = determineAdvStorageAddr(storageAddr, setupLog)
 	}
-	storage := mustInitStorage(storagePath, storageAdvAddr, setupLog)
-
-	if err = (&controllers.GitRepositoryReconciler{
-		Client:                mgr.GetClient(),
-		Scheme:                mgr.GetScheme(),
-		Storage:               storage,
-		EventRecorder:         mgr.GetEventRecorderFor(controllerName),
-		ExternalEventRecorder: eventRecorder,
-		MetricsRecorder:       metricsRecorder,
-	}).SetupWithManagerAndOptions(mgr, controllers.GitRepositoryReconcilerOptions{
-		MaxConcurrentReconciles:   concurrent,
-		DependencyRequeueInterval: requeueDependency,
-	}); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", sourcev1.GitRepositoryKind)
-		os.Exit(1)
+	storage := mustInitStorage(storagePath, storageAdvAddr, storageAdvURL, storageSigningKeyFile, storageSignedURLTTL, storageDedup, storageSBOMFormat, storageFileMode, storageFileUmask, storageSkipInvalid, storageSymlinkPolicy, storageHardlinkPolicy, setupLog)
+
+	operationsRecorder := sourcemetrics.NewRecorder(storage.BasePath)
+	crtlmetrics.Registry.MustRegister(operationsRecorder.Collectors()...)
+
+	mustInitTrustBundle(caBundleFiles, setupLog)
+	clientIdentity := mustInitClientIdentity(spiffeSVIDDir, setupLog)
+	endpointPolicy := mustLoadEndpointPolicy(endpointPolicyFile, setupLog)
+	urlRewriter := mustLoadURLRewriter(urlRewriteFile, setupLog)
+	eventLimiter := mustInitEventLimiter(eventlimit.Options{
+		DedupWindow: eventsDedupWindow,
+		MaxEvents:   eventsRateLimit,
+		Interval:    eventsRateInterval,
+		MinSeverity: eventsMinSeverity,
+	}, setupLog)
+
+	downloadLimiter := throttle.NewLimiter(downloadBandwidth)
+	downloadRetry := retry.NewPolicy(downloadRetries+1, downloadRetryBackoff)
+	helmIndexLimits := helm.IndexLimits{MaxSize: helmIndexMaxSize, MaxEntries: helmIndexMaxEntries}
+
+	var artifactIndex *index.Index
+	if artifactIndexSize > 0 && !artifactServerOnly {
+		artifactIndex = index.New(artifactIndexSize)
 	}
-	if err = (&controllers.HelmRepositoryReconciler{
-		Client:                mgr.GetClient(),
-		Scheme:                mgr.GetScheme(),
-		Storage:               storage,
-		Getters:               getters,
-		EventRecorder:         mgr.GetEventRecorderFor(controllerName),
-		ExternalEventRecorder: eventRecorder,
-		MetricsRecorder:       metricsRecorder,
-	}).SetupWithManagerAndOptions(mgr, controllers.HelmRepositoryReconcilerOptions{
-		MaxConcurrentReconciles: concurrent,
-	}); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", sourcev1.HelmRepositoryKind)
-		os.Exit(1)
+
+	var gitCache *gitcache.Cache
+	if gitCachePath != "" && !artifactServerOnly {
+		gitCache = mustInitGitCache(gitCachePath, gitCacheMaxSize, setupLog)
 	}
-	if err = (&controllers.HelmChartReconciler{
-		Client:                mgr.GetClient(),
-		Scheme:                mgr.GetScheme(),
-		Storage:               storage,
-		Getters:               getters,
-		EventRecorder:         mgr.GetEventRecorderFor(controllerName),
-		ExternalEventRecorder: eventRecorder,
-		MetricsRecorder:       metricsRecorder,
-	}).SetupWithManagerAndOptions(mgr, controllers.HelmChartReconcilerOptions{
-		MaxConcurrentReconciles: concurrent,
-	}); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", sourcev1.HelmChartKind)
-		os.Exit(1)
+
+	if artifactServerOnly {
+		setupLog.Info("running in artifact server only mode, reconcilers are disabled")
+	} else {
+		if err = (&controllers.GitRepositoryReconciler{
+			Client:                mgr.GetClient(),
+			Scheme:                mgr.GetScheme(),
+			Storage:               storage,
+			EventRecorder:         mgr.GetEventRecorderFor(controllerName),
+			ExternalEventRecorder: eventRecorder,
+			MetricsRecorder:       metricsRecorder,
+			OperationsRecorder:    operationsRecorder,
+			ArtifactIndex:         artifactIndex,
+			EndpointPolicy:        endpointPolicy,
+			URLRewriter:           urlRewriter,
+			EventLimiter:          eventLimiter,
+			GitCache:              gitCache,
+			SSHProxy:              sshProxy,
+			HTTPHeaders:           httpHeaders,
+			DownloadLimiter:       downloadLimiter,
+			SourceBandwidthLimit:  sourceBandwidth,
+		}).SetupWithManagerAndOptions(mgr, controllers.GitRepositoryReconcilerOptions{
+			MaxConcurrentReconciles:   concurrencyOrDefault(concurrentGit, concurrent),
+			DependencyRequeueInterval: requeueDependency,
+			IntervalJitterPercentage:  intervalJitter,
+		}); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", sourcev1.GitRepositoryKind)
+			os.Exit(1)
+		}
+		if err = (&controllers.HelmRepositoryReconciler{
+			Client:                mgr.GetClient(),
+			Scheme:                mgr.GetScheme(),
+			Storage:               storage,
+			Getters:               getters,
+			EventRecorder:         mgr.GetEventRecorderFor(controllerName),
+			ExternalEventRecorder: eventRecorder,
+			MetricsRecorder:       metricsRecorder,
+			OperationsRecorder:    operationsRecorder,
+			ArtifactIndex:         artifactIndex,
+			EndpointPolicy:        endpointPolicy,
+			URLRewriter:           urlRewriter,
+			EventLimiter:          eventLimiter,
+			ClientIdentity:        clientIdentity,
+			HTTPHeaders:           httpHeaders,
+			DownloadRetry:         downloadRetry,
+			IndexLimits:           helmIndexLimits,
+		}).SetupWithManagerAndOptions(mgr, controllers.HelmRepositoryReconcilerOptions{
+			MaxConcurrentReconciles:   concurrencyOrDefault(concurrentHelmRepo, concurrent),
+			DependencyRequeueInterval: requeueDependency,
+			IntervalJitterPercentage:  intervalJitter,
+		}); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", sourcev1.HelmRepositoryKind)
+			os.Exit(1)
+		}
+		if err = (&controllers.HelmChartReconciler{
+			Client:                mgr.GetClient(),
+			Scheme:                mgr.GetScheme(),
+			Storage:               storage,
+			Getters:               getters,
+			EventRecorder:         mgr.GetEventRecorderFor(controllerName),
+			ExternalEventRecorder: eventRecorder,
+			MetricsRecorder:       metricsRecorder,
+			OperationsRecorder:    operationsRecorder,
+			ArtifactIndex:         artifactIndex,
+			EndpointPolicy:        endpointPolicy,
+			URLRewriter:           urlRewriter,
+			EventLimiter:          eventLimiter,
+			ClientIdentity:        clientIdentity,
+			HTTPHeaders:           httpHeaders,
+			NoCrossNamespaceRefs:  noCrossNamespaceRefs,
+			DownloadRetry:         downloadRetry,
+			IndexLimits:           helmIndexLimits,
+		}).SetupWithManagerAndOptions(mgr, controllers.HelmChartReconcilerOptions{
+			MaxConcurrentReconciles:   concurrencyOrDefault(concurrentHelmChart, concurrent),
+			DependencyRequeueInterval: requeueDependency,
+			IntervalJitterPercentage:  intervalJitter,
+		}); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", sourcev1.HelmChartKind)
+			os.Exit(1)
+		}
+		if err = (&controllers.BucketReconciler{
+			Client:                mgr.GetClient(),
+			Scheme:                mgr.GetScheme(),
+			Storage:               storage,
+			EventRecorder:         mgr.GetEventRecorderFor(controllerName),
+			ExternalEventRecorder: eventRecorder,
+			MetricsRecorder:       metricsRecorder,
+			OperationsRecorder:    operationsRecorder,
+			ArtifactIndex:         artifactIndex,
+			EndpointPolicy:        endpointPolicy,
+			URLRewriter:           urlRewriter,
+			EventLimiter:          eventLimiter,
+			HTTPHeaders:           httpHeaders,
+			ChangesMaxKeys:        bucketChangesMaxKeys,
+			DownloadLimiter:       downloadLimiter,
+			SourceBandwidthLimit:  sourceBandwidth,
+			DownloadRetry:         downloadRetry,
+		}).SetupWithManagerAndOptions(mgr, controllers.BucketReconcilerOptions{
+			MaxConcurrentReconciles:   concurrencyOrDefault(concurrentBucket, concurrent),
+			DependencyRequeueInterval: requeueDependency,
+			IntervalJitterPercentage:  intervalJitter,
+			ChecksumWorkers:           bucketChecksumWorkers,
+		}); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Bucket")
+			os.Exit(1)
+		}
+		if storageVerifyInterval > 0 {
+			if err = mgr.Add(&controllers.ArtifactVerifier{
+				Client:             mgr.GetClient(),
+				Storage:            storage,
+				EventRecorder:      mgr.GetEventRecorderFor(controllerName),
+				OperationsRecorder: operationsRecorder,
+				Log:                ctrl.Log.WithName("artifact-verifier"),
+				Interval:           storageVerifyInterval,
+			}); err != nil {
+				setupLog.Error(err, "unable to create artifact verifier")
+				os.Exit(1)
+			}
+		}
+		if storageMaxSize > 0 {
+			if err = mgr.Add(&controllers.ArtifactEvictor{
+				Client:             mgr.GetClient(),
+				Storage:            storage,
+				OperationsRecorder: operationsRecorder,
+				Log:                ctrl.Log.WithName("artifact-evictor"),
+				MaxSize:            storageMaxSize,
+				Interval:           time.Minute,
+			}); err != nil {
+				setupLog.Error(err, "unable to create artifact evictor")
+				os.Exit(1)
+			}
+		}
+		if enableSourceSets {
+			if err = (&controllers.SourceSetReconciler{
+				Client: mgr.GetClient(),
+				Scheme: mgr.GetScheme(),
+			}).SetupWithManagerAndOptions(mgr, controllers.SourceSetReconcilerOptions{
+				MaxConcurrentReconciles: concurrent,
+			}); err != nil {
+				setupLog.Error(err, "unable to create controller", "controller", sourcev1.SourceSetKind)
+				os.Exit(1)
+			}
+		}
 	}
-	if err = (&controllers.BucketReconciler{
-		Client:                mgr.GetClient(),
-		Scheme:                mgr.GetScheme(),
-		Storage:               storage,
-		EventRecorder:         mgr.GetEventRecorderFor(controllerName),
-		ExternalEventRecorder: eventRecorder,
-		MetricsRecorder:       metricsRecorder,
-	}).SetupWithManagerAndOptions(mgr, controllers.BucketReconcilerOptions{
-		MaxConcurrentReconciles: concurrent,
-	}); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Bucket")
-		os.Exit(1)
+	if conversionWebhook {
+		for _, obj := range []runtime.Object{&sourcev1beta2.GitRepository{}, &sourcev1beta2.Bucket{}} {
+			if err = ctrl.NewWebhookManagedBy(mgr).For(obj).Complete(); err != nil {
+				setupLog.Error(err, "unable to create conversion webhook", "object", fmt.Sprintf("%T", obj))
+				os.Exit(1)
+			}
+		}
+	}
+	if validatingWebhook {
+		mgr.GetWebhookServer().Register(controllers.SourceValidatorPath, &webhook.Admission{
+			Handler: &controllers.SourceValidator{EndpointPolicy: endpointPolicy},
+		})
+	}
+	if dashboardAddr != "" {
+		if err = mgr.Add(&controllers.SourceDashboard{
+			Client: mgr.GetClient(),
+			Log:    ctrl.Log.WithName("source-dashboard"),
+			Addr:   dashboardAddr,
+		}); err != nil {
+			setupLog.Error(err, "unable to create source dashboard")
+			os.Exit(1)
+		}
 	}
 	// +kubebuilder:scaffold:builder
 
 	go func() {
 		// Block until our controller manager is elected leader. We presume our
 		// entire process will terminate if we lose leadership, so we don't need
-		// to handle that.
+		// to handle that. In artifact server only mode, leader election is
+		// disabled and the channel is closed right away.
 		<-mgr.Elected()
 
-		startFileServer(storage.BasePath, storageAddr, setupLog)
+		var apiHandler http.Handler
+		if artifactIndex != nil {
+			apiHandler = index.NewHandler(artifactIndex, &index.ReviewAuthorizer{Client: mgr.GetClient()},
+				ctrl.Log.WithName("artifact-index"))
+		}
+		var auditLog logr.Logger
+		if storageAuditLog {
+			auditLog = ctrl.Log.WithName("artifact-audit")
+		}
+		var auditRecorder *sourcemetrics.Recorder
+		if storageAuditMetrics {
+			auditRecorder = operationsRecorder
+		}
+		startFileServer(storage, storageAddr, apiHandler, auditLog, auditRecorder, setupLog)
 	}()
 
 	setupLog.Info("starting manager")
@@ -223,19 +569,28 @@ func main() {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
+	shutdownTracing()
 }
 
-func startFileServer(path string, address string, l logr.Logger) {
+func startFileServer(storage *controllers.Storage, address string, apiHandler http.Handler, auditLog logr.Logger,
+	auditRecorder *sourcemetrics.Recorder, l logr.Logger) {
 	l.Info("starting file server")
-	fs := http.FileServer(http.Dir(path))
-	http.Handle("/", fs)
+	fs := http.FileServer(http.Dir(storage.BasePath))
+	var h http.Handler = storage.SignedURLHandler(storage.ArtifactHandler(fs))
+	if auditLog != nil || auditRecorder != nil {
+		h = controllers.AuditHandler(h, auditLog, auditRecorder)
+	}
+	http.Handle("/", h)
+	if apiHandler != nil {
+		http.Handle(index.Path, apiHandler)
+	}
 	err := http.ListenAndServe(address, nil)
 	if err != nil {
 		l.Error(err, "file server error")
 	}
 }
 
-func mustInitStorage(path string, storageAdvAddr string, l logr.Logger) *controllers.Storage {
+func mustInitStorage(path string, storageAdvAddr string, storageAdvURL string, signingKeyFile string, signedURLTTL time.Duration, dedup bool, sbomFormat, fileMode, fileUmask string, skipInvalidFiles bool, symlinkPolicy, hardlinkPolicy string, l logr.Logger) *controllers.Storage {
 	if path == "" {
 		p, _ := os.Getwd()
 		path = filepath.Join(p, "bin")
@@ -248,9 +603,152 @@ func mustInitStorage(path string, storageAdvAddr string, l logr.Logger) *control
 		os.Exit(1)
 	}
 
+	if storageAdvURL != "" {
+		if err := storage.SetBaseURL(storageAdvURL); err != nil {
+			l.Error(err, "unable to initialise storage")
+			os.Exit(1)
+		}
+	}
+
+	if signingKeyFile != "" {
+		key, err := os.ReadFile(signingKeyFile)
+		if err != nil {
+			l.Error(err, "unable to read storage signing key")
+			os.Exit(1)
+		}
+		key = bytes.TrimSpace(key)
+		if len(key) == 0 {
+			l.Error(fmt.Errorf("'%s' is empty", signingKeyFile), "unable to read storage signing key")
+			os.Exit(1)
+		}
+		storage.SigningKey = key
+		storage.SignedURLTTL = signedURLTTL
+	}
+
+	storage.Dedup = dedup
+
+	if sbomFormat != "" {
+		if _, err := sbom.Ext(sbomFormat); err != nil {
+			l.Error(err, "unable to initialise storage")
+			os.Exit(1)
+		}
+		storage.SBOMFormat = sbomFormat
+	}
+
+	if err := storage.SetFileMode(fileMode, fileUmask); err != nil {
+		l.Error(err, "unable to initialise storage")
+		os.Exit(1)
+	}
+	storage.SkipInvalidFiles = skipInvalidFiles
+
+	if err := storage.SetLinkPolicies(symlinkPolicy, hardlinkPolicy); err != nil {
+		l.Error(err, "unable to initialise storage")
+		os.Exit(1)
+	}
 	return storage
 }
 
+func mustInitTracing(endpoint string, insecure bool, sampleRatio float64, l logr.Logger) func() {
+	shutdown, err := tracing.Setup(context.Background(), tracing.Options{
+		ServiceName: controllerName,
+		Endpoint:    endpoint,
+		Insecure:    insecure,
+		SampleRatio: sampleRatio,
+	})
+	if err != nil {
+		l.Error(err, "unable to initialise tracing")
+		os.Exit(1)
+	}
+	if endpoint != "" {
+		l.Info("exporting traces to OTLP collector", "endpoint", endpoint)
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			l.Error(err, "unable to flush traces")
+		}
+	}
+}
+
+func mustInitClientIdentity(svidDir string, l logr.Logger) *spiffe.X509SVIDSource {
+	if svidDir == "" {
+		return nil
+	}
+
+	source, err := spiffe.NewX509SVIDSource(svidDir)
+	if err != nil {
+		l.Error(err, "unable to initialise client identity")
+		os.Exit(1)
+	}
+	id, _ := source.ID()
+	l.Info("presenting SPIFFE X.509 SVID as TLS client certificate", "spiffeID", id)
+
+	gogit.InstallClientCertificate(source.GetClientCertificate)
+	return source
+}
+
+func mustInitTrustBundle(files []string, l logr.Logger) {
+	if len(files) == 0 {
+		return
+	}
+
+	bundle, err := trust.NewBundle(files...)
+	if err != nil {
+		l.Error(err, "unable to load CA bundle")
+		os.Exit(1)
+	}
+	l.Info("trusting the CA bundle in addition to the system CA certificates", "files", files)
+	trust.SetDefault(bundle)
+}
+
+func mustLoadEndpointPolicy(policyFile string, l logr.Logger) *policy.Policy {
+	if policyFile == "" {
+		return nil
+	}
+
+	p, err := policy.Load(policyFile)
+	if err != nil {
+		l.Error(err, "unable to load endpoint policy")
+		os.Exit(1)
+	}
+	l.Info("restricting the source endpoints", "policyFile", policyFile, "rules", len(p.Rules))
+	return p
+}
+
+func mustLoadURLRewriter(rewriteFile string, l logr.Logger) *rewrite.Rewriter {
+	if rewriteFile == "" {
+		return nil
+	}
+
+	r, err := rewrite.Load(rewriteFile)
+	if err != nil {
+		l.Error(err, "unable to load URL rewrite rules")
+		os.Exit(1)
+	}
+	l.Info("rewriting the source URLs", "rewriteFile", rewriteFile, "rules", len(r.Rules))
+	return r
+}
+
+func mustInitEventLimiter(opts eventlimit.Options, l logr.Logger) *eventlimit.Limiter {
+	limiter, err := eventlimit.New(opts)
+	if err != nil {
+		l.Error(err, "unable to initialise event limiter")
+		os.Exit(1)
+	}
+	return limiter
+}
+
+func mustInitGitCache(path string, maxSize int64, l logr.Logger) *gitcache.Cache {
+	cache, err := gitcache.New(path, maxSize)
+	if err != nil {
+		l.Error(err, "unable to initialise Git cache")
+		os.Exit(1)
+	}
+	l.Info("caching the Git repositories", "path", path, "maxSize", maxSize)
+	return cache
+}
+
 func determineAdvStorageAddr(storageAddr string, l logr.Logger) string {
 	// TODO(hidde): remove next MINOR prerelease as it can be passed in using
 	//  Kubernetes' substitution.
@@ -282,6 +780,15 @@ func determineAdvStorageAddr(storageAddr string, l logr.Logger) string {
 	return net.JoinHostPort(host, port)
 }
 
+// concurrencyOrDefault returns the given number of concurrent reconciles of a
+// kind, or the default number if not set.
+func concurrencyOrDefault(n, defaultValue int) int {
+	if n > 0 {
+		return n
+	}
+	return defaultValue
+}
+
 func envOrDefault(envName, defaultValue string) string {
 	ret := os.Getenv(envName)
 	if ret != "" {
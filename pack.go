@@ -0,0 +1,204 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"github.com/fluxcd/source-controller/controllers"
+)
+
+// runPack implements the 'pack' subcommand, which fetches the GitRepositories
+// and Buckets of a YAML file and writes their artifacts in a local directory,
+// without a Kubernetes cluster. The Secrets the sources refer to are read
+// from the same file.
+func runPack(args []string) error {
+	var (
+		file      string
+		outputDir string
+		namespace string
+		list      bool
+	)
+	fs := flag.NewFlagSet("pack", flag.ContinueOnError)
+	fs.StringVarP(&file, "file", "f", "", "The YAML file of the sources and their Secrets, '-' for the standard input.")
+	fs.StringVarP(&outputDir, "output-dir", "o", ".", "The directory the artifacts are written to.")
+	fs.StringVarP(&namespace, "namespace", "n", "default", "The namespace of the objects without one.")
+	fs.BoolVar(&list, "list", false, "List the files of the artifacts, e.g. to check the effect of the '.sourceignore' files.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if file == "" {
+		return errors.New("the --file flag is required")
+	}
+
+	objects, err := readObjects(file, namespace)
+	if err != nil {
+		return err
+	}
+	storagePath, err := os.MkdirTemp("", "source-controller-pack")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(storagePath)
+	storage, err := controllers.NewStorage(storagePath, "localhost", 5*time.Minute)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return err
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+	var packed int
+	for _, obj := range objects {
+		switch obj.(type) {
+		case *sourcev1.GitRepository, *sourcev1.Bucket:
+		default:
+			continue
+		}
+		kind := obj.GetObjectKind().GroupVersionKind().Kind
+		artifact, err := controllers.Pack(context.Background(), c, scheme, storage, obj)
+		if err != nil {
+			return fmt.Errorf("%s '%s/%s': %w", kind, obj.GetNamespace(), obj.GetName(), err)
+		}
+		output := filepath.Join(outputDir, fmt.Sprintf("%s-%s-%s", strings.ToLower(kind), obj.GetName(), filepath.Base(artifact.Path)))
+		if err := copyFile(storage.LocalPath(*artifact), output); err != nil {
+			return err
+		}
+		fmt.Printf("%s/%s/%s\n  revision: %s\n  checksum: %s\n  artifact: %s\n",
+			kind, obj.GetNamespace(), obj.GetName(), artifact.Revision, artifact.Checksum, output)
+		for _, skipped := range artifact.SkippedFiles {
+			fmt.Printf("  skipped: %s\n", skipped)
+		}
+		if list {
+			if err := listTarball(output, os.Stdout); err != nil {
+				return err
+			}
+		}
+		packed++
+	}
+	if packed == 0 {
+		return fmt.Errorf("no GitRepository or Bucket found in '%s'", file)
+	}
+	return nil
+}
+
+// readObjects decodes the objects of the given YAML file, setting the given
+// namespace on those without one.
+func readObjects(file, namespace string) ([]client.Object, error) {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	decoder := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+	reader := yaml.NewYAMLReader(bufio.NewReader(r))
+	var objects []client.Object
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read '%s': %w", file, err)
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		decoded, _, err := decoder.Decode(doc, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode '%s': %w", file, err)
+		}
+		obj, ok := decoded.(client.Object)
+		if !ok {
+			return nil, fmt.Errorf("unable to decode '%s': unsupported %T", file, decoded)
+		}
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(namespace)
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// copyFile copies the file at the given source path to the destination path.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// listTarball writes the names of the regular files of the given gzip
+// tarball to the given writer.
+func listTarball(path string, w io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unable to list '%s': %w", path, err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			fmt.Fprintf(w, "  - %s\n", header.Name)
+		}
+	}
+}
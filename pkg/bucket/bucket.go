@@ -0,0 +1,553 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package bucket fetches the content of object storage buckets the same way
+// the source-controller does for Bucket sources. The provider specific
+// clients are available in the sub packages.
+package bucket
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/fluxcd/source-controller/pkg/retry"
+	"github.com/fluxcd/source-controller/pkg/sourceignore"
+)
+
+// MetadataFile is the name of the file in the root of the fetched directory
+// holding the metadata of the objects, if enabled in the FetchOptions.
+const MetadataFile = ".source-metadata.json"
+
+// tracer records the spans of the list and download phases of Fetch.
+var tracer = otel.Tracer("github.com/fluxcd/source-controller/pkg/bucket")
+
+// ObjectInfo holds the metadata of an object.
+type ObjectInfo struct {
+	// Key is the name of the object in the bucket.
+	Key string `json:"key"`
+	// ContentType is the MIME type of the object content.
+	ContentType string `json:"contentType,omitempty"`
+	// LastModified is the time the object was last modified.
+	LastModified time.Time `json:"lastModified"`
+	// Metadata holds the user defined metadata of the object.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Metadata is the content of the MetadataFile.
+type Metadata struct {
+	// Objects holds the metadata of the fetched objects, sorted by key.
+	Objects []ObjectInfo `json:"objects"`
+}
+
+// Client is a client for an object storage bucket.
+type Client interface {
+	// BucketExists returns true if the bucket with the given name exists.
+	BucketExists(ctx context.Context, bucketName string) (bool, error)
+	// FGetObject downloads the object from the bucket to the local path,
+	// creating any missing parent directories, and returns its metadata.
+	FGetObject(ctx context.Context, bucketName, objectName, localPath string) (ObjectInfo, error)
+	// ListObjects calls fn with the name and the ETag of every object in the
+	// bucket, skipping directories. It stops at the first error returned by
+	// fn.
+	ListObjects(ctx context.Context, bucketName string, fn func(objectName, etag string) error) error
+	// ObjectIsNotFound returns true if the given error is returned for an
+	// object that does not exist.
+	ObjectIsNotFound(err error) bool
+}
+
+// ListOptions are the options for listing a page of the objects of a bucket.
+type ListOptions struct {
+	// StartAfter lists the objects whose key is after the given key in
+	// lexicographical order.
+	StartAfter string
+	// ContinuationToken is the NextContinuationToken of the previous page,
+	// to list the next page.
+	ContinuationToken string
+	// MaxKeys is the maximum number of objects of the page, defaults to the
+	// provider default when 0.
+	MaxKeys int
+}
+
+// ObjectEntry is an object listed in an ObjectsPage.
+type ObjectEntry struct {
+	// Key is the name of the object in the bucket.
+	Key string
+	// ETag is the ETag of the object, if any.
+	ETag string
+}
+
+// ObjectsPage is a page of the objects of a bucket.
+type ObjectsPage struct {
+	// Objects are the objects of the page, except directories.
+	Objects []ObjectEntry
+	// NextContinuationToken is the token to list the next page with, empty
+	// for the last page.
+	NextContinuationToken string
+}
+
+// PagedClient is implemented by the clients of the providers listing the
+// objects of a bucket page by page.
+type PagedClient interface {
+	// ListObjectsPage lists the page of the objects of the bucket with the
+	// given name selected by the given options.
+	ListObjectsPage(ctx context.Context, bucketName string, opts ListOptions) (ObjectsPage, error)
+}
+
+// ListPages calls fn with the name and the ETag of every object of the
+// bucket, listing the pages with the given client from the given options
+// until the last one. It stops at the first error returned by fn or the
+// client, or if a page does not advance the continuation token.
+func ListPages(ctx context.Context, client PagedClient, bucketName string, opts ListOptions, fn func(objectName, etag string) error) error {
+	for {
+		page, err := client.ListObjectsPage(ctx, bucketName, opts)
+		if err != nil {
+			return err
+		}
+		for _, object := range page.Objects {
+			if err := fn(object.Key, object.ETag); err != nil {
+				return err
+			}
+		}
+		if page.NextContinuationToken == "" {
+			return nil
+		}
+		if page.NextContinuationToken == opts.ContinuationToken {
+			return fmt.Errorf("listing objects from bucket '%s' does not advance past continuation token '%s'",
+				bucketName, page.NextContinuationToken)
+		}
+		opts.ContinuationToken = page.NextContinuationToken
+	}
+}
+
+// ObjectLockClient is implemented by the clients of the providers supporting
+// Object Lock.
+type ObjectLockClient interface {
+	// ObjectLockEnabled returns true if Object Lock is enabled on the bucket
+	// with the given name.
+	ObjectLockEnabled(ctx context.Context, bucketName string) (bool, error)
+}
+
+// ErrBucketNotFound is returned by Fetch, prefixed with the name of the
+// bucket, if the bucket does not exist.
+var ErrBucketNotFound = errors.New("not found")
+
+// ErrObjectLockNotEnabled is returned by VerifyObjectLock if Object Lock is
+// not enabled on the bucket.
+var ErrObjectLockNotEnabled = errors.New("object lock is not enabled")
+
+// ErrEmptyBucket is returned by Fetch if no object of the bucket is left to
+// fetch by the ignore patterns, when FetchOptions.RequireObjects is set.
+var ErrEmptyBucket = errors.New("no objects to fetch")
+
+// VerifyObjectLock checks that Object Lock is enabled on the bucket with the
+// given name, failing with ErrObjectLockNotEnabled if the client does not
+// implement ObjectLockClient.
+func VerifyObjectLock(ctx context.Context, client Client, bucketName string) error {
+	c, ok := client.(ObjectLockClient)
+	if !ok {
+		return fmt.Errorf("%w on bucket '%s': the provider does not support object lock", ErrObjectLockNotEnabled, bucketName)
+	}
+	enabled, err := c.ObjectLockEnabled(ctx, bucketName)
+	if err != nil {
+		return fmt.Errorf("verifying object lock of bucket '%s' failed: %w", bucketName, err)
+	}
+	if !enabled {
+		return fmt.Errorf("%w on bucket '%s'", ErrObjectLockNotEnabled, bucketName)
+	}
+	return nil
+}
+
+// FetchOptions are the options for Fetch.
+type FetchOptions struct {
+	// Ignore holds extra ignore patterns in the gitignore format, which take
+	// precedence over the patterns of the .sourceignore file in the bucket.
+	Ignore *string
+	// Metadata records the ObjectInfo of the fetched objects in the
+	// MetadataFile.
+	Metadata bool
+	// RequireObjects fails the Fetch with ErrEmptyBucket if no object is
+	// left to fetch by the ignore patterns, instead of fetching none.
+	RequireObjects bool
+	// StateFile is the path of a file outside of the directory recording the
+	// objects fetched into it. When set, Fetch resumes a previous, failed
+	// Fetch into the same directory: the objects whose ETag did not change
+	// since are not downloaded again, and the files of the objects no longer
+	// in the bucket are removed.
+	StateFile string
+	// ListTimeout is the timeout for checking that the bucket exists and
+	// listing its objects. Disabled when 0.
+	ListTimeout time.Duration
+	// DownloadTimeout is the timeout for downloading a single object.
+	// Disabled when 0.
+	DownloadTimeout time.Duration
+	// BeforeDownload is called with the listing revision of the objects to
+	// fetch once they are listed, before any of them is downloaded. Fetch
+	// returns without downloading the objects if it returns false. The
+	// listing revision is the SHA1 checksum of the keys and ETags of the
+	// objects and of the ignore files, and of the options changing the
+	// fetched content. It is empty if an object has no ETag.
+	BeforeDownload func(listingRevision string) bool
+}
+
+// stateObject is an object recorded in the FetchOptions.StateFile.
+type stateObject struct {
+	// ETag is the ETag of the object at the time it was fetched.
+	ETag string `json:"etag"`
+	// Info is the metadata of the fetched object.
+	Info ObjectInfo `json:"info"`
+}
+
+// Fetch downloads the objects of the bucket into the given directory, except
+// for the objects matching the ignore patterns of the .sourceignore files in
+// the bucket or the given options. The patterns of a .sourceignore file apply
+// to the objects under its key prefix, and take precedence over the patterns
+// of the .sourceignore files higher up. If enabled in the options, the
+// metadata of the fetched objects is written to the MetadataFile.
+func Fetch(ctx context.Context, client Client, bucketName, dir string, opts FetchOptions) (err error) {
+	listCtx, cancel := withTimeout(ctx, opts.ListTimeout)
+	defer cancel()
+	listCtx, listSpan := tracer.Start(listCtx, "list")
+	defer func() {
+		// the span is ended with the error here if the listing fails
+		endSpan(listSpan, err)
+	}()
+	download := func(objectName, localPath string) (info ObjectInfo, err error) {
+		ctx, cancel := withTimeout(ctx, opts.DownloadTimeout)
+		defer cancel()
+		err = retry.FromContext(ctx).Do(ctx, func() error {
+			info, err = client.FGetObject(ctx, bucketName, objectName, localPath)
+			return err
+		})
+		return info, err
+	}
+
+	exists, err := client.BucketExists(listCtx, bucketName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("bucket '%s' %w", bucketName, ErrBucketNotFound)
+	}
+
+	// Look for file with ignore rules first
+	// NB: S3 has flat filepath keys making it impossible to look
+	// for files in "subdirectories" without building up a tree first.
+	path := filepath.Join(dir, sourceignore.IgnoreFile)
+	ignoreFileFetched := true
+	if _, err := download(sourceignore.IgnoreFile, path); err != nil {
+		if !client.ObjectIsNotFound(err) {
+			return err
+		}
+		ignoreFileFetched = false
+		// the file fetched by a previous Fetch may have been deleted since
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	ps, err := sourceignore.ReadIgnoreFile(path, nil)
+	if err != nil {
+		return err
+	}
+
+	// list the bucket content, which is needed in full to find the nested
+	// ignore files before matching any object
+	var listed []listedObject
+	var ignoreFiles []string
+	etags := make(map[string]string)
+	err = client.ListObjects(listCtx, bucketName, func(objectName, etag string) error {
+		if objectName == sourceignore.IgnoreFile {
+			etags[objectName] = etag
+			return nil
+		}
+		if strings.HasSuffix(objectName, "/"+sourceignore.IgnoreFile) {
+			ignoreFiles = append(ignoreFiles, objectName)
+			etags[objectName] = etag
+			return nil
+		}
+		listed = append(listed, listedObject{key: objectName, etag: etag})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("listing objects from bucket '%s' failed: %w", bucketName, err)
+	}
+	listSpan.SetAttributes(attribute.Int("source.objects", len(listed)))
+	endSpan(listSpan, nil)
+
+	ctx, downloadSpan := tracer.Start(ctx, "download")
+	defer func() {
+		endSpan(downloadSpan, err)
+	}()
+
+	// download the nested ignore files from the top down, skipping the ones
+	// in ignored directories
+	sortByDepth(ignoreFiles)
+	nestedIgnoreFiles := make(map[string]bool)
+	for _, objectName := range ignoreFiles {
+		domain := strings.Split(strings.TrimSuffix(objectName, "/"+sourceignore.IgnoreFile), "/")
+		if sourceignore.NewMatcher(ps).Match(domain, true) {
+			continue
+		}
+		localPath, err := securejoin.SecureJoin(dir, objectName)
+		if err != nil {
+			return err
+		}
+		if _, err := download(objectName, localPath); err != nil {
+			return fmt.Errorf("downloading object from bucket '%s' failed: %w", bucketName, err)
+		}
+		nestedPs, err := sourceignore.ReadIgnoreFile(localPath, domain)
+		if err != nil {
+			return err
+		}
+		ps = append(ps, nestedPs...)
+		nestedIgnoreFiles[objectName] = true
+	}
+	if opts.Ignore != nil {
+		ps = append(ps, sourceignore.ReadPatterns(strings.NewReader(*opts.Ignore), nil)...)
+	}
+	matcher := sourceignore.NewMatcher(ps)
+
+	var toFetch []listedObject
+	for _, object := range listed {
+		if opts.Metadata && object.key == MetadataFile {
+			continue
+		}
+		if matcher.Match(strings.Split(object.key, "/"), false) {
+			continue
+		}
+		toFetch = append(toFetch, object)
+	}
+	if opts.RequireObjects && len(toFetch) == 0 {
+		if len(listed) > 0 {
+			return fmt.Errorf("bucket '%s' has %w: all the %d listed objects are ignored", bucketName, ErrEmptyBucket, len(listed))
+		}
+		return fmt.Errorf("bucket '%s' has %w", bucketName, ErrEmptyBucket)
+	}
+	if opts.BeforeDownload != nil {
+		var usedIgnoreFiles []listedObject
+		if etag, ok := etags[sourceignore.IgnoreFile]; ok {
+			usedIgnoreFiles = append(usedIgnoreFiles, listedObject{key: sourceignore.IgnoreFile, etag: etag})
+		}
+		for objectName := range nestedIgnoreFiles {
+			usedIgnoreFiles = append(usedIgnoreFiles, listedObject{key: objectName, etag: etags[objectName]})
+		}
+		if !opts.BeforeDownload(listingRevision(append(usedIgnoreFiles, toFetch...), opts)) {
+			return nil
+		}
+	}
+
+	// record the fetched objects, so a retry only downloads what is missing
+	var state map[string]stateObject
+	fetched := make(map[string]stateObject)
+	if opts.StateFile != "" {
+		state = readState(opts.StateFile)
+		defer func() {
+			// keep the objects of previous attempts not reached this time
+			if err != nil {
+				for k, v := range state {
+					if _, ok := fetched[k]; !ok {
+						fetched[k] = v
+					}
+				}
+			}
+			if werr := writeState(opts.StateFile, fetched); werr != nil && err == nil {
+				err = werr
+			}
+		}()
+		if ignoreFileFetched {
+			fetched[sourceignore.IgnoreFile] = stateObject{ETag: etags[sourceignore.IgnoreFile]}
+		}
+	}
+
+	// download bucket content
+	var objects []ObjectInfo
+	for _, object := range toFetch {
+		localPath, err := securejoin.SecureJoin(dir, object.key)
+		if err != nil {
+			return err
+		}
+		if prev, ok := state[object.key]; ok && object.etag != "" && prev.ETag == object.etag {
+			if _, err := os.Stat(localPath); err == nil {
+				fetched[object.key] = prev
+				objects = append(objects, prev.Info)
+				continue
+			}
+		}
+		info, err := download(object.key, localPath)
+		if err != nil {
+			return fmt.Errorf("downloading object from bucket '%s' failed: %w", bucketName, err)
+		}
+		fetched[object.key] = stateObject{ETag: object.etag, Info: info}
+		objects = append(objects, info)
+	}
+
+	if opts.StateFile != "" {
+		if err := removeUnfetched(dir, func(key string) bool {
+			_, ok := fetched[key]
+			return ok || nestedIgnoreFiles[key]
+		}); err != nil {
+			return err
+		}
+	}
+
+	if opts.Metadata {
+		return writeMetadata(filepath.Join(dir, MetadataFile), objects)
+	}
+	return nil
+}
+
+// endSpan records the given error on the span if not nil, and ends it. Ending
+// an ended span has no effect.
+func endSpan(span trace.Span, err error) {
+	if err != nil && span.IsRecording() {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// withTimeout returns a copy of the given context with the given timeout, or
+// without a timeout if 0.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// listedObject is an object listed in the bucket.
+type listedObject struct {
+	key  string
+	etag string
+}
+
+// listingRevision returns the SHA1 checksum of the keys and ETags of the
+// given objects, and of the given options changing the fetched content, or
+// an empty string if an object has no ETag.
+func listingRevision(objects []listedObject, opts FetchOptions) string {
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].key < objects[j].key
+	})
+	sum := sha1.New()
+	for _, object := range objects {
+		if object.etag == "" {
+			return ""
+		}
+		fmt.Fprintf(sum, "%s  %s\n", object.etag, object.key)
+	}
+	if opts.Ignore != nil {
+		fmt.Fprintf(sum, "ignore  %x\n", sha1.Sum([]byte(*opts.Ignore)))
+	}
+	if opts.Metadata {
+		fmt.Fprintf(sum, "metadata  %s\n", MetadataFile)
+	}
+	return fmt.Sprintf("%x", sum.Sum(nil))
+}
+
+// sortByDepth sorts the given object keys by the number of path elements,
+// then alphabetically.
+func sortByDepth(keys []string) {
+	sort.Slice(keys, func(i, j int) bool {
+		di, dj := strings.Count(keys[i], "/"), strings.Count(keys[j], "/")
+		if di != dj {
+			return di < dj
+		}
+		return keys[i] < keys[j]
+	})
+}
+
+// writeMetadata writes the given objects sorted by key as Metadata to the
+// given path.
+func writeMetadata(path string, objects []ObjectInfo) error {
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	if objects == nil {
+		objects = []ObjectInfo{}
+	}
+	b, err := json.MarshalIndent(Metadata{Objects: objects}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return fmt.Errorf("writing object metadata failed: %w", err)
+	}
+	return nil
+}
+
+// readState returns the objects recorded in the state file at the given path.
+// A missing or invalid state file is treated as empty, so all the objects are
+// downloaded again.
+func readState(path string) map[string]stateObject {
+	state := make(map[string]stateObject)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(b, &state); err != nil {
+		return make(map[string]stateObject)
+	}
+	return state
+}
+
+// writeState writes the given objects to the state file at the given path.
+func writeState(path string, state map[string]stateObject) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return fmt.Errorf("writing fetch state failed: %w", err)
+	}
+	return nil
+}
+
+// removeUnfetched removes the files in the given directory left behind by a
+// previous Fetch for objects that were not fetched this time, because they
+// were deleted from the bucket or are now ignored. This includes the ignore
+// files, which are only kept if fetched is true for them.
+func removeUnfetched(dir string, fetched func(key string) bool) error {
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if key == MetadataFile {
+			return nil
+		}
+		if !fetched(key) {
+			return os.Remove(p)
+		}
+		return nil
+	})
+}
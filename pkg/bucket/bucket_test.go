@@ -0,0 +1,563 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var errNotFound = errors.New("not found")
+
+// fakeClient is an in-memory Client.
+type fakeClient struct {
+	bucketName string
+	objects    map[string]string
+	// failOn is the name of the object failing to download.
+	failOn string
+	// downloaded holds the names of the downloaded objects.
+	downloaded []string
+}
+
+func (c *fakeClient) BucketExists(_ context.Context, bucketName string) (bool, error) {
+	return bucketName == c.bucketName, nil
+}
+
+func (c *fakeClient) FGetObject(_ context.Context, _, objectName, localPath string) (ObjectInfo, error) {
+	content, ok := c.objects[objectName]
+	if !ok {
+		return ObjectInfo{}, errNotFound
+	}
+	if objectName == c.failOn {
+		return ObjectInfo{}, errors.New("connection reset")
+	}
+	c.downloaded = append(c.downloaded, objectName)
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return ObjectInfo{}, err
+	}
+	info := ObjectInfo{
+		Key:          objectName,
+		ContentType:  "text/plain",
+		LastModified: time.Date(2021, time.September, 21, 11, 40, 5, 0, time.UTC),
+	}
+	return info, os.WriteFile(localPath, []byte(content), 0644)
+}
+
+func (c *fakeClient) ListObjects(_ context.Context, _ string, fn func(objectName, etag string) error) error {
+	var names []string
+	for name := range c.objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := fn(name, fmt.Sprintf("%x", md5.Sum([]byte(c.objects[name])))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *fakeClient) ObjectIsNotFound(err error) bool {
+	return errors.Is(err, errNotFound)
+}
+
+func TestFetch(t *testing.T) {
+	ignore := "*.txt"
+	tests := []struct {
+		name         string
+		objects      map[string]string
+		bucket       string
+		opts         FetchOptions
+		wantFiles    []string
+		wantMetadata string
+		wantErr      string
+	}{
+		{
+			name:    "bucket not found",
+			bucket:  "invalid",
+			wantErr: "bucket 'invalid' not found",
+		},
+		{
+			name: "all objects",
+			objects: map[string]string{
+				"deploy/deployment.yaml": "kind: Deployment",
+				"README.md":              "podinfo",
+			},
+			wantFiles: []string{"README.md", "deploy/deployment.yaml"},
+		},
+		{
+			name: "ignore file and spec patterns",
+			objects: map[string]string{
+				".sourceignore":          "*.md",
+				"deploy/deployment.yaml": "kind: Deployment",
+				"deploy/notes.txt":       "notes",
+				"README.md":              "podinfo",
+			},
+			opts:      FetchOptions{Ignore: &ignore},
+			wantFiles: []string{".sourceignore", "deploy/deployment.yaml"},
+		},
+		{
+			name: "nested ignore files and negation",
+			objects: map[string]string{
+				".sourceignore":         "*.txt\nignored/\n",
+				"team-a/.sourceignore":  "!keep.txt\nsecret.yaml\n",
+				"team-a/app.yaml":       "kind: Deployment",
+				"team-a/keep.txt":       "keep",
+				"team-a/notes.txt":      "notes",
+				"team-a/secret.yaml":    "kind: Secret",
+				"team-b/notes.txt":      "notes",
+				"team-b/secret.yaml":    "kind: Secret",
+				"ignored/.sourceignore": "!file.yaml\n",
+				"ignored/file.yaml":     "kind: ConfigMap",
+			},
+			wantFiles: []string{".sourceignore", "team-a/.sourceignore", "team-a/app.yaml", "team-a/keep.txt", "team-b/secret.yaml"},
+		},
+		{
+			name:      "empty bucket",
+			wantFiles: []string{},
+		},
+		{
+			name:    "empty bucket required",
+			opts:    FetchOptions{RequireObjects: true},
+			wantErr: "bucket 'podinfo' has no objects to fetch",
+		},
+		{
+			name: "ignored objects required",
+			objects: map[string]string{
+				".sourceignore": "*.md",
+				"README.md":     "podinfo",
+				"notes.txt":     "notes",
+			},
+			opts:    FetchOptions{Ignore: &ignore, RequireObjects: true},
+			wantErr: "bucket 'podinfo' has no objects to fetch: all the 2 listed objects are ignored",
+		},
+		{
+			name: "metadata",
+			objects: map[string]string{
+				"deploy/deployment.yaml": "kind: Deployment",
+				MetadataFile:             "{}",
+			},
+			opts:      FetchOptions{Metadata: true},
+			wantFiles: []string{MetadataFile, "deploy/deployment.yaml"},
+			wantMetadata: `{
+  "objects": [
+    {
+      "key": "deploy/deployment.yaml",
+      "contentType": "text/plain",
+      "lastModified": "2021-09-21T11:40:05Z"
+    }
+  ]
+}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "bucket-fetch-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			bucketName := tt.bucket
+			if bucketName == "" {
+				bucketName = "podinfo"
+			}
+			client := &fakeClient{bucketName: "podinfo", objects: tt.objects}
+			err = Fetch(context.TODO(), client, bucketName, dir, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Fetch() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Fetch() error = %v", err)
+			}
+
+			var got []string
+			if err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() {
+					return err
+				}
+				rel, _ := filepath.Rel(dir, p)
+				got = append(got, filepath.ToSlash(rel))
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.wantFiles, ",") {
+				t.Errorf("Fetch() files = %v, want %v", got, tt.wantFiles)
+			}
+
+			if tt.wantMetadata != "" {
+				b, err := os.ReadFile(filepath.Join(dir, MetadataFile))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(b) != tt.wantMetadata {
+					t.Errorf("Fetch() metadata = %s, want %s", string(b), tt.wantMetadata)
+				}
+			}
+		})
+	}
+}
+
+func TestFetch_Resume(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "bucket-fetch-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	dir := filepath.Join(tmpDir, "content")
+	opts := FetchOptions{Metadata: true, StateFile: filepath.Join(tmpDir, "state.json")}
+
+	client := &fakeClient{
+		bucketName: "podinfo",
+		objects: map[string]string{
+			"a.yaml": "a",
+			"b.yaml": "b",
+			"c.yaml": "c",
+		},
+		failOn: "c.yaml",
+	}
+	if err := Fetch(context.TODO(), client, "podinfo", dir, opts); err == nil {
+		t.Fatal("Fetch() error = nil, want download failure")
+	}
+
+	// b.yaml changes and a.yaml is removed from the bucket before the retry
+	client.objects = map[string]string{
+		"b.yaml": "b2",
+		"c.yaml": "c",
+		"d.yaml": "d",
+	}
+	client.failOn = ""
+	client.downloaded = nil
+	if err := Fetch(context.TODO(), client, "podinfo", dir, opts); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if got, want := strings.Join(client.downloaded, ","), "b.yaml,c.yaml,d.yaml"; got != want {
+		t.Errorf("Fetch() downloaded %v, want %v", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.yaml")); !os.IsNotExist(err) {
+		t.Errorf("Fetch() did not remove the file of the deleted object")
+	}
+
+	// a retry after success downloads nothing
+	client.downloaded = nil
+	if err := Fetch(context.TODO(), client, "podinfo", dir, opts); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if len(client.downloaded) != 0 {
+		t.Errorf("Fetch() downloaded %v, want none", client.downloaded)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, MetadataFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"b.yaml", "c.yaml", "d.yaml"} {
+		if !strings.Contains(string(b), key) {
+			t.Errorf("Fetch() metadata is missing %s", key)
+		}
+	}
+}
+
+func TestFetch_ResumeDeletedIgnoreFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	dir := filepath.Join(tmpDir, "content")
+	opts := FetchOptions{StateFile: filepath.Join(tmpDir, "state.json")}
+
+	client := &fakeClient{
+		bucketName: "podinfo",
+		objects: map[string]string{
+			".sourceignore": "*.txt",
+			"a.yaml":        "a",
+			"b.txt":         "b",
+			"c.yaml":        "c",
+		},
+		failOn: "c.yaml",
+	}
+	if err := Fetch(context.TODO(), client, "podinfo", dir, opts); err == nil {
+		t.Fatal("Fetch() error = nil, want download failure")
+	}
+
+	// the ignore file is removed from the bucket before the retry
+	delete(client.objects, ".sourceignore")
+	client.failOn = ""
+	client.downloaded = nil
+	if err := Fetch(context.TODO(), client, "podinfo", dir, opts); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if got, want := strings.Join(client.downloaded, ","), "b.txt,c.yaml"; got != want {
+		t.Errorf("Fetch() downloaded %v, want %v", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".sourceignore")); !os.IsNotExist(err) {
+		t.Errorf("Fetch() did not remove the deleted ignore file")
+	}
+
+	// the ignore file is kept once fetched again
+	client.objects[".sourceignore"] = "*.txt"
+	if err := Fetch(context.TODO(), client, "podinfo", dir, opts); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".sourceignore")); err != nil {
+		t.Errorf("Fetch() removed the fetched ignore file: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("Fetch() did not remove the file of the ignored object")
+	}
+}
+
+func TestFetch_BeforeDownload(t *testing.T) {
+	client := &fakeClient{
+		bucketName: "podinfo",
+		objects: map[string]string{
+			".sourceignore": "*.md",
+			"README.md":     "podinfo",
+			"a.yaml":        "a",
+		},
+	}
+	fetch := func(opts FetchOptions, download bool) string {
+		t.Helper()
+		dir, err := os.MkdirTemp("", "bucket-fetch-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		var revision string
+		client.downloaded = nil
+		opts.BeforeDownload = func(r string) bool {
+			revision = r
+			return download
+		}
+		if err := Fetch(context.TODO(), client, "podinfo", dir, opts); err != nil {
+			t.Fatalf("Fetch() error = %v", err)
+		}
+		// the ignore file is downloaded before the listing
+		fetched := client.downloaded[1:]
+		if download && len(fetched) != 1 || !download && len(fetched) != 0 {
+			t.Errorf("Fetch() downloaded %v with download %v", fetched, download)
+		}
+		return revision
+	}
+
+	revision := fetch(FetchOptions{}, false)
+	if revision == "" {
+		t.Fatal("Fetch() listing revision is empty")
+	}
+	if got := fetch(FetchOptions{}, true); got != revision {
+		t.Errorf("Fetch() listing revision = %s, want %s", got, revision)
+	}
+
+	// ignored objects do not change the revision
+	client.objects["README.md"] = "podinfo v2"
+	if got := fetch(FetchOptions{}, false); got != revision {
+		t.Errorf("Fetch() listing revision of ignored change = %s, want %s", got, revision)
+	}
+
+	client.objects["a.yaml"] = "a2"
+	changed := fetch(FetchOptions{}, false)
+	if changed == revision {
+		t.Error("Fetch() listing revision did not change with the object")
+	}
+	if got := fetch(FetchOptions{Metadata: true}, false); got == changed {
+		t.Error("Fetch() listing revision did not change with the options")
+	}
+}
+
+// slowClient is a fakeClient taking the given delay to download an object.
+type slowClient struct {
+	fakeClient
+	delay time.Duration
+}
+
+func (c *slowClient) FGetObject(ctx context.Context, bucketName, objectName, localPath string) (ObjectInfo, error) {
+	select {
+	case <-time.After(c.delay):
+	case <-ctx.Done():
+		return ObjectInfo{}, ctx.Err()
+	}
+	return c.fakeClient.FGetObject(ctx, bucketName, objectName, localPath)
+}
+
+func TestFetch_Timeouts(t *testing.T) {
+	tests := []struct {
+		name            string
+		downloadTimeout time.Duration
+		wantErr         error
+	}{
+		{
+			name:            "downloads outlast the list timeout",
+			downloadTimeout: time.Second,
+		},
+		{
+			name:            "download timeout",
+			downloadTimeout: 5 * time.Millisecond,
+			wantErr:         context.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "bucket-fetch-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			client := &slowClient{
+				fakeClient: fakeClient{
+					bucketName: "podinfo",
+					objects: map[string]string{
+						"a.yaml": "a",
+						"b.yaml": "b",
+						"c.yaml": "c",
+					},
+				},
+				delay: 20 * time.Millisecond,
+			}
+			err = Fetch(context.TODO(), client, "podinfo", dir, FetchOptions{
+				ListTimeout:     30 * time.Millisecond,
+				DownloadTimeout: tt.downloadTimeout,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Fetch() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// fakeObjectLockClient is a fakeClient implementing ObjectLockClient.
+type fakeObjectLockClient struct {
+	fakeClient
+	enabled bool
+}
+
+func (c *fakeObjectLockClient) ObjectLockEnabled(_ context.Context, _ string) (bool, error) {
+	return c.enabled, nil
+}
+
+func TestVerifyObjectLock(t *testing.T) {
+	tests := []struct {
+		name    string
+		client  Client
+		wantErr bool
+	}{
+		{
+			name:   "enabled",
+			client: &fakeObjectLockClient{enabled: true},
+		},
+		{
+			name:    "not enabled",
+			client:  &fakeObjectLockClient{},
+			wantErr: true,
+		},
+		{
+			name:    "not supported",
+			client:  &fakeClient{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyObjectLock(context.TODO(), tt.client, "podinfo")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyObjectLock() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrObjectLockNotEnabled) {
+				t.Errorf("VerifyObjectLock() error = %v, want ErrObjectLockNotEnabled", err)
+			}
+		})
+	}
+}
+
+// pagedClient lists the given pages, keyed by their continuation token.
+type pagedClient struct {
+	pages map[string]ObjectsPage
+	// opts holds the options of the listed pages.
+	opts []ListOptions
+}
+
+func (c *pagedClient) ListObjectsPage(_ context.Context, _ string, opts ListOptions) (ObjectsPage, error) {
+	c.opts = append(c.opts, opts)
+	page, ok := c.pages[opts.ContinuationToken]
+	if !ok {
+		return ObjectsPage{}, errors.New("invalid continuation token")
+	}
+	return page, nil
+}
+
+func TestListPages(t *testing.T) {
+	tests := []struct {
+		name    string
+		pages   map[string]ObjectsPage
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "pages",
+			pages: map[string]ObjectsPage{
+				"":   {Objects: []ObjectEntry{{Key: "a.yaml", ETag: "1"}}, NextContinuationToken: "p2"},
+				"p2": {Objects: []ObjectEntry{{Key: "b.yaml", ETag: "2"}}},
+			},
+			want: []string{"a.yaml", "b.yaml"},
+		},
+		{
+			name: "token not advancing",
+			pages: map[string]ObjectsPage{
+				"":   {Objects: []ObjectEntry{{Key: "a.yaml"}}, NextContinuationToken: "p2"},
+				"p2": {NextContinuationToken: "p2"},
+			},
+			want:    []string{"a.yaml"},
+			wantErr: true,
+		},
+		{
+			name:    "listing error",
+			pages:   map[string]ObjectsPage{"": {NextContinuationToken: "p2"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &pagedClient{pages: tt.pages}
+			var got []string
+			err := ListPages(context.TODO(), client, "podinfo", ListOptions{StartAfter: "0.yaml"}, func(objectName, _ string) error {
+				got = append(got, objectName)
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ListPages() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ListPages() = %v, want %v", got, tt.want)
+			}
+			for _, opts := range client.opts {
+				if opts.StartAfter != "0.yaml" {
+					t.Errorf("StartAfter = %q, want it kept across pages", opts.StartAfter)
+				}
+			}
+		})
+	}
+}
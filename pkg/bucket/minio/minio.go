@@ -0,0 +1,507 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package minio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+	"golang.org/x/sync/errgroup"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/fluxcd/source-controller/pkg/bucket"
+	"github.com/fluxcd/source-controller/pkg/retry"
+	"github.com/fluxcd/source-controller/pkg/throttle"
+	"github.com/fluxcd/source-controller/pkg/trust"
+)
+
+const (
+	// DefaultPartSize is the default size of the ranged GET requests.
+	DefaultPartSize int64 = 64 << 20
+	// MinPartSize is the minimum size of the ranged GET requests.
+	MinPartSize int64 = 1 << 20
+	// DefaultPartConcurrency is the default maximum number of concurrent
+	// ranged GET requests per object.
+	DefaultPartConcurrency = 4
+
+	// accelerateEndpoint is the S3 Transfer Acceleration endpoint.
+	accelerateEndpoint = "s3-accelerate.amazonaws.com"
+)
+
+// Client is a client for S3 compatible buckets.
+type Client struct {
+	// client is the underlying Minio client.
+	client *minio.Client
+	// partSize is the size of the ranged GET requests, the objects larger
+	// than it are downloaded in parts. Disabled when 0.
+	partSize int64
+	// partConcurrency is the maximum number of concurrent ranged GET
+	// requests per object.
+	partConcurrency int
+	// profile is the Profile of the provider.
+	profile Profile
+}
+
+// Options contains the connection settings for a Client.
+type Options struct {
+	// Endpoint is the S3 compatible storage endpoint.
+	Endpoint string
+	// Region is the bucket region, defaults to the region of the Profile.
+	Region string
+	// Profile adapts the client to the quirks of the provider.
+	Profile Profile
+	// Insecure connects to the endpoint over plain HTTP.
+	Insecure bool
+	// UseIAM retrieves the credentials from the AWS IAM role of the host when
+	// no Secret is given.
+	UseIAM bool
+	// ForcePathStyle addresses the bucket with path-style requests when true,
+	// and with virtual-host-style requests when false. The style is detected
+	// from the endpoint when nil.
+	ForcePathStyle *bool
+	// HTTP2 attempts to negotiate HTTP/2 with the endpoint over TLS.
+	HTTP2 bool
+	// TransferAcceleration downloads the objects through the S3 Transfer
+	// Acceleration endpoint. Only effective on the Amazon S3 endpoints.
+	TransferAcceleration bool
+	// PartSize enables the download of the objects larger than it with
+	// concurrent ranged GET requests of this size, if not 0. It can't be
+	// lower than MinPartSize.
+	PartSize int64
+	// PartConcurrency is the maximum number of concurrent ranged GET
+	// requests per object, defaults to DefaultPartConcurrency.
+	PartConcurrency int
+	// Headers are extra headers set on the requests after they are signed.
+	Headers http.Header
+	// ConnectTimeout is the timeout for establishing a connection to the
+	// endpoint, including the TLS handshake. Defaults to the Minio client
+	// settings when 0.
+	ConnectTimeout time.Duration
+	// SigningRegion and SigningService force the requests to be signed with
+	// AWS Signature Version 4 for the given region and service name when
+	// either is set, instead of the ones detected by the Minio client. They
+	// default to the region, or DefaultSigningRegion, and to
+	// DefaultSigningService.
+	SigningRegion  string
+	SigningService string
+}
+
+// NewClient creates a new Client with the static credentials from the given
+// Secret, which must contain the 'accesskey' and 'secretkey' fields.
+// If the Secret is nil, the credentials are retrieved from the AWS IAM role
+// when enabled in the options.
+func NewClient(opts Options, secret *corev1.Secret) (*Client, error) {
+	region := opts.Region
+	if region == "" {
+		region = opts.Profile.Region(opts.Endpoint)
+	}
+	opt := minio.Options{
+		Region:       region,
+		Secure:       !opts.Insecure,
+		BucketLookup: bucketLookup(opts.ForcePathStyle),
+	}
+
+	transport, err := minio.DefaultTransport(opt.Secure)
+	if err != nil {
+		return nil, err
+	}
+	transport.ForceAttemptHTTP2 = opts.HTTP2
+	bucket.SetConnectTimeout(transport, opts.ConnectTimeout)
+	rt, err := trust.Transport(transport, nil)
+	if err != nil {
+		return nil, err
+	}
+	// the downloads are throttled by the limiters of their context
+	opt.Transport = throttle.Transport(bucket.HeaderTransport(rt, opts.Headers))
+
+	if secret != nil {
+		if err := ValidateSecret(secret.Data, secret.Name); err != nil {
+			return nil, err
+		}
+		opt.Creds = credentials.NewStaticV4(string(secret.Data["accesskey"]), string(secret.Data["secretkey"]), "")
+	} else if opts.UseIAM {
+		opt.Creds = credentials.NewIAM("")
+	}
+
+	if opt.Creds == nil {
+		return nil, fmt.Errorf("no bucket credentials found")
+	}
+
+	if opts.SigningRegion != "" || opts.SigningService != "" {
+		region, service := opts.SigningRegion, opts.SigningService
+		if region == "" {
+			region = opt.Region
+		}
+		if region == "" {
+			region = DefaultSigningRegion
+		}
+		if service == "" {
+			service = DefaultSigningService
+		}
+		// the region is not looked up, as the endpoint may not support it
+		if opt.Region == "" {
+			opt.Region = region
+		}
+		// the extra headers are set after the requests are signed
+		opt.Transport = throttle.Transport(&sigV4Transport{
+			rt:      bucket.HeaderTransport(rt, opts.Headers),
+			creds:   opt.Creds,
+			region:  region,
+			service: service,
+		})
+	}
+
+	if opts.PartSize != 0 && opts.PartSize < MinPartSize {
+		return nil, fmt.Errorf("invalid part size %d: must be at least %d bytes", opts.PartSize, MinPartSize)
+	}
+	partConcurrency := opts.PartConcurrency
+	if partConcurrency <= 0 {
+		partConcurrency = DefaultPartConcurrency
+	}
+
+	client, err := minio.New(opts.Endpoint, &opt)
+	if err != nil {
+		return nil, err
+	}
+	if opts.TransferAcceleration {
+		client.SetS3TransferAccelerate(accelerateEndpoint)
+	}
+	return &Client{client: client, partSize: opts.PartSize, partConcurrency: partConcurrency, profile: opts.Profile}, nil
+}
+
+// ValidateSecret validates the credential fields of the given Secret data.
+func ValidateSecret(secret map[string][]byte, name string) error {
+	if len(secret["accesskey"]) == 0 || len(secret["secretkey"]) == 0 {
+		return fmt.Errorf("invalid '%s' secret data: required fields 'accesskey' and 'secretkey'", name)
+	}
+	return nil
+}
+
+// bucketLookup returns the minio.BucketLookupType for the given path-style
+// option.
+func bucketLookup(forcePathStyle *bool) minio.BucketLookupType {
+	switch {
+	case forcePathStyle == nil:
+		return minio.BucketLookupAuto
+	case *forcePathStyle:
+		return minio.BucketLookupPath
+	default:
+		return minio.BucketLookupDNS
+	}
+}
+
+// BucketExists checks if the bucket with the provided name exists.
+func (c *Client) BucketExists(ctx context.Context, bucketName string) (bool, error) {
+	return c.client.BucketExists(ctx, bucketName)
+}
+
+// FGetObject gets the object from the bucket and downloads it to the local
+// path, creating any missing parent directories. It returns the metadata of
+// the object. If enabled, the objects larger than the part size are
+// downloaded in parts. The downloads are retried by the retry.Policy of the
+// context, if any.
+func (c *Client) FGetObject(ctx context.Context, bucketName, objectName, localPath string) (bucket.ObjectInfo, error) {
+	if c.partSize > 0 {
+		stat, err := c.client.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{})
+		if err != nil {
+			return bucket.ObjectInfo{}, err
+		}
+		if stat.Size > c.partSize {
+			if err := c.fGetObjectParts(ctx, bucketName, objectName, localPath, stat); err != nil {
+				return bucket.ObjectInfo{}, err
+			}
+			return objectInfo(objectName, stat), nil
+		}
+	}
+
+	object, err := c.client.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return bucket.ObjectInfo{}, err
+	}
+	defer object.Close()
+
+	stat, err := object.Stat()
+	if err != nil {
+		return bucket.ObjectInfo{}, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return bucket.ObjectInfo{}, err
+	}
+	f, err := os.OpenFile(localPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return bucket.ObjectInfo{}, err
+	}
+	// a download interrupted by a transient error is resumed from the offset
+	// reached, with ranged requests matching the ETag of the object
+	var written int64
+	err = retry.FromContext(ctx).Do(ctx, func() error {
+		r := io.Reader(object)
+		if written > 0 {
+			if written >= stat.Size {
+				return nil
+			}
+			opts := minio.GetObjectOptions{}
+			if err := opts.SetRange(written, 0); err != nil {
+				return err
+			}
+			if stat.ETag != "" {
+				if err := opts.SetMatchETag(stat.ETag); err != nil {
+					return err
+				}
+			}
+			ranged, err := c.client.GetObject(ctx, bucketName, objectName, opts)
+			if err != nil {
+				return err
+			}
+			defer ranged.Close()
+			r = ranged
+		}
+		n, err := io.Copy(f, r)
+		written += n
+		return err
+	})
+	if err != nil {
+		f.Close()
+		os.Remove(localPath)
+		return bucket.ObjectInfo{}, err
+	}
+	if err := f.Close(); err != nil {
+		return bucket.ObjectInfo{}, err
+	}
+
+	return objectInfo(objectName, stat), nil
+}
+
+// fGetObjectParts downloads the object with the given info to the local path
+// with concurrent ranged GET requests of the part size. The requests must
+// match the ETag of the object, so the download fails if the object changes
+// meanwhile.
+func (c *Client) fGetObjectParts(ctx context.Context, bucketName, objectName, localPath string, stat minio.ObjectInfo) (err error) {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(localPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(localPath)
+		}
+	}()
+	if err := f.Truncate(stat.Size); err != nil {
+		return err
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	sem := make(chan struct{}, c.partConcurrency)
+parts:
+	for off := int64(0); off < stat.Size; off += c.partSize {
+		start, end := off, off+c.partSize-1
+		if end >= stat.Size {
+			end = stat.Size - 1
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break parts
+		}
+		g.Go(func() error {
+			defer func() { <-sem }()
+			return retry.FromContext(ctx).Do(ctx, func() error {
+				return c.getObjectRange(ctx, bucketName, objectName, stat.ETag, f, start, end)
+			})
+		})
+	}
+	return g.Wait()
+}
+
+// getObjectRange writes the given byte range of the object with the given
+// ETag at the same offset of the writer.
+func (c *Client) getObjectRange(ctx context.Context, bucketName, objectName, etag string, w io.WriterAt, start, end int64) error {
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(start, end); err != nil {
+		return err
+	}
+	if etag != "" {
+		if err := opts.SetMatchETag(etag); err != nil {
+			return err
+		}
+	}
+	object, err := c.client.GetObject(ctx, bucketName, objectName, opts)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	n, err := io.Copy(&offsetWriter{w: w, off: start}, object)
+	if err != nil {
+		return err
+	}
+	if n != end-start+1 {
+		return fmt.Errorf("short read of bytes %d-%d of object '%s': got %d bytes", start, end, objectName, n)
+	}
+	return nil
+}
+
+// offsetWriter writes to an io.WriterAt from an offset.
+type offsetWriter struct {
+	w   io.WriterAt
+	off int64
+}
+
+func (o *offsetWriter) Write(p []byte) (int, error) {
+	n, err := o.w.WriteAt(p, o.off)
+	o.off += int64(n)
+	return n, err
+}
+
+// objectInfo returns the bucket.ObjectInfo of the object with the given name
+// and info.
+func objectInfo(objectName string, stat minio.ObjectInfo) bucket.ObjectInfo {
+	return bucket.ObjectInfo{
+		Key:          objectName,
+		ContentType:  stat.ContentType,
+		LastModified: stat.LastModified,
+		Metadata:     stat.UserMetadata,
+	}
+}
+
+// ListObjects calls fn with the key and the ETag of every object in the
+// bucket, skipping directories. It stops at the first error returned by fn or
+// the server.
+func (c *Client) ListObjects(ctx context.Context, bucketName string, fn func(objectName, etag string) error) error {
+	return bucket.ListPages(ctx, c, bucketName, bucket.ListOptions{}, fn)
+}
+
+// ListObjectsPage lists a page of the objects of the bucket, skipping
+// directories, with the ListObjectsV2 API without fetching the owners of the
+// objects. The Google Cloud Storage endpoints, which do not support the V2
+// API, are listed with the V1 API, the continuation token being the marker.
+// The Minio client does not send the start-after parameter of the V2 API, so
+// the objects up to the StartAfter key are skipped from the listed pages
+// instead. The objects not listed by the Profile are skipped as well.
+func (c *Client) ListObjectsPage(ctx context.Context, bucketName string, opts bucket.ListOptions) (bucket.ObjectsPage, error) {
+	core := minio.Core{Client: c.client}
+	var (
+		contents []minio.ObjectInfo
+		next     string
+	)
+
+	if s3utils.IsGoogleEndpoint(*c.client.EndpointURL()) {
+		marker := opts.ContinuationToken
+		if marker == "" {
+			marker = opts.StartAfter
+		}
+		var result minio.ListBucketResult
+		err := withContext(ctx, func() (err error) {
+			result, err = core.ListObjects(bucketName, "", marker, "", opts.MaxKeys)
+			return err
+		})
+		if err != nil {
+			return bucket.ObjectsPage{}, err
+		}
+		contents = result.Contents
+		if result.IsTruncated {
+			// the next marker is only returned with a delimiter
+			next = result.NextMarker
+			if next == "" && len(contents) > 0 {
+				next = contents[len(contents)-1].Key
+			}
+		}
+	} else {
+		var result minio.ListBucketV2Result
+		err := withContext(ctx, func() (err error) {
+			result, err = core.ListObjectsV2(bucketName, "", opts.ContinuationToken, false, "", opts.MaxKeys)
+			return err
+		})
+		if err != nil {
+			return bucket.ObjectsPage{}, err
+		}
+		contents = result.Contents
+		if result.IsTruncated {
+			if result.NextContinuationToken == "" {
+				return bucket.ObjectsPage{}, fmt.Errorf("truncated listing of bucket '%s' without continuation token", bucketName)
+			}
+			next = result.NextContinuationToken
+		}
+	}
+
+	page := bucket.ObjectsPage{NextContinuationToken: next}
+	for _, object := range contents {
+		if strings.HasSuffix(object.Key, "/") || (opts.StartAfter != "" && object.Key <= opts.StartAfter) || c.profile.skipKey(object.Key) {
+			continue
+		}
+		page.Objects = append(page.Objects, bucket.ObjectEntry{
+			Key:  object.Key,
+			ETag: strings.Trim(object.ETag, "\""),
+		})
+	}
+	return page, nil
+}
+
+// withContext calls f, returning early with the error of the given context
+// if it is done first, as the Core API of the Minio client does not take a
+// context.
+func withContext(ctx context.Context, f func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- f()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ObjectLockEnabled checks if Object Lock is enabled in the configuration of
+// the bucket with the provided name. It is never enabled with the R2Profile,
+// as Cloudflare R2 does not support Object Lock.
+func (c *Client) ObjectLockEnabled(ctx context.Context, bucketName string) (bool, error) {
+	if c.profile == R2Profile {
+		return false, nil
+	}
+	objectLock, _, _, _, err := c.client.GetObjectLockConfig(ctx, bucketName)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "ObjectLockConfigurationNotFoundError" {
+			return false, nil
+		}
+		return false, err
+	}
+	return objectLock == "Enabled", nil
+}
+
+// ObjectIsNotFound checks if the error provided is a minio.ErrorResponse
+// with the "NoSuchKey" code.
+func (c *Client) ObjectIsNotFound(err error) bool {
+	return minio.ToErrorResponse(err).Code == "NoSuchKey"
+}
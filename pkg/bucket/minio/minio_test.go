@@ -0,0 +1,323 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package minio
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/fluxcd/source-controller/pkg/bucket"
+	"github.com/fluxcd/source-controller/pkg/retry"
+)
+
+func TestNewClient_ForcePathStyle(t *testing.T) {
+	var gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	secret := &corev1.Secret{
+		Data: map[string][]byte{
+			"accesskey": []byte("access"),
+			"secretkey": []byte("secret"),
+		},
+	}
+	pathStyle := true
+	c, err := NewClient(Options{
+		Endpoint:       strings.TrimPrefix(server.URL, "http://"),
+		Region:         "us-east-1",
+		Insecure:       true,
+		ForcePathStyle: &pathStyle,
+	}, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.BucketExists(context.TODO(), "podinfo"); err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/podinfo/" {
+		t.Errorf("request path = %q, want %q", gotPath, "/podinfo/")
+	}
+}
+
+func TestNewClient_Headers(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	secret := &corev1.Secret{
+		Data: map[string][]byte{
+			"accesskey": []byte("access"),
+			"secretkey": []byte("secret"),
+		},
+	}
+	c, err := NewClient(Options{
+		Endpoint: strings.TrimPrefix(server.URL, "http://"),
+		Region:   "us-east-1",
+		Insecure: true,
+		Headers: http.Header{
+			"User-Agent": []string{"flux/prod-eu"},
+			"X-Trace-Id": []string{"1234"},
+		},
+	}, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.BucketExists(context.TODO(), "podinfo"); err != nil {
+		t.Fatal(err)
+	}
+	if ua := got.Get("User-Agent"); ua != "flux/prod-eu" {
+		t.Errorf("User-Agent = %q, want %q", ua, "flux/prod-eu")
+	}
+	if id := got.Get("X-Trace-Id"); id != "1234" {
+		t.Errorf("X-Trace-Id = %q, want %q", id, "1234")
+	}
+	if got.Get("Authorization") == "" {
+		t.Error("request is not signed")
+	}
+}
+
+func TestClient_FGetObject_Parts(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 105)
+	var mu sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/podinfo/large.bin" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodGet {
+			mu.Lock()
+			ranges = append(ranges, r.Header.Get("Range"))
+			mu.Unlock()
+		}
+		w.Header().Set("ETag", `"1234"`)
+		http.ServeContent(w, r, "large.bin", time.Now(), bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	secret := &corev1.Secret{
+		Data: map[string][]byte{
+			"accesskey": []byte("access"),
+			"secretkey": []byte("secret"),
+		},
+	}
+	c, err := NewClient(Options{
+		Endpoint: strings.TrimPrefix(server.URL, "http://"),
+		Region:   "us-east-1",
+		Insecure: true,
+		PartSize: MinPartSize,
+	}, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// download the test object in parts of 100 bytes
+	c.partSize = 100
+
+	localPath := filepath.Join(t.TempDir(), "large.bin")
+	if _, err := c.FGetObject(context.TODO(), "podinfo", "large.bin", localPath); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(localPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("downloaded %d bytes, want the %d bytes of the object", len(got), len(data))
+	}
+	if len(ranges) != 11 {
+		t.Errorf("got %d ranged requests, want 11: %v", len(ranges), ranges)
+	}
+}
+
+func TestClient_FGetObject_Resume(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	var gets []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"1234"`)
+		if r.Method == http.MethodGet {
+			gets = append(gets, r.Header.Get("Range")+" "+r.Header.Get("If-Match"))
+			if len(gets) == 1 {
+				// cut the connection half way through the first download
+				w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+				w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+				w.WriteHeader(http.StatusOK)
+				w.Write(data[:500])
+				w.(http.Flusher).Flush()
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+		}
+		http.ServeContent(w, r, "object.bin", time.Now(), bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	secret := &corev1.Secret{
+		Data: map[string][]byte{
+			"accesskey": []byte("access"),
+			"secretkey": []byte("secret"),
+		},
+	}
+	c, err := NewClient(Options{
+		Endpoint: strings.TrimPrefix(server.URL, "http://"),
+		Region:   "us-east-1",
+		Insecure: true,
+	}, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := retry.WithPolicy(context.TODO(), retry.NewPolicy(2, time.Millisecond))
+	localPath := filepath.Join(t.TempDir(), "object.bin")
+	if _, err := c.FGetObject(ctx, "podinfo", "object.bin", localPath); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(localPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("downloaded %d bytes, want the %d bytes of the object", len(got), len(data))
+	}
+	if len(gets) != 2 || gets[1] != `bytes=500- "1234"` {
+		t.Errorf("got requests %q, want a download resumed from the offset reached", gets)
+	}
+}
+
+func TestClient_ListObjects(t *testing.T) {
+	pages := map[string]string{
+		"": `<ListBucketResult><Name>podinfo</Name><IsTruncated>true</IsTruncated><NextContinuationToken>page-2</NextContinuationToken>
+<Contents><Key>apps/</Key><ETag>&#34;d41d8cd9&#34;</ETag></Contents>
+<Contents><Key>apps/podinfo.yaml</Key><ETag>&#34;1234&#34;</ETag></Contents>
+</ListBucketResult>`,
+		"page-2": `<ListBucketResult><Name>podinfo</Name><IsTruncated>false</IsTruncated>
+<Contents><Key>infra/redis.yaml</Key><ETag>&#34;5678&#34;</ETag></Contents>
+</ListBucketResult>`,
+		"page-3": `<ListBucketResult><Name>podinfo</Name><IsTruncated>true</IsTruncated></ListBucketResult>`,
+	}
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("list-type") != "2" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		queries = append(queries, r.URL.RawQuery)
+		page, ok := pages[q.Get("continuation-token")]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(page))
+	}))
+	defer server.Close()
+
+	secret := &corev1.Secret{
+		Data: map[string][]byte{
+			"accesskey": []byte("access"),
+			"secretkey": []byte("secret"),
+		},
+	}
+	pathStyle := true
+	c, err := NewClient(Options{
+		Endpoint:       strings.TrimPrefix(server.URL, "http://"),
+		Region:         "us-east-1",
+		Insecure:       true,
+		ForcePathStyle: &pathStyle,
+	}, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	if err := c.ListObjects(context.TODO(), "podinfo", func(objectName, etag string) error {
+		got = append(got, objectName+"@"+etag)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "apps/podinfo.yaml@1234,infra/redis.yaml@5678"; strings.Join(got, ",") != want {
+		t.Errorf("ListObjects() = %v, want %s", got, want)
+	}
+	for _, q := range queries {
+		if strings.Contains(q, "fetch-owner") {
+			t.Errorf("request query %q fetches the owners", q)
+		}
+	}
+
+	page, err := c.ListObjectsPage(context.TODO(), "podinfo", bucket.ListOptions{StartAfter: "apps/podinfo.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Objects) != 0 || page.NextContinuationToken != "page-2" {
+		t.Errorf("ListObjectsPage() = %v, want no object after the start key and the next token", page)
+	}
+
+	if _, err := c.ListObjectsPage(context.TODO(), "podinfo", bucket.ListOptions{ContinuationToken: "page-3"}); err == nil {
+		t.Error("ListObjectsPage() error = nil, want an error for a truncated page without continuation token")
+	}
+}
+
+func TestNewClient_PartSize(t *testing.T) {
+	secret := &corev1.Secret{
+		Data: map[string][]byte{
+			"accesskey": []byte("access"),
+			"secretkey": []byte("secret"),
+		},
+	}
+	if _, err := NewClient(Options{Endpoint: "localhost:9000", PartSize: MinPartSize - 1}, secret); err == nil {
+		t.Error("NewClient() did not return error for part size below minimum")
+	}
+}
+
+func TestValidateSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string][]byte
+		wantErr bool
+	}{
+		{"keys", map[string][]byte{"accesskey": []byte("a"), "secretkey": []byte("s")}, false},
+		{"empty secret key", map[string][]byte{"accesskey": []byte("a"), "secretkey": []byte("")}, true},
+		{"missing access key", map[string][]byte{"secretkey": []byte("s")}, true},
+		{"empty", map[string][]byte{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateSecret(tt.data, "secret"); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package minio
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Profile adapts a Client to the quirks of an S3 compatible provider.
+type Profile string
+
+const (
+	// GenericProfile makes no assumption about the provider.
+	GenericProfile Profile = ""
+	// R2Profile is the profile of Cloudflare R2, whose endpoints are
+	// '<account id>.r2.cloudflarestorage.com', or
+	// '<account id>.<jurisdiction>.r2.cloudflarestorage.com'. The requests
+	// are signed for the 'auto' region, as R2 does not support the bucket
+	// location API, and R2 has no Object Lock.
+	R2Profile Profile = "r2"
+	// B2Profile is the profile of Backblaze B2, whose endpoints are
+	// 's3.<region>.backblazeb2.com'. The requests are signed for the region
+	// of the endpoint, and the '.bzEmpty' placeholders of the folders
+	// created with the B2 web UI are not listed.
+	B2Profile Profile = "b2"
+
+	// r2Region is the region the requests to Cloudflare R2 are signed for.
+	r2Region = "auto"
+	// b2FolderPlaceholder is the name of the empty objects created by the
+	// B2 web UI to materialize the folders.
+	b2FolderPlaceholder = ".bzEmpty"
+)
+
+var (
+	r2EndpointRegexp = regexp.MustCompile(`^[a-z0-9]+(\.[a-z]+)?\.r2\.cloudflarestorage\.com$`)
+	b2EndpointRegexp = regexp.MustCompile(`^s3\.([a-z0-9-]+)\.backblazeb2\.com$`)
+)
+
+// ValidateEndpoint returns an error if the given endpoint, in the
+// '<host>[:<port>][/<path>]' format, does not match the endpoints of the
+// provider of the profile.
+func (p Profile) ValidateEndpoint(endpoint string) error {
+	host := endpointHost(endpoint)
+	switch p {
+	case R2Profile:
+		if !r2EndpointRegexp.MatchString(host) {
+			return fmt.Errorf("invalid endpoint '%s': the '%s' provider requires a '<account id>.r2.cloudflarestorage.com' endpoint", endpoint, p)
+		}
+	case B2Profile:
+		if !b2EndpointRegexp.MatchString(host) {
+			return fmt.Errorf("invalid endpoint '%s': the '%s' provider requires a 's3.<region>.backblazeb2.com' endpoint", endpoint, p)
+		}
+	}
+	return nil
+}
+
+// Region returns the region the requests to the given endpoint are signed
+// for by the profile, or an empty string if it is looked up.
+func (p Profile) Region(endpoint string) string {
+	switch p {
+	case R2Profile:
+		return r2Region
+	case B2Profile:
+		if m := b2EndpointRegexp.FindStringSubmatch(endpointHost(endpoint)); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// skipKey returns true if the object with the given key is not listed by the
+// profile.
+func (p Profile) skipKey(key string) bool {
+	return p == B2Profile && path.Base(key) == b2FolderPlaceholder
+}
+
+// endpointHost returns the lower case host of the given endpoint, in the
+// '<host>[:<port>][/<path>]' format.
+func endpointHost(endpoint string) string {
+	host := endpoint
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
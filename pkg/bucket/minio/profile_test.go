@@ -0,0 +1,137 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package minio
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestProfile_ValidateEndpoint(t *testing.T) {
+	tests := []struct {
+		profile  Profile
+		endpoint string
+		wantErr  bool
+	}{
+		{profile: GenericProfile, endpoint: "minio:9000"},
+		{profile: R2Profile, endpoint: "0123456789abcdef.r2.cloudflarestorage.com"},
+		{profile: R2Profile, endpoint: "0123456789abcdef.eu.r2.cloudflarestorage.com:443"},
+		{profile: R2Profile, endpoint: "r2.cloudflarestorage.com", wantErr: true},
+		{profile: R2Profile, endpoint: "s3.amazonaws.com", wantErr: true},
+		{profile: B2Profile, endpoint: "s3.us-west-004.backblazeb2.com"},
+		{profile: B2Profile, endpoint: "S3.eu-central-003.backblazeb2.com."},
+		{profile: B2Profile, endpoint: "f004.backblazeb2.com", wantErr: true},
+		{profile: B2Profile, endpoint: "s3.us-west-004.backblazeb2.com.example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.profile)+" "+tt.endpoint, func(t *testing.T) {
+			if err := tt.profile.ValidateEndpoint(tt.endpoint); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateEndpoint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProfile_Region(t *testing.T) {
+	tests := []struct {
+		profile  Profile
+		endpoint string
+		want     string
+	}{
+		{profile: GenericProfile, endpoint: "s3.us-west-004.backblazeb2.com", want: ""},
+		{profile: R2Profile, endpoint: "0123456789abcdef.r2.cloudflarestorage.com", want: "auto"},
+		{profile: B2Profile, endpoint: "s3.us-west-004.backblazeb2.com", want: "us-west-004"},
+		{profile: B2Profile, endpoint: "minio:9000", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.profile)+" "+tt.endpoint, func(t *testing.T) {
+			if got := tt.profile.Region(tt.endpoint); got != tt.want {
+				t.Errorf("Region() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewClient_Profile(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RawQuery+" "+r.Header.Get("Authorization"))
+		if r.URL.Query().Get("list-type") != "2" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<ListBucketResult><Name>podinfo</Name><IsTruncated>false</IsTruncated>
+<Contents><Key>apps/.bzEmpty</Key><ETag>&#34;d41d8cd9&#34;</ETag></Contents>
+<Contents><Key>apps/podinfo.yaml</Key><ETag>&#34;1234&#34;</ETag></Contents>
+</ListBucketResult>`))
+	}))
+	defer server.Close()
+
+	secret := &corev1.Secret{
+		Data: map[string][]byte{
+			"accesskey": []byte("access"),
+			"secretkey": []byte("secret"),
+		},
+	}
+	pathStyle := true
+	for _, tt := range []struct {
+		profile    Profile
+		region     string
+		wantRegion string
+		wantKeys   string
+	}{
+		{profile: R2Profile, wantRegion: "/auto/s3/", wantKeys: "apps/.bzEmpty,apps/podinfo.yaml"},
+		{profile: B2Profile, region: "us-west-004", wantRegion: "/us-west-004/s3/", wantKeys: "apps/podinfo.yaml"},
+	} {
+		t.Run(string(tt.profile), func(t *testing.T) {
+			requests = nil
+			c, err := NewClient(Options{
+				Endpoint:       strings.TrimPrefix(server.URL, "http://"),
+				Region:         tt.region,
+				Insecure:       true,
+				ForcePathStyle: &pathStyle,
+				Profile:        tt.profile,
+			}, secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			if err := c.ListObjects(context.TODO(), "podinfo", func(objectName, etag string) error {
+				got = append(got, objectName)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, ",") != tt.wantKeys {
+				t.Errorf("ListObjects() = %v, want %s", got, tt.wantKeys)
+			}
+			for _, r := range requests {
+				if strings.Contains(r, "location") {
+					t.Errorf("request %q looks up the bucket location", r)
+				} else if !strings.Contains(r, tt.wantRegion) {
+					t.Errorf("request %q not signed for %s", r, tt.wantRegion)
+				}
+			}
+		})
+	}
+}
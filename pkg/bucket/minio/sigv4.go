@@ -0,0 +1,153 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package minio
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+)
+
+const (
+	// DefaultSigningRegion is the region the requests are signed for when
+	// neither the signing region nor the region of the bucket is set.
+	DefaultSigningRegion = "us-east-1"
+	// DefaultSigningService is the service name the requests are signed for
+	// when the signing service is not set.
+	DefaultSigningService = "s3"
+
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+	sigV4DateFormat = "20060102"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// sigV4Transport signs the requests sent with the wrapped http.RoundTripper
+// with AWS Signature Version 4 for its region and service name, replacing the
+// signature set by the Minio client, which always signs for the 's3' service
+// and may sign with Signature Version 2 depending on the endpoint.
+type sigV4Transport struct {
+	rt      http.RoundTripper
+	creds   *credentials.Credentials
+	region  string
+	service string
+}
+
+func (t *sigV4Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	value, err := t.creds.Get()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Del("Authorization")
+	if value.SignerType != credentials.SignatureAnonymous && value.AccessKeyID != "" && value.SecretAccessKey != "" {
+		signV4(req, value, t.region, t.service, time.Now().UTC())
+	}
+	return t.rt.RoundTrip(req)
+}
+
+// signV4 sets the Authorization header of the given request to its AWS
+// Signature Version 4 at the given time for the given region and service
+// name, in accordance with
+// https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html.
+// The 'Host', 'Content-Md5' and 'X-Amz-*' headers are signed, and the payload
+// is not unless its hash is already set in the 'X-Amz-Content-Sha256' header.
+func signV4(req *http.Request, creds credentials.Value, region, service string, t time.Time) {
+	req.Header.Set("X-Amz-Date", t.Format(sigV4TimeFormat))
+	req.Header.Del("X-Amz-Security-Token")
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	payloadHash := req.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = unsignedPayload
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for k, vs := range req.Header {
+		k = strings.ToLower(k)
+		if !strings.HasPrefix(k, "x-amz-") && k != "content-md5" {
+			continue
+		}
+		values := make([]string, 0, len(vs))
+		for _, v := range vs {
+			values = append(values, strings.Join(strings.Fields(v), " "))
+		}
+		headers[k] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3utils.EncodePath(path),
+		strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	date := t.Format(sigV4DateFormat)
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		t.Format(sigV4TimeFormat),
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, s := range []string{date, region, service, "aws4_request"} {
+		key = sumHMAC(key, []byte(s))
+	}
+	signature := hex.EncodeToString(sumHMAC(key, []byte(stringToSign)))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func sumHMAC(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package minio
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/signer"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func Test_signV4(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://objects.example.com/podinfo/some%20dir/file.yaml?list-type=2&prefix=a+b", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	// the signature for the 's3' service matches the one of the Minio client
+	want := signer.SignV4(*req, "access", "secret", "token", "eu-central-1")
+	signedAt, err := time.Parse(sigV4TimeFormat, want.Header.Get("X-Amz-Date"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := req.Clone(context.TODO())
+	signV4(got, credentials.Value{AccessKeyID: "access", SecretAccessKey: "secret", SessionToken: "token"}, "eu-central-1", "s3", signedAt)
+	if got.Header.Get("Authorization") != want.Header.Get("Authorization") {
+		t.Errorf("Authorization = %q, want %q", got.Header.Get("Authorization"), want.Header.Get("Authorization"))
+	}
+
+	custom := req.Clone(context.TODO())
+	signV4(custom, credentials.Value{AccessKeyID: "access", SecretAccessKey: "secret"}, "appliance-1", "objects", signedAt)
+	if auth := custom.Header.Get("Authorization"); !strings.Contains(auth, "/appliance-1/objects/aws4_request,") || auth == got.Header.Get("Authorization") {
+		t.Errorf("Authorization = %q, want a signature for the 'appliance-1' region and 'objects' service", auth)
+	}
+}
+
+func TestNewClient_Signing(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	secret := &corev1.Secret{
+		Data: map[string][]byte{
+			"accesskey": []byte("access"),
+			"secretkey": []byte("secret"),
+		},
+	}
+	tests := []struct {
+		name      string
+		opts      Options
+		wantScope string
+	}{
+		{
+			name:      "custom region and service",
+			opts:      Options{SigningRegion: "appliance-1", SigningService: "objects"},
+			wantScope: "/appliance-1/objects/aws4_request,",
+		},
+		{
+			name:      "default service",
+			opts:      Options{SigningRegion: "appliance-1"},
+			wantScope: "/appliance-1/s3/aws4_request,",
+		},
+		{
+			name:      "bucket region",
+			opts:      Options{Region: "eu-west-1", SigningService: "objects"},
+			wantScope: "/eu-west-1/objects/aws4_request,",
+		},
+		{
+			name:      "default region",
+			opts:      Options{SigningService: "objects"},
+			wantScope: "/us-east-1/objects/aws4_request,",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Endpoint = strings.TrimPrefix(server.URL, "http://")
+			opts.Insecure = true
+			opts.Headers = http.Header{"X-Trace-Id": []string{"1234"}}
+			c, err := NewClient(opts, secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.BucketExists(context.TODO(), "podinfo"); err != nil {
+				t.Fatal(err)
+			}
+			auth := got.Get("Authorization")
+			if !strings.HasPrefix(auth, sigV4Algorithm+" Credential=access/") || !strings.Contains(auth, tt.wantScope) {
+				t.Errorf("Authorization = %q, want a scope ending with %q", auth, tt.wantScope)
+			}
+			if strings.Contains(auth, "x-trace-id") {
+				t.Errorf("Authorization = %q, want the extra headers not signed", auth)
+			}
+		})
+	}
+}
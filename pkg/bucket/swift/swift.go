@@ -0,0 +1,280 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package swift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ncw/swift"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/fluxcd/source-controller/pkg/bucket"
+	"github.com/fluxcd/source-controller/pkg/throttle"
+	"github.com/fluxcd/source-controller/pkg/trust"
+)
+
+const (
+	// DefaultAuthPath is the path appended to the endpoint when it does
+	// not contain one, pointing to the Keystone v3 identity API.
+	DefaultAuthPath = "/v3"
+
+	// defaultListLimit is the default number of objects of a listed page.
+	defaultListLimit = 1000
+)
+
+var (
+	// ErrorContainerNotFound is returned when the container does not exist.
+	ErrorContainerNotFound = swift.ContainerNotFound
+	// ErrorObjectNotFound is returned when the object does not exist.
+	ErrorObjectNotFound = swift.ObjectNotFound
+)
+
+// Client is a minimal OpenStack Swift client for fetching the objects of a
+// container, authenticated against Keystone v3.
+type Client struct {
+	// conn is the underlying Swift connection.
+	conn *swift.Connection
+}
+
+// Options contains the connection settings for a Client.
+type Options struct {
+	// Endpoint is the Keystone identity endpoint address, with an optional
+	// path. When the path is omitted, DefaultAuthPath is used.
+	Endpoint string
+	// Region is the object-store region to select from the service catalog.
+	Region string
+	// Insecure connects to the identity endpoint over plain HTTP.
+	Insecure bool
+	// Timeout is the timeout for data operations.
+	Timeout time.Duration
+	// ConnectTimeout is the timeout for establishing a connection to the
+	// endpoints, including the TLS handshake. Defaults to Timeout when 0.
+	ConnectTimeout time.Duration
+	// Headers are extra headers set on the requests.
+	Headers http.Header
+}
+
+// NewClient creates a new Client authenticated against Keystone v3 with the
+// credentials from the given Secret.
+// The Secret must either contain the 'username' and 'password' fields, or the
+// 'applicationCredentialID' and 'applicationCredentialSecret' fields. The
+// optional 'domain', 'project' and 'projectDomain' fields scope the token.
+func NewClient(ctx context.Context, opts Options, secret *corev1.Secret) (*Client, error) {
+	if secret == nil {
+		return nil, fmt.Errorf("no bucket credentials found")
+	}
+	if err := ValidateSecret(secret.Data, secret.Name); err != nil {
+		return nil, err
+	}
+
+	authURL, err := authURL(opts.Endpoint, opts.Insecure)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &swift.Connection{
+		AuthUrl:                     authURL,
+		AuthVersion:                 3,
+		Region:                      opts.Region,
+		UserName:                    string(secret.Data["username"]),
+		ApiKey:                      string(secret.Data["password"]),
+		Domain:                      string(secret.Data["domain"]),
+		Tenant:                      string(secret.Data["project"]),
+		TenantDomain:                string(secret.Data["projectDomain"]),
+		ApplicationCredentialId:     string(secret.Data["applicationCredentialID"]),
+		ApplicationCredentialSecret: string(secret.Data["applicationCredentialSecret"]),
+		Retries:                     1,
+	}
+	if opts.Timeout > 0 {
+		conn.ConnectTimeout = opts.Timeout
+		conn.Timeout = opts.Timeout
+	}
+	if opts.ConnectTimeout > 0 {
+		conn.ConnectTimeout = opts.ConnectTimeout
+	}
+	if len(opts.Headers) > 0 || trust.Default() != nil {
+		// the connect timeout is only applied by the swift client to its
+		// default transport
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		bucket.SetConnectTimeout(transport, conn.ConnectTimeout)
+		rt, err := trust.Transport(transport, nil)
+		if err != nil {
+			return nil, err
+		}
+		conn.Transport = bucket.HeaderTransport(rt, opts.Headers)
+	}
+	if err := conn.Authenticate(); err != nil {
+		return nil, fmt.Errorf("keystone authentication failed: %w", err)
+	}
+	return &Client{conn: conn}, nil
+}
+
+// ValidateSecret validates the credential fields of the given Secret data.
+func ValidateSecret(secret map[string][]byte, name string) error {
+	if hasField(secret, "applicationCredentialID") && hasField(secret, "applicationCredentialSecret") {
+		return nil
+	}
+	if hasField(secret, "username") && hasField(secret, "password") {
+		return nil
+	}
+	return fmt.Errorf("invalid '%s' secret data: required fields 'username' and 'password', or 'applicationCredentialID' and 'applicationCredentialSecret'", name)
+}
+
+// BucketExists checks if the container with the provided name exists.
+func (c *Client) BucketExists(ctx context.Context, bucketName string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if _, _, err := c.conn.Container(bucketName); err != nil {
+		if errors.Is(err, ErrorContainerNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// FGetObject gets the object from the container and downloads it to the
+// local path, creating any missing parent directories. It returns the
+// metadata of the object. The download stops once the given context is done.
+func (c *Client) FGetObject(ctx context.Context, bucketName, objectName, localPath string) (bucket.ObjectInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return bucket.ObjectInfo{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return bucket.ObjectInfo{}, err
+	}
+	f, err := os.OpenFile(localPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return bucket.ObjectInfo{}, err
+	}
+	// the swift client does not pass the context to its requests
+	w := throttle.NewWriter(ctx, &contextWriter{ctx: ctx, w: f}, throttle.FromContext(ctx)...)
+	headers, err := c.conn.ObjectGet(bucketName, objectName, w, true, nil)
+	if err != nil {
+		f.Close()
+		os.Remove(localPath)
+		return bucket.ObjectInfo{}, err
+	}
+	if err := f.Close(); err != nil {
+		return bucket.ObjectInfo{}, err
+	}
+
+	info := bucket.ObjectInfo{
+		Key:         objectName,
+		ContentType: headers["Content-Type"],
+		Metadata:    headers.ObjectMetadata(),
+	}
+	if lastModified, err := http.ParseTime(headers["Last-Modified"]); err == nil {
+		info.LastModified = lastModified
+	}
+	return info, nil
+}
+
+// ListObjects calls fn with the name and the hash of every object in the
+// container, skipping pseudo directories. It stops at the first error
+// returned by fn or the server.
+func (c *Client) ListObjects(ctx context.Context, bucketName string, fn func(objectName, etag string) error) error {
+	return bucket.ListPages(ctx, c, bucketName, bucket.ListOptions{}, fn)
+}
+
+// ListObjectsPage lists a page of the objects of the container, skipping
+// pseudo directories. The continuation token is the marker of the Swift API,
+// the name of the last object of the previous page.
+func (c *Client) ListObjectsPage(ctx context.Context, bucketName string, opts bucket.ListOptions) (bucket.ObjectsPage, error) {
+	if err := ctx.Err(); err != nil {
+		return bucket.ObjectsPage{}, err
+	}
+	limit := opts.MaxKeys
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	marker := opts.ContinuationToken
+	if marker == "" {
+		marker = opts.StartAfter
+	}
+	objects, err := c.conn.Objects(bucketName, &swift.ObjectsOpts{Marker: marker, Limit: limit})
+	if err != nil {
+		return bucket.ObjectsPage{}, err
+	}
+
+	var page bucket.ObjectsPage
+	if len(objects) >= limit {
+		page.NextContinuationToken = objects[len(objects)-1].Name
+	}
+	for _, object := range objects {
+		if object.PseudoDirectory || strings.HasSuffix(object.Name, "/") {
+			continue
+		}
+		page.Objects = append(page.Objects, bucket.ObjectEntry{Key: object.Name, ETag: object.Hash})
+	}
+	return page, nil
+}
+
+// contextWriter fails the writes once its context is done, to stop the
+// downloads of the swift client.
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w *contextWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// ObjectIsNotFound checks if the error provided is an ErrorObjectNotFound.
+func ObjectIsNotFound(err error) bool {
+	return errors.Is(err, ErrorObjectNotFound)
+}
+
+// ObjectIsNotFound checks if the error provided is an ErrorObjectNotFound.
+func (c *Client) ObjectIsNotFound(err error) bool {
+	return ObjectIsNotFound(err)
+}
+
+// authURL composes the Keystone auth URL from the given endpoint.
+func authURL(endpoint string, insecure bool) (string, error) {
+	scheme := "https"
+	if insecure {
+		scheme = "http"
+	}
+	u, err := url.Parse(fmt.Sprintf("%s://%s", scheme, endpoint))
+	if err != nil {
+		return "", fmt.Errorf("invalid endpoint '%s': %w", endpoint, err)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = DefaultAuthPath
+	}
+	return u.String(), nil
+}
+
+func hasField(secret map[string][]byte, key string) bool {
+	v, ok := secret[key]
+	return ok && len(v) > 0
+}
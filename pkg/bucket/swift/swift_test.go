@@ -0,0 +1,335 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package swift
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	testContainer = "podinfo"
+	testToken     = "token"
+)
+
+var testObjects = map[string]string{
+	"deploy/deployment.yaml": "kind: Deployment",
+	"deploy/service.yaml":    "kind: Service",
+	".sourceignore":          "*.md",
+}
+
+// newTestServer returns a fake Keystone v3 and Swift API server.
+func newTestServer(t *testing.T) *httptest.Server {
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/auth/tokens", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Auth struct {
+				Identity struct {
+					Password struct {
+						User struct {
+							Name     string `json:"name"`
+							Password string `json:"password"`
+						} `json:"user"`
+					} `json:"password"`
+				} `json:"identity"`
+			} `json:"auth"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if u := body.Auth.Identity.Password.User; u.Name != "user" || u.Password != "password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("X-Subject-Token", testToken)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token":{"expires_at":"%s","catalog":[{"type":"object-store","endpoints":[{"interface":"public","region":"RegionOne","url":"%s/v1/AUTH_test"}]}]}}`,
+			time.Now().Add(time.Hour).UTC().Format(time.RFC3339), server.URL)
+	})
+	mux.HandleFunc("/v1/AUTH_test/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Auth-Token") != testToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/v1/AUTH_test/"), "/", 2)
+		if parts[0] != testContainer {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if len(parts) == 1 || parts[1] == "" {
+			if r.Method == http.MethodHead {
+				w.Header().Set("X-Container-Bytes-Used", "0")
+				w.Header().Set("X-Container-Object-Count", fmt.Sprint(len(testObjects)))
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			var names []string
+			for name := range testObjects {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			var list []map[string]interface{}
+			for _, name := range names {
+				list = append(list, map[string]interface{}{
+					"name":  name,
+					"bytes": len(testObjects[name]),
+					"hash":  fmt.Sprintf("%x", md5.Sum([]byte(testObjects[name]))),
+				})
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(list)
+			return
+		}
+		content, ok := testObjects[parts[1]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Etag", fmt.Sprintf("%x", md5.Sum([]byte(content))))
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Header().Set("Last-Modified", "Tue, 21 Sep 2021 11:40:05 GMT")
+		w.Header().Set("X-Object-Meta-Owner", "flux")
+		w.Write([]byte(content))
+	})
+	server = httptest.NewServer(mux)
+	return server
+}
+
+func newTestClient(t *testing.T, server *httptest.Server) *Client {
+	t.Helper()
+	client, err := NewClient(context.TODO(), Options{
+		Endpoint: strings.TrimPrefix(server.URL, "http://"),
+		Insecure: true,
+		Timeout:  5 * time.Second,
+	}, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "swift-credentials"},
+		Data: map[string][]byte{
+			"username": []byte("user"),
+			"password": []byte("password"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return client
+}
+
+func TestNewClient(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		secret  *corev1.Secret
+		wantErr string
+	}{
+		{
+			name:    "no secret",
+			wantErr: "no bucket credentials found",
+		},
+		{
+			name:    "missing fields",
+			secret:  &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "swift"}, Data: map[string][]byte{"username": []byte("user")}},
+			wantErr: "invalid 'swift' secret data",
+		},
+		{
+			name: "invalid credentials",
+			secret: &corev1.Secret{Data: map[string][]byte{
+				"username": []byte("user"),
+				"password": []byte("invalid"),
+			}},
+			wantErr: "keystone authentication failed",
+		},
+		{
+			name: "valid credentials",
+			secret: &corev1.Secret{Data: map[string][]byte{
+				"username": []byte("user"),
+				"password": []byte("password"),
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClient(context.TODO(), Options{
+				Endpoint: strings.TrimPrefix(server.URL, "http://"),
+				Insecure: true,
+			}, tt.secret)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("NewClient() unexpected error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("NewClient() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string][]byte
+		wantErr bool
+	}{
+		{"password", map[string][]byte{"username": []byte("u"), "password": []byte("p")}, false},
+		{"application credential", map[string][]byte{"applicationCredentialID": []byte("id"), "applicationCredentialSecret": []byte("s")}, false},
+		{"empty password", map[string][]byte{"username": []byte("u"), "password": []byte("")}, true},
+		{"empty", map[string][]byte{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateSecret(tt.data, "secret"); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClient_BucketExists(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	exists, err := client.BucketExists(context.TODO(), testContainer)
+	if err != nil || !exists {
+		t.Errorf("BucketExists(%q) = %v, %v, want true", testContainer, exists, err)
+	}
+	exists, err = client.BucketExists(context.TODO(), "invalid")
+	if err != nil || exists {
+		t.Errorf("BucketExists(%q) = %v, %v, want false", "invalid", exists, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	if _, err := client.BucketExists(ctx, testContainer); !errors.Is(err, context.Canceled) {
+		t.Errorf("BucketExists() with a done context error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestClient_FGetObject(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	tmpDir, err := os.MkdirTemp("", "swift-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	localPath := filepath.Join(tmpDir, "deploy", "deployment.yaml")
+	info, err := client.FGetObject(context.TODO(), testContainer, "deploy/deployment.yaml", localPath)
+	if err != nil {
+		t.Fatalf("FGetObject() error = %v", err)
+	}
+	if info.Key != "deploy/deployment.yaml" || info.ContentType != "application/yaml" || info.Metadata["owner"] != "flux" {
+		t.Errorf("FGetObject() info = %+v", info)
+	}
+	if want := time.Date(2021, time.September, 21, 11, 40, 5, 0, time.UTC); !info.LastModified.Equal(want) {
+		t.Errorf("FGetObject() last modified = %s, want %s", info.LastModified, want)
+	}
+	b, err := os.ReadFile(localPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != testObjects["deploy/deployment.yaml"] {
+		t.Errorf("FGetObject() content = %q, want %q", string(b), testObjects["deploy/deployment.yaml"])
+	}
+
+	missingPath := filepath.Join(tmpDir, "missing")
+	_, err = client.FGetObject(context.TODO(), testContainer, "missing", missingPath)
+	if !ObjectIsNotFound(err) {
+		t.Errorf("FGetObject() error = %v, want object not found", err)
+	}
+	if _, err := os.Stat(missingPath); !os.IsNotExist(err) {
+		t.Errorf("FGetObject() left behind %s", missingPath)
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	canceledPath := filepath.Join(tmpDir, "canceled")
+	if _, err := client.FGetObject(ctx, testContainer, "deploy/service.yaml", canceledPath); !errors.Is(err, context.Canceled) {
+		t.Errorf("FGetObject() with a done context error = %v, want %v", err, context.Canceled)
+	}
+	if _, err := os.Stat(canceledPath); !os.IsNotExist(err) {
+		t.Errorf("FGetObject() left behind %s", canceledPath)
+	}
+	if _, err := (&contextWriter{ctx: ctx, w: io.Discard}).Write([]byte("a")); !errors.Is(err, context.Canceled) {
+		t.Errorf("contextWriter.Write() with a done context error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestClient_ListObjects(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	var got []string
+	if err := client.ListObjects(context.TODO(), testContainer, func(objectName, etag string) error {
+		if want := fmt.Sprintf("%x", md5.Sum([]byte(testObjects[objectName]))); etag != want {
+			t.Errorf("ListObjects() etag of %s = %q, want %q", objectName, etag, want)
+		}
+		got = append(got, objectName)
+		return nil
+	}); err != nil {
+		t.Fatalf("ListObjects() error = %v", err)
+	}
+	want := []string{".sourceignore", "deploy/deployment.yaml", "deploy/service.yaml"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ListObjects() = %v, want %v", got, want)
+	}
+}
+
+func Test_authURL(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		insecure bool
+		want     string
+	}{
+		{"keystone.example.com", false, "https://keystone.example.com/v3"},
+		{"keystone.example.com:5000", true, "http://keystone.example.com:5000/v3"},
+		{"keystone.example.com/identity/v3", false, "https://keystone.example.com/identity/v3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			got, err := authURL(tt.endpoint, tt.insecure)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("authURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/fluxcd/source-controller/pkg/trust"
+)
+
+// HeaderTransport returns an http.RoundTripper setting the given headers on
+// the requests sent with the given http.RoundTripper, replacing the values
+// set by the client. If there are no headers, the given http.RoundTripper is
+// returned as is.
+func HeaderTransport(rt http.RoundTripper, headers http.Header) http.RoundTripper {
+	if len(headers) == 0 {
+		return rt
+	}
+	if rt == nil {
+		rt = trust.DefaultTransport
+	}
+	return &headerTransport{rt: rt, headers: headers}
+}
+
+type headerTransport struct {
+	rt      http.RoundTripper
+	headers http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header[k] = v
+	}
+	return t.rt.RoundTrip(req)
+}
+
+// SetConnectTimeout sets the timeout for establishing the connections of the
+// given http.Transport, including the TLS handshake, if not 0.
+func SetConnectTimeout(t *http.Transport, timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	t.DialContext = (&net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	t.TLSHandshakeTimeout = timeout
+}
@@ -0,0 +1,417 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+	gogithttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"github.com/fluxcd/source-controller/pkg/git"
+	"github.com/fluxcd/source-controller/pkg/throttle"
+)
+
+// CheckoutStrategyForRef returns the strategy fetching the archive of the
+// given reference from the REST API of the provider of the options.
+func CheckoutStrategyForRef(ref *sourcev1.GitRepositoryRef, opt git.CheckoutOptions) (git.CheckoutStrategy, error) {
+	switch {
+	case opt.ArchiveProvider != sourcev1.GitHubArchiveProvider && opt.ArchiveProvider != sourcev1.GitLabArchiveProvider:
+		return nil, fmt.Errorf("invalid archive provider '%s'", opt.ArchiveProvider)
+	case ref != nil && ref.SemVer != "":
+		return nil, fmt.Errorf("SemVer references are not supported by the archive provider")
+	case opt.RecurseSubmodules:
+		return nil, fmt.Errorf("submodules are not supported by the archive provider")
+	case opt.FullHistory:
+		return nil, fmt.Errorf("history rewrite policies are not supported by the archive provider")
+	case opt.BundleURL != "":
+		return nil, fmt.Errorf("bundles are not supported by the archive provider")
+	}
+
+	c := &CheckoutArchive{
+		provider: opt.ArchiveProvider,
+		branch:   git.DefaultBranch,
+		headers:  opt.Headers,
+	}
+	if ref != nil {
+		if ref.Branch != "" {
+			c.branch = ref.Branch
+		}
+		c.tag = ref.Tag
+		c.commit = ref.Commit
+	}
+	return c, nil
+}
+
+// CheckoutArchive fetches the archive of a branch, tag or commit from the
+// REST API of a Git provider, and extracts it to the checkout path.
+type CheckoutArchive struct {
+	provider string
+	branch   string
+	tag      string
+	commit   string
+	headers  http.Header
+}
+
+func (c *CheckoutArchive) Checkout(ctx context.Context, path, repositoryURL string, auth *git.Auth) (git.Commit, string, error) {
+	api, err := newClient(c.provider, repositoryURL, auth, c.headers)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// the commit takes precedence over the tag, as with the clones
+	ref, name := c.branch, c.branch
+	switch {
+	case c.commit != "":
+		ref = c.commit
+	case c.tag != "":
+		ref, name = c.tag, c.tag
+	}
+	commit, err := api.commit(ctx, ref)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to resolve '%s' of '%s', error: %w", ref, repositoryURL, err)
+	}
+	if err := api.download(ctx, commit.hash, path); err != nil {
+		return nil, "", fmt.Errorf("unable to fetch archive of '%s', error: %w", repositoryURL, err)
+	}
+	return commit, fmt.Sprintf("%s/%s", name, commit.hash), nil
+}
+
+// client is the client of the REST API of a Git provider for a repository.
+type client struct {
+	provider string
+	// baseURL is the URL of the API
+	baseURL string
+	// project is the path of the repository, e.g. 'owner/repo'
+	project string
+	token   string
+	headers http.Header
+	http    *http.Client
+}
+
+// newClient returns the client of the REST API of the provider for the
+// repository with the given HTTP/S URL. The API token is the password of
+// the basic auth.
+func newClient(provider, repositoryURL string, auth *git.Auth, headers http.Header) (*client, error) {
+	u, err := url.Parse(repositoryURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository URL '%s': %w", repositoryURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid repository URL '%s': scheme must be http or https", repositoryURL)
+	}
+	project := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	if strings.Count(project, "/") < 1 {
+		return nil, fmt.Errorf("invalid repository URL '%s': path must be the one of a repository", repositoryURL)
+	}
+
+	c := &client{
+		provider: provider,
+		project:  project,
+		headers:  headers,
+		http:     &http.Client{Transport: throttle.Transport(nil)},
+	}
+	switch {
+	case provider == sourcev1.GitLabArchiveProvider:
+		c.baseURL = fmt.Sprintf("%s://%s/api/v4", u.Scheme, u.Host)
+	case u.Host == "github.com":
+		c.baseURL = "https://api.github.com"
+	default:
+		// GitHub Enterprise Server
+		c.baseURL = fmt.Sprintf("%s://%s/api/v3", u.Scheme, u.Host)
+	}
+
+	if auth != nil {
+		switch a := auth.AuthMethod.(type) {
+		case nil:
+		case *gogithttp.BasicAuth:
+			c.token = a.Password
+		default:
+			return nil, fmt.Errorf("the '%s' auth method is not supported by the archive provider", a.Name())
+		}
+		if len(auth.CABundle) > 0 {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(auth.CABundle) {
+				return nil, fmt.Errorf("invalid CA bundle")
+			}
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+			c.http.Transport = throttle.Transport(transport)
+		}
+	}
+	return c, nil
+}
+
+// commit returns the commit the given reference resolves to.
+func (c *client) commit(ctx context.Context, ref string) (*Commit, error) {
+	var u string
+	if c.provider == sourcev1.GitLabArchiveProvider {
+		u = fmt.Sprintf("%s/projects/%s/repository/commits/%s", c.baseURL, escape(c.project), escape(ref))
+	} else {
+		u = fmt.Sprintf("%s/repos/%s/commits/%s", c.baseURL, c.project, escape(ref))
+	}
+	resp, err := c.get(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if c.provider == sourcev1.GitLabArchiveProvider {
+		var commit gitlabCommit
+		if err := json.NewDecoder(resp.Body).Decode(&commit); err != nil {
+			return nil, fmt.Errorf("invalid commit response: %w", err)
+		}
+		return commit.toCommit(), nil
+	}
+	var commit githubCommit
+	if err := json.NewDecoder(resp.Body).Decode(&commit); err != nil {
+		return nil, fmt.Errorf("invalid commit response: %w", err)
+	}
+	return commit.toCommit(), nil
+}
+
+// download extracts the archive of the commit with the given hash to the
+// given path.
+func (c *client) download(ctx context.Context, hash, path string) error {
+	var u string
+	if c.provider == sourcev1.GitLabArchiveProvider {
+		u = fmt.Sprintf("%s/projects/%s/repository/archive.tar.gz?sha=%s", c.baseURL, escape(c.project), hash)
+	} else {
+		u = fmt.Sprintf("%s/repos/%s/tarball/%s", c.baseURL, c.project, hash)
+	}
+	resp, err := c.get(ctx, u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return extract(resp.Body, path)
+}
+
+// get sends a GET request with the extra headers and the token to the given
+// URL, and returns the response if its status is 200.
+func (c *client) get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range c.headers {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	if c.token != "" {
+		if c.provider == sourcev1.GitLabArchiveProvider {
+			req.Header.Set("PRIVATE-TOKEN", c.token)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &StatusError{
+			URL:   u,
+			Code:  resp.StatusCode,
+			Delay: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+	return resp, nil
+}
+
+// StatusError is the error returned for the unexpected status codes of the
+// provider API.
+type StatusError struct {
+	URL  string
+	Code int
+	// Delay is the duration the provider asked to wait for before the next
+	// request in the Retry-After header of the response, if any.
+	Delay time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d from '%s'", e.Code, e.URL)
+}
+
+// StatusCode returns the status code of the response.
+func (e *StatusError) StatusCode() int {
+	return e.Code
+}
+
+// RetryAfter returns the duration the provider asked to wait for before the
+// next request, or 0 if it did not.
+func (e *StatusError) RetryAfter() time.Duration {
+	return e.Delay
+}
+
+// parseRetryAfter returns the duration from the given time until the next
+// request is allowed by the given value of a Retry-After header, which is
+// either a number of seconds or an HTTP date. It returns 0 if the value is
+// empty, invalid or in the past.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	t, err := http.ParseTime(v)
+	if err != nil || !t.After(now) {
+		return 0
+	}
+	return t.Sub(now).Round(time.Second)
+}
+
+// escape escapes the given value as a single path segment of a URL.
+func escape(v string) string {
+	return strings.ReplaceAll(url.PathEscape(v), "/", "%2F")
+}
+
+// extract extracts the given gzipped tarball to the given directory,
+// without the top directory the providers nest the files of their archives
+// in.
+func extract(r io.Reader, dir string) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("invalid archive: %w", err)
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid archive: %w", err)
+		}
+		parts := strings.SplitN(strings.TrimPrefix(hdr.Name, "./"), "/", 2)
+		if len(parts) < 2 || parts[1] == "" {
+			continue
+		}
+		target, err := securejoin.SecureJoin(dir, parts[1])
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(hdr.Mode)&0755|0644)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// githubCommit is a commit of the GitHub REST API.
+type githubCommit struct {
+	SHA    string `json:"sha"`
+	Commit struct {
+		Author       githubSignature `json:"author"`
+		Committer    githubSignature `json:"committer"`
+		Message      string          `json:"message"`
+		Verification struct {
+			Signature string `json:"signature"`
+		} `json:"verification"`
+	} `json:"commit"`
+}
+
+type githubSignature struct {
+	Name  string    `json:"name"`
+	Email string    `json:"email"`
+	Date  time.Time `json:"date"`
+}
+
+func (c githubCommit) toCommit() *Commit {
+	return &Commit{
+		hash: c.SHA,
+		info: git.CommitInfo{
+			Author:    git.Signature{Name: c.Commit.Author.Name, Email: c.Commit.Author.Email, When: c.Commit.Author.Date},
+			Committer: git.Signature{Name: c.Commit.Committer.Name, Email: c.Commit.Committer.Email, When: c.Commit.Committer.Date},
+			Message:   c.Commit.Message,
+			Signed:    c.Commit.Verification.Signature != "",
+		},
+	}
+}
+
+// gitlabCommit is a commit of the GitLab REST API, which does not include
+// the signature.
+type gitlabCommit struct {
+	ID             string    `json:"id"`
+	AuthorName     string    `json:"author_name"`
+	AuthorEmail    string    `json:"author_email"`
+	AuthoredDate   time.Time `json:"authored_date"`
+	CommitterName  string    `json:"committer_name"`
+	CommitterEmail string    `json:"committer_email"`
+	CommittedDate  time.Time `json:"committed_date"`
+	Message        string    `json:"message"`
+}
+
+func (c gitlabCommit) toCommit() *Commit {
+	return &Commit{
+		hash: c.ID,
+		info: git.CommitInfo{
+			Author:    git.Signature{Name: c.AuthorName, Email: c.AuthorEmail, When: c.AuthoredDate},
+			Committer: git.Signature{Name: c.CommitterName, Email: c.CommitterEmail, When: c.CommittedDate},
+			Message:   c.Message,
+		},
+	}
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gogithttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"github.com/fluxcd/source-controller/pkg/git"
+)
+
+const testHash = "b69b2e2f8c5beb1b09b4ea4d6a6d7c5b7a7e1e3b"
+
+// testArchive returns a gzipped tarball of the given files nested in the
+// given top directory, as served by the providers.
+func testArchive(t *testing.T, top string, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	if err := tw.WriteHeader(&tar.Header{Name: "pax_global_header", Typeflag: tar.TypeXGlobalHeader,
+		PAXRecords: map[string]string{"comment": testHash}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: top + "/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: top + "/" + name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCheckoutArchive_Checkout(t *testing.T) {
+	files := map[string]string{"README.md": "podinfo", "deploy/app.yaml": "kind: Deployment"}
+
+	tests := []struct {
+		name         string
+		provider     string
+		ref          *sourcev1.GitRepositoryRef
+		routes       map[string]string
+		authHeader   string
+		wantRevision string
+	}{
+		{
+			name:     "github branch",
+			provider: sourcev1.GitHubArchiveProvider,
+			ref:      &sourcev1.GitRepositoryRef{Branch: "feature/x"},
+			routes: map[string]string{
+				"/api/v3/repos/stefanprodan/podinfo/commits/feature%2Fx": `{"sha": "` + testHash + `", "commit": {"author": {"name": "Jane", "email": "jane@example.com", "date": "2021-08-01T10:00:00Z"}, "message": "Add app", "verification": {"signature": "-----BEGIN PGP SIGNATURE-----"}}}`,
+				"/api/v3/repos/stefanprodan/podinfo/tarball/" + testHash: "stefanprodan-podinfo-b69b2e2",
+			},
+			authHeader:   "Authorization",
+			wantRevision: "feature/x/" + testHash,
+		},
+		{
+			name:     "gitlab tag",
+			provider: sourcev1.GitLabArchiveProvider,
+			ref:      &sourcev1.GitRepositoryRef{Tag: "v1.0.0"},
+			routes: map[string]string{
+				"/api/v4/projects/stefanprodan%2Fpodinfo/repository/commits/v1.0.0": `{"id": "` + testHash + `", "author_name": "Jane", "author_email": "jane@example.com", "authored_date": "2021-08-01T10:00:00Z", "message": "Add app"}`,
+				"/api/v4/projects/stefanprodan%2Fpodinfo/repository/archive.tar.gz": "podinfo-v1.0.0-" + testHash,
+			},
+			authHeader:   "PRIVATE-TOKEN",
+			wantRevision: "v1.0.0/" + testHash,
+		},
+		{
+			name:     "github commit",
+			provider: sourcev1.GitHubArchiveProvider,
+			ref:      &sourcev1.GitRepositoryRef{Commit: testHash},
+			routes: map[string]string{
+				"/api/v3/repos/stefanprodan/podinfo/commits/" + testHash: `{"sha": "` + testHash + `", "commit": {"message": "Add app"}}`,
+				"/api/v3/repos/stefanprodan/podinfo/tarball/" + testHash: "stefanprodan-podinfo-b69b2e2",
+			},
+			authHeader:   "Authorization",
+			wantRevision: git.DefaultBranch + "/" + testHash,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get(tt.authHeader) == "" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				route, ok := tt.routes[r.URL.EscapedPath()]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				if filepath.Ext(r.URL.Path) == ".gz" || filepath.Base(filepath.Dir(r.URL.Path)) == "tarball" {
+					if sha := r.URL.Query().Get("sha"); tt.provider == sourcev1.GitLabArchiveProvider && sha != testHash {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+					_, _ = w.Write(testArchive(t, route, files))
+					return
+				}
+				_, _ = w.Write([]byte(route))
+			}))
+			defer srv.Close()
+
+			s, err := CheckoutStrategyForRef(tt.ref, git.CheckoutOptions{ArchiveProvider: tt.provider})
+			if err != nil {
+				t.Fatal(err)
+			}
+			dir := t.TempDir()
+			auth := &git.Auth{AuthMethod: &gogithttp.BasicAuth{Username: "git", Password: "token"}}
+			commit, revision, err := s.Checkout(context.TODO(), dir, srv.URL+"/stefanprodan/podinfo.git", auth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if revision != tt.wantRevision {
+				t.Errorf("revision = %s, want %s", revision, tt.wantRevision)
+			}
+			if commit.Hash() != testHash {
+				t.Errorf("hash = %s, want %s", commit.Hash(), testHash)
+			}
+			if commit.Info().Message != "Add app" {
+				t.Errorf("message = %q, want %q", commit.Info().Message, "Add app")
+			}
+			for name, content := range files {
+				b, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(b) != content {
+					t.Errorf("%s = %q, want %q", name, b, content)
+				}
+			}
+
+			if _, _, err := s.Checkout(context.TODO(), t.TempDir(), srv.URL+"/stefanprodan/podinfo.git", &git.Auth{}); err == nil {
+				t.Fatal("expected an error without token")
+			} else {
+				var statusErr *StatusError
+				if !errors.As(err, &statusErr) || statusErr.StatusCode() != http.StatusUnauthorized {
+					t.Errorf("error = %v, want an unauthorized status error", err)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckoutStrategyForRef(t *testing.T) {
+	tests := []struct {
+		name    string
+		ref     *sourcev1.GitRepositoryRef
+		opt     git.CheckoutOptions
+		wantErr bool
+	}{
+		{name: "default branch", opt: git.CheckoutOptions{ArchiveProvider: sourcev1.GitHubArchiveProvider}},
+		{name: "invalid provider", opt: git.CheckoutOptions{ArchiveProvider: "bitbucket"}, wantErr: true},
+		{name: "semver", ref: &sourcev1.GitRepositoryRef{SemVer: ">=1.0.0"}, opt: git.CheckoutOptions{ArchiveProvider: sourcev1.GitLabArchiveProvider}, wantErr: true},
+		{name: "submodules", opt: git.CheckoutOptions{ArchiveProvider: sourcev1.GitLabArchiveProvider, RecurseSubmodules: true}, wantErr: true},
+		{name: "full history", opt: git.CheckoutOptions{ArchiveProvider: sourcev1.GitHubArchiveProvider, FullHistory: true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CheckoutStrategyForRef(tt.ref, tt.opt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckoutStrategyForRef() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_newClient(t *testing.T) {
+	tests := []struct {
+		url         string
+		provider    string
+		wantBaseURL string
+		wantProject string
+		wantErr     bool
+	}{
+		{url: "https://github.com/fluxcd/flux2", provider: sourcev1.GitHubArchiveProvider, wantBaseURL: "https://api.github.com", wantProject: "fluxcd/flux2"},
+		{url: "https://github.example.com/fluxcd/flux2.git", provider: sourcev1.GitHubArchiveProvider, wantBaseURL: "https://github.example.com/api/v3", wantProject: "fluxcd/flux2"},
+		{url: "https://gitlab.com/group/subgroup/repo.git", provider: sourcev1.GitLabArchiveProvider, wantBaseURL: "https://gitlab.com/api/v4", wantProject: "group/subgroup/repo"},
+		{url: "ssh://git@github.com/fluxcd/flux2", provider: sourcev1.GitHubArchiveProvider, wantErr: true},
+		{url: "https://github.com/fluxcd", provider: sourcev1.GitHubArchiveProvider, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			c, err := newClient(tt.provider, tt.url, nil, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newClient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if c.baseURL != tt.wantBaseURL || c.project != tt.wantProject {
+				t.Errorf("newClient() = %s %s, want %s %s", c.baseURL, c.project, tt.wantBaseURL, tt.wantProject)
+			}
+		})
+	}
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{value: "", want: 0},
+		{value: "120", want: 2 * time.Minute},
+		{value: " 30 ", want: 30 * time.Second},
+		{value: "-1", want: 0},
+		{value: now.Add(90 * time.Second).Format(http.TimeFormat), want: 90 * time.Second},
+		{value: now.Add(-time.Minute).Format(http.TimeFormat), want: 0},
+		{value: "soon", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value, now); got != tt.want {
+				t.Errorf("parseRetryAfter() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
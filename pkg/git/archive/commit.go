@@ -0,0 +1,52 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/fluxcd/source-controller/pkg/git"
+)
+
+// Commit is a commit resolved with the REST API of a Git provider, whose
+// objects are not fetched.
+type Commit struct {
+	hash string
+	info git.CommitInfo
+}
+
+func (c *Commit) Hash() string {
+	return c.hash
+}
+
+// Verify returns an error, as the signature of the commit is not fetched.
+func (c *Commit) Verify(secret corev1.Secret) error {
+	return fmt.Errorf("PGP signature of commit '%s' can't be verified: not supported by the archive provider", c.hash)
+}
+
+// IsDescendantOf returns an error, as the history of the commit is not
+// fetched.
+func (c *Commit) IsDescendantOf(hash string) (bool, error) {
+	return false, fmt.Errorf("history of commit '%s' is not available with the archive provider", c.hash)
+}
+
+// Info returns the author, committer and message of the commit.
+func (c *Commit) Info() git.CommitInfo {
+	return c.info
+}
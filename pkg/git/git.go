@@ -18,6 +18,8 @@ package git
 
 import (
 	"context"
+	"net/http"
+	"time"
 
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	git2go "github.com/libgit2/git2go/v31"
@@ -29,11 +31,72 @@ const (
 	DefaultBranch            = "master"
 	DefaultPublicKeyAuthUser = "git"
 	CAFile                   = "caFile"
+	TLSCertFile              = "tls.crt"
+	TLSKeyFile               = "tls.key"
 )
 
 type Commit interface {
 	Verify(secret corev1.Secret) error
 	Hash() string
+	// IsDescendantOf returns true if the commit with the given hash is
+	// reachable from the commit, false if the history was rewritten.
+	IsDescendantOf(hash string) (bool, error)
+	// Info returns the author, committer and message of the commit.
+	Info() CommitInfo
+}
+
+// Signature identifies the author or the committer of a commit.
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time
+}
+
+// CommitInfo holds the metadata of a commit.
+type CommitInfo struct {
+	Author    Signature
+	Committer Signature
+	Message   string
+	// Signed is true if the commit has a PGP signature, verified or not.
+	Signed bool
+}
+
+// TagInfo holds the metadata of the tag a commit was checked out from.
+type TagInfo struct {
+	// Name is the name of the tag.
+	Name string
+	// Annotated is true for an annotated tag, false for a lightweight one.
+	Annotated bool
+	// Tagger is the tagger of an annotated tag.
+	Tagger Signature
+	// Signed is true if the annotated tag has a PGP signature, verified or
+	// not.
+	Signed bool
+}
+
+// TaggedCommit is implemented by the commits which may have been checked out
+// from a tag.
+type TaggedCommit interface {
+	// Tag returns the metadata of the tag the commit was checked out from,
+	// or nil if it was not checked out from a tag.
+	Tag() *TagInfo
+	// VerifyTag returns an error if the PGP signature of the annotated tag
+	// the commit was checked out from can't be verified.
+	VerifyTag(secret corev1.Secret) error
+}
+
+// ChangeCommit is implemented by the commits which can tell the files they
+// change and the keys their PGP signature is verified by, for the changes to
+// be checked against a signer policy.
+type ChangeCommit interface {
+	// ChangedFiles returns the paths of the files changed since the commit
+	// with the given hash, or since the first parent of the commit if the
+	// hash is empty or not reachable from the commit. All the files are
+	// returned for a root commit.
+	ChangedFiles(since string) ([]string, error)
+	// Signers returns the names of the keys of the given secret the PGP
+	// signature of the commit is verified by.
+	Signers(secret corev1.Secret) []string
 }
 
 type CheckoutStrategy interface {
@@ -43,6 +106,55 @@ type CheckoutStrategy interface {
 type CheckoutOptions struct {
 	GitImplementation string
 	RecurseSubmodules bool
+	// SubmoduleDepth is the maximum depth of the nested submodules
+	// initialized when RecurseSubmodules is set, the submodules of the
+	// repository being at depth 1. Defaults to the implementation default
+	// when zero.
+	SubmoduleDepth int
+	// SubmodulePaths are the paths of the submodules initialized when
+	// RecurseSubmodules is set, relative to the root of the repository.
+	// All the submodules are initialized when empty.
+	SubmodulePaths []string
+	// CheckSubmoduleURL is called with the URL of each submodule before it
+	// is fetched, the checkout failing with the error it returns, if any.
+	CheckSubmoduleURL func(url string) error
+	// Headers are extra headers sent with the requests to HTTP/S
+	// repositories.
+	Headers http.Header
+	// FullHistory clones the full history of branches and tags instead of
+	// their last commit, for their previous revisions to be reachable.
+	FullHistory bool
+	// BundleURL is the HTTP/S URL of a Git bundle to bootstrap the clone
+	// from, before fetching the missing objects from the repository.
+	BundleURL string
+	// CacheDir is the directory of the bare repository the objects are
+	// fetched into, keeping them across checkouts so that only the new
+	// objects are fetched. Only supported by go-git for the branch, tag and
+	// commit references without submodules.
+	CacheDir string
+	// ArchiveProvider is the Git provider the archive of the reference is
+	// fetched from with its REST API, instead of cloning the repository.
+	ArchiveProvider string
+	// PartialClone fetches the blobs of the files not left out by its
+	// filter only, from the servers supporting the filters of the Git
+	// protocol v2, taking precedence over the BundleURL and CacheDir. Only
+	// supported by go-git for the branch and tag references of HTTP/S
+	// repositories without submodules, the others are cloned fully.
+	PartialClone *PartialCloneOptions
+}
+
+// PathFilter returns true if the file at the given slash separated path,
+// relative to the root of the repository, is left out of the checkout.
+type PathFilter func(path string) bool
+
+// PartialCloneOptions configures the checkout of a partial clone.
+type PartialCloneOptions struct {
+	// IgnoreFile is the name of the files holding ignore patterns, which
+	// are checked out before the others.
+	IgnoreFile string
+	// Filter returns the PathFilter of the other files, given the directory
+	// the IgnoreFile files have been checked out to.
+	Filter func(dir string) (PathFilter, error)
 }
 
 // TODO(hidde): candidate for refactoring, so that we do not directly
@@ -0,0 +1,234 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gogit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	gohttp "net/http"
+	"strings"
+
+	extgogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+
+	"github.com/fluxcd/source-controller/pkg/trust"
+)
+
+const (
+	bundleV2Signature = "# v2 git bundle"
+	bundleV3Signature = "# v3 git bundle"
+
+	// bundleRefPrefix is the prefix of the references created for the tips
+	// of the bundle, so that they are advertised as haves to the remote on
+	// the incremental fetch.
+	bundleRefPrefix = "refs/bundle/"
+)
+
+// clone clones the repository with the given options to the path. If the
+// cache directory is set and the submodules are not recursed, the objects
+// are fetched into the bare repository of the directory, which keeps the
+// previously fetched objects, and the reference is checked out to the path.
+// If the bundle URL is set, the objects of the bundle are loaded first into
+// the empty repository, and only the missing objects of the reference are
+// fetched from the repository.
+func clone(ctx context.Context, path string, opts *extgogit.CloneOptions, bundleURL, cacheDir string) (*extgogit.Repository, error) {
+	var (
+		repo  *extgogit.Repository
+		empty = true
+		err   error
+	)
+	switch {
+	case cacheDir != "" && opts.RecurseSubmodules == extgogit.NoRecurseSubmodules:
+		repo, empty, err = openCache(cacheDir, path)
+	case bundleURL != "":
+		repo, err = extgogit.PlainInit(path, false)
+	default:
+		return extgogit.PlainCloneContext(ctx, path, false, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if bundleURL != "" && empty {
+		if err := loadBundle(ctx, repo, bundleURL); err != nil {
+			return nil, fmt.Errorf("unable to load bundle '%s': %w", bundleURL, err)
+		}
+	}
+
+	local := opts.ReferenceName
+	if local.IsBranch() {
+		local = plumbing.NewRemoteReferenceName(opts.RemoteName, opts.ReferenceName.Short())
+	}
+	refSpec := config.RefSpec(fmt.Sprintf("+%s:%s", opts.ReferenceName, local))
+	// the remote of a cached repository may have been fetched with another
+	// URL, e.g. the one of an SSH proxy
+	if err := repo.DeleteRemote(opts.RemoteName); err != nil && err != extgogit.ErrRemoteNotFound {
+		return nil, err
+	}
+	remote, err := repo.CreateRemote(&config.RemoteConfig{
+		Name:  opts.RemoteName,
+		URLs:  []string{opts.URL},
+		Fetch: []config.RefSpec{refSpec},
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = remote.FetchContext(ctx, &extgogit.FetchOptions{
+		RemoteName: opts.RemoteName,
+		RefSpecs:   []config.RefSpec{refSpec},
+		Auth:       opts.Auth,
+		Tags:       extgogit.NoTags,
+		CABundle:   opts.CABundle,
+	})
+	if err != nil && err != extgogit.NoErrAlreadyUpToDate {
+		return nil, err
+	}
+
+	ref, err := repo.Reference(local, true)
+	if err != nil {
+		return nil, fmt.Errorf("git reference '%s' not found: %w", opts.ReferenceName, err)
+	}
+	checkout := &extgogit.CheckoutOptions{Force: true}
+	if opts.ReferenceName.IsBranch() {
+		branch := plumbing.NewHashReference(opts.ReferenceName, ref.Hash())
+		if err := repo.Storer.SetReference(branch); err != nil {
+			return nil, err
+		}
+		checkout.Branch = opts.ReferenceName
+	} else {
+		hash := ref.Hash()
+		if tag, err := repo.TagObject(hash); err == nil {
+			hash = tag.Target
+		}
+		checkout.Hash = hash
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("git worktree error: %w", err)
+	}
+	if err := w.Checkout(checkout); err != nil {
+		return nil, fmt.Errorf("git checkout error: %w", err)
+	}
+
+	if opts.RecurseSubmodules != extgogit.NoRecurseSubmodules {
+		subs, err := w.Submodules()
+		if err != nil {
+			return nil, fmt.Errorf("git submodules error: %w", err)
+		}
+		if err := subs.UpdateContext(ctx, &extgogit.SubmoduleUpdateOptions{
+			Init:              true,
+			RecurseSubmodules: opts.RecurseSubmodules,
+			Auth:              opts.Auth,
+		}); err != nil {
+			return nil, fmt.Errorf("git submodules update error: %w", err)
+		}
+	}
+	return repo, nil
+}
+
+// loadBundle downloads the Git bundle from the given URL and writes its
+// objects to the storage of the repository.
+func loadBundle(ctx context.Context, repo *extgogit.Repository, url string) error {
+	req, err := gohttp.NewRequestWithContext(ctx, gohttp.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := (&gohttp.Client{Transport: trust.DefaultTransport}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != gohttp.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	refs, err := readBundleHeader(r)
+	if err != nil {
+		return err
+	}
+	if err := packfile.UpdateObjectStorage(repo.Storer, r); err != nil {
+		return fmt.Errorf("unable to write packfile: %w", err)
+	}
+	for name, hash := range refs {
+		if err := repo.Storer.HasEncodedObject(hash); err != nil {
+			continue
+		}
+		ref := plumbing.NewHashReference(plumbing.ReferenceName(bundleRefPrefix+strings.TrimPrefix(name, "refs/")), hash)
+		if err := repo.Storer.SetReference(ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBundleHeader reads the header of a v2 or v3 Git bundle, and returns
+// its references. The bundles with prerequisites are not supported, as the
+// repository is empty when they are loaded.
+func readBundleHeader(r *bufio.Reader) (map[string]plumbing.Hash, error) {
+	signature, err := readBundleLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if signature != bundleV2Signature && signature != bundleV3Signature {
+		return nil, fmt.Errorf("invalid bundle signature '%s'", signature)
+	}
+
+	refs := make(map[string]plumbing.Hash)
+	for {
+		line, err := readBundleLine(r)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case line == "":
+			if len(refs) == 0 {
+				return nil, fmt.Errorf("bundle has no references")
+			}
+			return refs, nil
+		case strings.HasPrefix(line, "@"):
+			if signature == bundleV3Signature && strings.HasPrefix(line, "@object-format=") &&
+				line != "@object-format=sha1" {
+				return nil, fmt.Errorf("unsupported bundle capability '%s'", line)
+			}
+		case strings.HasPrefix(line, "-"):
+			return nil, fmt.Errorf("bundles with prerequisites are not supported")
+		default:
+			fields := strings.SplitN(line, " ", 2)
+			if len(fields) != 2 || !plumbing.IsHash(fields[0]) {
+				return nil, fmt.Errorf("invalid bundle reference '%s'", line)
+			}
+			refs[fields[1]] = plumbing.NewHash(fields[0])
+		}
+	}
+}
+
+// readBundleLine reads a line of the bundle header without the line feed.
+func readBundleLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			return "", fmt.Errorf("unexpected end of bundle header")
+		}
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\n"), nil
+}
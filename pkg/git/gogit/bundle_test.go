@@ -0,0 +1,188 @@
+/*
+Copyright 2020 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gogit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	extgogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/fluxcd/source-controller/pkg/git"
+)
+
+func TestCheckoutBranch_Bundle(t *testing.T) {
+	repoDir, err := os.MkdirTemp("", "test-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repoDir)
+
+	repo, err := extgogit.PlainInit(repoDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := func(msg string) plumbing.Hash {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repoDir, "file"), []byte(msg), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Add("file"); err != nil {
+			t.Fatal(err)
+		}
+		hash, err := w.Commit(msg, &extgogit.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+
+	// the bundle contains the first commit, the second one is fetched
+	first := commit("first")
+	var hashes []plumbing.Hash
+	objects, err := repo.Storer.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := objects.ForEach(func(o plumbing.EncodedObject) error {
+		hashes = append(hashes, o.Hash())
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var bundle bytes.Buffer
+	fmt.Fprintf(&bundle, "%s\n%s refs/heads/master\n\n", bundleV2Signature, first)
+	if _, err := packfile.NewEncoder(&bundle, repo.Storer, false).Encode(hashes, 10); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bundle.Bytes())
+	}))
+	defer server.Close()
+	second := commit("second")
+
+	tmpDir, _ := os.MkdirTemp("", "test")
+	defer os.RemoveAll(tmpDir)
+	branch := &CheckoutBranch{branch: "master", bundleURL: server.URL}
+	c, ref, err := branch.Checkout(context.TODO(), tmpDir, repoDir, &git.Auth{})
+	if err != nil {
+		t.Fatalf("Checkout() error = %v", err)
+	}
+	if c.Hash() != second.String() {
+		t.Errorf("Checkout() commit = %s, want %s", c.Hash(), second)
+	}
+	if want := "master/" + second.String(); ref != want {
+		t.Errorf("Checkout() ref = %s, want %s", ref, want)
+	}
+	content, err := os.ReadFile(filepath.Join(tmpDir, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "second" {
+		t.Errorf("file content = %q, want %q", content, "second")
+	}
+	cloned, err := extgogit.PlainOpen(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cloned.Reference(plumbing.ReferenceName(bundleRefPrefix+"heads/master"), false); err != nil {
+		t.Errorf("bundle reference not found: %v", err)
+	}
+}
+
+func TestReadBundleHeader(t *testing.T) {
+	hash := "9b8a7e1c3d2f4b6a8c0e1f2a3b4c5d6e7f8a9b0c"
+	tests := []struct {
+		name    string
+		header  string
+		want    map[string]plumbing.Hash
+		wantErr bool
+	}{
+		{
+			name:   "v2",
+			header: "# v2 git bundle\n" + hash + " refs/heads/main\n\n",
+			want:   map[string]plumbing.Hash{"refs/heads/main": plumbing.NewHash(hash)},
+		},
+		{
+			name:   "v3 sha1",
+			header: "# v3 git bundle\n@object-format=sha1\n" + hash + " refs/heads/main\n\n",
+			want:   map[string]plumbing.Hash{"refs/heads/main": plumbing.NewHash(hash)},
+		},
+		{
+			name:    "v3 sha256",
+			header:  "# v3 git bundle\n@object-format=sha256\n" + hash + " refs/heads/main\n\n",
+			wantErr: true,
+		},
+		{
+			name:    "prerequisites",
+			header:  "# v2 git bundle\n-" + hash + " parent\n" + hash + " refs/heads/main\n\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid signature",
+			header:  "PACK",
+			wantErr: true,
+		},
+		{
+			name:    "no references",
+			header:  "# v2 git bundle\n\n",
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			header:  "# v2 git bundle\n" + hash + " refs/heads/main\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readBundleHeader(bufio.NewReader(strings.NewReader(tt.header)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readBundleHeader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("readBundleHeader() = %v, want %v", got, tt.want)
+			}
+			for name, hash := range tt.want {
+				if got[name] != hash {
+					t.Errorf("readBundleHeader() %s = %s, want %s", name, got[name], hash)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gogit
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	extgogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+// openCache opens the bare repository in the cache directory with its
+// worktree at the given path, initializing the repository if it does not
+// exist or can not be opened. It returns true if the repository was
+// initialized.
+func openCache(cacheDir, path string) (*extgogit.Repository, bool, error) {
+	storage := filesystem.NewStorage(osfs.New(cacheDir), cache.NewObjectLRUDefault())
+	repo, err := extgogit.Open(storage, osfs.New(path))
+	if err == nil {
+		_, err = repo.Config()
+	}
+	if err != nil {
+		if err := os.RemoveAll(cacheDir); err != nil {
+			return nil, false, err
+		}
+		// the repository is initialized as bare, as a worktree would get a
+		// .git file pointing to the cache directory
+		storage = filesystem.NewStorage(osfs.New(cacheDir), cache.NewObjectLRUDefault())
+		if _, err := extgogit.Init(storage, nil); err != nil {
+			return nil, false, fmt.Errorf("unable to initialize cached repository: %w", err)
+		}
+		repo, err = extgogit.Open(storage, osfs.New(path))
+		if err != nil {
+			return nil, false, fmt.Errorf("unable to open cached repository: %w", err)
+		}
+		return repo, true, nil
+	}
+	// the index of the previous checkout does not match the new worktree
+	if err := storage.SetIndex(&index.Index{Version: 2}); err != nil {
+		return nil, false, fmt.Errorf("unable to reset cached repository index: %w", err)
+	}
+	return repo, false, nil
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2020 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gogit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	extgogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/fluxcd/source-controller/pkg/git"
+)
+
+func TestCheckout_Cache(t *testing.T) {
+	repoDir, err := os.MkdirTemp("", "test-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repoDir)
+
+	repo, err := extgogit.PlainInit(repoDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := func(files map[string]string) plumbing.Hash {
+		t.Helper()
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(repoDir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Add(name); err != nil {
+				t.Fatal(err)
+			}
+		}
+		hash, err := w.Commit("update", &extgogit.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+
+	cacheDir, err := os.MkdirTemp("", "test-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	checkout := func(strategy git.CheckoutStrategy, want plumbing.Hash, wantFiles map[string]string) {
+		t.Helper()
+		tmpDir, err := os.MkdirTemp("", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(tmpDir)
+
+		c, _, err := strategy.Checkout(context.TODO(), tmpDir, repoDir, &git.Auth{})
+		if err != nil {
+			t.Fatalf("Checkout() error = %v", err)
+		}
+		if c.Hash() != want.String() {
+			t.Errorf("Checkout() commit = %s, want %s", c.Hash(), want)
+		}
+		for name, content := range wantFiles {
+			got, err := os.ReadFile(filepath.Join(tmpDir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != content {
+				t.Errorf("%s content = %q, want %q", name, got, content)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(tmpDir, ".git")); !os.IsNotExist(err) {
+			t.Errorf("checkout has a .git directory, err = %v", err)
+		}
+	}
+
+	first := commit(map[string]string{"file": "first", "other": "unchanged"})
+	checkout(&CheckoutBranch{branch: "master", cacheDir: cacheDir}, first, map[string]string{"file": "first", "other": "unchanged"})
+	if _, err := os.Stat(filepath.Join(cacheDir, "HEAD")); err != nil {
+		t.Fatalf("cache is not a bare repository: %v", err)
+	}
+
+	// the unchanged files are checked out to the new path as well
+	second := commit(map[string]string{"file": "second"})
+	checkout(&CheckoutBranch{branch: "master", cacheDir: cacheDir}, second, map[string]string{"file": "second", "other": "unchanged"})
+	checkout(&CheckoutCommit{branch: "master", commit: first.String(), cacheDir: cacheDir}, first, map[string]string{"file": "first"})
+
+	if _, err := repo.CreateTag("v1.0.0", second, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkout(&CheckoutTag{tag: "v1.0.0", cacheDir: cacheDir}, second, map[string]string{"file": "second"})
+
+	// a corrupted cache is initialized again
+	if err := os.WriteFile(filepath.Join(cacheDir, "config"), []byte("invalid"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checkout(&CheckoutBranch{branch: "master", cacheDir: cacheDir}, second, map[string]string{"file": "second"})
+}
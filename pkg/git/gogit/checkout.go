@@ -19,12 +19,14 @@ package gogit
 import (
 	"context"
 	"fmt"
+	gohttp "net/http"
 	"sort"
 	"time"
 
 	"github.com/Masterminds/semver/v3"
 	extgogit "github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 
 	"github.com/fluxcd/pkg/gitutil"
 	"github.com/fluxcd/pkg/version"
@@ -36,46 +38,64 @@ import (
 func CheckoutStrategyForRef(ref *sourcev1.GitRepositoryRef, opt git.CheckoutOptions) git.CheckoutStrategy {
 	switch {
 	case ref == nil:
-		return &CheckoutBranch{branch: git.DefaultBranch}
+		return &CheckoutBranch{branch: git.DefaultBranch, headers: opt.Headers, fullHistory: opt.FullHistory, bundleURL: opt.BundleURL, cacheDir: opt.CacheDir, partial: opt.PartialClone}
 	case ref.SemVer != "":
-		return &CheckoutSemVer{semVer: ref.SemVer, recurseSubmodules: opt.RecurseSubmodules}
+		strategy := &CheckoutSemVer{semVer: ref.SemVer, submodules: newSubmoduleOptions(opt), headers: opt.Headers}
+		if ref.SemVerScope == sourcev1.BranchSemVerScope {
+			strategy.branch = ref.Branch
+			if strategy.branch == "" {
+				strategy.branch = git.DefaultBranch
+			}
+		}
+		return strategy
 	case ref.Tag != "":
-		return &CheckoutTag{tag: ref.Tag, recurseSubmodules: opt.RecurseSubmodules}
+		return &CheckoutTag{tag: ref.Tag, submodules: newSubmoduleOptions(opt), headers: opt.Headers, fullHistory: opt.FullHistory, bundleURL: opt.BundleURL, cacheDir: opt.CacheDir, partial: opt.PartialClone}
 	case ref.Commit != "":
-		strategy := &CheckoutCommit{branch: ref.Branch, commit: ref.Commit, recurseSubmodules: opt.RecurseSubmodules}
+		strategy := &CheckoutCommit{branch: ref.Branch, commit: ref.Commit, submodules: newSubmoduleOptions(opt), headers: opt.Headers, bundleURL: opt.BundleURL, cacheDir: opt.CacheDir}
 		if strategy.branch == "" {
 			strategy.branch = git.DefaultBranch
 		}
 		return strategy
 	case ref.Branch != "":
-		return &CheckoutBranch{branch: ref.Branch, recurseSubmodules: opt.RecurseSubmodules}
+		return &CheckoutBranch{branch: ref.Branch, submodules: newSubmoduleOptions(opt), headers: opt.Headers, fullHistory: opt.FullHistory, bundleURL: opt.BundleURL, cacheDir: opt.CacheDir, partial: opt.PartialClone}
 	default:
-		return &CheckoutBranch{branch: git.DefaultBranch}
+		return &CheckoutBranch{branch: git.DefaultBranch, headers: opt.Headers, fullHistory: opt.FullHistory, bundleURL: opt.BundleURL, cacheDir: opt.CacheDir, partial: opt.PartialClone}
 	}
 }
 
 type CheckoutBranch struct {
-	branch            string
-	recurseSubmodules bool
+	branch      string
+	submodules  submoduleOptions
+	headers     gohttp.Header
+	fullHistory bool
+	bundleURL   string
+	cacheDir    string
+	partial     *git.PartialCloneOptions
 }
 
 func (c *CheckoutBranch) Checkout(ctx context.Context, path, url string, auth *git.Auth) (git.Commit, string, error) {
-	repo, err := extgogit.PlainCloneContext(ctx, path, false, &extgogit.CloneOptions{
-		URL:               url,
-		Auth:              auth.AuthMethod,
-		RemoteName:        git.DefaultOrigin,
-		ReferenceName:     plumbing.NewBranchReferenceName(c.branch),
-		SingleBranch:      true,
-		NoCheckout:        false,
-		Depth:             1,
-		RecurseSubmodules: recurseSubmodules(c.recurseSubmodules),
-		Progress:          nil,
-		Tags:              extgogit.NoTags,
-		CABundle:          auth.CABundle,
-	})
+	depth := 1
+	if c.fullHistory {
+		depth = 0
+	}
+	repo, err := cloneFiltered(ctx, path, &extgogit.CloneOptions{
+		URL:           url,
+		Auth:          authMethod(url, auth.AuthMethod, c.headers),
+		RemoteName:    git.DefaultOrigin,
+		ReferenceName: plumbing.NewBranchReferenceName(c.branch),
+		SingleBranch:  true,
+		NoCheckout:    false,
+		Depth:         depth,
+		Progress:      nil,
+		Tags:          extgogit.NoTags,
+		CABundle:      auth.CABundle,
+	}, c.partial, c.submodules, c.bundleURL, c.cacheDir)
 	if err != nil {
 		return nil, "", fmt.Errorf("unable to clone '%s', error: %w", url, gitutil.GoGitError(err))
 	}
+	if err := updateSubmodules(ctx, repo, c.submodules, authMethod(url, auth.AuthMethod, c.headers)); err != nil {
+		return nil, "", err
+	}
 	head, err := repo.Head()
 	if err != nil {
 		return nil, "", fmt.Errorf("git resolve HEAD error: %w", err)
@@ -84,31 +104,42 @@ func (c *CheckoutBranch) Checkout(ctx context.Context, path, url string, auth *g
 	if err != nil {
 		return nil, "", fmt.Errorf("git commit '%s' not found: %w", head.Hash(), err)
 	}
-	return &Commit{commit}, fmt.Sprintf("%s/%s", c.branch, head.Hash().String()), nil
+	return &Commit{commit: commit}, fmt.Sprintf("%s/%s", c.branch, head.Hash().String()), nil
 }
 
 type CheckoutTag struct {
-	tag               string
-	recurseSubmodules bool
+	tag         string
+	submodules  submoduleOptions
+	headers     gohttp.Header
+	fullHistory bool
+	bundleURL   string
+	cacheDir    string
+	partial     *git.PartialCloneOptions
 }
 
 func (c *CheckoutTag) Checkout(ctx context.Context, path, url string, auth *git.Auth) (git.Commit, string, error) {
-	repo, err := extgogit.PlainCloneContext(ctx, path, false, &extgogit.CloneOptions{
-		URL:               url,
-		Auth:              auth.AuthMethod,
-		RemoteName:        git.DefaultOrigin,
-		ReferenceName:     plumbing.NewTagReferenceName(c.tag),
-		SingleBranch:      true,
-		NoCheckout:        false,
-		Depth:             1,
-		RecurseSubmodules: recurseSubmodules(c.recurseSubmodules),
-		Progress:          nil,
-		Tags:              extgogit.NoTags,
-		CABundle:          auth.CABundle,
-	})
+	depth := 1
+	if c.fullHistory {
+		depth = 0
+	}
+	repo, err := cloneFiltered(ctx, path, &extgogit.CloneOptions{
+		URL:           url,
+		Auth:          authMethod(url, auth.AuthMethod, c.headers),
+		RemoteName:    git.DefaultOrigin,
+		ReferenceName: plumbing.NewTagReferenceName(c.tag),
+		SingleBranch:  true,
+		NoCheckout:    false,
+		Depth:         depth,
+		Progress:      nil,
+		Tags:          extgogit.NoTags,
+		CABundle:      auth.CABundle,
+	}, c.partial, c.submodules, c.bundleURL, c.cacheDir)
 	if err != nil {
 		return nil, "", fmt.Errorf("unable to clone '%s', error: %w", url, err)
 	}
+	if err := updateSubmodules(ctx, repo, c.submodules, authMethod(url, auth.AuthMethod, c.headers)); err != nil {
+		return nil, "", err
+	}
 	head, err := repo.Head()
 	if err != nil {
 		return nil, "", fmt.Errorf("git resolve HEAD error: %w", err)
@@ -117,28 +148,34 @@ func (c *CheckoutTag) Checkout(ctx context.Context, path, url string, auth *git.
 	if err != nil {
 		return nil, "", fmt.Errorf("git commit '%s' not found: %w", head.Hash(), err)
 	}
-	return &Commit{commit}, fmt.Sprintf("%s/%s", c.tag, head.Hash().String()), nil
+	tagged, err := tagCommit(repo, commit, c.tag)
+	if err != nil {
+		return nil, "", err
+	}
+	return tagged, fmt.Sprintf("%s/%s", c.tag, head.Hash().String()), nil
 }
 
 type CheckoutCommit struct {
-	branch            string
-	commit            string
-	recurseSubmodules bool
+	branch     string
+	commit     string
+	submodules submoduleOptions
+	headers    gohttp.Header
+	bundleURL  string
+	cacheDir   string
 }
 
 func (c *CheckoutCommit) Checkout(ctx context.Context, path, url string, auth *git.Auth) (git.Commit, string, error) {
-	repo, err := extgogit.PlainCloneContext(ctx, path, false, &extgogit.CloneOptions{
-		URL:               url,
-		Auth:              auth.AuthMethod,
-		RemoteName:        git.DefaultOrigin,
-		ReferenceName:     plumbing.NewBranchReferenceName(c.branch),
-		SingleBranch:      true,
-		NoCheckout:        false,
-		RecurseSubmodules: recurseSubmodules(c.recurseSubmodules),
-		Progress:          nil,
-		Tags:              extgogit.NoTags,
-		CABundle:          auth.CABundle,
-	})
+	repo, err := clone(ctx, path, &extgogit.CloneOptions{
+		URL:           url,
+		Auth:          authMethod(url, auth.AuthMethod, c.headers),
+		RemoteName:    git.DefaultOrigin,
+		ReferenceName: plumbing.NewBranchReferenceName(c.branch),
+		SingleBranch:  true,
+		NoCheckout:    false,
+		Progress:      nil,
+		Tags:          extgogit.NoTags,
+		CABundle:      auth.CABundle,
+	}, c.bundleURL, c.cacheDir)
 	if err != nil {
 		return nil, "", fmt.Errorf("unable to clone '%s', error: %w", url, err)
 	}
@@ -157,12 +194,19 @@ func (c *CheckoutCommit) Checkout(ctx context.Context, path, url string, auth *g
 	if err != nil {
 		return nil, "", fmt.Errorf("git checkout error: %w", err)
 	}
-	return &Commit{commit}, fmt.Sprintf("%s/%s", c.branch, commit.Hash.String()), nil
+	if err := updateSubmodules(ctx, repo, c.submodules, authMethod(url, auth.AuthMethod, c.headers)); err != nil {
+		return nil, "", err
+	}
+	return &Commit{commit: commit}, fmt.Sprintf("%s/%s", c.branch, commit.Hash.String()), nil
 }
 
 type CheckoutSemVer struct {
-	semVer            string
-	recurseSubmodules bool
+	semVer string
+	// branch restricts the matched tags to the ones reachable from the
+	// branch, if set.
+	branch     string
+	submodules submoduleOptions
+	headers    gohttp.Header
 }
 
 func (c *CheckoutSemVer) Checkout(ctx context.Context, path, url string, auth *git.Auth) (git.Commit, string, error) {
@@ -171,21 +215,34 @@ func (c *CheckoutSemVer) Checkout(ctx context.Context, path, url string, auth *g
 		return nil, "", fmt.Errorf("semver parse range error: %w", err)
 	}
 
-	repo, err := extgogit.PlainCloneContext(ctx, path, false, &extgogit.CloneOptions{
-		URL:               url,
-		Auth:              auth.AuthMethod,
-		RemoteName:        git.DefaultOrigin,
-		NoCheckout:        false,
-		Depth:             1,
-		RecurseSubmodules: recurseSubmodules(c.recurseSubmodules),
-		Progress:          nil,
-		Tags:              extgogit.AllTags,
-		CABundle:          auth.CABundle,
-	})
+	opts := &extgogit.CloneOptions{
+		URL:        url,
+		Auth:       authMethod(url, auth.AuthMethod, c.headers),
+		RemoteName: git.DefaultOrigin,
+		NoCheckout: false,
+		Depth:      1,
+		Progress:   nil,
+		Tags:       extgogit.AllTags,
+		CABundle:   auth.CABundle,
+	}
+	if c.branch != "" {
+		// the history of the branch is needed to find the reachable tags
+		opts.ReferenceName = plumbing.NewBranchReferenceName(c.branch)
+		opts.SingleBranch = true
+		opts.Depth = 0
+	}
+	repo, err := extgogit.PlainCloneContext(ctx, path, false, opts)
 	if err != nil {
 		return nil, "", fmt.Errorf("unable to clone '%s', error: %w", url, err)
 	}
 
+	var reachable map[plumbing.Hash]bool
+	if c.branch != "" {
+		if reachable, err = reachableCommits(repo); err != nil {
+			return nil, "", err
+		}
+	}
+
 	repoTags, err := repo.Tags()
 	if err != nil {
 		return nil, "", fmt.Errorf("git list tags error: %w", err)
@@ -199,6 +256,9 @@ func (c *CheckoutSemVer) Checkout(ctx context.Context, path, url string, auth *g
 		if err != nil {
 			return fmt.Errorf("unable to resolve tag revision: %w", err)
 		}
+		if reachable != nil && !reachable[*hash] {
+			return nil
+		}
 		commit, err := repo.CommitObject(*hash)
 		if err != nil {
 			return fmt.Errorf("unable to resolve commit of a tag revision: %w", err)
@@ -223,6 +283,9 @@ func (c *CheckoutSemVer) Checkout(ctx context.Context, path, url string, auth *g
 		matchedVersions = append(matchedVersions, v)
 	}
 	if len(matchedVersions) == 0 {
+		if c.branch != "" {
+			return nil, "", fmt.Errorf("no match found for semver: %s on branch '%s'", c.semVer, c.branch)
+		}
 		return nil, "", fmt.Errorf("no match found for semver: %s", c.semVer)
 	}
 
@@ -255,6 +318,9 @@ func (c *CheckoutSemVer) Checkout(ctx context.Context, path, url string, auth *g
 	if err != nil {
 		return nil, "", fmt.Errorf("git checkout error: %w", err)
 	}
+	if err := updateSubmodules(ctx, repo, c.submodules, authMethod(url, auth.AuthMethod, c.headers)); err != nil {
+		return nil, "", err
+	}
 
 	head, err := repo.Head()
 	if err != nil {
@@ -266,12 +332,30 @@ func (c *CheckoutSemVer) Checkout(ctx context.Context, path, url string, auth *g
 		return nil, "", fmt.Errorf("git commit '%s' not found: %w", head.Hash(), err)
 	}
 
-	return &Commit{commit}, fmt.Sprintf("%s/%s", t, head.Hash().String()), nil
+	tagged, err := tagCommit(repo, commit, t)
+	if err != nil {
+		return nil, "", err
+	}
+	return tagged, fmt.Sprintf("%s/%s", t, head.Hash().String()), nil
 }
 
-func recurseSubmodules(recurse bool) extgogit.SubmoduleRescursivity {
-	if recurse {
-		return extgogit.DefaultSubmoduleRecursionDepth
+// reachableCommits returns the hashes of the commits reachable from the HEAD
+// of the given repository.
+func reachableCommits(repo *extgogit.Repository) (map[plumbing.Hash]bool, error) {
+	head, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("git resolve HEAD error: %w", err)
+	}
+	commits, err := repo.Log(&extgogit.LogOptions{From: head.Hash()})
+	if err != nil {
+		return nil, fmt.Errorf("git log error: %w", err)
+	}
+	reachable := make(map[plumbing.Hash]bool)
+	if err := commits.ForEach(func(c *object.Commit) error {
+		reachable[c.Hash] = true
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("git log error: %w", err)
 	}
-	return extgogit.NoRecurseSubmodules
+	return reachable, nil
 }
@@ -19,7 +19,14 @@ package gogit
 import (
 	"context"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	extgogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 
 	"github.com/fluxcd/source-controller/pkg/git"
 )
@@ -52,3 +59,107 @@ func TestCheckoutTagSemVer_Checkout(t *testing.T) {
 		t.Errorf("expected semver hash %s, got %s", cTag.Hash(), cSemVer.Hash())
 	}
 }
+
+func TestCheckoutSemVer_Checkout_BranchScope(t *testing.T) {
+	repoDir, err := os.MkdirTemp("", "test-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repoDir)
+
+	// master: v1.0.0 -> v2.0.0, release-1: v1.0.0 -> v1.0.1
+	repo, err := extgogit.PlainInit(repoDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := func(msg string) plumbing.Hash {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repoDir, "file"), []byte(msg), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Add("file"); err != nil {
+			t.Fatal(err)
+		}
+		hash, err := w.Commit(msg, &extgogit.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+	tag := func(name string, hash plumbing.Hash) {
+		t.Helper()
+		if _, err := repo.CreateTag(name, hash, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tag("v1.0.0", commit("1.0.0"))
+	if err := w.Checkout(&extgogit.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("release-1"), Create: true}); err != nil {
+		t.Fatal(err)
+	}
+	hotfix := commit("1.0.1")
+	tag("v1.0.1", hotfix)
+	if err := w.Checkout(&extgogit.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("master")}); err != nil {
+		t.Fatal(err)
+	}
+	latest := commit("2.0.0")
+	tag("v2.0.0", latest)
+
+	tests := []struct {
+		name         string
+		semVer       string
+		branch       string
+		wantHash     plumbing.Hash
+		wantRevision string
+		wantErr      string
+	}{
+		{
+			name:         "repository scope",
+			semVer:       ">=1.0.0",
+			wantHash:     latest,
+			wantRevision: "v2.0.0",
+		},
+		{
+			name:         "branch scope",
+			semVer:       ">=1.0.0",
+			branch:       "release-1",
+			wantHash:     hotfix,
+			wantRevision: "v1.0.1",
+		},
+		{
+			name:    "no tag on branch",
+			semVer:  ">=1.0.1 <2.0.0",
+			branch:  "master",
+			wantErr: "no match found for semver: >=1.0.1 <2.0.0 on branch 'master'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			semVer := &CheckoutSemVer{semVer: tt.semVer, branch: tt.branch}
+			tmpDir, _ := os.MkdirTemp("", "test")
+			defer os.RemoveAll(tmpDir)
+
+			c, revision, err := semVer.Checkout(context.TODO(), tmpDir, repoDir, &git.Auth{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Checkout() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Checkout() error = %v", err)
+			}
+			if c.Hash() != tt.wantHash.String() {
+				t.Errorf("Checkout() hash = %s, want %s", c.Hash(), tt.wantHash)
+			}
+			if want := tt.wantRevision + "/" + tt.wantHash.String(); revision != want {
+				t.Errorf("Checkout() revision = %s, want %s", revision, want)
+			}
+		})
+	}
+}
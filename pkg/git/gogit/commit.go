@@ -18,13 +18,43 @@ package gogit
 
 import (
 	"fmt"
+	"sort"
 
+	extgogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
 	corev1 "k8s.io/api/core/v1"
+
+	"github.com/fluxcd/source-controller/pkg/git"
 )
 
 type Commit struct {
 	commit *object.Commit
+	// tagName is the name of the tag the commit was checked out from, if
+	// any, and tag its object if the tag is annotated.
+	tagName string
+	tag     *object.Tag
+}
+
+// tagCommit returns the given commit checked out from the tag with the given
+// name of the given repository.
+func tagCommit(repo *extgogit.Repository, commit *object.Commit, name string) (*Commit, error) {
+	ref, err := repo.Tag(name)
+	if err != nil {
+		return nil, fmt.Errorf("git tag '%s' not found: %w", name, err)
+	}
+	c := &Commit{commit: commit, tagName: name}
+	tag, err := repo.TagObject(ref.Hash())
+	switch err {
+	case nil:
+		c.tag = tag
+	case plumbing.ErrObjectNotFound:
+		// lightweight tag
+	default:
+		return nil, fmt.Errorf("git tag '%s' object error: %w", name, err)
+	}
+	return c, nil
 }
 
 func (c *Commit) Hash() string {
@@ -49,3 +79,134 @@ func (c *Commit) Verify(secret corev1.Secret) error {
 	}
 	return nil
 }
+
+// IsDescendantOf returns true if the commit with the given hash is reachable
+// from the commit. The history must not be shallow.
+func (c *Commit) IsDescendantOf(hash string) (bool, error) {
+	ancestor := plumbing.NewHash(hash)
+	var found bool
+	err := object.NewCommitPreorderIter(c.commit, nil, nil).ForEach(func(commit *object.Commit) error {
+		if commit.Hash == ancestor {
+			found = true
+			return storer.ErrStop
+		}
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("git history of '%s' walk error: %w", c.commit.Hash, err)
+	}
+	return found, nil
+}
+
+// ChangedFiles returns the paths of the files changed since the commit with
+// the given hash, or since the first parent of the commit if the hash is empty
+// or not reachable from the commit. The history must not be shallow.
+func (c *Commit) ChangedFiles(since string) ([]string, error) {
+	var base *object.Commit
+	if since != "" {
+		ancestor := plumbing.NewHash(since)
+		err := object.NewCommitPreorderIter(c.commit, nil, nil).ForEach(func(commit *object.Commit) error {
+			if commit.Hash == ancestor {
+				base = commit
+				return storer.ErrStop
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("git history of '%s' walk error: %w", c.commit.Hash, err)
+		}
+	}
+	if base == nil && c.commit.NumParents() > 0 {
+		parent, err := c.commit.Parent(0)
+		if err != nil {
+			return nil, fmt.Errorf("git parent of '%s' not found: %w", c.commit.Hash, err)
+		}
+		base = parent
+	}
+
+	tree, err := c.commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("git tree of '%s' not found: %w", c.commit.Hash, err)
+	}
+	var baseTree *object.Tree
+	if base != nil {
+		if baseTree, err = base.Tree(); err != nil {
+			return nil, fmt.Errorf("git tree of '%s' not found: %w", base.Hash, err)
+		}
+	}
+	changes, err := object.DiffTree(baseTree, tree)
+	if err != nil {
+		return nil, fmt.Errorf("git diff of '%s' error: %w", c.commit.Hash, err)
+	}
+	seen := make(map[string]bool)
+	var paths []string
+	for _, change := range changes {
+		for _, name := range []string{change.From.Name, change.To.Name} {
+			if name != "" && !seen[name] {
+				seen[name] = true
+				paths = append(paths, name)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Signers returns the names of the keys of the given secret the PGP signature
+// of the commit is verified by.
+func (c *Commit) Signers(secret corev1.Secret) []string {
+	if c.commit.PGPSignature == "" {
+		return nil
+	}
+	var names []string
+	for name, bytes := range secret.Data {
+		if _, err := c.commit.Verify(string(bytes)); err == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Info returns the author, committer and message of the commit.
+func (c *Commit) Info() git.CommitInfo {
+	return git.CommitInfo{
+		Author:    signature(c.commit.Author),
+		Committer: signature(c.commit.Committer),
+		Message:   c.commit.Message,
+		Signed:    c.commit.PGPSignature != "",
+	}
+}
+
+func signature(s object.Signature) git.Signature {
+	return git.Signature{Name: s.Name, Email: s.Email, When: s.When}
+}
+
+// Tag returns the metadata of the tag the commit was checked out from, or nil
+// if it was not checked out from a tag.
+func (c *Commit) Tag() *git.TagInfo {
+	if c.tagName == "" {
+		return nil
+	}
+	info := &git.TagInfo{Name: c.tagName}
+	if c.tag != nil {
+		info.Annotated = true
+		info.Tagger = signature(c.tag.Tagger)
+		info.Signed = c.tag.PGPSignature != ""
+	}
+	return info
+}
+
+// VerifyTag returns an error if the PGP signature of the annotated tag the
+// commit was checked out from can't be verified.
+func (c *Commit) VerifyTag(secret corev1.Secret) error {
+	if c.tag == nil || c.tag.PGPSignature == "" {
+		return fmt.Errorf("no PGP signature found for tag: %s", c.tagName)
+	}
+	for _, bytes := range secret.Data {
+		if _, err := c.tag.Verify(string(bytes)); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("PGP signature of tag '%s' by '%s' can't be verified", c.tagName, c.tag.Tagger)
+}
@@ -0,0 +1,298 @@
+/*
+Copyright 2020 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gogit
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	extgogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/fluxcd/source-controller/pkg/git"
+)
+
+func TestCommit_IsDescendantOf(t *testing.T) {
+	repoDir, err := os.MkdirTemp("", "test-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repoDir)
+
+	// master: first -> second, rewritten: first -> amended
+	repo, err := extgogit.PlainInit(repoDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := func(msg string) plumbing.Hash {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repoDir, "file"), []byte(msg), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Add("file"); err != nil {
+			t.Fatal(err)
+		}
+		hash, err := w.Commit(msg, &extgogit.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+	first := commit("first")
+	if err := w.Checkout(&extgogit.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("rewritten"), Create: true}); err != nil {
+		t.Fatal(err)
+	}
+	amended := commit("amended")
+	if err := w.Checkout(&extgogit.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("master")}); err != nil {
+		t.Fatal(err)
+	}
+	second := commit("second")
+
+	branch := &CheckoutBranch{branch: "master", fullHistory: true}
+	tmpDir, _ := os.MkdirTemp("", "test")
+	defer os.RemoveAll(tmpDir)
+	c, _, err := branch.Checkout(context.TODO(), tmpDir, repoDir, &git.Auth{})
+	if err != nil {
+		t.Fatalf("Checkout() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		hash plumbing.Hash
+		want bool
+	}{
+		{name: "same commit", hash: second, want: true},
+		{name: "ancestor", hash: first, want: true},
+		{name: "rewritten", hash: amended, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.IsDescendantOf(tt.hash.String())
+			if err != nil {
+				t.Fatalf("IsDescendantOf() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("IsDescendantOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommit_Tag(t *testing.T) {
+	repoDir, err := os.MkdirTemp("", "test-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repoDir)
+
+	repo, err := extgogit.PlainInit(repoDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "file"), []byte("first"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Add("file"); err != nil {
+		t.Fatal(err)
+	}
+	tagger := &object.Signature{Name: "test", Email: "test@example.com", When: time.Unix(1622028065, 0)}
+	hash, err := w.Commit("first", &extgogit.CommitOptions{Author: tagger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateTag("lightweight", hash, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateTag("annotated", hash, &extgogit.CreateTagOptions{Tagger: tagger, Message: "annotated"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		tag  string
+		want git.TagInfo
+	}{
+		{tag: "lightweight", want: git.TagInfo{Name: "lightweight"}},
+		{tag: "annotated", want: git.TagInfo{
+			Name:      "annotated",
+			Annotated: true,
+			Tagger:    git.Signature{Name: tagger.Name, Email: tagger.Email, When: tagger.When},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			tmpDir, _ := os.MkdirTemp("", "test")
+			defer os.RemoveAll(tmpDir)
+			c, _, err := (&CheckoutTag{tag: tt.tag}).Checkout(context.TODO(), tmpDir, repoDir, &git.Auth{})
+			if err != nil {
+				t.Fatalf("Checkout() error = %v", err)
+			}
+			tagged, ok := c.(git.TaggedCommit)
+			if !ok {
+				t.Fatal("commit is not a TaggedCommit")
+			}
+			got := tagged.Tag()
+			if got == nil {
+				t.Fatal("Tag() = nil")
+			}
+			if got.Name != tt.want.Name || got.Annotated != tt.want.Annotated || got.Signed != tt.want.Signed ||
+				got.Tagger.Name != tt.want.Tagger.Name || got.Tagger.Email != tt.want.Tagger.Email || !got.Tagger.When.Equal(tt.want.Tagger.When) {
+				t.Errorf("Tag() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+
+	branch := &CheckoutBranch{branch: "master"}
+	tmpDir, _ := os.MkdirTemp("", "test")
+	defer os.RemoveAll(tmpDir)
+	c, _, err := branch.Checkout(context.TODO(), tmpDir, repoDir, &git.Auth{})
+	if err != nil {
+		t.Fatalf("Checkout() error = %v", err)
+	}
+	if tag := c.(git.TaggedCommit).Tag(); tag != nil {
+		t.Errorf("Tag() = %+v, want nil for a branch", *tag)
+	}
+}
+
+func TestCommit_ChangedFiles(t *testing.T) {
+	repoDir, err := os.MkdirTemp("", "test-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repoDir)
+
+	repo, err := extgogit.PlainInit(repoDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := func(files map[string]string, remove ...string) plumbing.Hash {
+		t.Helper()
+		for name, content := range files {
+			path := filepath.Join(repoDir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Add(name); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, name := range remove {
+			if _, err := w.Remove(name); err != nil {
+				t.Fatal(err)
+			}
+		}
+		hash, err := w.Commit("commit", &extgogit.CommitOptions{
+			Author:  &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+			SignKey: signer,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+	first := commit(map[string]string{"README.md": "first", "charts/app/Chart.yaml": "first"})
+	commit(map[string]string{"charts/app/Chart.yaml": "second"})
+	commit(map[string]string{"deploy/app.yaml": "third"}, "README.md")
+
+	tmpDir, _ := os.MkdirTemp("", "test")
+	defer os.RemoveAll(tmpDir)
+	c, _, err := (&CheckoutBranch{branch: "master", fullHistory: true}).Checkout(context.TODO(), tmpDir, repoDir, &git.Auth{})
+	if err != nil {
+		t.Fatalf("Checkout() error = %v", err)
+	}
+	changes, ok := c.(git.ChangeCommit)
+	if !ok {
+		t.Fatal("commit is not a ChangeCommit")
+	}
+
+	tests := []struct {
+		name  string
+		since string
+		want  []string
+	}{
+		{name: "first parent", want: []string{"README.md", "deploy/app.yaml"}},
+		{name: "since ancestor", since: first.String(), want: []string{"README.md", "charts/app/Chart.yaml", "deploy/app.yaml"}},
+		{name: "since unreachable", since: "0123456789012345678901234567890123456789", want: []string{"README.md", "deploy/app.yaml"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := changes.ChangedFiles(tt.since)
+			if err != nil {
+				t.Fatalf("ChangedFiles() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ChangedFiles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var signerKey bytes.Buffer
+	aw, err := armor.Encode(&signerKey, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signer.Serialize(aw); err != nil {
+		t.Fatal(err)
+	}
+	aw.Close()
+	other, err := openpgp.NewEntity("other", "", "other@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var otherKey bytes.Buffer
+	aw, err = armor.Encode(&otherKey, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Serialize(aw); err != nil {
+		t.Fatal(err)
+	}
+	aw.Close()
+	secret := corev1.Secret{Data: map[string][]byte{"test": signerKey.Bytes(), "other": otherKey.Bytes()}}
+	if got := changes.Signers(secret); !reflect.DeepEqual(got, []string{"test"}) {
+		t.Errorf("Signers() = %v, want [test]", got)
+	}
+}
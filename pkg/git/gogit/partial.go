@@ -0,0 +1,643 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gogit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	gohttp "net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+	extgogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage"
+
+	"github.com/fluxcd/source-controller/pkg/git"
+	"github.com/fluxcd/source-controller/pkg/throttle"
+	"github.com/fluxcd/source-controller/pkg/trust"
+)
+
+const (
+	// partialCloneFilter is the filter of the objects of a partial clone,
+	// which leaves out all the blobs. The blobs of the checked out files are
+	// fetched afterwards.
+	partialCloneFilter = "blob:none"
+
+	// maxWantsPerFetch is the maximum number of blobs requested per fetch.
+	maxWantsPerFetch = 1000
+
+	// uploadPackRequest and uploadPackResult are the content types of the
+	// requests and responses of the smart HTTP upload-pack service.
+	uploadPackRequest = "application/x-git-upload-pack-request"
+	uploadPackResult  = "application/x-git-upload-pack-result"
+)
+
+// cloneFiltered clones the reference of the given options to the path with
+// partialClone if the given PartialCloneOptions are not nil and the
+// submodules are not initialized, and with clone otherwise or if the server
+// does not support the filters.
+func cloneFiltered(ctx context.Context, path string, opts *extgogit.CloneOptions, partial *git.PartialCloneOptions,
+	submodules submoduleOptions, bundleURL, cacheDir string) (*extgogit.Repository, error) {
+	if partial != nil && !submodules.recurse {
+		repo, ok, err := partialClone(ctx, path, opts, partial)
+		if ok || err != nil {
+			return repo, err
+		}
+	}
+	return clone(ctx, path, opts, bundleURL, cacheDir)
+}
+
+// partialClone clones the reference of the given options to the path with
+// the filters of the Git protocol v2, fetching the blobs of the files not
+// left out by the given PartialCloneOptions only. It returns false, without
+// error and before writing to the path, if the repository is not served over
+// HTTP/S by a server supporting the filters, for it to be cloned fully.
+func partialClone(ctx context.Context, path string, opts *extgogit.CloneOptions, partial *git.PartialCloneOptions) (*extgogit.Repository, bool, error) {
+	if !strings.HasPrefix(opts.URL, "http://") && !strings.HasPrefix(opts.URL, "https://") {
+		return nil, false, nil
+	}
+	session, ok, err := newUploadPackV2(ctx, opts.URL, opts.Auth, opts.CABundle)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	if !session.fetchFeatures["filter"] || (opts.Depth > 0 && !session.fetchFeatures["shallow"]) {
+		return nil, false, nil
+	}
+
+	target, peeled, err := session.lsRef(ctx, opts.ReferenceName)
+	if err != nil {
+		return nil, true, err
+	}
+	repo, err := extgogit.PlainInit(path, false)
+	if err != nil {
+		return nil, true, err
+	}
+	var args []string
+	if opts.Depth > 0 {
+		args = append(args, fmt.Sprintf("deepen %d", opts.Depth))
+	}
+	args = append(args, "filter "+partialCloneFilter)
+	if err := session.fetch(ctx, repo.Storer, []plumbing.Hash{target}, args...); err != nil {
+		return nil, true, err
+	}
+
+	// the remote and the local references are the ones of a full clone
+	local := opts.ReferenceName
+	if local.IsBranch() {
+		local = plumbing.NewRemoteReferenceName(opts.RemoteName, opts.ReferenceName.Short())
+	}
+	if _, err := repo.CreateRemote(&config.RemoteConfig{
+		Name:  opts.RemoteName,
+		URLs:  []string{opts.URL},
+		Fetch: []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", opts.ReferenceName, local))},
+	}); err != nil {
+		return nil, true, err
+	}
+	if opts.ReferenceName.IsBranch() {
+		for _, ref := range []*plumbing.Reference{
+			plumbing.NewHashReference(opts.ReferenceName, target),
+			plumbing.NewHashReference(local, target),
+			plumbing.NewSymbolicReference(plumbing.HEAD, opts.ReferenceName),
+		} {
+			if err := repo.Storer.SetReference(ref); err != nil {
+				return nil, true, err
+			}
+		}
+	} else {
+		for _, ref := range []*plumbing.Reference{
+			plumbing.NewHashReference(opts.ReferenceName, target),
+			plumbing.NewHashReference(plumbing.HEAD, peeled),
+		} {
+			if err := repo.Storer.SetReference(ref); err != nil {
+				return nil, true, err
+			}
+		}
+	}
+
+	commit, err := repo.CommitObject(peeled)
+	if err != nil {
+		return nil, true, fmt.Errorf("git commit '%s' not found: %w", peeled, err)
+	}
+	if err := checkoutPartial(ctx, session, repo, commit, path, partial); err != nil {
+		return nil, true, err
+	}
+	return repo, true, nil
+}
+
+// checkoutPartial writes the files of the given commit to the path, fetching
+// their missing blobs with the given session. The files named as the
+// IgnoreFile of the given options are written first, then the ones not left
+// out by the filter of the options.
+func checkoutPartial(ctx context.Context, session *uploadPackV2, repo *extgogit.Repository, commit *object.Commit,
+	dir string, partial *git.PartialCloneOptions) error {
+	tree, err := commit.Tree()
+	if err != nil {
+		return fmt.Errorf("git tree error: %w", err)
+	}
+	var ignoreFiles, files []treeFile
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("git tree error: %w", err)
+		}
+		switch entry.Mode {
+		case filemode.Regular, filemode.Deprecated, filemode.Executable, filemode.Symlink:
+		default:
+			continue
+		}
+		f := treeFile{name: name, entry: entry}
+		if partial.IgnoreFile != "" && path.Base(name) == partial.IgnoreFile {
+			ignoreFiles = append(ignoreFiles, f)
+			continue
+		}
+		files = append(files, f)
+	}
+
+	if err := writeTreeFiles(ctx, session, repo, dir, ignoreFiles); err != nil {
+		return err
+	}
+	if partial.Filter != nil {
+		filter, err := partial.Filter(dir)
+		if err != nil {
+			return err
+		}
+		kept := files[:0]
+		for _, f := range files {
+			if !filter(f.name) {
+				kept = append(kept, f)
+			}
+		}
+		files = kept
+	}
+	return writeTreeFiles(ctx, session, repo, dir, files)
+}
+
+// treeFile is a file of the tree of a commit.
+type treeFile struct {
+	name  string
+	entry object.TreeEntry
+}
+
+// writeTreeFiles fetches the missing blobs of the given files with the given
+// session, and writes the files to the given directory.
+func writeTreeFiles(ctx context.Context, session *uploadPackV2, repo *extgogit.Repository, dir string, files []treeFile) error {
+	var missing []plumbing.Hash
+	seen := make(map[plumbing.Hash]bool)
+	for _, f := range files {
+		if seen[f.entry.Hash] || repo.Storer.HasEncodedObject(f.entry.Hash) == nil {
+			continue
+		}
+		seen[f.entry.Hash] = true
+		missing = append(missing, f.entry.Hash)
+	}
+	for len(missing) > 0 {
+		n := len(missing)
+		if n > maxWantsPerFetch {
+			n = maxWantsPerFetch
+		}
+		if err := session.fetch(ctx, repo.Storer, missing[:n]); err != nil {
+			return fmt.Errorf("unable to fetch blobs: %w", err)
+		}
+		missing = missing[n:]
+	}
+
+	for _, f := range files {
+		if err := writeTreeFile(repo, dir, f); err != nil {
+			return fmt.Errorf("unable to write '%s': %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// writeTreeFile writes the given file to the given directory, with the
+// permissions of its file mode.
+func writeTreeFile(repo *extgogit.Repository, dir string, f treeFile) error {
+	p, err := securejoin.SecureJoin(dir, f.name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	blob, err := repo.BlobObject(f.entry.Hash)
+	if err != nil {
+		return err
+	}
+	r, err := blob.Reader()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if f.entry.Mode == filemode.Symlink {
+		target, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(string(target), p)
+	}
+	perm := os.FileMode(0o644)
+	if f.entry.Mode == filemode.Executable {
+		perm = 0o755
+	}
+	file, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// uploadPackV2 is a session with the upload-pack service of a repository
+// served over HTTP/S with the Git protocol v2.
+type uploadPackV2 struct {
+	client *gohttp.Client
+	url    string
+	auth   http.AuthMethod
+	// fetchFeatures are the features of the fetch command advertised by
+	// the server.
+	fetchFeatures map[string]bool
+}
+
+// newUploadPackV2 requests the capabilities of the upload-pack service of
+// the repository at the given HTTP/S URL. It returns false if the server
+// does not advertise the protocol v2, or if the repository can not be
+// accessed, for the error to be reported by a full clone.
+func newUploadPackV2(ctx context.Context, u string, auth transport.AuthMethod, caBundle []byte) (*uploadPackV2, bool, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, false, nil
+	}
+	s := &uploadPackV2{}
+	switch a := auth.(type) {
+	case nil:
+		if parsed.User != nil {
+			password, _ := parsed.User.Password()
+			s.auth = &http.BasicAuth{Username: parsed.User.Username(), Password: password}
+		}
+	case http.AuthMethod:
+		s.auth = a
+	default:
+		return nil, false, nil
+	}
+	parsed.User = nil
+	s.url = strings.TrimSuffix(parsed.String(), "/")
+	if s.client, err = uploadPackClient(parsed.Scheme, caBundle, s.auth); err != nil {
+		return nil, false, err
+	}
+
+	req, err := s.newRequest(ctx, gohttp.MethodGet, "/info/refs?service=git-upload-pack", nil)
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, false, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != gohttp.StatusOK {
+		return nil, false, nil
+	}
+
+	r := newPktReader(resp.Body)
+	line, err := r.readLine()
+	if err != nil {
+		return nil, false, nil
+	}
+	// the smart HTTP header is optional with the protocol v2
+	if strings.HasPrefix(line, "# service=") {
+		if _, err := r.readSection(); err != nil {
+			return nil, false, nil
+		}
+		if line, err = r.readLine(); err != nil {
+			return nil, false, nil
+		}
+	}
+	if line != "version 2" {
+		return nil, false, nil
+	}
+	caps, err := r.readSection()
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid capability advertisement: %w", err)
+	}
+	for _, c := range caps {
+		name, value := c, ""
+		if i := strings.Index(c, "="); i >= 0 {
+			name, value = c[:i], c[i+1:]
+		}
+		switch name {
+		case "object-format":
+			if value != "sha1" {
+				return nil, false, nil
+			}
+		case "fetch":
+			s.fetchFeatures = make(map[string]bool)
+			for _, f := range strings.Fields(value) {
+				s.fetchFeatures[f] = true
+			}
+		}
+	}
+	if s.fetchFeatures == nil {
+		return nil, false, nil
+	}
+	return s, true, nil
+}
+
+// uploadPackClient returns the HTTP client of the upload-pack sessions of
+// the given scheme, verifying the server certificate with the given PEM
+// encoded CA bundle in addition to the system ones if not empty. The
+// transports of the client certificates registered to the httpsTransport
+// already trust the CA bundle.
+func uploadPackClient(scheme string, caBundle []byte, auth http.AuthMethod) (*gohttp.Client, error) {
+	if scheme != "https" {
+		return &gohttp.Client{Transport: throttle.Transport(nil)}, nil
+	}
+	if h, ok := auth.(*headerAuth); ok {
+		auth = h.auth
+	}
+	if _, ok := auth.(*clientCertAuth); ok || len(caBundle) == 0 {
+		return &gohttp.Client{Transport: throttle.Transport(httpsTransport)}, nil
+	}
+	t, err := trust.Transport(gohttp.DefaultTransport.(*gohttp.Transport), caBundle)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: no PEM encoded certificate found", git.CAFile)
+	}
+	return &gohttp.Client{Transport: throttle.Transport(t)}, nil
+}
+
+func (s *uploadPackV2) newRequest(ctx context.Context, method, path string, body io.Reader) (*gohttp.Request, error) {
+	req, err := gohttp.NewRequestWithContext(ctx, method, s.url+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Git-Protocol", "version=2")
+	req.Header.Set("User-Agent", "git/2.0 (flux)")
+	if body != nil {
+		req.Header.Set("Content-Type", uploadPackRequest)
+		req.Header.Set("Accept", uploadPackResult)
+	}
+	if s.auth != nil {
+		s.auth.SetAuth(req)
+	}
+	return req, nil
+}
+
+// command sends the given command with the given arguments, and returns the
+// response body.
+func (s *uploadPackV2) command(ctx context.Context, command string, args []string) (io.ReadCloser, error) {
+	var body bytes.Buffer
+	writePktLine(&body, "command="+command+"\n")
+	body.WriteString(delimPkt)
+	for _, arg := range args {
+		writePktLine(&body, arg+"\n")
+	}
+	body.WriteString(flushPkt)
+
+	req, err := s.newRequest(ctx, gohttp.MethodPost, "/git-upload-pack", &body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != gohttp.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: unexpected status code %d", command, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// lsRef returns the target of the given reference of the repository, and
+// the commit it peels to.
+func (s *uploadPackV2) lsRef(ctx context.Context, name plumbing.ReferenceName) (plumbing.Hash, plumbing.Hash, error) {
+	body, err := s.command(ctx, "ls-refs", []string{"peel", "ref-prefix " + name.String()})
+	if err != nil {
+		return plumbing.ZeroHash, plumbing.ZeroHash, err
+	}
+	defer body.Close()
+	refs, err := newPktReader(body).readSection()
+	if err != nil {
+		return plumbing.ZeroHash, plumbing.ZeroHash, fmt.Errorf("ls-refs: %w", err)
+	}
+	for _, ref := range refs {
+		fields := strings.Fields(ref)
+		if len(fields) < 2 || fields[1] != name.String() {
+			continue
+		}
+		target := plumbing.NewHash(fields[0])
+		peeled := target
+		for _, attr := range fields[2:] {
+			if strings.HasPrefix(attr, "peeled:") {
+				peeled = plumbing.NewHash(strings.TrimPrefix(attr, "peeled:"))
+			}
+		}
+		return target, peeled, nil
+	}
+	return plumbing.ZeroHash, plumbing.ZeroHash, fmt.Errorf("couldn't find remote ref %q", name)
+}
+
+// fetch fetches the given objects with the given extra arguments of the
+// fetch command, and writes them to the given storage. The shallow commits
+// of a fetch with a depth are recorded in the storage.
+func (s *uploadPackV2) fetch(ctx context.Context, st storage.Storer, wants []plumbing.Hash, args ...string) error {
+	all := []string{"no-progress", "ofs-delta"}
+	for _, want := range wants {
+		all = append(all, "want "+want.String())
+	}
+	all = append(all, args...)
+	all = append(all, "done")
+	body, err := s.command(ctx, "fetch", all)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	r := newPktReader(body)
+	for {
+		section, err := r.readLine()
+		if err != nil {
+			return fmt.Errorf("fetch: %w", err)
+		}
+		lines, err := func() ([]string, error) {
+			if section == "packfile" {
+				return nil, nil
+			}
+			return r.readSection()
+		}()
+		if err != nil {
+			return fmt.Errorf("fetch: %w", err)
+		}
+		switch section {
+		case "shallow-info":
+			var shallows []plumbing.Hash
+			for _, l := range lines {
+				if strings.HasPrefix(l, "shallow ") {
+					shallows = append(shallows, plumbing.NewHash(strings.TrimPrefix(l, "shallow ")))
+				}
+			}
+			if len(shallows) > 0 {
+				if err := st.SetShallow(shallows); err != nil {
+					return err
+				}
+			}
+		case "packfile":
+			if err := packfile.UpdateObjectStorage(st, &sidebandReader{r: r}); err != nil {
+				return fmt.Errorf("unable to write packfile: %w", err)
+			}
+			return nil
+		}
+	}
+}
+
+const (
+	flushPkt = "0000"
+	delimPkt = "0001"
+)
+
+// writePktLine writes the given payload as a pkt-line to the given buffer.
+func writePktLine(b *bytes.Buffer, payload string) {
+	fmt.Fprintf(b, "%04x%s", len(payload)+4, payload)
+}
+
+// pktReader reads the pkt-lines of a protocol v2 response, including the
+// delimiter packets the go-git scanner does not support.
+type pktReader struct {
+	r *bufio.Reader
+}
+
+func newPktReader(r io.Reader) *pktReader {
+	return &pktReader{r: bufio.NewReader(r)}
+}
+
+// read returns the payload of the next pkt-line, or nil for a flush or a
+// delimiter packet.
+func (p *pktReader) read() ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(p.r, size[:]); err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	n, err := strconv.ParseUint(string(size[:]), 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pkt-line length '%s'", size)
+	}
+	switch {
+	case n <= 2:
+		return nil, nil
+	case n < 4:
+		return nil, fmt.Errorf("invalid pkt-line length '%s'", size)
+	}
+	payload := make([]byte, n-4)
+	if _, err := io.ReadFull(p.r, payload); err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(payload, []byte("ERR ")) {
+		return nil, fmt.Errorf("remote error: %s", strings.TrimSpace(string(payload[4:])))
+	}
+	return payload, nil
+}
+
+// readLine returns the next pkt-line as a string without the line feed.
+func (p *pktReader) readLine() (string, error) {
+	payload, err := p.read()
+	if err != nil {
+		return "", err
+	}
+	if payload == nil {
+		return "", fmt.Errorf("unexpected flush packet")
+	}
+	return strings.TrimSuffix(string(payload), "\n"), nil
+}
+
+// readSection returns the pkt-lines until the next flush or delimiter
+// packet.
+func (p *pktReader) readSection() ([]string, error) {
+	var lines []string
+	for {
+		payload, err := p.read()
+		if err != nil {
+			return nil, err
+		}
+		if payload == nil {
+			return lines, nil
+		}
+		lines = append(lines, strings.TrimSuffix(string(payload), "\n"))
+	}
+}
+
+// sidebandReader reads the packfile data of the side-band-64k pkt-lines of
+// a packfile section, until the flush packet ending it.
+type sidebandReader struct {
+	r       *pktReader
+	pending []byte
+	done    bool
+}
+
+func (s *sidebandReader) Read(b []byte) (int, error) {
+	for len(s.pending) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		payload, err := s.r.read()
+		if err != nil {
+			return 0, err
+		}
+		if payload == nil {
+			s.done = true
+			continue
+		}
+		switch payload[0] {
+		case 1:
+			s.pending = payload[1:]
+		case 2:
+			// progress messages
+		case 3:
+			return 0, fmt.Errorf("remote error: %s", strings.TrimSpace(string(payload[1:])))
+		default:
+			return 0, fmt.Errorf("invalid side-band channel %d", payload[0])
+		}
+	}
+	n := copy(b, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
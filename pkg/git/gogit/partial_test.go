@@ -0,0 +1,202 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gogit
+
+import (
+	"context"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	extgogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"github.com/fluxcd/source-controller/pkg/git"
+)
+
+func TestCheckout_PartialClone(t *testing.T) {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git binary not found")
+	}
+
+	repoDir, err := os.MkdirTemp("", "test-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repoDir)
+	repo, err := extgogit.PlainInit(repoDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		".sourceignore":   "*.bin\n",
+		"kept.txt":        "kept",
+		"dir/kept.yaml":   "kept",
+		"dir/ignored.bin": "ignored",
+		"run.sh":          "#!/bin/sh",
+	}
+	for name, content := range files {
+		p := filepath.Join(repoDir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(repoDir, "run.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddGlob("."); err != nil {
+		t.Fatal(err)
+	}
+	sig := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	head, err := w.Commit("files", &extgogit.CommitOptions{Author: sig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateTag("v1.0.0", head, &extgogit.CreateTagOptions{Tagger: sig, Message: "v1.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := repo.CommitObject(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := c.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ignored, err := tree.FindEntry("dir/ignored.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the repository is served by git-http-backend, supporting the filters
+	rootDir, err := os.MkdirTemp("", "test-root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootDir)
+	bareDir := filepath.Join(rootDir, "repo.git")
+	for _, args := range [][]string{
+		{"clone", "--bare", "--quiet", repoDir, bareDir},
+		{"-C", bareDir, "config", "uploadpack.allowFilter", "true"},
+		{"-C", bareDir, "config", "uploadpack.allowAnySHA1InWant", "true"},
+	} {
+		if out, err := exec.Command(gitPath, args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %s", strings.Join(args, " "), out)
+		}
+	}
+	backend := &cgi.Handler{
+		Path: gitPath,
+		Args: []string{"http-backend"},
+		Env:  []string{"GIT_PROJECT_ROOT=" + rootDir, "GIT_HTTP_EXPORT_ALL=1"},
+	}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+	// the protocol v0 is used without the Git-Protocol header
+	v0 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del("Git-Protocol")
+		backend.ServeHTTP(w, r)
+	}))
+	defer v0.Close()
+
+	partial := &git.PartialCloneOptions{
+		IgnoreFile: ".sourceignore",
+		Filter: func(dir string) (git.PathFilter, error) {
+			patterns, err := os.ReadFile(filepath.Join(dir, ".sourceignore"))
+			if err != nil {
+				return nil, err
+			}
+			suffix := strings.TrimPrefix(strings.TrimSpace(string(patterns)), "*")
+			return func(path string) bool {
+				return strings.HasSuffix(path, suffix)
+			}, nil
+		},
+	}
+
+	tests := []struct {
+		name        string
+		url         string
+		ref         *sourcev1.GitRepositoryRef
+		wantPartial bool
+	}{
+		{name: "branch", url: server.URL + "/repo.git", ref: &sourcev1.GitRepositoryRef{Branch: "master"}, wantPartial: true},
+		{name: "tag", url: server.URL + "/repo.git", ref: &sourcev1.GitRepositoryRef{Tag: "v1.0.0"}, wantPartial: true},
+		{name: "protocol v0", url: v0.URL + "/repo.git", ref: &sourcev1.GitRepositoryRef{Branch: "master"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, err := os.MkdirTemp("", "test-checkout")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			strategy := CheckoutStrategyForRef(tt.ref, git.CheckoutOptions{GitImplementation: sourcev1.GoGitImplementation, PartialClone: partial})
+			commit, _, err := strategy.Checkout(context.TODO(), tmpDir, tt.url, &git.Auth{})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if commit.Hash() != head.String() {
+				t.Errorf("expected commit %s, got %s", head, commit.Hash())
+			}
+
+			for _, name := range []string{".sourceignore", "kept.txt", "dir/kept.yaml", "run.sh"} {
+				b, err := os.ReadFile(filepath.Join(tmpDir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(b) != files[name] {
+					t.Errorf("expected %q content %q, got %q", name, files[name], b)
+				}
+			}
+			fi, err := os.Stat(filepath.Join(tmpDir, "run.sh"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode().Perm()&0100 == 0 {
+				t.Error("expected run.sh to be executable")
+			}
+
+			_, err = os.Stat(filepath.Join(tmpDir, "dir/ignored.bin"))
+			if tt.wantPartial != os.IsNotExist(err) {
+				t.Errorf("expected the ignored file to be checked out: %v, got error %v", !tt.wantPartial, err)
+			}
+			cloned, err := extgogit.PlainOpen(tmpDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fetched := cloned.Storer.HasEncodedObject(ignored.Hash) == nil
+			if fetched == tt.wantPartial {
+				t.Errorf("expected the blob of the ignored file to be fetched: %v", !tt.wantPartial)
+			}
+		})
+	}
+}
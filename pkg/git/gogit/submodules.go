@@ -0,0 +1,161 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gogit
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	extgogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+
+	"github.com/fluxcd/source-controller/pkg/git"
+)
+
+// submoduleOptions configures the initialization of the submodules of the
+// checked out worktree.
+type submoduleOptions struct {
+	// recurse initializes the submodules.
+	recurse bool
+	// depth is the maximum depth of the nested submodules, the submodules
+	// of the repository being at depth 1. Defaults to the go-git default
+	// recursion depth when zero.
+	depth int
+	// paths are the paths of the submodules to initialize, relative to the
+	// root of the repository. All the submodules are initialized when empty.
+	paths []string
+	// checkURL returns an error if the submodule with the given URL must
+	// not be fetched. Any URL is fetched when nil.
+	checkURL func(url string) error
+}
+
+func newSubmoduleOptions(opt git.CheckoutOptions) submoduleOptions {
+	return submoduleOptions{
+		recurse:  opt.RecurseSubmodules,
+		depth:    opt.SubmoduleDepth,
+		paths:    opt.SubmodulePaths,
+		checkURL: opt.CheckSubmoduleURL,
+	}
+}
+
+// updateSubmodules initializes and checks out the submodules of the
+// worktree of the given repository allowed by the given options.
+func updateSubmodules(ctx context.Context, repo *extgogit.Repository, opts submoduleOptions, auth transport.AuthMethod) error {
+	if !opts.recurse {
+		return nil
+	}
+	depth := opts.depth
+	if depth <= 0 {
+		depth = int(extgogit.DefaultSubmoduleRecursionDepth)
+	}
+	if err := updateNestedSubmodules(ctx, repo, "", depth, opts, auth); err != nil {
+		return fmt.Errorf("git submodules update error: %w", err)
+	}
+	return nil
+}
+
+func updateNestedSubmodules(ctx context.Context, repo *extgogit.Repository, prefix string, depth int, opts submoduleOptions, auth transport.AuthMethod) error {
+	w, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	subs, err := w.Submodules()
+	if err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		p := path.Join(prefix, sub.Config().Path)
+		if !submoduleAllowed(p, opts.paths) {
+			continue
+		}
+		if opts.checkURL != nil {
+			u, err := submoduleURL(repo, sub.Config().URL)
+			if err != nil {
+				return fmt.Errorf("submodule '%s': %w", p, err)
+			}
+			if err := opts.checkURL(u); err != nil {
+				return fmt.Errorf("submodule '%s': %w", p, err)
+			}
+		}
+		if err := sub.UpdateContext(ctx, &extgogit.SubmoduleUpdateOptions{
+			Init: true,
+			Auth: auth,
+		}); err != nil {
+			return fmt.Errorf("submodule '%s': %w", p, err)
+		}
+		if depth <= 1 {
+			continue
+		}
+		subRepo, err := sub.Repository()
+		if err != nil {
+			return fmt.Errorf("submodule '%s': %w", p, err)
+		}
+		if err := updateNestedSubmodules(ctx, subRepo, p, depth-1, opts, auth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// submoduleURL returns the URL the submodule with the given configured URL
+// is fetched from, resolving a relative URL against the URL of the first
+// remote of the given repository as go-git does.
+func submoduleURL(repo *extgogit.Repository, subURL string) (string, error) {
+	u, err := url.Parse(subURL)
+	if err != nil || path.IsAbs(u.Path) {
+		// the scp-like URLs are not parsed, and are never relative
+		return subURL, nil
+	}
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return "", err
+	}
+	if len(remotes) == 0 || len(remotes[0].Config().URLs) == 0 {
+		return "", fmt.Errorf("unable to resolve relative URL '%s' without remote", subURL)
+	}
+	return resolveSubmoduleURL(remotes[0].Config().URLs[0], u)
+}
+
+// resolveSubmoduleURL returns the given relative submodule URL joined to the
+// path of the given URL of the remote of its repository.
+func resolveSubmoduleURL(remoteURL string, sub *url.URL) (string, error) {
+	root, err := url.Parse(remoteURL)
+	if err != nil {
+		return "", err
+	}
+	root.Path = path.Join(root.Path, sub.Path)
+	return root.String(), nil
+}
+
+// submoduleAllowed returns true if the submodule at the given path is
+// allowed by the given paths: if no path is given, if it is one of the paths
+// or nested in one of them, or if one of the paths is nested in it.
+func submoduleAllowed(p string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, allowed := range paths {
+		allowed = path.Clean(strings.Trim(allowed, "/"))
+		if p == allowed || strings.HasPrefix(p, allowed+"/") || strings.HasPrefix(allowed, p+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gogit
+
+import (
+	"net/url"
+	"testing"
+)
+
+func Test_submoduleAllowed(t *testing.T) {
+	tests := []struct {
+		name  string
+		path  string
+		paths []string
+		want  bool
+	}{
+		{name: "no allowlist", path: "vendor/lib", want: true},
+		{name: "allowed path", path: "apps/frontend", paths: []string{"apps/frontend"}, want: true},
+		{name: "allowed path with slashes", path: "apps/frontend", paths: []string{"/apps/frontend/"}, want: true},
+		{name: "nested in an allowed path", path: "apps/frontend/theme", paths: []string{"apps/frontend"}, want: true},
+		{name: "containing an allowed path", path: "vendor/charts", paths: []string{"vendor/charts/backend"}, want: true},
+		{name: "other path", path: "apps/backend", paths: []string{"apps/frontend"}},
+		{name: "path with the same prefix", path: "apps/frontend-legacy", paths: []string{"apps/frontend"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := submoduleAllowed(tt.path, tt.paths); got != tt.want {
+				t.Errorf("submoduleAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_resolveSubmoduleURL(t *testing.T) {
+	tests := []struct {
+		remote string
+		sub    string
+		want   string
+	}{
+		{remote: "https://github.com/ourorg/podinfo", sub: "../lib.git", want: "https://github.com/ourorg/lib.git"},
+		{remote: "ssh://git@github.com/ourorg/podinfo.git", sub: "./vendor/lib", want: "ssh://git@github.com/ourorg/podinfo.git/vendor/lib"},
+		{remote: "https://github.com/ourorg/podinfo", sub: "../../otherorg/lib", want: "https://github.com/otherorg/lib"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sub, func(t *testing.T) {
+			sub, err := url.Parse(tt.sub)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := resolveSubmoduleURL(tt.remote, sub)
+			if err != nil {
+				t.Fatalf("resolveSubmoduleURL() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveSubmoduleURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -17,9 +17,17 @@ limitations under the License.
 package gogit
 
 import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"fmt"
+	gohttp "net/http"
 	"net/url"
+	"strings"
+	"sync"
 
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
 	corev1 "k8s.io/api/core/v1"
@@ -27,6 +35,8 @@ import (
 	"github.com/fluxcd/pkg/ssh/knownhosts"
 
 	"github.com/fluxcd/source-controller/pkg/git"
+	"github.com/fluxcd/source-controller/pkg/throttle"
+	"github.com/fluxcd/source-controller/pkg/trust"
 )
 
 func AuthSecretStrategyForURL(URL string) (git.AuthSecretStrategy, error) {
@@ -66,6 +76,26 @@ func (s *BasicAuth) Method(secret corev1.Secret) (*git.Auth, error) {
 	if basicAuth.Username != "" && basicAuth.Password != "" {
 		auth.AuthMethod = basicAuth
 	}
+
+	certPEM, keyPEM := secret.Data[git.TLSCertFile], secret.Data[git.TLSKeyFile]
+	if len(certPEM) == 0 && len(keyPEM) == 0 {
+		return auth, nil
+	}
+	if len(certPEM) == 0 || len(keyPEM) == 0 {
+		return nil, fmt.Errorf("invalid '%s' secret data: required fields '%s' and '%s'", secret.Name, git.TLSCertFile, git.TLSKeyFile)
+	}
+	id, err := httpsTransport.register(certPEM, keyPEM, auth.CABundle)
+	if err != nil {
+		return nil, fmt.Errorf("invalid '%s' secret data: %w", secret.Name, err)
+	}
+	certAuth := &clientCertAuth{id: id}
+	if basicAuth.Username != "" && basicAuth.Password != "" {
+		certAuth.auth = basicAuth
+	}
+	// the CA is verified by the transport of the certificate, instead of the
+	// one go-git creates for a CA bundle
+	auth.AuthMethod = certAuth
+	auth.CABundle = nil
 	return auth, nil
 }
 
@@ -102,3 +132,186 @@ func (s *PublicKeyAuth) Method(secret corev1.Secret) (*git.Auth, error) {
 
 	return &git.Auth{AuthMethod: pk}, nil
 }
+
+// clientCertHeader is the header set by the clientCertAuth on the requests,
+// holding the ID of the transport presenting its client certificate. It is
+// removed by the clientCertTransport before the requests are sent.
+const clientCertHeader = "X-Flux-Client-Cert-Id"
+
+// httpsTransport is the transport of the go-git HTTPS client.
+var httpsTransport = &clientCertTransport{
+	base:       trust.DefaultTransport,
+	transports: make(map[string]gohttp.RoundTripper),
+}
+
+func init() {
+	// the clones are throttled by the limiters of their context
+	client.InstallProtocol("http", http.NewClient(&gohttp.Client{Transport: throttle.Transport(nil)}))
+	client.InstallProtocol("https", http.NewClient(&gohttp.Client{Transport: throttle.Transport(httpsTransport)}))
+}
+
+// InstallClientCertificate replaces the base go-git HTTPS transport with one
+// presenting the certificate returned by getCertificate to the servers
+// requesting a TLS client certificate. The repositories with a caFile or a
+// client certificate in their Secret are cloned with a transport of their
+// own, without this certificate.
+func InstallClientCertificate(getCertificate func(*tls.CertificateRequestInfo) (*tls.Certificate, error)) {
+	transport := gohttp.DefaultTransport.(*gohttp.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{GetClientCertificate: getCertificate}
+	base, _ := trust.Transport(transport, nil)
+	httpsTransport.mu.Lock()
+	httpsTransport.base = base
+	httpsTransport.mu.Unlock()
+}
+
+// clientCertTransport sends the requests of a clientCertAuth with the
+// transport registered for its client certificate, and the others with the
+// base transport. go-git does not allow setting the transport per clone.
+type clientCertTransport struct {
+	mu   sync.RWMutex
+	base gohttp.RoundTripper
+	// transports are the transports of the client certificates by ID,
+	// kept for their connections to be reused across clones.
+	transports map[string]gohttp.RoundTripper
+}
+
+// register returns the ID of the transport presenting the given PEM encoded
+// client certificate and key, and verifying the server certificate with the
+// given PEM encoded CA bundle in addition to the system ones if not empty.
+// The transport is created if it is not registered yet.
+func (t *clientCertTransport) register(certPEM, keyPEM, caBundle []byte) (string, error) {
+	h := sha256.New()
+	for _, b := range [][]byte{certPEM, keyPEM, caBundle} {
+		h.Write(b)
+		h.Write([]byte{0})
+	}
+	id := hex.EncodeToString(h.Sum(nil))
+
+	t.mu.RLock()
+	_, ok := t.transports[id]
+	t.mu.RUnlock()
+	if ok {
+		return id, nil
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return "", fmt.Errorf("invalid client certificate: %w", err)
+	}
+	base := gohttp.DefaultTransport.(*gohttp.Transport).Clone()
+	base.TLSClientConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	transport, err := trust.Transport(base, caBundle)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s: no PEM encoded certificate found", git.CAFile)
+	}
+
+	t.mu.Lock()
+	if _, ok := t.transports[id]; !ok {
+		t.transports[id] = transport
+	}
+	t.mu.Unlock()
+	return id, nil
+}
+
+func (t *clientCertTransport) RoundTrip(req *gohttp.Request) (*gohttp.Response, error) {
+	id := req.Header.Get(clientCertHeader)
+	t.mu.RLock()
+	base, transport := t.base, t.transports[id]
+	t.mu.RUnlock()
+	if id == "" {
+		return base.RoundTrip(req)
+	}
+	if transport == nil {
+		return nil, fmt.Errorf("no transport registered for the client certificate")
+	}
+	req = req.Clone(req.Context())
+	req.Header.Del(clientCertHeader)
+	return transport.RoundTrip(req)
+}
+
+// clientCertAuth is an http.AuthMethod sending the requests with the
+// transport of a client certificate registered to the httpsTransport, and the
+// credentials of the wrapped http.AuthMethod if not nil.
+type clientCertAuth struct {
+	id   string
+	auth http.AuthMethod
+}
+
+func (a *clientCertAuth) Name() string {
+	if a.auth != nil {
+		return a.auth.Name()
+	}
+	return "tls-client-certificate"
+}
+
+func (a *clientCertAuth) String() string {
+	if a.auth != nil {
+		return a.auth.String()
+	}
+	return a.Name()
+}
+
+func (a *clientCertAuth) SetAuth(r *gohttp.Request) {
+	if r.URL.Scheme == "https" {
+		r.Header.Set(clientCertHeader, a.id)
+	}
+	if a.auth != nil {
+		a.auth.SetAuth(r)
+	}
+}
+
+// authMethod returns the auth method for cloning the repository at the given
+// URL, which sets the given headers on the requests to HTTP/S repositories
+// before the credentials of the given auth method, or of the URL.
+func authMethod(u string, auth transport.AuthMethod, headers gohttp.Header) transport.AuthMethod {
+	if a, ok := auth.(*clientCertAuth); ok && a.auth == nil {
+		if ep, err := transport.NewEndpoint(u); err == nil && ep.User != "" {
+			auth = &clientCertAuth{id: a.id, auth: &http.BasicAuth{Username: ep.User, Password: ep.Password}}
+		}
+	}
+	if len(headers) == 0 || !(strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://")) {
+		return auth
+	}
+	a := &headerAuth{headers: headers}
+	switch m := auth.(type) {
+	case nil:
+		if ep, err := transport.NewEndpoint(u); err == nil && ep.User != "" {
+			a.auth = &http.BasicAuth{Username: ep.User, Password: ep.Password}
+		}
+	case http.AuthMethod:
+		a.auth = m
+	default:
+		return auth
+	}
+	return a
+}
+
+// headerAuth is an http.AuthMethod setting extra headers on the requests, in
+// addition to the credentials of the wrapped http.AuthMethod if not nil.
+type headerAuth struct {
+	auth    http.AuthMethod
+	headers gohttp.Header
+}
+
+func (a *headerAuth) Name() string {
+	if a.auth != nil {
+		return a.auth.Name()
+	}
+	return "http-headers"
+}
+
+func (a *headerAuth) String() string {
+	if a.auth != nil {
+		return a.auth.String()
+	}
+	return a.Name()
+}
+
+func (a *headerAuth) SetAuth(r *gohttp.Request) {
+	for k, v := range a.headers {
+		r.Header[k] = v
+	}
+	if a.auth != nil {
+		a.auth.SetAuth(r)
+	}
+}
@@ -33,34 +33,44 @@ import (
 )
 
 func CheckoutStrategyForRef(ref *sourcev1.GitRepositoryRef, opt git.CheckoutOptions) git.CheckoutStrategy {
+	headers := headerLines(opt.Headers)
 	switch {
 	case ref == nil:
-		return &CheckoutBranch{branch: git.DefaultBranch}
+		return &CheckoutBranch{branch: git.DefaultBranch, headers: headers}
 	case ref.SemVer != "":
-		return &CheckoutSemVer{semVer: ref.SemVer}
+		strategy := &CheckoutSemVer{semVer: ref.SemVer, headers: headers}
+		if ref.SemVerScope == sourcev1.BranchSemVerScope {
+			strategy.branch = ref.Branch
+			if strategy.branch == "" {
+				strategy.branch = git.DefaultBranch
+			}
+		}
+		return strategy
 	case ref.Tag != "":
-		return &CheckoutTag{tag: ref.Tag}
+		return &CheckoutTag{tag: ref.Tag, headers: headers}
 	case ref.Commit != "":
-		strategy := &CheckoutCommit{branch: ref.Branch, commit: ref.Commit}
+		strategy := &CheckoutCommit{branch: ref.Branch, commit: ref.Commit, headers: headers}
 		if strategy.branch == "" {
 			strategy.branch = git.DefaultBranch
 		}
 		return strategy
 	case ref.Branch != "":
-		return &CheckoutBranch{branch: ref.Branch}
+		return &CheckoutBranch{branch: ref.Branch, headers: headers}
 	default:
-		return &CheckoutBranch{branch: git.DefaultBranch}
+		return &CheckoutBranch{branch: git.DefaultBranch, headers: headers}
 	}
 }
 
 type CheckoutBranch struct {
-	branch string
+	branch  string
+	headers []string
 }
 
 func (c *CheckoutBranch) Checkout(ctx context.Context, path, url string, auth *git.Auth) (git.Commit, string, error) {
 	repo, err := git2go.Clone(url, path, &git2go.CloneOptions{
 		FetchOptions: &git2go.FetchOptions{
 			DownloadTags: git2go.DownloadTagsNone,
+			Headers:      c.headers,
 			RemoteCallbacks: git2go.RemoteCallbacks{
 				CredentialsCallback:      auth.CredCallback,
 				CertificateCheckCallback: auth.CertCallback,
@@ -79,17 +89,19 @@ func (c *CheckoutBranch) Checkout(ctx context.Context, path, url string, auth *g
 	if err != nil {
 		return nil, "", fmt.Errorf("git commit '%s' not found: %w", head.Target(), err)
 	}
-	return &Commit{commit}, fmt.Sprintf("%s/%s", c.branch, head.Target().String()), nil
+	return &Commit{commit: commit}, fmt.Sprintf("%s/%s", c.branch, head.Target().String()), nil
 }
 
 type CheckoutTag struct {
-	tag string
+	tag     string
+	headers []string
 }
 
 func (c *CheckoutTag) Checkout(ctx context.Context, path, url string, auth *git.Auth) (git.Commit, string, error) {
 	repo, err := git2go.Clone(url, path, &git2go.CloneOptions{
 		FetchOptions: &git2go.FetchOptions{
 			DownloadTags: git2go.DownloadTagsAll,
+			Headers:      c.headers,
 			RemoteCallbacks: git2go.RemoteCallbacks{
 				CredentialsCallback:      auth.CredCallback,
 				CertificateCheckCallback: auth.CertCallback,
@@ -122,18 +134,24 @@ func (c *CheckoutTag) Checkout(ctx context.Context, path, url string, auth *git.
 		return nil, "", fmt.Errorf("git checkout error: %w", err)
 	}
 
-	return &Commit{commit}, fmt.Sprintf("%s/%s", c.tag, commit.Id().String()), nil
+	tagged, err := tagCommit(repo, commit, c.tag)
+	if err != nil {
+		return nil, "", err
+	}
+	return tagged, fmt.Sprintf("%s/%s", c.tag, commit.Id().String()), nil
 }
 
 type CheckoutCommit struct {
-	branch string
-	commit string
+	branch  string
+	commit  string
+	headers []string
 }
 
 func (c *CheckoutCommit) Checkout(ctx context.Context, path, url string, auth *git.Auth) (git.Commit, string, error) {
 	repo, err := git2go.Clone(url, path, &git2go.CloneOptions{
 		FetchOptions: &git2go.FetchOptions{
 			DownloadTags: git2go.DownloadTagsNone,
+			Headers:      c.headers,
 			RemoteCallbacks: git2go.RemoteCallbacks{
 				CredentialsCallback:      auth.CredCallback,
 				CertificateCheckCallback: auth.CertCallback,
@@ -163,11 +181,15 @@ func (c *CheckoutCommit) Checkout(ctx context.Context, path, url string, auth *g
 		return nil, "", fmt.Errorf("git checkout error: %w", err)
 	}
 
-	return &Commit{commit}, fmt.Sprintf("%s/%s", c.branch, commit.Id().String()), nil
+	return &Commit{commit: commit}, fmt.Sprintf("%s/%s", c.branch, commit.Id().String()), nil
 }
 
 type CheckoutSemVer struct {
 	semVer string
+	// branch restricts the matched tags to the ones reachable from the
+	// branch, if set.
+	branch  string
+	headers []string
 }
 
 func (c *CheckoutSemVer) Checkout(ctx context.Context, path, url string, auth *git.Auth) (git.Commit, string, error) {
@@ -179,6 +201,7 @@ func (c *CheckoutSemVer) Checkout(ctx context.Context, path, url string, auth *g
 	repo, err := git2go.Clone(url, path, &git2go.CloneOptions{
 		FetchOptions: &git2go.FetchOptions{
 			DownloadTags: git2go.DownloadTagsAll,
+			Headers:      c.headers,
 			RemoteCallbacks: git2go.RemoteCallbacks{
 				CredentialsCallback:      auth.CredCallback,
 				CertificateCheckCallback: auth.CertCallback,
@@ -189,6 +212,15 @@ func (c *CheckoutSemVer) Checkout(ctx context.Context, path, url string, auth *g
 		return nil, "", fmt.Errorf("unable to clone '%s', error: %w", url, err)
 	}
 
+	var branchHead *git2go.Oid
+	if c.branch != "" {
+		ref, err := repo.References.Lookup(fmt.Sprintf("refs/remotes/%s/%s", git.DefaultOrigin, c.branch))
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to find branch '%s': %w", c.branch, err)
+		}
+		branchHead = ref.Target()
+	}
+
 	tags := make(map[string]string)
 	tagTimestamps := make(map[string]time.Time)
 	if err := repo.Tags.Foreach(func(name string, id *git2go.Oid) error {
@@ -205,6 +237,15 @@ func (c *CheckoutSemVer) Checkout(ctx context.Context, path, url string, auth *g
 		if err != nil {
 			return err
 		}
+		if branchHead != nil && !branchHead.Equal(c.Id()) {
+			reachable, err := repo.DescendantOf(branchHead, c.Id())
+			if err != nil {
+				return fmt.Errorf("can't check if tag %s is reachable from branch: %w", name, err)
+			}
+			if !reachable {
+				return nil
+			}
+		}
 		tagTimestamps[tag.Name()] = c.Committer().When
 		tags[tag.Name()] = name
 		return nil
@@ -224,6 +265,9 @@ func (c *CheckoutSemVer) Checkout(ctx context.Context, path, url string, auth *g
 		matchedVersions = append(matchedVersions, v)
 	}
 	if len(matchedVersions) == 0 {
+		if c.branch != "" {
+			return nil, "", fmt.Errorf("no match found for semver: %s on branch '%s'", c.semVer, c.branch)
+		}
 		return nil, "", fmt.Errorf("no match found for semver: %s", c.semVer)
 	}
 
@@ -268,5 +312,9 @@ func (c *CheckoutSemVer) Checkout(ctx context.Context, path, url string, auth *g
 		return nil, "", fmt.Errorf("git checkout error: %w", err)
 	}
 
-	return &Commit{commit}, fmt.Sprintf("%s/%s", t, commit.Id().String()), nil
+	tagged, err := tagCommit(repo, commit, t)
+	if err != nil {
+		return nil, "", err
+	}
+	return tagged, fmt.Sprintf("%s/%s", t, commit.Id().String()), nil
 }
@@ -19,16 +19,42 @@ package libgit2
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"strings"
 
 	"golang.org/x/crypto/openpgp"
 
 	git2go "github.com/libgit2/git2go/v31"
 	corev1 "k8s.io/api/core/v1"
+
+	"github.com/fluxcd/source-controller/pkg/git"
 )
 
+// pgpSignatureHeader is the first line of the PGP signature appended to the
+// content of a signed tag.
+const pgpSignatureHeader = "-----BEGIN PGP SIGNATURE-----"
+
 type Commit struct {
 	commit *git2go.Commit
+	// tagName is the name of the tag the commit was checked out from, if
+	// any, and tag its object if the tag is annotated.
+	tagName string
+	tag     *git2go.Tag
+}
+
+// tagCommit returns the given commit checked out from the tag with the given
+// name of the given repository.
+func tagCommit(repo *git2go.Repository, commit *git2go.Commit, name string) (*Commit, error) {
+	ref, err := repo.References.Lookup("refs/tags/" + name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find tag '%s': %w", name, err)
+	}
+	c := &Commit{commit: commit, tagName: name}
+	// the lookup fails for a lightweight tag, which targets the commit
+	if tag, err := repo.LookupTag(ref.Target()); err == nil {
+		c.tag = tag
+	}
+	return c, nil
 }
 
 func (c *Commit) Hash() string {
@@ -63,3 +89,167 @@ func (c *Commit) Verify(secret corev1.Secret) error {
 
 	return nil
 }
+
+// IsDescendantOf returns true if the commit with the given hash is reachable
+// from the commit.
+func (c *Commit) IsDescendantOf(hash string) (bool, error) {
+	if c.commit.Id().String() == hash {
+		return true, nil
+	}
+	oid, err := git2go.NewOid(hash)
+	if err != nil {
+		return false, err
+	}
+	repo := c.commit.Owner()
+	// The commit is not in the clone when it is not reachable from the
+	// branch anymore.
+	if _, err := repo.LookupCommit(oid); err != nil {
+		return false, nil
+	}
+	return repo.DescendantOf(c.commit.Id(), oid)
+}
+
+// ChangedFiles returns the paths of the files changed since the commit with
+// the given hash, or since the first parent of the commit if the hash is empty
+// or not reachable from the commit.
+func (c *Commit) ChangedFiles(since string) ([]string, error) {
+	repo := c.commit.Owner()
+	var base *git2go.Commit
+	if since != "" {
+		if descendant, err := c.IsDescendantOf(since); err == nil && descendant {
+			oid, err := git2go.NewOid(since)
+			if err != nil {
+				return nil, err
+			}
+			if base, err = repo.LookupCommit(oid); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if base == nil && c.commit.ParentCount() > 0 {
+		if base = c.commit.Parent(0); base == nil {
+			return nil, fmt.Errorf("git parent of '%s' not found", c.commit.Id())
+		}
+	}
+
+	tree, err := c.commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	var baseTree *git2go.Tree
+	if base != nil {
+		if baseTree, err = base.Tree(); err != nil {
+			return nil, err
+		}
+	}
+	diff, err := repo.DiffTreeToTree(baseTree, tree, nil)
+	if err != nil {
+		return nil, fmt.Errorf("git diff of '%s' error: %w", c.commit.Id(), err)
+	}
+	defer diff.Free()
+	seen := make(map[string]bool)
+	var paths []string
+	err = diff.ForEach(func(delta git2go.DiffDelta, _ float64) (git2go.DiffForEachHunkCallback, error) {
+		for _, name := range []string{delta.OldFile.Path, delta.NewFile.Path} {
+			if name != "" && !seen[name] {
+				seen[name] = true
+				paths = append(paths, name)
+			}
+		}
+		return nil, nil
+	}, git2go.DiffDetailFiles)
+	if err != nil {
+		return nil, fmt.Errorf("git diff of '%s' error: %w", c.commit.Id(), err)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Signers returns the names of the keys of the given secret the PGP signature
+// of the commit is verified by.
+func (c *Commit) Signers(secret corev1.Secret) []string {
+	signature, signedData, err := c.commit.ExtractSignature()
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for name, b := range secret.Data {
+		keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(b))
+		if err != nil {
+			continue
+		}
+		if _, err := openpgp.CheckArmoredDetachedSignature(keyring, strings.NewReader(signedData), strings.NewReader(signature)); err == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Info returns the author, committer and message of the commit.
+func (c *Commit) Info() git.CommitInfo {
+	_, _, err := c.commit.ExtractSignature()
+	return git.CommitInfo{
+		Author:    signature(c.commit.Author()),
+		Committer: signature(c.commit.Committer()),
+		Message:   c.commit.Message(),
+		Signed:    err == nil,
+	}
+}
+
+func signature(s *git2go.Signature) git.Signature {
+	if s == nil {
+		return git.Signature{}
+	}
+	return git.Signature{Name: s.Name, Email: s.Email, When: s.When}
+}
+
+// Tag returns the metadata of the tag the commit was checked out from, or nil
+// if it was not checked out from a tag.
+func (c *Commit) Tag() *git.TagInfo {
+	if c.tagName == "" {
+		return nil
+	}
+	info := &git.TagInfo{Name: c.tagName}
+	if c.tag != nil {
+		info.Annotated = true
+		info.Tagger = signature(c.tag.Tagger())
+		info.Signed = strings.Contains(c.tag.Message(), pgpSignatureHeader)
+	}
+	return info
+}
+
+// VerifyTag returns an error if the PGP signature of the annotated tag the
+// commit was checked out from can't be verified.
+func (c *Commit) VerifyTag(secret corev1.Secret) error {
+	if c.tag == nil {
+		return fmt.Errorf("no PGP signature found for tag: %s", c.tagName)
+	}
+	odb, err := c.tag.Owner().Odb()
+	if err != nil {
+		return err
+	}
+	obj, err := odb.Read(c.tag.Id())
+	if err != nil {
+		return err
+	}
+	// the data is copied before the object is freed
+	data := string(obj.Data())
+	obj.Free()
+	i := strings.Index(data, pgpSignatureHeader)
+	if i < 0 {
+		return fmt.Errorf("no PGP signature found for tag: %s", c.tagName)
+	}
+	signature, signedData := data[i:], data[:i]
+
+	for _, b := range secret.Data {
+		keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		if _, err := openpgp.CheckArmoredDetachedSignature(keyring, strings.NewReader(signedData), strings.NewReader(signature)); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("PGP signature of tag '%s' can't be verified", c.tagName)
+}
@@ -26,7 +26,9 @@ import (
 	"fmt"
 	"hash"
 	"net"
+	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 
 	git2go "github.com/libgit2/git2go/v31"
@@ -56,6 +58,9 @@ func AuthSecretStrategyForURL(URL string) (git.AuthSecretStrategy, error) {
 type BasicAuth struct{}
 
 func (s *BasicAuth) Method(secret corev1.Secret) (*git.Auth, error) {
+	if _, ok := secret.Data[git.TLSCertFile]; ok {
+		return nil, fmt.Errorf("found %s key in secret '%s' but libgit2 HTTPS transport does not support client certificates", git.TLSCertFile, secret.Name)
+	}
 	var credCallback git2go.CredentialsCallback
 	var username string
 	if d, ok := secret.Data["username"]; ok {
@@ -237,3 +242,20 @@ func containsHost(hosts []string, host string) bool {
 
 	return false
 }
+
+// headerLines returns the given headers as sorted 'Name: value' lines, for
+// the git2go.FetchOptions. The User-Agent is left out, as libgit2 refuses to
+// override it.
+func headerLines(headers http.Header) []string {
+	var lines []string
+	for k, values := range headers {
+		if k == "User-Agent" {
+			continue
+		}
+		for _, v := range values {
+			lines = append(lines, k+": "+v)
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
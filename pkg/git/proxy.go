@@ -0,0 +1,180 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package git
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+
+	gossh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	git2go "github.com/libgit2/git2go/v31"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/proxy"
+)
+
+// SSHProxy forwards the connections to an SSH Git server through a SOCKS5
+// proxy. It listens on a local address, which the Git implementations are
+// pointed at using the URL returned by SSHProxy.URL.
+type SSHProxy struct {
+	listener net.Listener
+	dialer   proxy.Dialer
+	url      *url.URL
+	host     string
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// NewSSHProxy starts forwarding the connections for the given SSH repository
+// URL through the SOCKS5 proxy with the given URL, in the
+// 'socks5://[user:password@]host:port' format. The caller must Close the
+// SSHProxy once done.
+func NewSSHProxy(proxyURL, repositoryURL string) (*SSHProxy, error) {
+	pu, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	if pu.Scheme != "socks5" {
+		return nil, fmt.Errorf("unsupported proxy scheme '%s', must be 'socks5'", pu.Scheme)
+	}
+	dialer, err := proxy.FromURL(pu, proxy.Direct)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+
+	u, err := url.Parse(repositoryURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository URL: %w", err)
+	}
+	if u.Scheme != "ssh" {
+		return nil, fmt.Errorf("proxy is only supported for SSH repositories")
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "22")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for proxy connections: %w", err)
+	}
+	p := &SSHProxy{
+		listener: listener,
+		dialer:   dialer,
+		url:      u,
+		host:     host,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	p.wg.Add(1)
+	go p.serve()
+	return p, nil
+}
+
+// URL returns the repository URL pointing to the local address of the
+// SSHProxy.
+func (p *SSHProxy) URL() string {
+	u := *p.url
+	u.Host = p.listener.Addr().String()
+	return u.String()
+}
+
+// Auth returns a copy of the given Auth verifying the host key of the
+// repository host instead of the local address of the SSHProxy.
+func (p *SSHProxy) Auth(auth *Auth) *Auth {
+	if auth == nil {
+		return nil
+	}
+	a := *auth
+	if pk, ok := auth.AuthMethod.(*gossh.PublicKeys); ok && pk.HostKeyCallback != nil {
+		c := *pk
+		callback := pk.HostKeyCallback
+		c.HostKeyCallback = func(_ string, remote net.Addr, key ssh.PublicKey) error {
+			return callback(p.host, remote, key)
+		}
+		a.AuthMethod = &c
+	}
+	if auth.CertCallback != nil {
+		callback := auth.CertCallback
+		a.CertCallback = func(cert *git2go.Certificate, valid bool, _ string) git2go.ErrorCode {
+			return callback(cert, valid, p.url.Hostname())
+		}
+	}
+	return &a
+}
+
+// Close stops the SSHProxy, and closes all forwarded connections.
+func (p *SSHProxy) Close() error {
+	err := p.listener.Close()
+	p.mu.Lock()
+	for conn := range p.conns {
+		conn.Close()
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+	return err
+}
+
+func (p *SSHProxy) serve() {
+	defer p.wg.Done()
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.forward(conn)
+		}()
+	}
+}
+
+func (p *SSHProxy) forward(conn net.Conn) {
+	defer p.untrack(p.track(conn))
+	upstream, err := p.dialer.Dial("tcp", p.host)
+	if err != nil {
+		return
+	}
+	defer p.untrack(p.track(upstream))
+
+	done := make(chan struct{}, 2)
+	copyConn := func(dst, src net.Conn) {
+		_, _ = io.Copy(dst, src)
+		done <- struct{}{}
+	}
+	go copyConn(upstream, conn)
+	go copyConn(conn, upstream)
+	<-done
+}
+
+func (p *SSHProxy) track(conn net.Conn) net.Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.conns[conn] = struct{}{}
+	return conn
+}
+
+func (p *SSHProxy) untrack(conn net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.conns, conn)
+	conn.Close()
+}
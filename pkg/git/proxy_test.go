@@ -0,0 +1,209 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package git
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"testing"
+
+	gossh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	git2go "github.com/libgit2/git2go/v31"
+	"golang.org/x/crypto/ssh"
+)
+
+// newSOCKS5Server starts a minimal SOCKS5 server without authentication,
+// which sends the requested target addresses to the returned channel.
+func newSOCKS5Server(t *testing.T) (net.Listener, <-chan string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				header := make([]byte, 2)
+				if _, err := io.ReadFull(r, header); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(r, make([]byte, header[1])); err != nil {
+					return
+				}
+				conn.Write([]byte{5, 0})
+
+				req := make([]byte, 4)
+				if _, err := io.ReadFull(r, req); err != nil {
+					return
+				}
+				var host string
+				switch req[3] {
+				case 1:
+					ip := make([]byte, 4)
+					io.ReadFull(r, ip)
+					host = net.IP(ip).String()
+				case 3:
+					n, _ := r.ReadByte()
+					name := make([]byte, n)
+					io.ReadFull(r, name)
+					host = string(name)
+				default:
+					return
+				}
+				port := make([]byte, 2)
+				io.ReadFull(r, port)
+				target := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+				targets <- target
+
+				upstream, err := net.Dial("tcp", target)
+				if err != nil {
+					conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer upstream.Close()
+				conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+				go io.Copy(upstream, r)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return l, targets
+}
+
+// newEchoServer starts a TCP server writing back what it reads.
+func newEchoServer(t *testing.T) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l
+}
+
+func TestSSHProxy(t *testing.T) {
+	socks, targets := newSOCKS5Server(t)
+	defer socks.Close()
+	echo := newEchoServer(t)
+	defer echo.Close()
+
+	p, err := NewSSHProxy("socks5://"+socks.Addr().String(), "ssh://git@"+echo.Addr().String()+"/org/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	u, err := url.Parse(p.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.User.Username() != "git" || u.Path != "/org/repo" || u.Host == echo.Addr().String() {
+		t.Fatalf("URL() = %s, want local address with user and path", p.URL())
+	}
+
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(conn, b); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "ping" {
+		t.Errorf("forwarded response = %q, want %q", string(b), "ping")
+	}
+	if target := <-targets; target != echo.Addr().String() {
+		t.Errorf("proxy target = %s, want %s", target, echo.Addr().String())
+	}
+}
+
+func TestSSHProxy_Auth(t *testing.T) {
+	p, err := NewSSHProxy("socks5://127.0.0.1:1080", "ssh://git@example.com/org/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	var hostKeyHost, certHost string
+	auth := p.Auth(&Auth{
+		AuthMethod: &gossh.PublicKeys{
+			HostKeyCallbackHelper: gossh.HostKeyCallbackHelper{
+				HostKeyCallback: func(hostname string, _ net.Addr, _ ssh.PublicKey) error {
+					hostKeyHost = hostname
+					return nil
+				},
+			},
+		},
+		CertCallback: func(_ *git2go.Certificate, _ bool, hostname string) git2go.ErrorCode {
+			certHost = hostname
+			return git2go.ErrOk
+		},
+	})
+	auth.AuthMethod.(*gossh.PublicKeys).HostKeyCallback("127.0.0.1:1234", nil, nil)
+	auth.CertCallback(nil, true, "127.0.0.1")
+	if hostKeyHost != "example.com:22" {
+		t.Errorf("host key callback hostname = %s, want example.com:22", hostKeyHost)
+	}
+	if certHost != "example.com" {
+		t.Errorf("certificate callback hostname = %s, want example.com", certHost)
+	}
+}
+
+func TestNewSSHProxy(t *testing.T) {
+	tests := []struct {
+		name          string
+		proxyURL      string
+		repositoryURL string
+	}{
+		{name: "unsupported proxy scheme", proxyURL: "http://127.0.0.1:8080", repositoryURL: "ssh://git@example.com/org/repo"},
+		{name: "unsupported repository scheme", proxyURL: "socks5://127.0.0.1:1080", repositoryURL: "https://example.com/org/repo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if p, err := NewSSHProxy(tt.proxyURL, tt.repositoryURL); err == nil {
+				p.Close()
+				t.Error("NewSSHProxy() did not return an error")
+			}
+		})
+	}
+}
@@ -21,11 +21,15 @@ import (
 
 	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
 	"github.com/fluxcd/source-controller/pkg/git"
+	"github.com/fluxcd/source-controller/pkg/git/archive"
 	"github.com/fluxcd/source-controller/pkg/git/gogit"
 	"github.com/fluxcd/source-controller/pkg/git/libgit2"
 )
 
 func CheckoutStrategyForRef(ref *sourcev1.GitRepositoryRef, opt git.CheckoutOptions) (git.CheckoutStrategy, error) {
+	if opt.ArchiveProvider != "" {
+		return archive.CheckoutStrategyForRef(ref, opt)
+	}
 	switch opt.GitImplementation {
 	case sourcev1.GoGitImplementation:
 		return gogit.CheckoutStrategyForRef(ref, opt), nil
@@ -37,6 +41,10 @@ func CheckoutStrategyForRef(ref *sourcev1.GitRepositoryRef, opt git.CheckoutOpti
 }
 
 func AuthSecretStrategyForURL(url string, opt git.CheckoutOptions) (git.AuthSecretStrategy, error) {
+	// the API token of the archive provider is the password of the basic auth
+	if opt.ArchiveProvider != "" {
+		return gogit.AuthSecretStrategyForURL(url)
+	}
 	switch opt.GitImplementation {
 	case sourcev1.GoGitImplementation:
 		return gogit.AuthSecretStrategyForURL(url)
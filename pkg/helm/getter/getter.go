@@ -14,21 +14,24 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-package helm
+// Package getter provides the Helm getter options to authenticate against Helm
+// chart repositories with the credentials from a Kubernetes Secret, and a
+// Helm getter sending extra headers.
+package getter
 
 import (
 	"fmt"
 	"os"
 	"path/filepath"
 
-	"helm.sh/helm/v3/pkg/getter"
+	helmgetter "helm.sh/helm/v3/pkg/getter"
 	corev1 "k8s.io/api/core/v1"
 )
 
 // ClientOptionsFromSecret constructs a getter.Option slice for the given secret.
 // It returns the slice, and a callback to remove temporary files.
-func ClientOptionsFromSecret(secret corev1.Secret) ([]getter.Option, func(), error) {
-	var opts []getter.Option
+func ClientOptionsFromSecret(secret corev1.Secret) ([]helmgetter.Option, func(), error) {
+	var opts []helmgetter.Option
 	basicAuth, err := BasicAuthFromSecret(secret)
 	if err != nil {
 		return opts, nil, err
@@ -46,12 +49,24 @@ func ClientOptionsFromSecret(secret corev1.Secret) ([]getter.Option, func(), err
 	return opts, cleanup, nil
 }
 
+// ClientIdentityOption returns a getter.Option presenting the given
+// certificate and key files as the TLS client certificate, for a chart
+// repository with the given optional Secret. It returns nil if the Secret has
+// a certFile, keyFile or caFile, as the TLS client config of the Secret takes
+// precedence.
+func ClientIdentityOption(certFile, keyFile string, secret *corev1.Secret) helmgetter.Option {
+	if secret != nil && len(secret.Data["certFile"])+len(secret.Data["keyFile"])+len(secret.Data["caFile"]) > 0 {
+		return nil
+	}
+	return helmgetter.WithTLSClientConfig(certFile, keyFile, "")
+}
+
 // BasicAuthFromSecret attempts to construct a basic auth getter.Option for the
 // given v1.Secret and returns the result.
 //
 // Secrets with no username AND password are ignored, if only one is defined it
 // returns an error.
-func BasicAuthFromSecret(secret corev1.Secret) (getter.Option, error) {
+func BasicAuthFromSecret(secret corev1.Secret) (helmgetter.Option, error) {
 	username, password := string(secret.Data["username"]), string(secret.Data["password"])
 	switch {
 	case username == "" && password == "":
@@ -59,7 +74,7 @@ func BasicAuthFromSecret(secret corev1.Secret) (getter.Option, error) {
 	case username == "" || password == "":
 		return nil, fmt.Errorf("invalid '%s' secret data: required fields 'username' and 'password'", secret.Name)
 	}
-	return getter.WithBasicAuth(username, password), nil
+	return helmgetter.WithBasicAuth(username, password), nil
 }
 
 // TLSClientConfigFromSecret attempts to construct a TLS client config
@@ -68,7 +83,7 @@ func BasicAuthFromSecret(secret corev1.Secret) (getter.Option, error) {
 //
 // Secrets with no certFile, keyFile, AND caFile are ignored, if only a
 // certBytes OR keyBytes is defined it returns an error.
-func TLSClientConfigFromSecret(secret corev1.Secret) (getter.Option, func(), error) {
+func TLSClientConfigFromSecret(secret corev1.Secret) (helmgetter.Option, func(), error) {
 	certBytes, keyBytes, caBytes := secret.Data["certFile"], secret.Data["keyFile"], secret.Data["caFile"]
 	switch {
 	case len(certBytes)+len(keyBytes)+len(caBytes) == 0:
@@ -108,5 +123,5 @@ func TLSClientConfigFromSecret(secret corev1.Secret) (getter.Option, func(), err
 		}
 	}
 
-	return getter.WithTLSClientConfig(certFile, keyFile, caFile), cleanup, nil
+	return helmgetter.WithTLSClientConfig(certFile, keyFile, caFile), cleanup, nil
 }
@@ -0,0 +1,199 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package getter
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	helmgetter "helm.sh/helm/v3/pkg/getter"
+
+	"github.com/fluxcd/source-controller/pkg/trust"
+)
+
+// HTTPGetter is a getter.Getter of the HTTP/S chart repositories which sends
+// the requests with the given Headers, which the Helm HTTPGetter does not
+// support. It is otherwise configured with the Helm getter options, like the
+// Helm HTTPGetter.
+type HTTPGetter struct {
+	// Headers are the extra headers sent with the requests. The User-Agent
+	// set with getter.WithUserAgent takes precedence.
+	Headers http.Header
+
+	opts []helmgetter.Option
+}
+
+// NewHTTPGetter returns a new HTTPGetter configured with the given options.
+// It implements getter.Constructor.
+func NewHTTPGetter(options ...helmgetter.Option) (helmgetter.Getter, error) {
+	return &HTTPGetter{opts: options}, nil
+}
+
+// WithHeaders returns the given getter.Constructor, setting the given headers
+// on the HTTPGetters it returns.
+func WithHeaders(newGetter helmgetter.Constructor, headers http.Header) helmgetter.Constructor {
+	return func(options ...helmgetter.Option) (helmgetter.Getter, error) {
+		g, err := newGetter(options...)
+		if hg, ok := g.(*HTTPGetter); ok {
+			hg.Headers = headers
+		}
+		return g, err
+	}
+}
+
+// Get performs a GET request of the given URL and returns the body. The given
+// options are added to the ones of the HTTPGetter, as the Helm HTTPGetter
+// does.
+func (g *HTTPGetter) Get(href string, options ...helmgetter.Option) (*bytes.Buffer, error) {
+	g.opts = append(g.opts, options...)
+	opts := readOptions(g.opts...)
+
+	req, err := http.NewRequest(http.MethodGet, href, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range g.Headers {
+		req.Header[k] = v
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", "Helm/"+strings.TrimPrefix(chartutil.DefaultCapabilities.HelmVersion.Version, "v"))
+	}
+	if opts.userAgent != "" {
+		req.Header.Set("User-Agent", opts.userAgent)
+	}
+
+	// the credentials are only sent to the host of the repository, unless
+	// they are passed to all the hosts
+	u1, err := url.Parse(opts.url)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse getter URL: %w", err)
+	}
+	u2, err := url.Parse(href)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse URL getting from: %w", err)
+	}
+	if opts.passCredentialsAll || (u1.Scheme == u2.Scheme && u1.Host == u2.Host) {
+		if opts.username != "" && opts.password != "" {
+			req.SetBasicAuth(opts.username, opts.password)
+		}
+	}
+
+	transport, err := newTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Transport: transport, Timeout: opts.timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s : %s", href, resp.Status)
+	}
+	buf := bytes.NewBuffer(nil)
+	_, err = io.Copy(buf, resp.Body)
+	return buf, err
+}
+
+// newTransport returns the http.RoundTripper of the requests of a getter with
+// the given options, verifying the servers with the trust.Default Bundle and
+// the CA file of the options in addition to the system CA certificates.
+func newTransport(opts options) (http.RoundTripper, error) {
+	transport := &http.Transport{
+		DisableCompression: true,
+		Proxy:              http.ProxyFromEnvironment,
+	}
+	if (opts.certFile != "" && opts.keyFile != "") || opts.caFile != "" || opts.insecureSkipVerifyTLS {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: opts.insecureSkipVerifyTLS}
+	}
+	if opts.certFile != "" && opts.keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.certFile, opts.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't load key pair from cert %s and key %s: %w", opts.certFile, opts.keyFile, err)
+		}
+		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+	var caBundle []byte
+	if opts.caFile != "" {
+		pem, err := os.ReadFile(opts.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read CA file: %s", opts.caFile)
+		}
+		caBundle = pem
+	}
+	if transport.TLSClientConfig != nil && opts.url != "" {
+		u, err := url.Parse(opts.url)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig.ServerName = u.Hostname()
+	}
+	rt, err := trust.Transport(transport, caBundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to append certificates from file: %s", opts.caFile)
+	}
+	return rt, nil
+}
+
+// options are the settings of the Helm getter options read by the HTTPGetter.
+type options struct {
+	url                   string
+	certFile              string
+	keyFile               string
+	caFile                string
+	insecureSkipVerifyTLS bool
+	username              string
+	password              string
+	passCredentialsAll    bool
+	userAgent             string
+	timeout               time.Duration
+}
+
+// readOptions returns the settings of the given Helm getter options. Helm
+// does not export them: the options are applied to a value of their
+// unexported type, the fields of which are then read by name.
+func readOptions(opts ...helmgetter.Option) options {
+	v := reflect.New(reflect.TypeOf(helmgetter.Option(nil)).In(0).Elem())
+	for _, opt := range opts {
+		if opt != nil {
+			reflect.ValueOf(opt).Call([]reflect.Value{v})
+		}
+	}
+	o := v.Elem()
+	return options{
+		url:                   o.FieldByName("url").String(),
+		certFile:              o.FieldByName("certFile").String(),
+		keyFile:               o.FieldByName("keyFile").String(),
+		caFile:                o.FieldByName("caFile").String(),
+		insecureSkipVerifyTLS: o.FieldByName("insecureSkipVerifyTLS").Bool(),
+		username:              o.FieldByName("username").String(),
+		password:              o.FieldByName("password").String(),
+		passCredentialsAll:    o.FieldByName("passCredentialsAll").Bool(),
+		userAgent:             o.FieldByName("userAgent").String(),
+		timeout:               time.Duration(o.FieldByName("timeout").Int()),
+	}
+}
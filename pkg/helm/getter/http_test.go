@@ -0,0 +1,165 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package getter
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	helmgetter "helm.sh/helm/v3/pkg/getter"
+
+	"github.com/fluxcd/source-controller/pkg/trust"
+)
+
+func TestHTTPGetter_Get(t *testing.T) {
+	var got *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		w.Write([]byte("index"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		headers       http.Header
+		opts          []helmgetter.Option
+		wantHeaders   map[string]string
+		wantBasicAuth bool
+	}{
+		{
+			name:        "default User-Agent",
+			wantHeaders: map[string]string{"User-Agent": "Helm/"},
+		},
+		{
+			name:        "headers",
+			headers:     http.Header{"X-Cluster": []string{"prod-eu"}, "User-Agent": []string{"flux"}},
+			wantHeaders: map[string]string{"X-Cluster": "prod-eu", "User-Agent": "flux"},
+		},
+		{
+			name:        "User-Agent option takes precedence",
+			headers:     http.Header{"User-Agent": []string{"flux"}},
+			opts:        []helmgetter.Option{helmgetter.WithUserAgent("flux/podinfo")},
+			wantHeaders: map[string]string{"User-Agent": "flux/podinfo"},
+		},
+		{
+			name:          "credentials for the repository host",
+			opts:          []helmgetter.Option{helmgetter.WithURL(server.URL), helmgetter.WithBasicAuth("user", "password")},
+			wantBasicAuth: true,
+		},
+		{
+			name: "no credentials for another host",
+			opts: []helmgetter.Option{helmgetter.WithURL("https://charts.example.com"), helmgetter.WithBasicAuth("user", "password")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := WithHeaders(NewHTTPGetter, tt.headers)(tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := g.Get(server.URL + "/index.yaml")
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if b.String() != "index" {
+				t.Errorf("Get() = %q, want %q", b.String(), "index")
+			}
+			for k, v := range tt.wantHeaders {
+				if !strings.HasPrefix(got.Header.Get(k), v) {
+					t.Errorf("header %s = %q, want %q", k, got.Header.Get(k), v)
+				}
+			}
+			if _, _, ok := got.BasicAuth(); ok != tt.wantBasicAuth {
+				t.Errorf("basic auth = %v, want %v", ok, tt.wantBasicAuth)
+			}
+		})
+	}
+}
+
+func TestHTTPGetter_Get_status(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	g, _ := NewHTTPGetter()
+	if _, err := g.Get(server.URL + "/index.yaml"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Get() error = %v, want 404 status", err)
+	}
+}
+
+func TestHTTPGetter_Get_trust(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	g, _ := NewHTTPGetter()
+	if _, err := g.Get(server.URL + "/index.yaml"); err == nil {
+		t.Fatal("Get() returned no error for an untrusted server")
+	}
+
+	g, _ = NewHTTPGetter(helmgetter.WithTLSClientConfig("", "", caFile))
+	if _, err := g.Get(server.URL + "/index.yaml"); err != nil {
+		t.Errorf("Get() error = %v, want the CA file to be trusted", err)
+	}
+
+	bundle, err := trust.NewBundle(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trust.SetDefault(bundle)
+	defer trust.SetDefault(nil)
+	g, _ = NewHTTPGetter()
+	if _, err := g.Get(server.URL + "/index.yaml"); err != nil {
+		t.Errorf("Get() error = %v, want the default CA bundle to be trusted", err)
+	}
+}
+
+func Test_readOptions(t *testing.T) {
+	got := readOptions(
+		helmgetter.WithURL("https://charts.example.com"),
+		helmgetter.WithBasicAuth("user", "password"),
+		helmgetter.WithPassCredentialsAll(true),
+		helmgetter.WithUserAgent("flux"),
+		helmgetter.WithInsecureSkipVerifyTLS(true),
+		helmgetter.WithTLSClientConfig("cert.pem", "key.pem", "ca.pem"),
+		helmgetter.WithTimeout(time.Minute),
+		nil,
+	)
+	want := options{
+		url:                   "https://charts.example.com",
+		certFile:              "cert.pem",
+		keyFile:               "key.pem",
+		caFile:                "ca.pem",
+		insecureSkipVerifyTLS: true,
+		username:              "user",
+		password:              "password",
+		passCredentialsAll:    true,
+		userAgent:             "flux",
+		timeout:               time.Minute,
+	}
+	if got != want {
+		t.Errorf("readOptions() = %+v, want %+v", got, want)
+	}
+}
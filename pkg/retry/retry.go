@@ -0,0 +1,128 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package retry retries the idempotent downloads of the sources which fail
+// with a transient error, e.g. a connection reset or a timeout, so that an
+// almost complete fetch is not failed by a single interrupted request.
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+)
+
+// maxBackoff is the maximum delay between two attempts.
+const maxBackoff = 30 * time.Second
+
+// Policy is the retry policy of the downloads. A nil Policy makes a single
+// attempt.
+type Policy struct {
+	// Attempts is the maximum number of attempts, including the first one.
+	Attempts int
+	// Backoff is the delay before the second attempt, which is doubled
+	// before every next attempt.
+	Backoff time.Duration
+}
+
+// NewPolicy returns a Policy of the given maximum number of attempts and
+// initial backoff, or nil if there is at most one attempt.
+func NewPolicy(attempts int, backoff time.Duration) *Policy {
+	if attempts <= 1 {
+		return nil
+	}
+	return &Policy{Attempts: attempts, Backoff: backoff}
+}
+
+// Do calls fn until it succeeds, it returns an error that is not Transient,
+// the attempts are exhausted or the given context is done. The returned error
+// of a retried call is not Transient, so that the nested calls of Do do not
+// retry it again.
+func (p *Policy) Do(ctx context.Context, fn func() error) error {
+	err := fn()
+	if p == nil || err == nil || !Transient(err) {
+		return err
+	}
+	backoff := p.Backoff
+	for attempt := 2; attempt <= p.Attempts; attempt++ {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return &exhaustedError{err: err}
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		if err = fn(); err == nil || !Transient(err) {
+			return err
+		}
+	}
+	return &exhaustedError{err: err}
+}
+
+// exhaustedError is the last error of the attempts of a Policy.
+type exhaustedError struct {
+	err error
+}
+
+func (e *exhaustedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exhaustedError) Unwrap() error {
+	return e.err
+}
+
+// Transient returns true if the given error is a network error which may not
+// happen again, i.e. a timeout, a connection reset, refused or closed by the
+// peer, or a response body cut short. The errors of the cancelled contexts and
+// the ones already retried by a Policy are not transient.
+func Transient(err error) bool {
+	var exhausted *exhaustedError
+	if err == nil || errors.As(err, &exhausted) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+type policyKey struct{}
+
+// WithPolicy returns a copy of the given context carrying the given Policy,
+// which retries the downloads of the clients called with the context.
+func WithPolicy(ctx context.Context, p *Policy) context.Context {
+	if p == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, policyKey{}, p)
+}
+
+// FromContext returns the Policy carried by the given context, or nil.
+func FromContext(ctx context.Context) *Policy {
+	p, _ := ctx.Value(policyKey{}).(*Policy)
+	return p
+}
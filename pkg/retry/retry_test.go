@@ -0,0 +1,127 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestPolicy_Do(t *testing.T) {
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	permanent := errors.New("access denied")
+
+	tests := []struct {
+		name      string
+		policy    *Policy
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "success", policy: NewPolicy(3, time.Millisecond), errs: []error{nil}, wantCalls: 1},
+		{name: "transient", policy: NewPolicy(3, time.Millisecond), errs: []error{reset, io.ErrUnexpectedEOF, nil}, wantCalls: 3},
+		{name: "permanent", policy: NewPolicy(3, time.Millisecond), errs: []error{reset, permanent}, wantCalls: 2, wantErr: permanent},
+		{name: "exhausted", policy: NewPolicy(2, time.Millisecond), errs: []error{reset, reset}, wantCalls: 2, wantErr: reset},
+		{name: "nil policy", errs: []error{reset}, wantCalls: 1, wantErr: reset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := tt.policy.Do(context.TODO(), func() error {
+				err := tt.errs[calls]
+				calls++
+				return err
+			})
+			if calls != tt.wantCalls {
+				t.Errorf("called %d times, want %d", calls, tt.wantCalls)
+			}
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("Do() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicy_Do_Nested(t *testing.T) {
+	p := NewPolicy(2, time.Millisecond)
+	calls := 0
+	err := p.Do(context.TODO(), func() error {
+		return p.Do(context.TODO(), func() error {
+			calls++
+			return io.ErrUnexpectedEOF
+		})
+	})
+	if calls != 2 {
+		t.Errorf("called %d times, want 2", calls)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Do() error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestPolicy_Do_Context(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	calls := 0
+	err := NewPolicy(3, time.Hour).Do(ctx, func() error {
+		calls++
+		return io.ErrUnexpectedEOF
+	})
+	if calls != 1 || err == nil {
+		t.Errorf("called %d times with error %v, want a single failed call", calls, err)
+	}
+}
+
+func TestTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: fmt.Errorf("read: %w", syscall.ECONNRESET), want: true},
+		{err: io.ErrUnexpectedEOF, want: true},
+		{err: &net.DNSError{Err: "timeout", IsTimeout: true}, want: true},
+		{err: &net.DNSError{Err: "no such host", IsNotFound: true}, want: false},
+		{err: fmt.Errorf("get: %w", context.DeadlineExceeded), want: false},
+		{err: errors.New("403 Forbidden"), want: false},
+		{err: nil, want: false},
+	}
+	for _, tt := range tests {
+		if got := Transient(tt.err); got != tt.want {
+			t.Errorf("Transient(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWithPolicy(t *testing.T) {
+	p := NewPolicy(2, time.Second)
+	if got := FromContext(WithPolicy(context.TODO(), p)); got != p {
+		t.Errorf("FromContext() = %v, want %v", got, p)
+	}
+	if got := FromContext(context.TODO()); got != nil {
+		t.Errorf("FromContext() = %v, want nil", got)
+	}
+	if NewPolicy(1, time.Second) != nil {
+		t.Error("NewPolicy() is not nil for a single attempt")
+	}
+}
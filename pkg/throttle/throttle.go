@@ -0,0 +1,225 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package throttle limits the bandwidth of the downloads of the sources, for
+// the bursts of reconciliations not to saturate the egress of the cluster.
+package throttle
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fluxcd/source-controller/pkg/trust"
+)
+
+const (
+	// burst is the duration of the bandwidth a Limiter allows to be used at
+	// once after being idle.
+	burst = time.Second
+	// maxChunk is the maximum number of bytes read at once from a throttled
+	// reader, for the waits to be spread evenly.
+	maxChunk = 32 * 1024
+)
+
+// Limiter limits the bandwidth shared by the readers it throttles. A nil
+// Limiter does not limit the bandwidth. It is safe for concurrent use.
+type Limiter struct {
+	bytesPerSecond int64
+
+	mu sync.Mutex
+	// next is the time at which the bytes read so far are within the limit.
+	next time.Time
+}
+
+// NewLimiter returns a Limiter of the given bytes per second, or nil if it
+// is not positive.
+func NewLimiter(bytesPerSecond int64) *Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &Limiter{bytesPerSecond: bytesPerSecond}
+}
+
+// WaitN blocks until n more bytes can be read within the limit, or the
+// given context is done.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if earliest := now.Add(-burst); l.next.Before(earliest) {
+		l.next = earliest
+	}
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.bytesPerSecond))
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type limitersKey struct{}
+
+// WithLimiters returns a copy of the given context carrying the given
+// Limiters in addition to the ones of the context, which throttle the
+// responses of the requests sent with the context through a Transport.
+func WithLimiters(ctx context.Context, limiters ...*Limiter) context.Context {
+	all := FromContext(ctx)
+	for _, l := range limiters {
+		if l != nil {
+			all = append(all, l)
+		}
+	}
+	if len(all) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, limitersKey{}, all)
+}
+
+// FromContext returns the Limiters carried by the given context.
+func FromContext(ctx context.Context) []*Limiter {
+	limiters, _ := ctx.Value(limitersKey{}).([]*Limiter)
+	// the slice is copied for the callers to append to it
+	return append([]*Limiter(nil), limiters...)
+}
+
+// NewReader returns a reader throttled by the given Limiters, which unblocks
+// when the given context is done. The given reader is returned as is if no
+// Limiter is given.
+func NewReader(ctx context.Context, r io.Reader, limiters ...*Limiter) io.Reader {
+	var active []*Limiter
+	for _, l := range limiters {
+		if l != nil {
+			active = append(active, l)
+		}
+	}
+	if len(active) == 0 {
+		return r
+	}
+	return &reader{ctx: ctx, r: r, limiters: active}
+}
+
+type reader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*Limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > maxChunk {
+		p = p[:maxChunk]
+	}
+	n, err := r.r.Read(p)
+	for _, l := range r.limiters {
+		if werr := l.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// NewWriter returns a writer throttled by the given Limiters, which unblocks
+// when the given context is done. It is meant for the clients writing the
+// downloads to a writer without passing the context to their requests. The
+// given writer is returned as is if no Limiter is given.
+func NewWriter(ctx context.Context, w io.Writer, limiters ...*Limiter) io.Writer {
+	var active []*Limiter
+	for _, l := range limiters {
+		if l != nil {
+			active = append(active, l)
+		}
+	}
+	if len(active) == 0 {
+		return w
+	}
+	return &writer{ctx: ctx, w: w, limiters: active}
+}
+
+type writer struct {
+	ctx      context.Context
+	w        io.Writer
+	limiters []*Limiter
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > maxChunk {
+			chunk = chunk[:maxChunk]
+		}
+		for _, l := range w.limiters {
+			if err := l.WaitN(w.ctx, len(chunk)); err != nil {
+				return written, err
+			}
+		}
+		n, err := w.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// Transport returns an http.RoundTripper throttling the bodies of the
+// responses to the requests sent with the given http.RoundTripper, by the
+// Limiters of the context of the requests, or with trust.DefaultTransport
+// if nil.
+func Transport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = trust.DefaultTransport
+	}
+	return &transport{rt: rt}
+}
+
+type transport struct {
+	rt http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if limiters := FromContext(req.Context()); len(limiters) > 0 && resp.Body != nil {
+		resp.Body = &body{
+			Reader: NewReader(req.Context(), resp.Body, limiters...),
+			Closer: resp.Body,
+		}
+	}
+	return resp, nil
+}
+
+type body struct {
+	io.Reader
+	io.Closer
+}
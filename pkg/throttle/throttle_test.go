@@ -0,0 +1,124 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package throttle
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewReader(t *testing.T) {
+	// the first second of bandwidth is allowed at once
+	l := NewLimiter(64 * 1024)
+	data := bytes.Repeat([]byte("a"), 96*1024)
+
+	start := time.Now()
+	n, err := io.Copy(io.Discard, NewReader(context.TODO(), bytes.NewReader(data), l))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) {
+		t.Errorf("read %d bytes, want %d", n, len(data))
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("read in %s, want about 500ms", elapsed)
+	}
+}
+
+func TestNewReader_Context(t *testing.T) {
+	l := NewLimiter(1024)
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := io.Copy(io.Discard, NewReader(ctx, bytes.NewReader(make([]byte, 4096)), l))
+	if err != context.DeadlineExceeded {
+		t.Errorf("error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestNewReader_Unlimited(t *testing.T) {
+	r := bytes.NewReader(nil)
+	if got := NewReader(context.TODO(), r, NewLimiter(0), nil); got != r {
+		t.Errorf("NewReader() = %T, want the given reader", got)
+	}
+}
+
+func TestWithLimiters(t *testing.T) {
+	a, b := NewLimiter(1), NewLimiter(2)
+	ctx := WithLimiters(context.TODO(), a, nil)
+	ctx = WithLimiters(ctx, b)
+	if got := FromContext(ctx); len(got) != 2 || got[0] != a || got[1] != b {
+		t.Errorf("FromContext() = %v, want both limiters", got)
+	}
+	if got := FromContext(context.TODO()); len(got) != 0 {
+		t.Errorf("FromContext() = %v, want none", got)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 4096))
+	}))
+	defer server.Close()
+
+	c := &http.Client{Transport: Transport(nil)}
+	ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(WithLimiters(ctx, NewLimiter(1024)), http.MethodGet, server.URL, nil)
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.ReadAll(resp.Body); err == nil {
+		t.Error("read the body within the deadline, want it throttled")
+	}
+
+	req, _ = http.NewRequestWithContext(context.TODO(), http.MethodGet, server.URL, nil)
+	resp, err = c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if data, err := io.ReadAll(resp.Body); err != nil || len(data) != 4096 {
+		t.Errorf("read %d bytes, %v, want the unthrottled body", len(data), err)
+	}
+}
+
+func TestNewWriter(t *testing.T) {
+	l := NewLimiter(1024)
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+
+	var buf bytes.Buffer
+	n, err := NewWriter(ctx, &buf, l).Write(make([]byte, 4096))
+	if err != context.DeadlineExceeded {
+		t.Errorf("error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if n != buf.Len() {
+		t.Errorf("wrote %d bytes, want %d", n, buf.Len())
+	}
+
+	if got := NewWriter(context.TODO(), &buf); got != &buf {
+		t.Errorf("NewWriter() = %T, want the given writer", got)
+	}
+}
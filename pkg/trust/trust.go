@@ -0,0 +1,228 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package trust provides the CA certificates trusted to verify the TLS
+// servers of the sources, in addition to the system ones, from PEM files
+// loaded again when they change, e.g. when the ConfigMap mounting them is
+// updated, for the rotation of a CA not to require a restart.
+package trust
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// checkInterval is the minimum interval between two checks of the
+// modification time of the files of a Bundle, for the requests not to stat
+// them each.
+const checkInterval = 10 * time.Second
+
+// Bundle holds the CA certificates of a list of PEM files. The files are
+// loaded again when their modification time changes, which is checked at
+// most once every checkInterval. It is safe for concurrent use.
+type Bundle struct {
+	files         []string
+	checkInterval time.Duration
+
+	mu       sync.Mutex
+	certs    [][]byte
+	modTimes []time.Time
+	checked  time.Time
+	// generation is incremented each time the files are loaded.
+	generation int
+}
+
+// NewBundle returns a Bundle of the given files, failing if one of them can
+// not be read or holds no PEM encoded certificate.
+func NewBundle(files ...string) (*Bundle, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no CA bundle file")
+	}
+	b := &Bundle{files: files, checkInterval: checkInterval}
+	if err := b.reload(); err != nil {
+		return nil, err
+	}
+	b.checked = time.Now()
+	return b, nil
+}
+
+// Generation returns the number of times the files were loaded, loading them
+// again first if one of them has been modified since, and they were not
+// checked for the checkInterval. Between two checks, the generation loaded
+// last is returned. A file which can not be loaded, e.g. while it is being
+// replaced, is ignored until it can, the certificates loaded previously being
+// kept.
+func (b *Bundle) Generation() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now := time.Now(); now.Sub(b.checked) >= b.checkInterval {
+		b.checked = now
+		_ = b.reload()
+	}
+	return b.generation
+}
+
+// reload loads the files if they are not loaded yet or one of them has been
+// modified since. It must be called with the lock held.
+func (b *Bundle) reload() error {
+	modTimes := make([]time.Time, len(b.files))
+	changed := b.certs == nil
+	for i, f := range b.files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		modTimes[i] = info.ModTime()
+		changed = changed || !modTimes[i].Equal(b.modTimes[i])
+	}
+	if !changed {
+		return nil
+	}
+
+	certs := make([][]byte, len(b.files))
+	for i, f := range b.files {
+		pem, err := os.ReadFile(f)
+		if err != nil {
+			return fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+			return fmt.Errorf("invalid CA bundle '%s': no PEM encoded certificate found", f)
+		}
+		certs[i] = pem
+	}
+	b.certs = certs
+	b.modTimes = modTimes
+	b.generation++
+	return nil
+}
+
+// pool returns a new pool of the system CA certificates and the ones loaded
+// last by the Bundle, and their generation.
+func (b *Bundle) pool() (*x509.CertPool, int) {
+	pool, _ := x509.SystemCertPool()
+	if pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if b == nil {
+		return pool, 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, pem := range b.certs {
+		pool.AppendCertsFromPEM(pem)
+	}
+	return pool, b.generation
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultBundle *Bundle
+)
+
+// SetDefault sets the Bundle trusted by the transports of this package, in
+// addition to the system CA certificates.
+func SetDefault(b *Bundle) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultBundle = b
+}
+
+// Default returns the Bundle set with SetDefault, or nil.
+func Default() *Bundle {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultBundle
+}
+
+// DefaultTransport is http.DefaultTransport verifying the server
+// certificates with the default Bundle in addition to the system CA
+// certificates.
+var DefaultTransport http.RoundTripper = &transport{base: http.DefaultTransport.(*http.Transport)}
+
+// Transport returns an http.RoundTripper sending the requests with a clone
+// of the given http.Transport verifying the server certificates with the
+// system CA certificates, the ones of the default Bundle, and the given PEM
+// encoded CA bundle if not empty. The other settings of the TLS client
+// config of the given http.Transport are kept. The clone is replaced when the
+// default Bundle changes, the idle connections of the previous one being
+// closed. Without default Bundle nor CA bundle, the given http.Transport is
+// used as is.
+func Transport(base *http.Transport, caBundle []byte) (http.RoundTripper, error) {
+	if len(caBundle) > 0 && !x509.NewCertPool().AppendCertsFromPEM(caBundle) {
+		return nil, fmt.Errorf("invalid CA bundle: no PEM encoded certificate found")
+	}
+	return &transport{base: base, caBundle: caBundle}, nil
+}
+
+type transport struct {
+	base     *http.Transport
+	caBundle []byte
+
+	mu         sync.Mutex
+	current    *http.Transport
+	generation int
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.transport().RoundTrip(req)
+}
+
+// transport returns the clone of the base transport trusting the current
+// generation of the default Bundle, cloning it again if it has changed.
+func (t *transport) transport() *http.Transport {
+	b := Default()
+	if b == nil && len(t.caBundle) == 0 {
+		return t.base
+	}
+	generation := 0
+	if b != nil {
+		generation = b.Generation()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current != nil && t.generation == generation {
+		return t.current
+	}
+	pool, generation := b.pool()
+	pool.AppendCertsFromPEM(t.caBundle)
+	current := t.base.Clone()
+	if current.TLSClientConfig == nil {
+		current.TLSClientConfig = &tls.Config{}
+	}
+	current.TLSClientConfig.RootCAs = pool
+	if t.current != nil {
+		t.current.CloseIdleConnections()
+	}
+	t.current, t.generation = current, generation
+	return current
+}
+
+// CloseIdleConnections closes the idle connections of the current clone of
+// the base transport.
+func (t *transport) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current != nil {
+		t.current.CloseIdleConnections()
+	}
+	t.base.CloseIdleConnections()
+}
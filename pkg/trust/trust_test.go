@@ -0,0 +1,222 @@
+/*
+Copyright 2021 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trust
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA is a self-signed CA issuing the certificates of the test servers.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// server returns a started TLS server with a certificate of the CA for
+// 127.0.0.1.
+func (ca *testCA) server(t *testing.T) *httptest.Server {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func writeFile(t *testing.T, path string, b []byte, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func get(rt http.RoundTripper, url string) error {
+	resp, err := (&http.Client{Transport: rt}).Get(url)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func TestTransport(t *testing.T) {
+	t.Cleanup(func() { SetDefault(nil) })
+
+	ca1, ca2, ca3 := newTestCA(t, "ca1"), newTestCA(t, "ca2"), newTestCA(t, "ca3")
+	server1, server2, server3 := ca1.server(t), ca2.server(t), ca3.server(t)
+
+	rt := DefaultTransport
+	if err := get(rt, server1.URL); err == nil {
+		t.Fatal("get() returned no error without CA bundle")
+	}
+
+	file := filepath.Join(t.TempDir(), "ca.pem")
+	now := time.Now()
+	writeFile(t, file, ca1.pem, now)
+	bundle, err := NewBundle(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle.checkInterval = 0
+	SetDefault(bundle)
+	if err := get(rt, server1.URL); err != nil {
+		t.Fatalf("get() error = %v, want the CA bundle to be trusted", err)
+	}
+
+	// the rotated CA is trusted without a new transport
+	writeFile(t, file, ca2.pem, now.Add(time.Minute))
+	if err := get(rt, server2.URL); err != nil {
+		t.Fatalf("get() error = %v, want the rotated CA bundle to be trusted", err)
+	}
+	if err := get(rt, server1.URL); err == nil {
+		t.Error("get() returned no error for the CA removed from the bundle")
+	}
+	if got := bundle.Generation(); got != 2 {
+		t.Errorf("Generation() = %d, want 2", got)
+	}
+
+	// an invalid file keeps the previous certificates
+	writeFile(t, file, []byte("invalid"), now.Add(2*time.Minute))
+	if err := get(rt, server2.URL); err != nil {
+		t.Errorf("get() error = %v, want the previous CA bundle to be kept", err)
+	}
+
+	// the CA bundle of a transport is trusted along the default bundle
+	rt, err = Transport(http.DefaultTransport.(*http.Transport), ca3.pem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, server := range []*httptest.Server{server2, server3} {
+		if err := get(rt, server.URL); err != nil {
+			t.Errorf("get(%s) error = %v", server.URL, err)
+		}
+	}
+	if _, err := Transport(http.DefaultTransport.(*http.Transport), []byte("invalid")); err == nil {
+		t.Error("Transport() returned no error for an invalid CA bundle")
+	}
+}
+
+func TestNewBundle(t *testing.T) {
+	dir := t.TempDir()
+	valid, invalid := filepath.Join(dir, "valid.pem"), filepath.Join(dir, "invalid.pem")
+	writeFile(t, valid, newTestCA(t, "ca").pem, time.Now())
+	writeFile(t, invalid, []byte("invalid"), time.Now())
+
+	tests := []struct {
+		name    string
+		files   []string
+		wantErr bool
+	}{
+		{name: "valid", files: []string{valid}},
+		{name: "no file", wantErr: true},
+		{name: "missing file", files: []string{valid, filepath.Join(dir, "missing.pem")}, wantErr: true},
+		{name: "no certificate", files: []string{valid, invalid}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewBundle(tt.files...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewBundle() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Generation() != 1 {
+				t.Errorf("Generation() = %d, want 1", got.Generation())
+			}
+		})
+	}
+}
+
+func TestBundle_Generation(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ca.pem")
+	now := time.Now()
+	writeFile(t, file, newTestCA(t, "ca1").pem, now)
+	bundle, err := NewBundle(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the files are not checked again before the check interval
+	writeFile(t, file, newTestCA(t, "ca2").pem, now.Add(time.Minute))
+	if got := bundle.Generation(); got != 1 {
+		t.Errorf("Generation() = %d before the check interval, want 1", got)
+	}
+
+	bundle.checked = bundle.checked.Add(-checkInterval)
+	if got := bundle.Generation(); got != 2 {
+		t.Errorf("Generation() = %d after the check interval, want 2", got)
+	}
+	if got := bundle.Generation(); got != 2 {
+		t.Errorf("Generation() = %d without change, want 2", got)
+	}
+}